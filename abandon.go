@@ -0,0 +1,196 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// AbandonedProgress returns the progress of the partial run a Down undoes when
+// the engine abandons an interrupted chunked migration, or nil in a regular
+// rollback. A Down that gets it only needs to undo the data up to its Cursor.
+func (c *MigrationContext) AbandonedProgress() *MigrationProgress {
+	return c.abandoned
+}
+
+// AbandonMigration rolls back the partial run of a chunked migration that was
+// interrupted and will not be resumed, restoring the state before the migration
+// without restoring a backup. Only the chunks the run committed are undone: by
+// restoring their pre-images if the migration records them (see
+// Migration.ChunkPreImages), and otherwise with its Down, which gets the saved
+// progress through MigrationContext.AbandonedProgress. A plain Down must cope
+// with partially migrated data.
+//
+// The migration, which may be named by a former ID registered as an alias, must
+// not be applied and must have saved progress running up.
+// On success the progress is cleared, a rollback is recorded and the status is
+// clean. Pre-images are restored one chunk at a time, so an interrupted
+// abandon continues where it stopped when called again. While a plan is
+// executing on the database, AbandonMigration fails with ErrConcurrentExecution.
+func (e *MigrationEngine) AbandonMigration(migrationID string, progress ProgressReporter) error {
+	if progress == nil {
+		progress = ProgressFunc(nil)
+	}
+	migrationID = e.registry.ResolveID(migrationID)
+	end, err := e.claim("abandon of " + migrationID)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	migration, ok := e.registry.GetMigration(migrationID)
+	if !ok {
+		return fmt.Errorf("migration '%s' not found", migrationID)
+	}
+	applied, err := e.schemaManager.IsMigrationApplied(migrationID)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return fmt.Errorf("migration %s is applied; roll it back with a downgrade", migrationID)
+	}
+	saved, err := e.schemaManager.GetMigrationProgress(migrationID)
+	if err != nil {
+		return err
+	}
+	if saved == nil || saved.Direction != "up" {
+		return fmt.Errorf("%w: %s", ErrNoSavedProgress, migrationID)
+	}
+	if !migration.ChunkPreImages && migration.Down == nil && migration.DownContext == nil {
+		return fmt.Errorf("migration %s has no down function and records no chunk pre-images", migrationID)
+	}
+
+	if e.dryRun {
+		reportf(progress, ProgressDryRun, "DRY RUN: Would roll back %d chunk(s) of %s", saved.Chunks, migrationID)
+		return nil
+	}
+
+	if e.enableBackup && e.backupManager != nil {
+		reportf(progress, ProgressBackup, "Creating database backup before rollback...")
+		if err := e.createBackup(fmt.Sprintf("Before abandoning %s", migrationID), progress); err != nil {
+			return fmt.Errorf("failed to create backup before rollback: %w", err)
+		}
+	}
+
+	progress.Report(migrationEvent(ProgressMigrationStarted, 1, 1, 0, migration, "down",
+		fmt.Sprintf("Rolling back %d chunk(s) of %s", saved.Chunks, migrationID)))
+	started := StepEvent{Step: StepMarkStarted, MigrationID: migrationID, Direction: "down"}
+	if err := e.interceptStep(started, e.schemaManager.MarkRollbackStarted); err != nil {
+		return fmt.Errorf("failed to mark rollback as started: %w", err)
+	}
+
+	start := time.Now()
+	run := func() error {
+		if migration.ChunkPreImages {
+			return e.undoChunks(migrationID, progress)
+		}
+		return e.downPartial(migration, saved, progress)
+	}
+	execute := StepEvent{Step: StepExecute, MigrationID: migrationID, Direction: "down"}
+	if migration.AllowInternalWrites {
+		err = e.interceptStep(execute, run)
+	} else {
+		err = e.schemaManager.guardReservedKeys(migrationID, func() error { return e.interceptStep(execute, run) })
+	}
+	description := fmt.Sprintf("%s (partial run, %d chunks)", migration.Description, saved.Chunks)
+	if err != nil {
+		if markErr := e.schemaManager.markFailed(migrationID, RecordRollback, "Rollback: "+description, time.Since(start), err); markErr != nil {
+			return fmt.Errorf("rollback failed and failed to mark as failed: %w (original error: %v)", markErr, err)
+		}
+		return fmt.Errorf("rollback of the partial run of %s failed: %w", migrationID, err)
+	}
+
+	if err := e.schemaManager.ClearMigrationProgress(migrationID); err != nil {
+		return err
+	}
+	record := StepEvent{Step: StepRecord, MigrationID: migrationID, Direction: "down"}
+	if err := e.interceptStep(record, func() error {
+		return e.schemaManager.UpdateAfterRollback(migrationID, migration.Version, description, time.Since(start))
+	}); err != nil {
+		return fmt.Errorf("failed to update schema after rollback of %s: %w", migrationID, err)
+	}
+
+	progress.Report(migrationEvent(ProgressMigrationCompleted, 1, 1, 1, migration, "down",
+		fmt.Sprintf("Partial run of %s rolled back", migrationID)))
+	return nil
+}
+
+// undoChunks restores the pre-images of the committed chunks of a migration,
+// last chunk first. Each chunk is restored and its pre-images are deleted in one
+// batch. Unless undo is forced, the keys must still have the values the chunk
+// left; otherwise ErrOpLogConflict is returned.
+func (e *MigrationEngine) undoChunks(migrationID string, progress ProgressReporter) error {
+	prefix := e.schemaManager.preImagePrefix(migrationID)
+	for {
+		key, data, err := lastKeyWithPrefix(e.db, prefix)
+		if err != nil || key == nil {
+			return err
+		}
+
+		log := &OpLog{}
+		if err := log.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		if !e.forceUndo {
+			conflicts, err := checkStates(e.db, log.finalStates())
+			if err != nil {
+				return err
+			}
+			if len(conflicts) > 0 {
+				return fmt.Errorf("%w: keys changed since chunk %s of %s: %s", ErrOpLogConflict, key[len(prefix):], migrationID, summarizeKeys(conflicts))
+			}
+		}
+
+		batch := e.db.NewBatch()
+		for i := len(log.Ops) - 1; i >= 0; i-- {
+			op := log.Ops[i]
+			if op.Existed {
+				err = batch.Set(op.Key, op.Previous, nil)
+			} else {
+				err = batch.Delete(op.Key, nil)
+			}
+			if err != nil {
+				batch.Close()
+				return err
+			}
+		}
+		if err := batch.Delete(key, nil); err != nil {
+			batch.Close()
+			return err
+		}
+		err = batch.Commit(pebble.Sync)
+		batch.Close()
+		if err != nil {
+			return err
+		}
+		reportf(progress, ProgressMigration, "%s: chunk %s rolled back (%d keys)", migrationID, key[len(prefix):], len(log.Ops))
+	}
+}
+
+// downPartial runs the Down of a migration to undo its partial run
+func (e *MigrationEngine) downPartial(migration *Migration, saved *MigrationProgress, progress ProgressReporter) error {
+	if migration.DownContext == nil {
+		return migration.Down(e.db)
+	}
+	ctx := newMigrationContext(context.Background(), e.db, migration.ID, "down", e.log(), progress)
+	ctx.schemaManager = e.schemaManager
+	ctx.abandoned = saved
+	return migration.DownContext(ctx)
+}
+
+// lastKeyWithPrefix returns the last key with prefix and a copy of its value, or
+// a nil key if there is none
+func lastKeyWithPrefix(db *pebble.DB, prefix []byte) ([]byte, []byte, error) {
+	iter, err := db.NewIter(&pebble.IterOptions{LowerBound: prefix, UpperBound: prefixUpperBound(prefix)})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iter.Close()
+
+	if !iter.Last() {
+		return nil, nil, iter.Error()
+	}
+	return append([]byte(nil), iter.Key()...), append([]byte(nil), iter.Value()...), nil
+}
@@ -0,0 +1,204 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// chunkedBackfill returns a migration that writes item/0 to item/5 in chunks of
+// two, failing before the third chunk while *interrupt is set
+func chunkedBackfill(interrupt *bool) *Migration {
+	return &Migration{
+		ID:          "1754917200_backfill",
+		Description: "Backfill items",
+		UpContext: func(ctx *MigrationContext) error {
+			for i := 0; i < 6; i += 2 {
+				if *interrupt && i == 4 {
+					return errors.New("interrupted")
+				}
+				chunk := ctx.NewChunk()
+				chunk.Set([]byte(fmt.Sprintf("item/%d", i)), []byte("new"))
+				chunk.Set([]byte(fmt.Sprintf("item/%d", i+1)), []byte("new"))
+				err := chunk.Commit([]byte(fmt.Sprintf("item/%d", i+1)), float64(i+2)*100/6)
+				chunk.Close()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func TestAbandonMigrationPreImages(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	if err := db.Set([]byte("item/0"), []byte("old"), pebble.Sync); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	interrupt := true
+	migration := chunkedBackfill(&interrupt)
+	migration.ChunkPreImages = true
+	migration.Down = func(db *pebble.DB) error { return errors.New("not used with pre-images") }
+	if err := registry.Register(migration); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err == nil {
+		t.Fatalf("Expected the first run to fail")
+	}
+
+	diagnosis, err := schemaManager.DiagnoseRecovery(registry, nil)
+	if err != nil {
+		t.Fatalf("Failed to diagnose: %v", err)
+	}
+	expected := []RecoveryStep{RecoveryRerun, RecoveryAbandon}
+	if fmt.Sprint(diagnosis.Steps) != fmt.Sprint(expected) {
+		t.Errorf("Expected steps %v, got %v", expected, diagnosis.Steps)
+	}
+
+	if err := engine.AbandonMigration(migration.ID, nil); err != nil {
+		t.Fatalf("Failed to abandon: %v", err)
+	}
+
+	if value, err := getCopy(db, []byte("item/0")); err != nil || string(value) != "old" {
+		t.Errorf("Expected item/0 to be restored, got %q, %v", value, err)
+	}
+	for i := 1; i < 6; i++ {
+		if _, err := getCopy(db, []byte(fmt.Sprintf("item/%d", i))); err != pebble.ErrNotFound {
+			t.Errorf("Expected item/%d to be removed, got %v", i, err)
+		}
+	}
+	if p, err := schemaManager.GetMigrationProgress(migration.ID); err != nil || p != nil {
+		t.Errorf("Expected the progress to be cleared, got %+v, %v", p, err)
+	}
+	if key, _, err := lastKeyWithPrefix(db, schemaManager.preImagePrefix(migration.ID)); err != nil || key != nil {
+		t.Errorf("Expected the pre-images to be removed, got %q, %v", key, err)
+	}
+
+	schema, err := schemaManager.GetSchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	last := schema.MigrationHistory[len(schema.MigrationHistory)-1]
+	if schema.Status != StatusClean || last.Type != RecordRollback || !last.Success {
+		t.Errorf("Expected a clean state with a rollback record, got %s, %+v", schema.Status, last)
+	}
+
+	// The migration runs again from the start
+	interrupt = false
+	plan, err = NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to rerun: %v", err)
+	}
+	if value, err := getCopy(db, []byte("item/5")); err != nil || string(value) != "new" {
+		t.Errorf("Expected item/5 to be written, got %q, %v", value, err)
+	}
+
+	if err := engine.AbandonMigration(migration.ID, nil); err == nil {
+		t.Errorf("Expected abandoning an applied migration to fail")
+	}
+}
+
+func TestAbandonMigrationDown(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	interrupt := true
+	var abandoned *MigrationProgress
+	migration := chunkedBackfill(&interrupt)
+	migration.DownContext = func(ctx *MigrationContext) error {
+		abandoned = ctx.AbandonedProgress()
+		last := 5
+		if abandoned != nil {
+			fmt.Sscanf(string(abandoned.Cursor), "item/%d", &last)
+		}
+		for i := 0; i <= last; i++ {
+			if err := ctx.DB.Delete([]byte(fmt.Sprintf("item/%d", i)), pebble.Sync); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := registry.Register(migration); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if err := registry.RegisterAlias("1754917100_backfill", migration.ID); err != nil {
+		t.Fatalf("Failed to register alias: %v", err)
+	}
+
+	if err := engine.AbandonMigration(migration.ID, nil); !errors.Is(err, ErrNoSavedProgress) {
+		t.Fatalf("Expected ErrNoSavedProgress before any run, got %v", err)
+	}
+
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err == nil {
+		t.Fatalf("Expected the first run to fail")
+	}
+
+	// Abandoning is offered with DownContext alone
+	diagnosis, err := schemaManager.DiagnoseRecovery(registry, nil)
+	if err != nil {
+		t.Fatalf("Failed to diagnose: %v", err)
+	}
+	expected := []RecoveryStep{RecoveryRerun, RecoveryAbandon}
+	if fmt.Sprint(diagnosis.Steps) != fmt.Sprint(expected) {
+		t.Errorf("Expected steps %v, got %v", expected, diagnosis.Steps)
+	}
+
+	// The migration is abandoned by its former ID
+	var messages []string
+	if err := engine.AbandonMigration("1754917100_backfill", ProgressFunc(func(message string) {
+		messages = append(messages, message)
+	})); err != nil {
+		t.Fatalf("Failed to abandon: %v", err)
+	}
+	if abandoned == nil || string(abandoned.Cursor) != "item/3" || abandoned.Chunks != 2 {
+		t.Errorf("Expected Down to get the progress of the partial run, got %+v", abandoned)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := getCopy(db, []byte(fmt.Sprintf("item/%d", i))); err != pebble.ErrNotFound {
+			t.Errorf("Expected item/%d to be removed, got %v", i, err)
+		}
+	}
+	if len(messages) == 0 {
+		t.Errorf("Expected progress messages")
+	}
+	if status, err := schemaManager.GetSchemaVersion(); err != nil || status.Status != StatusClean {
+		t.Errorf("Expected a clean state, got %+v, %v", status, err)
+	}
+}
@@ -0,0 +1,160 @@
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RegisterAlias registers an alias in the global registry, see
+// MigrationRegistry.RegisterAlias
+func RegisterAlias(oldID, newID string) error {
+	return GlobalRegistry.RegisterAlias(oldID, newID)
+}
+
+// RegisterAlias records that the migration registered as newID was applied as
+// oldID on some databases, e.g. because its ID had a typo or it replaces squashed
+// migrations. A database that recorded oldID treats newID as applied instead of
+// running it again, and the engine renames oldID to newID in the schema state
+// before it executes the next plan (see SchemaManager.AdoptAliases).
+//
+// The alias may be registered before the migration. oldID must not be the ID of
+// a registered migration or already be an alias, and aliases do not chain.
+func (r *MigrationRegistry) RegisterAlias(oldID, newID string) error {
+	if oldID == "" || newID == "" {
+		return fmt.Errorf("alias IDs cannot be empty")
+	}
+	if oldID == newID {
+		return fmt.Errorf("migration '%s' cannot be an alias of itself", oldID)
+	}
+	if _, exists := r.migrations[oldID]; exists {
+		return fmt.Errorf("cannot alias '%s': a migration with this ID is registered", oldID)
+	}
+	if target, exists := r.aliases[oldID]; exists {
+		return fmt.Errorf("'%s' is already an alias of '%s'", oldID, target)
+	}
+	if target, exists := r.aliases[newID]; exists {
+		return fmt.Errorf("cannot alias '%s' to '%s', which is an alias of '%s'", oldID, newID, target)
+	}
+	for alias, target := range r.aliases {
+		if target == oldID {
+			return fmt.Errorf("cannot alias '%s', which '%s' is an alias of", oldID, alias)
+		}
+	}
+
+	if r.aliases == nil {
+		r.aliases = make(map[string]string)
+	}
+	r.aliases[oldID] = newID
+	return nil
+}
+
+// ResolveID returns the current ID of a migration: the ID an alias points to, or
+// id itself if it is not an alias
+func (r *MigrationRegistry) ResolveID(id string) string {
+	if target, ok := r.aliases[id]; ok {
+		return target
+	}
+	return id
+}
+
+// GetAliases returns the registered aliases, mapping each former ID to the
+// current one
+func (r *MigrationRegistry) GetAliases() map[string]string {
+	aliases := make(map[string]string, len(r.aliases))
+	for oldID, newID := range r.aliases {
+		aliases[oldID] = newID
+	}
+	return aliases
+}
+
+// resolveApplied returns the applied set with aliases replaced by the IDs they
+// point to. The set is returned as is if no applied ID is an alias.
+func (r *MigrationRegistry) resolveApplied(applied map[string]bool) map[string]bool {
+	aliased := false
+	for id := range applied {
+		if _, ok := r.aliases[id]; ok {
+			aliased = true
+			break
+		}
+	}
+	if !aliased {
+		return applied
+	}
+
+	resolved := make(map[string]bool, len(applied))
+	for id, ok := range applied {
+		if ok {
+			resolved[r.ResolveID(id)] = true
+		}
+	}
+	return resolved
+}
+
+// AdoptAliases renames the applied migrations recorded under an alias of the
+// registry to the IDs the aliases point to, so the schema state only refers to
+// current IDs. The former ID gets a RecordRenamed history record and the current
+// ID a RecordStamp record. Aliases of unregistered migrations are left alone. It
+// returns the renamed former IDs, sorted.
+func (s *SchemaManager) AdoptAliases(registry *MigrationRegistry) ([]string, error) {
+	head, err := s.getSchemaHead()
+	if err != nil {
+		return nil, err
+	}
+	if len(registry.adoptableAliases(head.AppliedMigrations)) == 0 {
+		return nil, nil
+	}
+
+	var adopted []string
+	err = s.modifySchema(func(head *SchemaVersion) ([]MigrationRecord, error) {
+		adopted = registry.adoptableAliases(head.AppliedMigrations)
+		now := time.Now()
+		var records []MigrationRecord
+		for _, oldID := range adopted {
+			newID := registry.aliases[oldID]
+			delete(head.AppliedMigrations, oldID)
+			records = append(records, MigrationRecord{
+				ID:           oldID,
+				Type:         RecordRenamed,
+				Description:  fmt.Sprintf("Renamed to %s", newID),
+				AppliedAt:    now,
+				DurationText: "0s",
+				Success:      true,
+			})
+			if head.AppliedMigrations[newID] {
+				continue
+			}
+			head.AppliedMigrations[newID] = true
+			m, _ := registry.GetMigration(newID)
+			records = append(records, MigrationRecord{
+				ID:           newID,
+				Type:         RecordStamp,
+				Description:  fmt.Sprintf("%s (renamed from %s)", m.Description, oldID),
+				AppliedAt:    now,
+				DurationText: "0s",
+				Success:      true,
+			})
+		}
+		head.CurrentVersion, _ = appliedVersion(head.AppliedMigrations)
+		return records, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rename aliased migrations: %w", err)
+	}
+	return adopted, nil
+}
+
+// adoptableAliases returns the applied IDs that are aliases of registered
+// migrations, sorted
+func (r *MigrationRegistry) adoptableAliases(applied map[string]bool) []string {
+	var ids []string
+	for id := range applied {
+		if newID, ok := r.aliases[id]; ok {
+			if _, registered := r.migrations[newID]; registered {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
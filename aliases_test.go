@@ -0,0 +1,132 @@
+package migrate
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestMigrationAliases(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	schemaManager := NewSchemaManager(db)
+	noop := func(db *pebble.DB) error { return nil }
+
+	// The database recorded the migration under its misspelled ID
+	old := NewMigrationRegistry()
+	if err := old.Register(&Migration{ID: "1754917200_add_emial", Up: noop, Down: noop}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	engine := NewMigrationEngineWithBackup(db, schemaManager, old, dbPath)
+	engine.SetBackupEnabled(false)
+	plan, err := NewMigrationPlanner(old, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+
+	// The next release fixes the ID
+	var ran []string
+	run := func(id string) MigrationFunc {
+		return func(db *pebble.DB) error {
+			ran = append(ran, id)
+			return nil
+		}
+	}
+	registry := NewMigrationRegistry()
+	if err := registry.RegisterAlias("1754917200_add_emial", "1754917200_add_email"); err != nil {
+		t.Fatalf("Failed to register alias: %v", err)
+	}
+	for _, m := range []*Migration{
+		{ID: "1754917200_add_email", Description: "Add email", Up: run("1754917200_add_email"), Down: noop},
+		{ID: "1754917300_index_email", Up: run("1754917300_index_email"), Down: noop, Dependencies: []string{"1754917200_add_emial"}},
+	} {
+		if err := registry.Register(m); err != nil {
+			t.Fatalf("Failed to register: %v", err)
+		}
+	}
+
+	planner := NewMigrationPlanner(registry, schemaManager)
+	plan, err = planner.PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if len(plan.Migrations) != 1 || plan.Migrations[0].ID != "1754917300_index_email" {
+		t.Fatalf("Expected only the new migration to be pending, got %v", plan.Migrations)
+	}
+
+	engine = NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+	var messages []string
+	if err := engine.ExecutePlan(plan, func(message string) { messages = append(messages, message) }); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+	if fmt.Sprint(ran) != "[1754917300_index_email]" {
+		t.Errorf("Expected the renamed migration not to run again, ran %v", ran)
+	}
+	if len(messages) == 0 || messages[0] != "Migration 1754917200_add_emial was renamed to 1754917200_add_email" {
+		t.Errorf("Expected the rename to be reported, got %v", messages)
+	}
+
+	schema, err := schemaManager.GetSchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	if schema.AppliedMigrations["1754917200_add_emial"] || !schema.AppliedMigrations["1754917200_add_email"] {
+		t.Errorf("Expected the applied ID to be renamed, got %v", schema.AppliedMigrations)
+	}
+	if err := schemaManager.ValidateSchemaState(); err != nil {
+		t.Errorf("Expected a consistent state after the rename: %v", err)
+	}
+	if report, err := schemaManager.CheckVersion(); err != nil || len(report.Discrepancies) > 0 {
+		t.Errorf("Expected no discrepancies, got %+v, %v", report, err)
+	}
+
+	// The renamed migration rolls back under its current ID
+	plan, err = planner.PlanDowngrade(0)
+	if err != nil {
+		t.Fatalf("Failed to plan downgrade: %v", err)
+	}
+	if len(plan.Migrations) != 2 {
+		t.Errorf("Expected both migrations to roll back, got %v", plan.Migrations)
+	}
+}
+
+func TestRegisterAliasErrors(t *testing.T) {
+	noop := func(db *pebble.DB) error { return nil }
+	registry := NewMigrationRegistry()
+	if err := registry.Register(&Migration{ID: "1754917200_a", Up: noop, Down: noop}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if err := registry.RegisterAlias("1754917100_b", "1754917200_a"); err != nil {
+		t.Fatalf("Failed to register alias: %v", err)
+	}
+
+	cases := [][2]string{
+		{"1754917200_a", "1754917300_c"}, // A registered migration
+		{"1754917100_b", "1754917300_c"}, // Already an alias
+		{"1754917000_d", "1754917100_b"}, // Points to an alias
+		{"1754917200_a", "1754917200_a"}, // Itself
+		{"", "1754917200_a"},
+	}
+	for _, c := range cases {
+		if err := registry.RegisterAlias(c[0], c[1]); err == nil {
+			t.Errorf("Expected aliasing %q to %q to fail", c[0], c[1])
+		}
+	}
+	if err := registry.Register(&Migration{ID: "1754917100_b", Up: noop, Down: noop}); err == nil {
+		t.Errorf("Expected registering a migration under an alias to fail")
+	}
+	if id := registry.ResolveID("1754917100_b"); id != "1754917200_a" {
+		t.Errorf("Expected the alias to resolve to 1754917200_a, got %s", id)
+	}
+}
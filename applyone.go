@@ -0,0 +1,63 @@
+package migrate
+
+import "fmt"
+
+// PlanApplyOne creates an upgrade plan applying only the given migration, out of
+// order with the other pending migrations, e.g. a hotfix that must not wait for
+// a backlog of backfills. The migration must not be applied yet and all of its
+// dependencies must be; otherwise an error wrapping ErrDependencyNotApplied is
+// returned. The other pending migrations stay pending and are applied by the
+// next upgrade.
+func (p *MigrationPlanner) PlanApplyOne(migrationID string) (*ExecutionPlan, error) {
+	if err := p.verifyLock(); err != nil {
+		return nil, err
+	}
+
+	migration, exists := p.registry.GetMigration(p.registry.ResolveID(migrationID))
+	if !exists {
+		return nil, fmt.Errorf("migration '%s' not found", migrationID)
+	}
+
+	currentSchema, err := p.schema.getSchemaHead()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current schema: %w", err)
+	}
+
+	applied := p.registry.resolveApplied(currentSchema.AppliedMigrations)
+	if applied[migration.ID] {
+		return nil, fmt.Errorf("migration %s is already applied", migration.ID)
+	}
+	var missing []string
+	for _, depID := range migration.Dependencies {
+		if depID = p.registry.ResolveID(depID); !applied[depID] {
+			missing = append(missing, depID)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: migration %s depends on %v", ErrDependencyNotApplied, migration.ID, missing)
+	}
+
+	plan := &ExecutionPlan{
+		Type:           ExecutionTypeUpgrade,
+		CurrentVersion: currentSchema.CurrentVersion,
+		TargetVersion:  currentSchema.CurrentVersion,
+		Migrations:     []*Migration{migration},
+		EstimatedSteps: 1,
+	}
+	if migration.Version > plan.TargetVersion {
+		plan.TargetVersion = migration.Version
+	}
+	return plan, nil
+}
+
+// ApplyOne applies only the given migration, leaving the other pending
+// migrations pending; see MigrationPlanner.PlanApplyOne. It is executed and
+// recorded like any upgrade, with a backup, policies and progress, which may be
+// nil.
+func (e *MigrationEngine) ApplyOne(migrationID string, progress ProgressReporter) error {
+	plan, err := NewMigrationPlanner(e.registry, e.schemaManager).PlanApplyOne(migrationID)
+	if err != nil {
+		return err
+	}
+	return e.ExecutePlanWithProgress(plan, progress)
+}
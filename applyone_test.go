@@ -0,0 +1,77 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestApplyOne(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var ran []string
+	migration := func(id string, deps ...string) *Migration {
+		return &Migration{
+			ID:           id,
+			Dependencies: deps,
+			Up:           func(db *pebble.DB) error { ran = append(ran, id); return nil },
+			Down:         func(db *pebble.DB) error { return nil },
+		}
+	}
+	registry := NewMigrationRegistry()
+	for _, m := range []*Migration{
+		migration("1754917200_backfill"),
+		migration("1754917300_hotfix"),
+		migration("1754917400_follow_up", "1754917200_backfill"),
+	} {
+		if err := registry.Register(m); err != nil {
+			t.Fatalf("Failed to register %s: %v", m.ID, err)
+		}
+	}
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	// A migration with an unapplied dependency is refused
+	if err := engine.ApplyOne("1754917400_follow_up", nil); !errors.Is(err, ErrDependencyNotApplied) {
+		t.Errorf("Expected the unapplied dependency to be refused, got %v", err)
+	}
+
+	// Only the named migration runs, and it is recorded
+	if err := engine.ApplyOne("1754917300_hotfix", nil); err != nil {
+		t.Fatalf("Failed to apply one migration: %v", err)
+	}
+	if len(ran) != 1 || ran[0] != "1754917300_hotfix" {
+		t.Errorf("Expected only the hotfix to run, got %v", ran)
+	}
+	version, err := schemaManager.GetSchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	if !version.AppliedMigrations["1754917300_hotfix"] || version.AppliedMigrations["1754917200_backfill"] ||
+		version.CurrentVersion != 1754917300 || version.Status != StatusClean {
+		t.Errorf("Unexpected schema after applying one migration: %+v", version)
+	}
+	if err := engine.ApplyOne("1754917300_hotfix", nil); err == nil {
+		t.Errorf("Expected an applied migration to be refused")
+	}
+
+	// The next upgrade applies the rest
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	if len(ran) != 3 || ran[1] != "1754917200_backfill" || ran[2] != "1754917400_follow_up" {
+		t.Errorf("Expected the rest to run in order, got %v", ran)
+	}
+}
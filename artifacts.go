@@ -0,0 +1,273 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArtifactKind classifies a leftover file or directory next to the database that
+// is not a usable backup
+type ArtifactKind string
+
+const (
+	// ArtifactIncompleteBackup is a backup without metadata, e.g. from an
+	// interrupted backup
+	ArtifactIncompleteBackup ArtifactKind = "incomplete_backup"
+	// ArtifactOrphanedMetadata is the metadata file of a compressed backup whose
+	// archive was removed
+	ArtifactOrphanedMetadata ArtifactKind = "orphaned_metadata"
+	// ArtifactCheckpoint is a temporary checkpoint left by an interrupted
+	// compressed backup
+	ArtifactCheckpoint ArtifactKind = "temp_checkpoint"
+	// ArtifactRestoreTemp is a partial copy of a backup left by an interrupted
+	// restore
+	ArtifactRestoreTemp ArtifactKind = "restore_temp"
+	// ArtifactPrevious is the database replaced by a restore, left behind when the
+	// restore was interrupted. It may be the only copy of the previous state.
+	ArtifactPrevious ArtifactKind = "previous_database"
+)
+
+// DefaultTempArtifactMaxAge is the age after which NewBackupManager removes
+// leftover temporary checkpoints and restore copies. A previous database is
+// never removed automatically.
+const DefaultTempArtifactMaxAge = 7 * 24 * time.Hour
+
+// tempManifestSuffix follows the database path in the name of the manifest that
+// tracks temporary artifacts
+const tempManifestSuffix = ".temp_manifest"
+
+// tempManifestEntry records why a temporary artifact was created, and why it was
+// kept if the operation that created it failed
+type tempManifestEntry struct {
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	Purpose   string    `json:"purpose"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// BackupArtifact is a leftover backup-like file or directory next to the database
+type BackupArtifact struct {
+	Path    string       `json:"path"`
+	Kind    ArtifactKind `json:"kind"`
+	Size    int64        `json:"size"`
+	ModTime time.Time    `json:"mod_time"`
+	Note    string       `json:"note,omitempty"` // Why the artifact exists, if tracked in the manifest
+}
+
+// ListArtifacts lists the files and directories next to the database that look
+// like backups but are not listed by ListBackups, oldest first
+func (b *BackupManager) ListArtifacts() ([]*BackupArtifact, error) {
+	parentDir := filepath.Dir(b.dbPath)
+	dbName := filepath.Base(b.dbPath)
+
+	entries, err := os.ReadDir(parentDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	manifest, err := b.readTempManifest()
+	if err != nil {
+		return nil, err
+	}
+	notes := make(map[string]string, len(manifest))
+	for _, entry := range manifest {
+		notes[entry.Path] = entry.Purpose
+		if entry.Error != "" {
+			notes[entry.Path] += " failed: " + entry.Error
+		}
+	}
+
+	var artifacts []*BackupArtifact
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(parentDir, name)
+
+		var kind ArtifactKind
+		switch {
+		case strings.HasPrefix(name, dbName+".restore_temp_"):
+			kind = ArtifactRestoreTemp
+		case name == dbName+".previous":
+			kind = ArtifactPrevious
+		case !strings.HasPrefix(name, dbName+".backup_"):
+			continue
+		case strings.HasSuffix(name, ".tmp_checkpoint"):
+			kind = ArtifactCheckpoint
+		case strings.HasSuffix(name, ".tar.gz.metadata"):
+			if _, err := os.Stat(strings.TrimSuffix(path, ".metadata")); err == nil {
+				continue
+			}
+			kind = ArtifactOrphanedMetadata
+		case b.isValidBackup(path):
+			continue
+		default:
+			kind = ArtifactIncompleteBackup
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		size, err := b.GetBackupSize(path)
+		if err != nil {
+			size = info.Size()
+		}
+		artifacts = append(artifacts, &BackupArtifact{
+			Path:    path,
+			Kind:    kind,
+			Size:    size,
+			ModTime: info.ModTime(),
+			Note:    notes[path],
+		})
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].ModTime.Before(artifacts[j].ModTime)
+	})
+	return artifacts, nil
+}
+
+// RemoveArtifacts removes the given artifacts and returns how many were removed.
+// It continues past failures and returns the first one.
+func (b *BackupManager) RemoveArtifacts(artifacts []*BackupArtifact) (int, error) {
+	removed := 0
+	var firstErr error
+	for _, artifact := range artifacts {
+		if err := os.RemoveAll(artifact.Path); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to remove %s: %w", artifact.Path, err)
+			}
+			continue
+		}
+		removed++
+	}
+
+	if err := b.pruneTempManifest(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return removed, firstErr
+}
+
+// CleanupTempArtifacts removes temporary checkpoints and restore copies older than
+// maxAge and returns the removed artifacts. Incomplete backups are left to
+// RemoveArtifacts.
+func (b *BackupManager) CleanupTempArtifacts(maxAge time.Duration) ([]*BackupArtifact, error) {
+	artifacts, err := b.ListArtifacts()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var stale []*BackupArtifact
+	for _, artifact := range artifacts {
+		if (artifact.Kind == ArtifactRestoreTemp || artifact.Kind == ArtifactCheckpoint) &&
+			artifact.ModTime.Before(cutoff) {
+			stale = append(stale, artifact)
+		}
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+
+	for _, artifact := range stale {
+		b.log().Printf("Removing stale temporary artifact: %s", artifact.Path)
+	}
+	_, err = b.RemoveArtifacts(stale)
+	return stale, err
+}
+
+// tempManifestPath returns the path of the manifest tracking temporary artifacts
+func (b *BackupManager) tempManifestPath() string {
+	return b.dbPath + tempManifestSuffix
+}
+
+// readTempManifest reads the temporary artifact manifest. A missing manifest is empty.
+func (b *BackupManager) readTempManifest() ([]tempManifestEntry, error) {
+	data, err := os.ReadFile(b.tempManifestPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read temp manifest: %w", err)
+	}
+
+	var entries []tempManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse temp manifest %s: %w", b.tempManifestPath(), err)
+	}
+	return entries, nil
+}
+
+// writeTempManifest writes the temporary artifact manifest, removing it when empty
+func (b *BackupManager) writeTempManifest(entries []tempManifestEntry) error {
+	if len(entries) == 0 {
+		if err := os.Remove(b.tempManifestPath()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove temp manifest: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(b.tempManifestPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write temp manifest: %w", err)
+	}
+	return nil
+}
+
+// trackTemp records a temporary artifact in the manifest before it is created
+func (b *BackupManager) trackTemp(path, purpose string) error {
+	entries, err := b.readTempManifest()
+	if err != nil {
+		return err
+	}
+	entries = append(entries, tempManifestEntry{Path: path, CreatedAt: time.Now(), Purpose: purpose})
+	return b.writeTempManifest(entries)
+}
+
+// untrackTemp updates the manifest entry of a temporary artifact when the
+// operation that created it ends. On success the entry is dropped; on failure
+// the error is recorded, as the artifact is kept.
+func (b *BackupManager) untrackTemp(path string, failure error) error {
+	entries, err := b.readTempManifest()
+	if err != nil {
+		return err
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.Path == path {
+			if failure == nil {
+				continue
+			}
+			entry.Error = failure.Error()
+		}
+		kept = append(kept, entry)
+	}
+	return b.writeTempManifest(kept)
+}
+
+// pruneTempManifest drops manifest entries whose artifact no longer exists
+func (b *BackupManager) pruneTempManifest() error {
+	entries, err := b.readTempManifest()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if _, err := os.Stat(entry.Path); err == nil {
+			kept = append(kept, entry)
+		}
+	}
+	return b.writeTempManifest(kept)
+}
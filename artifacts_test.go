@@ -0,0 +1,153 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestBackupArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	backupManager := NewBackupManager(dbPath)
+	backup, err := backupManager.CreateBackup(db, "Valid")
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	leftovers := map[string]ArtifactKind{
+		"test.db.backup_20240101_000000":                       ArtifactIncompleteBackup,
+		"test.db.backup_20240102_000000.tar.gz.metadata":       ArtifactOrphanedMetadata,
+		"test.db.backup_20240103_000000.tar.gz.tmp_checkpoint": ArtifactCheckpoint,
+		"test.db.restore_temp_20240104_000000":                 ArtifactRestoreTemp,
+	}
+	for name := range leftovers {
+		os.MkdirAll(filepath.Join(dir, name), 0755)
+	}
+	// Files of other databases are not touched
+	os.MkdirAll(filepath.Join(dir, "other.db.restore_temp_20240104_000000"), 0755)
+
+	artifacts, err := backupManager.ListArtifacts()
+	if err != nil {
+		t.Fatalf("Failed to list artifacts: %v", err)
+	}
+	if len(artifacts) != len(leftovers) {
+		t.Fatalf("Expected %d artifacts, got %+v", len(leftovers), artifacts)
+	}
+	for _, artifact := range artifacts {
+		if expected := leftovers[filepath.Base(artifact.Path)]; artifact.Kind != expected {
+			t.Errorf("%s: expected kind %s, got %s", artifact.Path, expected, artifact.Kind)
+		}
+	}
+
+	removed, err := backupManager.RemoveArtifacts(artifacts)
+	if err != nil || removed != len(leftovers) {
+		t.Fatalf("Expected %d artifacts removed, got %d (%v)", len(leftovers), removed, err)
+	}
+	if artifacts, _ := backupManager.ListArtifacts(); len(artifacts) != 0 {
+		t.Errorf("Expected no artifacts after removal, got %+v", artifacts)
+	}
+
+	backups, _ := backupManager.ListBackups()
+	if len(backups) != 1 || backups[0].Path != backup.Path {
+		t.Errorf("Expected the valid backup to be kept, got %+v", backups)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.db.restore_temp_20240104_000000")); err != nil {
+		t.Errorf("Expected artifacts of other databases to be kept: %v", err)
+	}
+}
+
+func TestTempArtifactCleanup(t *testing.T) {
+	t.Run("RemovesStaleTempsOnConstruction", func(t *testing.T) {
+		dir := t.TempDir()
+		dbPath := filepath.Join(dir, "test.db")
+
+		stale := filepath.Join(dir, "test.db.restore_temp_20240101_000000")
+		fresh := filepath.Join(dir, "test.db.restore_temp_20240102_000000")
+		incomplete := filepath.Join(dir, "test.db.backup_20240101_000000")
+		for _, path := range []string{stale, fresh, incomplete} {
+			os.MkdirAll(path, 0755)
+		}
+		old := time.Now().Add(-DefaultTempArtifactMaxAge - time.Hour)
+		os.Chtimes(stale, old, old)
+		os.Chtimes(incomplete, old, old)
+
+		// A zero age disables the cleanup
+		NewBackupManagerWithOptions(dbPath, BackupOptions{})
+		if _, err := os.Stat(stale); err != nil {
+			t.Fatalf("Expected no cleanup with a zero age: %v", err)
+		}
+
+		NewBackupManager(dbPath)
+		if _, err := os.Stat(stale); !os.IsNotExist(err) {
+			t.Errorf("Expected the stale restore copy to be removed, got %v", err)
+		}
+		for _, path := range []string{fresh, incomplete} {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("Expected %s to be kept: %v", path, err)
+			}
+		}
+	})
+
+	t.Run("ManifestRecordsFailedRestore", func(t *testing.T) {
+		dir := t.TempDir()
+		backupManager := NewBackupManager(filepath.Join(dir, "test.db"))
+
+		temp := filepath.Join(dir, "test.db.restore_temp_20240101_000000")
+		if err := backupManager.trackTemp(temp, "restore of test.db.backup_1"); err != nil {
+			t.Fatalf("Failed to track temp: %v", err)
+		}
+		os.MkdirAll(temp, 0755)
+		backupManager.untrackTemp(temp, errors.New("disk full"))
+
+		artifacts, err := backupManager.ListArtifacts()
+		if err != nil {
+			t.Fatalf("Failed to list artifacts: %v", err)
+		}
+		if len(artifacts) != 1 || artifacts[0].Note != "restore of test.db.backup_1 failed: disk full" {
+			t.Fatalf("Expected the failed restore to be noted, got %+v", artifacts)
+		}
+
+		backupManager.RemoveArtifacts(artifacts)
+		if _, err := os.Stat(backupManager.tempManifestPath()); !os.IsNotExist(err) {
+			t.Errorf("Expected the manifest to be removed with its last artifact, got %v", err)
+		}
+	})
+
+	t.Run("SuccessfulRestoreLeavesNothing", func(t *testing.T) {
+		dir := t.TempDir()
+		dbPath := filepath.Join(dir, "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		db.Set([]byte("key"), []byte("before"), pebble.Sync)
+
+		backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{})
+		backup, err := backupManager.CreateBackup(db, "Before")
+		if err != nil {
+			t.Fatalf("Failed to create backup: %v", err)
+		}
+		db.Close()
+
+		if err := backupManager.RestoreBackup(backup.Path); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		if artifacts, _ := backupManager.ListArtifacts(); len(artifacts) != 0 {
+			t.Errorf("Expected no artifacts after a successful restore, got %+v", artifacts)
+		}
+		if _, err := os.Stat(backupManager.tempManifestPath()); !os.IsNotExist(err) {
+			t.Errorf("Expected no manifest after a successful restore, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// PendingBackup is a backup being completed in the background by
+// CreateBackupAsync
+type PendingBackup struct {
+	Path string // Path of the backup once complete
+
+	done chan struct{}
+	info *BackupInfo
+	err  error
+}
+
+// Done returns a channel that is closed when the backup is complete or failed
+func (p *PendingBackup) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the backup to complete and returns it
+func (p *PendingBackup) Wait() (*BackupInfo, error) {
+	<-p.done
+	return p.info, p.err
+}
+
+// completedBackup returns a PendingBackup that is already complete
+func completedBackup(info *BackupInfo) *PendingBackup {
+	p := &PendingBackup{Path: info.Path, done: make(chan struct{}), info: info}
+	close(p.done)
+	return p
+}
+
+// CreateBackupAsync creates a compressed backup in two steps. It returns once the
+// checkpoint of db exists, which is fast, and compresses the checkpoint in the
+// background; the database can be written meanwhile. The checkpoint is tracked
+// as a temporary artifact until the backup is complete.
+//
+// Uncompressed and hardlinked backups are only a checkpoint, so they are created
+// before CreateBackupAsync returns.
+func (b *BackupManager) CreateBackupAsync(db *pebble.DB, description string) (*PendingBackup, error) {
+	if !b.compress || b.hardlink {
+		info, err := b.CreateBackup(db, description)
+		if err != nil {
+			return nil, err
+		}
+		return completedBackup(info), nil
+	}
+
+	estimate := b.EstimateBackupSize(db)
+	timestamp := time.Now().Format("20060102_150405")
+	backupPath := fmt.Sprintf("%s.backup_%s.tar.gz", b.dbPath, timestamp)
+	checkpointPath := backupPath + ".tmp_checkpoint"
+	b.log().Printf("Creating compressed backup in the background: %s", backupPath)
+
+	start := time.Now()
+	if err := b.trackTemp(checkpointPath, "compression of "+backupPath); err != nil {
+		return nil, err
+	}
+	os.RemoveAll(checkpointPath)
+	if err := db.Checkpoint(checkpointPath, pebble.WithFlushedWAL()); err != nil {
+		os.RemoveAll(checkpointPath)
+		b.untrackTemp(checkpointPath, nil)
+		return nil, fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+
+	// The version is read now, as the database changes while compressing
+	backupInfo := &BackupInfo{
+		Path:        backupPath,
+		OriginalDB:  b.dbPath,
+		Version:     b.backupSchemaVersion(db),
+		Description: description,
+		SourceSize:  estimate.SourceSize,
+	}
+
+	// The database may be closed before the backup is complete, so the audit
+	// record is written now, without the checksum, which is in the metadata
+	b.recordAudit(db, AuditRecord{
+		Type:        AuditBackup,
+		Path:        backupPath,
+		Version:     int64(backupInfo.Version),
+		Description: description,
+	})
+
+	pending := &PendingBackup{Path: backupPath, done: make(chan struct{})}
+	go func() {
+		defer close(pending.done)
+		pending.info, pending.err = b.compressPendingBackup(backupInfo, checkpointPath, start)
+	}()
+	return pending, nil
+}
+
+// compressPendingBackup compresses the checkpoint of a backup started by
+// CreateBackupAsync, removes the checkpoint and writes the metadata
+func (b *BackupManager) compressPendingBackup(backupInfo *BackupInfo, checkpointPath string, start time.Time) (*BackupInfo, error) {
+	warnings := b.warnings.mark()
+	size, err := b.compressCheckpoint(checkpointPath, backupInfo.Path)
+	os.RemoveAll(checkpointPath)
+	b.untrackTemp(checkpointPath, nil)
+	if err != nil {
+		os.Remove(backupInfo.Path)
+		return nil, fmt.Errorf("failed to create backup: failed to compress checkpoint: %w", err)
+	}
+
+	if b.faultInjector != nil {
+		if err := b.faultInjector(FaultDuringBackup, ""); err != nil {
+			return nil, fmt.Errorf("failed to create backup: %w", err)
+		}
+	}
+
+	backupInfo.CreatedAt = time.Now()
+	backupInfo.Size = size
+	backupInfo.Duration = time.Since(start)
+	if backupInfo.Checksum, err = b.BackupChecksum(backupInfo.Path); err != nil {
+		os.Remove(backupInfo.Path)
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+	if err := b.finishBackup(backupInfo); err != nil {
+		return nil, err
+	}
+
+	b.log().Printf("Backup created successfully: %s (%.2f MB)",
+		backupInfo.Path, float64(size)/1024/1024)
+	backupInfo.Warnings = b.warnings.since(warnings)
+	return backupInfo, nil
+}
@@ -0,0 +1,86 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestAsyncBackup(t *testing.T) {
+	setup := func(t *testing.T, up func(db *pebble.DB) error) (*MigrationEngine, *BackupManager, *ExecutionPlan) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		schemaManager := NewSchemaManager(db)
+		schemaManager.UpdateSchemaAfterMigration("1754917200_first", 1754917200, "First", 0)
+
+		registry := NewMigrationRegistry()
+		noop := func(db *pebble.DB) error { return nil }
+		registry.Register(&Migration{ID: "1754917200_first", Up: noop, Down: noop})
+		registry.Register(&Migration{ID: "1754917300_second", Up: up, Down: noop})
+
+		backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{Compress: true})
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupManager(backupManager)
+		engine.SetAsyncBackup(true)
+
+		plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err != nil {
+			t.Fatalf("Failed to plan: %v", err)
+		}
+		return engine, backupManager, plan
+	}
+
+	t.Run("CompletesInBackground", func(t *testing.T) {
+		engine, backupManager, plan := setup(t, func(db *pebble.DB) error {
+			return db.Set([]byte("key"), []byte("value"), pebble.Sync)
+		})
+
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to execute plan: %v", err)
+		}
+		pending := engine.PendingBackup()
+		if pending == nil {
+			t.Fatal("Expected a pending backup")
+		}
+		info, err := pending.Wait()
+		if err != nil {
+			t.Fatalf("Background backup failed: %v", err)
+		}
+		if !strings.HasSuffix(info.Path, ".tar.gz") || info.Version != 1754917200 {
+			t.Errorf("Expected a compressed backup of the version before the plan, got %+v", info)
+		}
+
+		backups, _ := backupManager.ListBackups()
+		if len(backups) != 1 || backups[0].Path != info.Path {
+			t.Errorf("Expected the backup to be listed, got %+v", backups)
+		}
+		if artifacts, _ := backupManager.ListArtifacts(); len(artifacts) != 0 {
+			t.Errorf("Expected the checkpoint to be removed, got %+v", artifacts)
+		}
+	})
+
+	t.Run("FailedPlanWaitsForBackup", func(t *testing.T) {
+		failure := errors.New("migration failed")
+		engine, _, plan := setup(t, func(db *pebble.DB) error { return failure })
+
+		if err := engine.ExecutePlan(plan, nil); !errors.Is(err, failure) {
+			t.Fatalf("Expected the migration failure, got %v", err)
+		}
+		select {
+		case <-engine.PendingBackup().Done():
+		default:
+			t.Fatal("Expected the backup to be complete when the failure is returned")
+		}
+		if _, err := engine.PendingBackup().Wait(); err != nil {
+			t.Errorf("Expected the backup to succeed, got %v", err)
+		}
+	})
+}
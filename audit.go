@@ -0,0 +1,200 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// auditInfix follows the key prefix in the keys audit records are stored under
+const auditInfix = "audit/"
+
+// AuditType is the kind of operation an audit record describes
+type AuditType string
+
+const (
+	// AuditBackup records a backup taken of the database
+	AuditBackup AuditType = "backup"
+	// AuditRestore records that the database was restored from a backup
+	AuditRestore AuditType = "restore"
+	// AuditFix records a fix script applied to the database, see ApplyFix
+	AuditFix AuditType = "fix"
+)
+
+// AuditRecord is an entry of the audit history, which records the operations that
+// change or copy a database besides migrations. It is kept apart from the
+// migration history.
+type AuditRecord struct {
+	Type        AuditType `json:"type"`
+	At          time.Time `json:"at"`
+	Path        string    `json:"path"`                  // Backup created or restored from, or fix script applied
+	Checksum    string    `json:"checksum,omitempty"`    // Checksum of the backup, see BackupChecksum, or of the fix script
+	Version     int64     `json:"version"`               // Schema version of the database after the operation
+	Description string    `json:"description,omitempty"` // Backup or fix description
+
+	Keys    int        `json:"keys,omitempty"`    // Keys changed by a fix
+	Inverse *FixScript `json:"inverse,omitempty"` // Fix script undoing a fix
+}
+
+// auditKey returns the internal key an audit record is stored under, keyed by
+// its time in Unix nanoseconds like history records
+func (s *SchemaManager) auditKey(ts int64) []byte {
+	return []byte(fmt.Sprintf("%s%s%020d", s.keyPrefix, auditInfix, ts))
+}
+
+// auditPrefix returns the prefix of all audit record keys
+func (s *SchemaManager) auditPrefix() []byte {
+	return []byte(s.keyPrefix + auditInfix)
+}
+
+// RecordAudit adds a record to the audit history
+func (s *SchemaManager) RecordAudit(record AuditRecord) error {
+	key, data, err := s.auditEntry(record)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Set(key, data, pebble.Sync); err != nil {
+		return fmt.Errorf("failed to record audit: %w", err)
+	}
+	return nil
+}
+
+// auditEntry returns the key and value an audit record is stored under
+func (s *SchemaManager) auditEntry(record AuditRecord) ([]byte, []byte, error) {
+	if record.At.IsZero() {
+		record.At = time.Now()
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	// Records of the same nanosecond get the next free key
+	ts := record.At.UnixNano()
+	for {
+		_, closer, err := s.db.Get(s.auditKey(ts))
+		if err == pebble.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to record audit: %w", err)
+		}
+		closer.Close()
+		ts++
+	}
+	return s.auditKey(ts), data, nil
+}
+
+// AuditHistory returns the audit history, oldest first
+func (s *SchemaManager) AuditHistory() ([]AuditRecord, error) {
+	prefix := s.auditPrefix()
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixUpperBound(prefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit history: %w", err)
+	}
+	defer iter.Close()
+
+	var records []AuditRecord
+	for iter.First(); iter.Valid(); iter.Next() {
+		var record AuditRecord
+		if err := json.Unmarshal(iter.Value(), &record); err != nil {
+			return nil, fmt.Errorf("%w: audit record %s: %v", ErrCorruptSchemaState, iter.Key(), err)
+		}
+		records = append(records, record)
+	}
+	return records, iter.Error()
+}
+
+// BackupChecksum returns the SHA-256 checksum of a backup, prefixed with
+// "sha256:". For an archive it is the checksum of the file. For a directory
+// backup it covers the relative path and content of every file in lexical
+// order, except the metadata and references.
+func (b *BackupManager) BackupChecksum(backupPath string) (string, error) {
+	h := sha256.New()
+	if strings.HasSuffix(backupPath, ".tar.gz") {
+		if err := b.hashFile(h, backupPath); err != nil {
+			return "", err
+		}
+		return formatChecksum(h), nil
+	}
+
+	err := filepath.Walk(backupPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == backupRefsDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(backupPath, path)
+		if err != nil || relPath == ".backup_metadata" {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(relPath), info.Size())
+		return b.hashFile(h, path)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to checksum backup: %w", err)
+	}
+	return formatChecksum(h), nil
+}
+
+// hashFile adds the content of a file to a hash, honoring the read rate limit
+func (b *BackupManager) hashFile(h hash.Hash, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(h, b.throttle(file))
+	return err
+}
+
+// formatChecksum formats the sum of a SHA-256 hash as stored in metadata
+func formatChecksum(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// recordAudit adds a record to the audit history of db. Failing to record does
+// not fail the operation; nothing is recorded in a database open read-only.
+func (b *BackupManager) recordAudit(db *pebble.DB, record AuditRecord) {
+	schemaManager := NewSchemaManager(db)
+	schemaManager.SetSchemaKey(b.schemaKey)
+	schemaManager.SetKeyPrefix(b.keyPrefix)
+	if err := schemaManager.RecordAudit(record); err != nil && !errors.Is(err, pebble.ErrReadOnly) {
+		b.warnf("audit", "%s not recorded in the audit history: %v", record.Type, err)
+	}
+}
+
+// recordRestoreAudit opens the restored database and records the restore
+func (b *BackupManager) recordRestoreAudit(report *RestoreReport) {
+	db, err := pebble.Open(b.dbPath, &pebble.Options{})
+	if err != nil {
+		b.warnf("audit", "restore not recorded in the audit history: %v", err)
+		return
+	}
+	defer db.Close()
+
+	b.recordAudit(db, AuditRecord{
+		Type:        AuditRestore,
+		Path:        report.Backup.Path,
+		Checksum:    report.Backup.Checksum,
+		Version:     report.RestoredVersion,
+		Description: report.Backup.Description,
+	})
+}
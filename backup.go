@@ -5,8 +5,11 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,19 +19,139 @@ import (
 // BackupManager handles database backup and restore operations
 type BackupManager struct {
 	dbPath            string
+	schemaKey         string
+	keyPrefix         string
+	registry          *MigrationRegistry
+	faultInjector     FaultInjector
 	compress          bool
+	hardlink          bool
 	cleanupOldBackups bool
 	maxBackups        int
+
+	readLimiter        *rateLimiter
+	compressionWorkers int
+	logger             Logger
+	warnings           warningLog
 }
 
-// NewBackupManager creates a new backup manager with default settings
+// NewBackupManager creates a new backup manager with default settings.
+// Temporary artifacts older than DefaultTempArtifactMaxAge are removed.
 func NewBackupManager(dbPath string) *BackupManager {
-	return &BackupManager{
+	return NewBackupManagerWithOptions(dbPath, BackupOptions{
+		Compress:           true, // Enable compression by default
+		CleanupOldBackups:  true, // Enable cleanup by default for operational sanity
+		MaxBackups:         2,    // Keep max 2 backups when cleanup is enabled
+		TempArtifactMaxAge: DefaultTempArtifactMaxAge,
+	})
+}
+
+// NewBackupManagerWithOptions creates a backup manager with the given options.
+// Temporary checkpoints and restore copies older than opts.TempArtifactMaxAge
+// are removed; a zero age disables the cleanup.
+func NewBackupManagerWithOptions(dbPath string, opts BackupOptions) *BackupManager {
+	b := &BackupManager{
 		dbPath:            dbPath,
-		compress:          true, // Enable compression by default
-		cleanupOldBackups: true, // Enable cleanup by default for operational sanity
-		maxBackups:        2,    // Keep max 2 backups when cleanup is enabled
+		schemaKey:         SchemaVersionKey,
+		keyPrefix:         MigrationPrefix,
+		compress:          opts.Compress,
+		cleanupOldBackups: opts.CleanupOldBackups,
+		maxBackups:        opts.MaxBackups,
+		hardlink:          opts.Hardlink,
+
+		readLimiter:        newRateLimiter(opts.MaxReadMBps),
+		compressionWorkers: opts.CompressionWorkers,
+	}
+
+	if opts.TempArtifactMaxAge > 0 {
+		if _, err := b.CleanupTempArtifacts(opts.TempArtifactMaxAge); err != nil {
+			b.warnf("temp cleanup", "failed to clean up temporary artifacts: %v", err)
+		}
+	}
+	return b
+}
+
+// newSchemaAwareBackupManager creates a backup manager that reads the schema
+// state from the same keys as the given schema manager
+func newSchemaAwareBackupManager(dbPath string, schemaManager *SchemaManager) *BackupManager {
+	b := NewBackupManager(dbPath)
+	b.SetSchemaKey(schemaManager.SchemaKey())
+	b.SetKeyPrefix(schemaManager.KeyPrefix())
+	return b
+}
+
+// SetFaultInjector installs a fault injector consulted at FaultDuringBackup and
+// FaultDuringRestore
+func (b *BackupManager) SetFaultInjector(injector FaultInjector) {
+	b.faultInjector = injector
+}
+
+// SetLogger sets the logger backup and restore messages are written to. Without
+// a logger they are printed to stdout.
+func (b *BackupManager) SetLogger(logger Logger) {
+	b.logger = logger
+}
+
+// log returns the logger of the manager
+func (b *BackupManager) log() Logger {
+	if b.logger == nil {
+		return defaultLogger
+	}
+	return b.logger
+}
+
+// warnf logs a warning and collects it, see Warnings
+func (b *BackupManager) warnf(source, format string, args ...interface{}) {
+	w := newWarning(source, format, args...)
+	b.warnings.add(w)
+	logWarning(b.log(), w)
+}
+
+// Warnings returns the last warnings of the manager's operations, oldest first,
+// e.g. old backups that could not be removed. The warnings of a backup or a
+// restore are also in its BackupInfo or RestoreReport.
+func (b *BackupManager) Warnings() []Warning {
+	return b.warnings.since(0)
+}
+
+// SetSchemaKey sets the key the schema version recorded in backup metadata is read from
+func (b *BackupManager) SetSchemaKey(key string) {
+	if key == "" {
+		key = SchemaVersionKey
 	}
+	b.schemaKey = key
+}
+
+// SetKeyPrefix sets the key prefix the migration history of a restored database
+// is read from
+func (b *BackupManager) SetKeyPrefix(prefix string) {
+	if prefix == "" {
+		prefix = MigrationPrefix
+	}
+	b.keyPrefix = prefix
+}
+
+// SetHardlink sets whether backups keep the checkpoint directory, see
+// BackupOptions.Hardlink
+func (b *BackupManager) SetHardlink(enabled bool) {
+	b.hardlink = enabled
+}
+
+// SetMaxReadRate limits the read rate of backups and restores, see
+// BackupOptions.MaxReadMBps
+func (b *BackupManager) SetMaxReadRate(mbps float64) {
+	b.readLimiter = newRateLimiter(mbps)
+}
+
+// SetCompressionWorkers sets the number of goroutines compressing a backup, see
+// BackupOptions.CompressionWorkers
+func (b *BackupManager) SetCompressionWorkers(workers int) {
+	b.compressionWorkers = workers
+}
+
+// SetRegistry sets the registry restores compare the restored database against,
+// to report the migrations that need to be reapplied
+func (b *BackupManager) SetRegistry(registry *MigrationRegistry) {
+	b.registry = registry
 }
 
 // BackupOptions configures backup behavior
@@ -36,51 +159,84 @@ type BackupOptions struct {
 	Compress          bool
 	CleanupOldBackups bool
 	MaxBackups        int
+
+	// Hardlink keeps the checkpoint directory as the backup, overriding Compress.
+	// Pebble hardlinks the SSTables into it, so it is nearly instant and takes
+	// little extra space; convert it with ConvertToArchive to move it elsewhere.
+	Hardlink bool
+
+	// MaxReadMBps limits how fast backups and restores read database and backup
+	// files, in megabytes per second, so they do not saturate the disk of a live
+	// node. Zero is unlimited. Creating the checkpoint itself is not limited.
+	MaxReadMBps float64
+
+	// CompressionWorkers is the number of goroutines compressing a backup. Zero
+	// or one compresses on a single goroutine.
+	CompressionWorkers int
+
+	// TempArtifactMaxAge is the age after which leftover temporary checkpoints and
+	// restore copies are removed when the manager is created. Zero disables it.
+	TempArtifactMaxAge time.Duration
 }
 
 
 // BackupInfo contains information about a database backup
 type BackupInfo struct {
-	Path        string    `json:"path"`
-	OriginalDB  string    `json:"original_db"`
-	CreatedAt   time.Time `json:"created_at"`
-	Size        int64     `json:"size"`
-	Version     int32     `json:"version"`
-	Description string    `json:"description"`
+	Path        string        `json:"path"`
+	OriginalDB  string        `json:"original_db"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Size        int64         `json:"size"`
+	Version     int32         `json:"version"`
+	Description string        `json:"description"`
+	Hardlinked  bool          `json:"hardlinked,omitempty"`  // Raw checkpoint sharing SSTables with the database
+	Pinned      string        `json:"pinned,omitempty"`      // Why the backup is pinned, see PinBackup
+	Checksum    string        `json:"checksum,omitempty"`    // See BackupChecksum; empty for hardlinked backups
+	SourceSize  int64         `json:"source_size,omitempty"` // Database size the backup was taken at, for EstimateBackupSize
+	Duration    time.Duration `json:"duration,omitempty"`    // How long the backup took, for EstimateBackupSize
+	Warnings    []Warning     `json:"-"`                     // Soft failures while creating the backup, e.g. of the cleanup
 }
 
 // CreateBackup creates a backup of the database before migration using Pebble Checkpoint
 func (b *BackupManager) CreateBackup(db *pebble.DB, description string) (*BackupInfo, error) {
 	timestamp := time.Now().Format("20060102_150405")
+	warnings := b.warnings.mark()
+
+	estimate := b.EstimateBackupSize(db)
+	if estimate.Duration >= longBackupThreshold {
+		b.log().Printf("Estimated backup size: %.2f MB, estimated time: %s",
+			float64(estimate.Size)/1024/1024, estimate.Duration.Round(time.Second))
+	}
 
 	var backupPath string
 	var size int64
 	var err error
 
-	if b.compress {
+	start := time.Now()
+	if b.hardlink {
+		// Keep the checkpoint, whose SSTables are hardlinks to the database's
+		backupPath = fmt.Sprintf("%s.backup_%s", b.dbPath, timestamp)
+		b.log().Printf("Creating hardlinked backup: %s", backupPath)
+		size, err = b.createCheckpointBackup(db, backupPath)
+	} else if b.compress {
 		// Create compressed tar.gz backup using checkpoint
 		backupPath = fmt.Sprintf("%s.backup_%s.tar.gz", b.dbPath, timestamp)
-		fmt.Printf("Creating compressed backup: %s\n", backupPath)
+		b.log().Printf("Creating compressed backup: %s", backupPath)
 		size, err = b.createCompressedCheckpointBackup(db, backupPath)
 	} else {
 		// Create uncompressed directory backup using checkpoint
 		backupPath = fmt.Sprintf("%s.backup_%s", b.dbPath, timestamp)
-		fmt.Printf("Creating backup: %s\n", backupPath)
+		b.log().Printf("Creating backup: %s", backupPath)
 		size, err = b.createCheckpointBackup(db, backupPath)
 	}
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create backup: %w", err)
 	}
+	duration := time.Since(start)
 
-	// Get current schema version from open database
-	version := int32(0)
-	schemaManager := NewSchemaManager(db)
-	if schema, err := schemaManager.GetSchemaVersion(); err == nil {
-		// Convert int64 timestamp to int32 for backward compatibility
-		// This is safe as we're within the valid int32 range for timestamps
-		if schema.CurrentVersion <= int64(^int32(0)) {
-			version = int32(schema.CurrentVersion)
+	if b.faultInjector != nil {
+		if err := b.faultInjector(FaultDuringBackup, ""); err != nil {
+			return nil, fmt.Errorf("failed to create backup: %w", err)
 		}
 	}
 
@@ -89,87 +245,301 @@ func (b *BackupManager) CreateBackup(db *pebble.DB, description string) (*Backup
 		OriginalDB:  b.dbPath,
 		CreatedAt:   time.Now(),
 		Size:        size,
-		Version:     version,
+		Version:     b.backupSchemaVersion(db),
 		Description: description,
+		Hardlinked:  b.hardlink,
+		SourceSize:  estimate.SourceSize,
+		Duration:    duration,
+	}
+	// Hardlinked backups are not read, to keep them instant
+	if !b.hardlink {
+		if backupInfo.Checksum, err = b.BackupChecksum(backupPath); err != nil {
+			return nil, fmt.Errorf("failed to create backup: %w", err)
+		}
 	}
+	if err := b.finishBackup(backupInfo); err != nil {
+		return nil, err
+	}
+	b.recordAudit(db, AuditRecord{
+		Type:        AuditBackup,
+		Path:        backupPath,
+		Checksum:    backupInfo.Checksum,
+		Version:     int64(backupInfo.Version),
+		Description: description,
+	})
 
-	// Cleanup old backups if enabled
-	if b.cleanupOldBackups {
-		if err := b.performBackupCleanup(); err != nil {
-			fmt.Printf("Warning: failed to cleanup old backups: %v\n", err)
+	b.log().Printf("Backup created successfully: %s (%.2f MB)",
+		backupPath, float64(size)/1024/1024)
+
+	backupInfo.Warnings = b.warnings.since(warnings)
+	return backupInfo, nil
+}
+
+// backupSchemaVersion returns the schema version recorded in the metadata of a
+// backup of db
+func (b *BackupManager) backupSchemaVersion(db *pebble.DB) int32 {
+	version := int32(0)
+	schemaManager := NewSchemaManager(db)
+	schemaManager.SetSchemaKey(b.schemaKey)
+	if schema, err := schemaManager.getSchemaHead(); err == nil {
+		// Convert int64 timestamp to int32 for backward compatibility
+		// This is safe as we're within the valid int32 range for timestamps
+		if schema.CurrentVersion <= math.MaxInt32 {
+			version = int32(schema.CurrentVersion)
 		}
 	}
+	return version
+}
 
+// finishBackup writes the metadata of a created backup and removes old backups
+// if enabled
+func (b *BackupManager) finishBackup(backupInfo *BackupInfo) error {
 	// Write backup metadata
 	if err := b.writeBackupMetadata(backupInfo); err != nil {
-		return nil, fmt.Errorf("failed to write backup metadata: %w", err)
+		return fmt.Errorf("failed to write backup metadata: %w", err)
 	}
 
-	fmt.Printf("Backup created successfully: %s (%.2f MB)\n",
-		backupPath, float64(size)/1024/1024)
+	// Cleanup old backups if enabled, counting the new one
+	if b.cleanupOldBackups {
+		if err := b.performBackupCleanup(); err != nil {
+			b.warnf("backup cleanup", "failed to cleanup old backups: %v", err)
+		}
+	}
+	return nil
+}
 
-	return backupInfo, nil
+// RestoreReport describes a restored database compared to the backup it was
+// restored from
+type RestoreReport struct {
+	Backup          *BackupInfo
+	RestoredVersion int64        // Schema version of the restored database
+	Status          Status       // Schema status of the restored database
+	ValidationError error        // Why ValidateSchemaState failed on the restored database, if it did
+	Pending         []*Migration // Registered migrations not applied in the restored database; nil without a registry
+	Warnings        []Warning    // Soft failures of the restore, e.g. a previous database that could not be removed
+}
+
+// VersionMatches reports whether the restored schema version is the version
+// recorded in the backup metadata
+func (r *RestoreReport) VersionMatches() bool {
+	return int64(r.Backup.Version) == r.RestoredVersion
 }
 
-// RestoreBackup restores a database from backup
+// RestoreBackup restores a database from backup, see RestoreBackupWithReport
 func (b *BackupManager) RestoreBackup(backupPath string) error {
-	fmt.Printf("Restoring database from backup: %s\n", backupPath)
+	_, err := b.RestoreBackupWithReport(backupPath)
+	return err
+}
+
+// RestoreBackupWithReport restores a database from backup. The backup is copied,
+// or extracted if it is compressed, into a sibling .restore_temp_ directory,
+// which is then swapped in with renames; the live database is never deleted
+// before the copy is complete. The old database is kept as .previous until the
+// restored one opens and its schema state decodes, and swapped back if it does
+// not.
+//
+// The returned report validates the restored schema state, compares its version
+// with the backup metadata and, if a registry is set, lists the migrations that
+// need to be reapplied. These findings do not fail the restore.
+//
+// Nothing may have the database open during the restore; use RestoreInto to
+// restore a database the caller has open.
+func (b *BackupManager) RestoreBackupWithReport(backupPath string) (*RestoreReport, error) {
+	return b.RestoreInto(backupPath, nil)
+}
+
+// RestoreInto restores a database the caller has open. The backup is copied while
+// the database stays open, then closeDB is called right before the swap; it must
+// close the database and stop everything using it. If closeDB fails, the restore
+// is abandoned with the database untouched.
+//
+// Once closeDB has been called the caller reopens the database, also when
+// RestoreInto fails: the previous database is swapped back on failure. A nil
+// closeDB is the same as RestoreBackupWithReport.
+func (b *BackupManager) RestoreInto(backupPath string, closeDB func() error) (*RestoreReport, error) {
+	b.log().Printf("Restoring database from backup: %s", backupPath)
+	warnings := b.warnings.mark()
 
 	// Verify backup exists and is valid
 	if !b.isValidBackup(backupPath) {
-		return fmt.Errorf("invalid backup directory: %s", backupPath)
+		return nil, fmt.Errorf("invalid backup directory: %s", backupPath)
 	}
 
 	// Read backup metadata
 	backupInfo, err := b.readBackupMetadata(backupPath)
 	if err != nil {
-		return fmt.Errorf("failed to read backup metadata: %w", err)
+		return nil, fmt.Errorf("failed to read backup metadata: %w", err)
 	}
 
 	// Verify this backup is for the current database
 	if backupInfo.OriginalDB != b.dbPath {
-		return fmt.Errorf("backup is for database %s, not %s",
+		return nil, fmt.Errorf("backup is for database %s, not %s",
 			backupInfo.OriginalDB, b.dbPath)
 	}
 
-	// Create temporary backup of current state
-	tempBackup := b.dbPath + ".restore_temp_" + time.Now().Format("20060102_150405")
-	if err := b.createTempBackup(tempBackup); err != nil {
-		return fmt.Errorf("failed to create temporary backup: %w", err)
+	previous := b.previousPath()
+	if _, err := os.Stat(previous); err == nil {
+		return nil, fmt.Errorf("%s exists from an interrupted restore; check and remove it first", previous)
 	}
-	defer func() {
-		// Clean up temp backup on success, keep on failure
-		if err == nil {
-			os.RemoveAll(tempBackup)
+
+	// Copy the backup next to the live database
+	staging := b.dbPath + ".restore_temp_" + time.Now().Format("20060102_150405")
+	purpose := "restore of " + backupPath
+	if err := b.trackTemp(staging, purpose); err != nil {
+		return nil, err
+	}
+	release, err := b.ReferenceBackup(backupPath, purpose)
+	if err != nil {
+		b.untrackTemp(staging, nil)
+		return nil, err
+	}
+	if strings.HasSuffix(backupPath, ".tar.gz") {
+		err = b.extractBackupArchive(backupPath, staging)
+	} else {
+		_, err = b.copyDatabaseFiles(backupPath, staging)
+	}
+	release()
+	if err != nil {
+		os.RemoveAll(staging)
+		b.untrackTemp(staging, nil)
+		return nil, fmt.Errorf("failed to copy backup: %w", err)
+	}
+
+	if closeDB != nil {
+		if err := closeDB(); err != nil {
+			os.RemoveAll(staging)
+			b.untrackTemp(staging, nil)
+			return nil, fmt.Errorf("failed to close database: %w", err)
+		}
+	}
+
+	// Swap it in, keeping the live database as .previous
+	hasLive := true
+	if _, err := os.Stat(b.dbPath); os.IsNotExist(err) {
+		hasLive = false
+	}
+	if hasLive {
+		if err := b.trackTemp(previous, "database before "+purpose); err != nil {
+			os.RemoveAll(staging)
+			b.untrackTemp(staging, nil)
+			return nil, err
+		}
+		if err := os.Rename(b.dbPath, previous); err != nil {
+			b.untrackTemp(previous, nil)
+			return nil, fmt.Errorf("failed to move current database aside: %w", err)
+		}
+	}
+	if err := os.Rename(staging, b.dbPath); err != nil {
+		b.untrackTemp(staging, err)
+		return nil, b.rollbackRestore(hasLive, err)
+	}
+
+	// Verify the restored database before dropping the previous one
+	report := &RestoreReport{Backup: backupInfo}
+	if err := b.verifyRestoredDatabase(report); err != nil {
+		b.untrackTemp(staging, nil)
+		os.RemoveAll(b.dbPath)
+		return nil, b.rollbackRestore(hasLive, err)
+	}
+
+	b.untrackTemp(staging, nil)
+	if hasLive {
+		if err := os.RemoveAll(previous); err != nil {
+			b.warnf("restore", "failed to remove previous database %s: %v", previous, err)
 		} else {
-			fmt.Printf("Temporary backup kept at: %s\n", tempBackup)
+			b.untrackTemp(previous, nil)
 		}
-	}()
+	}
+
+	b.recordRestoreAudit(report)
+
+	b.log().Printf("Database restored successfully from backup")
+	b.log().Printf("  Backup created: %s", backupInfo.CreatedAt.Format("2006-01-02 15:04:05"))
+	b.log().Printf("  Backup version: %d", backupInfo.Version)
+	b.log().Printf("  Description: %s", backupInfo.Description)
+	b.printRestoreReport(report)
+
+	report.Warnings = b.warnings.since(warnings)
+	return report, nil
+}
 
-	// Remove current database
-	if err := os.RemoveAll(b.dbPath); err != nil {
-		return fmt.Errorf("failed to remove current database: %w", err)
+// rollbackRestore moves the previous database back after a failed restore and
+// returns the error to report for cause
+func (b *BackupManager) rollbackRestore(hasLive bool, cause error) error {
+	if !hasLive {
+		return fmt.Errorf("restore failed: %w", cause)
 	}
 
-	// Restore from backup
-	_, err = b.copyDatabaseFiles(backupPath, b.dbPath)
-	if err != nil {
-		// Try to restore from temp backup
-		if restoreErr := b.restoreFromTemp(tempBackup); restoreErr != nil {
-			return fmt.Errorf("restore failed and recovery failed: %w (original: %v)",
-				restoreErr, err)
+	previous := b.previousPath()
+	if err := os.Rename(previous, b.dbPath); err != nil {
+		b.untrackTemp(previous, cause)
+		return fmt.Errorf("restore failed and recovery failed: %w (original: %v); previous database kept at %s",
+			err, cause, previous)
+	}
+	b.untrackTemp(previous, nil)
+	return fmt.Errorf("restore failed but database recovered: %w", cause)
+}
+
+// previousPath returns where RestoreBackup keeps the replaced database until the
+// restored one is verified
+func (b *BackupManager) previousPath() string {
+	return b.dbPath + ".previous"
+}
+
+// verifyRestoredDatabase checks that the restored database opens and that its
+// schema state decodes, and fills in the report
+func (b *BackupManager) verifyRestoredDatabase(report *RestoreReport) error {
+	if b.faultInjector != nil {
+		if err := b.faultInjector(FaultDuringRestore, ""); err != nil {
+			return err
 		}
-		return fmt.Errorf("restore failed but database recovered: %w", err)
 	}
 
-	fmt.Printf("Database restored successfully from backup\n")
-	fmt.Printf("  Backup created: %s\n", backupInfo.CreatedAt.Format("2006-01-02 15:04:05"))
-	fmt.Printf("  Backup version: %d\n", backupInfo.Version)
-	fmt.Printf("  Description: %s\n", backupInfo.Description)
+	db, err := pebble.Open(b.dbPath, &pebble.Options{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("restored database does not open: %w", err)
+	}
+	defer db.Close()
 
+	schemaManager := NewSchemaManager(db)
+	schemaManager.SetSchemaKey(b.schemaKey)
+	schemaManager.SetKeyPrefix(b.keyPrefix)
+	head, err := schemaManager.getSchemaHead()
+	if err != nil {
+		return fmt.Errorf("restored database has unreadable schema state: %w", err)
+	}
+	report.RestoredVersion = head.CurrentVersion
+	report.Status = head.Status
+	report.ValidationError = schemaManager.ValidateSchemaState()
+
+	if b.registry != nil {
+		plan, err := NewMigrationPlanner(b.registry, schemaManager).PlanUpgrade()
+		if err != nil {
+			if report.ValidationError == nil {
+				report.ValidationError = fmt.Errorf("failed to plan pending migrations: %w", err)
+			}
+		} else {
+			report.Pending = plan.Migrations
+		}
+	}
 	return nil
 }
 
+// printRestoreReport prints what needs attention after a restore
+func (b *BackupManager) printRestoreReport(report *RestoreReport) {
+	b.log().Printf("  Restored schema version: %d (%s)", report.RestoredVersion, report.Status)
+	if !report.VersionMatches() {
+		b.warnf("restore", "restored schema version %d differs from the backup version %d",
+			report.RestoredVersion, report.Backup.Version)
+	}
+	if report.ValidationError != nil {
+		b.warnf("restore", "restored schema state does not validate: %v", report.ValidationError)
+	}
+	if len(report.Pending) > 0 {
+		b.log().Printf("  %d migration(s) need to be reapplied", len(report.Pending))
+	}
+}
+
 // ListBackups lists all available backups for this database
 func (b *BackupManager) ListBackups() ([]*BackupInfo, error) {
 	dbDir := filepath.Dir(b.dbPath)
@@ -194,7 +564,8 @@ func (b *BackupManager) ListBackups() ([]*BackupInfo, error) {
 	return backups, nil
 }
 
-// CleanupOldBackups removes backups older than the specified duration
+// CleanupOldBackups removes backups older than the specified duration, except
+// the protected ones, see ProtectedBackups
 func (b *BackupManager) CleanupOldBackups(olderThan time.Duration) error {
 	backups, err := b.ListBackups()
 	if err != nil {
@@ -204,21 +575,17 @@ func (b *BackupManager) CleanupOldBackups(olderThan time.Duration) error {
 	cutoff := time.Now().Add(-olderThan)
 	removedCount := 0
 
+	protected := b.ProtectedBackups(backups)
 	for _, backup := range backups {
-		if backup.CreatedAt.Before(cutoff) {
-			fmt.Printf("Removing old backup: %s\n", backup.Path)
-			if err := os.RemoveAll(backup.Path); err != nil {
-				fmt.Printf("Warning: failed to remove backup %s: %v\n", backup.Path, err)
-			} else {
-				removedCount++
-			}
+		if backup.CreatedAt.Before(cutoff) && b.removeOldBackup(backup, protected) {
+			removedCount++
 		}
 	}
 
 	if removedCount > 0 {
-		fmt.Printf("Removed %d old backup(s)\n", removedCount)
+		b.log().Printf("Removed %d old backup(s)", removedCount)
 	} else {
-		fmt.Printf("No old backups to remove\n")
+		b.log().Printf("No old backups to remove")
 	}
 
 	return nil
@@ -233,8 +600,11 @@ func (b *BackupManager) copyDatabaseFiles(srcPath, dstPath string) (int64, error
 			return err
 		}
 
-		// Skip directories
+		// Skip directories and the references of the backup
 		if info.IsDir() {
+			if info.Name() == backupRefsDir {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -276,7 +646,7 @@ func (b *BackupManager) copyFile(src, dst string) (int64, error) {
 	}
 	defer dstFile.Close()
 
-	size, err := io.Copy(dstFile, srcFile)
+	size, err := io.Copy(dstFile, b.throttle(srcFile))
 	if err != nil {
 		return 0, err
 	}
@@ -289,21 +659,6 @@ func (b *BackupManager) copyFile(src, dst string) (int64, error) {
 	return size, nil
 }
 
-// createTempBackup creates a temporary backup for restore safety
-func (b *BackupManager) createTempBackup(tempPath string) error {
-	_, err := b.copyDatabaseFiles(b.dbPath, tempPath)
-	return err
-}
-
-// restoreFromTemp restores from temporary backup
-func (b *BackupManager) restoreFromTemp(tempPath string) error {
-	if err := os.RemoveAll(b.dbPath); err != nil {
-		return err
-	}
-	_, err := b.copyDatabaseFiles(tempPath, b.dbPath)
-	return err
-}
-
 // isValidBackup checks if a backup is valid
 func (b *BackupManager) isValidBackup(backupPath string) bool {
 	// Check if backup exists
@@ -351,6 +706,11 @@ ORIGINAL_DB=%s
 CREATED_AT=%s
 VERSION=%d
 SIZE=%d
+HARDLINKED=%t
+SOURCE_SIZE=%d
+DURATION=%s
+PINNED=%s
+CHECKSUM=%s
 DESCRIPTION=%s
 `,
 		info.CreatedAt.Format("2006-01-02 15:04:05"),
@@ -363,6 +723,11 @@ DESCRIPTION=%s
 		info.CreatedAt.Format(time.RFC3339),
 		info.Version,
 		info.Size,
+		info.Hardlinked,
+		info.SourceSize,
+		info.Duration,
+		info.Pinned,
+		info.Checksum,
 		info.Description,
 	)
 
@@ -385,11 +750,17 @@ func (b *BackupManager) readBackupMetadata(backupPath string) (*BackupInfo, erro
 		return nil, err
 	}
 
-	// Parse metadata (simple key=value format)
+	return parseBackupMetadata(backupPath, content)
+}
+
+// parseBackupMetadata parses the key=value backup metadata format.
+// Malformed values return an error wrapping ErrInvalidBackupMetadata instead of
+// being silently ignored.
+func parseBackupMetadata(backupPath string, content []byte) (*BackupInfo, error) {
 	info := &BackupInfo{Path: backupPath}
 
 	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
+	for i, line := range lines {
 		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
 			continue
 		}
@@ -406,18 +777,54 @@ func (b *BackupManager) readBackupMetadata(backupPath string) (*BackupInfo, erro
 		case "ORIGINAL_DB":
 			info.OriginalDB = value
 		case "CREATED_AT":
-			if t, err := time.Parse(time.RFC3339, value); err == nil {
-				info.CreatedAt = t
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: invalid CREATED_AT %q", ErrInvalidBackupMetadata, i+1, value)
 			}
+			info.CreatedAt = t
 		case "VERSION":
-			fmt.Sscanf(value, "%d", &info.Version)
+			version, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: invalid VERSION %q", ErrInvalidBackupMetadata, i+1, value)
+			}
+			info.Version = int32(version)
 		case "SIZE":
-			fmt.Sscanf(value, "%d", &info.Size)
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("%w: line %d: invalid SIZE %q", ErrInvalidBackupMetadata, i+1, value)
+			}
+			info.Size = size
+		case "HARDLINKED":
+			hardlinked, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: invalid HARDLINKED %q", ErrInvalidBackupMetadata, i+1, value)
+			}
+			info.Hardlinked = hardlinked
+		case "SOURCE_SIZE":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("%w: line %d: invalid SOURCE_SIZE %q", ErrInvalidBackupMetadata, i+1, value)
+			}
+			info.SourceSize = size
+		case "DURATION":
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration < 0 {
+				return nil, fmt.Errorf("%w: line %d: invalid DURATION %q", ErrInvalidBackupMetadata, i+1, value)
+			}
+			info.Duration = duration
+		case "PINNED":
+			info.Pinned = value
+		case "CHECKSUM":
+			info.Checksum = value
 		case "DESCRIPTION":
 			info.Description = value
 		}
 	}
 
+	if info.OriginalDB == "" {
+		return nil, fmt.Errorf("%w: missing ORIGINAL_DB", ErrInvalidBackupMetadata)
+	}
+
 	return info, nil
 }
 
@@ -450,12 +857,8 @@ func (b *BackupManager) GetBackupSize(backupPath string) (int64, error) {
 
 // createCheckpointBackup creates an uncompressed directory backup using Pebble Checkpoint
 func (b *BackupManager) createCheckpointBackup(db *pebble.DB, backupPath string) (int64, error) {
-	// Create backup directory
-	if err := os.MkdirAll(backupPath, 0755); err != nil {
-		return 0, fmt.Errorf("failed to create backup directory: %w", err)
-	}
-
 	// Create checkpoint with flushed WAL for consistency
+	// Pebble will create the directory and fails if it already exists
 	if err := db.Checkpoint(backupPath, pebble.WithFlushedWAL()); err != nil {
 		// Clean up failed backup
 		os.RemoveAll(backupPath)
@@ -505,7 +908,7 @@ func (b *BackupManager) compressCheckpoint(checkpointPath, backupPath string) (i
 	defer file.Close()
 
 	// Create gzip writer
-	gzipWriter := gzip.NewWriter(file)
+	gzipWriter := b.newCompressor(file)
 	defer gzipWriter.Close()
 
 	// Create tar writer
@@ -518,8 +921,11 @@ func (b *BackupManager) compressCheckpoint(checkpointPath, backupPath string) (i
 			return err
 		}
 
-		// Skip directories
+		// Skip directories and the references of the backup
 		if info.IsDir() {
+			if info.Name() == backupRefsDir {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -549,10 +955,16 @@ func (b *BackupManager) compressCheckpoint(checkpointPath, backupPath string) (i
 		}
 		defer srcFile.Close()
 
-		_, err = io.Copy(tarWriter, srcFile)
+		_, err = io.Copy(tarWriter, b.throttle(srcFile))
 		return err
 	})
 
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err == nil {
+		err = gzipWriter.Close()
+	}
 	if err != nil {
 		os.Remove(backupPath)
 		return 0, err
@@ -567,6 +979,59 @@ func (b *BackupManager) compressCheckpoint(checkpointPath, backupPath string) (i
 	return stat.Size(), nil
 }
 
+// extractBackupArchive extracts a compressed backup into the database directory
+// dstPath
+func (b *BackupManager) extractBackupArchive(backupPath, dstPath string) error {
+	file, err := os.Open(backupPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(b.throttle(file))
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// Entries are under the database name as root
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		parts := strings.SplitN(name, string(filepath.Separator), 2)
+		if len(parts) != 2 || parts[1] == ".." || strings.HasPrefix(parts[1], ".."+string(filepath.Separator)) || filepath.IsAbs(name) {
+			return fmt.Errorf("unexpected entry %q in backup archive", header.Name)
+		}
+
+		dstFile := filepath.Join(dstPath, parts[1])
+		if err := os.MkdirAll(filepath.Dir(dstFile), 0755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(dstFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tarReader)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
 // createDirectoryBackup creates an uncompressed directory backup
 func (b *BackupManager) createDirectoryBackup(backupPath string) (int64, error) {
 	// Create backup directory
@@ -585,64 +1050,28 @@ func (b *BackupManager) createDirectoryBackup(backupPath string) (int64, error)
 	return size, nil
 }
 
-// performBackupCleanup removes old backups beyond the maxBackups limit
-func (b *BackupManager) performBackupCleanup() error {
-	if b.maxBackups <= 0 {
-		return nil // No limit
-	}
-
-	// Find all backup files/directories for this database
-	parentDir := filepath.Dir(b.dbPath)
-	dbName := filepath.Base(b.dbPath)
-
-	var backups []backupFileInfo
-
-	entries, err := os.ReadDir(parentDir)
-	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
-	}
-
-	for _, entry := range entries {
-		name := entry.Name()
-		// Match backup files: dbname.backup_TIMESTAMP or dbname.backup_TIMESTAMP.tar.gz
-		if strings.HasPrefix(name, dbName+".backup_") {
-			fullPath := filepath.Join(parentDir, name)
-			info, err := entry.Info()
-			if err != nil {
-				continue
-			}
-
-			backups = append(backups, backupFileInfo{
-				path:    fullPath,
-				modTime: info.ModTime(),
-			})
-		}
-	}
+// OpLogPath returns the path an operation log of migrationID created at t is saved to
+func (b *BackupManager) OpLogPath(migrationID string, t time.Time) string {
+	return fmt.Sprintf("%s.oplog_%s_%s", b.dbPath, t.Format("20060102_150405"), migrationID)
+}
 
-	// Sort by modification time (newest first)
-	for i := 0; i < len(backups)-1; i++ {
-		for j := i + 1; j < len(backups); j++ {
-			if backups[i].modTime.Before(backups[j].modTime) {
-				backups[i], backups[j] = backups[j], backups[i]
-			}
-		}
+// SaveOpLog saves an operation log next to the backups of this database
+func (b *BackupManager) SaveOpLog(log *OpLog) (string, error) {
+	path := b.OpLogPath(log.MigrationID, log.CreatedAt)
+	if err := WriteOpLog(path, log); err != nil {
+		return "", err
 	}
+	return path, nil
+}
 
-	// Remove old backups
-	if len(backups) > b.maxBackups {
-		for i := b.maxBackups; i < len(backups); i++ {
-			fmt.Printf("Removing old backup: %s\n", backups[i].path)
-			if err := os.RemoveAll(backups[i].path); err != nil {
-				fmt.Printf("Warning: failed to remove backup %s: %v\n", backups[i].path, err)
-			}
-		}
+// ListOpLogs returns the paths of the saved operation logs for this database, oldest first
+func (b *BackupManager) ListOpLogs() ([]string, error) {
+	pattern := filepath.Join(filepath.Dir(b.dbPath), filepath.Base(b.dbPath)+".oplog_*")
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find operation logs: %w", err)
 	}
-
-	return nil
+	sort.Strings(matches)
+	return matches, nil
 }
 
-// backupFileInfo holds backup file information for sorting
-type backupFileInfo struct {
-	path    string
-	modTime time.Time
-}
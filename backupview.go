@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// OpenBackup opens a backup read-only without restoring it, e.g. to look at data
+// as it was at the time of the backup. The backup is copied, or extracted if
+// compressed, next to the database and opened from there, leaving the backup
+// untouched. The returned function closes the database and removes the copy.
+func (b *BackupManager) OpenBackup(backupPath string) (*pebble.DB, func(), error) {
+	if !b.isValidBackup(backupPath) {
+		return nil, nil, fmt.Errorf("invalid backup: %s", backupPath)
+	}
+
+	temp := b.dbPath + ".backup_view_" + time.Now().Format("20060102_150405")
+	purpose := "view of " + backupPath
+	if err := b.trackTemp(temp, purpose); err != nil {
+		return nil, nil, err
+	}
+	remove := func() {
+		os.RemoveAll(temp)
+		b.untrackTemp(temp, nil)
+	}
+
+	release, err := b.ReferenceBackup(backupPath, purpose)
+	if err != nil {
+		remove()
+		return nil, nil, err
+	}
+	if strings.HasSuffix(backupPath, ".tar.gz") {
+		err = b.extractBackupArchive(backupPath, temp)
+	} else {
+		_, err = b.copyDatabaseFiles(backupPath, temp)
+	}
+	release()
+	if err != nil {
+		remove()
+		return nil, nil, fmt.Errorf("failed to copy backup: %w", err)
+	}
+
+	db, err := pebble.Open(temp, &pebble.Options{ReadOnly: true})
+	if err != nil {
+		remove()
+		return nil, nil, fmt.Errorf("backup does not open: %w", err)
+	}
+	return db, func() {
+		db.Close()
+		remove()
+	}, nil
+}
+
+// OpenBackupSchema opens a backup like OpenBackup and returns a schema manager
+// for it that uses the manager's schema key and key prefix
+func (b *BackupManager) OpenBackupSchema(backupPath string) (*SchemaManager, func(), error) {
+	db, closeBackup, err := b.OpenBackup(backupPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	schemaManager := NewSchemaManager(db)
+	schemaManager.SetSchemaKey(b.schemaKey)
+	schemaManager.SetKeyPrefix(b.keyPrefix)
+	return schemaManager, closeBackup, nil
+}
@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestOpenBackup(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "test.db")
+			db, err := pebble.Open(dbPath, &pebble.Options{})
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+			if err := NewSchemaManager(db).InitializeFreshDatabase(NewMigrationRegistry()); err != nil {
+				t.Fatalf("Failed to initialize: %v", err)
+			}
+			db.Set([]byte("user/1"), []byte("alice"), pebble.Sync)
+			db.Set([]byte("user/2"), []byte("bob"), pebble.Sync)
+
+			backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{Compress: compress})
+			backup, err := backupManager.CreateBackup(db, "Before")
+			if err != nil {
+				t.Fatalf("Failed to back up: %v", err)
+			}
+			db.Set([]byte("user/1"), []byte("changed"), pebble.Sync)
+			db.Delete([]byte("user/2"), pebble.Sync)
+
+			schemaManager, closeBackup, err := backupManager.OpenBackupSchema(backup.Path)
+			if err != nil {
+				t.Fatalf("Failed to open backup: %v", err)
+			}
+			value, exists, err := schemaManager.GetKey([]byte("user/1"))
+			if err != nil || !exists || string(value) != "alice" {
+				t.Errorf("Expected user/1 = alice in the backup, got %q, %v, %v", value, exists, err)
+			}
+			stats, err := schemaManager.StatPrefix(nil)
+			if err != nil {
+				t.Fatalf("Failed to stat backup: %v", err)
+			}
+			if stats.Keys != 2 || stats.KeyBytes != 12 || stats.ValueBytes != 8 {
+				t.Errorf("Expected 2 keys of 12 and 8 bytes without the internal keys, got %+v", stats)
+			}
+			closeBackup()
+
+			view, closeView, err := backupManager.OpenBackup(backup.Path)
+			if err != nil {
+				t.Fatalf("Failed to open backup: %v", err)
+			}
+			if err := view.Set([]byte("user/3"), nil, pebble.Sync); err == nil {
+				t.Errorf("Expected the backup to be opened read-only")
+			}
+			closeView()
+
+			if temps, _ := filepath.Glob(dbPath + ".backup_view_*"); len(temps) != 0 {
+				t.Errorf("Expected the copy of the backup to be removed, got %v", temps)
+			}
+			if _, _, err := backupManager.OpenBackup(dbPath + ".missing"); err == nil {
+				t.Errorf("Expected opening a missing backup to fail")
+			}
+		})
+	}
+}
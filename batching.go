@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetBatchLimits caps how much of an upgrade plan one execution runs: no more
+// than maxMigrations migrations, and no migration is started once maxDuration
+// has passed since the plan started. The rest of the plan is deferred (see
+// DeferredMigrations) and the plan succeeds; the deferred migrations stay pending
+// for the next execution. The first migration always runs, so every execution
+// makes progress. Zero disables a limit.
+//
+// With parallelism, the limits are checked between waves and a wave that would
+// exceed maxMigrations is deferred as a whole.
+func (e *MigrationEngine) SetBatchLimits(maxMigrations int, maxDuration time.Duration) {
+	e.maxBatchMigrations = maxMigrations
+	e.maxBatchDuration = maxDuration
+}
+
+// DeferredMigrations returns the migrations of the last executed plan that were
+// deferred by the batch limits, in plan order
+func (e *MigrationEngine) DeferredMigrations() []*Migration {
+	return e.deferred
+}
+
+// batchExhausted reports whether the batch limits leave no room for the next
+// count migrations after ran migrations of a plan that started at start
+func (e *MigrationEngine) batchExhausted(ran, count int, start time.Time) bool {
+	if ran == 0 {
+		return false
+	}
+	if e.maxBatchMigrations > 0 && ran+count > e.maxBatchMigrations {
+		return true
+	}
+	return e.maxBatchDuration > 0 && time.Since(start) >= e.maxBatchDuration
+}
+
+// deferRest defers rest, the migrations of a plan of total migrations that did
+// not run, and reports it
+func (e *MigrationEngine) deferRest(rest []*Migration, total int, progress ProgressReporter) {
+	e.deferred = rest
+	ran := total - len(rest)
+	progress.Report(ProgressEvent{
+		Phase:   ProgressPlanCompleted,
+		Step:    ran,
+		Total:   total,
+		Percent: planPercent(ran, total),
+		Message: fmt.Sprintf("Upgrade batch completed: %d of %d migrations applied, %d deferred by the batch limits",
+			ran, total, len(rest)),
+	})
+}
@@ -0,0 +1,142 @@
+package migrate
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestBatchLimits(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	schemaManager := NewSchemaManager(db)
+	noop := func(db *pebble.DB) error { return nil }
+	slow := func(db *pebble.DB) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+	registry := NewMigrationRegistry()
+	for _, m := range []*Migration{
+		{ID: "1754917200_a", Up: noop, Down: noop},
+		{ID: "1754917300_b", Up: slow, Down: noop},
+		{ID: "1754917400_c", Up: noop, Down: noop},
+		{ID: "1754917500_d", Up: noop, Down: noop},
+	} {
+		if err := registry.Register(m); err != nil {
+			t.Fatalf("Failed to register: %v", err)
+		}
+	}
+	planner := NewMigrationPlanner(registry, schemaManager)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	// At most two migrations
+	engine.SetBatchLimits(2, 0)
+	plan, err := planner.PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+	if deferred := engine.DeferredMigrations(); len(deferred) != 2 || deferred[0].ID != "1754917400_c" {
+		t.Fatalf("Expected c and d to be deferred, got %v", deferred)
+	}
+	plans, err := schemaManager.PlanHistory()
+	if err != nil || len(plans) != 1 {
+		t.Fatalf("Expected one recorded plan, got %v, %v", plans, err)
+	}
+	if record := plans[0]; fmt.Sprint(record.Migrations) != "[1754917200_a 1754917300_b]" ||
+		fmt.Sprint(record.Deferred) != "[1754917400_c 1754917500_d]" || record.TargetVersion != 1754917300 {
+		t.Errorf("Expected the plan record to show where it stopped, got %+v", record)
+	}
+
+	// The slow migration used up the time budget, so the next one is deferred
+	plan, err = planner.PlanDowngrade(1754917200)
+	if err != nil {
+		t.Fatalf("Failed to plan downgrade: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	engine.SetBatchLimits(0, 10*time.Millisecond)
+	plan, err = planner.PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+	if deferred := engine.DeferredMigrations(); len(deferred) != 2 {
+		t.Errorf("Expected the migrations after the slow one to be deferred, got %v", deferred)
+	}
+
+	// Without limits the rest runs
+	engine.SetBatchLimits(0, 0)
+	plan, err = planner.PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+	if deferred := engine.DeferredMigrations(); len(deferred) != 0 {
+		t.Errorf("Expected nothing to be deferred, got %v", deferred)
+	}
+}
+
+func TestStartupBatches(t *testing.T) {
+	originalRegistry := GlobalRegistry
+	defer func() { GlobalRegistry = originalRegistry }()
+
+	GlobalRegistry = NewMigrationRegistry()
+	noop := func(db *pebble.DB) error { return nil }
+	for _, id := range []string{"1754917200_a", "1754917300_b", "1754917400_c"} {
+		GlobalRegistry.Register(&Migration{ID: id, Up: noop, Down: noop})
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	schemaManager := NewSchemaManager(db)
+	if err := schemaManager.InitializeFreshDatabase(NewMigrationRegistry()); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+
+	opts := DefaultStartupOptions()
+	opts.RunMigrations = true
+	opts.CheckDiskSpace = false
+	opts.MaxMigrationsPerStartup = 2
+	for startup, want := range []int64{1754917300, 1754917400} {
+		if err := CheckAndRunStartupMigrations(db, dbPath, opts); err != nil {
+			t.Fatalf("Startup %d failed: %v", startup+1, err)
+		}
+		schema, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to read schema: %v", err)
+		}
+		if schema.CurrentVersion != want {
+			t.Errorf("Expected startup %d to reach version %d, got %d", startup+1, want, schema.CurrentVersion)
+		}
+	}
+
+	// The version reached must still be supported
+	GlobalRegistry.Register(&Migration{ID: "1754917500_d", Up: noop, Down: noop})
+	GlobalRegistry.Register(&Migration{ID: "1754917600_e", Up: noop, Down: noop})
+	opts.MaxMigrationsPerStartup = 1
+	opts.MinSchemaVersion = 1754917600
+	if err := CheckAndRunStartupMigrations(db, dbPath, opts); err == nil {
+		t.Errorf("Expected startup below MinSchemaVersion to fail")
+	}
+}
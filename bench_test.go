@@ -0,0 +1,249 @@
+package migrate
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// Benchmarks for engine overhead, schema state I/O, batch throughput and backup
+// compression. Dataset size for the data-heavy benchmarks defaults to a small
+// value so `go test -bench .` stays quick; set PEBBLE_MIGRATE_BENCH_MB to run
+// against multi-GB synthetic datasets, e.g.:
+//
+//	PEBBLE_MIGRATE_BENCH_MB=4096 go test -run '^$' -bench Backup -benchtime 1x
+
+const benchValueSize = 1024
+
+// benchDatasetMB returns the synthetic dataset size in MB
+func benchDatasetMB() int {
+	if v := os.Getenv("PEBBLE_MIGRATE_BENCH_MB"); v != "" {
+		if mb, err := strconv.Atoi(v); err == nil && mb > 0 {
+			return mb
+		}
+	}
+	return 16
+}
+
+// openBenchDB opens a scratch database in a temporary directory
+func openBenchDB(b *testing.B) (*pebble.DB, string) {
+	b.Helper()
+	dir := b.TempDir()
+	dbPath := filepath.Join(dir, "bench.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		b.Fatalf("Failed to open database: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return db, dbPath
+}
+
+// populateBenchDB writes sizeMB of pseudo-random values under the given prefix
+func populateBenchDB(b *testing.B, db *pebble.DB, prefix string, sizeMB int) int {
+	b.Helper()
+	rng := rand.New(rand.NewSource(1))
+	value := make([]byte, benchValueSize)
+	keys := sizeMB * 1024 * 1024 / benchValueSize
+
+	batch := db.NewBatch()
+	for i := 0; i < keys; i++ {
+		rng.Read(value)
+		if err := batch.Set([]byte(fmt.Sprintf("%s%012d", prefix, i)), value, nil); err != nil {
+			b.Fatalf("Failed to populate database: %v", err)
+		}
+		if batch.Len() >= 4*1024*1024 {
+			if err := batch.Commit(pebble.NoSync); err != nil {
+				b.Fatalf("Failed to commit batch: %v", err)
+			}
+			batch = db.NewBatch()
+		}
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		b.Fatalf("Failed to commit batch: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		b.Fatalf("Failed to flush database: %v", err)
+	}
+	return keys
+}
+
+func BenchmarkEngineOverhead(b *testing.B) {
+	for _, count := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("migrations=%d", count), func(b *testing.B) {
+			noop := func(db *pebble.DB) error { return nil }
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				db, dbPath := openBenchDB(b)
+				registry := NewMigrationRegistry()
+				for j := 0; j < count; j++ {
+					registry.Register(&Migration{
+						ID:          fmt.Sprintf("%d_bench_%d", 1700000000+j, j),
+						Description: "Benchmark migration",
+						Up:          noop,
+						Down:        noop,
+					})
+				}
+				schemaManager := NewSchemaManager(db)
+				engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+				engine.SetBackupEnabled(false)
+				plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+				if err != nil {
+					b.Fatalf("Failed to plan upgrade: %v", err)
+				}
+				b.StartTimer()
+
+				if err := engine.ExecutePlan(plan, nil); err != nil {
+					b.Fatalf("Failed to execute plan: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSchemaReadWrite(b *testing.B) {
+	for _, historySize := range []int{10, 1000, 10000} {
+		db, _ := openBenchDB(b)
+		schemaManager := NewSchemaManager(db)
+
+		schema := &SchemaVersion{
+			AppliedMigrations: make(map[string]bool, historySize),
+			MigrationHistory:  make([]MigrationRecord, 0, historySize),
+			Status:            StatusClean,
+		}
+		for i := 0; i < historySize; i++ {
+			id := fmt.Sprintf("%d_bench_%d", 1700000000+i, i)
+			schema.AppliedMigrations[id] = true
+			schema.MigrationHistory = append(schema.MigrationHistory, MigrationRecord{
+				ID:           id,
+				Description:  "Benchmark migration",
+				AppliedAt:    time.Now(),
+				Duration:     time.Millisecond,
+				DurationText: "1ms",
+				Success:      true,
+			})
+		}
+		if err := schemaManager.SetSchemaVersion(schema); err != nil {
+			b.Fatalf("Failed to set schema version: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("read/history=%d", historySize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := schemaManager.GetSchemaVersion(); err != nil {
+					b.Fatalf("Failed to get schema version: %v", err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("write/history=%d", historySize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := schemaManager.SetSchemaVersion(schema); err != nil {
+					b.Fatalf("Failed to set schema version: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSchemaEncoding(b *testing.B) {
+	version := &SchemaVersion{AppliedMigrations: make(map[string]bool), Status: StatusClean, LastMigrationAt: time.Now()}
+	for i := 0; i < 10000; i++ {
+		version.AppliedMigrations[fmt.Sprintf("%d_bench_%d", 1700000000+i, i)] = true
+	}
+
+	for _, encoding := range []SchemaEncoding{SchemaEncodingJSON, SchemaEncodingProto} {
+		data, err := encodeSchemaHead(version, encoding)
+		if err != nil {
+			b.Fatalf("Failed to encode schema: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("encode/%s", encoding), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				encodeSchemaHead(version, encoding)
+			}
+		})
+
+		b.Run(fmt.Sprintf("decode/%s", encoding), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := decodeSchemaVersion(data); err != nil {
+					b.Fatalf("Failed to decode schema: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBatchThroughput(b *testing.B) {
+	for _, batchSize := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("batch=%d", batchSize), func(b *testing.B) {
+			db, _ := openBenchDB(b)
+			keys := populateBenchDB(b, db, "data:", benchDatasetMB())
+			b.SetBytes(int64(keys) * benchValueSize)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				// Rewrite every value the way a typical data migration does
+				iter, err := db.NewIter(&pebble.IterOptions{
+					LowerBound: []byte("data:"),
+					UpperBound: []byte("data;"),
+				})
+				if err != nil {
+					b.Fatalf("Failed to create iterator: %v", err)
+				}
+
+				batch := db.NewBatch()
+				count := 0
+				for iter.First(); iter.Valid(); iter.Next() {
+					if err := batch.Set(iter.Key(), iter.Value(), nil); err != nil {
+						b.Fatalf("Failed to set key: %v", err)
+					}
+					count++
+					if count >= batchSize {
+						if err := batch.Commit(pebble.NoSync); err != nil {
+							b.Fatalf("Failed to commit batch: %v", err)
+						}
+						batch = db.NewBatch()
+						count = 0
+					}
+				}
+				if err := batch.Commit(pebble.Sync); err != nil {
+					b.Fatalf("Failed to commit batch: %v", err)
+				}
+				iter.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkBackupCompression(b *testing.B) {
+	for _, compress := range []bool{false, true} {
+		b.Run(fmt.Sprintf("compress=%v", compress), func(b *testing.B) {
+			db, dbPath := openBenchDB(b)
+			keys := populateBenchDB(b, db, "data:", benchDatasetMB())
+			b.SetBytes(int64(keys) * benchValueSize)
+
+			backupManager := NewBackupManager(dbPath)
+			backupManager.compress = compress
+			backupManager.maxBackups = 1
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				info, err := backupManager.CreateBackup(db, "benchmark")
+				if err != nil {
+					b.Fatalf("Failed to create backup: %v", err)
+				}
+				b.StopTimer()
+				os.RemoveAll(info.Path)
+				os.Remove(info.Path + ".metadata")
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MarkBestEffortFailed records the failure of a best-effort migration (see
+// Migration.BestEffort) after running for duration. Unlike MarkMigrationFailed it
+// leaves the state clean so that the plan can continue; the migration stays
+// pending and is listed by SchemaVersion.BestEffortFailures.
+func (s *SchemaManager) MarkBestEffortFailed(migrationID string, description string, duration time.Duration, migrationErr error) error {
+	return s.recordCleanFailure(migrationID, description+" (FAILED, best effort)", duration, migrationErr, true)
+}
+
+// recordCleanFailure records a failed apply of a migration, leaving the state clean
+func (s *SchemaManager) recordCleanFailure(migrationID string, description string, duration time.Duration, migrationErr error, bestEffort bool) error {
+	return s.modifySchema(func(currentSchema *SchemaVersion) ([]MigrationRecord, error) {
+		record := MigrationRecord{
+			ID:           migrationID,
+			Type:         RecordApply,
+			Description:  description,
+			AppliedAt:    time.Now(),
+			Duration:     duration,
+			DurationText: duration.String(),
+			Success:      false,
+			Error:        migrationErr.Error(),
+			BestEffort:   bestEffort,
+		}
+
+		currentSchema.LastMigrationAt = record.AppliedAt
+		currentSchema.Status = StatusClean
+
+		return []MigrationRecord{record}, nil
+	})
+}
+
+// BestEffortFailures returns the last failure of every best-effort migration that
+// failed and has not been applied since, oldest first. These failures leave the
+// state clean, so the status does not show them otherwise.
+func (v *SchemaVersion) BestEffortFailures() []MigrationRecord {
+	last := make(map[string]MigrationRecord)
+	for _, record := range v.MigrationHistory {
+		if record.BestEffort && !record.Success {
+			last[record.ID] = record
+		} else if record.Success && record.Type.Applies() {
+			delete(last, record.ID)
+		}
+	}
+
+	var failures []MigrationRecord
+	for id, record := range last {
+		if !v.AppliedMigrations[id] {
+			failures = append(failures, record)
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].AppliedAt.Before(failures[j].AppliedAt) })
+	return failures
+}
+
+// SkippedMigrations returns the migrations of the last plan that were left
+// pending because a best-effort migration failed, or any migration with
+// FailureContinue: the failed migrations and those depending on them, in plan
+// order
+func (e *MigrationEngine) SkippedMigrations() []*Migration {
+	return e.skipped
+}
+
+// bestEffortFailed records the failure of a best-effort migration and warns about
+// it instead of failing the plan
+func (e *MigrationEngine) bestEffortFailed(migration *Migration, duration time.Duration, err error, progress ProgressReporter) error {
+	if markErr := e.schemaManager.MarkBestEffortFailed(migration.ID, migration.Description, duration, err); markErr != nil {
+		return fmt.Errorf("best-effort migration failed and failed to record the failure: %w (original error: %v)", markErr, err)
+	}
+	e.skipped = append(e.skipped, migration)
+	e.warnf(progress, "best effort", "best-effort migration %s failed, continuing: %v", migration.ID, err)
+	return nil
+}
+
+// skipIfBlocked skips a migration that depends on a migration skipped earlier in
+// the plan, and reports whether it did
+func (e *MigrationEngine) skipIfBlocked(migration *Migration, progress ProgressReporter) bool {
+	for _, dep := range migration.Dependencies {
+		dep = e.registry.ResolveID(dep)
+		for _, skipped := range e.skipped {
+			if skipped.ID == dep {
+				e.skipped = append(e.skipped, migration)
+				e.warnf(progress, "best effort", "skipping migration %s: it depends on %s, which failed or was skipped", migration.ID, dep)
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestBestEffortMigrations(t *testing.T) {
+	for _, parallelism := range []int{1, 2} {
+		dir := t.TempDir()
+		dbPath := filepath.Join(dir, "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		broken := true
+		cleanup := func(db *pebble.DB) error {
+			if broken {
+				return errors.New("cleanup failed")
+			}
+			return nil
+		}
+		noop := func(db *pebble.DB) error { return nil }
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{ID: "1754917200_cleanup", Up: cleanup, Down: noop, BestEffort: true, KeyPrefixes: []string{"tmp:"}})
+		registry.Register(&Migration{ID: "1754917300_after_cleanup", Up: noop, Down: noop, Dependencies: []string{"1754917200_cleanup"}, KeyPrefixes: []string{"tmp:"}})
+		registry.Register(&Migration{ID: "1754917400_independent", Up: noop, Down: noop, KeyPrefixes: []string{"user:"}})
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupEnabled(false)
+		engine.SetParallelism(parallelism)
+
+		// The failure and its dependent are skipped, the rest of the plan runs
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Expected the plan to succeed with parallelism %d, got %v", parallelism, err)
+		}
+		skipped := engine.SkippedMigrations()
+		if len(skipped) != 2 || skipped[0].ID != "1754917200_cleanup" || skipped[1].ID != "1754917300_after_cleanup" {
+			t.Errorf("Expected the failed migration and its dependent to be skipped, got %v", skipped)
+		}
+		if warnings := engine.Warnings(); len(warnings) != 2 || warnings[0].Source != "best effort" {
+			t.Errorf("Expected a warning per skipped migration, got %v", warnings)
+		}
+
+		schema, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get schema version: %v", err)
+		}
+		if schema.Status != StatusClean || schema.LastFailure != nil || len(schema.AppliedMigrations) != 1 ||
+			!schema.AppliedMigrations["1754917400_independent"] {
+			t.Errorf("Expected a clean state with only the independent migration applied, got %+v", schema)
+		}
+		failures := schema.BestEffortFailures()
+		if len(failures) != 1 || failures[0].ID != "1754917200_cleanup" || !strings.Contains(failures[0].Error, "cleanup failed") {
+			t.Errorf("Expected the best-effort failure to be listed, got %v", failures)
+		}
+		plans, err := schemaManager.PlanHistory()
+		if err != nil || len(plans) != 1 || len(plans[0].Skipped) != 2 || len(plans[0].Migrations) != 1 || !plans[0].Success {
+			t.Errorf("Expected the plan record to list the skipped migrations, got %+v (%v)", plans, err)
+		}
+
+		// Once it succeeds, the failure is no longer listed
+		broken = false
+		plan, _ = NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to execute plan: %v", err)
+		}
+		schema, err = schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get schema version: %v", err)
+		}
+		if len(schema.AppliedMigrations) != 3 || len(schema.BestEffortFailures()) != 0 || len(engine.SkippedMigrations()) != 0 {
+			t.Errorf("Expected every migration applied and no failures, got %+v", schema)
+		}
+	}
+}
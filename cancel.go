@@ -0,0 +1,39 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// planContext returns the context of the running plan, see ExecutePlanContext
+func (e *MigrationEngine) planContext() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+// canceledBefore returns the error a plan whose context is done fails with
+// instead of starting migration, or nil if the plan goes on. An upgrade that
+// continued past failed migrations marks the state dirty with the first failure
+// first, like at its end.
+func (e *MigrationEngine) canceledBefore(migration *Migration) error {
+	ctxErr := e.planContext().Err()
+	if ctxErr == nil {
+		return nil
+	}
+	err := fmt.Errorf("plan canceled before migration %s: %w", migration.ID, ctxErr)
+	if failErr := e.continuedFailure(); failErr != nil {
+		return fmt.Errorf("%w (after %v)", err, failErr)
+	}
+	return err
+}
+
+// canceledDuring reports whether a migration failed with err because the context
+// of the plan is done. Such a migration is left marked as running, like one whose
+// process stopped, instead of being marked as failed.
+func (e *MigrationEngine) canceledDuring(err error) bool {
+	ctxErr := e.planContext().Err()
+	return ctxErr != nil && errors.Is(err, ctxErr)
+}
@@ -0,0 +1,121 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestExecutePlanContext(t *testing.T) {
+	run := func(t *testing.T, ctx context.Context, parallelism int, migrations ...*Migration) (*SchemaVersion, error) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		registry := NewMigrationRegistry()
+		for _, m := range migrations {
+			if err := registry.Register(m); err != nil {
+				t.Fatalf("Failed to register: %v", err)
+			}
+		}
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupEnabled(false)
+		engine.SetParallelism(parallelism)
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		planErr := engine.ExecutePlanContext(ctx, plan, nil)
+		schema, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get schema version: %v", err)
+		}
+		return schema, planErr
+	}
+	noop := func(db *pebble.DB) error { return nil }
+
+	t.Run("BetweenMigrations", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stop := func(db *pebble.DB) error { cancel(); return nil }
+		schema, err := run(t, ctx, 1,
+			&Migration{ID: "1754917200_first", Up: stop, Down: noop},
+			&Migration{ID: "1754917300_second", Up: noop, Down: noop})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected the plan to be canceled, got %v", err)
+		}
+		if schema.Status != StatusClean || !schema.AppliedMigrations["1754917200_first"] || schema.AppliedMigrations["1754917300_second"] {
+			t.Errorf("Expected a clean state after the first migration, got %+v", schema)
+		}
+	})
+
+	t.Run("DuringMigration", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		backfill := func(mc *MigrationContext) error {
+			w := mc.NewBatchWriter(1)
+			defer w.Close()
+			cancel()
+			return w.Set([]byte("user/1"), []byte("x"))
+		}
+		schema, err := run(t, ctx, 1,
+			&Migration{ID: "1754917200_backfill", UpContext: backfill, Down: noop, Rerunnable: true},
+			&Migration{ID: "1754917300_second", Up: noop, Down: noop})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected the plan to be canceled, got %v", err)
+		}
+		if schema.Status != StatusMigrating || len(schema.RunningMigrations) != 1 || schema.RunningMigrations[0] != "1754917200_backfill" {
+			t.Errorf("Expected the migration to be left interrupted, got %+v", schema)
+		}
+		if schema.LastFailure != nil || len(schema.AppliedMigrations) != 0 {
+			t.Errorf("Expected no failure and nothing applied, got %+v", schema)
+		}
+	})
+
+	t.Run("Wave", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		canceled := func(mc *MigrationContext) error { cancel(); return mc.Err() }
+		schema, err := run(t, ctx, 2,
+			&Migration{ID: "1754917200_users", UpContext: canceled, Down: noop, KeyPrefixes: []string{"user/"}},
+			&Migration{ID: "1754917300_orders", Up: noop, Down: noop, KeyPrefixes: []string{"order/"}})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected the plan to be canceled, got %v", err)
+		}
+		if schema.Status != StatusMigrating || len(schema.RunningMigrations) != 1 || schema.RunningMigrations[0] != "1754917200_users" {
+			t.Errorf("Expected the canceled migration to be left interrupted, got %+v", schema)
+		}
+		if !schema.AppliedMigrations["1754917300_orders"] {
+			t.Errorf("Expected the completed migration of the wave to be recorded, got %+v", schema)
+		}
+	})
+
+	t.Run("WaveWithFailure", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		canceled := func(mc *MigrationContext) error { cancel(); return mc.Err() }
+		fail := func(db *pebble.DB) error { return errors.New("boom") }
+		schema, err := run(t, ctx, 2,
+			&Migration{ID: "1754917200_users", UpContext: canceled, Down: noop, KeyPrefixes: []string{"user/"}},
+			&Migration{ID: "1754917300_orders", Up: fail, Down: noop, KeyPrefixes: []string{"order/"}})
+		if err == nil {
+			t.Fatal("Expected the plan to fail")
+		}
+
+		// The failure decides the state, and the canceled migration is recorded
+		if schema.Status != StatusDirty || schema.LastFailure == nil || schema.LastFailure.MigrationID != "1754917300_orders" {
+			t.Errorf("Expected a dirty state with the failure, got %+v", schema)
+		}
+		recorded := false
+		for _, record := range schema.MigrationHistory {
+			if record.ID == "1754917200_users" && !record.Success && strings.HasSuffix(record.Error, context.Canceled.Error()) {
+				recorded = true
+			}
+		}
+		if !recorded {
+			t.Errorf("Expected the canceled migration in the history, got %+v", schema.MigrationHistory)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// schemaChunksInfix follows the key prefix in the keys the chunks of a large
+// schema state are stored under
+const schemaChunksInfix = "schema_chunks/"
+
+// DefaultSchemaChunkSize is the size above which the schema state is stored in
+// chunks by default
+const DefaultSchemaChunkSize = 512 << 10
+
+// chunkManifestHeader starts the value of the schema key when the state is stored
+// in chunks. Like protoSchemaHeader it starts with a zero byte, so releases that
+// do not know chunks fail to decode it instead of misreading it.
+const chunkManifestHeader = "\x00pc\x01"
+
+// chunkManifest is stored under the schema key in place of a state stored in chunks
+type chunkManifest struct {
+	Chunks int    `json:"chunks"`
+	Size   int    `json:"size"`   // Size of the encoded state
+	SHA256 string `json:"sha256"` // Checksum of the encoded state
+}
+
+// SetSchemaChunkSize sets the size above which the encoded schema state is split
+// across several keys, e.g. for an applied set of many thousands of migrations.
+// The schema key then holds a small manifest of the chunks; GetSchemaVersion and
+// SetSchemaVersion are unaffected. 0 disables chunking. Chunked state is always
+// read, whatever the size.
+func (s *SchemaManager) SetSchemaChunkSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	s.chunkSize = size
+}
+
+// schemaChunkKey returns the key chunk i of the schema state is stored under
+func (s *SchemaManager) schemaChunkKey(i int) []byte {
+	return []byte(fmt.Sprintf("%s%s%s/%06d", s.keyPrefix, schemaChunksInfix, s.schemaKey, i))
+}
+
+// readSchemaData returns the encoded schema state, joining its chunks if it is
+// stored in chunks, and the number of chunks. It returns pebble.ErrNotFound if
+// no state is stored, and an error wrapping ErrCorruptSchemaState if chunks are
+// missing or do not match the manifest.
+func (s *SchemaManager) readSchemaData() ([]byte, int, error) {
+	value, closer, err := s.db.Get([]byte(s.schemaKey))
+	if err != nil {
+		return nil, 0, err
+	}
+	data := append([]byte(nil), value...)
+	closer.Close()
+
+	manifest, ok, err := decodeChunkManifest(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		return data, 0, nil
+	}
+
+	joined := make([]byte, 0, manifest.Size)
+	for i := 0; i < manifest.Chunks; i++ {
+		chunk, closer, err := s.db.Get(s.schemaChunkKey(i))
+		if err == pebble.ErrNotFound {
+			return nil, 0, fmt.Errorf("%w: schema state chunk %d of %d is missing", ErrCorruptSchemaState, i+1, manifest.Chunks)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		joined = append(joined, chunk...)
+		closer.Close()
+	}
+	sum := sha256.Sum256(joined)
+	if len(joined) != manifest.Size || hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		return nil, 0, fmt.Errorf("%w: schema state chunks do not match their manifest", ErrCorruptSchemaState)
+	}
+	return joined, manifest.Chunks, nil
+}
+
+// writeSchemaData adds the encoded schema state to batch, split into chunks under
+// a manifest if it is larger than the chunk size, and deletes the chunks of the
+// stored state that are no longer used
+func (s *SchemaManager) writeSchemaData(batch *pebble.Batch, data []byte) error {
+	stale := 0
+	if value, closer, err := s.db.Get([]byte(s.schemaKey)); err == nil {
+		if manifest, ok, _ := decodeChunkManifest(value); ok {
+			stale = manifest.Chunks
+		}
+		closer.Close()
+	} else if err != pebble.ErrNotFound {
+		return err
+	}
+
+	value := data
+	chunks := 0
+	if s.chunkSize > 0 && len(data) > s.chunkSize {
+		for start := 0; start < len(data); start += s.chunkSize {
+			end := start + s.chunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			if err := batch.Set(s.schemaChunkKey(chunks), data[start:end], nil); err != nil {
+				return err
+			}
+			chunks++
+		}
+
+		sum := sha256.Sum256(data)
+		manifest, err := json.Marshal(chunkManifest{Chunks: chunks, Size: len(data), SHA256: hex.EncodeToString(sum[:])})
+		if err != nil {
+			return err
+		}
+		value = append([]byte(chunkManifestHeader), manifest...)
+	}
+
+	for i := chunks; i < stale; i++ {
+		if err := batch.Delete(s.schemaChunkKey(i), nil); err != nil {
+			return err
+		}
+	}
+	return batch.Set([]byte(s.schemaKey), value, nil)
+}
+
+// decodeChunkManifest decodes the value of the schema key if it is a chunk
+// manifest, and reports whether it is one
+func decodeChunkManifest(value []byte) (*chunkManifest, bool, error) {
+	if !strings.HasPrefix(string(value), chunkManifestHeader) {
+		return nil, false, nil
+	}
+	var manifest chunkManifest
+	if err := json.Unmarshal(value[len(chunkManifestHeader):], &manifest); err != nil {
+		return nil, true, fmt.Errorf("%w: failed to unmarshal schema chunk manifest: %v", ErrCorruptSchemaState, err)
+	}
+	return &manifest, true, nil
+}
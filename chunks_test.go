@@ -0,0 +1,102 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestSchemaChunks(t *testing.T) {
+	db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	schemaManager := NewSchemaManager(db)
+	schemaManager.SetSchemaChunkSize(1024)
+
+	chunkKeys := func() int {
+		prefix := []byte(MigrationPrefix + schemaChunksInfix)
+		iter, err := db.NewIter(&pebble.IterOptions{LowerBound: prefix, UpperBound: prefixUpperBound(prefix)})
+		if err != nil {
+			t.Fatalf("Failed to iterate: %v", err)
+		}
+		defer iter.Close()
+		n := 0
+		for iter.First(); iter.Valid(); iter.Next() {
+			n++
+		}
+		return n
+	}
+
+	// A large applied set is stored in chunks under a manifest
+	version, err := schemaManager.GetSchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		version.AppliedMigrations[fmt.Sprintf("%d_migration_with_a_long_name", 1754917200+i)] = true
+	}
+	version.CurrentVersion = 1754917399
+	if err := schemaManager.SetSchemaVersion(version); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	value, closer, err := db.Get([]byte(SchemaVersionKey))
+	if err != nil {
+		t.Fatalf("Failed to read schema key: %v", err)
+	}
+	if !strings.HasPrefix(string(value), chunkManifestHeader) || len(value) > 200 {
+		t.Errorf("Expected a small manifest under the schema key, got %d bytes", len(value))
+	}
+	closer.Close()
+	chunks := chunkKeys()
+	if chunks < 2 {
+		t.Fatalf("Expected several chunks, got %d", chunks)
+	}
+
+	read, err := schemaManager.GetSchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to read chunked schema: %v", err)
+	}
+	if len(read.AppliedMigrations) != 200 || read.CurrentVersion != 1754917399 || read.Revision != 1 {
+		t.Errorf("Unexpected chunked schema: %d applied, version %d, revision %d",
+			len(read.AppliedMigrations), read.CurrentVersion, read.Revision)
+	}
+	info, err := schemaManager.InspectSchemaState()
+	if err != nil || info.Chunks != chunks || info.Version == nil {
+		t.Errorf("Expected inspection to join %d chunks, got %+v, %v", chunks, info, err)
+	}
+
+	// Shrinking the state removes the chunks no longer used
+	read.AppliedMigrations = map[string]bool{"1754917200_migration_with_a_long_name": true}
+	if err := schemaManager.SetSchemaVersion(read); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	if n := chunkKeys(); n != 0 {
+		t.Errorf("Expected the chunks to be removed, %d remain", n)
+	}
+	if applied, err := schemaManager.IsMigrationApplied("1754917200_migration_with_a_long_name"); err != nil || !applied {
+		t.Errorf("Expected the small state to be read, got %v, %v", applied, err)
+	}
+
+	// A missing chunk is reported as corrupt state
+	for i := 0; i < 200; i++ {
+		read.AppliedMigrations[fmt.Sprintf("%d_migration_with_a_long_name", 1754917200+i)] = true
+	}
+	if err := schemaManager.SetSchemaVersion(read); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	if err := db.Delete(schemaManager.schemaChunkKey(1), pebble.Sync); err != nil {
+		t.Fatalf("Failed to delete chunk: %v", err)
+	}
+	if _, err := schemaManager.GetSchemaVersion(); !errors.Is(err, ErrCorruptSchemaState) {
+		t.Errorf("Expected a missing chunk to be corrupt state, got %v", err)
+	}
+	if info, err := schemaManager.InspectSchemaState(); err != nil || !errors.Is(info.DecodeError, ErrCorruptSchemaState) {
+		t.Errorf("Expected inspection to report the missing chunk, got %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"fmt"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewApplyOneCommand creates the apply-one command
+func NewApplyOneCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply-one <migration_id>",
+		Short: "Apply a single pending migration out of order",
+		Long: `Apply exactly one migration that has not been applied yet, leaving the
+other pending migrations pending.
+
+This is useful for a hotfix migration that must land before a backlog of
+heavy backfills. The migration is refused unless all of its dependencies are
+applied. It is backed up, executed and recorded like any other migration; the
+next 'up' applies the migrations still pending.
+
+Examples:
+  pebble-migrate apply-one 1754917200_fix_index
+  pebble-migrate apply-one 1754917200_fix_index --dry-run
+  pebble-migrate apply-one 1754917200_fix_index --no-backup`,
+		Args: cobra.ExactArgs(1),
+		RunE: runApplyOneCommand,
+	}
+
+	cmd.Flags().Bool("no-backup", false, "Skip creating backup before migration")
+	cmd.Flags().Bool("record-ops", false, "Save the operation log of a migration that uses Apply alongside the backups")
+	cmd.Flags().String("lock-file", migrate.DefaultLockFile, "Verify the registered migrations against this lock file if it exists (empty to skip)")
+
+	return cmd
+}
+
+func runApplyOneCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	// Open database (read-only for dry-run, read-write otherwise)
+	db, err := OpenDatabase(config, config.DryRun)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	schemaManager, planner, discovery, err := CreateMigrationServices(db, config)
+	if err != nil {
+		return err
+	}
+
+	if err := discovery.ValidateMigrations(); err != nil {
+		return fmt.Errorf("migration validation failed: %w", err)
+	}
+
+	if !config.DryRun {
+		if err := ValidateSchemaState(schemaManager); err != nil {
+			return fmt.Errorf("database is not in a valid state for migration: %w", err)
+		}
+	}
+
+	lock, err := loadLockFile(cmd)
+	if err != nil {
+		return err
+	}
+	planner.SetLockFile(lock)
+
+	plan, err := planner.PlanApplyOne(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to create migration plan: %w", err)
+	}
+
+	displayMigrationPlan(plan, config.DryRun)
+	if pending, err := planner.PlanUpgrade(); err == nil && len(pending.Migrations) > 1 {
+		PrintInfo("%d other pending migration(s) stay pending\n\n", len(pending.Migrations)-1)
+	}
+
+	engine, _ := CreateMigrationEngine(db, config)
+	engine.SetDryRun(config.DryRun)
+	engine.SetVerbose(config.Verbose)
+
+	noBackup, _ := cmd.Flags().GetBool("no-backup")
+	if noBackup {
+		engine.SetBackupEnabled(false)
+		if config.Verbose {
+			PrintInfo("Backup creation disabled by --no-backup flag\n")
+		}
+	}
+	recordOps, _ := cmd.Flags().GetBool("record-ops")
+	engine.SetRecordOps(recordOps)
+
+	// Refuse plans violating the policies before asking
+	if err := CheckPolicies(engine, plan); err != nil {
+		return err
+	}
+
+	if !config.DryRun {
+		if !ConfirmAction(fmt.Sprintf("Do you want to apply migration '%s' on its own?", plan.Migrations[0].ID)) {
+			PrintInfo("Migration cancelled.\n")
+			return nil
+		}
+	}
+
+	// Execute the plan (against a throwaway copy in dry-run mode)
+	if err := ExecutePlan(engine, plan, config); err != nil {
+		PrintError("Migration failed: %v\n", err)
+		return err
+	}
+
+	if config.DryRun {
+		PrintSuccess("Dry run completed successfully. No changes were made.\n")
+	} else {
+		PrintSuccess("Migration '%s' applied successfully!\n", plan.Migrations[0].ID)
+	}
+
+	return nil
+}
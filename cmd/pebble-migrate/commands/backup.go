@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/spf13/cobra"
 	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
 )
 
 // NewBackupCommand creates the backup command
@@ -23,6 +23,10 @@ database backups that are automatically created before migrations.`,
 	cmd.AddCommand(NewBackupListCommand())
 	cmd.AddCommand(NewBackupRestoreCommand())
 	cmd.AddCommand(NewBackupCleanupCommand())
+	cmd.AddCommand(NewBackupGCCommand())
+	cmd.AddCommand(NewBackupConvertCommand())
+	cmd.AddCommand(NewBackupPinCommand())
+	cmd.AddCommand(NewBackupUnpinCommand())
 
 	return cmd
 }
@@ -34,13 +38,27 @@ func NewBackupCreateCommand() *cobra.Command {
 		Short: "Create a database backup",
 		Long: `Create a manual backup of the database.
 
+With --hardlink, the backup is the raw checkpoint directory, whose SSTables are
+hardlinks to the database's. It is nearly instant and takes little extra space,
+but lives on the database's filesystem; convert it to an archive with
+'backup convert' to move it elsewhere.
+
+The expected size and duration are printed before backups estimated to take
+long. With --estimate, only the estimate is printed. It is based on the
+database size and the compression ratio and speed of earlier backups.
+
 Examples:
   pebble-migrate backup create "Before major update"
-  pebble-migrate backup create`,
+  pebble-migrate backup create
+  pebble-migrate backup create --hardlink "Before major update"
+  pebble-migrate backup create --estimate`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: runBackupCreateCommand,
 	}
 
+	cmd.Flags().Bool("hardlink", false, "Keep the hardlinked checkpoint directory as the backup instead of compressing it")
+	cmd.Flags().Bool("estimate", false, "Print the estimated backup size and duration without creating a backup")
+
 	return cmd
 }
 
@@ -51,10 +69,19 @@ func NewBackupListCommand() *cobra.Command {
 		Short: "List available backups",
 		Long: `List all available backups for the database.
 
-Shows backup creation time, size, version, and description.`,
+Shows backup creation time, size, version, and description. With --all, also
+lists leftover artifacts that are not usable backups: backups without metadata,
+temporary checkpoints of interrupted backups, and the .restore_temp_ and
+.previous directories of interrupted restores. Remove them with 'backup gc'.
+Leftovers of interrupted restores are always reported.
+
+Temporary checkpoints and restore copies older than 7 days are removed
+automatically.`,
 		RunE: runBackupListCommand,
 	}
 
+	cmd.Flags().Bool("all", false, "Also list unrecognized backup artifacts")
+
 	return cmd
 }
 
@@ -86,6 +113,9 @@ func NewBackupCleanupCommand() *cobra.Command {
 		Short: "Clean up old backups",
 		Long: `Remove old backups based on age.
 
+Pinned backups, the newest backup and the backup taken before the last
+successful migration plan are never removed.
+
 Examples:
   pebble-migrate backup cleanup --older-than 30d
   pebble-migrate backup cleanup --older-than 7d`,
@@ -97,6 +127,133 @@ Examples:
 	return cmd
 }
 
+// NewBackupGCCommand creates the backup gc subcommand
+func NewBackupGCCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove leftover backup artifacts",
+		Long: `Remove the artifacts listed by 'backup list --all': backups without metadata,
+orphaned metadata files, temporary checkpoints and the leftovers of interrupted
+restores.
+
+A .previous directory is the database replaced by an interrupted restore and may
+be the only copy of the database before the restore. Check it before removing it.
+
+Examples:
+  pebble-migrate backup gc -d /path/to/db --dry-run
+  pebble-migrate backup gc -d /path/to/db --force`,
+		RunE: runBackupGCCommand,
+	}
+
+	cmd.Flags().Bool("force", false, "Skip confirmation prompt")
+
+	return cmd
+}
+
+// NewBackupPinCommand creates the backup pin subcommand
+func NewBackupPinCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pin <backup_path> [reason]",
+		Short: "Keep a backup regardless of cleanup policies",
+		Long: `Pin a backup so that neither 'backup cleanup' nor the automatic cleanup after
+creating a backup removes it, whatever its age or the number of backups. The
+reason is stored in the backup metadata and shown by 'backup list'.
+
+The newest backup and the backup taken before the last successful migration
+plan are always kept without a pin.
+
+Examples:
+  pebble-migrate backup pin /path/to/db.backup_20240101_120000 "Before v2 launch" -d /path/to/db`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: runBackupPinCommand,
+	}
+
+	return cmd
+}
+
+// NewBackupUnpinCommand creates the backup unpin subcommand
+func NewBackupUnpinCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unpin <backup_path>",
+		Short: "Let cleanup remove a pinned backup again",
+		Long: `Remove the pin of a backup, so cleanup policies apply to it again.
+
+Examples:
+  pebble-migrate backup unpin /path/to/db.backup_20240101_120000 -d /path/to/db`,
+		Args: cobra.ExactArgs(1),
+		RunE: runBackupUnpinCommand,
+	}
+
+	return cmd
+}
+
+func runBackupPinCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	reason := ""
+	if len(args) > 1 {
+		reason = args[1]
+	}
+	if err := NewBackupManager(config).PinBackup(args[0], reason); err != nil {
+		return fmt.Errorf("failed to pin backup: %w", err)
+	}
+
+	PrintSuccess("✓ Pinned %s\n", args[0])
+	return nil
+}
+
+func runBackupUnpinCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := NewBackupManager(config).UnpinBackup(args[0]); err != nil {
+		return fmt.Errorf("failed to unpin backup: %w", err)
+	}
+
+	PrintSuccess("✓ Unpinned %s\n", args[0])
+	return nil
+}
+
+// NewBackupConvertCommand creates the backup convert subcommand
+func NewBackupConvertCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "convert <backup_path>",
+		Short: "Convert a directory backup into a compressed archive",
+		Long: `Compress a directory backup, such as one created with --hardlink, into a
+.tar.gz archive and remove the directory. The archive does not share files with
+the database, so it can be copied off the machine. Backups in use, e.g. by a
+running restore, are not converted.
+
+Examples:
+  pebble-migrate backup convert /path/to/db.backup_20240101_120000 -d /path/to/db`,
+		Args: cobra.ExactArgs(1),
+		RunE: runBackupConvertCommand,
+	}
+
+	return cmd
+}
+
+func runBackupConvertCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	backupManager := NewBackupManager(config)
+	backupInfo, err := backupManager.ConvertToArchive(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to convert backup: %w", err)
+	}
+
+	PrintSuccess("✓ Backup converted to %s (%.2f MB)\n", backupInfo.Path, float64(backupInfo.Size)/1024/1024)
+	return nil
+}
+
 func runBackupCreateCommand(cmd *cobra.Command, args []string) error {
 	config, err := GetGlobalConfig(cmd)
 	if err != nil {
@@ -108,15 +265,30 @@ func runBackupCreateCommand(cmd *cobra.Command, args []string) error {
 		description = args[0]
 	}
 
-	backupManager := migrate.NewBackupManager(config.DatabasePath)
+	backupManager := NewBackupManager(config)
+	hardlink, _ := cmd.Flags().GetBool("hardlink")
+	backupManager.SetHardlink(hardlink)
 
 	// Open database for backup
-	db, err := OpenDatabase(config.DatabasePath, true)
+	db, err := OpenDatabase(config, true)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
+	if estimateOnly, _ := cmd.Flags().GetBool("estimate"); estimateOnly {
+		estimate := backupManager.EstimateBackupSize(db)
+		source := "defaults, no earlier backup records them"
+		if estimate.FromHistory {
+			source = "earlier backups"
+		}
+		fmt.Printf("Database size: %.2f MB\n", float64(estimate.SourceSize)/1024/1024)
+		fmt.Printf("Estimated backup size: %.2f MB (ratio %.2f)\n", float64(estimate.Size)/1024/1024, estimate.CompressionRatio)
+		fmt.Printf("Estimated time: %s\n", estimate.Duration.Round(time.Millisecond))
+		fmt.Printf("Ratio and speed from: %s\n", source)
+		return nil
+	}
+
 	PrintInfo("Creating backup of database: %s\n", config.DatabasePath)
 	backupInfo, err := backupManager.CreateBackup(db, description)
 	if err != nil {
@@ -128,6 +300,9 @@ func runBackupCreateCommand(cmd *cobra.Command, args []string) error {
 	fmt.Printf("  Size: %.2f MB\n", float64(backupInfo.Size)/1024/1024)
 	fmt.Printf("  Version: %d\n", backupInfo.Version)
 	fmt.Printf("  Description: %s\n", backupInfo.Description)
+	if backupInfo.Hardlinked {
+		PrintInfo("The backup shares its SSTables with the database; run 'backup convert' to archive it\n")
+	}
 
 	return nil
 }
@@ -138,7 +313,7 @@ func runBackupListCommand(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	backupManager := migrate.NewBackupManager(config.DatabasePath)
+	backupManager := NewBackupManager(config)
 
 	backups, err := backupManager.ListBackups()
 	if err != nil {
@@ -147,21 +322,114 @@ func runBackupListCommand(cmd *cobra.Command, args []string) error {
 
 	if len(backups) == 0 {
 		PrintInfo("No backups found for database: %s\n", config.DatabasePath)
+	} else {
+		fmt.Printf("=== Available Backups ===\n\n")
+		fmt.Printf("Found %d backup(s) for database: %s\n\n", len(backups), config.DatabasePath)
+
+		protected := backupManager.ProtectedBackups(backups)
+
+		for i, backup := range backups {
+			fmt.Printf("%d. %s\n", i+1, backup.Path)
+			fmt.Printf("   Created: %s\n", backup.CreatedAt.Format("2006-01-02 15:04:05"))
+			if backup.Hardlinked {
+				fmt.Printf("   Size: %.2f MB (hardlinked)\n", float64(backup.Size)/1024/1024)
+			} else {
+				fmt.Printf("   Size: %.2f MB\n", float64(backup.Size)/1024/1024)
+			}
+			fmt.Printf("   Version: %d\n", backup.Version)
+			fmt.Printf("   Description: %s\n", backup.Description)
+			if reason, ok := protected[backup.Path]; ok {
+				fmt.Printf("   Kept by cleanup: %s\n", reason)
+			}
+			if refs, err := backupManager.BackupReferences(backup.Path); err == nil {
+				for _, ref := range refs {
+					fmt.Printf("   In use by process %d: %s\n", ref.PID, ref.Reason)
+				}
+			}
+			fmt.Printf("\n")
+		}
+	}
+
+	artifacts, err := backupManager.ListArtifacts()
+	if err != nil {
+		return fmt.Errorf("failed to list backup artifacts: %w", err)
+	}
+
+	if all, _ := cmd.Flags().GetBool("all"); !all {
+		// Leftovers of interrupted restores are reported even without --all
+		for _, artifact := range artifacts {
+			if artifact.Kind == migrate.ArtifactPrevious || artifact.Kind == migrate.ArtifactRestoreTemp {
+				PrintWarning("%s was left by an interrupted restore, run 'backup list --all' for details\n", artifact.Path)
+			}
+		}
+		return nil
+	}
+
+	if len(artifacts) == 0 {
+		PrintInfo("No unrecognized backup artifacts found\n")
 		return nil
 	}
 
-	fmt.Printf("=== Available Backups ===\n\n")
-	fmt.Printf("Found %d backup(s) for database: %s\n\n", len(backups), config.DatabasePath)
+	fmt.Printf("=== Unrecognized Artifacts ===\n\n")
+	printBackupArtifacts(artifacts)
+	PrintInfo("Run 'backup gc' to remove them\n")
+
+	return nil
+}
 
-	for i, backup := range backups {
-		fmt.Printf("%d. %s\n", i+1, backup.Path)
-		fmt.Printf("   Created: %s\n", backup.CreatedAt.Format("2006-01-02 15:04:05"))
-		fmt.Printf("   Size: %.2f MB\n", float64(backup.Size)/1024/1024)
-		fmt.Printf("   Version: %d\n", backup.Version)
-		fmt.Printf("   Description: %s\n", backup.Description)
+// printBackupArtifacts prints leftover backup artifacts
+func printBackupArtifacts(artifacts []*migrate.BackupArtifact) {
+	for i, artifact := range artifacts {
+		fmt.Printf("%d. %s\n", i+1, artifact.Path)
+		fmt.Printf("   Kind: %s\n", artifact.Kind)
+		if artifact.Note != "" {
+			fmt.Printf("   Note: %s\n", artifact.Note)
+		}
+		fmt.Printf("   Modified: %s\n", artifact.ModTime.Format("2006-01-02 15:04:05"))
+		fmt.Printf("   Size: %.2f MB\n", float64(artifact.Size)/1024/1024)
 		fmt.Printf("\n")
 	}
+}
+
+func runBackupGCCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	force, _ := cmd.Flags().GetBool("force")
+
+	backupManager := NewBackupManager(config)
+	artifacts, err := backupManager.ListArtifacts()
+	if err != nil {
+		return fmt.Errorf("failed to list backup artifacts: %w", err)
+	}
+	if len(artifacts) == 0 {
+		PrintInfo("No backup artifacts to remove\n")
+		return nil
+	}
+
+	printBackupArtifacts(artifacts)
+	if config.DryRun {
+		PrintInfo("DRY RUN: Would remove %d artifact(s)\n", len(artifacts))
+		return nil
+	}
 
+	for _, artifact := range artifacts {
+		if artifact.Kind == migrate.ArtifactPrevious {
+			PrintWarning("%s is the database replaced by an interrupted restore\n", artifact.Path)
+		}
+	}
+	if !force && !ConfirmAction(fmt.Sprintf("Remove %d artifact(s)?", len(artifacts))) {
+		PrintInfo("Operation cancelled.\n")
+		return nil
+	}
+
+	removed, err := backupManager.RemoveArtifacts(artifacts)
+	if err != nil {
+		return err
+	}
+	PrintSuccess("Removed %d artifact(s)\n", removed)
 	return nil
 }
 
@@ -174,7 +442,7 @@ func runBackupRestoreCommand(cmd *cobra.Command, args []string) error {
 	backupPath := args[0]
 	force, _ := cmd.Flags().GetBool("force")
 
-	backupManager := migrate.NewBackupManager(config.DatabasePath)
+	backupManager := NewBackupManager(config)
 
 	// Confirm restore operation unless forced
 	if !force {
@@ -188,13 +456,38 @@ func runBackupRestoreCommand(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if config.Chaos != "" {
+		injector, _ := migrate.ParseFaultSpec(config.Chaos)
+		backupManager.SetFaultInjector(injector)
+		PrintWarning("Chaos mode: injecting fault %s\n", config.Chaos)
+	}
+
+	// Load the migrations to report which need to be reapplied
+	discovery := migrate.NewDiscoveryService(config.ScriptsDir, migrate.GlobalRegistry)
+	discovery.SetPluginDir(config.PluginsDir)
+	if err := discovery.LoadMigrations(); err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+	backupManager.SetRegistry(migrate.GlobalRegistry)
+
 	PrintInfo("Restoring database from backup...\n")
-	err = backupManager.RestoreBackup(backupPath)
+	report, err := backupManager.RestoreBackupWithReport(backupPath)
 	if err != nil {
 		return fmt.Errorf("failed to restore backup: %w", err)
 	}
 
 	PrintSuccess("✓ Database restored successfully from backup!\n")
+
+	if report.ValidationError != nil {
+		PrintWarning("Run 'validate' and 'repair' to check the restored schema state\n")
+	}
+	if len(report.Pending) > 0 {
+		fmt.Printf("\nMigrations to reapply:\n")
+		for _, m := range report.Pending {
+			fmt.Printf("  %s: %s\n", m.ID, m.Description)
+		}
+		PrintInfo("Run 'up' to reapply them\n")
+	}
 	return nil
 }
 
@@ -221,7 +514,7 @@ func runBackupCleanupCommand(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	backupManager := migrate.NewBackupManager(config.DatabasePath)
+	backupManager := NewBackupManager(config)
 
 	PrintInfo("Cleaning up backups older than %v...\n", olderThan)
 	err = backupManager.CleanupOldBackups(olderThan)
@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewBenchCommand creates the bench command
+func NewBenchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Run a standardized workload against a scratch database",
+		Long: `Run a standardized migration workload against a scratch database and
+report throughput numbers, useful for sizing hardware before running large
+migrations in production.
+
+The workload:
+1. Populates the scratch database with synthetic key/value pairs
+2. Runs a batched data migration that rewrites every value through the engine
+3. Measures schema state read/write latency
+4. Creates a compressed backup
+
+The --database path must not exist or must be an empty directory. It is
+removed after the run unless --keep is given.
+
+Examples:
+  pebble-migrate bench -d /tmp/bench.db
+  pebble-migrate bench -d /mnt/data/bench.db --size-mb 4096 --keep`,
+		RunE: runBenchCommand,
+	}
+
+	cmd.Flags().Int("size-mb", 256, "Size of the synthetic dataset in MB")
+	cmd.Flags().Int("value-size", 1024, "Size of each value in bytes")
+	cmd.Flags().Int("batch-size", 1000, "Number of keys per batch in the migration workload")
+	cmd.Flags().Bool("skip-backup", false, "Skip the backup phase")
+	cmd.Flags().Bool("keep", false, "Keep the scratch database and backup after the run")
+
+	return cmd
+}
+
+func runBenchCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	sizeMB, _ := cmd.Flags().GetInt("size-mb")
+	valueSize, _ := cmd.Flags().GetInt("value-size")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	skipBackup, _ := cmd.Flags().GetBool("skip-backup")
+	keep, _ := cmd.Flags().GetBool("keep")
+
+	if sizeMB <= 0 || valueSize <= 0 || batchSize <= 0 {
+		return fmt.Errorf("--size-mb, --value-size and --batch-size must be positive")
+	}
+
+	// Refuse to run against anything that looks like a real database
+	if entries, err := os.ReadDir(config.DatabasePath); err == nil && len(entries) > 0 {
+		return fmt.Errorf("scratch database path %s is not empty", config.DatabasePath)
+	}
+
+	if config.DryRun {
+		PrintInfo("DRY RUN: Would run a %d MB benchmark workload in %s\n", sizeMB, config.DatabasePath)
+		return nil
+	}
+
+	db, err := OpenDatabase(config, false)
+	if err != nil {
+		return fmt.Errorf("failed to open scratch database: %w", err)
+	}
+	var backupPath string
+	defer func() {
+		db.Close()
+		if !keep {
+			os.RemoveAll(config.DatabasePath)
+			if backupPath != "" {
+				os.RemoveAll(backupPath)
+				os.Remove(backupPath + ".metadata")
+			}
+		}
+	}()
+
+	totalBytes := int64(sizeMB) * 1024 * 1024
+	keys := int(totalBytes / int64(valueSize))
+
+	fmt.Printf("=== Benchmark Workload ===\n")
+	fmt.Printf("Scratch database: %s\n", config.DatabasePath)
+	fmt.Printf("Dataset: %d keys x %d bytes (%d MB)\n\n", keys, valueSize, sizeMB)
+
+	// Phase 1: populate
+	start := time.Now()
+	if err := benchPopulate(db, keys, valueSize); err != nil {
+		return fmt.Errorf("populate phase failed: %w", err)
+	}
+	printBenchResult("Populate", time.Since(start), totalBytes, keys)
+
+	// Phase 2: batched migration through the engine
+	registry := migrate.NewMigrationRegistry()
+	err = registry.Register(&migrate.Migration{
+		ID:          "1700000000_bench_rewrite",
+		Description: "Benchmark rewrite of all values",
+		Up: func(db *pebble.DB) error {
+			return benchRewrite(db, batchSize)
+		},
+		Down: func(db *pebble.DB) error { return nil },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register benchmark migration: %w", err)
+	}
+
+	schemaManager := migrate.NewSchemaManager(db)
+	engine := migrate.NewMigrationEngineWithBackup(db, schemaManager, registry, config.DatabasePath)
+	engine.SetBackupEnabled(false)
+	plan, err := migrate.NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		return fmt.Errorf("failed to plan benchmark migration: %w", err)
+	}
+
+	start = time.Now()
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		return fmt.Errorf("migration phase failed: %w", err)
+	}
+	printBenchResult("Migration", time.Since(start), totalBytes, keys)
+
+	// Phase 3: schema state latency
+	const schemaIterations = 1000
+	start = time.Now()
+	for i := 0; i < schemaIterations; i++ {
+		schema, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			return fmt.Errorf("schema phase failed: %w", err)
+		}
+		if err := schemaManager.SetSchemaVersion(schema); err != nil {
+			return fmt.Errorf("schema phase failed: %w", err)
+		}
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("%-10s %d read+write cycles in %v (%v per cycle)\n",
+		"Schema", schemaIterations, elapsed.Round(time.Millisecond), elapsed/schemaIterations)
+
+	// Phase 4: compressed backup
+	if !skipBackup {
+		backupManager := migrate.NewBackupManager(config.DatabasePath)
+		start = time.Now()
+		info, err := backupManager.CreateBackup(db, "Benchmark backup")
+		if err != nil {
+			return fmt.Errorf("backup phase failed: %w", err)
+		}
+		backupPath = info.Path
+		printBenchResult("Backup", time.Since(start), totalBytes, keys)
+		fmt.Printf("%-10s compressed to %.2f MB (%.1f%% of dataset)\n", "",
+			float64(info.Size)/1024/1024, float64(info.Size)*100/float64(totalBytes))
+	}
+
+	fmt.Printf("\n")
+	PrintSuccess("Benchmark completed\n")
+	if keep {
+		PrintInfo("Scratch database kept at %s\n", config.DatabasePath)
+	}
+
+	return nil
+}
+
+// benchPopulate writes keys pseudo-random values of valueSize bytes
+func benchPopulate(db *pebble.DB, keys, valueSize int) error {
+	rng := rand.New(rand.NewSource(1))
+	value := make([]byte, valueSize)
+
+	batch := db.NewBatch()
+	for i := 0; i < keys; i++ {
+		// Half random, half zero bytes so compression numbers are realistic
+		rng.Read(value[:valueSize/2])
+		if err := batch.Set([]byte(fmt.Sprintf("bench:%012d", i)), value, nil); err != nil {
+			return err
+		}
+		if batch.Len() >= 4*1024*1024 {
+			if err := batch.Commit(pebble.NoSync); err != nil {
+				return err
+			}
+			batch = db.NewBatch()
+		}
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return err
+	}
+	return db.Flush()
+}
+
+// benchRewrite rewrites every benchmark value in batches of batchSize keys
+func benchRewrite(db *pebble.DB, batchSize int) error {
+	iter, err := db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte("bench:"),
+		UpperBound: []byte("bench;"),
+	})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	batch := db.NewBatch()
+	count := 0
+	for iter.First(); iter.Valid(); iter.Next() {
+		if err := batch.Set(iter.Key(), iter.Value(), nil); err != nil {
+			return err
+		}
+		count++
+		if count >= batchSize {
+			if err := batch.Commit(pebble.NoSync); err != nil {
+				return err
+			}
+			batch = db.NewBatch()
+			count = 0
+		}
+	}
+
+	return batch.Commit(pebble.Sync)
+}
+
+func printBenchResult(phase string, elapsed time.Duration, bytes int64, keys int) {
+	seconds := elapsed.Seconds()
+	if seconds == 0 {
+		seconds = 1e-9
+	}
+	fmt.Printf("%-10s %v  %.1f MB/s  %.0f keys/s\n",
+		phase, elapsed.Round(time.Millisecond), float64(bytes)/1024/1024/seconds, float64(keys)/seconds)
+}
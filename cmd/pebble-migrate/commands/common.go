@@ -1,9 +1,16 @@
 package commands
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/cockroachdb/pebble"
 	"github.com/spf13/cobra"
@@ -17,6 +24,29 @@ type GlobalConfig struct {
 	DatabasePath string
 	Verbose      bool
 	DryRun       bool
+	SchemaKey    string
+	KeyPrefix    string
+	Encoding     migrate.SchemaEncoding
+	ScriptsDir   string
+	PluginsDir   string
+	Chaos        string
+	PlanOnly     bool
+	EventLog     string
+	LockWait     time.Duration
+	Environment  string
+	Standby      string
+
+	// Plan policies, see migrate.PolicyFunc
+	MaxMigrations     int
+	ForbidDowngradeIn []string
+	RequireBackupFor  []string
+	MaxFutureSkew     time.Duration
+
+	// What to do when the registered plan validators fail, see migrate.PlanValidatorFunc
+	OnValidationFailure migrate.PlanValidationAction
+
+	BackupMaxReadMBps float64
+	BackupWorkers     int
 }
 
 // GetGlobalConfig extracts global configuration from cobra command
@@ -25,6 +55,9 @@ func GetGlobalConfig(cmd *cobra.Command) (*GlobalConfig, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database flag: %w", err)
 	}
+	if dbPath == "" {
+		return nil, fmt.Errorf("required flag \"database\" not set")
+	}
 
 	verbose, err := cmd.Flags().GetBool("verbose")
 	if err != nil {
@@ -36,6 +69,122 @@ func GetGlobalConfig(cmd *cobra.Command) (*GlobalConfig, error) {
 		return nil, fmt.Errorf("failed to get dry-run flag: %w", err)
 	}
 
+	schemaKey, err := cmd.Flags().GetString("schema-key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema-key flag: %w", err)
+	}
+
+	keyPrefix, err := cmd.Flags().GetString("key-prefix")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key-prefix flag: %w", err)
+	}
+
+	encodingName, err := cmd.Flags().GetString("schema-encoding")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema-encoding flag: %w", err)
+	}
+	encoding, err := migrate.ParseSchemaEncoding(encodingName)
+	if err != nil {
+		return nil, err
+	}
+
+	scriptsDir, err := cmd.Flags().GetString("scripts-dir")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scripts-dir flag: %w", err)
+	}
+
+	pluginsDir, err := cmd.Flags().GetString("plugins-dir")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plugins-dir flag: %w", err)
+	}
+
+	chaos, err := cmd.Flags().GetString("chaos")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chaos flag: %w", err)
+	}
+	if chaos != "" {
+		if _, err := migrate.ParseFaultSpec(chaos); err != nil {
+			return nil, err
+		}
+	}
+
+	planOnly, err := cmd.Flags().GetBool("plan-only")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan-only flag: %w", err)
+	}
+
+	eventLog, err := cmd.Flags().GetString("event-log")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event-log flag: %w", err)
+	}
+
+	lockWait, err := cmd.Flags().GetDuration("wait")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wait flag: %w", err)
+	}
+
+	environment, err := cmd.Flags().GetString("environment")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get environment flag: %w", err)
+	}
+
+	standby, err := cmd.Flags().GetString("standby")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get standby flag: %w", err)
+	}
+	if standby != "" {
+		if standby, err = filepath.Abs(standby); err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for standby: %w", err)
+		}
+	}
+
+	maxMigrations, err := cmd.Flags().GetInt("max-migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get max-migrations flag: %w", err)
+	}
+
+	forbidDowngradeIn, err := cmd.Flags().GetStringSlice("forbid-downgrade-in")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forbid-downgrade-in flag: %w", err)
+	}
+
+	requireBackupFor, err := cmd.Flags().GetStringSlice("require-backup-for")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get require-backup-for flag: %w", err)
+	}
+
+	maxFutureSkew, err := cmd.Flags().GetDuration("max-future-skew")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get max-future-skew flag: %w", err)
+	}
+
+	onValidationFailure, err := cmd.Flags().GetString("on-validation-failure")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get on-validation-failure flag: %w", err)
+	}
+	validationAction, err := migrate.ParsePlanValidationAction(onValidationFailure)
+	if err != nil {
+		return nil, err
+	}
+
+	backupMaxReadMBps, err := cmd.Flags().GetFloat64("backup-max-read-mbps")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup-max-read-mbps flag: %w", err)
+	}
+
+	backupWorkers, err := cmd.Flags().GetInt("backup-workers")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup-workers flag: %w", err)
+	}
+
+	valueDecoders, err := cmd.Flags().GetStringSlice("value-decoder")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get value-decoder flag: %w", err)
+	}
+	if err := registerValueDecoders(valueDecoders); err != nil {
+		return nil, err
+	}
+
 	// Validate database path
 	if dbPath == "" {
 		return nil, fmt.Errorf("database path is required")
@@ -51,11 +200,59 @@ func GetGlobalConfig(cmd *cobra.Command) (*GlobalConfig, error) {
 		DatabasePath: dbPath,
 		Verbose:      verbose,
 		DryRun:       dryRun,
+		SchemaKey:    schemaKey,
+		KeyPrefix:    keyPrefix,
+		Encoding:     encoding,
+		ScriptsDir:   scriptsDir,
+		PluginsDir:   pluginsDir,
+		Chaos:        chaos,
+		PlanOnly:     planOnly,
+		EventLog:     eventLog,
+		LockWait:     lockWait,
+		Environment:  environment,
+		Standby:      standby,
+
+		MaxMigrations:     maxMigrations,
+		ForbidDowngradeIn: forbidDowngradeIn,
+		RequireBackupFor:  requireBackupFor,
+		MaxFutureSkew:     maxFutureSkew,
+
+		OnValidationFailure: validationAction,
+
+		BackupMaxReadMBps: backupMaxReadMBps,
+		BackupWorkers:     backupWorkers,
 	}, nil
 }
 
-// OpenDatabase opens a Pebble database connection
-func OpenDatabase(dbPath string, readOnly bool) (*pebble.DB, error) {
+// registerValueDecoders registers the value decoders of the value-decoder flag,
+// given as prefix=codec
+func registerValueDecoders(specs []string) error {
+	registered := make(map[string]bool)
+	for _, decoder := range migrate.ValueDecoders() {
+		registered[decoder] = true
+	}
+	for _, spec := range specs {
+		prefix, codec, ok := strings.Cut(spec, "=")
+		if !ok || codec == "" {
+			return fmt.Errorf("invalid value decoder %q, expected prefix=codec", spec)
+		}
+		if registered[spec] {
+			continue
+		}
+		if err := migrate.RegisterValueDecoder(prefix, codec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenDatabase opens a Pebble database connection. If another process holds the
+// database, e.g. the running application, the error names it, and with --wait
+// opening is retried with backoff until the lock is released. With
+// --environment, a database of another environment is only opened read-only.
+func OpenDatabase(config *GlobalConfig, readOnly bool) (*pebble.DB, error) {
+	dbPath := config.DatabasePath
+
 	// Check if database directory exists
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
 		if readOnly {
@@ -72,32 +269,207 @@ func OpenDatabase(dbPath string, readOnly bool) (*pebble.DB, error) {
 		ReadOnly: readOnly,
 	}
 
-	db, err := pebble.Open(dbPath, opts)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database at %s: %w", dbPath, err)
+	deadline := time.Now().Add(config.LockWait)
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		db, err := pebble.Open(dbPath, opts)
+		if err == nil {
+			if err := checkEnvironment(db, config, readOnly); err != nil {
+				db.Close()
+				return nil, err
+			}
+			return db, nil
+		}
+
+		err = migrate.ExplainOpenError(dbPath, err)
+		if !errors.Is(err, migrate.ErrDatabaseLocked) {
+			return nil, fmt.Errorf("failed to open database at %s: %w", dbPath, err)
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			if config.LockWait > 0 {
+				return nil, fmt.Errorf("%w (waited %s)", err, config.LockWait)
+			}
+			return nil, fmt.Errorf("%w; stop it or retry with --wait", err)
+		}
+
+		if attempt == 1 {
+			PrintWarning("%v, waiting up to %s...\n", err, config.LockWait)
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > 5*time.Second {
+			backoff = 5 * time.Second
+		}
 	}
+}
 
-	return db, nil
+// checkEnvironment compares --environment with the environment the database is
+// stamped with. Commands that write refuse to run on a database of another
+// environment and stamp an unstamped one; read-only commands only warn.
+func checkEnvironment(db *pebble.DB, config *GlobalConfig, readOnly bool) error {
+	if config.Environment == "" {
+		return nil
+	}
+
+	schemaManager := NewSchemaManager(db, config)
+	var err error
+	if readOnly {
+		err = schemaManager.CheckEnvironment(config.Environment)
+	} else {
+		err = schemaManager.StampEnvironment(config.Environment)
+	}
+	if errors.Is(err, migrate.ErrEnvironmentMismatch) && !readOnly {
+		return fmt.Errorf("%w; refusing to change it", err)
+	}
+	if err != nil {
+		PrintWarning("%v\n", err)
+	}
+	return nil
 }
 
-// CreateMigrationServices creates the core migration services
-func CreateMigrationServices(db *pebble.DB) (*migrate.SchemaManager, *migrate.MigrationPlanner, *migrate.DiscoveryService) {
+// NewSchemaManager creates a schema manager using the configured schema key and key prefix
+func NewSchemaManager(db *pebble.DB, config *GlobalConfig) *migrate.SchemaManager {
 	schemaManager := migrate.NewSchemaManager(db)
+	schemaManager.SetSchemaKey(config.SchemaKey)
+	schemaManager.SetKeyPrefix(config.KeyPrefix)
+	schemaManager.SetEncoding(config.Encoding)
+	return schemaManager
+}
+
+// NewBackupManager creates a backup manager that reads the configured schema key
+// and key prefix
+func NewBackupManager(config *GlobalConfig) *migrate.BackupManager {
+	backupManager := migrate.NewBackupManager(config.DatabasePath)
+	backupManager.SetSchemaKey(config.SchemaKey)
+	backupManager.SetKeyPrefix(config.KeyPrefix)
+	backupManager.SetMaxReadRate(config.BackupMaxReadMBps)
+	backupManager.SetCompressionWorkers(config.BackupWorkers)
+	return backupManager
+}
+
+// CreateMigrationServices creates the core migration services and loads the
+// script and plugin migrations from the configured directories
+func CreateMigrationServices(db *pebble.DB, config *GlobalConfig) (*migrate.SchemaManager, *migrate.MigrationPlanner, *migrate.DiscoveryService, error) {
+	schemaManager := NewSchemaManager(db, config)
 	registry := migrate.GlobalRegistry
 	planner := migrate.NewMigrationPlanner(registry, schemaManager)
-	discovery := migrate.NewDiscoveryService("migrations", registry)
+	discovery := migrate.NewDiscoveryService(config.ScriptsDir, registry)
+	discovery.SetPluginDir(config.PluginsDir)
+
+	if err := discovery.LoadMigrations(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
 
-	return schemaManager, planner, discovery
+	return schemaManager, planner, discovery, nil
 }
 
 // CreateMigrationEngine creates a migration engine with backup support
-func CreateMigrationEngine(db *pebble.DB, dbPath string) (*migrate.MigrationEngine, *migrate.SchemaManager) {
-	schemaManager := migrate.NewSchemaManager(db)
-	engine := migrate.NewMigrationEngineWithBackup(db, schemaManager, migrate.GlobalRegistry, dbPath)
+func CreateMigrationEngine(db *pebble.DB, config *GlobalConfig) (*migrate.MigrationEngine, *migrate.SchemaManager) {
+	schemaManager := NewSchemaManager(db, config)
+	engine := migrate.NewMigrationEngineWithBackup(db, schemaManager, migrate.GlobalRegistry, config.DatabasePath)
+	engine.SetBackupManager(NewBackupManager(config))
+	engine.SetLogger(migrate.NewDefaultLogger(config.Verbose))
+
+	// Fault injection for exercising recovery (validated in GetGlobalConfig)
+	if config.Chaos != "" {
+		injector, _ := migrate.ParseFaultSpec(config.Chaos)
+		engine.SetFaultInjector(injector)
+		PrintWarning("Chaos mode: injecting fault %s\n", config.Chaos)
+	}
+
+	engine.SetDryRunExecute(!config.PlanOnly)
+	engine.SetEventLog(config.EventLog)
+	engine.SetStandby(config.Standby)
+
+	if config.MaxMigrations > 0 {
+		engine.AddPolicy(migrate.MaxMigrationsPolicy(config.MaxMigrations))
+	}
+	if len(config.ForbidDowngradeIn) > 0 {
+		engine.AddPolicy(migrate.ForbidDowngradePolicy(config.ForbidDowngradeIn...))
+	}
+	if len(config.RequireBackupFor) > 0 {
+		engine.AddPolicy(migrate.RequireBackupPolicy(config.RequireBackupFor...))
+	}
+	if config.MaxFutureSkew > 0 {
+		engine.AddPolicy(migrate.FutureMigrationsPolicy(config.MaxFutureSkew))
+	}
+	engine.SetPlanValidationAction(config.OnValidationFailure)
 
 	return engine, schemaManager
 }
 
+// CheckPolicies prints the violations of the plan policies set with the global
+// flags and returns the error refusing the plan, if any
+func CheckPolicies(engine *migrate.MigrationEngine, plan *migrate.ExecutionPlan) error {
+	err := engine.CheckPolicies(plan)
+	var policyErr *migrate.PolicyError
+	if errors.As(err, &policyErr) {
+		PrintError("The plan violates %d policy rule(s):\n", len(policyErr.Violations))
+		for _, violation := range policyErr.Violations {
+			fmt.Printf("  - %s\n", violation)
+		}
+		return migrate.ErrPolicyViolation
+	}
+	return err
+}
+
+// ExecutePlan executes a plan with the engine. In dry-run mode the plan is executed
+// against a throwaway copy of the database and the changes are printed, unless
+// --plan-only is set.
+func ExecutePlan(engine *migrate.MigrationEngine, plan *migrate.ExecutionPlan, config *GlobalConfig) error {
+	if err := CheckPolicies(engine, plan); err != nil {
+		return err
+	}
+	if config.DryRun && !config.PlanOnly {
+		report, err := engine.DryRun(plan)
+		printDryRunReport(report, config.Verbose)
+		return err
+	}
+
+	// SIGINT and SIGTERM cancel the plan instead of killing a running migration
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return engine.ExecutePlanContext(ctx, plan, createProgressReporter(config.Verbose))
+}
+
+// printDryRunReport prints the changes of every migration in a dry run
+func printDryRunReport(report *migrate.DryRunReport, verbose bool) {
+	if report == nil {
+		return
+	}
+
+	fmt.Printf("=== Dry Run Changes ===\n")
+	for _, result := range report.Migrations {
+		if result.Err != nil {
+			PrintError("%s would fail: %v\n", result.MigrationID, result.Err)
+			continue
+		}
+
+		fmt.Printf("%s: %d added, %d modified, %d deleted (%v)\n", result.MigrationID,
+			result.Added, result.Modified, result.Deleted, result.Duration.Round(time.Millisecond))
+		for _, change := range result.Changes {
+			switch change.Kind {
+			case migrate.ChangeAdded:
+				fmt.Printf("  + %q", change.Key)
+				if verbose {
+					fmt.Printf(" = %s", migrate.RenderValue(change.Key, change.After))
+				}
+			case migrate.ChangeDeleted:
+				fmt.Printf("  - %q", change.Key)
+			default:
+				fmt.Printf("  ~ %q", change.Key)
+				if verbose {
+					fmt.Printf(": %s -> %s", migrate.RenderValue(change.Key, change.Before), migrate.RenderValue(change.Key, change.After))
+				}
+			}
+			fmt.Printf("\n")
+		}
+		if more := result.Total() - len(result.Changes); more > 0 {
+			fmt.Printf("  ... and %d more\n", more)
+		}
+	}
+	fmt.Printf("\n")
+}
+
 // VerbosePrintf prints a message only if verbose mode is enabled
 func VerbosePrintf(config *GlobalConfig, format string, args ...interface{}) {
 	if config.Verbose {
@@ -135,6 +507,28 @@ func ConfirmAction(message string) bool {
 	return response == "y" || response == "Y" || response == "yes" || response == "Yes"
 }
 
+// ConfirmPhrase asks the user to confirm a destructive operation by typing
+// phrase. If given (the value of --confirm-phrase) is set, it is checked instead
+// of prompting and a mismatch is an error.
+func ConfirmPhrase(message, phrase, given string) (bool, error) {
+	if given != "" {
+		if given != phrase {
+			return false, fmt.Errorf("confirmation phrase %q does not match, expected %q", given, phrase)
+		}
+		return true, nil
+	}
+
+	fmt.Printf("%s\nType %q to confirm: ", message, phrase)
+	response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(response) == phrase, nil
+}
+
+// DatabaseConfirmPhrase returns the phrase that confirms destructive operations
+// on a database: the name of its directory.
+func DatabaseConfirmPhrase(config *GlobalConfig) string {
+	return filepath.Base(config.DatabasePath)
+}
+
 // FormatDuration formats a duration string for display
 func FormatDuration(duration string) string {
 	if duration == "" {
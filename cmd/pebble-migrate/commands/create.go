@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewCreateCommand creates the create command (for generating new migration files)
+func NewCreateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create <migration_name>",
+		Short: "Create a new migration file",
+		Long: `Create a new migration file with the given name.
+
+The file is named <unix_timestamp>_<migration_name>.go and generated from a Go
+template. Creating a migration with a timestamp another one in the directory
+already has fails; --bump takes the next free second instead. Teams can provide their own templates with --template-dir: every
+migration*.tmpl file produces a file per migration (migration.go.tmpl produces
+<id>.go, migration_test.go.tmpl produces <id>_test.go), and other *.tmpl files
+can be included from them, e.g. a company header. A migration.go.tmpl in the
+directory replaces the built-in one.
+
+Templates receive .ID, .Version, .Name, .FuncName (CamelCase), .Description,
+.Package, .Author, .Tags and .CreatedAt, and can use the functions join, lower,
+upper, quote and required, e.g. {{required "author" .Author}}.
+
+Examples:
+  pebble-migrate create add_user_indexes
+  pebble-migrate create optimize_queries --dir internal/migrations --tag perf
+  pebble-migrate create backfill_orders --template-dir tools/migration-templates
+  pebble-migrate create backfill_orders --manifest
+  pebble-migrate create backfill_orders --bump`,
+		Args: cobra.ExactArgs(1),
+		RunE: runCreateCommand,
+	}
+
+	cmd.Flags().String("dir", "migrations", "Directory to create the migration in")
+	cmd.Flags().String("template-dir", "", "Directory of *.tmpl templates replacing or extending the built-in one")
+	cmd.Flags().String("package", "", "Go package of the migration (default: name of --dir)")
+	cmd.Flags().String("description", "", "Description of the migration (default: the name in words)")
+	cmd.Flags().String("author", "", "Author of the migration (default: $USER)")
+	cmd.Flags().StringArray("tag", nil, "Tag of the migration; repeatable")
+	cmd.Flags().Bool("bump", false, "Use the next free second if a migration in --dir already has the current timestamp")
+	cmd.Flags().Bool("manifest", false, "Declare the migration as a variable registered by 'gen manifest' instead of in init")
+
+	return cmd
+}
+
+func runCreateCommand(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	templateDir, _ := cmd.Flags().GetString("template-dir")
+	pkg, _ := cmd.Flags().GetString("package")
+	description, _ := cmd.Flags().GetString("description")
+	author, _ := cmd.Flags().GetString("author")
+	tags, _ := cmd.Flags().GetStringArray("tag")
+	manifest, _ := cmd.Flags().GetBool("manifest")
+	bump, _ := cmd.Flags().GetBool("bump")
+
+	if pkg == "" {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path for %s: %w", dir, err)
+		}
+		pkg = filepath.Base(absDir)
+	}
+	if author == "" {
+		author = os.Getenv("USER")
+	}
+
+	data, err := migrate.NewMigrationTemplateData(args[0], pkg)
+	if err != nil {
+		return err
+	}
+	if description != "" {
+		data.Description = description
+	}
+	data.Author = author
+	data.Tags = tags
+	data.Manifest = manifest
+
+	generator := migrate.NewMigrationGenerator()
+	if templateDir != "" {
+		if err := generator.LoadTemplates(os.DirFS(templateDir)); err != nil {
+			return fmt.Errorf("failed to load templates from %s: %w", templateDir, err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	files, err := migrate.ScanMigrationFiles(dir)
+	if err != nil {
+		return err
+	}
+	if free := migrate.NextFreeVersion(files, data.Version); free != data.Version {
+		if !bump {
+			return fmt.Errorf("a migration in %s already has version %d: use --bump to take the next free second", dir, data.Version)
+		}
+		data.SetVersion(free)
+	}
+	paths, err := generator.Generate(dir, data)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		PrintSuccess("Created %s\n", path)
+	}
+
+	if manifest {
+		PrintInfo("Run 'pebble-migrate gen manifest --dir %s' to register the migration\n", dir)
+		return nil
+	}
+	PrintInfo("Register the package with a blank import so the migration's init function runs\n")
+	return nil
+}
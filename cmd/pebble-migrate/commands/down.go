@@ -26,12 +26,22 @@ Examples:
   pebble-migrate down 3       # Rollback to version 3
   pebble-migrate down 0       # Rollback all migrations
   pebble-migrate down 3 --dry-run  # Show what would be done
-  pebble-migrate down 3 --no-backup  # Skip backup creation`,
+  pebble-migrate down 3 --no-backup  # Skip backup creation
+
+Migrations without a Down function are rolled back by restoring the values
+their Apply function replaced. This fails if those keys changed since the
+migration ran, unless --force-undo is passed.
+
+Rolling back to version 0 must be confirmed by typing the name of the database
+directory. Pass it with --confirm-phrase to roll back without prompting; it also
+skips the confirmation of rollbacks to any other version.`,
 		Args: cobra.ExactArgs(1),
 		RunE: runDownCommand,
 	}
 
 	cmd.Flags().Bool("no-backup", false, "Skip creating backup before rollback")
+	cmd.Flags().String("confirm-phrase", "", "Confirm any rollback without prompting, including to version 0, by passing the name of the database directory")
+	cmd.Flags().Bool("force-undo", false, "Restore recorded values of migrations without Down even if the keys changed since")
 
 	return cmd
 }
@@ -54,14 +64,17 @@ func runDownCommand(cmd *cobra.Command, args []string) error {
 
 	// Open database (read-only for dry-run, read-write otherwise)
 	readOnly := config.DryRun
-	db, err := OpenDatabase(config.DatabasePath, readOnly)
+	db, err := OpenDatabase(config, readOnly)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
 	// Create migration services
-	schemaManager, planner, discovery := CreateMigrationServices(db)
+	schemaManager, planner, discovery, err := CreateMigrationServices(db, config)
+	if err != nil {
+		return err
+	}
 
 	// Validate migrations
 	if err := discovery.ValidateMigrations(); err != nil {
@@ -96,6 +109,28 @@ func runDownCommand(cmd *cobra.Command, args []string) error {
 	// Display rollback plan
 	displayRollbackPlan(plan, config.DryRun)
 
+	// Create migration engine with backup support
+	engine, _ := CreateMigrationEngine(db, config)
+	engine.SetDryRun(config.DryRun)
+	engine.SetVerbose(config.Verbose)
+
+	// Check if backup should be disabled
+	noBackup, _ := cmd.Flags().GetBool("no-backup")
+	if noBackup {
+		engine.SetBackupEnabled(false)
+		if config.Verbose {
+			PrintInfo("Backup creation disabled by --no-backup flag\n")
+		}
+	}
+
+	forceUndo, _ := cmd.Flags().GetBool("force-undo")
+	engine.SetForceUndo(forceUndo)
+
+	// Refuse plans violating the policies before asking
+	if err := CheckPolicies(engine, plan); err != nil {
+		return err
+	}
+
 	// Show warning about potential data loss
 	if !config.DryRun {
 		PrintWarning("DANGER: This operation will rollback migrations and may result in data loss!\n")
@@ -103,41 +138,36 @@ func runDownCommand(cmd *cobra.Command, args []string) error {
 		fmt.Printf("\n")
 	}
 
-	// Confirm execution (unless dry-run)
+	// Confirm execution (unless dry-run or confirmed with --confirm-phrase)
+	confirmPhrase, _ := cmd.Flags().GetString("confirm-phrase")
 	if !config.DryRun {
-		if !ConfirmAction("Are you absolutely sure you want to proceed with this rollback?") {
+		if confirmPhrase == "" && !ConfirmAction("Are you absolutely sure you want to proceed with this rollback?") {
 			PrintInfo("Rollback cancelled.\n")
 			return nil
 		}
 
-		// Double confirmation for potentially destructive operations
+		// Typed confirmation for potentially destructive operations
 		if plan.CurrentVersion > 0 && targetVersion == 0 {
 			fmt.Printf("\n")
 			PrintWarning("You are about to rollback ALL migrations to version 0!\n")
-			if !ConfirmAction("Type 'yes' to confirm you want to rollback everything") {
+			confirmed, err := ConfirmPhrase("To rollback everything, type the name of the database directory.",
+				DatabaseConfirmPhrase(config), confirmPhrase)
+			if err != nil {
+				return err
+			}
+			if !confirmed {
 				PrintInfo("Rollback cancelled.\n")
 				return nil
 			}
+		} else if confirmPhrase != "" {
+			if _, err := ConfirmPhrase("", DatabaseConfirmPhrase(config), confirmPhrase); err != nil {
+				return err
+			}
 		}
 	}
 
-	// Create migration engine with backup support
-	engine, _ := CreateMigrationEngine(db, config.DatabasePath)
-	engine.SetDryRun(config.DryRun)
-	engine.SetVerbose(config.Verbose)
-
-	// Check if backup should be disabled
-	noBackup, _ := cmd.Flags().GetBool("no-backup")
-	if noBackup {
-		engine.SetBackupEnabled(false)
-		if config.Verbose {
-			PrintInfo("Backup creation disabled by --no-backup flag\n")
-		}
-	}
-
-	// Execute rollback plan with progress callback
-	progressCallback := createProgressCallback(config.Verbose)
-	err = engine.ExecutePlan(plan, progressCallback)
+	// Execute rollback plan (against a throwaway copy in dry-run mode)
+	err = ExecutePlan(engine, plan, config)
 	if err != nil {
 		PrintError("Rollback failed: %v\n", err)
 		return err
@@ -0,0 +1,256 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewFingerprintCommand creates the fingerprint command
+func NewFingerprintCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fingerprint",
+		Short: "Checksum the data under a key prefix and compare it later",
+		Long: `Checksum all keys and values under a key prefix, to tell later whether
+anything changed without keeping a copy of the data.
+
+A fingerprint is stored in the database under a name, e.g. before a migration
+that must leave a prefix alone, and checked against the data afterwards. It can
+also be compared with the same prefix in a backup. Fingerprints are split into
+chunks of about --chunk-size keys, which locate the changed key ranges.`,
+	}
+
+	cmd.PersistentFlags().Int("chunk-size", migrate.DefaultFingerprintChunkSize, "Average number of keys per chunk")
+
+	cmd.AddCommand(NewFingerprintShowCommand())
+	cmd.AddCommand(NewFingerprintSaveCommand())
+	cmd.AddCommand(NewFingerprintCheckCommand())
+	cmd.AddCommand(NewFingerprintListCommand())
+	cmd.AddCommand(NewFingerprintBackupCommand())
+
+	return cmd
+}
+
+// NewFingerprintShowCommand creates the fingerprint show subcommand
+func NewFingerprintShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <prefix>",
+		Short: "Print the fingerprint of a prefix",
+		Long: `Print the fingerprint of the keys under a prefix.
+
+Examples:
+  pebble-migrate fingerprint show user/ -d /path/to/db`,
+		Args: cobra.ExactArgs(1),
+		RunE: runFingerprintShowCommand,
+	}
+}
+
+func runFingerprintShowCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+	chunkSize, _ := cmd.Flags().GetInt("chunk-size")
+
+	db, err := OpenDatabase(config, true)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	fp, err := migrate.FingerprintPrefix(db, []byte(args[0]), chunkSize)
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint %q: %w", args[0], err)
+	}
+	printFingerprint(fp)
+	return nil
+}
+
+// NewFingerprintSaveCommand creates the fingerprint save subcommand
+func NewFingerprintSaveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "save <name> <prefix>",
+		Short: "Store the fingerprint of a prefix under a name",
+		Long: `Store the fingerprint of the keys under a prefix in the database, replacing
+the one stored under the name before. Check it later with 'fingerprint check'.
+
+Examples:
+  pebble-migrate fingerprint save orders order/ -d /path/to/db`,
+		Args: cobra.ExactArgs(2),
+		RunE: runFingerprintSaveCommand,
+	}
+}
+
+func runFingerprintSaveCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+	chunkSize, _ := cmd.Flags().GetInt("chunk-size")
+
+	db, err := OpenDatabase(config, false)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	fp, err := migrate.FingerprintPrefix(db, []byte(args[1]), chunkSize)
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint %q: %w", args[1], err)
+	}
+	if err := NewSchemaManager(db, config).SaveFingerprint(args[0], fp); err != nil {
+		return err
+	}
+	PrintSuccess("Fingerprint %s saved: %d keys under %q\n", args[0], fp.Keys, fp.Prefix)
+	return nil
+}
+
+// NewFingerprintCheckCommand creates the fingerprint check subcommand
+func NewFingerprintCheckCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "check <name>",
+		Short: "Check the data against a stored fingerprint",
+		Long: `Fingerprint the prefix of a stored fingerprint again and compare. The command
+fails and prints the changed key ranges if the data changed.
+
+Examples:
+  pebble-migrate fingerprint check orders -d /path/to/db`,
+		Args: cobra.ExactArgs(1),
+		RunE: runFingerprintCheckCommand,
+	}
+}
+
+func runFingerprintCheckCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(config, true)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	diff, err := NewSchemaManager(db, config).VerifyFingerprint(args[0])
+	if errors.Is(err, migrate.ErrFingerprintMismatch) {
+		printFingerprintDiff(diff)
+		return fmt.Errorf("data changed since fingerprint %s", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	PrintSuccess("No changes since fingerprint %s\n", args[0])
+	return nil
+}
+
+// NewFingerprintListCommand creates the fingerprint list subcommand
+func NewFingerprintListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the stored fingerprints",
+		Args:  cobra.NoArgs,
+		RunE:  runFingerprintListCommand,
+	}
+}
+
+func runFingerprintListCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(config, true)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	list, err := NewSchemaManager(db, config).ListFingerprints()
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		PrintInfo("No fingerprints stored\n")
+		return nil
+	}
+	fmt.Printf("=== Fingerprints ===\n")
+	for _, fp := range list {
+		fmt.Printf("%s: %q, %d keys, %s, %s\n", fp.Name, fp.Prefix, fp.Keys,
+			fp.Sum[:16], fp.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// NewFingerprintBackupCommand creates the fingerprint backup subcommand
+func NewFingerprintBackupCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup <backup_path> <prefix>",
+		Short: "Compare a prefix with the same prefix in a backup",
+		Long: `Fingerprint a prefix in the database and in a backup and print the changed
+key ranges. The backup is copied next to the database to be read, and the copy
+is removed afterwards.
+
+Examples:
+  pebble-migrate fingerprint backup /path/to/db.backup_20250811_142003.tar.gz user/ -d /path/to/db`,
+		Args: cobra.ExactArgs(2),
+		RunE: runFingerprintBackupCommand,
+	}
+}
+
+func runFingerprintBackupCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+	chunkSize, _ := cmd.Flags().GetInt("chunk-size")
+	prefix := []byte(args[1])
+
+	inBackup, err := NewBackupManager(config).FingerprintBackup(args[0], prefix, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(config, true)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	live, err := migrate.FingerprintPrefix(db, prefix, chunkSize)
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint %q: %w", args[1], err)
+	}
+	diff, err := migrate.CompareFingerprints(inBackup, live)
+	if err != nil {
+		return err
+	}
+	if diff.Equal {
+		PrintSuccess("%q is the same in the database and the backup (%d keys)\n", prefix, live.Keys)
+		return nil
+	}
+	printFingerprintDiff(diff)
+	return nil
+}
+
+// printFingerprint prints a fingerprint
+func printFingerprint(fp *migrate.Fingerprint) {
+	fmt.Printf("=== Fingerprint ===\n")
+	fmt.Printf("Prefix: %q\n", fp.Prefix)
+	fmt.Printf("Keys: %d\n", fp.Keys)
+	fmt.Printf("Size: %d bytes\n", fp.Bytes)
+	fmt.Printf("Checksum: %s\n", fp.Sum)
+	if fp.ChunkSize > 0 {
+		fmt.Printf("Chunks: %d (about %d keys each)\n", len(fp.Chunks), fp.ChunkSize)
+	}
+}
+
+// printFingerprintDiff prints the differences between two fingerprints
+func printFingerprintDiff(diff *migrate.FingerprintDiff) {
+	PrintWarning("Data changed: %d keys before, %d after\n", diff.KeysBefore, diff.KeysAfter)
+	for _, r := range diff.Ranges {
+		fmt.Printf("  - %s\n", r)
+	}
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewFixCommand creates the fix command
+func NewFixCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fix",
+		Short: "Apply a reviewed set of key mutations atomically",
+		Long: `Apply a fix script, a reviewed set of key mutations, in a single atomic batch:
+a safer alternative to fixing data with a one-off program. The fix is recorded in
+the audit history (see 'state audit') together with a generated inverse script,
+which is also written next to the script to undo the fix with another 'fix'.
+
+A fix script is a YAML or JSON file with a description and ops limited to set,
+delete and rename:
+
+  description: Restore the email of user 42 lost in INC-123
+  owner: data-team
+  ops:
+    - op: set
+      values:
+        user/42/email: alice@example.com
+    - op: rename
+      from: user/42/nickname
+      to: user/42/display_name
+    - op: delete
+      keys: [user/42/tmp]
+
+The changes are shown before they are applied; with --dry-run nothing is
+written. If any step fails, e.g. a rename of a missing key, nothing is written.
+
+Examples:
+  pebble-migrate fix --script fixes.yaml -d /path/to/db
+  pebble-migrate fix --script fixes.yaml -d /path/to/db --dry-run
+  pebble-migrate fix --script fixes.inverse.yaml -d /path/to/db`,
+		RunE: runFixCommand,
+	}
+
+	cmd.Flags().String("script", "", "Fix script to apply (required)")
+	cmd.Flags().String("inverse-out", "", "File to write the inverse script to (default <script>.inverse<ext>)")
+	cmd.Flags().Bool("force", false, "Skip confirmation prompt")
+	_ = cmd.MarkFlagRequired("script")
+
+	return cmd
+}
+
+func runFixCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+	scriptPath, _ := cmd.Flags().GetString("script")
+	inverseOut, _ := cmd.Flags().GetString("inverse-out")
+	force, _ := cmd.Flags().GetBool("force")
+	if inverseOut == "" {
+		ext := filepath.Ext(scriptPath)
+		inverseOut = strings.TrimSuffix(scriptPath, ext) + ".inverse" + ext
+	}
+
+	fix, err := migrate.LoadFixScript(scriptPath)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(config, config.DryRun)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	schemaManager := NewSchemaManager(db, config)
+
+	result, err := schemaManager.PlanFix(fix)
+	if err != nil {
+		return err
+	}
+	if len(result.Changes) == 0 {
+		PrintInfo("The fix changes nothing\n")
+		return nil
+	}
+	fmt.Printf("=== Fix: %s ===\n", fix.Description)
+	printFixChanges(result.Changes)
+	fmt.Printf("\n")
+
+	if config.DryRun {
+		PrintInfo("Dry run: nothing written\n")
+		return nil
+	}
+	if !force && !ConfirmAction(fmt.Sprintf("Apply %d key changes to %s?", len(result.Changes), config.DatabasePath)) {
+		PrintInfo("Fix cancelled.\n")
+		return nil
+	}
+
+	result, err = schemaManager.ApplyFix(fix)
+	if err != nil {
+		return err
+	}
+	PrintSuccess("Fix applied: %d keys changed\n", len(result.Changes))
+	if len(result.Changes) == 0 {
+		return nil
+	}
+	if err := result.Inverse.WriteFile(inverseOut); err != nil {
+		PrintWarning("Inverse script not written, it is kept in the audit history: %v\n", err)
+		return nil
+	}
+	PrintInfo("Undo with: pebble-migrate fix --script %s\n", inverseOut)
+	return nil
+}
+
+// printFixChanges prints the key changes of a fix with their values
+func printFixChanges(changes []migrate.KeyChange) {
+	for _, change := range changes {
+		switch change.Kind {
+		case migrate.ChangeAdded:
+			fmt.Printf("  + %q = %s\n", change.Key, migrate.RenderValue(change.Key, change.After))
+		case migrate.ChangeDeleted:
+			fmt.Printf("  - %q (was %s)\n", change.Key, migrate.RenderValue(change.Key, change.Before))
+		default:
+			fmt.Printf("  ~ %q: %s -> %s\n", change.Key, migrate.RenderValue(change.Key, change.Before), migrate.RenderValue(change.Key, change.After))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewGenCommand creates the gen command (for generating code)
+func NewGenCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gen",
+		Short: "Generate code for migrations packages",
+	}
+
+	cmd.AddCommand(newGenManifestCommand())
+
+	return cmd
+}
+
+// newGenManifestCommand creates the gen manifest subcommand
+func newGenManifestCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "manifest",
+		Short: "Generate the registrations of a migrations package",
+		Long: `Scan a migrations package and generate a file registering its migrations
+into a given registry, instead of relying on init side effects.
+
+Migrations are declared as package-level variables, one per file named after
+the migration ID (see 'create --manifest'):
+
+  var migrationAddUserIndexes = &migrate.Migration{ID: "1700000000_add_user_indexes", ...}
+
+The generated file declares Migrations(), returning the migrations ordered by
+file name, and RegisterMigrations(registry). The command fails without writing
+if a file named like a migration declares none, a file declares more than one,
+a file name and its migration ID differ, an ID is declared twice, or a file
+calls migrate.Register itself.
+
+With --check, nothing is written and the command fails if the file is missing
+or out of date, e.g. in CI.
+
+Run it from the package with go:generate:
+
+  //go:generate pebble-migrate gen manifest
+
+Examples:
+  pebble-migrate gen manifest --dir internal/migrations
+  pebble-migrate gen manifest --dir internal/migrations --check`,
+		Args: cobra.NoArgs,
+		RunE: runGenManifestCommand,
+	}
+
+	cmd.Flags().String("dir", ".", "Directory of the migrations package")
+	cmd.Flags().String("output", migrate.ManifestFileName, "Name of the generated file in --dir")
+	cmd.Flags().Bool("check", false, "Fail if the generated file is missing or out of date instead of writing it")
+
+	return cmd
+}
+
+func runGenManifestCommand(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	output, _ := cmd.Flags().GetString("output")
+	check, _ := cmd.Flags().GetBool("check")
+
+	manifest, err := migrate.ScanMigrationPackage(dir, output)
+	if err != nil {
+		return err
+	}
+	source, err := manifest.Source()
+	if err != nil {
+		return fmt.Errorf("failed to generate manifest: %w", err)
+	}
+
+	path := filepath.Join(dir, output)
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if bytes.Equal(existing, source) {
+		PrintSuccess("%s is up to date (%d migrations)\n", path, len(manifest.Entries))
+		return nil
+	}
+	if check {
+		return fmt.Errorf("%s is out of date: run 'pebble-migrate gen manifest --dir %s'", path, dir)
+	}
+
+	if err := os.WriteFile(path, source, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	PrintSuccess("Wrote %s (%d migrations)\n", path, len(manifest.Entries))
+	return nil
+}
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewImportCommand creates the import command
+func NewImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Seed migration state from golang-migrate or a version list",
+		Long: `Seed the schema state from another migration tool, so migrations that were
+already applied before moving to pebble-migrate are not run again.
+
+Use --version with the version (and --dirty flag) from golang-migrate's
+schema_migrations table: every registered migration up to and including that
+version is marked as applied.
+
+Use --versions-file to mark exactly the listed versions as applied. The file
+holds one version per line; a "version,dirty" export of schema_migrations is
+also accepted.
+
+Versions must match the Version of registered migrations. No migration code is
+executed; only the schema state is written.
+
+Examples:
+  pebble-migrate import -d /path/to/db --version 1754917200
+  pebble-migrate import -d /path/to/db --versions-file applied.txt
+  pebble-migrate import -d /path/to/db --version 1754917200 --force`,
+		RunE: runImportCommand,
+	}
+
+	cmd.Flags().Int64("version", 0, "Latest applied version from golang-migrate's schema_migrations")
+	cmd.Flags().Bool("dirty", false, "The dirty flag from golang-migrate's schema_migrations")
+	cmd.Flags().String("versions-file", "", "File listing applied versions, one per line")
+	cmd.Flags().String("source", "golang-migrate", "Name of the tool the state is imported from")
+	cmd.Flags().Bool("force", false, "Replace a schema state that already has applied migrations")
+
+	return cmd
+}
+
+func runImportCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	version, _ := cmd.Flags().GetInt64("version")
+	dirty, _ := cmd.Flags().GetBool("dirty")
+	versionsFile, _ := cmd.Flags().GetString("versions-file")
+	source, _ := cmd.Flags().GetString("source")
+	force, _ := cmd.Flags().GetBool("force")
+
+	if cmd.Flags().Changed("version") == (versionsFile != "") {
+		return fmt.Errorf("exactly one of --version or --versions-file is required")
+	}
+
+	var versions []int64
+	if versionsFile != "" {
+		f, err := os.Open(versionsFile)
+		if err != nil {
+			return fmt.Errorf("failed to open versions file: %w", err)
+		}
+		versions, err = migrate.ParseAppliedVersions(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse versions file: %w", err)
+		}
+	}
+
+	if config.DryRun {
+		if versionsFile != "" {
+			PrintInfo("DRY RUN: Would import %d applied versions from %s\n", len(versions), versionsFile)
+		} else {
+			PrintInfo("DRY RUN: Would import %s state at version %d\n", source, version)
+		}
+		return nil
+	}
+
+	db, err := OpenDatabase(config, false)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	schemaManager := NewSchemaManager(db, config)
+	opts := migrate.ImportOptions{Source: source, Force: force}
+
+	if force && !ConfirmAction("This replaces the existing migration state. Continue?") {
+		PrintInfo("Import cancelled.\n")
+		return nil
+	}
+
+	var imported []string
+	if versionsFile != "" {
+		imported, err = schemaManager.ImportAppliedVersions(migrate.GlobalRegistry, versions, opts)
+	} else {
+		imported, err = schemaManager.ImportGolangMigrateState(migrate.GlobalRegistry, version, dirty, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+
+	PrintSuccess("Imported %d applied migrations from %s\n", len(imported), source)
+	for _, id := range imported {
+		VerbosePrintf(config, "  - %s\n", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewLintCommand creates the lint command
+func NewLintCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check the migration files of a directory",
+		Long: `Check the migration files of a directory, e.g. in CI after merging branches.
+The files are read directly, so migrations not built into this binary are
+checked too: Go files named like a migration ID and script migrations.
+
+Checks:
+  --unique-timestamps  No two migrations share a Unix timestamp. Migrations with
+                       the same timestamp run in an order decided only by their
+                       IDs, which changes when branches that each added one are
+                       merged. Use 'create --bump' to pick the next free second.
+  --metadata           Every migration has a description, an owner and a
+                       runbook URL (migrate.StrictMetadataPolicy). Go files are
+                       checked through their migrate.Migration literal; files
+                       without one are reported as unchecked.
+
+Migrations dated more than --future-tolerance after the current time are
+reported as warnings, whatever the checks: they usually come from a machine with
+a skewed clock, and once applied they raise the schema version past the
+migrations others create meanwhile. Rename them to the current time.
+
+With no check selected, all checks except --metadata run, as it enforces a team
+policy. The command fails if a check finds a problem. The database is not
+opened.
+
+Examples:
+  pebble-migrate lint --dir internal/migrations
+  pebble-migrate lint --dir internal/migrations --unique-timestamps
+  pebble-migrate lint --dir internal/migrations --metadata`,
+		Args: cobra.NoArgs,
+		RunE: runLintCommand,
+	}
+
+	cmd.Flags().String("dir", "migrations", "Directory of the migration files")
+	cmd.Flags().Bool("unique-timestamps", false, "Check that no two migrations share a timestamp")
+	cmd.Flags().Bool("metadata", false, "Check that every migration has a description, owner and runbook URL")
+	cmd.Flags().Duration("future-tolerance", migrate.DefaultFutureTolerance, "Warn about migrations dated more than this far in the future")
+
+	return cmd
+}
+
+func runLintCommand(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	uniqueTimestamps, _ := cmd.Flags().GetBool("unique-timestamps")
+	metadata, _ := cmd.Flags().GetBool("metadata")
+	futureTolerance, _ := cmd.Flags().GetDuration("future-tolerance")
+	all := !uniqueTimestamps && !metadata
+
+	files, err := migrate.ScanMigrationFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, future := range migrate.FindFutureFiles(files, time.Now(), futureTolerance) {
+		PrintWarning("%s\n", future)
+	}
+
+	problems := 0
+	if all || uniqueTimestamps {
+		for _, collision := range migrate.FindVersionCollisions(files) {
+			PrintError("%s\n", collision)
+			problems++
+		}
+	}
+
+	if metadata {
+		for _, problem := range migrate.FindMetadataProblems(files, migrate.StrictMetadataPolicy) {
+			PrintError("%s\n", problem)
+			problems++
+		}
+		for _, file := range files {
+			if !file.HasMetadata {
+				PrintWarning("%s: no migrate.Migration literal found, metadata not checked\n", file.Name)
+			}
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("lint found %d problem(s) in %d migration files", problems, len(files))
+	}
+	PrintSuccess("%d migration files checked, no problems found\n", len(files))
+	return nil
+}
@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewOpLogCommand creates the oplog command
+func NewOpLogCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "oplog",
+		Short: "Operation log management",
+		Long: `Inspect, replay and undo recorded migration operation logs.
+
+Migrations that write through a migrate.Writer (the Apply function) record
+every key mutation with the key's previous value. Run "up --record-ops" to
+save these logs next to the backups. A log can be undone to revert the
+migration's writes, or replayed to apply them again, which makes it a
+lightweight alternative to full backups for small, targeted migrations.`,
+	}
+
+	cmd.AddCommand(NewOpLogListCommand())
+	cmd.AddCommand(NewOpLogShowCommand())
+	cmd.AddCommand(NewOpLogReplayCommand())
+	cmd.AddCommand(NewOpLogUndoCommand())
+
+	return cmd
+}
+
+// NewOpLogListCommand creates the oplog list subcommand
+func NewOpLogListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List saved operation logs",
+		RunE:  runOpLogListCommand,
+	}
+}
+
+// NewOpLogShowCommand creates the oplog show subcommand
+func NewOpLogShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <oplog_path>",
+		Short: "Show the operations in a log",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runOpLogShowCommand,
+	}
+}
+
+// NewOpLogReplayCommand creates the oplog replay subcommand
+func NewOpLogReplayCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay <oplog_path>",
+		Short: "Re-apply the operations in a log",
+		Long: `Re-apply the operations in a log in one atomic batch.
+
+Every touched key must still have the value it had before the migration ran,
+for example after restoring an older backup. Use --force to apply anyway.
+The schema state is not changed.
+
+Examples:
+  pebble-migrate oplog replay /path/to/db.oplog_20240101_120000_1736700000_backfill`,
+		Args: cobra.ExactArgs(1),
+		RunE: runOpLogReplayCommand,
+	}
+
+	cmd.Flags().Bool("force", false, "Apply even if keys changed since the log was recorded")
+
+	return cmd
+}
+
+// NewOpLogUndoCommand creates the oplog undo subcommand
+func NewOpLogUndoCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "undo <oplog_path>",
+		Short: "Revert the operations in a log",
+		Long: `Restore every key touched by a log to its value before the migration,
+in one atomic batch.
+
+Every touched key must still have the value the migration left. Use --force
+to revert anyway. The schema state is not changed; use "down" to roll back
+a migration and update the schema state, or "force-clean" after undoing the
+partial writes of a failed migration.
+
+Examples:
+  pebble-migrate oplog undo /path/to/db.oplog_20240101_120000_1736700000_backfill`,
+		Args: cobra.ExactArgs(1),
+		RunE: runOpLogUndoCommand,
+	}
+
+	cmd.Flags().Bool("force", false, "Revert even if keys changed since the log was recorded")
+
+	return cmd
+}
+
+func runOpLogListCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	paths, err := NewBackupManager(config).ListOpLogs()
+	if err != nil {
+		return err
+	}
+
+	if len(paths) == 0 {
+		PrintInfo("No operation logs found for database: %s\n", config.DatabasePath)
+		return nil
+	}
+
+	fmt.Printf("=== Operation Logs ===\n\n")
+	for i, path := range paths {
+		log, err := migrate.ReadOpLog(path)
+		if err != nil {
+			fmt.Printf("%d. %s\n   Error: %v\n\n", i+1, path, err)
+			continue
+		}
+		fmt.Printf("%d. %s\n", i+1, path)
+		fmt.Printf("   Migration: %s\n", log.MigrationID)
+		fmt.Printf("   Created: %s\n", log.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("   Operations: %d on %d key(s)\n\n", len(log.Ops), len(log.Keys()))
+	}
+
+	return nil
+}
+
+func runOpLogShowCommand(cmd *cobra.Command, args []string) error {
+	log, err := migrate.ReadOpLog(args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Migration: %s\n", log.MigrationID)
+	fmt.Printf("Created: %s\n", log.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Operations: %d\n\n", len(log.Ops))
+
+	for i, op := range log.Ops {
+		previous := "(absent)"
+		if op.Existed {
+			previous = fmt.Sprintf("%q", op.Previous)
+		}
+		if op.Kind == migrate.OpSet {
+			fmt.Printf("%4d. set    %q = %q (was %s)\n", i+1, op.Key, op.Value, previous)
+		} else {
+			fmt.Printf("%4d. delete %q (was %s)\n", i+1, op.Key, previous)
+		}
+	}
+
+	return nil
+}
+
+func runOpLogReplayCommand(cmd *cobra.Command, args []string) error {
+	return applyOpLog(cmd, args[0], "replay", func(log *migrate.OpLog, db *pebble.DB, force bool) error {
+		return log.Replay(db, force)
+	})
+}
+
+func runOpLogUndoCommand(cmd *cobra.Command, args []string) error {
+	return applyOpLog(cmd, args[0], "undo", func(log *migrate.OpLog, db *pebble.DB, force bool) error {
+		return log.Undo(db, force)
+	})
+}
+
+// applyOpLog confirms and runs a replay or undo of the log at path
+func applyOpLog(cmd *cobra.Command, path, action string, apply func(*migrate.OpLog, *pebble.DB, bool) error) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+	force, _ := cmd.Flags().GetBool("force")
+
+	log, err := migrate.ReadOpLog(path)
+	if err != nil {
+		return err
+	}
+
+	PrintInfo("Operation log: %s\n", path)
+	PrintInfo("Migration: %s (%d operations on %d key(s))\n", log.MigrationID, len(log.Ops), len(log.Keys()))
+	if config.DryRun {
+		PrintInfo("Dry run: would %s the log. No changes were made.\n", action)
+		return nil
+	}
+	if !ConfirmAction(fmt.Sprintf("Do you want to %s this log?", action)) {
+		PrintInfo("Cancelled.\n")
+		return nil
+	}
+
+	db, err := OpenDatabase(config, false)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := apply(log, db, force); err != nil {
+		return fmt.Errorf("failed to %s operation log: %w", action, err)
+	}
+
+	PrintSuccess("Operation log applied (%s)\n", action)
+	PrintInfo("The schema state was not changed.\n")
+	return nil
+}
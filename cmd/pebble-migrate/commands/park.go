@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"fmt"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewParkCommand creates the park command
+func NewParkCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "park <migration_id>",
+		Short: "Exclude a pending migration from upgrades until it is unparked",
+		Long: `Park a pending migration, e.g. a known-slow backfill, so that 'up', 'watch'
+and migrations at application startup leave it out, together with the pending
+migrations depending on it. Unrelated migrations keep being applied. Parked
+migrations are listed by 'status' and stay parked until 'unpark'; 'apply-one'
+still applies one explicitly.
+
+Examples:
+  pebble-migrate park 1754917200_backfill_orders --reason "runs in the maintenance window"
+  pebble-migrate unpark 1754917200_backfill_orders`,
+		Args: cobra.ExactArgs(1),
+		RunE: runParkCommand,
+	}
+
+	cmd.Flags().String("reason", "", "Why the migration is parked, shown by status")
+
+	return cmd
+}
+
+// NewUnparkCommand creates the unpark command
+func NewUnparkCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unpark <migration_id>",
+		Short: "Return a parked migration to upgrades",
+		Long: `Unpark a migration parked with 'park', so that the next upgrade applies it.
+
+Examples:
+  pebble-migrate unpark 1754917200_backfill_orders`,
+		Args: cobra.ExactArgs(1),
+		RunE: runUnparkCommand,
+	}
+}
+
+func runParkCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+	reason, _ := cmd.Flags().GetString("reason")
+
+	db, err := OpenDatabase(config, false)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	schemaManager, _, _, err := CreateMigrationServices(db, config)
+	if err != nil {
+		return err
+	}
+
+	migration, ok := migrate.GlobalRegistry.GetMigration(migrate.GlobalRegistry.ResolveID(args[0]))
+	if !ok {
+		return fmt.Errorf("migration '%s' not found", args[0])
+	}
+	if err := schemaManager.ParkMigration(migration.ID, reason); err != nil {
+		return err
+	}
+
+	PrintSuccess("Migration '%s' parked; run 'pebble-migrate unpark %s' to apply it again\n", migration.ID, migration.ID)
+	return nil
+}
+
+func runUnparkCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(config, false)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	schemaManager, _, _, err := CreateMigrationServices(db, config)
+	if err != nil {
+		return err
+	}
+
+	migrationID := migrate.GlobalRegistry.ResolveID(args[0])
+	parked, err := schemaManager.ListParkedMigrations()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, p := range parked {
+		found = found || p.ID == migrationID
+	}
+	if !found {
+		return fmt.Errorf("migration '%s' is not parked", args[0])
+	}
+	if err := schemaManager.UnparkMigration(migrationID); err != nil {
+		return err
+	}
+
+	PrintSuccess("Migration '%s' unparked; the next upgrade applies it\n", migrationID)
+	return nil
+}
@@ -0,0 +1,325 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewRecoverCommand creates the recover command
+func NewRecoverCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recover",
+		Short: "Walk through recovering from a failed or interrupted migration",
+		Long: `Inspect the schema state and walk through the recommended recovery path.
+
+The state is checked for a dirty or interrupted migration and for drift between
+the applied migrations, the history and the version. The recommended steps are
+then offered one at a time, and each one is executed after confirmation:
+
+  validate  Run the Validate function of the failed or interrupted migration to
+            check whether its changes are in place
+  repair    Reconcile the applied migrations and the version with the history
+            (repair --mode reconcile)
+  rerun     Mark the state clean and run the pending migrations again
+            (force-clean, then up)
+  abandon   Roll back only the chunks an interrupted chunked migration
+            committed, from their pre-images or with its Down
+  restore   Restore the backup taken before the failed plan, or the newest
+            backup (backup restore)
+
+Rerun, abandon and restore are alternatives. Like force-clean, rerun must be
+confirmed by typing the name of the database directory; pass it with
+--confirm-phrase to skip the prompt. With --dry-run the diagnosis and the
+recommended path are only printed.
+
+Examples:
+  pebble-migrate recover -d /path/to/db
+  pebble-migrate recover -d /path/to/db --dry-run`,
+		RunE: runRecoverCommand,
+	}
+
+	cmd.Flags().Bool("no-backup", false, "Skip creating a backup before rerunning or abandoning migrations")
+	cmd.Flags().String("confirm-phrase", "", "Confirm marking the state clean for rerun with the name of the database directory instead of prompting")
+
+	return cmd
+}
+
+func runRecoverCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(config, config.DryRun)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			db.Close()
+		}
+	}()
+
+	schemaManager, _, _, err := CreateMigrationServices(db, config)
+	if err != nil {
+		return err
+	}
+	registry := migrate.GlobalRegistry
+	backupManager := NewBackupManager(config)
+
+	diagnosis, err := schemaManager.DiagnoseRecovery(registry, backupManager)
+	if err != nil {
+		return fmt.Errorf("failed to inspect schema state: %w", err)
+	}
+	printDiagnosis(diagnosis)
+
+	if !diagnosis.NeedsRecovery() {
+		PrintSuccess("Nothing to recover: the schema state is clean and consistent\n")
+		return nil
+	}
+	if config.DryRun {
+		PrintInfo("DRY RUN: no step was executed\n")
+		return nil
+	}
+
+	for _, step := range diagnosis.Steps {
+		switch step {
+		case migrate.RecoveryValidate:
+			if ConfirmAction(fmt.Sprintf("\nValidate the changes of %s?", diagnosis.MigrationID)) {
+				recoverValidate(db, registry, diagnosis.MigrationID)
+			}
+
+		case migrate.RecoveryRepair:
+			if ConfirmAction("\nReconcile the applied migrations and the version with the history?") {
+				if err := recoverRepair(schemaManager, registry); err != nil {
+					return err
+				}
+			}
+
+		case migrate.RecoveryRerun:
+			// Rerun, abandon and restore are alternatives, offered together
+			choice := promptRecoveryChoice(diagnosis.Steps)
+			noBackup, _ := cmd.Flags().GetBool("no-backup")
+			switch choice {
+			case migrate.RecoveryRerun:
+				confirmPhrase, _ := cmd.Flags().GetString("confirm-phrase")
+				return recoverRerun(db, schemaManager, config, noBackup, confirmPhrase)
+			case migrate.RecoveryAbandon:
+				return recoverAbandon(db, config, diagnosis.MigrationID, noBackup)
+			case migrate.RecoveryRestore:
+				db.Close()
+				closed = true
+				return recoverRestore(backupManager, registry, diagnosis.Backup)
+			}
+			PrintInfo("Stopped. Run 'recover' again to continue.\n")
+			return nil
+		}
+	}
+
+	return printRecoveryOutcome(schemaManager, registry)
+}
+
+// printDiagnosis prints the state found by DiagnoseRecovery and the recommended path
+func printDiagnosis(diagnosis *migrate.RecoveryDiagnosis) {
+	fmt.Printf("=== Recovery ===\n\n")
+	fmt.Printf("Status: %s\n", diagnosis.Status)
+	fmt.Printf("Current Version: %d (%s)\n", diagnosis.Version, migrate.FormatVersionAsTime(diagnosis.Version))
+	if diagnosis.MigrationID != "" {
+		fmt.Printf("Migration: %s\n", diagnosis.MigrationID)
+	}
+	if diagnosis.Error != "" {
+		fmt.Printf("Error: %s\n", diagnosis.Error)
+	}
+	if len(diagnosis.Discrepancies) > 0 {
+		fmt.Printf("Drift:\n")
+		for _, d := range diagnosis.Discrepancies {
+			fmt.Printf("  - %s\n", d.Message)
+		}
+	}
+	if diagnosis.Backup != "" {
+		fmt.Printf("Backup: %s\n", diagnosis.Backup)
+	}
+	if len(diagnosis.Steps) > 0 {
+		var path []string
+		for _, step := range diagnosis.Steps {
+			if step == migrate.RecoveryAbandon || step == migrate.RecoveryRestore {
+				path[len(path)-1] += " or " + string(step)
+				continue
+			}
+			path = append(path, string(step))
+		}
+		fmt.Printf("\nRecommended path: %s\n", strings.Join(path, " → "))
+	}
+	fmt.Printf("\n")
+}
+
+// recoverValidate runs the Validate function of a migration and prints what the
+// result means for the next steps
+func recoverValidate(db *pebble.DB, registry *migrate.MigrationRegistry, migrationID string) {
+	migration, _ := registry.GetMigration(migrationID)
+	if err := migration.Validate(db); err != nil {
+		PrintWarning("Validation failed: %v\n", err)
+		PrintInfo("The changes of %s are not (completely) in place. Rerun it if it is idempotent, or restore the backup.\n", migrationID)
+		return
+	}
+	PrintSuccess("Validation passed\n")
+	PrintInfo("The changes of %s are in place. Rerunning it completes the recovery if it is idempotent.\n", migrationID)
+}
+
+// recoverRepair reconciles the applied migrations and the version with the history
+func recoverRepair(schemaManager *migrate.SchemaManager, registry *migrate.MigrationRegistry) error {
+	plan, err := schemaManager.PlanRepair(migrate.RepairReconcile)
+	if err != nil {
+		return fmt.Errorf("failed to plan repair: %w", err)
+	}
+	if plan.Empty() {
+		PrintInfo("Nothing to repair\n")
+		return nil
+	}
+	if err := schemaManager.ApplyRepair(plan, registry); err != nil {
+		return fmt.Errorf("failed to repair: %w", err)
+	}
+	PrintSuccess("Repaired %d migration(s), version %d → %d\n", countRepaired(plan), plan.FromVersion, plan.ToVersion)
+	return nil
+}
+
+// promptRecoveryChoice asks whether to rerun the pending migrations, abandon the
+// interrupted migration or restore the backup, as far as steps offer them, and
+// returns the chosen step or "" to stop
+func promptRecoveryChoice(steps []migrate.RecoveryStep) migrate.RecoveryStep {
+	offered := make(map[migrate.RecoveryStep]bool)
+	for _, step := range steps {
+		offered[step] = true
+	}
+
+	for {
+		choices := []string{"[r]erun the pending migrations"}
+		if offered[migrate.RecoveryAbandon] {
+			choices = append(choices, "[a]bandon the partial run")
+		}
+		if offered[migrate.RecoveryRestore] {
+			choices = append(choices, "re[s]tore the backup")
+		}
+		if !offered[migrate.RecoveryRestore] {
+			fmt.Printf("\n%s, or [q]uit (no backup to restore): ", strings.Join(choices, ", "))
+		} else {
+			fmt.Printf("\n%s, or [q]uit: ", strings.Join(choices, ", "))
+		}
+
+		var response string
+		fmt.Scanln(&response)
+
+		switch strings.ToLower(response) {
+		case "r", "rerun":
+			return migrate.RecoveryRerun
+		case "a", "abandon":
+			if offered[migrate.RecoveryAbandon] {
+				return migrate.RecoveryAbandon
+			}
+		case "s", "restore":
+			if offered[migrate.RecoveryRestore] {
+				return migrate.RecoveryRestore
+			}
+		case "", "q", "quit":
+			return ""
+		}
+		PrintWarning("Unknown choice %q\n", response)
+	}
+}
+
+// recoverRerun marks the state clean and runs the pending migrations again. Like
+// force-clean, marking the state clean must be confirmed with the name of the
+// database directory, or confirmPhrase if given.
+func recoverRerun(db *pebble.DB, schemaManager *migrate.SchemaManager, config *GlobalConfig, noBackup bool, confirmPhrase string) error {
+	PrintWarning("Rerunning forces the database to clean state, bypassing the safety checks.\n")
+	confirmed, err := ConfirmPhrase("To force clean state, type the name of the database directory.",
+		DatabaseConfirmPhrase(config), confirmPhrase)
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		PrintInfo("Rerun cancelled.\n")
+		return nil
+	}
+
+	if err := schemaManager.ForceCleanState(); err != nil {
+		return fmt.Errorf("failed to mark state clean: %w", err)
+	}
+	PrintInfo("State marked clean\n")
+
+	planner := migrate.NewMigrationPlanner(migrate.GlobalRegistry, schemaManager)
+	plan, err := planner.PlanUpgrade()
+	if err != nil {
+		return fmt.Errorf("failed to create migration plan: %w", err)
+	}
+	if len(plan.Migrations) == 0 {
+		PrintSuccess("No pending migrations, recovery complete\n")
+		return nil
+	}
+
+	engine, _ := CreateMigrationEngine(db, config)
+	engine.SetVerbose(config.Verbose)
+	engine.SetBackupEnabled(!noBackup)
+	if err := ExecutePlan(engine, plan, config); err != nil {
+		PrintError("Rerun failed: %v\n", err)
+		return err
+	}
+	PrintSuccess("Recovery complete: %d migration(s) applied\n", len(plan.Migrations))
+	return nil
+}
+
+// recoverAbandon rolls back the chunks the interrupted migration committed
+func recoverAbandon(db *pebble.DB, config *GlobalConfig, migrationID string, noBackup bool) error {
+	engine, _ := CreateMigrationEngine(db, config)
+	engine.SetVerbose(config.Verbose)
+	engine.SetBackupEnabled(!noBackup)
+	if err := engine.AbandonMigration(migrationID, createProgressReporter(config.Verbose)); err != nil {
+		PrintError("Abandon failed: %v\n", err)
+		return err
+	}
+	PrintSuccess("Recovery complete: the partial run of %s was rolled back\n", migrationID)
+	PrintInfo("Run 'up' to apply it again from the start\n")
+	return nil
+}
+
+// recoverRestore restores a backup. The database must be closed.
+func recoverRestore(backupManager *migrate.BackupManager, registry *migrate.MigrationRegistry, backupPath string) error {
+	PrintWarning("This will completely replace the current database with %s\n", backupPath)
+	if !ConfirmAction("Do you want to proceed with the restore?") {
+		PrintInfo("Restore cancelled.\n")
+		return nil
+	}
+
+	backupManager.SetRegistry(registry)
+	report, err := backupManager.RestoreBackupWithReport(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+	PrintSuccess("Database restored successfully from backup!\n")
+	if len(report.Pending) > 0 {
+		PrintInfo("Run 'up' to reapply %d migration(s)\n", len(report.Pending))
+	}
+	return nil
+}
+
+// printRecoveryOutcome prints whether the state still needs recovery after the
+// executed steps
+func printRecoveryOutcome(schemaManager *migrate.SchemaManager, registry *migrate.MigrationRegistry) error {
+	diagnosis, err := schemaManager.DiagnoseRecovery(registry, nil)
+	if err != nil {
+		return fmt.Errorf("failed to inspect schema state: %w", err)
+	}
+	if diagnosis.NeedsRecovery() {
+		fmt.Printf("\n")
+		PrintWarning("The database still needs recovery (status %s). Run 'recover' again.\n", diagnosis.Status)
+		return nil
+	}
+	fmt.Printf("\n")
+	PrintSuccess("Recovery complete: the schema state is clean and consistent\n")
+	return nil
+}
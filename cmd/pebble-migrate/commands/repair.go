@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 	migrate "github.com/herenow/pebble-migrate"
@@ -14,23 +15,46 @@ func NewRepairCommand() *cobra.Command {
 		Short: "Repair inconsistencies in migration state",
 		Long: `Repair inconsistencies between AppliedMigrations and MigrationHistory.
 
-This command fixes the error:
+This command fixes errors such as:
   "migration X marked as applied but no successful record in history"
+  "migration X appears in history as successful but not marked as applied"
 
 This can happen when:
 - A database was initialized with an older version of the migration system
 - The schema state was manually modified
-- A bug caused inconsistent state
+- A downgrade or a bug left an inconsistent state
 
-The repair creates synthetic history records for any migrations that are
-marked as applied but don't have corresponding history entries.
+The --mode flag selects which side is trusted:
+  applied    Add synthetic history records for migrations that are marked as
+             applied without a successful history record (default)
+  history    Rebuild the applied migrations from the successful history records
+             that were not rolled back
+  reconcile  Trust the history for migrations it records and the applied
+             migrations for the others
+
+Single migrations can be resolved differently, with --interactive to be asked
+for each one or with --resolve <migration_id>=<resolution> (or all=<resolution>):
+  history    Make the applied migrations match the history
+  applied    Make the history match the applied migrations
+  unknown    Leave the discrepancy for manual intervention
+  validate   Run the migration's Validate function: trust the side claiming it
+             is applied if it passes, the other side if it fails
+
+The changes are shown as a diff before they are applied. The current version is
+then recomputed from the applied migrations and the state is marked clean.
 
 Examples:
   pebble-migrate repair -d /path/to/db
-  pebble-migrate repair -d /path/to/db --dry-run`,
+  pebble-migrate repair -d /path/to/db --mode reconcile --dry-run
+  pebble-migrate repair -d /path/to/db --interactive
+  pebble-migrate repair -d /path/to/db --resolve all=validate --resolve 1754917300_b=history`,
 		RunE: runRepairCommand,
 	}
 
+	cmd.Flags().String("mode", string(migrate.RepairFromApplied), "What to trust: applied, history or reconcile")
+	cmd.Flags().Bool("interactive", false, "Choose the resolution of each migration")
+	cmd.Flags().StringArray("resolve", nil, "Resolution of a migration as <migration_id>=<resolution>, or all=<resolution>")
+
 	return cmd
 }
 
@@ -40,14 +64,28 @@ func runRepairCommand(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	modeFlag, _ := cmd.Flags().GetString("mode")
+	mode := migrate.RepairMode(modeFlag)
+	switch mode {
+	case migrate.RepairFromApplied, migrate.RepairFromHistory, migrate.RepairReconcile:
+	default:
+		return fmt.Errorf("unknown repair mode %q (expected applied, history or reconcile)", modeFlag)
+	}
+	interactive, _ := cmd.Flags().GetBool("interactive")
+	resolveFlags, _ := cmd.Flags().GetStringArray("resolve")
+	resolutions, err := parseResolutions(resolveFlags)
+	if err != nil {
+		return err
+	}
+
 	// Open database (not read-only unless dry-run)
-	db, err := OpenDatabase(config.DatabasePath, config.DryRun)
+	db, err := OpenDatabase(config, config.DryRun)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
-	schemaManager := migrate.NewSchemaManager(db)
+	schemaManager := NewSchemaManager(db, config)
 	registry := migrate.GlobalRegistry
 
 	fmt.Printf("=== Migration State Repair ===\n\n")
@@ -61,32 +99,53 @@ func runRepairCommand(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Current Version: %d (%s)\n", currentSchema.CurrentVersion, migrate.FormatVersionAsTime(currentSchema.CurrentVersion))
 	fmt.Printf("Applied Migrations: %d\n", len(currentSchema.AppliedMigrations))
 	fmt.Printf("History Records: %d\n", len(currentSchema.MigrationHistory))
-	fmt.Printf("Status: %s\n\n", currentSchema.Status)
+	fmt.Printf("Status: %s\n", currentSchema.Status)
+	fmt.Printf("Mode: %s\n\n", mode)
 
 	// Check what needs repair
-	successfulInHistory := make(map[string]bool)
-	for _, record := range currentSchema.MigrationHistory {
-		if record.Success && !isRollbackRecord(record.ID) {
-			successfulInHistory[record.ID] = true
-		}
+	plan, err := schemaManager.PlanRepair(mode)
+	if err != nil {
+		return fmt.Errorf("failed to plan repair: %w", err)
 	}
 
-	var missingHistory []string
-	for migrationID := range currentSchema.AppliedMigrations {
-		if !successfulInHistory[migrationID] {
-			missingHistory = append(missingHistory, migrationID)
+	// Resolve single migrations, from the flags first
+	for i, item := range plan.Items {
+		resolution, ok := resolutions[item.MigrationID]
+		if !ok {
+			resolution, ok = resolutions["all"]
+		}
+		if !ok {
+			continue
+		}
+		if _, err := schemaManager.ResolveRepair(plan, i, resolution, registry); err != nil {
+			return err
 		}
 	}
+	if interactive && len(plan.Items) > 0 {
+		PrintInfo("Choose how to resolve each migration:\n\n")
+		for i := range plan.Items {
+			if err := promptResolution(schemaManager, plan, i, registry); err != nil {
+				return err
+			}
+		}
+		fmt.Println()
+	}
 
-	if len(missingHistory) == 0 {
-		PrintSuccess("No repairs needed - migration state is consistent\n")
+	if plan.Empty() {
+		remaining, err := printRemainingDiscrepancies(schemaManager)
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			PrintSuccess("No repairs needed - migration state is consistent\n")
+		} else {
+			PrintInfo("Nothing to repair in %s mode\n", mode)
+		}
 		return nil
 	}
 
-	PrintWarning("Found %d migrations missing history records:\n", len(missingHistory))
-	for _, id := range missingHistory {
-		fmt.Printf("  - %s\n", id)
-	}
+	PrintWarning("Repair changes:\n")
+	printRepairDiff(plan)
 	fmt.Println()
 
 	if config.DryRun {
@@ -101,14 +160,15 @@ func runRepairCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	// Perform repair
-	repaired, err := schemaManager.RepairMissingHistory(registry)
-	if err != nil {
+	if err := schemaManager.ApplyRepair(plan, registry); err != nil {
 		return fmt.Errorf("repair failed: %w", err)
 	}
-
-	PrintSuccess("Repaired %d migration records:\n", len(repaired))
-	for _, id := range repaired {
-		fmt.Printf("  - %s\n", id)
+	PrintSuccess("Repaired %d migrations\n", countRepaired(plan))
+	if plan.FromVersion != plan.ToVersion {
+		PrintSuccess("Current version set to %d (%s)\n", plan.ToVersion, migrate.FormatVersionAsTime(plan.ToVersion))
+	}
+	if _, err := printRemainingDiscrepancies(schemaManager); err != nil {
+		return err
 	}
 
 	// Validate after repair
@@ -122,3 +182,103 @@ func runRepairCommand(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// printRepairDiff prints the changes of a repair plan
+func printRepairDiff(plan *migrate.RepairPlan) {
+	for _, item := range plan.Items {
+		switch item.Action {
+		case migrate.RepairAddHistory:
+			fmt.Printf("  + history  %s (%s)\n", item.MigrationID, item.Kind)
+		case migrate.RepairAddRollback:
+			fmt.Printf("  + rollback %s (%s)\n", item.MigrationID, item.Kind)
+		case migrate.RepairMarkApplied:
+			fmt.Printf("  + applied  %s (%s)\n", item.MigrationID, item.Kind)
+		case migrate.RepairUnmarkApplied:
+			fmt.Printf("  - applied  %s (%s)\n", item.MigrationID, item.Kind)
+		case migrate.RepairSkip:
+			fmt.Printf("  ? skipped  %s (%s)\n", item.MigrationID, item.Kind)
+		}
+	}
+	if plan.FromVersion != plan.ToVersion {
+		fmt.Printf("  ~ version  %d -> %d\n", plan.FromVersion, plan.ToVersion)
+	}
+}
+
+// printRemainingDiscrepancies lists the discrepancies a repair in the selected
+// mode does not resolve and returns their number
+func printRemainingDiscrepancies(schemaManager *migrate.SchemaManager) (int, error) {
+	report, err := schemaManager.CheckVersion()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check version: %w", err)
+	}
+	for _, d := range report.Discrepancies {
+		PrintWarning("Needs manual intervention: %s\n", d.Message)
+	}
+	return len(report.Discrepancies), nil
+}
+
+// parseResolutions parses the --resolve flags into resolutions by migration ID
+func parseResolutions(flags []string) (map[string]migrate.RepairResolution, error) {
+	resolutions := make(map[string]migrate.RepairResolution, len(flags))
+	for _, flag := range flags {
+		id, value, ok := strings.Cut(flag, "=")
+		resolution := migrate.RepairResolution(value)
+		switch resolution {
+		case migrate.ResolveTrustHistory, migrate.ResolveTrustApplied, migrate.ResolveUnknown, migrate.ResolveValidate:
+		default:
+			ok = false
+		}
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid --resolve %q (expected <migration_id>=history|applied|unknown|validate)", flag)
+		}
+		resolutions[id] = resolution
+	}
+	return resolutions, nil
+}
+
+// promptResolution asks for the resolution of the i-th item of a plan
+func promptResolution(schemaManager *migrate.SchemaManager, plan *migrate.RepairPlan, i int, registry *migrate.MigrationRegistry) error {
+	item := plan.Items[i]
+	for {
+		fmt.Printf("%s\n  Proposed: %s\n", item.Message, item.Action)
+		fmt.Printf("  Trust [h]istory, trust [a]pplied, mark [u]nknown, run [v]alidate, or Enter to keep: ")
+
+		var response string
+		fmt.Scanln(&response)
+
+		var resolution migrate.RepairResolution
+		switch strings.ToLower(response) {
+		case "":
+			return nil
+		case "h", "history":
+			resolution = migrate.ResolveTrustHistory
+		case "a", "applied":
+			resolution = migrate.ResolveTrustApplied
+		case "u", "unknown":
+			resolution = migrate.ResolveUnknown
+		case "v", "validate":
+			resolution = migrate.ResolveValidate
+		default:
+			PrintWarning("Unknown choice %q\n", response)
+			continue
+		}
+
+		action, err := schemaManager.ResolveRepair(plan, i, resolution, registry)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  -> %s\n", action)
+		return nil
+	}
+}
+
+// countRepaired returns the number of items of a plan that change the state
+func countRepaired(plan *migrate.RepairPlan) int {
+	count := 0
+	for _, item := range plan.Items {
+		if item.Action != migrate.RepairSkip {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewReportCommand creates the report command
+func NewReportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Write a review report of the migrations added since a version",
+		Long: `Write a single Markdown or JSON report of the migrations added since a
+version, to attach to the review of a release:
+
+  Plan         The migrations in the order an upgrade applies them, with their
+               owner, tags and whether they validate and can be rerun
+  Rollback     Whether each migration has a Down function, is rolled back
+               automatically from its recorded writes, or not at all
+  Dependencies A Mermaid graph of the dependencies, and the waves the
+               migrations run in with parallelism
+  Lint         Missing description, owner or runbook URL, shared timestamps and
+               key prefix conflicts
+  Simulation   With --database, the pending upgrade of the database is run
+               against a throwaway copy: the duration and key changes of every
+               migration, and the size of the backup taken before it
+
+The report only describes problems; the command does not fail on them. The
+database is optional and is not modified.
+
+Examples:
+  pebble-migrate report --since 1754917200 > review.md
+  pebble-migrate report --since 1754917200 -d /path/to/staging-copy --output review.json`,
+		Args: cobra.NoArgs,
+		RunE: runReportCommand,
+	}
+
+	cmd.Flags().Int64("since", 0, "Report the migrations with a version above this one (default all)")
+	cmd.Flags().String("format", "", "Report format: markdown or json (default markdown, or json for a .json file)")
+	cmd.Flags().StringP("output", "o", "", "File to write (default standard output)")
+
+	return cmd
+}
+
+func runReportCommand(cmd *cobra.Command, args []string) error {
+	since, _ := cmd.Flags().GetInt64("since")
+	format, _ := cmd.Flags().GetString("format")
+	output, _ := cmd.Flags().GetString("output")
+	dbPath, _ := cmd.Flags().GetString("database")
+	if format == "" {
+		format = "markdown"
+		if strings.EqualFold(filepath.Ext(output), ".json") {
+			format = "json"
+		}
+	}
+	if format != "markdown" && format != "json" {
+		return fmt.Errorf("unknown format %q: use markdown or json", format)
+	}
+
+	var engine *migrate.MigrationEngine
+	if dbPath != "" {
+		config, err := GetGlobalConfig(cmd)
+		if err != nil {
+			return err
+		}
+		db, err := OpenDatabase(config, true)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+		if _, _, _, err := CreateMigrationServices(db, config); err != nil {
+			return err
+		}
+		engine, _ = CreateMigrationEngine(db, config)
+	} else {
+		scriptsDir, _ := cmd.Flags().GetString("scripts-dir")
+		pluginsDir, _ := cmd.Flags().GetString("plugins-dir")
+		discovery := migrate.NewDiscoveryService(scriptsDir, migrate.GlobalRegistry)
+		discovery.SetPluginDir(pluginsDir)
+		if err := discovery.LoadMigrations(); err != nil {
+			return fmt.Errorf("failed to load migrations: %w", err)
+		}
+	}
+
+	report, err := migrate.GlobalRegistry.Review(since)
+	if err != nil {
+		return err
+	}
+	if engine != nil {
+		if err := engine.SimulateReview(report); err != nil {
+			return fmt.Errorf("failed to simulate: %w", err)
+		}
+	}
+
+	var data []byte
+	if format == "json" {
+		if data, err = json.MarshalIndent(report, "", "  "); err != nil {
+			return fmt.Errorf("failed to marshal report: %w", err)
+		}
+		data = append(data, '\n')
+	} else {
+		data = []byte(report.Markdown())
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	PrintSuccess("Report of %d migrations written to %s\n", len(report.Migrations), output)
+	return nil
+}
@@ -47,14 +47,17 @@ func runRerunCommand(cmd *cobra.Command, args []string) error {
 
 	// Open database (read-only for dry-run, read-write otherwise)
 	readOnly := config.DryRun
-	db, err := OpenDatabase(config.DatabasePath, readOnly)
+	db, err := OpenDatabase(config, readOnly)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
 	// Create migration services
-	schemaManager, planner, discovery := CreateMigrationServices(db)
+	schemaManager, planner, discovery, err := CreateMigrationServices(db, config)
+	if err != nil {
+		return err
+	}
 
 	// Validate migrations
 	if err := discovery.ValidateMigrations(); err != nil {
@@ -117,7 +120,7 @@ func runRerunCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	// Create migration engine with backup support
-	engine, _ := CreateMigrationEngine(db, config.DatabasePath)
+	engine, _ := CreateMigrationEngine(db, config)
 	engine.SetDryRun(config.DryRun)
 	engine.SetVerbose(config.Verbose)
 
@@ -130,9 +133,8 @@ func runRerunCommand(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Execute rerun plan with progress callback
-	progressCallback := createProgressCallback(config.Verbose)
-	err = engine.ExecutePlan(plan, progressCallback)
+	// Execute rerun plan (against a throwaway copy in dry-run mode)
+	err = ExecutePlan(engine, plan, config)
 	if err != nil {
 		PrintError("Rerun failed: %v\n", err)
 		return err
@@ -160,18 +162,26 @@ func runFirstTimeApplication(targetMigration *migrate.Migration, config *GlobalC
 	}
 
 	// Create a simple single-migration plan with backup support
-	engine, _ := CreateMigrationEngine(db, config.DatabasePath)
+	engine, _ := CreateMigrationEngine(db, config)
 	engine.SetVerbose(config.Verbose)
 
 	// Mark migration as started
-	if err := schemaManager.MarkMigrationStarted(); err != nil {
+	if err := schemaManager.MarkMigrationStarted(targetMigration.ID); err != nil {
 		return fmt.Errorf("failed to mark migration as started: %w", err)
 	}
 
-	// Execute the migration
+	// Execute the migration, recording the inverse of a migration without Down
+	up := targetMigration.Up
+	log := migrate.NewOpLog(targetMigration.ID)
+	if targetMigration.HasAutomaticDown() {
+		up = func(db *pebble.DB) error {
+			return targetMigration.Apply(migrate.NewWriter(db, log))
+		}
+	}
+
 	start := time.Now()
-	if err := targetMigration.Up(db); err != nil {
-		if markErr := schemaManager.MarkMigrationFailed(targetMigration.ID, targetMigration.Description, err); markErr != nil {
+	if err := up(db); err != nil {
+		if markErr := schemaManager.MarkMigrationFailed(targetMigration.ID, targetMigration.Description, time.Since(start), err); markErr != nil {
 			return fmt.Errorf("migration failed and failed to mark as failed: %w (original error: %v)", markErr, err)
 		}
 		return fmt.Errorf("migration failed: %w", err)
@@ -186,6 +196,12 @@ func runFirstTimeApplication(targetMigration *migrate.Migration, config *GlobalC
 
 	duration := time.Since(start)
 
+	if targetMigration.HasAutomaticDown() {
+		if err := schemaManager.SaveUndoLog(log); err != nil {
+			return err
+		}
+	}
+
 	// Update schema after migration
 	if err := schemaManager.UpdateSchemaAfterMigration(targetMigration.ID, targetMigration.Version, targetMigration.Description, duration); err != nil {
 		return fmt.Errorf("failed to update schema after migration: %w", err)
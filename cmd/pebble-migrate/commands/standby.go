@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// NewStandbyCommand creates the standby command
+func NewStandbyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "standby",
+		Short: "Keep a warm standby copy of the database migrated",
+		Long: `Manage a warm standby: a copy of the database, e.g. a restored backup or a
+checkpoint, that is migrated in lockstep with it so it can be promoted at
+failover without migrating.
+
+Pass --standby <dir> to up, down, rerun and recover to apply every executed
+plan to the standby too. A standby that cannot be migrated is reported as a
+warning; bring it back in line with 'standby sync'.`,
+	}
+
+	cmd.AddCommand(NewStandbyCreateCommand())
+	cmd.AddCommand(NewStandbySyncCommand())
+
+	return cmd
+}
+
+// NewStandbyCreateCommand creates the standby create subcommand
+func NewStandbyCreateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "create <dir>",
+		Short: "Create a standby as a checkpoint of the database",
+		Long: `Create a warm standby in a new directory as a checkpoint of the database.
+Table files are hard-linked where the filesystem allows it, so place the
+standby on another volume to survive the loss of the database's.
+
+Examples:
+  pebble-migrate standby create /standby/db -d /data/db`,
+		Args: cobra.ExactArgs(1),
+		RunE: runStandbyCreateCommand,
+	}
+}
+
+func runStandbyCreateCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+	path, err := standbyPath(config, args[0])
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(config, false)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	engine, _ := CreateMigrationEngine(db, config)
+	if err := engine.CreateStandby(path); err != nil {
+		return err
+	}
+	PrintSuccess("Standby created: %s\n", path)
+	return nil
+}
+
+// NewStandbySyncCommand creates the standby sync subcommand
+func NewStandbySyncCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sync <dir>",
+		Short: "Bring a standby in line with the database",
+		Long: `Migrate a standby to the migrations applied to the database: migrations only
+the standby has applied are rolled back, then the ones it lacks are applied.
+The standby must be in a clean state and belong to the same environment. No
+backup of the standby is taken.
+
+Examples:
+  pebble-migrate standby sync /standby/db -d /data/db`,
+		Args: cobra.ExactArgs(1),
+		RunE: runStandbySyncCommand,
+	}
+}
+
+func runStandbySyncCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+	path, err := standbyPath(config, args[0])
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(config, true)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if _, _, _, err := CreateMigrationServices(db, config); err != nil {
+		return err
+	}
+	engine, _ := CreateMigrationEngine(db, config)
+	if err := engine.SyncStandby(path, createProgressReporter(config.Verbose)); err != nil {
+		return err
+	}
+	PrintSuccess("Standby %s is in sync with the database\n", path)
+	return nil
+}
+
+// standbyPath returns the absolute path of a standby, which must not be the
+// database itself
+func standbyPath(config *GlobalConfig, dir string) (string, error) {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path for standby: %w", err)
+	}
+	if path == config.DatabasePath {
+		return "", fmt.Errorf("the standby cannot be the database itself")
+	}
+	return path, nil
+}
@@ -0,0 +1,561 @@
+package commands
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// NewStateCommand creates the state command
+func NewStateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Inspect the stored schema state",
+		Long: `Inspect the schema state stored under the schema key.
+
+The schema state is written as JSON by default, or as Protocol Buffers with
+--schema-encoding proto. Both encodings are always read, and the state is
+converted on the next write after switching.
+
+Before an operation replaces or repairs the state (force-clean, repair, import,
+state seed, state rollback), a snapshot of it is kept in the database. The last 10
+snapshots are kept; "state rollback" restores one.`,
+	}
+
+	cmd.AddCommand(NewStateShowCommand())
+	cmd.AddCommand(NewStateExportCommand())
+	cmd.AddCommand(NewStateAuditCommand())
+	cmd.AddCommand(NewStateSnapshotsCommand())
+	cmd.AddCommand(NewStateRollbackCommand())
+	cmd.AddCommand(NewStateEnvironmentCommand())
+	cmd.AddCommand(NewStateSeedCommand())
+
+	return cmd
+}
+
+// NewStateShowCommand creates the state show subcommand
+func NewStateShowCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the stored schema state with size and decode diagnostics",
+		Long: `Show how the schema state is stored: its key, encoding, size and revision,
+the size of the history records, and why the state does not decode, if it does
+not. Use it to debug corrupt or oversized schema state. The command fails if
+the state or a history record does not decode.
+
+With --raw the stored value is printed as is (JSON), or as a hex dump (proto).
+
+Examples:
+  pebble-migrate state show -d /path/to/db
+  pebble-migrate state show -d /path/to/db --raw`,
+		RunE: runStateShowCommand,
+	}
+
+	cmd.Flags().Bool("raw", false, "Also print the stored value")
+
+	return cmd
+}
+
+func runStateShowCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	raw, _ := cmd.Flags().GetBool("raw")
+
+	db, err := OpenDatabase(config, true)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	info, err := NewSchemaManager(db, config).InspectSchemaState()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("=== Schema State ===\n")
+	fmt.Printf("Key: %s\n", info.Key)
+	if !info.Exists {
+		PrintInfo("The schema key does not exist (uninitialized database)\n")
+	} else {
+		format := string(info.Encoding)
+		if info.Legacy {
+			format += " (legacy format with inline history, converted on the next write)"
+		}
+		fmt.Printf("Encoding: %s\n", format)
+		fmt.Printf("Size: %d bytes\n", len(info.Raw))
+		if info.Chunks > 0 {
+			fmt.Printf("Chunks: %d\n", info.Chunks)
+		}
+	}
+	if info.Version != nil {
+		fmt.Printf("Revision: %d\n", info.Version.Revision)
+		fmt.Printf("Status: %s\n", info.Version.Status)
+		fmt.Printf("Current version: %d (%s)\n", info.Version.CurrentVersion, migrate.FormatVersionAsTime(info.Version.CurrentVersion))
+		fmt.Printf("Applied migrations: %d\n", len(info.Version.AppliedMigrations))
+		if info.Version.Environment != "" {
+			fmt.Printf("Environment: %s\n", info.Version.Environment)
+		}
+		if len(info.Version.MigrationHistory) > 0 {
+			fmt.Printf("Inline history records: %d\n", len(info.Version.MigrationHistory))
+		}
+	}
+	fmt.Printf("History records: %d (%d bytes)\n", info.HistoryRecords, info.HistoryBytes)
+
+	if raw && info.Exists {
+		fmt.Printf("\n=== Raw Value ===\n")
+		if info.Encoding == migrate.SchemaEncodingProto {
+			fmt.Print(hex.Dump(info.Raw))
+		} else {
+			fmt.Printf("%s\n", info.Raw)
+		}
+	}
+
+	if info.DecodeError == nil && len(info.CorruptHistory) == 0 {
+		fmt.Println()
+		PrintSuccess("Schema state decodes cleanly\n")
+		return nil
+	}
+
+	fmt.Printf("\n=== Diagnostics ===\n")
+	if info.DecodeError != nil {
+		PrintError("Schema state does not decode: %v\n", info.DecodeError)
+	}
+	for _, key := range info.CorruptHistory {
+		PrintError("History record %s does not decode\n", key)
+	}
+	return fmt.Errorf("%w: %s", migrate.ErrCorruptSchemaState, info.Key)
+}
+
+// NewStateExportCommand creates the state export subcommand
+func NewStateExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the schema state, including the history, as JSON",
+		Long: `Export the schema state, including the full migration history, as indented
+JSON. The output is the same for both schema encodings, so it is the readable
+form of a proto-encoded state.
+
+Examples:
+  pebble-migrate state export -d /path/to/db
+  pebble-migrate state export -d /path/to/db --output state.json`,
+		RunE: runStateExportCommand,
+	}
+
+	cmd.Flags().StringP("output", "o", "", "Write the JSON to this file instead of stdout")
+
+	return cmd
+}
+
+func runStateExportCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	output, _ := cmd.Flags().GetString("output")
+
+	db, err := OpenDatabase(config, true)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	schemaManager := NewSchemaManager(db, config)
+	schema, err := schemaManager.GetSchemaVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema state: %w", err)
+	}
+	data = append(data, '\n')
+
+	if output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+	PrintSuccess("Exported schema state to %s\n", output)
+	return nil
+}
+
+// NewStateAuditCommand creates the state audit subcommand
+func NewStateAuditCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show the backups, restores and fixes recorded in the database",
+		Long: `Show the audit history: the backups taken of the database, the restores
+into it, with the backup path and checksum, and the fix scripts applied to it.
+Together with the migration history it shows every operation that changed the
+database. With --verbose, the inverse script of every fix is shown.
+
+A backup is recorded in the database it was taken of, after the backup, so a
+backup does not contain its own record. A restore is recorded in the restored
+database. Backups taken with the database open read-only are not recorded.
+
+Examples:
+  pebble-migrate state audit -d /path/to/db`,
+		RunE: runStateAuditCommand,
+	}
+
+	return cmd
+}
+
+func runStateAuditCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(config, true)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	records, err := NewSchemaManager(db, config).AuditHistory()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		PrintInfo("No backups, restores or fixes recorded\n")
+		return nil
+	}
+
+	fmt.Printf("=== Audit History ===\n\n")
+	for _, record := range records {
+		fmt.Printf("%s  %-7s  version %d\n", record.At.Format("2006-01-02 15:04:05"), record.Type, record.Version)
+		if record.Type == migrate.AuditFix {
+			fmt.Printf("  Script: %s\n", record.Path)
+			fmt.Printf("  Keys changed: %d\n", record.Keys)
+		} else {
+			fmt.Printf("  Backup: %s\n", record.Path)
+		}
+		if record.Checksum != "" {
+			fmt.Printf("  Checksum: %s\n", record.Checksum)
+		}
+		if record.Description != "" {
+			fmt.Printf("  Description: %s\n", record.Description)
+		}
+		if config.Verbose && record.Inverse != nil {
+			inverse, err := yaml.Marshal(record.Inverse)
+			if err == nil {
+				fmt.Printf("  Inverse:\n    %s\n", strings.ReplaceAll(strings.TrimSpace(string(inverse)), "\n", "\n    "))
+			}
+		}
+	}
+	return nil
+}
+
+// NewStateSnapshotsCommand creates the state snapshots subcommand
+func NewStateSnapshotsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshots",
+		Short: "List the stored snapshots of the schema state",
+		Long: `List the snapshots of the schema state, newest first, with the operation
+each was taken before. Restore one with "state rollback --snapshot <n>".
+
+Examples:
+  pebble-migrate state snapshots -d /path/to/db`,
+		RunE: runStateSnapshotsCommand,
+	}
+
+	return cmd
+}
+
+func runStateSnapshotsCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(config, true)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	snapshots, err := NewSchemaManager(db, config).SchemaSnapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		PrintInfo("No schema snapshots stored\n")
+		return nil
+	}
+
+	fmt.Printf("=== Schema Snapshots ===\n\n")
+	for i, snapshot := range snapshots {
+		printSnapshot(i+1, snapshot)
+	}
+	return nil
+}
+
+// NewStateRollbackCommand creates the state rollback subcommand
+func NewStateRollbackCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Restore the schema state from a snapshot",
+		Long: `Restore the schema state, including the history, from a snapshot taken before
+an operation that replaced or repaired it. Use it to undo an accidental
+force-clean, a bad repair or import. Only the schema state is restored, not the
+data; restore a backup for that.
+
+The newest snapshot is restored unless --snapshot selects another one, numbered
+as listed by "state snapshots". The replaced state is snapshotted first, so a
+rollback can be undone in turn.
+
+Examples:
+  pebble-migrate state rollback -d /path/to/db
+  pebble-migrate state rollback -d /path/to/db --snapshot 3 --dry-run`,
+		RunE: runStateRollbackCommand,
+	}
+
+	cmd.Flags().Int("snapshot", 1, "Number of the snapshot to restore, newest first")
+	cmd.Flags().Bool("force", false, "Skip confirmation prompt")
+
+	return cmd
+}
+
+func runStateRollbackCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	number, _ := cmd.Flags().GetInt("snapshot")
+	force, _ := cmd.Flags().GetBool("force")
+
+	db, err := OpenDatabase(config, config.DryRun)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	schemaManager := NewSchemaManager(db, config)
+	snapshots, err := schemaManager.SchemaSnapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("no schema snapshots stored")
+	}
+	if number < 1 || number > len(snapshots) {
+		return fmt.Errorf("snapshot %d does not exist (%d stored)", number, len(snapshots))
+	}
+	snapshot := snapshots[number-1]
+
+	current, err := schemaManager.GetSchemaVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	fmt.Printf("=== Schema State Rollback ===\n\n")
+	fmt.Printf("Current: version %d, %d applied, %d history records, %s\n",
+		current.CurrentVersion, len(current.AppliedMigrations), len(current.MigrationHistory), current.Status)
+	fmt.Printf("Restore: ")
+	printSnapshot(number, snapshot)
+	fmt.Println()
+
+	if config.DryRun {
+		PrintInfo("DRY RUN: Would restore the schema state from snapshot %d\n", number)
+		return nil
+	}
+
+	if !force && !ConfirmAction("Restore the schema state from this snapshot?") {
+		PrintInfo("Rollback cancelled.\n")
+		return nil
+	}
+
+	if err := schemaManager.RestoreSnapshot(snapshot); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	PrintSuccess("Schema state restored from the snapshot of %s\n", snapshot.TakenAt.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// NewStateEnvironmentCommand creates the state environment subcommand
+func NewStateEnvironmentCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "environment [name]",
+		Short: "Show or change the environment the database is stamped with",
+		Long: `Show the environment the schema state is stamped with, or stamp it with a
+new one. Commands run with --environment refuse to change a database stamped
+with another environment, and stamp an unstamped one; applications do the same
+with StartupOptions.Environment.
+
+Run this without --environment to restamp a database, e.g. a production copy
+restored into staging. --clear removes the stamp.
+
+Examples:
+  pebble-migrate state environment -d /path/to/db
+  pebble-migrate state environment staging -d /path/to/db
+  pebble-migrate state environment --clear -d /path/to/db`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runStateEnvironmentCommand,
+	}
+
+	cmd.Flags().Bool("clear", false, "Remove the environment stamp")
+	cmd.Flags().Bool("force", false, "Skip confirmation prompt")
+
+	return cmd
+}
+
+func runStateEnvironmentCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	remove, _ := cmd.Flags().GetBool("clear")
+	force, _ := cmd.Flags().GetBool("force")
+	if remove && len(args) > 0 {
+		return fmt.Errorf("--clear takes no environment name")
+	}
+	change := remove || len(args) > 0
+
+	db, err := OpenDatabase(config, !change || config.DryRun)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	schemaManager := NewSchemaManager(db, config)
+	current, err := schemaManager.GetEnvironment()
+	if err != nil {
+		return err
+	}
+	if !change {
+		if current == "" {
+			PrintInfo("The database is not stamped with an environment\n")
+		} else {
+			fmt.Printf("Environment: %s\n", current)
+		}
+		return nil
+	}
+
+	env := ""
+	if len(args) > 0 {
+		env = args[0]
+	}
+	if env == current {
+		PrintInfo("Nothing to change\n")
+		return nil
+	}
+	if config.DryRun {
+		PrintInfo("DRY RUN: Would change the environment from %q to %q\n", current, env)
+		return nil
+	}
+	if current != "" && !force && !ConfirmAction(fmt.Sprintf("The database belongs to environment %q. Change it to %q?", current, env)) {
+		PrintInfo("Change cancelled.\n")
+		return nil
+	}
+
+	if err := schemaManager.SetEnvironment(env); err != nil {
+		return fmt.Errorf("failed to stamp environment: %w", err)
+	}
+	if env == "" {
+		PrintSuccess("Environment stamp removed\n")
+	} else {
+		PrintSuccess("Database stamped with environment %s\n", env)
+	}
+	return nil
+}
+
+// printSnapshot prints a one-line summary of a snapshot
+func printSnapshot(number int, snapshot migrate.SchemaSnapshot) {
+	fmt.Printf("[%d] %s  before %s\n", number, snapshot.TakenAt.Format("2006-01-02 15:04:05"), snapshot.Reason)
+	if state := snapshot.State; state != nil {
+		fmt.Printf("    version %d, %d applied, %d history records, %s\n",
+			state.CurrentVersion, len(state.AppliedMigrations), len(state.MigrationHistory), state.Status)
+	}
+}
+
+// NewStateSeedCommand creates the state seed command
+func NewStateSeedCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Seed the schema state from a list of applied migration IDs",
+		Long: `Seed the schema state so that exactly the listed migrations are marked as
+applied, e.g. when adopting pebble-migrate on a database where the
+transformations that were already performed are known.
+
+The file holds one migration ID per line; blank lines and lines starting with
+# are ignored. Every ID must match a registered migration (former IDs registered
+as aliases are accepted), and the dependencies of listed migrations must be
+listed too. No migration code is executed; only the schema state is written.
+
+Examples:
+  pebble-migrate state seed -d /path/to/db --applied-file applied.txt
+  pebble-migrate state seed -d /path/to/db --applied-file applied.txt --force`,
+		RunE: runStateSeedCommand,
+	}
+
+	cmd.Flags().String("applied-file", "", "File listing applied migration IDs, one per line")
+	cmd.Flags().Bool("force", false, "Replace a schema state that already has applied migrations")
+	_ = cmd.MarkFlagRequired("applied-file")
+
+	return cmd
+}
+
+func runStateSeedCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	appliedFile, _ := cmd.Flags().GetString("applied-file")
+	force, _ := cmd.Flags().GetBool("force")
+
+	f, err := os.Open(appliedFile)
+	if err != nil {
+		return fmt.Errorf("failed to open applied file: %w", err)
+	}
+	ids, err := migrate.ParseAppliedIDs(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse applied file: %w", err)
+	}
+
+	if config.DryRun {
+		PrintInfo("DRY RUN: Would seed %d applied migrations from %s\n", len(ids), appliedFile)
+		return nil
+	}
+
+	db, err := OpenDatabase(config, false)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if force && !ConfirmAction("This replaces the existing migration state. Continue?") {
+		PrintInfo("Seed cancelled.\n")
+		return nil
+	}
+
+	schemaManager := NewSchemaManager(db, config)
+	seeded, err := schemaManager.InitializeFromAppliedList(migrate.GlobalRegistry, ids, migrate.ImportOptions{Source: appliedFile, Force: force})
+	if err != nil {
+		return fmt.Errorf("seed failed: %w", err)
+	}
+
+	PrintSuccess("Seeded %d applied migrations from %s\n", len(seeded), appliedFile)
+	for _, id := range seeded {
+		VerbosePrintf(config, "  - %s\n", id)
+	}
+
+	return nil
+}
@@ -1,8 +1,13 @@
 package commands
 
 import (
+	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/spf13/cobra"
 	migrate "github.com/herenow/pebble-migrate"
@@ -19,6 +24,8 @@ This command provides a comprehensive overview of your database migration state,
 including:
 - Current schema version
 - Migration status (clean, dirty, migrating)
+- Progress of chunked migrations that are in flight or were interrupted
+  (cursor, percent, chunks done and the time of the last chunk)
 - List of applied migrations with timestamps
 - List of pending migrations
 - Migration history and statistics`,
@@ -35,14 +42,17 @@ func runStatusCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	// Open database in read-only mode
-	db, err := OpenDatabase(config.DatabasePath, true)
+	db, err := OpenDatabase(config, true)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
 	// Create migration services
-	schemaManager, planner, discovery := CreateMigrationServices(db)
+	schemaManager, planner, discovery, err := CreateMigrationServices(db, config)
+	if err != nil {
+		return err
+	}
 
 	// Validate migrations
 	if err := discovery.ValidateMigrations(); err != nil {
@@ -61,10 +71,24 @@ func runStatusCommand(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create migration plan: %w", err)
 	}
 
+	inFlight, err := schemaManager.ListMigrationProgress()
+	if err != nil {
+		return fmt.Errorf("failed to get migration progress: %w", err)
+	}
+
+	parked, err := schemaManager.ListParkedMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to get parked migrations: %w", err)
+	}
+
 	// Display status information
 	displaySchemaStatus(currentSchema)
+	displayFutureMigrations(currentSchema, discovery.GetAvailableMigrations())
+	displayMigrationProgress(inFlight)
+	displayBestEffortFailures(currentSchema)
 	displayMigrationHistory(currentSchema)
 	displayPendingMigrations(plan)
+	displayParkedMigrations(plan, parked)
 	displayMigrationStatistics(currentSchema, plan)
 
 	return nil
@@ -77,15 +101,81 @@ func displaySchemaStatus(schema *migrate.SchemaVersion) {
 	// Status with color/emoji indicators
 	statusIcon := getStatusIcon(schema.Status)
 	fmt.Printf("Status: %s %s\n", statusIcon, schema.Status)
+	if len(schema.RunningMigrations) > 0 {
+		fmt.Printf("Running Migrations: %s\n", strings.Join(schema.RunningMigrations, ", "))
+	}
+	if failure := schema.LastFailure; failure != nil {
+		fmt.Printf("Last Failure: %s at %s\n", failure.MigrationID, failure.FailedAt.Format(time.RFC3339))
+		fmt.Printf("  Error: %s\n", failure.Error)
+		fmt.Printf("  Remediation: %s\n", failure.Remediation)
+	}
 
 	if !schema.LastMigrationAt.IsZero() {
 		fmt.Printf("Last Migration: %s\n", schema.LastMigrationAt.Format(time.RFC3339))
 	} else {
 		fmt.Printf("Last Migration: Never\n")
 	}
+	if schema.Environment != "" {
+		fmt.Printf("Environment: %s\n", schema.Environment)
+	}
 	fmt.Printf("\n")
 }
 
+// displayFutureMigrations warns about migrations dated in the future, and about
+// a schema version raised into the future by one
+func displayFutureMigrations(schema *migrate.SchemaVersion, migrations []*migrate.Migration) {
+	now := time.Now()
+	future := migrate.FindFutureMigrations(migrations, now, migrate.DefaultFutureTolerance)
+	for _, f := range future {
+		PrintWarning("Migration %s\n", f)
+	}
+	ahead, futureVersion := migrate.IsFutureVersion(schema.CurrentVersion, now, migrate.DefaultFutureTolerance)
+	if futureVersion {
+		PrintWarning("Current version is %s in the future: migrations created until then apply out of version order\n",
+			ahead.Round(time.Minute))
+	}
+	if len(future) > 0 || futureVersion {
+		fmt.Printf("\n")
+	}
+}
+
+// displayMigrationProgress shows the saved progress of chunked migrations. The
+// age of the last chunk tells a slow migration from a stuck one.
+func displayMigrationProgress(inFlight []*migrate.MigrationProgress) {
+	if len(inFlight) == 0 {
+		return
+	}
+
+	fmt.Printf("=== In-Flight Migrations ===\n")
+	for _, p := range inFlight {
+		fmt.Printf("  %s (%s)\n", p.MigrationID, p.Direction)
+		if p.Percent >= 0 {
+			fmt.Printf("    Progress: %.1f%% (%d chunks)\n", p.Percent, p.Chunks)
+		} else {
+			fmt.Printf("    Progress: %d chunks\n", p.Chunks)
+		}
+		if len(p.Cursor) > 0 {
+			fmt.Printf("    Cursor: %s\n", formatCursor(p.Cursor))
+		}
+		fmt.Printf("    Started: %s\n", p.StartedAt.Format(time.RFC3339))
+		fmt.Printf("    Last Chunk: %s (%s ago)\n", p.UpdatedAt.Format(time.RFC3339), time.Since(p.UpdatedAt).Round(time.Second))
+	}
+	fmt.Printf("\n")
+}
+
+// formatCursor formats a cursor as a quoted string, or as hex if it is binary,
+// shortened to 64 bytes
+func formatCursor(cursor []byte) string {
+	suffix := ""
+	if len(cursor) > 64 {
+		cursor, suffix = cursor[:64], "..."
+	}
+	if utf8.Valid(cursor) && strings.IndexFunc(string(cursor), func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+		return strconv.Quote(string(cursor)) + suffix
+	}
+	return "0x" + hex.EncodeToString(cursor) + suffix
+}
+
 func displayMigrationHistory(schema *migrate.SchemaVersion) {
 	fmt.Printf("=== Migration History ===\n")
 
@@ -112,8 +202,8 @@ func displayMigrationHistory(schema *migrate.SchemaVersion) {
 		fmt.Printf("  %s %s - %s\n",
 			statusIcon, record.ID, record.AppliedAt.Format("2006-01-02 15:04:05"))
 
-		if record.Duration != "" {
-			fmt.Printf("    Duration: %s\n", record.Duration)
+		if record.DurationText != "" {
+			fmt.Printf("    Duration: %s\n", record.DurationText)
 		}
 
 		if record.Error != "" {
@@ -144,6 +234,49 @@ func displayPendingMigrations(plan *migrate.ExecutionPlan) {
 	fmt.Printf("\nTo apply pending migrations, run: pebble-migrate up\n\n")
 }
 
+// displayParkedMigrations shows the pending migrations upgrades leave out because
+// they or their dependencies are parked
+func displayParkedMigrations(plan *migrate.ExecutionPlan, parked []*migrate.ParkedMigration) {
+	if len(plan.Parked) == 0 {
+		return
+	}
+
+	records := make(map[string]*migrate.ParkedMigration)
+	for _, p := range parked {
+		records[p.ID] = p
+	}
+
+	fmt.Printf("=== Parked Migrations ===\n")
+	for _, m := range plan.Parked {
+		fmt.Printf("  • %s (v%d) - %s\n", m.ID, m.Version, m.Description)
+		if p, ok := records[m.ID]; !ok {
+			fmt.Printf("    Held back by a parked dependency\n")
+		} else if p.Reason != "" {
+			fmt.Printf("    Parked %s: %s\n", p.ParkedAt.Format(time.RFC3339), p.Reason)
+		} else {
+			fmt.Printf("    Parked %s\n", p.ParkedAt.Format(time.RFC3339))
+		}
+	}
+
+	fmt.Printf("\nTo apply them again, run: pebble-migrate unpark <migration_id>\n\n")
+}
+
+// displayBestEffortFailures shows the best-effort migrations that failed without
+// dirtying the state and are still pending
+func displayBestEffortFailures(schema *migrate.SchemaVersion) {
+	failures := schema.BestEffortFailures()
+	if len(failures) == 0 {
+		return
+	}
+
+	fmt.Printf("=== Best-Effort Failures ===\n")
+	for _, record := range failures {
+		fmt.Printf("  ⚠ %s - failed %s\n", record.ID, record.AppliedAt.Format(time.RFC3339))
+		fmt.Printf("    Error: %s\n", record.Error)
+	}
+	fmt.Printf("\nThey are retried with the next upgrade.\n\n")
+}
+
 func displayMigrationStatistics(schema *migrate.SchemaVersion, plan *migrate.ExecutionPlan) {
 	fmt.Printf("=== Statistics ===\n")
 
@@ -167,6 +300,12 @@ func displayMigrationStatistics(schema *migrate.SchemaVersion, plan *migrate.Exe
 	}
 
 	fmt.Printf("Pending Migrations: %d\n", len(plan.Migrations))
+	if len(plan.Parked) > 0 {
+		fmt.Printf("Parked Migrations: %d\n", len(plan.Parked))
+	}
+	if failures := schema.BestEffortFailures(); len(failures) > 0 {
+		fmt.Printf("Best-Effort Failures: %d\n", len(failures))
+	}
 
 	if len(plan.Migrations) > 0 {
 		fmt.Printf("Target Version: %d\n", plan.TargetVersion)
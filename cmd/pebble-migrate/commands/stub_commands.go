@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 	migrate "github.com/herenow/pebble-migrate"
@@ -9,37 +10,6 @@ import (
 
 // Stub implementations for remaining commands
 
-// NewCreateCommand creates the create command (for generating new migration files)
-func NewCreateCommand() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "create <migration_name>",
-		Short: "Create a new migration file",
-		Long: `Create a new migration file with the given name.
-
-This command generates a new migration file template in the migrations directory
-with the appropriate version number and boilerplate code.
-
-Examples:
-  pebble-migrate create add_user_indexes
-  pebble-migrate create optimize_queries`,
-		Args: cobra.ExactArgs(1),
-		RunE: runCreateCommand,
-	}
-
-	return cmd
-}
-
-func runCreateCommand(cmd *cobra.Command, args []string) error {
-	migrationName := args[0]
-
-	PrintInfo("Creating migration file for: %s\n", migrationName)
-	PrintWarning("Migration file creation is not yet implemented.\n")
-	PrintInfo("Please manually create migration files in the migrations/ directory.\n")
-	PrintInfo("Follow the naming convention: 001_%s.go\n", migrationName)
-
-	return nil
-}
-
 // NewHistoryCommand creates the history command
 func NewHistoryCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -60,14 +30,14 @@ func runHistoryCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	// Open database in read-only mode
-	db, err := OpenDatabase(config.DatabasePath, true)
+	db, err := OpenDatabase(config, true)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
 	// Create migration services
-	schemaManager, _, _ := CreateMigrationServices(db)
+	schemaManager := NewSchemaManager(db, config)
 
 	// Get migration history
 	history, err := schemaManager.GetMigrationHistory()
@@ -82,30 +52,86 @@ func runHistoryCommand(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	fmt.Printf("Found %d migration records:\n\n", len(history))
+	plans, err := schemaManager.PlanHistory()
+	if err != nil {
+		return fmt.Errorf("failed to get plan history: %w", err)
+	}
+
+	fmt.Printf("Found %d migration records in %d recorded plans:\n\n", len(history), len(plans))
 
+	// Records are grouped under the plan they were recorded in. Records of
+	// migrations run before plans were recorded are listed on their own.
+	next, shown := 0, false
 	for i, record := range history {
-		statusIcon := "✓"
-		if !record.Success {
-			statusIcon = "✗"
+		for next < len(plans) && plans[next].FinishedAt.Before(record.AppliedAt) {
+			if !shown {
+				printPlanRecord(plans[next])
+			}
+			next, shown = next+1, false
 		}
+		indent := ""
+		if next < len(plans) && plans[next].Contains(record) {
+			if !shown {
+				printPlanRecord(plans[next])
+				shown = true
+			}
+			indent = "   "
+		}
+		printHistoryRecord(i+1, record, indent)
+	}
+	for ; next < len(plans); next, shown = next+1, false {
+		if !shown {
+			printPlanRecord(plans[next])
+		}
+	}
 
-		fmt.Printf("%d. %s %s\n", i+1, statusIcon, record.ID)
-		fmt.Printf("   Description: %s\n", record.Description)
-		fmt.Printf("   Applied: %s\n", record.AppliedAt.Format("2006-01-02 15:04:05 MST"))
+	return nil
+}
 
-		if record.Duration != "" {
-			fmt.Printf("   Duration: %s\n", record.Duration)
-		}
+// printPlanRecord prints the header of a plan in the history
+func printPlanRecord(plan migrate.PlanRecord) {
+	statusIcon := "✓"
+	if !plan.Success {
+		statusIcon = "✗"
+	}
+	fmt.Printf("%s Plan: %s from version %d to %d (%d migrations) at %s, took %s\n", statusIcon, plan.Type,
+		plan.FromVersion, plan.TargetVersion, len(plan.Migrations), plan.StartedAt.Format("2006-01-02 15:04:05 MST"), plan.DurationText)
+	if plan.BackupPath != "" {
+		fmt.Printf("  Backup: %s\n", plan.BackupPath)
+	}
+	if len(plan.Deferred) > 0 {
+		fmt.Printf("  Deferred: %d migrations (%s)\n", len(plan.Deferred), strings.Join(plan.Deferred, ", "))
+	}
+	if plan.Error != "" {
+		fmt.Printf("  Error: %s\n", plan.Error)
+	}
+	fmt.Printf("\n")
+}
 
-		if record.Error != "" {
-			fmt.Printf("   Error: %s\n", record.Error)
-		}
+// printHistoryRecord prints a migration record of the history
+func printHistoryRecord(n int, record migrate.MigrationRecord, indent string) {
+	statusIcon := "✓"
+	if !record.Success {
+		statusIcon = "✗"
+	}
 
-		fmt.Printf("\n")
+	if record.Type != migrate.RecordApply {
+		fmt.Printf("%s%d. %s %s (%s)\n", indent, n, statusIcon, record.ID, record.Type)
+	} else {
+		fmt.Printf("%s%d. %s %s\n", indent, n, statusIcon, record.ID)
 	}
+	fmt.Printf("%s   Description: %s\n", indent, record.Description)
+	fmt.Printf("%s   Applied: %s\n", indent, record.AppliedAt.Format("2006-01-02 15:04:05 MST"))
 
-	return nil
+	if record.DurationText != "" {
+		fmt.Printf("%s   Duration: %s\n", indent, record.DurationText)
+	}
+
+	if record.Error != "" {
+		fmt.Printf("%s   Error: %s\n", indent, record.Error)
+	}
+
+	fmt.Printf("\n")
 }
 
 // NewForceCleanCommand creates the force-clean command
@@ -122,10 +148,18 @@ you're doing. This command bypasses all safety checks.
 Use this command only if:
 - You understand the current state of your database
 - You have backups of your data
-- Normal migration operations are failing due to state issues`,
+- Normal migration operations are failing due to state issues
+
+Force-clean only changes the status. To fix inconsistencies between the
+applied migrations and the history, use "repair --mode reconcile".
+
+The operation must be confirmed by typing the name of the database directory.
+Pass it with --confirm-phrase to force clean without prompting.`,
 		RunE: runForceCleanCommand,
 	}
 
+	cmd.Flags().String("confirm-phrase", "", "Confirm without prompting by passing the name of the database directory")
+
 	return cmd
 }
 
@@ -141,14 +175,14 @@ func runForceCleanCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	// Open database
-	db, err := OpenDatabase(config.DatabasePath, false)
+	db, err := OpenDatabase(config, false)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
 	// Create schema manager
-	schemaManager, _, _ := CreateMigrationServices(db)
+	schemaManager := NewSchemaManager(db, config)
 
 	// Show current state
 	currentSchema, err := schemaManager.GetSchemaVersion()
@@ -164,12 +198,18 @@ func runForceCleanCommand(cmd *cobra.Command, args []string) error {
 	PrintWarning("This operation bypasses all safety checks and may mask underlying issues.\n")
 	PrintWarning("Make sure you have backups and understand the implications.\n\n")
 
-	if !ConfirmAction("Do you understand the risks and want to continue?") {
+	confirmPhrase, _ := cmd.Flags().GetString("confirm-phrase")
+	if confirmPhrase == "" && !ConfirmAction("Do you understand the risks and want to continue?") {
 		PrintInfo("Operation cancelled.\n")
 		return nil
 	}
 
-	if !ConfirmAction("Are you absolutely sure you want to force clean state?") {
+	confirmed, err := ConfirmPhrase("To force clean state, type the name of the database directory.",
+		DatabaseConfirmPhrase(config), confirmPhrase)
+	if err != nil {
+		return err
+	}
+	if !confirmed {
 		PrintInfo("Operation cancelled.\n")
 		return nil
 	}
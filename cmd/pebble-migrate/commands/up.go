@@ -26,12 +26,21 @@ Examples:
   pebble-migrate up          # Apply all pending migrations
   pebble-migrate up 5        # Migrate to version 5
   pebble-migrate up --dry-run  # Show what would be done
-  pebble-migrate up --no-backup  # Skip backup creation`,
+  pebble-migrate up --no-backup  # Skip backup creation
+  pebble-migrate up --no-backup --record-ops  # Keep operation logs instead
+  pebble-migrate up --parallel 4  # Run independent migrations concurrently
+  pebble-migrate up --strict  # Refuse plans with key prefix conflicts
+  pebble-migrate up --on-failure=rollback  # Roll back the plan if a migration fails`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: runUpCommand,
 	}
 
 	cmd.Flags().Bool("no-backup", false, "Skip creating backup before migration")
+	cmd.Flags().Bool("record-ops", false, "Save the operation log of migrations that use Apply alongside the backups")
+	cmd.Flags().String("lock-file", migrate.DefaultLockFile, "Verify the registered migrations against this lock file if it exists (empty to skip)")
+	cmd.Flags().Bool("strict", false, "Fail if planned migrations declare overlapping key prefixes without a dependency")
+	cmd.Flags().Int("parallel", 1, "Run up to N independent migrations with disjoint key prefixes concurrently")
+	cmd.Flags().String("on-failure", "stop", "What a failed migration does to the plan: stop, continue with the migrations not depending on it, or rollback the plan")
 
 	return cmd
 }
@@ -52,16 +61,25 @@ func runUpCommand(cmd *cobra.Command, args []string) error {
 		targetVersion = &version
 	}
 
+	onFailure, _ := cmd.Flags().GetString("on-failure")
+	failurePolicy, err := migrate.ParseFailurePolicy(onFailure)
+	if err != nil {
+		return err
+	}
+
 	// Open database (read-only for dry-run, read-write otherwise)
 	readOnly := config.DryRun
-	db, err := OpenDatabase(config.DatabasePath, readOnly)
+	db, err := OpenDatabase(config, readOnly)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
 	// Create migration services
-	schemaManager, planner, discovery := CreateMigrationServices(db)
+	schemaManager, planner, discovery, err := CreateMigrationServices(db, config)
+	if err != nil {
+		return err
+	}
 
 	// Validate migrations
 	if err := discovery.ValidateMigrations(); err != nil {
@@ -75,6 +93,15 @@ func runUpCommand(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	strict, _ := cmd.Flags().GetBool("strict")
+	planner.SetStrictConflicts(strict)
+
+	lock, err := loadLockFile(cmd)
+	if err != nil {
+		return err
+	}
+	planner.SetLockFile(lock)
+
 	// Create migration plan
 	var plan *migrate.ExecutionPlan
 	if targetVersion != nil {
@@ -92,22 +119,15 @@ func runUpCommand(cmd *cobra.Command, args []string) error {
 	// Check if there are migrations to apply
 	if len(plan.Migrations) == 0 {
 		PrintSuccess("Database is already up to date!\n")
+		displayParkedCount(plan)
 		return nil
 	}
 
 	// Display plan
 	displayMigrationPlan(plan, config.DryRun)
 
-	// Confirm execution (unless dry-run or non-interactive)
-	if !config.DryRun {
-		if !ConfirmAction("Do you want to proceed with this migration?") {
-			PrintInfo("Migration cancelled.\n")
-			return nil
-		}
-	}
-
 	// Create migration engine with backup support
-	engine, _ := CreateMigrationEngine(db, config.DatabasePath)
+	engine, _ := CreateMigrationEngine(db, config)
 	engine.SetDryRun(config.DryRun)
 	engine.SetVerbose(config.Verbose)
 
@@ -120,9 +140,27 @@ func runUpCommand(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Execute migration plan with progress callback
-	progressCallback := createProgressCallback(config.Verbose)
-	err = engine.ExecutePlan(plan, progressCallback)
+	recordOps, _ := cmd.Flags().GetBool("record-ops")
+	engine.SetRecordOps(recordOps)
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	engine.SetParallelism(parallel)
+	engine.SetFailurePolicy(failurePolicy)
+
+	// Refuse plans violating the policies before asking
+	if err := CheckPolicies(engine, plan); err != nil {
+		return err
+	}
+
+	// Confirm execution (unless dry-run or non-interactive)
+	if !config.DryRun {
+		if !ConfirmAction("Do you want to proceed with this migration?") {
+			PrintInfo("Migration cancelled.\n")
+			return nil
+		}
+	}
+
+	// Execute migration plan (against a throwaway copy in dry-run mode)
+	err = ExecutePlan(engine, plan, config)
 	if err != nil {
 		PrintError("Migration failed: %v\n", err)
 		return err
@@ -131,6 +169,11 @@ func runUpCommand(cmd *cobra.Command, args []string) error {
 	// Success message
 	if config.DryRun {
 		PrintSuccess("Dry run completed successfully. No changes were made.\n")
+	} else if skipped := engine.SkippedMigrations(); len(skipped) > 0 {
+		PrintWarning("Migration completed with %d migrations skipped after best-effort failures:\n", len(skipped))
+		for _, m := range skipped {
+			fmt.Printf("  - %s\n", m.ID)
+		}
 	} else {
 		PrintSuccess("Migration completed successfully!\n")
 		PrintInfo("Database is now at version %d\n", plan.TargetVersion)
@@ -158,17 +201,35 @@ func displayMigrationPlan(plan *migrate.ExecutionPlan, isDryRun bool) {
 		}
 		fmt.Printf("\n")
 	}
-}
 
-func createProgressCallback(verbose bool) func(string) {
-	return func(message string) {
-		if verbose {
-			fmt.Printf("[PROGRESS] %s\n", message)
-		} else {
-			// For non-verbose mode, only show major progress indicators
-			if len(message) > 0 && (strings.HasPrefix(message, "✓") || strings.HasPrefix(message, "⚠") || strings.HasPrefix(message, "✗")) {
-				fmt.Println(message)
-			}
+	displayParkedCount(plan)
+
+	if len(plan.Conflicts) > 0 {
+		PrintWarning("Key prefix conflicts (add a dependency to fix the order, or use --strict to refuse):\n")
+		for _, conflict := range plan.Conflicts {
+			fmt.Printf("  - %s\n", conflict)
 		}
+		fmt.Printf("\n")
+	}
+}
+
+// displayParkedCount notes the parked migrations a plan leaves out
+func displayParkedCount(plan *migrate.ExecutionPlan) {
+	if len(plan.Parked) > 0 {
+		PrintInfo("%d parked migration(s) left out, see 'pebble-migrate status'\n\n", len(plan.Parked))
 	}
 }
+
+// createProgressReporter returns the reporter printing the progress of a plan.
+// Without verbose output only warnings are shown.
+func createProgressReporter(verbose bool) migrate.ProgressReporter {
+	return migrate.ProgressEventFunc(func(event migrate.ProgressEvent) {
+		switch {
+		case event.Message == "":
+		case verbose:
+			fmt.Printf("[PROGRESS] %s\n", event.Message)
+		case event.Phase == migrate.ProgressWarning:
+			PrintWarning("%s\n", strings.TrimPrefix(event.Message, "Warning: "))
+		}
+	})
+}
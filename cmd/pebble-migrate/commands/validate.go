@@ -21,12 +21,18 @@ This command performs comprehensive validation checks including:
 - Key structure validation
 - Orphaned data detection
 
+With --orphans, the prefixes declared in Introduces by migrations that were
+rolled back are scanned for keys their Down functions missed.
+
 Examples:
   pebble-migrate validate
-  pebble-migrate validate --verbose`,
+  pebble-migrate validate --verbose
+  pebble-migrate validate --orphans`,
 		RunE: runValidateCommand,
 	}
 
+	cmd.Flags().Bool("orphans", false, "Also scan the prefixes introduced by rolled back migrations for leftover keys")
+
 	return cmd
 }
 
@@ -37,14 +43,17 @@ func runValidateCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	// Open database in read-only mode
-	db, err := OpenDatabase(config.DatabasePath, true)
+	db, err := OpenDatabase(config, true)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
 	// Create migration services
-	schemaManager, _, discovery := CreateMigrationServices(db)
+	schemaManager, _, discovery, err := CreateMigrationServices(db, config)
+	if err != nil {
+		return err
+	}
 
 	fmt.Printf("=== Database Validation ===\n\n")
 
@@ -87,6 +96,12 @@ func runValidateCommand(cmd *cobra.Command, args []string) error {
 	}
 	PrintSuccess("Migration history is consistent\n")
 
+	if orphans, _ := cmd.Flags().GetBool("orphans"); orphans {
+		if err := validateOrphans(schemaManager); err != nil {
+			return err
+		}
+	}
+
 	// TODO: Add data integrity validation once we implement the validation framework
 	if config.Verbose {
 		PrintInfo("\nSkipping data integrity validation (not yet implemented)\n")
@@ -101,6 +116,24 @@ func runValidateCommand(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// validateOrphans reports the keys left under prefixes introduced by rolled back migrations
+func validateOrphans(schemaManager *migrate.SchemaManager) error {
+	PrintInfo("\nScanning for orphaned keys...\n")
+	orphans, err := schemaManager.FindOrphanedKeys(migrate.GlobalRegistry)
+	if err != nil {
+		return fmt.Errorf("failed to scan for orphaned keys: %w", err)
+	}
+	if len(orphans) == 0 {
+		PrintSuccess("No orphaned keys found\n")
+		return nil
+	}
+	PrintError("Found keys left by rolled back migrations:\n")
+	for _, orphan := range orphans {
+		PrintError("  - %s\n", orphan)
+	}
+	return fmt.Errorf("found orphaned keys under %d prefix(es)", len(orphans))
+}
+
 // ValidationResult represents the result of validation
 type ValidationResult struct {
 	Success bool
@@ -127,8 +160,8 @@ func validateMigrationHistory(schema *migrate.SchemaVersion, verbose bool) Valid
 				record.AppliedAt.Format("2006-01-02 15:04:05"))
 		}
 
-		// Skip rollback records in counting
-		if isRollbackRecord(record.ID) {
+		// Skip rollback, rerun and rename records in counting
+		if record.Type == migrate.RecordRollback || record.Type == migrate.RecordRerun || record.Type == migrate.RecordRenamed {
 			continue
 		}
 
@@ -144,7 +177,7 @@ func validateMigrationHistory(schema *migrate.SchemaVersion, verbose bool) Valid
 	for migID := range schema.AppliedMigrations {
 		found := false
 		for _, record := range schema.MigrationHistory {
-			if record.ID == migID && record.Success {
+			if record.ID == migID && record.Success && record.Type.Applies() {
 				found = true
 				break
 			}
@@ -163,8 +196,3 @@ func validateMigrationHistory(schema *migrate.SchemaVersion, verbose bool) Valid
 
 	return result
 }
-
-// isRollbackRecord checks if a migration record is a rollback record
-func isRollbackRecord(id string) bool {
-	return len(id) > 9 && (id[len(id)-9:] == "_rollback" || id[len(id)-6:] == "_rerun")
-}
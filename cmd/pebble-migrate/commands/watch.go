@@ -0,0 +1,279 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	migrate "github.com/herenow/pebble-migrate"
+	"github.com/spf13/cobra"
+)
+
+// NewWatchCommand creates the watch command
+func NewWatchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Watch migrations and auto-apply them to a dev database (development only)",
+		Long: `Watch a migrations directory and apply new migrations to a local development
+database whenever its files change.
+
+DEVELOPMENT ONLY: migrations are applied without confirmation and without
+backups. Never point this command at a production database.
+
+By default, script migrations (.yaml, .yml, .json) in the directory are loaded
+in-process on each change. Go migrations have to be recompiled: use --run with a
+command that builds and runs your migration CLI (for example "go run ./cmd/migrate").
+The command is executed as "<run> up -d <database>" after every change, so it
+picks up edited and newly added Go migrations.
+
+Examples:
+  pebble-migrate watch -d ./dev.db --dir ./migrations
+  pebble-migrate watch -d ./dev.db --dir ./migrations --run "go run ./cmd/migrate"`,
+		RunE: runWatchCommand,
+	}
+
+	cmd.Flags().String("dir", "migrations", "Migrations directory to watch")
+	cmd.Flags().Duration("interval", time.Second, "Polling interval")
+	cmd.Flags().String("run", "", "Command that rebuilds and runs the migration CLI, invoked as '<run> up -d <database>'")
+
+	return cmd
+}
+
+func runWatchCommand(cmd *cobra.Command, args []string) error {
+	config, err := GetGlobalConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	dir, _ := cmd.Flags().GetString("dir")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	runCommand, _ := cmd.Flags().GetString("run")
+
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("cannot watch migrations directory: %w", err)
+	}
+
+	PrintWarning("Development only: migrations are applied without confirmation or backups\n")
+	PrintInfo("Watching %s (every %s), database %s\n", dir, interval, config.DatabasePath)
+
+	w := &watcher{
+		config:     config,
+		dir:        dir,
+		runCommand: runCommand,
+		scripts:    make(map[string]string),
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last map[string]fileStamp
+	for {
+		current, err := snapshotDir(dir)
+		if err != nil {
+			PrintError("Failed to scan %s: %v\n", dir, err)
+		} else if !sameStamps(last, current) {
+			if last != nil {
+				fmt.Printf("\n[%s] Change detected\n", time.Now().Format("15:04:05"))
+			}
+			last = current
+			if err := w.apply(); err != nil {
+				PrintError("%v\n", err)
+			}
+		}
+
+		select {
+		case <-interrupt:
+			fmt.Println()
+			PrintInfo("Stopped watching.\n")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// watcher applies migrations after a change to the watched directory
+type watcher struct {
+	config     *GlobalConfig
+	dir        string
+	runCommand string
+	scripts    map[string]string // script path -> encoded script as last loaded
+}
+
+// apply runs the configured command, or loads new scripts and applies pending
+// migrations in-process
+func (w *watcher) apply() error {
+	if w.runCommand != "" {
+		return w.runExternal()
+	}
+
+	if err := w.loadScripts(); err != nil {
+		return err
+	}
+
+	db, err := OpenDatabase(w.config, w.config.DryRun)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	schemaManager := NewSchemaManager(db, w.config)
+	if err := schemaManager.ValidateSchemaState(); err != nil {
+		return fmt.Errorf("database is not in a valid state for migration: %w", err)
+	}
+
+	plan, err := migrate.NewMigrationPlanner(migrate.GlobalRegistry, schemaManager).PlanUpgrade()
+	if err != nil {
+		return fmt.Errorf("failed to create migration plan: %w", err)
+	}
+	if len(plan.Migrations) == 0 {
+		PrintSuccess("Database is up to date\n")
+		return nil
+	}
+
+	engine, _ := CreateMigrationEngine(db, w.config)
+	engine.SetDryRun(w.config.DryRun)
+	engine.SetVerbose(w.config.Verbose)
+	engine.SetBackupEnabled(false)
+
+	if err := engine.ExecutePlanWithProgress(plan, createProgressReporter(w.config.Verbose)); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	PrintSuccess("Applied %d migrations, database is now at version %d\n", len(plan.Migrations), plan.TargetVersion)
+	return nil
+}
+
+// loadScripts registers script migrations that appeared since the last scan.
+// Scripts that were already registered cannot be replaced in-process.
+func (w *watcher) loadScripts() error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !migrate.IsScriptMigrationFile(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(w.dir, entry.Name())
+
+		script, err := migrate.LoadScriptMigration(path)
+		if err != nil {
+			return err
+		}
+
+		encoded, _ := json.Marshal(script)
+		if previous, loaded := w.scripts[path]; loaded {
+			if previous != string(encoded) {
+				PrintWarning("%s changed after it was loaded; restart watch to reload it (use down or rerun if it was applied)\n", entry.Name())
+				w.scripts[path] = string(encoded)
+			}
+			continue
+		}
+		if _, exists := migrate.GlobalRegistry.GetMigration(script.ID); exists {
+			w.scripts[path] = string(encoded)
+			continue
+		}
+
+		migration, err := script.Migration()
+		if err != nil {
+			return err
+		}
+		if err := migrate.GlobalRegistry.Register(migration); err != nil {
+			return fmt.Errorf("failed to register script %s: %w", entry.Name(), err)
+		}
+		w.scripts[path] = string(encoded)
+		PrintInfo("Loaded script migration %s\n", script.ID)
+	}
+
+	return nil
+}
+
+// runExternal runs the user's migration CLI to apply pending migrations
+func (w *watcher) runExternal() error {
+	args := []string{"up", "-d", w.config.DatabasePath, "--no-backup",
+		"--schema-key", w.config.SchemaKey, "--key-prefix", w.config.KeyPrefix}
+	if w.config.ScriptsDir != "" {
+		args = append(args, "--scripts-dir", w.config.ScriptsDir)
+	}
+	if w.config.DryRun {
+		args = append(args, "--dry-run")
+	}
+	if w.config.Verbose {
+		args = append(args, "--verbose")
+	}
+
+	shellCommand := w.runCommand + " " + strings.Join(quoteArgs(args), " ")
+	VerbosePrintf(w.config, "Running: %s\n", shellCommand)
+
+	c := exec.Command("sh", "-c", shellCommand)
+	c.Stdin = strings.NewReader("y\n") // Confirm the migration prompt
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", w.runCommand, err)
+	}
+	return nil
+}
+
+// quoteArgs single-quotes arguments for the shell
+func quoteArgs(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return quoted
+}
+
+// fileStamp identifies a version of a watched file
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshotDir records the size and modification time of every non-hidden file under dir
+func snapshotDir(dir string) (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && path != dir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			stamps[path] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		}
+		return nil
+	})
+	return stamps, err
+}
+
+// sameStamps reports whether two directory snapshots are identical
+func sameStamps(a, b map[string]fileStamp) bool {
+	if a == nil || len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		other, ok := b[path]
+		if !ok || !other.modTime.Equal(stamp.modTime) || other.size != stamp.size {
+			return false
+		}
+	}
+	return true
+}
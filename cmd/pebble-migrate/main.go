@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	migrate "github.com/herenow/pebble-migrate"
 	"github.com/herenow/pebble-migrate/cmd/pebble-migrate/commands"
 )
 
@@ -35,21 +36,59 @@ This tool allows you to:
 	rootCmd.PersistentFlags().StringP("database", "d", "", "Path to the Pebble database directory")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Enable verbose output")
 	rootCmd.PersistentFlags().BoolP("dry-run", "n", false, "Show what would be done without executing")
+	rootCmd.PersistentFlags().String("schema-key", migrate.SchemaVersionKey, "Key the schema state is stored under")
+	rootCmd.PersistentFlags().String("key-prefix", migrate.MigrationPrefix, "Prefix reserved for internal migration metadata")
+	rootCmd.PersistentFlags().String("schema-encoding", string(migrate.SchemaEncodingJSON), "Encoding the schema state is written in: json or proto (both are always read)")
+	rootCmd.PersistentFlags().String("scripts-dir", "", "Directory of YAML/JSON script migrations to load")
+	rootCmd.PersistentFlags().String("plugins-dir", "", "Load Go plugin (.so) migrations from this directory (experimental)")
+	rootCmd.PersistentFlags().Float64("backup-max-read-mbps", 0, "Limit how fast backups and restores read files, in MB/s (0 is unlimited)")
+	rootCmd.PersistentFlags().Int("backup-workers", 1, "Number of goroutines compressing a backup")
+	rootCmd.PersistentFlags().Bool("plan-only", false, "With --dry-run, only print the plan instead of executing it against a throwaway copy of the database")
+	rootCmd.PersistentFlags().String("event-log", "", "Append a JSON lines log of the progress events of executed plans to this file")
+	rootCmd.PersistentFlags().Duration("wait", 0, "Wait up to this long for another process holding the database to release it, e.g. 30s")
+	rootCmd.PersistentFlags().String("environment", "", "Environment the database must belong to, e.g. production; stamps an unstamped database")
+	rootCmd.PersistentFlags().String("standby", "", "Apply executed plans to this warm standby copy of the database too")
+	rootCmd.PersistentFlags().Int("max-migrations", 0, "Refuse plans of more than this many migrations (0 is unlimited)")
+	rootCmd.PersistentFlags().StringSlice("forbid-downgrade-in", nil, "Refuse downgrades of databases stamped with these environments")
+	rootCmd.PersistentFlags().StringSlice("require-backup-for", nil, "Refuse to run migrations with these tags without a backup")
+	rootCmd.PersistentFlags().Duration("max-future-skew", 0, "Refuse to apply migrations dated more than this far in the future, e.g. 1h (0 allows any)")
+	rootCmd.PersistentFlags().String("on-validation-failure", string(migrate.PlanValidationFail), "What to do when the registered plan validators fail after a plan: fail, rollback (upgrades only) or alert")
+	rootCmd.PersistentFlags().StringSlice("value-decoder", nil, "Render the values of keys under a prefix with a registered codec, prefix=codec, e.g. blob/=base64_encode")
+	rootCmd.PersistentFlags().String("chaos", "", "Development only: inject a fault, [crash:]<point>[:<n>] with point before_migration, after_data_write, during_backup or during_restore")
 
-	// Mark database flag as required
-	rootCmd.MarkPersistentFlagRequired("database")
+	// The database flag is checked by the commands that open a database, so that
+	// create, gen, lint and report can run without one (e.g. from go:generate or CI)
 
 	// Add commands
 	rootCmd.AddCommand(commands.NewStatusCommand())
 	rootCmd.AddCommand(commands.NewUpCommand())
 	rootCmd.AddCommand(commands.NewDownCommand())
 	rootCmd.AddCommand(commands.NewRerunCommand())
+	rootCmd.AddCommand(commands.NewApplyOneCommand())
+	rootCmd.AddCommand(commands.NewParkCommand())
+	rootCmd.AddCommand(commands.NewUnparkCommand())
 	rootCmd.AddCommand(commands.NewValidateCommand())
 	rootCmd.AddCommand(commands.NewCreateCommand())
+	rootCmd.AddCommand(commands.NewGenCommand())
+	rootCmd.AddCommand(commands.NewLintCommand())
 	rootCmd.AddCommand(commands.NewHistoryCommand())
 	rootCmd.AddCommand(commands.NewForceCleanCommand())
 	rootCmd.AddCommand(commands.NewBackupCommand())
 	rootCmd.AddCommand(commands.NewRepairCommand())
+	rootCmd.AddCommand(commands.NewRecoverCommand())
+	rootCmd.AddCommand(commands.NewBenchCommand())
+	rootCmd.AddCommand(commands.NewImportCommand())
+	rootCmd.AddCommand(commands.NewWatchCommand())
+	rootCmd.AddCommand(commands.NewOpLogCommand())
+	rootCmd.AddCommand(commands.NewLockCommand())
+	rootCmd.AddCommand(commands.NewStateCommand())
+	rootCmd.AddCommand(commands.NewFingerprintCommand())
+	rootCmd.AddCommand(commands.NewStandbyCommand())
+	rootCmd.AddCommand(commands.NewExportCommand())
+	rootCmd.AddCommand(commands.NewLoadCommand())
+	rootCmd.AddCommand(commands.NewInspectCommand())
+	rootCmd.AddCommand(commands.NewFixCommand())
+	rootCmd.AddCommand(commands.NewReportCommand())
 
 	// Execute the root command
 	if err := rootCmd.Execute(); err != nil {
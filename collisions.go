@@ -0,0 +1,164 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// VersionCollision is a version and sequence shared by more than one migration.
+// Migrations with the same version and sequence run in an order decided only by
+// their priority and ID, which changes when branches that each added one are
+// merged.
+type VersionCollision struct {
+	Version  int64    `json:"version"`
+	Sequence int64    `json:"sequence,omitempty"`
+	IDs      []string `json:"ids"` // Sorted
+}
+
+// String returns a human-readable description of the collision
+func (c VersionCollision) String() string {
+	if c.Sequence != 0 {
+		return fmt.Sprintf("%s share version %d.%d", strings.Join(c.IDs, ", "), c.Version, c.Sequence)
+	}
+	return fmt.Sprintf("%s share version %d", strings.Join(c.IDs, ", "), c.Version)
+}
+
+// MigrationFile is a migration file of a migrations directory
+type MigrationFile struct {
+	Name     string // Base name of the file
+	ID       string // Migration ID, the file name without extension for Go files
+	Version  int64
+	Sequence int64
+
+	// Metadata of the migration, read from scripts and from the Migration
+	// literal of Go files. Fields set to an expression hold its source.
+	Description string
+	Owner       string
+	RunbookURL  string
+	HasMetadata bool // False for Go files without a Migration literal
+}
+
+// ScanMigrationFiles returns the migration files of dir: Go files named like a
+// migration ID, except test files, and script migrations. It reads the files
+// themselves, so that it also covers migrations not registered in the running
+// binary, e.g. in CI after merging branches.
+func ScanMigrationFiles(dir string) ([]MigrationFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration directory: %w", err)
+	}
+
+	var files []MigrationFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+
+		file := MigrationFile{Name: name}
+		switch {
+		case strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go"):
+			file.ID = strings.TrimSuffix(name, ".go")
+		case IsScriptMigrationFile(name):
+			script, err := LoadScriptMigration(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			file.ID = script.ID
+			file.Description, file.Owner, file.RunbookURL = script.Description, script.Owner, script.RunbookURL
+			file.HasMetadata = true
+		default:
+			continue
+		}
+
+		version, err := parseVersionPrefix(file.ID)
+		if err != nil {
+			continue // Not a migration, e.g. a helper or the manifest
+		}
+		file.Version, file.Sequence = version, ParseMigrationSequence(file.ID)
+		if !file.HasMetadata {
+			readGoMigrationMetadata(filepath.Join(dir, name), &file)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// FindVersionCollisions returns the versions and sequences shared by more than
+// one of the files, in version order
+func FindVersionCollisions(files []MigrationFile) []VersionCollision {
+	type key struct{ version, sequence int64 }
+	ids := make(map[key][]string)
+	for _, file := range files {
+		k := key{file.Version, file.Sequence}
+		ids[k] = append(ids[k], file.ID)
+	}
+
+	var collisions []VersionCollision
+	for k, versionIDs := range ids {
+		if len(versionIDs) > 1 {
+			sort.Strings(versionIDs)
+			collisions = append(collisions, VersionCollision{Version: k.version, Sequence: k.sequence, IDs: versionIDs})
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		if collisions[i].Version != collisions[j].Version {
+			return collisions[i].Version < collisions[j].Version
+		}
+		return collisions[i].Sequence < collisions[j].Sequence
+	})
+	return collisions
+}
+
+// NextFreeVersion returns the first version from version on that none of the
+// files uses, with or without a sequence
+func NextFreeVersion(files []MigrationFile, version int64) int64 {
+	used := make(map[int64]bool, len(files))
+	for _, file := range files {
+		used[file.Version] = true
+	}
+	for used[version] {
+		version++
+	}
+	return version
+}
+
+// SetUniqueVersions makes Register reject a migration with the same version and
+// sequence as a registered one with ErrDuplicateVersion. Enabling it fails, and leaves it
+// disabled, if registered migrations already share a version, e.g. ones
+// registered in init functions.
+func (r *MigrationRegistry) SetUniqueVersions(enabled bool) error {
+	if enabled {
+		var files []MigrationFile
+		for _, m := range r.ordered {
+			files = append(files, MigrationFile{ID: m.ID, Version: m.Version, Sequence: m.Sequence})
+		}
+		if collisions := FindVersionCollisions(files); len(collisions) > 0 {
+			var details []string
+			for _, collision := range collisions {
+				details = append(details, collision.String())
+			}
+			return fmt.Errorf("%w: %s", ErrDuplicateVersion, strings.Join(details, "; "))
+		}
+	}
+	r.uniqueVersions = enabled
+	return nil
+}
+
+// checkUniqueVersion returns ErrDuplicateVersion if unique versions are enforced
+// and a registered migration has the version and sequence of m
+func (r *MigrationRegistry) checkUniqueVersion(m *Migration, version int64) error {
+	if !r.uniqueVersions {
+		return nil
+	}
+	sequence := ParseMigrationSequence(m.ID)
+	for _, registered := range r.ordered {
+		if registered.Version == version && registered.Sequence == sequence {
+			return fmt.Errorf("%w: migration '%s' has the same version %d as '%s'", ErrDuplicateVersion, m.ID, version, registered.ID)
+		}
+	}
+	return nil
+}
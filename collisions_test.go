@@ -0,0 +1,87 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestFindVersionCollisions(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"1700000000_add_users.go":      "package migrations\n",
+		"1700000000_add_orders.go":     "package migrations\n",
+		"1700000000_add_users_test.go": "package migrations\n",
+		"backfill.yaml":                "id: 1700000001_backfill\n",
+		"1700000001_other.go":          "package migrations\n",
+		"helpers.go":                   "package migrations\n",
+		ManifestFileName:               "package migrations\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	files, err := ScanMigrationFiles(dir)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("Expected 4 migration files, got %+v", files)
+	}
+
+	collisions := FindVersionCollisions(files)
+	if len(collisions) != 2 {
+		t.Fatalf("Expected 2 collisions, got %+v", collisions)
+	}
+	if c := collisions[0]; c.Version != 1700000000 || len(c.IDs) != 2 || c.IDs[0] != "1700000000_add_orders" {
+		t.Errorf("Unexpected first collision: %+v", c)
+	}
+	if c := collisions[1]; c.Version != 1700000001 || len(c.IDs) != 2 || c.IDs[0] != "1700000001_backfill" {
+		t.Errorf("Unexpected second collision: %+v", c)
+	}
+
+	if v := NextFreeVersion(files, 1700000000); v != 1700000002 {
+		t.Errorf("Expected next free version 1700000002, got %d", v)
+	}
+	if v := NextFreeVersion(files, 1700000005); v != 1700000005 {
+		t.Errorf("Expected a free version to be kept, got %d", v)
+	}
+}
+
+func TestRegistryUniqueVersions(t *testing.T) {
+	migration := func(id string) *Migration {
+		return &Migration{ID: id, Up: func(db *pebble.DB) error { return nil }, Down: func(db *pebble.DB) error { return nil }}
+	}
+
+	registry := NewMigrationRegistry()
+	if err := registry.Register(migration("1700000000_first")); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if err := registry.Register(migration("1700000000_second")); err != nil {
+		t.Fatalf("Expected a shared version to be accepted by default: %v", err)
+	}
+	if err := registry.SetUniqueVersions(true); !errors.Is(err, ErrDuplicateVersion) {
+		t.Fatalf("Expected ErrDuplicateVersion for registered migrations, got %v", err)
+	}
+
+	registry = NewMigrationRegistry()
+	if err := registry.SetUniqueVersions(true); err != nil {
+		t.Fatalf("Failed to enable unique versions: %v", err)
+	}
+	if err := registry.Register(migration("1700000000_first")); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if err := registry.Register(migration("1700000000_second")); !errors.Is(err, ErrDuplicateVersion) {
+		t.Errorf("Expected ErrDuplicateVersion, got %v", err)
+	}
+	if _, ok := registry.GetMigration("1700000000_second"); ok {
+		t.Errorf("Expected the rejected migration not to be registered")
+	}
+	if err := registry.Register(migration("1700000001_second")); err != nil {
+		t.Errorf("Failed to register a migration with a free version: %v", err)
+	}
+}
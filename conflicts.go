@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyConflict describes two migrations of a plan whose declared key prefixes
+// overlap while neither depends on the other, so their relative order is decided
+// only by priority and timestamp
+type KeyConflict struct {
+	First        string `json:"first"`         // ID of the migration that runs first
+	FirstPrefix  string `json:"first_prefix"`  // Overlapping prefix declared by First
+	Second       string `json:"second"`        // ID of the migration that runs second
+	SecondPrefix string `json:"second_prefix"` // Overlapping prefix declared by Second
+}
+
+// String returns a human-readable description of the conflict
+func (c KeyConflict) String() string {
+	return fmt.Sprintf("%s (%q) and %s (%q) touch overlapping keys without a dependency between them",
+		c.First, c.FirstPrefix, c.Second, c.SecondPrefix)
+}
+
+// SetStrictConflicts makes upgrade planning fail with ErrKeyConflict when two
+// planned migrations declare overlapping KeyPrefixes without a dependency between
+// them. By default such conflicts are only reported in ExecutionPlan.Conflicts.
+func (p *MigrationPlanner) SetStrictConflicts(enabled bool) {
+	p.strictConflicts = enabled
+}
+
+// checkConflicts records the key conflicts of an upgrade plan, failing in strict mode
+func (p *MigrationPlanner) checkConflicts(plan *ExecutionPlan) error {
+	plan.Conflicts = p.registry.FindKeyConflicts(plan.Migrations)
+	if p.strictConflicts && len(plan.Conflicts) > 0 {
+		var details []string
+		for _, conflict := range plan.Conflicts {
+			details = append(details, conflict.String())
+		}
+		return fmt.Errorf("%w: %s", ErrKeyConflict, strings.Join(details, "; "))
+	}
+	return nil
+}
+
+// FindKeyConflicts returns every pair of the given migrations, in execution order,
+// whose declared KeyPrefixes overlap and where neither migration depends on the
+// other, directly or transitively. Migrations without KeyPrefixes are not checked.
+func (r *MigrationRegistry) FindKeyConflicts(migrations []*Migration) []KeyConflict {
+	var conflicts []KeyConflict
+	for i, first := range migrations {
+		for _, second := range migrations[i+1:] {
+			firstPrefix, secondPrefix, ok := overlappingPrefixes(first, second)
+			if !ok || r.dependsOn(second, first.ID) || r.dependsOn(first, second.ID) {
+				continue
+			}
+			conflicts = append(conflicts, KeyConflict{
+				First:        first.ID,
+				FirstPrefix:  firstPrefix,
+				Second:       second.ID,
+				SecondPrefix: secondPrefix,
+			})
+		}
+	}
+	return conflicts
+}
+
+// overlappingPrefixes returns the first pair of declared prefixes of a and b that overlap
+func overlappingPrefixes(a, b *Migration) (string, string, bool) {
+	for _, pa := range a.KeyPrefixes {
+		for _, pb := range b.KeyPrefixes {
+			if prefixesOverlap(pa, pb) {
+				return pa, pb, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// dependsOn reports whether m depends on the migration with the given ID, directly
+// or through other registered migrations
+func (r *MigrationRegistry) dependsOn(m *Migration, id string) bool {
+	visited := make(map[string]bool)
+	var visit func(m *Migration) bool
+	visit = func(m *Migration) bool {
+		for _, dep := range m.Dependencies {
+			if dep == id {
+				return true
+			}
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			if depMigration, ok := r.migrations[dep]; ok && visit(depMigration) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(m)
+}
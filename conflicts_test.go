@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestKeyConflicts(t *testing.T) {
+	noop := func(db *pebble.DB) error { return nil }
+
+	newPlanner := func(t *testing.T, migrations ...*Migration) *MigrationPlanner {
+		registry := NewMigrationRegistry()
+		for _, m := range migrations {
+			m.Up, m.Down = noop, noop
+			if err := registry.Register(m); err != nil {
+				t.Fatalf("Failed to register %s: %v", m.ID, err)
+			}
+		}
+
+		db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return NewMigrationPlanner(registry, NewSchemaManager(db))
+	}
+
+	t.Run("OverlapWithoutDependency", func(t *testing.T) {
+		planner := newPlanner(t,
+			&Migration{ID: "1754917200_users", KeyPrefixes: []string{"user:"}},
+			&Migration{ID: "1754917300_orders", KeyPrefixes: []string{"order:"}},
+			&Migration{ID: "1754917400_legacy_users", KeyPrefixes: []string{"user:legacy:"}},
+		)
+
+		plan, err := planner.PlanUpgrade()
+		if err != nil {
+			t.Fatalf("Expected non-strict planning to succeed: %v", err)
+		}
+		if len(plan.Conflicts) != 1 {
+			t.Fatalf("Expected 1 conflict, got %v", plan.Conflicts)
+		}
+		expected := KeyConflict{
+			First:        "1754917200_users",
+			FirstPrefix:  "user:",
+			Second:       "1754917400_legacy_users",
+			SecondPrefix: "user:legacy:",
+		}
+		if plan.Conflicts[0] != expected {
+			t.Errorf("Expected %+v, got %+v", expected, plan.Conflicts[0])
+		}
+
+		planner.SetStrictConflicts(true)
+		if _, err := planner.PlanUpgrade(); !errors.Is(err, ErrKeyConflict) {
+			t.Errorf("Expected strict planning to fail with ErrKeyConflict, got %v", err)
+		}
+	})
+
+	t.Run("TransitiveDependency", func(t *testing.T) {
+		planner := newPlanner(t,
+			&Migration{ID: "1754917200_users", KeyPrefixes: []string{"user:"}},
+			&Migration{ID: "1754917300_orders", KeyPrefixes: []string{"order:"}, Dependencies: []string{"1754917200_users"}},
+			&Migration{ID: "1754917400_legacy_users", KeyPrefixes: []string{"user:"}, Dependencies: []string{"1754917300_orders"}},
+		)
+		planner.SetStrictConflicts(true)
+
+		plan, err := planner.PlanUpgrade()
+		if err != nil {
+			t.Fatalf("Expected ordered migrations to plan without conflicts: %v", err)
+		}
+		if len(plan.Conflicts) != 0 {
+			t.Errorf("Expected no conflicts, got %v", plan.Conflicts)
+		}
+	})
+
+	t.Run("UndeclaredPrefixes", func(t *testing.T) {
+		planner := newPlanner(t,
+			&Migration{ID: "1754917200_users"},
+			&Migration{ID: "1754917300_more_users"},
+		)
+		planner.SetStrictConflicts(true)
+
+		if _, err := planner.PlanUpgrade(); err != nil {
+			t.Errorf("Expected migrations without prefixes to be ignored: %v", err)
+		}
+	})
+}
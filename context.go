@@ -0,0 +1,226 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// defaultBatchWriterSize is the number of mutations a BatchWriter commits at once
+// unless told otherwise
+const defaultBatchWriterSize = 1000
+
+// Counters maintained by BatchWriter in the migration metrics
+const (
+	MetricKeysWritten = "keys_written"
+	MetricKeysDeleted = "keys_deleted"
+	MetricBatches     = "batches"
+)
+
+// ContextFunc is the signature for migration functions that receive a
+// MigrationContext
+type ContextFunc func(ctx *MigrationContext) error
+
+// MigrationContext is passed to the UpContext, DownContext and ValidateContext
+// functions of a migration. It is a context.Context, canceled when the migration
+// should stop, and carries what the engine provides to a running migration.
+type MigrationContext struct {
+	context.Context
+
+	DB          *pebble.DB
+	MigrationID string
+	Direction   string // "up" or "down"
+	Logger      Logger // Never nil
+
+	// DryRun is set when the migration runs against a throwaway copy of the
+	// database during a dry run. Skip side effects outside the database then.
+	DryRun bool
+
+	// Metrics holds counters of the run, readable afterwards through
+	// MigrationEngine.MigrationMetrics
+	Metrics *MigrationMetrics
+
+	progress       ProgressReporter
+	schemaManager  *SchemaManager     // Stores the progress of the migration; nil for the default keys
+	chunkPreImages bool               // Chunks record the previous values of the keys they write
+	abandoned      *MigrationProgress // Progress of the partial run a Down undoes, see AbandonMigration
+}
+
+// newMigrationContext creates the context of a migration run
+func newMigrationContext(ctx context.Context, db *pebble.DB, migrationID, direction string, logger Logger, progress ProgressReporter) *MigrationContext {
+	if logger == nil {
+		logger = &NopLogger{}
+	}
+	if progress == nil {
+		progress = ProgressFunc(nil)
+	}
+	return &MigrationContext{
+		Context:     ctx,
+		DB:          db,
+		MigrationID: migrationID,
+		Direction:   direction,
+		Logger:      logger,
+		Metrics:     NewMigrationMetrics(),
+		progress:    progress,
+	}
+}
+
+// Progress reports the progress of the migration to the plan's progress reporter
+func (c *MigrationContext) Progress(format string, args ...interface{}) {
+	c.ProgressPercent(-1, format, args...)
+}
+
+// ProgressPercent reports the progress of the migration with its completion in
+// percent
+func (c *MigrationContext) ProgressPercent(percent float64, format string, args ...interface{}) {
+	c.progress.Report(ProgressEvent{
+		Phase:       ProgressMigration,
+		MigrationID: c.MigrationID,
+		Direction:   c.Direction,
+		Percent:     percent,
+		Message:     fmt.Sprintf("%s: %s", c.MigrationID, fmt.Sprintf(format, args...)),
+	})
+}
+
+// WithContext adapts a MigrationFunc to a ContextFunc that runs it on ctx.DB
+func WithContext(fn MigrationFunc) ContextFunc {
+	return func(ctx *MigrationContext) error {
+		return fn(ctx.DB)
+	}
+}
+
+// WithoutContext adapts a ContextFunc to a MigrationFunc. The function gets a
+// background context, a NopLogger and no progress reporting.
+func WithoutContext(migrationID, direction string, fn ContextFunc) MigrationFunc {
+	return func(db *pebble.DB) error {
+		return fn(newMigrationContext(context.Background(), db, migrationID, direction, nil, nil))
+	}
+}
+
+// MigrationMetrics are named counters of a migration run. It is safe for
+// concurrent use.
+type MigrationMetrics struct {
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+// NewMigrationMetrics creates empty metrics
+func NewMigrationMetrics() *MigrationMetrics {
+	return &MigrationMetrics{counters: make(map[string]int64)}
+}
+
+// Add adds delta to a counter
+func (m *MigrationMetrics) Add(name string, delta int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += delta
+}
+
+// Get returns the value of a counter, 0 if it was never added to
+func (m *MigrationMetrics) Get(name string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name]
+}
+
+// Snapshot returns a copy of all counters
+func (m *MigrationMetrics) Snapshot() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]int64, len(m.counters))
+	for name, value := range m.counters {
+		snapshot[name] = value
+	}
+	return snapshot
+}
+
+// String formats the counters as "name=value" pairs in name order
+func (m *MigrationMetrics) String() string {
+	snapshot := m.Snapshot()
+	pairs := make([]string, 0, len(snapshot))
+	for name, value := range snapshot {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", name, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// BatchWriter writes to the database of a migration in batches of a fixed number
+// of mutations, counting the committed ones in the migration metrics. Before each
+// commit it checks the context, so a canceled migration stops between batches.
+type BatchWriter struct {
+	ctx     *MigrationContext
+	batch   *pebble.Batch
+	size    int
+	sets    int64
+	deletes int64
+}
+
+// NewBatchWriter creates a batch writer committing every size mutations, or
+// every 1000 if size is not positive. Call Flush to commit the last batch.
+func (c *MigrationContext) NewBatchWriter(size int) *BatchWriter {
+	if size <= 0 {
+		size = defaultBatchWriterSize
+	}
+	return &BatchWriter{ctx: c, batch: c.DB.NewBatch(), size: size}
+}
+
+// Set adds a write of key, committing the batch once it is full
+func (w *BatchWriter) Set(key, value []byte) error {
+	if err := w.batch.Set(key, value, nil); err != nil {
+		return err
+	}
+	w.sets++
+	return w.commitIfFull()
+}
+
+// Delete adds a delete of key, committing the batch once it is full
+func (w *BatchWriter) Delete(key []byte) error {
+	if err := w.batch.Delete(key, nil); err != nil {
+		return err
+	}
+	w.deletes++
+	return w.commitIfFull()
+}
+
+// Pending returns the number of uncommitted mutations
+func (w *BatchWriter) Pending() int {
+	return int(w.batch.Count())
+}
+
+func (w *BatchWriter) commitIfFull() error {
+	if w.Pending() < w.size {
+		return nil
+	}
+	return w.Flush()
+}
+
+// Flush commits the pending mutations. It fails without committing if the
+// context is canceled.
+func (w *BatchWriter) Flush() error {
+	if w.Pending() == 0 {
+		return nil
+	}
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if err := w.batch.Commit(pebble.Sync); err != nil {
+		return err
+	}
+	w.ctx.Metrics.Add(MetricKeysWritten, w.sets)
+	w.ctx.Metrics.Add(MetricKeysDeleted, w.deletes)
+	w.ctx.Metrics.Add(MetricBatches, 1)
+	w.sets, w.deletes = 0, 0
+	w.batch.Close()
+	w.batch = w.ctx.DB.NewBatch()
+	return nil
+}
+
+// Close releases the writer. Uncommitted mutations are discarded.
+func (w *BatchWriter) Close() error {
+	return w.batch.Close()
+}
@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestMigrationContext(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	var validated bool
+	err = registry.Register(&Migration{
+		ID:          "1754917200_backfill",
+		Description: "Backfill",
+		UpContext: func(ctx *MigrationContext) error {
+			w := ctx.NewBatchWriter(10)
+			defer w.Close()
+			for i := 0; i < 25; i++ {
+				if err := w.Set([]byte(fmt.Sprintf("item/%02d", i)), []byte("v")); err != nil {
+					return err
+				}
+			}
+			ctx.Progress("wrote %d keys", 25)
+			return w.Flush()
+		},
+		DownContext: WithContext(func(db *pebble.DB) error {
+			return db.DeleteRange([]byte("item/"), []byte("item0"), pebble.Sync)
+		}),
+		ValidateContext: func(ctx *MigrationContext) error {
+			validated = ctx.Direction == "up" && !ctx.DryRun
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	migration, _ := registry.GetMigration("1754917200_backfill")
+	if migration.Up == nil || migration.Down == nil || migration.Validate == nil {
+		t.Fatalf("Expected plain functions to be derived from the context functions")
+	}
+
+	t.Run("Upgrade", func(t *testing.T) {
+		plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err != nil {
+			t.Fatalf("Failed to plan: %v", err)
+		}
+		var messages []string
+		if err := engine.ExecutePlan(plan, func(msg string) { messages = append(messages, msg) }); err != nil {
+			t.Fatalf("Failed to execute: %v", err)
+		}
+
+		if !strings.Contains(strings.Join(messages, "\n"), "1754917200_backfill: wrote 25 keys") {
+			t.Errorf("Expected the migration's progress to be reported, got %q", messages)
+		}
+		if !validated {
+			t.Errorf("Expected ValidateContext to run")
+		}
+		metrics := engine.MigrationMetrics("1754917200_backfill")
+		if metrics == nil || metrics.Get(MetricKeysWritten) != 25 || metrics.Get(MetricBatches) != 3 {
+			t.Errorf("Expected 25 keys in 3 batches, got %v", metrics)
+		}
+	})
+
+	t.Run("Downgrade", func(t *testing.T) {
+		plan, err := NewMigrationPlanner(registry, schemaManager).PlanDowngrade(0)
+		if err != nil {
+			t.Fatalf("Failed to plan: %v", err)
+		}
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to execute: %v", err)
+		}
+		if _, closer, err := db.Get([]byte("item/00")); err == nil {
+			closer.Close()
+			t.Errorf("Expected DownContext to remove the keys")
+		}
+	})
+
+	t.Run("CanceledBatchIsNotCommitted", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+		ctx := newMigrationContext(canceled, db, "test", "up", nil, nil)
+		w := ctx.NewBatchWriter(0)
+		defer w.Close()
+		w.Set([]byte("canceled"), []byte("v"))
+		if err := w.Flush(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected context.Canceled, got %v", err)
+		}
+		if _, closer, err := db.Get([]byte("canceled")); err == nil {
+			closer.Close()
+			t.Errorf("Expected the batch not to be committed")
+		}
+	})
+
+	t.Run("ApplyAndUpContextConflict", func(t *testing.T) {
+		err := NewMigrationRegistry().Register(&Migration{
+			ID:        "1754917300_both",
+			Apply:     func(w *Writer) error { return nil },
+			UpContext: func(ctx *MigrationContext) error { return nil },
+		})
+		if err == nil {
+			t.Errorf("Expected registering both Apply and UpContext to fail")
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package migrate
+
+// Coordinator coordinates the startup migrations of nodes that each own a
+// replica of a database, e.g. to apply a plan on the leader first and on the
+// followers once the leader validated it. Implementations typically build on
+// the leader election of the deployment.
+type Coordinator interface {
+	// BeforeMigrate is called with the pending plan before it runs and returns
+	// whether this node runs it now. It may block, e.g. while a follower waits for
+	// the leader. A node that does not run the plan starts without migrating. An
+	// error fails the startup.
+	BeforeMigrate(plan *ExecutionPlan) (bool, error)
+
+	// AfterMigrate is called after the plan ran, with its error if it failed,
+	// e.g. for the leader to release the followers. An error fails the startup.
+	AfterMigrate(plan *ExecutionPlan, migrateErr error) error
+}
+
+// NopCoordinator lets every node migrate on its own. It is the default.
+type NopCoordinator struct{}
+
+// BeforeMigrate lets the node run the plan.
+func (NopCoordinator) BeforeMigrate(plan *ExecutionPlan) (bool, error) { return true, nil }
+
+// AfterMigrate does nothing.
+func (NopCoordinator) AfterMigrate(plan *ExecutionPlan, migrateErr error) error { return nil }
@@ -0,0 +1,93 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// recordingCoordinator records the calls of the startup path
+type recordingCoordinator struct {
+	allow     bool
+	beforeErr error
+	before    *ExecutionPlan
+	after     bool
+	afterErr  error
+}
+
+func (c *recordingCoordinator) BeforeMigrate(plan *ExecutionPlan) (bool, error) {
+	c.before = plan
+	return c.allow, c.beforeErr
+}
+
+func (c *recordingCoordinator) AfterMigrate(plan *ExecutionPlan, migrateErr error) error {
+	c.after = true
+	c.afterErr = migrateErr
+	return nil
+}
+
+func TestStartupCoordinator(t *testing.T) {
+	originalRegistry := GlobalRegistry
+	defer func() { GlobalRegistry = originalRegistry }()
+	GlobalRegistry = NewMigrationRegistry()
+	GlobalRegistry.Register(&Migration{
+		ID:   "1754917300_shared",
+		Up:   func(db *pebble.DB) error { return nil },
+		Down: func(db *pebble.DB) error { return nil },
+	})
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	// A database with data is not fresh, so the migration is pending
+	db.Set([]byte("data"), []byte("value"), pebble.Sync)
+
+	opts := DefaultStartupOptions()
+	opts.RunMigrations = true
+	opts.CheckDiskSpace = false
+	opts.Logger = &NopLogger{}
+
+	t.Run("ErrorFailsStartup", func(t *testing.T) {
+		errLeaderGone := errors.New("leader gone")
+		opts.Coordinator = &recordingCoordinator{beforeErr: errLeaderGone}
+		if err := CheckAndRunStartupMigrations(db, dbPath, opts); !errors.Is(err, errLeaderGone) {
+			t.Fatalf("Expected the coordinator error, got %v", err)
+		}
+	})
+
+	t.Run("FollowerStartsWithoutMigrating", func(t *testing.T) {
+		coordinator := &recordingCoordinator{allow: false}
+		opts.Coordinator = coordinator
+		if err := CheckAndRunStartupMigrations(db, dbPath, opts); err != nil {
+			t.Fatalf("Expected a follower to start: %v", err)
+		}
+		if coordinator.before == nil || len(coordinator.before.Migrations) != 1 {
+			t.Fatalf("Expected the coordinator to see the pending plan, got %+v", coordinator.before)
+		}
+		if coordinator.after {
+			t.Errorf("Expected no AfterMigrate call on a node that did not migrate")
+		}
+		if applied, _ := NewSchemaManager(db).IsMigrationApplied("1754917300_shared"); applied {
+			t.Errorf("Expected the migration not to run on a follower")
+		}
+	})
+
+	t.Run("LeaderMigrates", func(t *testing.T) {
+		coordinator := &recordingCoordinator{allow: true}
+		opts.Coordinator = coordinator
+		if err := CheckAndRunStartupMigrations(db, dbPath, opts); err != nil {
+			t.Fatalf("Expected the leader to migrate: %v", err)
+		}
+		if !coordinator.after || coordinator.afterErr != nil {
+			t.Errorf("Expected AfterMigrate to see the successful run, got called=%v err=%v", coordinator.after, coordinator.afterErr)
+		}
+		if applied, _ := NewSchemaManager(db).IsMigrationApplied("1754917300_shared"); !applied {
+			t.Errorf("Expected the migration to run on the leader")
+		}
+	})
+}
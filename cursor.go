@@ -0,0 +1,300 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// progressInfix follows the key prefix in the keys the progress of running
+// migrations is stored under
+const progressInfix = "progress_"
+
+// preImageInfix follows the key prefix in the keys the pre-images of committed
+// chunks are stored under (see Migration.ChunkPreImages)
+const preImageInfix = "preimage_"
+
+// MigrationProgress is the persisted progress of a long-running migration that
+// processes its data in chunks, e.g. a backfill. It is saved by the migration
+// with MigrationContext.SaveProgress, survives interruptions so the migration can
+// resume from Cursor, and is removed once the migration completes.
+type MigrationProgress struct {
+	MigrationID string    `json:"migration_id"`
+	Direction   string    `json:"direction"`        // "up" or "down"
+	Cursor      []byte    `json:"cursor,omitempty"` // Where the migration resumes, e.g. the last processed key
+	Percent     float64   `json:"percent"`          // Completion of the migration; -1 if unknown
+	Chunks      int64     `json:"chunks"`           // Number of chunks done
+	StartedAt   time.Time `json:"started_at"`       // First chunk
+	UpdatedAt   time.Time `json:"updated_at"`       // Last chunk
+}
+
+// progressKey returns the internal key the progress of a migration is stored under
+func (s *SchemaManager) progressKey(migrationID string) []byte {
+	return []byte(s.keyPrefix + progressInfix + migrationID)
+}
+
+// preImagePrefix returns the prefix of the keys the pre-images of the chunks of a
+// migration are stored under, one key per chunk
+func (s *SchemaManager) preImagePrefix(migrationID string) []byte {
+	return []byte(s.keyPrefix + preImageInfix + migrationID + "/")
+}
+
+// preImageKey returns the internal key the pre-images of a chunk are stored under
+func (s *SchemaManager) preImageKey(migrationID string, chunk int64) []byte {
+	return append(s.preImagePrefix(migrationID), fmt.Sprintf("%016x", chunk)...)
+}
+
+// GetMigrationProgress returns the persisted progress of a migration, or nil if
+// none is stored
+func (s *SchemaManager) GetMigrationProgress(migrationID string) (*MigrationProgress, error) {
+	data, err := getCopy(s.db, s.progressKey(migrationID))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read progress of %s: %w", migrationID, err)
+	}
+
+	var progress MigrationProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return nil, fmt.Errorf("%w: progress of %s: %v", ErrCorruptSchemaState, migrationID, err)
+	}
+	return &progress, nil
+}
+
+// ListMigrationProgress returns the persisted progress of all migrations that
+// are in flight or were interrupted, ordered by migration ID
+func (s *SchemaManager) ListMigrationProgress() ([]*MigrationProgress, error) {
+	prefix := []byte(s.keyPrefix + progressInfix)
+	iter, err := s.db.NewIter(&pebble.IterOptions{LowerBound: prefix, UpperBound: prefixUpperBound(prefix)})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var list []*MigrationProgress
+	for iter.First(); iter.Valid(); iter.Next() {
+		var progress MigrationProgress
+		if err := json.Unmarshal(iter.Value(), &progress); err != nil {
+			return nil, fmt.Errorf("%w: progress key %s: %v", ErrCorruptSchemaState, iter.Key(), err)
+		}
+		list = append(list, &progress)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].MigrationID < list[j].MigrationID })
+	return list, nil
+}
+
+// saveMigrationProgress stores the progress of a migration
+func (s *SchemaManager) saveMigrationProgress(progress *MigrationProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Set(s.progressKey(progress.MigrationID), data, pebble.Sync); err != nil {
+		return fmt.Errorf("failed to save progress of %s: %w", progress.MigrationID, err)
+	}
+	return nil
+}
+
+// ClearMigrationProgress removes the persisted progress of a migration and the
+// pre-images of its chunks. The engine calls it when the migration completes.
+func (s *SchemaManager) ClearMigrationProgress(migrationID string) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	prefix := s.preImagePrefix(migrationID)
+	if err := batch.DeleteRange(prefix, prefixUpperBound(prefix), nil); err != nil {
+		return err
+	}
+	if err := batch.Delete(s.progressKey(migrationID), nil); err != nil {
+		return err
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return fmt.Errorf("failed to clear progress of %s: %w", migrationID, err)
+	}
+	return nil
+}
+
+// SavedProgress returns the progress the migration saved in this direction
+// before it was interrupted, to resume from its Cursor, or nil on a fresh start
+func (c *MigrationContext) SavedProgress() (*MigrationProgress, error) {
+	progress, err := c.schema().GetMigrationProgress(c.MigrationID)
+	if err != nil || progress == nil || progress.Direction != c.Direction {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// SaveProgress persists that a chunk is done: the migration resumes from cursor
+// after an interruption, and status shows percent (-1 if unknown), the number of
+// chunks and the time of the last one. The progress is also reported to the
+// plan's progress reporter.
+//
+// SaveProgress commits the cursor alone. A migration whose chunks write data
+// should commit them with NewChunk instead, so that the data and the cursor
+// cannot diverge.
+func (c *MigrationContext) SaveProgress(cursor []byte, percent float64) error {
+	chunk := c.NewChunk()
+	defer chunk.Close()
+	return chunk.Commit(cursor, percent)
+}
+
+// Chunk is a chunk of a chunked migration: its writes and the cursor after it
+// are committed in one batch. An interrupted migration therefore finds either
+// both or neither, and resumes from the saved cursor without redoing or losing
+// writes.
+type Chunk struct {
+	ctx       *MigrationContext
+	batch     *pebble.Batch
+	preImages *OpLog // Previous values of the written keys, if recorded
+	sets      int64
+	deletes   int64
+}
+
+// NewChunk starts a chunk. Add its writes with Set and Delete, then commit them
+// with the cursor with Commit, or discard them with Close.
+func (c *MigrationContext) NewChunk() *Chunk {
+	chunk := &Chunk{ctx: c, batch: c.DB.NewBatch()}
+	if c.chunkPreImages {
+		chunk.preImages = NewOpLog(c.MigrationID)
+	}
+	return chunk
+}
+
+// Set adds a write of key to the chunk
+func (ch *Chunk) Set(key, value []byte) error {
+	if err := ch.recordPreImage(OpSet, key, value); err != nil {
+		return err
+	}
+	if err := ch.batch.Set(key, value, nil); err != nil {
+		return err
+	}
+	ch.sets++
+	return nil
+}
+
+// Delete adds a delete of key to the chunk
+func (ch *Chunk) Delete(key []byte) error {
+	if err := ch.recordPreImage(OpDelete, key, nil); err != nil {
+		return err
+	}
+	if err := ch.batch.Delete(key, nil); err != nil {
+		return err
+	}
+	ch.deletes++
+	return nil
+}
+
+// recordPreImage records the value of key before the chunk, if pre-images are
+// recorded. A key written twice in a chunk gets the same pre-image twice.
+func (ch *Chunk) recordPreImage(kind OpKind, key, value []byte) error {
+	if ch.preImages == nil {
+		return nil
+	}
+	op, err := newOp(ch.ctx.DB, kind, key, value)
+	if err != nil {
+		return err
+	}
+	ch.preImages.Ops = append(ch.preImages.Ops, op)
+	return nil
+}
+
+// Pending returns the number of mutations in the chunk
+func (ch *Chunk) Pending() int {
+	return int(ch.batch.Count())
+}
+
+// Commit commits the writes of the chunk together with the progress of the
+// migration, see SaveProgress. It fails without committing anything if the
+// context is canceled, so a canceled migration resumes after the last committed
+// chunk. A chunk is committed once; start the next one with NewChunk.
+func (ch *Chunk) Commit(cursor []byte, percent float64) error {
+	if err := ch.ctx.Err(); err != nil {
+		return err
+	}
+
+	progress, err := ch.ctx.SavedProgress()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if progress == nil {
+		progress = &MigrationProgress{MigrationID: ch.ctx.MigrationID, Direction: ch.ctx.Direction, StartedAt: now}
+	}
+	progress.Cursor = append([]byte(nil), cursor...)
+	progress.Percent = percent
+	progress.Chunks++
+	progress.UpdatedAt = now
+
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	if err := ch.batch.Set(ch.ctx.schema().progressKey(progress.MigrationID), data, nil); err != nil {
+		return err
+	}
+	if ch.preImages != nil && len(ch.preImages.Ops) > 0 {
+		data, err := ch.preImages.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := ch.batch.Set(ch.ctx.schema().preImageKey(progress.MigrationID, progress.Chunks), data, nil); err != nil {
+			return err
+		}
+	}
+	if err := ch.batch.Commit(pebble.Sync); err != nil {
+		return fmt.Errorf("failed to commit chunk %d of %s: %w", progress.Chunks, progress.MigrationID, err)
+	}
+	ch.ctx.Metrics.Add(MetricKeysWritten, ch.sets)
+	ch.ctx.Metrics.Add(MetricKeysDeleted, ch.deletes)
+	ch.ctx.Metrics.Add(MetricBatches, 1)
+
+	ch.ctx.ProgressPercent(percent, "chunk %d done", progress.Chunks)
+	return nil
+}
+
+// Close releases the chunk. Uncommitted writes are discarded.
+func (ch *Chunk) Close() error {
+	return ch.batch.Close()
+}
+
+// validateSavedProgress checks the progress a migration saved in direction
+// before it was interrupted, if any, before the engine resumes it
+func (e *MigrationEngine) validateSavedProgress(migration *Migration, direction string, metrics *MigrationMetrics, progress ProgressReporter) error {
+	saved, err := e.schemaManager.GetMigrationProgress(migration.ID)
+	if err != nil || saved == nil || saved.Direction != direction {
+		return err
+	}
+	if saved.MigrationID != migration.ID || saved.Chunks < 1 || saved.UpdatedAt.Before(saved.StartedAt) {
+		return fmt.Errorf("%w: progress of %s is inconsistent: %+v", ErrInvalidCursor, migration.ID, saved)
+	}
+
+	ctx := newMigrationContext(context.Background(), e.db, migration.ID, direction, e.log(), progress)
+	if metrics != nil {
+		ctx.Metrics = metrics
+	}
+	ctx.schemaManager = e.schemaManager
+	if migration.ValidateCursor != nil {
+		if err := migration.ValidateCursor(ctx, saved); err != nil {
+			return fmt.Errorf("%w: %s at chunk %d: %v", ErrInvalidCursor, migration.ID, saved.Chunks, err)
+		}
+	}
+	ctx.ProgressPercent(saved.Percent, "resuming after chunk %d", saved.Chunks)
+	return nil
+}
+
+// schema returns the schema manager of the engine running the migration, or one
+// with the default keys
+func (c *MigrationContext) schema() *SchemaManager {
+	if c.schemaManager == nil {
+		return NewSchemaManager(c.DB)
+	}
+	return c.schemaManager
+}
@@ -0,0 +1,244 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestMigrationProgress(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	schemaManager := NewSchemaManager(db)
+	schemaManager.SetKeyPrefix("__custom_")
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	// Backfills 10 items in chunks of 2, failing after the third chunk on the
+	// first run
+	failAfter := 3
+	var resumedFrom []byte
+	err = registry.Register(&Migration{
+		ID: "1754917200_backfill",
+		UpContext: func(ctx *MigrationContext) error {
+			start := 0
+			saved, err := ctx.SavedProgress()
+			if err != nil {
+				return err
+			}
+			if saved != nil {
+				resumedFrom = saved.Cursor
+				fmt.Sscanf(string(saved.Cursor), "item/%d", &start)
+				start++
+			}
+			for i := start; i < 10; i += 2 {
+				if err := ctx.DB.Set([]byte(fmt.Sprintf("item/%d", i)), []byte("v"), pebble.Sync); err != nil {
+					return err
+				}
+				if err := ctx.DB.Set([]byte(fmt.Sprintf("item/%d", i+1)), []byte("v"), pebble.Sync); err != nil {
+					return err
+				}
+				if err := ctx.SaveProgress([]byte(fmt.Sprintf("item/%d", i+1)), float64(i+2)*10); err != nil {
+					return err
+				}
+				if failAfter--; failAfter == 0 {
+					return errors.New("interrupted")
+				}
+			}
+			return nil
+		},
+		Down: func(db *pebble.DB) error { return nil },
+	})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err == nil {
+		t.Fatalf("Expected the first run to fail")
+	}
+
+	progress, err := schemaManager.ListMigrationProgress()
+	if err != nil {
+		t.Fatalf("Failed to list progress: %v", err)
+	}
+	if len(progress) != 1 {
+		t.Fatalf("Expected the progress of the interrupted migration, got %+v", progress)
+	}
+	p := progress[0]
+	if p.MigrationID != "1754917200_backfill" || p.Direction != "up" || string(p.Cursor) != "item/5" || p.Percent != 60 || p.Chunks != 3 {
+		t.Errorf("Unexpected progress: %+v", p)
+	}
+	if p.StartedAt.IsZero() || p.UpdatedAt.Before(p.StartedAt) {
+		t.Errorf("Unexpected progress times: %+v", p)
+	}
+
+	if err := schemaManager.ForceCleanState(); err != nil {
+		t.Fatalf("Failed to clean state: %v", err)
+	}
+	plan, err = NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	if string(resumedFrom) != "item/5" {
+		t.Errorf("Expected the migration to resume from item/5, got %q", resumedFrom)
+	}
+	if p, err := schemaManager.GetMigrationProgress("1754917200_backfill"); err != nil || p != nil {
+		t.Errorf("Expected the progress to be cleared after completion, got %+v, %v", p, err)
+	}
+}
+
+func TestChunkCommit(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	// Backfills 6 items in chunks of 2, interrupted in the middle of the third
+	// chunk on the first run
+	interrupt := true
+	cursorValid := true
+	err = registry.Register(&Migration{
+		ID: "1754917200_backfill",
+		UpContext: func(ctx *MigrationContext) error {
+			start := 0
+			saved, err := ctx.SavedProgress()
+			if err != nil {
+				return err
+			}
+			if saved != nil {
+				fmt.Sscanf(string(saved.Cursor), "item/%d", &start)
+				start++
+			}
+			for i := start; i < 6; i += 2 {
+				chunk := ctx.NewChunk()
+				if err := chunk.Set([]byte(fmt.Sprintf("item/%d", i)), []byte("v")); err != nil {
+					return err
+				}
+				if interrupt && i == 4 {
+					chunk.Close()
+					return errors.New("interrupted")
+				}
+				if err := chunk.Set([]byte(fmt.Sprintf("item/%d", i+1)), []byte("v")); err != nil {
+					return err
+				}
+				if err := chunk.Commit([]byte(fmt.Sprintf("item/%d", i+1)), float64(i+2)*100/6); err != nil {
+					return err
+				}
+				chunk.Close()
+			}
+			return nil
+		},
+		ValidateCursor: func(ctx *MigrationContext, progress *MigrationProgress) error {
+			_, closer, err := ctx.DB.Get(progress.Cursor)
+			if err != nil {
+				return err
+			}
+			closer.Close()
+			if !cursorValid {
+				return errors.New("data behind cursor")
+			}
+			return nil
+		},
+		Down: func(db *pebble.DB) error { return nil },
+	})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	run := func() error {
+		if err := schemaManager.ForceCleanState(); err != nil {
+			t.Fatalf("Failed to clean state: %v", err)
+		}
+		plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err != nil {
+			t.Fatalf("Failed to plan: %v", err)
+		}
+		return engine.ExecutePlan(plan, nil)
+	}
+
+	if err := run(); err == nil {
+		t.Fatalf("Expected the first run to fail")
+	}
+	p, err := schemaManager.GetMigrationProgress("1754917200_backfill")
+	if err != nil || p == nil || string(p.Cursor) != "item/3" || p.Chunks != 2 {
+		t.Fatalf("Expected the progress of the committed chunks, got %+v, %v", p, err)
+	}
+	if _, _, err := db.Get([]byte("item/4")); err != pebble.ErrNotFound {
+		t.Errorf("Expected the writes of the interrupted chunk to be discarded, got %v", err)
+	}
+
+	interrupt = false
+	cursorValid = false
+	if err := run(); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("Expected ErrInvalidCursor, got %v", err)
+	}
+	if p, err := schemaManager.GetMigrationProgress("1754917200_backfill"); err != nil || p == nil || p.Chunks != 2 {
+		t.Errorf("Expected the progress to be kept after a failed validation, got %+v, %v", p, err)
+	}
+
+	cursorValid = true
+	if err := run(); err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		if _, closer, err := db.Get([]byte(fmt.Sprintf("item/%d", i))); err != nil {
+			t.Errorf("Expected item/%d to be written: %v", i, err)
+		} else {
+			closer.Close()
+		}
+	}
+	if metrics := engine.MigrationMetrics("1754917200_backfill"); metrics == nil || metrics.Get(MetricKeysWritten) != 2 || metrics.Get(MetricBatches) != 1 {
+		t.Errorf("Expected the resumed run to count one chunk of 2 keys, got %+v", metrics)
+	}
+}
+
+func TestChunkCommitCanceled(t *testing.T) {
+	db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx := newMigrationContext(canceled, db, "1754917200_backfill", "up", nil, nil)
+
+	chunk := ctx.NewChunk()
+	defer chunk.Close()
+	if err := chunk.Set([]byte("item/0"), []byte("v")); err != nil {
+		t.Fatalf("Failed to set: %v", err)
+	}
+	if err := chunk.Commit([]byte("item/0"), 50); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if _, _, err := db.Get([]byte("item/0")); err != pebble.ErrNotFound {
+		t.Errorf("Expected no write after cancellation, got %v", err)
+	}
+	if p, err := ctx.SavedProgress(); err != nil || p != nil {
+		t.Errorf("Expected no progress after cancellation, got %+v, %v", p, err)
+	}
+}
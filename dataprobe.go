@@ -0,0 +1,29 @@
+package migrate
+
+import "strings"
+
+// DataProbe reports whether a key is application data. A database without
+// schema state that has such a key predates the migrations and starts at
+// version 0; one without is fresh (see SchemaManager.InitializeDatabase).
+type DataProbe func(key []byte) bool
+
+// DataPrefixesProbe returns a probe counting only the keys under one of
+// prefixes as application data, e.g. to ignore metadata the application writes
+// before the migrations are checked
+func DataPrefixesProbe(prefixes ...string) DataProbe {
+	return func(key []byte) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(string(key), prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SetDataProbe sets the probe telling application data from other keys when
+// classifying a database without schema state. By default, and with nil, any
+// key is application data.
+func (s *SchemaManager) SetDataProbe(probe DataProbe) {
+	s.dataProbe = probe
+}
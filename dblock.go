@@ -0,0 +1,83 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// DatabaseLockedError is returned by ExplainOpenError when another process holds
+// the lock of the database directory. It matches ErrDatabaseLocked with errors.Is.
+type DatabaseLockedError struct {
+	Path    string // Database directory
+	PID     int    // Process holding the lock, 0 if unknown
+	Command string // Command line of that process, if known
+	Err     error  // Error opening the database
+}
+
+func (e *DatabaseLockedError) Error() string {
+	switch {
+	case e.PID != 0 && e.Command != "":
+		return fmt.Sprintf("%v: %s is held by process %d (%s)", ErrDatabaseLocked, e.Path, e.PID, e.Command)
+	case e.PID != 0:
+		return fmt.Sprintf("%v: %s is held by process %d", ErrDatabaseLocked, e.Path, e.PID)
+	}
+	return fmt.Sprintf("%v: %s is held by another process (%v)", ErrDatabaseLocked, e.Path, e.Err)
+}
+
+func (e *DatabaseLockedError) Unwrap() error {
+	return ErrDatabaseLocked
+}
+
+// ExplainOpenError returns a *DatabaseLockedError naming the process that holds
+// the lock if err, returned by pebble.Open for the database at path, means the
+// database is open in another process, e.g. the running application. Other
+// errors are returned unchanged.
+func ExplainOpenError(path string, err error) error {
+	if err == nil || !isLockConflict(err) {
+		return err
+	}
+	lockedErr := &DatabaseLockedError{Path: path, Err: err}
+	if pid := lockHolder(filepath.Join(path, "LOCK")); pid > 0 {
+		lockedErr.PID = pid
+		lockedErr.Command = processCommand(pid)
+	}
+	return lockedErr
+}
+
+// isLockConflict reports whether an error of pebble.Open means that the lock of
+// the database directory is held
+func isLockConflict(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EACCES) ||
+		strings.Contains(err.Error(), "lock held by current process")
+}
+
+// processCommand returns the command line of a process, or "" if it cannot be
+// read. Only Linux exposes it, in /proc.
+func processCommand(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+}
+
+// lockHolder returns the process holding the lock pebble takes on a LOCK file,
+// or 0 if it is not held or cannot be determined
+func lockHolder(lockPath string) int {
+	file, err := os.OpenFile(lockPath, os.O_RDWR, 0)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	spec := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: io.SeekStart}
+	if err := syscall.FcntlFlock(file.Fd(), syscall.F_GETLK, &spec); err != nil || spec.Type == syscall.F_UNLCK {
+		return 0
+	}
+	return int(spec.Pid)
+}
@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestExplainOpenError(t *testing.T) {
+	// Helper process holding the database until its stdin is closed
+	if dbPath := os.Getenv("PEBBLE_MIGRATE_TEST_HOLD_DB"); dbPath != "" {
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		os.Stdout.WriteString("ready\n")
+		bufio.NewReader(os.Stdin).ReadString('\n')
+		return
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	t.Run("HeldByThisProcess", func(t *testing.T) {
+		_, err := pebble.Open(dbPath, &pebble.Options{})
+		if err = ExplainOpenError(dbPath, err); !errors.Is(err, ErrDatabaseLocked) {
+			t.Errorf("Expected ErrDatabaseLocked, got %v", err)
+		}
+	})
+	db.Close()
+
+	t.Run("HeldByAnotherProcess", func(t *testing.T) {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestExplainOpenError$")
+		cmd.Env = append(os.Environ(), "PEBBLE_MIGRATE_TEST_HOLD_DB="+dbPath)
+		stdin, _ := cmd.StdinPipe()
+		stdout, _ := cmd.StdoutPipe()
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start helper: %v", err)
+		}
+		defer cmd.Wait()
+		defer stdin.Close()
+		if line, _ := bufio.NewReader(stdout).ReadString('\n'); line != "ready\n" {
+			t.Fatalf("Helper did not open the database: %q", line)
+		}
+
+		_, err := pebble.Open(dbPath, &pebble.Options{ReadOnly: true})
+		var lockedErr *DatabaseLockedError
+		if !errors.As(ExplainOpenError(dbPath, err), &lockedErr) {
+			t.Fatalf("Expected a *DatabaseLockedError, got %v", err)
+		}
+		if lockedErr.PID != cmd.Process.Pid {
+			t.Errorf("Expected the helper's pid %d, got %d", cmd.Process.Pid, lockedErr.PID)
+		}
+	})
+
+	t.Run("OtherErrorsUnchanged", func(t *testing.T) {
+		openErr := errors.New("corrupt manifest")
+		if err := ExplainOpenError(dbPath, openErr); err != openErr {
+			t.Errorf("Expected the error unchanged, got %v", err)
+		}
+	})
+}
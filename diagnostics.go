@@ -0,0 +1,166 @@
+package migrate
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiagnosticLogLines is the number of the last progress messages of a failed
+// plan included in its diagnostic bundle
+const DiagnosticLogLines = 200
+
+// diagnosticPlanRecords is the number of the last plan records included in a
+// diagnostic bundle
+const diagnosticPlanRecords = 10
+
+// messageTail keeps the last progress messages of a plan execution and passes
+// the events on
+type messageTail struct {
+	mu    sync.Mutex
+	lines []string
+	next  ProgressReporter
+}
+
+// Report keeps the message of the event and passes the event on
+func (t *messageTail) Report(event ProgressEvent) {
+	if event.Message != "" {
+		t.mu.Lock()
+		t.lines = append(t.lines, time.Now().Format(time.RFC3339Nano)+" "+event.Message)
+		if len(t.lines) > DiagnosticLogLines {
+			t.lines = t.lines[len(t.lines)-DiagnosticLogLines:]
+		}
+		t.mu.Unlock()
+	}
+	t.next.Report(event)
+}
+
+// Lines returns the kept messages, oldest first
+func (t *messageTail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+// diagnosticFile is a file of a diagnostic bundle
+type diagnosticFile struct {
+	name string
+	data []byte
+}
+
+// writeDiagnosticBundle collects the diagnostics of a failed plan into a tar.gz
+// next to the database and returns its path. It holds the error, the plan, the
+// schema state with its history, the last plan records, the last progress
+// messages, the Pebble metrics and the stacks of all goroutines. Parts that
+// cannot be collected are replaced by the error collecting them.
+func (e *MigrationEngine) writeDiagnosticBundle(plan *ExecutionPlan, planErr error, lines []string) (string, error) {
+	now := time.Now()
+	files := []diagnosticFile{
+		{"error.txt", []byte(fmt.Sprintf("time: %s\nerror: %v\n", now.Format(time.RFC3339Nano), planErr))},
+		{"plan.json", diagnosticJSON(summarizePlan(plan), nil)},
+		{"schema.json", diagnosticJSON(e.schemaManager.GetSchemaVersion())},
+		{"plans.json", diagnosticJSON(e.lastPlanRecords())},
+		{"log.txt", []byte(strings.Join(lines, "\n") + "\n")},
+		{"pebble_metrics.txt", []byte(e.db.Metrics().String())},
+		{"goroutines.txt", goroutineStacks()},
+	}
+
+	name := fmt.Sprintf("%s.diagnostics_%s", filepath.Base(e.dbPath), now.Format("20060102_150405"))
+	path := filepath.Join(filepath.Dir(e.dbPath), name+".tar.gz")
+	if err := writeTarGz(path, name, files, now); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write diagnostic bundle: %w", err)
+	}
+	return path, nil
+}
+
+// planSummary is the plan as written to a diagnostic bundle
+type planSummary struct {
+	Type           ExecutionType `json:"type"`
+	CurrentVersion int64         `json:"current_version"`
+	TargetVersion  int64         `json:"target_version"`
+	Migrations     []string      `json:"migrations"`
+}
+
+// summarizePlan returns the summary of a plan
+func summarizePlan(plan *ExecutionPlan) planSummary {
+	summary := planSummary{Type: plan.Type, CurrentVersion: plan.CurrentVersion, TargetVersion: plan.TargetVersion}
+	for _, migration := range plan.Migrations {
+		summary.Migrations = append(summary.Migrations, migration.ID)
+	}
+	return summary
+}
+
+// lastPlanRecords returns the last recorded plans, oldest first
+func (e *MigrationEngine) lastPlanRecords() ([]PlanRecord, error) {
+	records, err := e.schemaManager.PlanHistory()
+	if len(records) > diagnosticPlanRecords {
+		records = records[len(records)-diagnosticPlanRecords:]
+	}
+	return records, err
+}
+
+// diagnosticJSON returns v as indented JSON, or the error collecting or
+// marshaling it
+func diagnosticJSON(v interface{}, err error) []byte {
+	if err != nil {
+		return []byte(fmt.Sprintf("error: %v\n", err))
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return []byte(fmt.Sprintf("error: %v\n", err))
+	}
+	return append(data, '\n')
+}
+
+// goroutineStacks returns the stacks of all goroutines
+func goroutineStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// writeTarGz writes files into a tar.gz at path, under the directory dir
+func writeTarGz(path, dir string, files []diagnosticFile, modTime time.Time) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, f := range files {
+		header := &tar.Header{
+			Name:    dir + "/" + f.name,
+			Mode:    0644,
+			Size:    int64(len(f.data)),
+			ModTime: modTime,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tarWriter.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
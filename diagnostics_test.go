@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestDiagnosticBundle(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	registry.Register(&Migration{
+		ID:   "1754917200_broken",
+		Up:   func(db *pebble.DB) error { return errors.New("boom") },
+		Down: func(db *pebble.DB) error { return nil },
+	})
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+	engine.SetLogger(&NopLogger{})
+
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	var reported string
+	err = engine.ExecutePlanWithProgress(plan, ProgressEventFunc(func(event ProgressEvent) {
+		if event.Phase == ProgressWarning && strings.HasPrefix(event.Message, "Diagnostic bundle written to ") {
+			reported = strings.TrimPrefix(event.Message, "Diagnostic bundle written to ")
+		}
+	}))
+	if err == nil {
+		t.Fatalf("Expected the broken migration to fail the plan")
+	}
+	if reported == "" || filepath.Dir(reported) != dir {
+		t.Fatalf("Expected the bundle path next to the database, got %q", reported)
+	}
+
+	file, err := os.Open(reported)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	contents := map[string]string{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read bundle: %v", err)
+		}
+		data, _ := io.ReadAll(tarReader)
+		contents[filepath.Base(header.Name)] = string(data)
+	}
+
+	for _, name := range []string{"error.txt", "plan.json", "schema.json", "plans.json", "log.txt", "pebble_metrics.txt", "goroutines.txt"} {
+		if _, ok := contents[name]; !ok {
+			t.Errorf("Expected %s in the bundle", name)
+		}
+	}
+	if !strings.Contains(contents["error.txt"], "boom") {
+		t.Errorf("Expected the error in error.txt, got %q", contents["error.txt"])
+	}
+	if !strings.Contains(contents["plan.json"], "1754917200_broken") || !strings.Contains(contents["schema.json"], "1754917200_broken") {
+		t.Errorf("Expected the plan and the failed history record in the bundle")
+	}
+	if !strings.Contains(contents["log.txt"], "Starting upgrade...") {
+		t.Errorf("Expected the progress messages in log.txt, got %q", contents["log.txt"])
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		os.Remove(reported)
+		engine.SetDiagnostics(false)
+		schemaManager.ForceCleanState()
+		engine.ExecutePlan(plan, nil)
+		if matches, _ := filepath.Glob(dbPath + ".diagnostics_*"); len(matches) != 0 {
+			t.Errorf("Expected no bundle with diagnostics disabled, got %v", matches)
+		}
+	})
+}
@@ -0,0 +1,275 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// maxSampledChanges is the number of key changes a dry run keeps per migration
+const maxSampledChanges = 20
+
+// ChangeKind describes how a key was changed
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeModified ChangeKind = "modified"
+	ChangeDeleted  ChangeKind = "deleted"
+)
+
+// KeyChange is a single key changed by a migration during a dry run
+type KeyChange struct {
+	Kind   ChangeKind
+	Key    []byte
+	Before []byte // Value before the migration, unless added
+	After  []byte // Value after the migration, unless deleted
+}
+
+// MigrationDryRun is what a single migration would change
+type MigrationDryRun struct {
+	MigrationID string
+	Duration    time.Duration
+	Added       int
+	Modified    int
+	Deleted     int
+	Changes     []KeyChange // The first changes in key order, at most maxSampledChanges
+	Err         error       // Set if the migration failed
+}
+
+// Total returns the number of keys the migration would change
+func (r *MigrationDryRun) Total() int {
+	return r.Added + r.Modified + r.Deleted
+}
+
+// DryRunReport is the result of executing a plan against a throwaway copy of the database
+type DryRunReport struct {
+	Migrations []*MigrationDryRun
+}
+
+// SetDryRunExecute controls what dry-run mode does. By default (and when the engine
+// knows the database path) a dry run executes the plan against a throwaway copy of
+// the database and reports the keys each migration would change. Disable it to only
+// print the plan, for example when migrations have side effects outside the database.
+func (e *MigrationEngine) SetDryRunExecute(enabled bool) {
+	e.dryRunExecute = enabled
+}
+
+// DryRun executes a plan against a copy-on-write checkpoint of the database and
+// reports what every migration would change. The database itself is not modified;
+// the checkpoint shares the immutable table files with it and is removed afterwards.
+// Migration functions do run, so side effects outside the database still happen.
+//
+// On a failing migration the report includes it with Err set, and the error is returned.
+func (e *MigrationEngine) DryRun(plan *ExecutionPlan) (*DryRunReport, error) {
+	if e.dbPath == "" {
+		return nil, fmt.Errorf("dry run needs the database path")
+	}
+
+	overlayPath := fmt.Sprintf("%s.dryrun_%d", e.dbPath, time.Now().UnixNano())
+	defer os.RemoveAll(overlayPath)
+	if err := e.db.Checkpoint(overlayPath); err != nil {
+		// A database opened read-only cannot be checkpointed; nothing writes to it,
+		// so its directory can be cloned instead
+		os.RemoveAll(overlayPath)
+		if cloneErr := cloneDatabaseDir(e.dbPath, overlayPath); cloneErr != nil {
+			return nil, fmt.Errorf("failed to create dry-run checkpoint: %w (clone failed: %v)", err, cloneErr)
+		}
+	}
+
+	overlay, err := pebble.Open(overlayPath, &pebble.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dry-run checkpoint: %w", err)
+	}
+	defer overlay.Close()
+
+	schemaManager := NewSchemaManager(overlay)
+	schemaManager.SetSchemaKey(e.schemaManager.SchemaKey())
+	schemaManager.SetKeyPrefix(e.schemaManager.KeyPrefix())
+	schemaManager.SetEncoding(e.schemaManager.Encoding())
+
+	engine := &MigrationEngine{
+		db:            overlay,
+		schemaManager: schemaManager,
+		registry:      e.registry,
+		forceUndo:     e.forceUndo,
+		logger:        e.logger,
+		inDryRun:      true,
+	}
+
+	report := &DryRunReport{}
+	for _, migration := range plan.Migrations {
+		step := *plan
+		step.Migrations = []*Migration{migration}
+
+		before := overlay.NewSnapshot()
+		start := time.Now()
+		execErr := engine.ExecutePlan(&step, nil)
+		duration := time.Since(start)
+		result, err := diffDryRun(before, overlay, schemaManager)
+		before.Close()
+		if err != nil {
+			return report, fmt.Errorf("failed to compare dry-run state: %w", err)
+		}
+
+		result.MigrationID = migration.ID
+		result.Duration = duration
+		result.Err = execErr
+		report.Migrations = append(report.Migrations, result)
+
+		if execErr != nil {
+			return report, execErr
+		}
+	}
+
+	return report, nil
+}
+
+// cloneDatabaseDir copies a database directory, hard-linking the immutable table
+// files where possible. Other files are copied because the clone appends to them.
+func cloneDatabaseDir(srcPath, dstPath string) error {
+	entries, err := os.ReadDir(srcPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dstPath, 0755); err != nil {
+		return err
+	}
+
+	copier := &BackupManager{}
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == "LOCK" {
+			continue
+		}
+		src := filepath.Join(srcPath, entry.Name())
+		dst := filepath.Join(dstPath, entry.Name())
+
+		if strings.HasSuffix(entry.Name(), ".sst") && os.Link(src, dst) == nil {
+			continue
+		}
+		if _, err := copier.copyFile(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffDryRun compares the non-reserved keys of a snapshot with the current database
+func diffDryRun(before *pebble.Snapshot, after *pebble.DB, schemaManager *SchemaManager) (*MigrationDryRun, error) {
+	beforeIter, err := before.NewIter(&pebble.IterOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer beforeIter.Close()
+
+	afterIter, err := after.NewIter(&pebble.IterOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer afterIter.Close()
+
+	result := &MigrationDryRun{}
+	record := func(kind ChangeKind, key, beforeValue, afterValue []byte) {
+		if schemaManager.IsReservedKey(key) {
+			return
+		}
+		switch kind {
+		case ChangeAdded:
+			result.Added++
+		case ChangeModified:
+			result.Modified++
+		case ChangeDeleted:
+			result.Deleted++
+		}
+		if len(result.Changes) < maxSampledChanges {
+			result.Changes = append(result.Changes, KeyChange{
+				Kind:   kind,
+				Key:    append([]byte(nil), key...),
+				Before: append([]byte(nil), beforeValue...),
+				After:  append([]byte(nil), afterValue...),
+			})
+		}
+	}
+
+	// Merge both iterators in key order
+	beforeIter.First()
+	afterIter.First()
+	for beforeIter.Valid() || afterIter.Valid() {
+		cmp := 0
+		switch {
+		case !beforeIter.Valid():
+			cmp = 1
+		case !afterIter.Valid():
+			cmp = -1
+		default:
+			cmp = bytes.Compare(beforeIter.Key(), afterIter.Key())
+		}
+
+		switch {
+		case cmp < 0:
+			record(ChangeDeleted, beforeIter.Key(), beforeIter.Value(), nil)
+			beforeIter.Next()
+		case cmp > 0:
+			record(ChangeAdded, afterIter.Key(), nil, afterIter.Value())
+			afterIter.Next()
+		default:
+			if !bytes.Equal(beforeIter.Value(), afterIter.Value()) {
+				record(ChangeModified, afterIter.Key(), beforeIter.Value(), afterIter.Value())
+			}
+			beforeIter.Next()
+			afterIter.Next()
+		}
+	}
+
+	if err := beforeIter.Error(); err != nil {
+		return nil, err
+	}
+	return result, afterIter.Error()
+}
+
+// executeDryRun runs a plan in dry-run mode, reporting through progress
+func (e *MigrationEngine) executeDryRun(plan *ExecutionPlan, progress ProgressReporter) error {
+	reportf(progress, ProgressDryRun, "DRY RUN: Executing against a throwaway copy of the database...")
+
+	report, err := e.DryRun(plan)
+	if report != nil {
+		for i, result := range report.Migrations {
+			reportf(progress, ProgressDryRun, "DRY RUN: Migration %d/%d: %s", i+1, len(plan.Migrations), result.MigrationID)
+			if result.Err != nil {
+				reportf(progress, ProgressDryRun, "  Would fail: %v", result.Err)
+				continue
+			}
+			reportf(progress, ProgressDryRun, "  Would add %d, modify %d, delete %d key(s) (%v)",
+				result.Added, result.Modified, result.Deleted, result.Duration.Round(time.Millisecond))
+			for _, change := range result.Changes {
+				reportf(progress, ProgressDryRun, "    %s %q", changeSymbol(change.Kind), change.Key)
+			}
+			if more := result.Total() - len(result.Changes); more > 0 {
+				reportf(progress, ProgressDryRun, "    ... and %d more", more)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("dry run failed: %w", err)
+	}
+
+	reportf(progress, ProgressDryRun, "DRY RUN: Would move from version %d to %d", plan.CurrentVersion, plan.TargetVersion)
+	return nil
+}
+
+// changeSymbol returns the diff marker for a change kind
+func changeSymbol(kind ChangeKind) string {
+	switch kind {
+	case ChangeAdded:
+		return "+"
+	case ChangeDeleted:
+		return "-"
+	default:
+		return "~"
+	}
+}
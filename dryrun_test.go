@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestDryRunOverlay(t *testing.T) {
+	newRegistry := func(t *testing.T, failSecond bool) *MigrationRegistry {
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{
+			ID: "1754917200_rewrite",
+			Up: func(db *pebble.DB) error {
+				db.Set([]byte("user:1"), []byte("ALICE"), pebble.Sync)
+				db.Set([]byte("user:3"), []byte("carol"), pebble.Sync)
+				return db.Delete([]byte("user:2"), pebble.Sync)
+			},
+			Down: func(db *pebble.DB) error { return nil },
+		})
+		registry.Register(&Migration{
+			ID: "1754917300_second",
+			Up: func(db *pebble.DB) error {
+				// Sees the changes of the first migration
+				_, closer, err := db.Get([]byte("user:3"))
+				if err != nil {
+					return err
+				}
+				closer.Close()
+				if failSecond {
+					return errors.New("boom")
+				}
+				return db.Set([]byte("index:carol"), []byte("user:3"), pebble.Sync)
+			},
+			Down: func(db *pebble.DB) error { return nil },
+		})
+		return registry
+	}
+
+	seed := func(t *testing.T) string {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		db.Set([]byte("user:1"), []byte("alice"), pebble.Sync)
+		db.Set([]byte("user:2"), []byte("bob"), pebble.Sync)
+		db.Close()
+		return dbPath
+	}
+
+	run := func(t *testing.T, dbPath string, registry *MigrationRegistry, readOnly bool) (*DryRunReport, error) {
+		db, err := pebble.Open(dbPath, &pebble.Options{ReadOnly: readOnly})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err != nil {
+			t.Fatalf("Failed to plan: %v", err)
+		}
+		report, err := engine.DryRun(plan)
+
+		// Nothing was persisted
+		if v, closer, err := db.Get([]byte("user:1")); err != nil || string(v) != "alice" {
+			t.Errorf("Expected database to be unchanged, got %q, %v", v, err)
+		} else {
+			closer.Close()
+		}
+		if applied, _ := schemaManager.IsMigrationApplied("1754917200_rewrite"); applied {
+			t.Error("Expected schema state to be unchanged")
+		}
+		if matches, _ := filepath.Glob(dbPath + ".dryrun_*"); len(matches) != 0 {
+			t.Errorf("Expected dry-run copy to be removed, found %v", matches)
+		}
+		return report, err
+	}
+
+	for _, readOnly := range []bool{false, true} {
+		name := "ReadWrite"
+		if readOnly {
+			name = "ReadOnly"
+		}
+		t.Run(name, func(t *testing.T) {
+			report, err := run(t, seed(t), newRegistry(t, false), readOnly)
+			if err != nil {
+				t.Fatalf("Dry run failed: %v", err)
+			}
+			if len(report.Migrations) != 2 {
+				t.Fatalf("Expected 2 migration results, got %d", len(report.Migrations))
+			}
+
+			first := report.Migrations[0]
+			if first.Added != 1 || first.Modified != 1 || first.Deleted != 1 {
+				t.Errorf("Expected 1 added, 1 modified, 1 deleted, got %+v", first)
+			}
+			if len(first.Changes) != 3 || string(first.Changes[0].Key) != "user:1" || first.Changes[0].Kind != ChangeModified ||
+				string(first.Changes[0].Before) != "alice" || string(first.Changes[0].After) != "ALICE" {
+				t.Errorf("Unexpected changes %+v", first.Changes)
+			}
+
+			second := report.Migrations[1]
+			if second.Total() != 1 || string(second.Changes[0].Key) != "index:carol" {
+				t.Errorf("Expected second migration to add the index only, got %+v", second)
+			}
+		})
+	}
+
+	t.Run("FailingMigration", func(t *testing.T) {
+		report, err := run(t, seed(t), newRegistry(t, true), false)
+		if err == nil {
+			t.Fatal("Expected dry run to fail")
+		}
+		if len(report.Migrations) != 2 || report.Migrations[1].Err == nil || report.Migrations[0].Err != nil {
+			t.Errorf("Expected the second migration to be reported as failing, got %+v", report.Migrations)
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// SchemaEncoding selects how the schema state is encoded under the schema key
+type SchemaEncoding string
+
+const (
+	// SchemaEncodingJSON stores the schema state as JSON (the default)
+	SchemaEncodingJSON SchemaEncoding = "json"
+	// SchemaEncodingProto stores the schema state as a Protocol Buffers message,
+	// see schema.proto. It is smaller and faster to decode for large applied sets.
+	SchemaEncodingProto SchemaEncoding = "proto"
+)
+
+// protoSchemaHeader starts proto-encoded schema values. Its last byte is the
+// format version. JSON values never start with a zero byte.
+const protoSchemaHeader = "\x00pb\x01"
+
+// Field numbers of the SchemaState message in schema.proto
+const (
+	protoFieldCurrentVersion  protowire.Number = 1
+	protoFieldApplied         protowire.Number = 2
+	protoFieldLastHistoryKey  protowire.Number = 3
+	protoFieldLastMigrationAt protowire.Number = 4
+	protoFieldStatus          protowire.Number = 5
+	protoFieldRevision        protowire.Number = 6
+	protoFieldEnvironment     protowire.Number = 7
+	protoFieldRunning         protowire.Number = 8
+	protoFieldLastFailure     protowire.Number = 9
+)
+
+// Field numbers of the MigrationFailure message in schema.proto
+const (
+	protoFailureMigrationID protowire.Number = 1
+	protoFailureType        protowire.Number = 2
+	protoFailureError       protowire.Number = 3
+	protoFailureFailedAt    protowire.Number = 4
+	protoFailureRemediation protowire.Number = 5
+)
+
+// ParseSchemaEncoding parses a schema encoding name. An empty name selects JSON.
+func ParseSchemaEncoding(name string) (SchemaEncoding, error) {
+	switch SchemaEncoding(strings.ToLower(name)) {
+	case "", SchemaEncodingJSON:
+		return SchemaEncodingJSON, nil
+	case SchemaEncodingProto:
+		return SchemaEncodingProto, nil
+	default:
+		return "", fmt.Errorf("unknown schema encoding %q (expected json or proto)", name)
+	}
+}
+
+// encodeStoredSchema encodes a stored schema state with the given encoding
+func encodeStoredSchema(stored *storedSchemaVersion, encoding SchemaEncoding) ([]byte, error) {
+	if encoding == SchemaEncodingProto {
+		return encodeSchemaProto(stored), nil
+	}
+	return json.Marshal(stored)
+}
+
+// decodeStoredSchema decodes a stored schema state in either encoding
+func decodeStoredSchema(data []byte) (*storedSchemaVersion, error) {
+	if strings.HasPrefix(string(data), protoSchemaHeader) {
+		return decodeSchemaProto(data[len(protoSchemaHeader):])
+	}
+	if len(data) > 0 && data[0] == 0 {
+		return nil, fmt.Errorf("unsupported binary schema format")
+	}
+
+	var stored storedSchemaVersion
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// encodeSchemaProto encodes a schema state as a SchemaState message. Inline
+// history is not encoded; it is moved to per-record keys before every write.
+func encodeSchemaProto(stored *storedSchemaVersion) []byte {
+	b := []byte(protoSchemaHeader)
+	if stored.CurrentVersion != 0 {
+		b = protowire.AppendTag(b, protoFieldCurrentVersion, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(stored.CurrentVersion))
+	}
+	for _, id := range stored.Applied {
+		b = protowire.AppendTag(b, protoFieldApplied, protowire.BytesType)
+		b = protowire.AppendString(b, id)
+	}
+	if stored.LastHistoryKey != 0 {
+		b = protowire.AppendTag(b, protoFieldLastHistoryKey, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(stored.LastHistoryKey))
+	}
+	if !stored.LastMigrationAt.IsZero() {
+		b = protowire.AppendTag(b, protoFieldLastMigrationAt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(stored.LastMigrationAt.UnixNano()))
+	}
+	if stored.Status != "" {
+		b = protowire.AppendTag(b, protoFieldStatus, protowire.BytesType)
+		b = protowire.AppendString(b, string(stored.Status))
+	}
+	if stored.Revision != 0 {
+		b = protowire.AppendTag(b, protoFieldRevision, protowire.VarintType)
+		b = protowire.AppendVarint(b, stored.Revision)
+	}
+	if stored.Environment != "" {
+		b = protowire.AppendTag(b, protoFieldEnvironment, protowire.BytesType)
+		b = protowire.AppendString(b, stored.Environment)
+	}
+	for _, id := range stored.RunningMigrations {
+		b = protowire.AppendTag(b, protoFieldRunning, protowire.BytesType)
+		b = protowire.AppendString(b, id)
+	}
+	if stored.LastFailure != nil {
+		b = protowire.AppendTag(b, protoFieldLastFailure, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeFailureProto(stored.LastFailure))
+	}
+	return b
+}
+
+// encodeFailureProto encodes a failure as a MigrationFailure message
+func encodeFailureProto(failure *MigrationFailure) []byte {
+	var b []byte
+	for _, field := range []struct {
+		num   protowire.Number
+		value string
+	}{
+		{protoFailureMigrationID, failure.MigrationID},
+		{protoFailureType, string(failure.Type)},
+		{protoFailureError, failure.Error},
+		{protoFailureRemediation, failure.Remediation},
+	} {
+		if field.value != "" {
+			b = protowire.AppendTag(b, field.num, protowire.BytesType)
+			b = protowire.AppendString(b, field.value)
+		}
+	}
+	if !failure.FailedAt.IsZero() {
+		b = protowire.AppendTag(b, protoFailureFailedAt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(failure.FailedAt.UnixNano()))
+	}
+	return b
+}
+
+// decodeFailureProto decodes a MigrationFailure message, skipping unknown fields
+func decodeFailureProto(data []byte) (*MigrationFailure, error) {
+	var failure MigrationFailure
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case typ == protowire.BytesType && num >= protoFailureMigrationID && num <= protoFailureRemediation:
+			var value string
+			value, n = protowire.ConsumeString(data)
+			switch num {
+			case protoFailureMigrationID:
+				failure.MigrationID = value
+			case protoFailureType:
+				failure.Type = RecordType(value)
+			case protoFailureError:
+				failure.Error = value
+			case protoFailureRemediation:
+				failure.Remediation = value
+			}
+		case num == protoFailureFailedAt && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(data)
+			failure.FailedAt = time.Unix(0, int64(v))
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return &failure, nil
+}
+
+// decodeSchemaProto decodes a SchemaState message. Unknown fields are skipped, so
+// values written by newer versions can still be read.
+func decodeSchemaProto(data []byte) (*storedSchemaVersion, error) {
+	stored := storedSchemaVersion{Applied: []string{}}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case num == protoFieldApplied && typ == protowire.BytesType:
+			var id string
+			id, n = protowire.ConsumeString(data)
+			stored.Applied = append(stored.Applied, id)
+		case num == protoFieldStatus && typ == protowire.BytesType:
+			var status string
+			status, n = protowire.ConsumeString(data)
+			stored.Status = Status(status)
+		case num == protoFieldEnvironment && typ == protowire.BytesType:
+			stored.Environment, n = protowire.ConsumeString(data)
+		case num == protoFieldRunning && typ == protowire.BytesType:
+			var id string
+			id, n = protowire.ConsumeString(data)
+			stored.RunningMigrations = append(stored.RunningMigrations, id)
+		case num == protoFieldLastFailure && typ == protowire.BytesType:
+			var msg []byte
+			msg, n = protowire.ConsumeBytes(data)
+			if n >= 0 {
+				var err error
+				if stored.LastFailure, err = decodeFailureProto(msg); err != nil {
+					return nil, err
+				}
+			}
+		case typ == protowire.VarintType && num >= protoFieldCurrentVersion && num <= protoFieldRevision:
+			var v uint64
+			v, n = protowire.ConsumeVarint(data)
+			switch num {
+			case protoFieldCurrentVersion:
+				stored.CurrentVersion = int64(v)
+			case protoFieldLastHistoryKey:
+				stored.LastHistoryKey = int64(v)
+			case protoFieldLastMigrationAt:
+				stored.LastMigrationAt = time.Unix(0, int64(v))
+			case protoFieldRevision:
+				stored.Revision = v
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return &stored, nil
+}
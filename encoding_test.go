@@ -0,0 +1,147 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestSchemaEncoding(t *testing.T) {
+	setup := func(t *testing.T) (*pebble.DB, *SchemaManager) {
+		db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db, NewSchemaManager(db)
+	}
+
+	raw := func(t *testing.T, db *pebble.DB) []byte {
+		data, closer, err := db.Get([]byte(SchemaVersionKey))
+		if err != nil {
+			t.Fatalf("Failed to read schema key: %v", err)
+		}
+		defer closer.Close()
+		return append([]byte(nil), data...)
+	}
+
+	t.Run("ProtoRoundTrip", func(t *testing.T) {
+		db, schemaManager := setup(t)
+		schemaManager.SetEncoding(SchemaEncodingProto)
+
+		for i := 0; i < 3; i++ {
+			id := fmt.Sprintf("%d_step", 1754917200+i)
+			if err := schemaManager.UpdateSchemaAfterMigration(id, int64(1754917200+i), "Step", time.Second); err != nil {
+				t.Fatalf("Failed to update schema: %v", err)
+			}
+		}
+		if !strings.HasPrefix(string(raw(t, db)), protoSchemaHeader) {
+			t.Fatal("Expected the schema state to be proto-encoded")
+		}
+
+		version, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to read schema: %v", err)
+		}
+		if version.CurrentVersion != 1754917202 || len(version.AppliedMigrations) != 3 ||
+			len(version.MigrationHistory) != 3 || version.Status != StatusClean || version.Revision != 3 {
+			t.Errorf("Unexpected schema state: %+v", version)
+		}
+		if version.LastMigrationAt.IsZero() {
+			t.Error("Expected the last migration time to be kept")
+		}
+		if err := schemaManager.ValidateSchemaState(); err != nil {
+			t.Errorf("Expected state to validate: %v", err)
+		}
+
+		if err := schemaManager.MarkMigrationStarted("1754917300_a", "1754917300_b"); err != nil {
+			t.Fatalf("Failed to mark migration started: %v", err)
+		}
+		if version, err := schemaManager.GetSchemaVersion(); err != nil || len(version.RunningMigrations) != 2 || version.RunningMigrations[1] != "1754917300_b" {
+			t.Errorf("Expected the running migrations to be kept, got %+v (%v)", version, err)
+		}
+	})
+
+	t.Run("SwitchingConverts", func(t *testing.T) {
+		db, schemaManager := setup(t)
+		schemaManager.UpdateSchemaAfterMigration("1754917200_step", 1754917200, "Step", time.Second)
+		if raw(t, db)[0] != '{' {
+			t.Fatal("Expected the default encoding to be JSON")
+		}
+
+		schemaManager.SetEncoding(SchemaEncodingProto)
+		if applied, err := schemaManager.IsMigrationApplied("1754917200_step"); err != nil || !applied {
+			t.Fatalf("Expected JSON state to be read, got %v (%v)", applied, err)
+		}
+		schemaManager.ForceCleanState()
+		if !strings.HasPrefix(string(raw(t, db)), protoSchemaHeader) {
+			t.Fatal("Expected the next write to convert the state to proto")
+		}
+
+		schemaManager.SetEncoding(SchemaEncodingJSON)
+		schemaManager.ForceCleanState()
+		if raw(t, db)[0] != '{' {
+			t.Fatal("Expected the next write to convert the state back to JSON")
+		}
+		if applied, _ := schemaManager.IsMigrationApplied("1754917200_step"); !applied {
+			t.Error("Expected the applied set to survive both conversions")
+		}
+	})
+
+	t.Run("ProtoIsSmaller", func(t *testing.T) {
+		version := &SchemaVersion{AppliedMigrations: map[string]bool{}, Status: StatusClean, LastMigrationAt: time.Now()}
+		for i := 0; i < 1000; i++ {
+			version.AppliedMigrations[fmt.Sprintf("%d_step", 1700000000+i)] = true
+		}
+
+		jsonData, _ := encodeSchemaHead(version, SchemaEncodingJSON)
+		protoData, _ := encodeSchemaHead(version, SchemaEncodingProto)
+		if len(protoData) >= len(jsonData) {
+			t.Errorf("Expected proto (%d bytes) to be smaller than JSON (%d bytes)", len(protoData), len(jsonData))
+		}
+	})
+
+	t.Run("SkipsUnknownFields", func(t *testing.T) {
+		data := encodeSchemaProto(&storedSchemaVersion{CurrentVersion: 1754917200, Status: StatusClean})
+		data = protowire.AppendTag(data, 99, protowire.BytesType)
+		data = protowire.AppendString(data, "added later")
+
+		version, err := decodeSchemaVersion(data)
+		if err != nil {
+			t.Fatalf("Expected unknown fields to be skipped: %v", err)
+		}
+		if version.CurrentVersion != 1754917200 {
+			t.Errorf("Expected version 1754917200, got %d", version.CurrentVersion)
+		}
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		for _, data := range []string{
+			protoSchemaHeader + "\x12\x09short",
+			protoSchemaHeader + "\x2a\x08exploded",
+			"\x00pb\x02",
+		} {
+			if _, err := decodeSchemaVersion([]byte(data)); !errors.Is(err, ErrCorruptSchemaState) {
+				t.Errorf("Expected ErrCorruptSchemaState for %q, got %v", data, err)
+			}
+		}
+	})
+
+	t.Run("Parse", func(t *testing.T) {
+		if encoding, err := ParseSchemaEncoding("PROTO"); err != nil || encoding != SchemaEncodingProto {
+			t.Errorf("Expected proto, got %q (%v)", encoding, err)
+		}
+		if encoding, err := ParseSchemaEncoding(""); err != nil || encoding != SchemaEncodingJSON {
+			t.Errorf("Expected json, got %q (%v)", encoding, err)
+		}
+		if _, err := ParseSchemaEncoding("xml"); err == nil {
+			t.Error("Expected an unknown encoding to fail")
+		}
+	})
+}
@@ -1,7 +1,11 @@
 package migrate
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/pebble"
@@ -13,9 +17,60 @@ type MigrationEngine struct {
 	schemaManager *SchemaManager
 	registry      *MigrationRegistry
 	backupManager *BackupManager
+	dbPath        string
 	dryRun        bool
+	dryRunExecute bool
 	verbose       bool
 	enableBackup  bool
+	asyncBackup   bool
+	pendingBackup *PendingBackup
+	planBackup    string
+	recordOps     bool
+	forceUndo     bool
+	parallelism   int
+	faultInjector FaultInjector
+	logger        Logger
+	eventLogPath  string
+	diagnostics   bool
+	inDryRun      bool // Executing against the copy of a dry run
+	policies      []PolicyFunc
+	standbyPath   string
+
+	// Batch limits of upgrade plans, see SetBatchLimits
+	maxBatchMigrations int
+	maxBatchDuration   time.Duration
+	deferred           []*Migration
+
+	// Migrations the last plan left pending because a best-effort migration
+	// failed, see SkippedMigrations
+	skipped []*Migration
+
+	// What a failed migration does to an upgrade plan, see SetFailurePolicy. With
+	// FailureContinue the first failure fails the plan once the rest ran.
+	failurePolicy   FailurePolicy
+	firstFailure    *MigrationFailure
+	firstFailureErr error
+
+	// Context of the running plan, see ExecutePlanContext
+	ctx context.Context
+
+	// Set when the caller claimed the database for the engine, see beginExecution
+	claimed bool
+
+	// Called before and after each step of a plan, see SetStepInterceptor
+	stepInterceptor StepInterceptor
+
+	// Run after each plan, see AddPlanValidator
+	planValidators       []planValidator
+	planValidationAction PlanValidationAction
+
+	// Soft failures, and where those of the last plan start, see Warnings
+	warnings           warningLog
+	planWarnings       int
+	planBackupWarnings int
+
+	metricsMu sync.Mutex
+	metrics   map[string]*MigrationMetrics
 }
 
 
@@ -25,14 +80,17 @@ func NewMigrationEngineWithBackup(db *pebble.DB, schemaManager *SchemaManager, r
 		db:            db,
 		schemaManager: schemaManager,
 		registry:      registry,
-		backupManager: NewBackupManager(dbPath),
+		backupManager: newSchemaAwareBackupManager(dbPath, schemaManager),
+		dbPath:        dbPath,
 		dryRun:        false,
+		dryRunExecute: true,
 		verbose:       false,
 		enableBackup:  true,
+		diagnostics:   true,
 	}
 }
 
-// SetDryRun enables or disables dry-run mode
+// SetDryRun enables or disables dry-run mode (see SetDryRunExecute)
 func (e *MigrationEngine) SetDryRun(enabled bool) {
 	e.dryRun = enabled
 }
@@ -47,46 +105,363 @@ func (e *MigrationEngine) SetBackupEnabled(enabled bool) {
 	e.enableBackup = enabled
 }
 
+// SetAsyncBackup sets whether the backup taken before executing a plan is
+// compressed in the background, see CreateBackupAsync. Migrations start once the
+// checkpoint exists. If the plan fails, ExecutePlan waits for the backup before
+// returning; otherwise wait for it with PendingBackup.
+func (e *MigrationEngine) SetAsyncBackup(enabled bool) {
+	e.asyncBackup = enabled
+}
+
+// PendingBackup returns the backup of the last executed plan if it was created
+// asynchronously, or nil
+func (e *MigrationEngine) PendingBackup() *PendingBackup {
+	return e.pendingBackup
+}
+
+// SetRecordOps enables or disables saving the operation log of migrations that
+// use Apply alongside the backups. Logs can be replayed or undone later, which
+// makes them a lightweight alternative to full backups for small migrations.
+func (e *MigrationEngine) SetRecordOps(enabled bool) {
+	e.recordOps = enabled
+}
+
+// SetForceUndo makes automatic rollbacks of migrations without a Down function
+// restore the recorded values even if the keys changed after the migration ran.
+// By default such a rollback fails with ErrOpLogConflict.
+func (e *MigrationEngine) SetForceUndo(enabled bool) {
+	e.forceUndo = enabled
+}
+
 // SetBackupManager sets the backup manager for the engine
 func (e *MigrationEngine) SetBackupManager(backupManager *BackupManager) {
+	if backupManager != nil {
+		backupManager.SetSchemaKey(e.schemaManager.SchemaKey())
+		backupManager.SetKeyPrefix(e.schemaManager.KeyPrefix())
+		backupManager.SetFaultInjector(e.faultInjector)
+		backupManager.SetLogger(e.logger)
+	}
 	e.backupManager = backupManager
 }
 
-// ExecutePlan executes a migration plan
+// SetLogger sets the logger execution and backup messages are written to, which
+// is also passed to migrations in their MigrationContext. Without a logger they
+// are printed to stdout. Verbose messages are logged at info level in verbose
+// mode and at debug level otherwise.
+func (e *MigrationEngine) SetLogger(logger Logger) {
+	e.logger = logger
+	if e.backupManager != nil {
+		e.backupManager.SetLogger(logger)
+	}
+}
+
+// SetEventLog sets the path of a file the progress events of every executed plan
+// are appended to as JSON lines, independent of the logger, or disables it if
+// path is empty. A plan fails if the file cannot be opened.
+func (e *MigrationEngine) SetEventLog(path string) {
+	e.eventLogPath = path
+}
+
+// SetDiagnostics enables or disables writing a diagnostic bundle next to the
+// database when a plan fails. The bundle is a tar.gz with the error, the plan,
+// the schema state and history, the last progress messages, the Pebble metrics
+// and the goroutine stacks; its path is reported as a warning. Enabled by default.
+func (e *MigrationEngine) SetDiagnostics(enabled bool) {
+	e.diagnostics = enabled
+}
+
+// log returns the logger of the engine
+func (e *MigrationEngine) log() Logger {
+	if e.logger == nil {
+		return defaultLogger
+	}
+	return e.logger
+}
+
+// debugf logs a message shown in verbose mode
+func (e *MigrationEngine) debugf(format string, args ...interface{}) {
+	if e.verbose {
+		e.log().Printf(format, args...)
+	} else {
+		e.log().Debugf(format, args...)
+	}
+}
+
+// MigrationMetrics returns the metrics of the last run of a migration by this
+// engine, or nil if it did not run. Only migrations with context functions
+// collect metrics.
+func (e *MigrationEngine) MigrationMetrics(migrationID string) *MigrationMetrics {
+	e.metricsMu.Lock()
+	defer e.metricsMu.Unlock()
+	return e.metrics[migrationID]
+}
+
+// SetFaultInjector installs a fault injector for testing recovery and dirty-state
+// handling. Pass nil to disable fault injection.
+func (e *MigrationEngine) SetFaultInjector(injector FaultInjector) {
+	e.faultInjector = injector
+	if e.backupManager != nil {
+		e.backupManager.SetFaultInjector(injector)
+	}
+}
+
+// injectFault consults the fault injector at a fault point
+func (e *MigrationEngine) injectFault(point FaultPoint, migrationID string) error {
+	if e.faultInjector == nil {
+		return nil
+	}
+	return e.faultInjector(point, migrationID)
+}
+
+// warnf collects a warning of the current plan and reports it to progress, or
+// logs it if progress is nil
+func (e *MigrationEngine) warnf(progress ProgressReporter, source, format string, args ...interface{}) {
+	w := newWarning(source, format, args...)
+	e.warnings.add(w)
+	if progress == nil {
+		logWarning(e.log(), w)
+		return
+	}
+	reportf(progress, ProgressWarning, "Warning: %s", w.Message)
+}
+
+// Warnings returns the soft failures of the last plan executed, oldest first:
+// those of the engine, e.g. a plan not recorded in the plan history or a standby
+// out of sync, and those of its backup manager, e.g. old backups not removed.
+// They are also reported as ProgressWarning events or logged. Warnings of an
+// async backup completing after the plan are in the BackupInfo of its
+// PendingBackup.
+func (e *MigrationEngine) Warnings() []Warning {
+	warnings := e.warnings.since(e.planWarnings)
+	if e.backupManager != nil {
+		warnings = append(warnings, e.backupManager.warnings.since(e.planBackupWarnings)...)
+		sort.SliceStable(warnings, func(i, j int) bool { return warnings[i].Time.Before(warnings[j].Time) })
+	}
+	return warnings
+}
+
+// SetStepInterceptor installs an interceptor called before and after each step
+// of executing a plan: the backup, marking the schema as migrating, executing and
+// validating a migration, and recording it. Pass nil to remove it.
+func (e *MigrationEngine) SetStepInterceptor(interceptor StepInterceptor) {
+	e.stepInterceptor = interceptor
+}
+
+// interceptStep runs a step, calling the step interceptor before and after it
+func (e *MigrationEngine) interceptStep(event StepEvent, step func() error) error {
+	if e.stepInterceptor == nil {
+		return step()
+	}
+	if err := e.stepInterceptor(event); err != nil {
+		return err
+	}
+	err := step()
+	event.After, event.Err = true, err
+	if interceptErr := e.stepInterceptor(event); err == nil {
+		err = interceptErr
+	}
+	return err
+}
+
+// ExecutePlan executes a migration plan, passing the progress messages to
+// progressCallback, which may be nil. See ExecutePlanWithProgress for structured
+// progress events.
 func (e *MigrationEngine) ExecutePlan(plan *ExecutionPlan, progressCallback func(string)) error {
-	if progressCallback == nil {
-		progressCallback = func(string) {} // No-op callback
+	return e.ExecutePlanWithProgress(plan, ProgressFunc(progressCallback))
+}
+
+// ExecutePlanWithProgress executes a migration plan, reporting its progress to
+// progress, which may be nil
+func (e *MigrationEngine) ExecutePlanWithProgress(plan *ExecutionPlan, progress ProgressReporter) error {
+	return e.ExecutePlanContext(context.Background(), plan, progress)
+}
+
+// ExecutePlanContext executes a migration plan like ExecutePlanWithProgress until
+// ctx is done. No migration is started once ctx is done, and the MigrationContext
+// of a running migration is canceled with it. A migration that stops with the
+// error of ctx is left interrupted, as if the process had stopped, and recovered
+// like any interrupted migration. Migrations with plain functions run to their end.
+//
+// One plan executes on a database at a time: while a plan of any engine of the
+// process is executing on it, ExecutePlanContext fails with ErrConcurrentExecution.
+func (e *MigrationEngine) ExecutePlanContext(ctx context.Context, plan *ExecutionPlan, progress ProgressReporter) error {
+	end, err := e.claim(string(plan.Type) + " plan")
+	if err != nil {
+		return err
+	}
+	defer end()
+	e.ctx = ctx
+	defer func() { e.ctx = nil }()
+	if progress == nil {
+		progress = ProgressFunc(nil) // Discards events
+	}
+	e.planWarnings = e.warnings.mark()
+	if e.backupManager != nil {
+		e.planBackupWarnings = e.backupManager.warnings.mark()
+	}
+
+	if e.eventLogPath == "" {
+		return e.executePlan(plan, progress)
+	}
+	eventLog, err := openEventLog(e.eventLogPath, plan.Type, progress)
+	if err != nil {
+		return err
+	}
+	err = e.executePlan(plan, eventLog)
+	if closeErr := eventLog.Close(err); closeErr != nil {
+		e.warnf(progress, "event log", "%v", closeErr)
+	}
+	return err
+}
+
+// executePlan executes a migration plan, reporting its progress to progress
+func (e *MigrationEngine) executePlan(plan *ExecutionPlan, progress ProgressReporter) error {
+	e.pendingBackup = nil
+	e.planBackup = ""
+	e.deferred = nil
+	e.skipped = nil
+	e.firstFailure, e.firstFailureErr = nil, nil
+
+	var tail *messageTail
+	if e.diagnostics {
+		tail = &messageTail{next: progress}
+		progress = tail
+	}
+
+	// Plan policies approve the plan before anything is changed
+	if !e.inDryRun {
+		if err := e.CheckPolicies(plan); err != nil {
+			return err
+		}
+	}
+
+	// Applied migrations recorded under a former ID are renamed first
+	if !e.dryRun && !e.inDryRun {
+		adopted, err := e.schemaManager.AdoptAliases(e.registry)
+		if err != nil {
+			return err
+		}
+		for _, id := range adopted {
+			reportf(progress, ProgressPlanStarted, "Migration %s was renamed to %s", id, e.registry.ResolveID(id))
+		}
 	}
 
+	// Applications follow the plan with CurrentOperation
+	if !e.dryRun && !e.inDryRun {
+		reporter := progress
+		tracker := startOperation(e.schemaManager, plan, reporter)
+		progress = tracker
+		defer func() {
+			if err := tracker.finish(); err != nil {
+				e.warnf(reporter, "operation", "%v", err)
+			}
+		}()
+	}
+
+	start := time.Now()
+	var err error
 	switch plan.Type {
 	case ExecutionTypeUpgrade:
-		return e.executeUpgrade(plan, progressCallback)
+		err = e.executeUpgrade(plan, progress)
 	case ExecutionTypeDowngrade:
-		return e.executeDowngrade(plan, progressCallback)
+		err = e.executeDowngrade(plan, progress)
 	case ExecutionTypeRerun:
-		return e.executeRerun(plan, progressCallback)
+		err = e.executeRerun(plan, progress)
 	default:
 		return fmt.Errorf("unsupported execution type: %s", plan.Type)
 	}
+	if err == nil && !e.dryRun && !e.inDryRun {
+		err = e.validatePlan(plan, progress)
+	}
+	e.recordPlan(plan, start, err, progress)
+	if err == nil && e.standbyPath != "" && !e.dryRun && !e.inDryRun {
+		e.syncStandby(plan, progress)
+	}
+	if err != nil && tail != nil {
+		e.reportDiagnostics(plan, err, tail, progress)
+	}
+
+	// Cleanup keeps the backup of the last successful plan
+	if err == nil && e.planBackup != "" {
+		if markErr := e.backupManager.MarkLastGoodBackup(e.planBackup); markErr != nil {
+			e.warnf(progress, "backup", "%v", markErr)
+		}
+	}
+
+	// A failed plan is only reported once its backup is complete
+	if err != nil && e.pendingBackup != nil {
+		reportf(progress, ProgressBackup, "Waiting for the backup to complete...")
+		if _, backupErr := e.pendingBackup.Wait(); backupErr != nil {
+			return fmt.Errorf("%w (and the background backup failed: %v)", err, backupErr)
+		}
+	}
+	return err
+}
+
+// reportDiagnostics writes the diagnostic bundle of a failed plan and reports its
+// path. Dry runs and simulated crashes write no bundle.
+func (e *MigrationEngine) reportDiagnostics(plan *ExecutionPlan, planErr error, tail *messageTail, progress ProgressReporter) {
+	if e.dryRun || e.inDryRun || e.dbPath == "" || errors.Is(planErr, ErrSimulatedCrash) {
+		return
+	}
+	path, err := e.writeDiagnosticBundle(plan, planErr, tail.Lines())
+	if err != nil {
+		e.warnf(progress, "diagnostics", "%v", err)
+		return
+	}
+	reportf(progress, ProgressWarning, "Diagnostic bundle written to %s", path)
+}
+
+// createBackup creates the backup taken before executing a plan. With async
+// backups it returns once the checkpoint exists and the backup is completed in
+// the background.
+func (e *MigrationEngine) createBackup(description string, progress ProgressReporter) error {
+	return e.interceptStep(StepEvent{Step: StepBackup}, func() error {
+		return e.takeBackup(description, progress)
+	})
+}
+
+// takeBackup creates the backup of createBackup
+func (e *MigrationEngine) takeBackup(description string, progress ProgressReporter) error {
+	if !e.asyncBackup {
+		backupInfo, err := e.backupManager.CreateBackup(e.db, description)
+		if err != nil {
+			return err
+		}
+		e.planBackup = backupInfo.Path
+		reportf(progress, ProgressBackup, "Backup created: %s", backupInfo.Path)
+		return nil
+	}
+
+	pending, err := e.backupManager.CreateBackupAsync(e.db, description)
+	if err != nil {
+		return err
+	}
+	e.pendingBackup = pending
+	e.planBackup = pending.Path
+	reportf(progress, ProgressBackup, "Backup checkpoint created, completing in the background: %s", pending.Path)
+	return nil
 }
 
 // executeUpgrade executes an upgrade plan
-func (e *MigrationEngine) executeUpgrade(plan *ExecutionPlan, progressCallback func(string)) error {
-	progressCallback("Starting upgrade...")
+func (e *MigrationEngine) executeUpgrade(plan *ExecutionPlan, progress ProgressReporter) error {
+	progress.Report(ProgressEvent{Phase: ProgressPlanStarted, Total: len(plan.Migrations), Message: "Starting upgrade..."})
 
 	if e.dryRun {
-		return e.simulateUpgrade(plan, progressCallback)
+		if e.dryRunExecute && e.dbPath != "" {
+			return e.executeDryRun(plan, progress)
+		}
+		return e.simulateUpgrade(plan, progress)
 	}
+	start := time.Now() // Batch limits count from here
 
 	// Create backup before migration if enabled and there are migrations to apply
 	if e.enableBackup && e.backupManager != nil && len(plan.Migrations) > 0 {
-		progressCallback("Creating database backup before migration...")
+		reportf(progress, ProgressBackup, "Creating database backup before migration...")
 		description := fmt.Sprintf("Before upgrade to version %d (%d migrations)", plan.TargetVersion, len(plan.Migrations))
-		backupInfo, err := e.backupManager.CreateBackup(e.db, description)
-		if err != nil {
+		if err := e.createBackup(description, progress); err != nil {
 			return fmt.Errorf("failed to create backup before migration: %w", err)
 		}
-		progressCallback(fmt.Sprintf("Backup created: %s", backupInfo.Path))
 	}
 
 	// Validate schema state before starting
@@ -94,56 +469,88 @@ func (e *MigrationEngine) executeUpgrade(plan *ExecutionPlan, progressCallback f
 		return fmt.Errorf("schema validation failed: %w", err)
 	}
 
-	// Mark migration as started
-	if err := e.schemaManager.MarkMigrationStarted(); err != nil {
-		return fmt.Errorf("failed to mark migration as started: %w", err)
+	if e.parallelism > 1 {
+		return e.executeWaves(plan, start, progress)
 	}
 
 	// Execute each migration
 	for i, migration := range plan.Migrations {
-		progressCallback(fmt.Sprintf("Executing migration %d/%d: %s", i+1, len(plan.Migrations), migration.ID))
+		if err := e.canceledBefore(migration); err != nil {
+			return err
+		}
+		if e.batchExhausted(i, 1, start) {
+			e.deferRest(plan.Migrations[i:], len(plan.Migrations), progress)
+			return e.continuedFailure()
+		}
+		if e.skipIfBlocked(migration, progress) {
+			continue
+		}
+		progress.Report(migrationEvent(ProgressMigrationStarted, i+1, len(plan.Migrations), i, migration, "up",
+			fmt.Sprintf("Executing migration %d/%d: %s", i+1, len(plan.Migrations), migration.ID)))
+
+		// Mark migration as started. Each migration leaves the schema clean, so this
+		// is repeated per migration for an interruption to be detected at any point.
+		started := StepEvent{Step: StepMarkStarted, MigrationID: migration.ID, Direction: "up"}
+		if err := e.interceptStep(started, func() error { return e.schemaManager.MarkMigrationStarted(migration.ID) }); err != nil {
+			return fmt.Errorf("failed to mark migration as started: %w", err)
+		}
 
 		start := time.Now()
-		if err := e.executeSingleMigration(migration, true); err != nil {
-			// Mark migration as failed
-			if markErr := e.schemaManager.MarkMigrationFailed(migration.ID, migration.Description, err); markErr != nil {
-				return fmt.Errorf("migration failed and failed to mark as failed: %w (original error: %v)", markErr, err)
+		if err := e.executeWithFaults(migration, true, progress); err != nil {
+			if errors.Is(err, ErrSimulatedCrash) {
+				return err
 			}
-			return fmt.Errorf("migration %s failed: %w", migration.ID, err)
+			if e.canceledDuring(err) {
+				return fmt.Errorf("migration %s was canceled and is left interrupted: %w", migration.ID, err)
+			}
+			// Mark migration as failed, or record it and continue as the policy says
+			if err := e.migrationFailed(plan, migration, time.Since(start), err, progress); err != nil {
+				return err
+			}
+			continue
 		}
 		duration := time.Since(start)
 
 		// Update schema version after successful migration
-		if err := e.schemaManager.UpdateSchemaAfterMigration(migration.ID, migration.Version, migration.Description, duration); err != nil {
+		record := StepEvent{Step: StepRecord, MigrationID: migration.ID, Direction: "up"}
+		if err := e.interceptStep(record, func() error {
+			return e.schemaManager.UpdateSchemaAfterMigration(migration.ID, migration.Version, migration.Description, duration)
+		}); err != nil {
 			return fmt.Errorf("failed to update schema version after migration %s: %w", migration.ID, err)
 		}
 
+		event := migrationEvent(ProgressMigrationCompleted, i+1, len(plan.Migrations), i+1, migration, "up", "")
 		if e.verbose {
-			progressCallback(fmt.Sprintf("Migration %s completed in %v", migration.ID, duration))
+			event.Message = fmt.Sprintf("Migration %s completed in %v", migration.ID, duration)
 		}
+		progress.Report(event)
+	}
+	if err := e.continuedFailure(); err != nil {
+		return err
 	}
 
-	progressCallback("Upgrade completed successfully")
+	progress.Report(ProgressEvent{Phase: ProgressPlanCompleted, Total: len(plan.Migrations), Percent: 100, Message: "Upgrade completed successfully"})
 	return nil
 }
 
 // executeDowngrade executes a downgrade plan
-func (e *MigrationEngine) executeDowngrade(plan *ExecutionPlan, progressCallback func(string)) error {
-	progressCallback("Starting downgrade...")
+func (e *MigrationEngine) executeDowngrade(plan *ExecutionPlan, progress ProgressReporter) error {
+	progress.Report(ProgressEvent{Phase: ProgressPlanStarted, Total: len(plan.Migrations), Message: "Starting downgrade..."})
 
 	if e.dryRun {
-		return e.simulateDowngrade(plan, progressCallback)
+		if e.dryRunExecute && e.dbPath != "" {
+			return e.executeDryRun(plan, progress)
+		}
+		return e.simulateDowngrade(plan, progress)
 	}
 
 	// Create backup before rollback if enabled and there are migrations to rollback
 	if e.enableBackup && e.backupManager != nil && len(plan.Migrations) > 0 {
-		progressCallback("Creating database backup before rollback...")
+		reportf(progress, ProgressBackup, "Creating database backup before rollback...")
 		description := fmt.Sprintf("Before rollback to version %d (%d rollbacks)", plan.TargetVersion, len(plan.Migrations))
-		backupInfo, err := e.backupManager.CreateBackup(e.db, description)
-		if err != nil {
+		if err := e.createBackup(description, progress); err != nil {
 			return fmt.Errorf("failed to create backup before rollback: %w", err)
 		}
-		progressCallback(fmt.Sprintf("Backup created: %s", backupInfo.Path))
 	}
 
 	// Validate schema state before starting
@@ -151,19 +558,30 @@ func (e *MigrationEngine) executeDowngrade(plan *ExecutionPlan, progressCallback
 		return fmt.Errorf("schema validation failed: %w", err)
 	}
 
-	// Mark rollback as started
-	if err := e.schemaManager.MarkRollbackStarted(); err != nil {
-		return fmt.Errorf("failed to mark rollback as started: %w", err)
-	}
-
 	// Execute each migration rollback
 	for i, migration := range plan.Migrations {
-		progressCallback(fmt.Sprintf("Rolling back migration %d/%d: %s", i+1, len(plan.Migrations), migration.ID))
+		if err := e.canceledBefore(migration); err != nil {
+			return err
+		}
+		progress.Report(migrationEvent(ProgressMigrationStarted, i+1, len(plan.Migrations), i, migration, "down",
+			fmt.Sprintf("Rolling back migration %d/%d: %s", i+1, len(plan.Migrations), migration.ID)))
+
+		// Mark rollback as started (repeated per migration, see executeUpgrade)
+		started := StepEvent{Step: StepMarkStarted, MigrationID: migration.ID, Direction: "down"}
+		if err := e.interceptStep(started, e.schemaManager.MarkRollbackStarted); err != nil {
+			return fmt.Errorf("failed to mark rollback as started: %w", err)
+		}
 
 		start := time.Now()
-		if err := e.executeSingleMigration(migration, false); err != nil {
+		if err := e.executeWithFaults(migration, false, progress); err != nil {
+			if errors.Is(err, ErrSimulatedCrash) {
+				return err
+			}
+			if e.canceledDuring(err) {
+				return fmt.Errorf("rollback of migration %s was canceled and is left interrupted: %w", migration.ID, err)
+			}
 			// Mark migration as failed
-			if markErr := e.schemaManager.MarkMigrationFailed(migration.ID+"_rollback", "Rollback: "+migration.Description, err); markErr != nil {
+			if markErr := e.schemaManager.markFailed(migration.ID, RecordRollback, "Rollback: "+migration.Description, time.Since(start), err); markErr != nil {
 				return fmt.Errorf("rollback failed and failed to mark as failed: %w (original error: %v)", markErr, err)
 			}
 			return fmt.Errorf("rollback of migration %s failed: %w", migration.ID, err)
@@ -171,41 +589,54 @@ func (e *MigrationEngine) executeDowngrade(plan *ExecutionPlan, progressCallback
 		duration := time.Since(start)
 
 		// Update schema after successful rollback
-		if err := e.schemaManager.UpdateAfterRollback(migration.ID, migration.Version, migration.Description); err != nil {
+		record := StepEvent{Step: StepRecord, MigrationID: migration.ID, Direction: "down"}
+		if err := e.interceptStep(record, func() error {
+			return e.schemaManager.UpdateAfterRollback(migration.ID, migration.Version, migration.Description, duration)
+		}); err != nil {
 			return fmt.Errorf("failed to update schema after rollback of %s: %w", migration.ID, err)
 		}
 
+		// The undo log of an automatic Down is only dropped once the rollback is recorded
+		if migration.HasAutomaticDown() {
+			if err := e.schemaManager.DeleteUndoLog(migration.ID); err != nil {
+				return err
+			}
+		}
+
+		event := migrationEvent(ProgressMigrationCompleted, i+1, len(plan.Migrations), i+1, migration, "down", "")
 		if e.verbose {
-			progressCallback(fmt.Sprintf("Rollback of %s completed in %v", migration.ID, duration))
+			event.Message = fmt.Sprintf("Rollback of %s completed in %v", migration.ID, duration)
 		}
+		progress.Report(event)
 	}
 
-	progressCallback("Downgrade completed successfully")
+	progress.Report(ProgressEvent{Phase: ProgressPlanCompleted, Total: len(plan.Migrations), Percent: 100, Message: "Downgrade completed successfully"})
 	return nil
 }
 
 // executeRerun executes a rerun plan (down then up)
-func (e *MigrationEngine) executeRerun(plan *ExecutionPlan, progressCallback func(string)) error {
+func (e *MigrationEngine) executeRerun(plan *ExecutionPlan, progress ProgressReporter) error {
 	if len(plan.Migrations) != 1 {
 		return fmt.Errorf("rerun plan must contain exactly one migration, got %d", len(plan.Migrations))
 	}
 
 	migration := plan.Migrations[0]
-	progressCallback(fmt.Sprintf("Rerunning migration: %s", migration.ID))
+	progress.Report(ProgressEvent{Phase: ProgressPlanStarted, Total: 1, MigrationID: migration.ID, Message: fmt.Sprintf("Rerunning migration: %s", migration.ID)})
 
 	if e.dryRun {
-		return e.simulateRerun(plan, progressCallback)
+		if e.dryRunExecute && e.dbPath != "" {
+			return e.executeDryRun(plan, progress)
+		}
+		return e.simulateRerun(plan, progress)
 	}
 
 	// Create backup before rerun if enabled
 	if e.enableBackup && e.backupManager != nil {
-		progressCallback("Creating database backup before rerun...")
+		reportf(progress, ProgressBackup, "Creating database backup before rerun...")
 		description := fmt.Sprintf("Before rerun of migration %s", migration.ID)
-		backupInfo, err := e.backupManager.CreateBackup(e.db, description)
-		if err != nil {
+		if err := e.createBackup(description, progress); err != nil {
 			return fmt.Errorf("failed to create backup before rerun: %w", err)
 		}
-		progressCallback(fmt.Sprintf("Backup created: %s", backupInfo.Path))
 	}
 
 	// Validate schema state before starting
@@ -214,24 +645,40 @@ func (e *MigrationEngine) executeRerun(plan *ExecutionPlan, progressCallback fun
 	}
 
 	// Mark migration as started
-	if err := e.schemaManager.MarkMigrationStarted(); err != nil {
+	started := StepEvent{Step: StepMarkStarted, MigrationID: migration.ID, Direction: "down"}
+	if err := e.interceptStep(started, func() error { return e.schemaManager.MarkMigrationStarted(migration.ID) }); err != nil {
 		return fmt.Errorf("failed to mark migration as started: %w", err)
 	}
 
 	// Execute down migration first
-	progressCallback(fmt.Sprintf("Rolling back migration: %s", migration.ID))
-	if err := e.executeSingleMigration(migration, false); err != nil {
-		if markErr := e.schemaManager.MarkMigrationFailed(migration.ID+"_rerun_rollback", "Rerun Rollback: "+migration.Description, err); markErr != nil {
+	progress.Report(migrationEvent(ProgressMigrationStarted, 1, 1, 0, migration, "down",
+		fmt.Sprintf("Rolling back migration: %s", migration.ID)))
+	downStart := time.Now()
+	if err := e.executeWithFaults(migration, false, progress); err != nil {
+		if errors.Is(err, ErrSimulatedCrash) {
+			return err
+		}
+		if e.canceledDuring(err) {
+			return fmt.Errorf("rerun rollback of migration %s was canceled and is left interrupted: %w", migration.ID, err)
+		}
+		if markErr := e.schemaManager.markFailed(migration.ID, RecordRollback, "Rerun Rollback: "+migration.Description, time.Since(downStart), err); markErr != nil {
 			return fmt.Errorf("rerun rollback failed and failed to mark as failed: %w (original error: %v)", markErr, err)
 		}
 		return fmt.Errorf("rerun rollback of migration %s failed: %w", migration.ID, err)
 	}
 
 	// Execute up migration
-	progressCallback(fmt.Sprintf("Re-applying migration: %s", migration.ID))
+	progress.Report(migrationEvent(ProgressMigrationStarted, 1, 1, 0, migration, "up",
+		fmt.Sprintf("Re-applying migration: %s", migration.ID)))
 	start := time.Now()
-	if err := e.executeSingleMigration(migration, true); err != nil {
-		if markErr := e.schemaManager.MarkMigrationFailed(migration.ID+"_rerun", "Rerun: "+migration.Description, err); markErr != nil {
+	if err := e.executeWithFaults(migration, true, progress); err != nil {
+		if errors.Is(err, ErrSimulatedCrash) {
+			return err
+		}
+		if e.canceledDuring(err) {
+			return fmt.Errorf("rerun of migration %s was canceled and is left interrupted: %w", migration.ID, err)
+		}
+		if markErr := e.schemaManager.markFailed(migration.ID, RecordRerun, "Rerun: "+migration.Description, time.Since(start), err); markErr != nil {
 			return fmt.Errorf("rerun failed and failed to mark as failed: %w (original error: %v)", markErr, err)
 		}
 		return fmt.Errorf("rerun of migration %s failed: %w", migration.ID, err)
@@ -239,93 +686,219 @@ func (e *MigrationEngine) executeRerun(plan *ExecutionPlan, progressCallback fun
 	duration := time.Since(start)
 
 	// Update schema version (should remain the same for rerun)
-	if err := e.schemaManager.UpdateSchemaAfterMigration(migration.ID+"_rerun", migration.Version, "Rerun: "+migration.Description, duration); err != nil {
+	record := StepEvent{Step: StepRecord, MigrationID: migration.ID, Direction: "up"}
+	if err := e.interceptStep(record, func() error {
+		return e.schemaManager.recordApplied(migration.ID, RecordRerun, migration.Version, "Rerun: "+migration.Description, duration)
+	}); err != nil {
 		return fmt.Errorf("failed to update schema version after rerun of %s: %w", migration.ID, err)
 	}
 
-	progressCallback(fmt.Sprintf("Rerun of migration %s completed successfully", migration.ID))
+	progress.Report(ProgressEvent{Phase: ProgressPlanCompleted, Total: 1, MigrationID: migration.ID, Percent: 100,
+		Message: fmt.Sprintf("Rerun of migration %s completed successfully", migration.ID)})
 	return nil
 }
 
+// executeWithFaults executes a single migration, consulting the fault injector
+// before the migration runs and after its data was written
+func (e *MigrationEngine) executeWithFaults(migration *Migration, up bool, progress ProgressReporter) error {
+	if err := e.injectFault(FaultBeforeMigration, migration.ID); err != nil {
+		return err
+	}
+	if err := e.executeSingleMigration(migration, up, progress); err != nil {
+		return err
+	}
+	return e.injectFault(FaultAfterDataWrite, migration.ID)
+}
+
 // executeSingleMigration executes a single migration (up or down)
-func (e *MigrationEngine) executeSingleMigration(migration *Migration, up bool) error {
+func (e *MigrationEngine) executeSingleMigration(migration *Migration, up bool, progress ProgressReporter) error {
+	log, err := e.runMigration(migration, up, progress)
+	if err != nil {
+		return err
+	}
+
+	// The saved progress of a chunked migration is only needed to resume it
+	if err := e.schemaManager.ClearMigrationProgress(migration.ID); err != nil {
+		return err
+	}
+
+	// Keep the inverse of an automatic Down durably, outside of the guarded run
+	if up && migration.HasAutomaticDown() {
+		return e.schemaManager.SaveUndoLog(log)
+	}
+	return nil
+}
+
+// runMigration runs a migration function and its validation, guarding the internal
+// metadata. It returns the operation log of a migration that uses Apply.
+func (e *MigrationEngine) runMigration(migration *Migration, up bool, progress ProgressReporter) (*OpLog, error) {
 	var migrationFunc MigrationFunc
 	var direction string
 
+	var metrics *MigrationMetrics
+	if migration.UpContext != nil || migration.DownContext != nil || migration.ValidateContext != nil {
+		metrics = e.trackMetrics(migration.ID)
+	}
+
+	var log *OpLog
 	if up {
 		migrationFunc = migration.Up
 		direction = "up"
+
+		if migration.UpContext != nil {
+			migrationFunc = e.contextFunc(migration, direction, migration.UpContext, metrics, progress)
+		}
+		if migration.Apply != nil {
+			log = NewOpLog(migration.ID)
+			migrationFunc = func(db *pebble.DB) error {
+				return migration.Apply(NewWriter(db, log))
+			}
+			defer e.saveOpLog(log)
+		}
 	} else {
 		migrationFunc = migration.Down
 		direction = "down"
+
+		if migration.DownContext != nil {
+			migrationFunc = e.contextFunc(migration, direction, migration.DownContext, metrics, progress)
+		}
+
+		if migration.HasAutomaticDown() {
+			migrationFunc = func(db *pebble.DB) error {
+				return e.schemaManager.undoRecorded(migration.ID, e.forceUndo)
+			}
+		}
 	}
 
 	if migrationFunc == nil {
-		return fmt.Errorf("migration %s has no %s function", migration.ID, direction)
+		return nil, fmt.Errorf("migration %s has no %s function", migration.ID, direction)
 	}
 
-	if e.verbose {
-		fmt.Printf("Executing %s migration for %s...\n", direction, migration.ID)
-	}
+	e.debugf("Executing %s migration for %s...", direction, migration.ID)
 
-	// Execute the migration function
-	if err := migrationFunc(e.db); err != nil {
-		return fmt.Errorf("%s migration failed: %w", direction, err)
+	validateFunc := migration.Validate
+	if migration.ValidateContext != nil {
+		validateFunc = e.contextFunc(migration, direction, migration.ValidateContext, metrics, progress)
 	}
 
-	// Run validation if available
-	if migration.Validate != nil {
-		if e.verbose {
-			fmt.Printf("Validating migration %s...\n", migration.ID)
+	run := func() error {
+		// Check where an interrupted chunked migration resumes
+		if err := e.validateSavedProgress(migration, direction, metrics, progress); err != nil {
+			return err
+		}
+
+		// Execute the migration function
+		execute := StepEvent{Step: StepExecute, MigrationID: migration.ID, Direction: direction}
+		if err := e.interceptStep(execute, func() error { return migrationFunc(e.db) }); err != nil {
+			return fmt.Errorf("%s migration failed: %w", direction, err)
 		}
 
-		if err := migration.Validate(e.db); err != nil {
-			return fmt.Errorf("migration validation failed: %w", err)
+		// Run validation if available
+		if validateFunc != nil {
+			e.debugf("Validating migration %s...", migration.ID)
+
+			validate := StepEvent{Step: StepValidate, MigrationID: migration.ID, Direction: direction}
+			if err := e.interceptStep(validate, func() error { return validateFunc(e.db) }); err != nil {
+				return fmt.Errorf("migration validation failed: %w", err)
+			}
 		}
+
+		return nil
 	}
 
-	return nil
+	var err error
+	if migration.AllowInternalWrites {
+		err = run()
+	} else {
+		// Fail the migration if it touched the internal migration metadata
+		err = e.schemaManager.guardReservedKeys(migration.ID, run)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// contextFunc returns a MigrationFunc running fn with a MigrationContext of the
+// engine, counting in metrics
+func (e *MigrationEngine) contextFunc(migration *Migration, direction string, fn ContextFunc, metrics *MigrationMetrics, progress ProgressReporter) MigrationFunc {
+	return func(db *pebble.DB) error {
+		ctx := newMigrationContext(e.planContext(), db, migration.ID, direction, e.log(), progress)
+		ctx.DryRun = e.inDryRun
+		ctx.Metrics = metrics
+		ctx.schemaManager = e.schemaManager
+		ctx.chunkPreImages = migration.ChunkPreImages
+		return fn(ctx)
+	}
+}
+
+// trackMetrics creates the metrics of a migration run, replacing those of an
+// earlier run
+func (e *MigrationEngine) trackMetrics(migrationID string) *MigrationMetrics {
+	metrics := NewMigrationMetrics()
+	e.metricsMu.Lock()
+	defer e.metricsMu.Unlock()
+	if e.metrics == nil {
+		e.metrics = make(map[string]*MigrationMetrics)
+	}
+	e.metrics[migrationID] = metrics
+	return metrics
+}
+
+// saveOpLog saves an operation log alongside the backups if recording is enabled.
+// Logs of failed migrations are kept as well, so partial writes can be undone.
+func (e *MigrationEngine) saveOpLog(log *OpLog) {
+	if !e.recordOps || e.backupManager == nil || len(log.Ops) == 0 {
+		return
+	}
+
+	path, err := e.backupManager.SaveOpLog(log)
+	if err != nil {
+		e.warnf(nil, "operation log", "failed to save operation log for %s: %v", log.MigrationID, err)
+		return
+	}
+	e.log().Printf("Operation log saved: %s (%d operations)", path, len(log.Ops))
 }
 
 // Simulation methods for dry-run mode
 
-func (e *MigrationEngine) simulateUpgrade(plan *ExecutionPlan, progressCallback func(string)) error {
-	progressCallback("DRY RUN: Simulating upgrade...")
+func (e *MigrationEngine) simulateUpgrade(plan *ExecutionPlan, progress ProgressReporter) error {
+	reportf(progress, ProgressDryRun, "DRY RUN: Simulating upgrade...")
 
 	for i, migration := range plan.Migrations {
-		progressCallback(fmt.Sprintf("DRY RUN: Would execute migration %d/%d: %s", i+1, len(plan.Migrations), migration.ID))
-		progressCallback(fmt.Sprintf("  Description: %s", migration.Description))
-		progressCallback(fmt.Sprintf("  Version: %d (%s)", migration.Version, FormatVersionAsTime(migration.Version)))
+		reportf(progress, ProgressDryRun, "DRY RUN: Would execute migration %d/%d: %s", i+1, len(plan.Migrations), migration.ID)
+		reportf(progress, ProgressDryRun, "  Description: %s", migration.Description)
+		reportf(progress, ProgressDryRun, "  Version: %d (%s)", migration.Version, FormatVersionAsTime(migration.Version))
 	}
 
-	progressCallback(fmt.Sprintf("DRY RUN: Would upgrade from version %d to %d", plan.CurrentVersion, plan.TargetVersion))
+	reportf(progress, ProgressDryRun, "DRY RUN: Would upgrade from version %d to %d", plan.CurrentVersion, plan.TargetVersion)
 	return nil
 }
 
-func (e *MigrationEngine) simulateDowngrade(plan *ExecutionPlan, progressCallback func(string)) error {
-	progressCallback("DRY RUN: Simulating downgrade...")
+func (e *MigrationEngine) simulateDowngrade(plan *ExecutionPlan, progress ProgressReporter) error {
+	reportf(progress, ProgressDryRun, "DRY RUN: Simulating downgrade...")
 
 	for i, migration := range plan.Migrations {
-		progressCallback(fmt.Sprintf("DRY RUN: Would rollback migration %d/%d: %s", i+1, len(plan.Migrations), migration.ID))
-		progressCallback(fmt.Sprintf("  Description: %s", migration.Description))
-		progressCallback(fmt.Sprintf("  Version: %d (%s)", migration.Version, FormatVersionAsTime(migration.Version)))
+		reportf(progress, ProgressDryRun, "DRY RUN: Would rollback migration %d/%d: %s", i+1, len(plan.Migrations), migration.ID)
+		reportf(progress, ProgressDryRun, "  Description: %s", migration.Description)
+		reportf(progress, ProgressDryRun, "  Version: %d (%s)", migration.Version, FormatVersionAsTime(migration.Version))
 	}
 
-	progressCallback(fmt.Sprintf("DRY RUN: Would downgrade from version %d to %d", plan.CurrentVersion, plan.TargetVersion))
+	reportf(progress, ProgressDryRun, "DRY RUN: Would downgrade from version %d to %d", plan.CurrentVersion, plan.TargetVersion)
 	return nil
 }
 
-func (e *MigrationEngine) simulateRerun(plan *ExecutionPlan, progressCallback func(string)) error {
+func (e *MigrationEngine) simulateRerun(plan *ExecutionPlan, progress ProgressReporter) error {
 	if len(plan.Migrations) != 1 {
 		return fmt.Errorf("rerun plan must contain exactly one migration, got %d", len(plan.Migrations))
 	}
 
 	migration := plan.Migrations[0]
-	progressCallback("DRY RUN: Simulating rerun...")
-	progressCallback(fmt.Sprintf("DRY RUN: Would rollback migration: %s", migration.ID))
-	progressCallback(fmt.Sprintf("DRY RUN: Would re-apply migration: %s", migration.ID))
-	progressCallback(fmt.Sprintf("  Description: %s", migration.Description))
-	progressCallback(fmt.Sprintf("  Version: %d (unchanged) - %s", migration.Version, FormatVersionAsTime(migration.Version)))
+	reportf(progress, ProgressDryRun, "DRY RUN: Simulating rerun...")
+	reportf(progress, ProgressDryRun, "DRY RUN: Would rollback migration: %s", migration.ID)
+	reportf(progress, ProgressDryRun, "DRY RUN: Would re-apply migration: %s", migration.ID)
+	reportf(progress, ProgressDryRun, "  Description: %s", migration.Description)
+	reportf(progress, ProgressDryRun, "  Version: %d (unchanged) - %s", migration.Version, FormatVersionAsTime(migration.Version))
 
 	return nil
 }
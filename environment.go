@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// GetEnvironment returns the environment the schema state is stamped with, or ""
+// if it is not stamped
+func (s *SchemaManager) GetEnvironment() (string, error) {
+	head, err := s.getSchemaHead()
+	if err != nil {
+		return "", err
+	}
+	return head.Environment, nil
+}
+
+// CheckEnvironment returns ErrEnvironmentMismatch if the schema state is stamped
+// with another environment than env. An empty env and an unstamped state pass.
+func (s *SchemaManager) CheckEnvironment(env string) error {
+	if env == "" {
+		return nil
+	}
+	stamped, err := s.GetEnvironment()
+	if err != nil {
+		return err
+	}
+	if stamped != "" && stamped != env {
+		return fmt.Errorf("%w: database belongs to environment %q, not %q", ErrEnvironmentMismatch, stamped, env)
+	}
+	return nil
+}
+
+// StampEnvironment checks env like CheckEnvironment and stamps an unstamped
+// schema state with it, so tools pointed at the database with another
+// environment refuse to change it. A database without schema state is not
+// stamped, to not be mistaken for an initialized one; stamp it after
+// InitializeFreshDatabase.
+func (s *SchemaManager) StampEnvironment(env string) error {
+	if env == "" {
+		return nil
+	}
+	stamped, err := s.GetEnvironment()
+	if err != nil {
+		return err
+	}
+	if stamped == env {
+		return nil
+	}
+	if stamped != "" {
+		return fmt.Errorf("%w: database belongs to environment %q, not %q", ErrEnvironmentMismatch, stamped, env)
+	}
+
+	if exists, err := s.hasSchemaState(); err != nil || !exists {
+		return err
+	}
+	return s.SetEnvironment(env)
+}
+
+// SetEnvironment stamps the schema state with env, replacing the environment it
+// was stamped with. An empty env removes the stamp. The database must have
+// schema state.
+func (s *SchemaManager) SetEnvironment(env string) error {
+	exists, err := s.hasSchemaState()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("database has no schema state to stamp")
+	}
+	return s.modifySchema(func(head *SchemaVersion) ([]MigrationRecord, error) {
+		head.Environment = env
+		return nil, nil
+	})
+}
+
+// hasSchemaState reports whether the schema key exists
+func (s *SchemaManager) hasSchemaState() (bool, error) {
+	_, closer, err := s.db.Get([]byte(s.schemaKey))
+	if err == pebble.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	closer.Close()
+	return true, nil
+}
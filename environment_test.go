@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestStartupEnvironment(t *testing.T) {
+	originalRegistry := GlobalRegistry
+	defer func() { GlobalRegistry = originalRegistry }()
+
+	GlobalRegistry = NewMigrationRegistry()
+	GlobalRegistry.Register(&Migration{
+		ID:   "1754917200_first",
+		Up:   func(db *pebble.DB) error { return nil },
+		Down: func(db *pebble.DB) error { return nil },
+	})
+
+	for _, encoding := range []SchemaEncoding{SchemaEncodingJSON, SchemaEncodingProto} {
+		t.Run(string(encoding), func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "test.db")
+			db, err := pebble.Open(dbPath, &pebble.Options{})
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+			schemaManager := NewSchemaManager(db)
+
+			opts := DefaultStartupOptions()
+			opts.SchemaEncoding = encoding
+			opts.Environment = "production"
+			if err := CheckAndRunStartupMigrations(db, dbPath, opts); err != nil {
+				t.Fatalf("Failed to start: %v", err)
+			}
+			if env, err := schemaManager.GetEnvironment(); err != nil || env != "production" {
+				t.Fatalf("Expected the database to be stamped production, got %q, %v", env, err)
+			}
+
+			opts.Environment = "staging"
+			if err := CheckAndRunStartupMigrations(db, dbPath, opts); !errors.Is(err, ErrEnvironmentMismatch) {
+				t.Errorf("Expected ErrEnvironmentMismatch, got %v", err)
+			}
+			opts.Environment = ""
+			if err := CheckAndRunStartupMigrations(db, dbPath, opts); err != nil {
+				t.Errorf("Expected an unset environment not to be checked, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStampEnvironment(t *testing.T) {
+	db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	schemaManager := NewSchemaManager(db)
+
+	// A database without schema state is not stamped, so it still counts as fresh
+	if err := schemaManager.StampEnvironment("dev"); err != nil {
+		t.Fatalf("Failed to stamp: %v", err)
+	}
+	if _, closer, err := db.Get([]byte(SchemaVersionKey)); err != pebble.ErrNotFound {
+		if err == nil {
+			closer.Close()
+		}
+		t.Fatalf("Expected no schema state to be written, got %v", err)
+	}
+	if err := schemaManager.SetEnvironment("dev"); err == nil {
+		t.Errorf("Expected stamping a database without schema state to fail")
+	}
+
+	if err := schemaManager.InitializeFreshDatabase(NewMigrationRegistry()); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	if err := schemaManager.StampEnvironment("dev"); err != nil {
+		t.Fatalf("Failed to stamp: %v", err)
+	}
+	if err := schemaManager.CheckEnvironment("dev"); err != nil {
+		t.Errorf("Expected the same environment to pass, got %v", err)
+	}
+	if err := schemaManager.CheckEnvironment("production"); !errors.Is(err, ErrEnvironmentMismatch) {
+		t.Errorf("Expected ErrEnvironmentMismatch, got %v", err)
+	}
+	if err := schemaManager.StampEnvironment("production"); !errors.Is(err, ErrEnvironmentMismatch) {
+		t.Errorf("Expected stamping over another environment to fail, got %v", err)
+	}
+
+	// Updates keep the stamp
+	if err := schemaManager.MarkMigrationStarted(); err != nil {
+		t.Fatalf("Failed to update schema: %v", err)
+	}
+	if env, err := schemaManager.GetEnvironment(); err != nil || env != "dev" {
+		t.Errorf("Expected the stamp to survive an update, got %q, %v", env, err)
+	}
+
+	if err := schemaManager.SetEnvironment("production"); err != nil {
+		t.Fatalf("Failed to restamp: %v", err)
+	}
+	if err := schemaManager.CheckEnvironment("production"); err != nil {
+		t.Errorf("Expected the new environment to pass, got %v", err)
+	}
+}
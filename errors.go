@@ -0,0 +1,121 @@
+package migrate
+
+import "errors"
+
+// Sentinel errors returned (wrapped) by this package. Use errors.Is to test for them.
+var (
+	// ErrInvalidMigrationID is returned when a migration ID does not follow the ID format
+	ErrInvalidMigrationID = errors.New("invalid migration ID")
+
+	// ErrCorruptSchemaState is returned when the stored schema state cannot be decoded
+	// or contains values that are not valid
+	ErrCorruptSchemaState = errors.New("corrupt schema state")
+
+	// ErrInvalidBackupMetadata is returned when a backup metadata file cannot be parsed
+	ErrInvalidBackupMetadata = errors.New("invalid backup metadata")
+
+	// ErrReservedKeyModified is returned when a migration writes or deletes keys in the
+	// internal namespace (SchemaVersionKey or keys under MigrationPrefix)
+	ErrReservedKeyModified = errors.New("reserved key modified")
+
+	// ErrInjectedFault is returned by fault injectors to simulate a failing operation
+	ErrInjectedFault = errors.New("injected fault")
+
+	// ErrSimulatedCrash is returned by fault injectors to simulate the process dying;
+	// the engine stops without recording the failure
+	ErrSimulatedCrash = errors.New("simulated crash")
+
+	// ErrInvalidOpLog is returned when an operation log cannot be decoded
+	ErrInvalidOpLog = errors.New("invalid operation log")
+
+	// ErrOpLogConflict is returned when replaying or undoing an operation log would
+	// overwrite keys that changed since the log was recorded
+	ErrOpLogConflict = errors.New("operation log conflict")
+
+	// ErrNoUndoLog is returned when a migration without a Down function is rolled
+	// back but no recorded undo log is stored for it
+	ErrNoUndoLog = errors.New("no undo log recorded")
+
+	// ErrKeyConflict is returned by a strict planner when two planned migrations
+	// declare overlapping key prefixes without a dependency between them
+	ErrKeyConflict = errors.New("key prefix conflict")
+
+	// ErrInvalidLockFile is returned when a lock file cannot be parsed
+	ErrInvalidLockFile = errors.New("invalid lock file")
+
+	// ErrLockMismatch is returned when the registered migrations do not match the lock file
+	ErrLockMismatch = errors.New("migrations do not match lock file")
+
+	// ErrSchemaConflict is returned (as a *SchemaConflictError) when the schema state
+	// was changed by another writer after it was read
+	ErrSchemaConflict = errors.New("schema state changed concurrently")
+
+	// ErrBackupReferenced is returned when removing or converting a backup that
+	// another operation holds a reference to
+	ErrBackupReferenced = errors.New("backup is referenced")
+
+	// ErrUnsupportedSchemaVersion is returned (as a *SchemaVersionError) at startup
+	// when the schema version is outside the window the application supports
+	ErrUnsupportedSchemaVersion = errors.New("unsupported schema version")
+
+	// ErrDatabaseLocked is returned (as a *DatabaseLockedError) when the database
+	// cannot be opened because another process holds its lock
+	ErrDatabaseLocked = errors.New("database is locked")
+
+	// ErrManifestDrift is returned when the files of a migrations package and the
+	// migrations they declare do not match
+	ErrManifestDrift = errors.New("migration files and IDs drift")
+
+	// ErrDuplicateVersion is returned when two migrations share a version while
+	// unique versions are enforced
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+
+	// ErrInvalidCursor is returned when the saved progress of an interrupted
+	// chunked migration fails validation before the migration resumes
+	ErrInvalidCursor = errors.New("invalid migration cursor")
+
+	// ErrNoSavedProgress is returned when abandoning a migration that saved no
+	// progress running up
+	ErrNoSavedProgress = errors.New("no saved migration progress")
+
+	// ErrSampleValidation is returned when too many sampled keys fail a
+	// sampling validation
+	ErrSampleValidation = errors.New("sample validation failed")
+
+	// ErrFingerprintMismatch is returned when the data under a prefix no longer
+	// matches its stored fingerprint
+	ErrFingerprintMismatch = errors.New("fingerprint mismatch")
+
+	// ErrEnvironmentMismatch is returned when the schema state is stamped with
+	// another environment than the one expected
+	ErrEnvironmentMismatch = errors.New("environment mismatch")
+
+	// ErrMissingMetadata is returned when a migration lacks metadata required by
+	// the registry's MetadataPolicy
+	ErrMissingMetadata = errors.New("missing migration metadata")
+
+	// ErrPolicyViolation is returned when a plan policy refuses to approve a plan,
+	// see PolicyError
+	ErrPolicyViolation = errors.New("plan policy violation")
+
+	// ErrDependencyNotApplied is returned when applying a single migration whose
+	// dependencies are not all applied
+	ErrDependencyNotApplied = errors.New("dependency not applied")
+
+	// ErrPlanValidation is returned when the validators run after a plan fail it,
+	// see PlanValidationError
+	ErrPlanValidation = errors.New("plan validation failed")
+
+	// ErrFreshDatabase is returned when initializing a database without any
+	// application data with FreshDatabaseFail
+	ErrFreshDatabase = errors.New("fresh database")
+
+	// ErrConcurrentExecution is returned when an operation that changes the
+	// schema state is started on a database while another is running on it in
+	// the same process. Guarded are MigrationEngine.ExecutePlan and its variants
+	// (and ApplyOne, which executes a plan), RestoreBackup and AbandonMigration,
+	// SchemaManager.ApplyFix, and CheckAndRunStartupMigrations unless ReadOnly. Other SchemaManager methods, e.g. ForceCleanState or
+	// SetSchemaVersion, are not guarded; they rely on the revision check of
+	// ErrSchemaConflict.
+	ErrConcurrentExecution = errors.New("concurrent execution")
+)
@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+const (
+	// defaultCompressionRatio is the expected size of a compressed backup relative
+	// to the database when no earlier compressed backup records one
+	defaultCompressionRatio = 0.5
+	// defaultBackupThroughput is the expected backup speed in bytes of database
+	// per second when no earlier backup records one
+	defaultBackupThroughput = 100 << 20
+	// longBackupThreshold is the estimated duration from which CreateBackup
+	// prints the estimate before it starts
+	longBackupThreshold = 10 * time.Second
+)
+
+// BackupEstimate is the expected size and duration of a backup
+type BackupEstimate struct {
+	SourceSize       int64         `json:"source_size"`       // Disk usage of the database, from pebble metrics
+	Size             int64         `json:"size"`              // Expected size of the backup
+	CompressionRatio float64       `json:"compression_ratio"` // Expected backup size relative to the database; 1 for uncompressed backups without history
+	Duration         time.Duration `json:"duration"`          // Expected time to create the backup
+	FromHistory      bool          `json:"from_history"`      // Whether the ratio and duration come from earlier backups rather than defaults
+}
+
+// EstimateBackupSize predicts the size and duration of a backup of db. The
+// database size comes from pebble metrics, so it includes the WAL and obsolete
+// files not yet deleted. The compression ratio and speed are averaged over the
+// earlier backups of the same kind (compressed or not) that record them, and
+// fall back to defaults otherwise.
+func (b *BackupManager) EstimateBackupSize(db *pebble.DB) *BackupEstimate {
+	estimate := &BackupEstimate{
+		SourceSize:       int64(db.Metrics().DiskSpaceUsage()),
+		CompressionRatio: 1,
+	}
+	if b.compress {
+		estimate.CompressionRatio = defaultCompressionRatio
+	}
+	throughput := float64(defaultBackupThroughput)
+
+	// Earlier backups without SOURCE_SIZE and DURATION predate the estimate
+	backups, _ := b.ListBackups()
+	var sourceSize, size int64
+	var duration time.Duration
+	for _, backup := range backups {
+		if strings.HasSuffix(backup.Path, ".tar.gz") != b.compress ||
+			backup.SourceSize == 0 || backup.Duration == 0 {
+			continue
+		}
+		sourceSize += backup.SourceSize
+		size += backup.Size
+		duration += backup.Duration
+	}
+	if sourceSize > 0 {
+		estimate.CompressionRatio = float64(size) / float64(sourceSize)
+		throughput = float64(sourceSize) / duration.Seconds()
+		estimate.FromHistory = true
+	}
+
+	estimate.Size = int64(float64(estimate.SourceSize) * estimate.CompressionRatio)
+	estimate.Duration = time.Duration(float64(estimate.SourceSize) / throughput * float64(time.Second))
+	return estimate
+}
@@ -0,0 +1,60 @@
+package migrate
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestEstimateBackupSize(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 1000; i++ {
+		db.Set([]byte(fmt.Sprintf("key_%04d", i)), []byte("some repetitive value some repetitive value"), pebble.NoSync)
+	}
+	db.Flush()
+
+	backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{Compress: true})
+	estimate := backupManager.EstimateBackupSize(db)
+	if estimate.SourceSize == 0 || estimate.FromHistory {
+		t.Fatalf("Expected a default estimate of a non-empty database, got %+v", estimate)
+	}
+	if estimate.CompressionRatio != defaultCompressionRatio || estimate.Size != int64(float64(estimate.SourceSize)*defaultCompressionRatio) {
+		t.Errorf("Expected the default compression ratio, got %+v", estimate)
+	}
+
+	backup, err := backupManager.CreateBackup(db, "First")
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	info, err := backupManager.readBackupMetadata(backup.Path)
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if info.SourceSize != estimate.SourceSize || info.Duration <= 0 {
+		t.Fatalf("Expected the source size and duration in the metadata, got %+v", info)
+	}
+
+	estimate = backupManager.EstimateBackupSize(db)
+	ratio := float64(info.Size) / float64(info.SourceSize)
+	if !estimate.FromHistory || estimate.CompressionRatio != ratio {
+		t.Errorf("Expected the ratio %.3f of the earlier backup, got %+v", ratio, estimate)
+	}
+	if estimate.Duration <= 0 || estimate.Duration > time.Minute {
+		t.Errorf("Expected a duration from the earlier backup, got %s", estimate.Duration)
+	}
+
+	// Uncompressed backups do not use the history of compressed ones
+	uncompressed := NewBackupManagerWithOptions(dbPath, BackupOptions{})
+	if estimate := uncompressed.EstimateBackupSize(db); estimate.FromHistory || estimate.CompressionRatio != 1 {
+		t.Errorf("Expected a default uncompressed estimate, got %+v", estimate)
+	}
+}
@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// EventLogPlanFailed is the phase of the event log entry written when a plan fails
+const EventLogPlanFailed ProgressPhase = "plan_failed"
+
+// EventLogEntry is a line of the event log, a progress event of a plan execution
+// with the time it was reported
+type EventLogEntry struct {
+	Time        time.Time     `json:"time"`
+	Plan        ExecutionType `json:"plan"`
+	Phase       ProgressPhase `json:"phase"`
+	Step        int           `json:"step,omitempty"`
+	Total       int           `json:"total,omitempty"`
+	MigrationID string        `json:"migration_id,omitempty"`
+	Direction   string        `json:"direction,omitempty"`
+	Percent     float64       `json:"percent"`
+	Message     string        `json:"message,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// eventLog appends the events of a plan execution to a JSON lines file
+type eventLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	plan     ExecutionType
+	next     ProgressReporter
+	writeErr error // First failed write
+}
+
+// openEventLog opens the event log at path for appending the events of a plan,
+// which are also passed on to next
+func openEventLog(path string, plan ExecutionType, next ProgressReporter) (*eventLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	return &eventLog{file: file, plan: plan, next: next}, nil
+}
+
+// Report writes the event to the log and passes it on
+func (l *eventLog) Report(event ProgressEvent) {
+	l.write(EventLogEntry{
+		Time:        time.Now(),
+		Plan:        l.plan,
+		Phase:       event.Phase,
+		Step:        event.Step,
+		Total:       event.Total,
+		MigrationID: event.MigrationID,
+		Direction:   event.Direction,
+		Percent:     event.Percent,
+		Message:     event.Message,
+	})
+	l.next.Report(event)
+}
+
+// write appends an entry to the log. Write errors are kept for Close so that a
+// full disk does not fail the plan.
+func (l *eventLog) write(entry EventLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := json.Marshal(entry)
+	if err == nil {
+		_, err = l.file.Write(append(data, '\n'))
+	}
+	if err != nil && l.writeErr == nil {
+		l.writeErr = err
+	}
+}
+
+// Close writes the failure of the plan, if it failed, and closes the log. It
+// returns the first error writing the log.
+func (l *eventLog) Close(planErr error) error {
+	if planErr != nil {
+		l.write(EventLogEntry{Time: time.Now(), Plan: l.plan, Phase: EventLogPlanFailed, Percent: -1, Error: planErr.Error()})
+	}
+	if err := l.file.Close(); err != nil && l.writeErr == nil {
+		l.writeErr = err
+	}
+	if l.writeErr != nil {
+		return fmt.Errorf("failed to write event log: %w", l.writeErr)
+	}
+	return nil
+}
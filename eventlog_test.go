@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestEventLog(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	registry.Register(&Migration{
+		ID:   "1754917200_first",
+		Up:   func(db *pebble.DB) error { return nil },
+		Down: func(db *pebble.DB) error { return nil },
+	})
+	registry.Register(&Migration{
+		ID:   "1754917300_broken",
+		Up:   func(db *pebble.DB) error { return errors.New("boom") },
+		Down: func(db *pebble.DB) error { return nil },
+	})
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+	engine.SetLogger(&NopLogger{})
+	logPath := filepath.Join(dir, "events.jsonl")
+	engine.SetEventLog(logPath)
+
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	var reported int
+	if err := engine.ExecutePlanWithProgress(plan, ProgressEventFunc(func(event ProgressEvent) {
+		reported++
+	})); err == nil {
+		t.Fatalf("Expected the broken migration to fail the plan")
+	}
+
+	file, err := os.Open(logPath)
+	if err != nil {
+		t.Fatalf("Failed to open event log: %v", err)
+	}
+	defer file.Close()
+	var entries []EventLogEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry EventLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid event log line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	// Every reported event is logged, followed by the failure
+	if len(entries) != reported+1 {
+		t.Fatalf("Expected %d entries, got %d: %+v", reported+1, len(entries), entries)
+	}
+	if entries[0].Phase != ProgressPlanStarted || entries[0].Plan != ExecutionTypeUpgrade || entries[0].Time.IsZero() {
+		t.Errorf("Unexpected first entry: %+v", entries[0])
+	}
+	last := entries[len(entries)-1]
+	if last.Phase != EventLogPlanFailed || last.Error == "" {
+		t.Errorf("Expected the failure as the last entry, got %+v", last)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Time.Before(entries[i-1].Time) {
+			t.Errorf("Expected entries in order, entry %d is earlier than entry %d", i, i-1)
+		}
+	}
+
+	t.Run("UnwritablePathFailsPlan", func(t *testing.T) {
+		engine.SetEventLog(filepath.Join(dir, "missing", "events.jsonl"))
+		defer engine.SetEventLog("")
+		if err := engine.ExecutePlan(plan, nil); err == nil {
+			t.Errorf("Expected a plan with an unwritable event log to fail")
+		}
+	})
+}
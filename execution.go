@@ -0,0 +1,41 @@
+package migrate
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// executions holds the databases plans are executing on in this process, and
+// what is executing on them
+var executions = struct {
+	sync.Mutex
+	running map[*pebble.DB]string
+}{running: make(map[*pebble.DB]string)}
+
+// beginExecution claims db for what, e.g. "upgrade plan", until the returned
+// function is called. It fails with ErrConcurrentExecution if db is claimed
+// already, by any engine of the process.
+func beginExecution(db *pebble.DB, what string) (func(), error) {
+	executions.Lock()
+	defer executions.Unlock()
+	if running, ok := executions.running[db]; ok {
+		return nil, fmt.Errorf("%w: cannot start %s while %s is executing on the database", ErrConcurrentExecution, what, running)
+	}
+	executions.running[db] = what
+	return func() {
+		executions.Lock()
+		defer executions.Unlock()
+		delete(executions.running, db)
+	}, nil
+}
+
+// claim claims the database of the engine for what, see beginExecution, unless
+// the caller claimed it for the engine
+func (e *MigrationEngine) claim(what string) (func(), error) {
+	if e.claimed {
+		return func() {}, nil
+	}
+	return beginExecution(e.db, what)
+}
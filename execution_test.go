@@ -0,0 +1,75 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestConcurrentExecution(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	noop := func(db *pebble.DB) error { return nil }
+	other := NewMigrationRegistry()
+	if err := other.Register(&Migration{ID: "1754917300_other", Up: noop, Down: noop}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	schemaManager := NewSchemaManager(db)
+	otherEngine := NewMigrationEngineWithBackup(db, schemaManager, other, dbPath)
+	otherEngine.SetBackupEnabled(false)
+
+	// Plans, startup checks, restores, abandons and fixes started while a plan
+	// executes on the database fail
+	var planErr, startupErr, restoreErr, abandonErr, fixErr error
+	overlap := func(db *pebble.DB) error {
+		plan, _ := NewMigrationPlanner(other, schemaManager).PlanUpgrade()
+		planErr = otherEngine.ExecutePlan(plan, nil)
+		startupErr = CheckAndRunStartupMigrations(db, dbPath, DefaultStartupOptions())
+		_, restoreErr = otherEngine.RestoreBackup(dbPath+".backup", &pebble.Options{})
+		abandonErr = otherEngine.AbandonMigration("1754917300_other", nil)
+		_, fixErr = schemaManager.ApplyFix(&FixScript{Description: "Overlapping fix"})
+		return nil
+	}
+	registry := NewMigrationRegistry()
+	if err := registry.Register(&Migration{ID: "1754917200_first", Up: overlap, Down: noop}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	if !errors.Is(planErr, ErrConcurrentExecution) {
+		t.Errorf("Expected the overlapping plan to fail, got %v", planErr)
+	}
+	if !errors.Is(startupErr, ErrConcurrentExecution) {
+		t.Errorf("Expected the overlapping startup check to fail, got %v", startupErr)
+	}
+	if !errors.Is(restoreErr, ErrConcurrentExecution) || otherEngine.DB() != db {
+		t.Errorf("Expected the overlapping restore to fail without closing the database, got %v", restoreErr)
+	}
+	if !errors.Is(abandonErr, ErrConcurrentExecution) {
+		t.Errorf("Expected the overlapping abandon to fail, got %v", abandonErr)
+	}
+	if !errors.Is(fixErr, ErrConcurrentExecution) {
+		t.Errorf("Expected the overlapping fix to fail, got %v", fixErr)
+	}
+
+	// The database is released once the plan completed
+	plan, _ = NewMigrationPlanner(other, schemaManager).PlanUpgrade()
+	if err := otherEngine.ExecutePlan(plan, nil); err != nil {
+		t.Errorf("Expected the next plan to execute, got %v", err)
+	}
+	if applied, _ := schemaManager.IsMigrationApplied("1754917300_other"); !applied {
+		t.Error("Expected the next plan to apply its migration")
+	}
+}
@@ -0,0 +1,299 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// KeyFormat is the file format of exported key/value pairs
+type KeyFormat string
+
+const (
+	KeyFormatJSONL KeyFormat = "jsonl" // One {"key": ..., "value": ...} object per line
+	KeyFormatCSV   KeyFormat = "csv"   // A key,value header, then one row per pair
+)
+
+// ParseKeyFormat parses the name of a key format
+func ParseKeyFormat(name string) (KeyFormat, error) {
+	switch KeyFormat(name) {
+	case KeyFormatJSONL, KeyFormatCSV:
+		return KeyFormat(name), nil
+	case "":
+		return KeyFormatJSONL, nil
+	}
+	return "", fmt.Errorf("unknown format %q: use jsonl or csv", name)
+}
+
+// importBatchSize is the number of pairs ImportKeys commits at once
+const importBatchSize = 1000
+
+// ExportOptions controls ExportKeys and ImportKeys
+type ExportOptions struct {
+	// Prefix limits the pairs to keys under it. Default: all keys
+	Prefix []byte
+
+	// Format is the file format. Default: KeyFormatJSONL
+	Format KeyFormat
+
+	// Encoding is how keys and values are written in the file: "" (as text),
+	// "base64" or "hex", as in the set operation of script migrations. Binary data
+	// needs base64 or hex.
+	Encoding string
+
+	// Codec transforms every value, see RegisterCodec: on export before it is
+	// written, on import before it is stored, e.g. to export values compressed
+	// in the database as plain text and compress them again on import
+	Codec string
+
+	// Decode renders every value with the decoder registered for its key on
+	// export, see RegisterValueDecoder, for reading rather than loading: an
+	// export with Decode cannot be imported. It excludes Codec.
+	Decode bool
+}
+
+// exportedPair is a key/value pair of a JSONL export
+type exportedPair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ExportKeys writes the key/value pairs under opts.Prefix to w in key order and
+// returns their number. Internal migration keys are skipped.
+func (s *SchemaManager) ExportKeys(w io.Writer, opts ExportOptions) (int64, error) {
+	codec, err := exportCodec(opts.Codec)
+	if err != nil {
+		return 0, err
+	}
+	format, err := ParseKeyFormat(string(opts.Format))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := encodeExported(nil, opts.Encoding); err != nil {
+		return 0, err
+	}
+	if opts.Decode && codec != nil {
+		return 0, fmt.Errorf("decoding values excludes a codec")
+	}
+
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: opts.Prefix,
+		UpperBound: prefixUpperBound(opts.Prefix),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read keys: %w", err)
+	}
+	defer iter.Close()
+
+	buffered := bufio.NewWriter(w)
+	var csvWriter *csv.Writer
+	if format == KeyFormatCSV {
+		csvWriter = csv.NewWriter(buffered)
+		if err := csvWriter.Write([]string{"key", "value"}); err != nil {
+			return 0, err
+		}
+	}
+	encoder := json.NewEncoder(buffered)
+
+	var count int64
+	for iter.First(); iter.Valid(); iter.Next() {
+		if s.IsReservedKey(iter.Key()) {
+			continue
+		}
+		value := iter.Value()
+		if codec != nil {
+			if value, err = codec(iter.Key(), value); err != nil {
+				return count, fmt.Errorf("codec %s failed on key %q: %w", opts.Codec, iter.Key(), err)
+			}
+		}
+		if opts.Decode {
+			if value, _, err = DecodeValue(iter.Key(), value); err != nil {
+				return count, err
+			}
+		}
+		key, err := encodeExported(iter.Key(), opts.Encoding)
+		if err != nil {
+			return count, fmt.Errorf("key %q: %w", iter.Key(), err)
+		}
+		encodedValue, err := encodeExported(value, opts.Encoding)
+		if err != nil {
+			return count, fmt.Errorf("value of key %q: %w", iter.Key(), err)
+		}
+
+		if csvWriter != nil {
+			err = csvWriter.Write([]string{key, encodedValue})
+		} else {
+			err = encoder.Encode(exportedPair{Key: key, Value: encodedValue})
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to write export: %w", err)
+		}
+		count++
+	}
+	if err := iter.Error(); err != nil {
+		return count, fmt.Errorf("failed to read keys: %w", err)
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return count, fmt.Errorf("failed to write export: %w", err)
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return count, fmt.Errorf("failed to write export: %w", err)
+	}
+	return count, nil
+}
+
+// ImportKeys stores the key/value pairs of an export read from r, overwriting
+// existing values, and returns their number. Every key must be under opts.Prefix
+// and outside the internal migration keys. Pairs are committed in batches, so a
+// failure leaves the batches before it stored.
+func (s *SchemaManager) ImportKeys(r io.Reader, opts ExportOptions) (int64, error) {
+	codec, err := exportCodec(opts.Codec)
+	if err != nil {
+		return 0, err
+	}
+	format, err := ParseKeyFormat(string(opts.Format))
+	if err != nil {
+		return 0, err
+	}
+	if opts.Decode {
+		return 0, fmt.Errorf("an export with decoded values cannot be imported")
+	}
+
+	next := jsonlPairs(r)
+	if format == KeyFormatCSV {
+		next, err = csvPairs(r)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var count int64
+	batch := s.db.NewBatch()
+	defer func() { batch.Close() }()
+	for n := 1; ; n++ {
+		pair, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("record %d: %w", n, err)
+		}
+
+		key, err := decodeScriptValue(pair.Key, opts.Encoding)
+		if err != nil {
+			return count, fmt.Errorf("record %d: key: %w", n, err)
+		}
+		value, err := decodeScriptValue(pair.Value, opts.Encoding)
+		if err != nil {
+			return count, fmt.Errorf("record %d: value: %w", n, err)
+		}
+		if !bytes.HasPrefix(key, opts.Prefix) {
+			return count, fmt.Errorf("record %d: key %q is not under prefix %q", n, key, opts.Prefix)
+		}
+		if s.IsReservedKey(key) {
+			return count, fmt.Errorf("record %d: key %q is an internal migration key", n, key)
+		}
+		if codec != nil {
+			if value, err = codec(key, value); err != nil {
+				return count, fmt.Errorf("record %d: codec %s failed: %w", n, opts.Codec, err)
+			}
+		}
+
+		if err := batch.Set(key, value, nil); err != nil {
+			return count, err
+		}
+		if batch.Count() >= importBatchSize {
+			if err := batch.Commit(pebble.Sync); err != nil {
+				return count, fmt.Errorf("failed to store keys: %w", err)
+			}
+			count += int64(batch.Count())
+			batch.Close()
+			batch = s.db.NewBatch()
+		}
+	}
+
+	if !batch.Empty() {
+		if err := batch.Commit(pebble.Sync); err != nil {
+			return count, fmt.Errorf("failed to store keys: %w", err)
+		}
+		count += int64(batch.Count())
+	}
+	return count, nil
+}
+
+// jsonlPairs returns a function reading the pairs of a JSONL export, io.EOF
+// after the last one
+func jsonlPairs(r io.Reader) func() (exportedPair, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	return func() (exportedPair, error) {
+		var pair exportedPair
+		err := decoder.Decode(&pair)
+		return pair, err
+	}
+}
+
+// csvPairs returns a function reading the pairs of a CSV export, io.EOF after
+// the last one
+func csvPairs(r io.Reader) (func() (exportedPair, error), error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("empty CSV file, expected a key,value header")
+		}
+		return nil, err
+	}
+	if header[0] != "key" || header[1] != "value" {
+		return nil, fmt.Errorf("unexpected CSV header %q, expected key,value", header)
+	}
+	return func() (exportedPair, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return exportedPair{}, err
+		}
+		return exportedPair{Key: record[0], Value: record[1]}, nil
+	}, nil
+}
+
+// encodeExported encodes a key or value of an export
+func encodeExported(data []byte, encoding string) (string, error) {
+	switch encoding {
+	case "":
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("binary data cannot be exported as text, use the base64 or hex encoding")
+		}
+		return string(data), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	case "hex":
+		return hex.EncodeToString(data), nil
+	default:
+		return "", fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+// exportCodec returns the codec registered under name, or nil for no name
+func exportCodec(name string) (ValueCodec, error) {
+	if name == "" {
+		return nil, nil
+	}
+	codec, ok := lookupCodec(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return codec, nil
+}
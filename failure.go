@@ -0,0 +1,48 @@
+package migrate
+
+import (
+	"fmt"
+	"time"
+)
+
+// MigrationFailure describes the failure that left the schema state dirty. It is
+// kept in the state itself, see SchemaVersion.LastFailure, so that status output
+// and startup errors can report it without searching the history.
+type MigrationFailure struct {
+	MigrationID string     `json:"migration_id"`
+	Type        RecordType `json:"type"` // What failed: apply, rollback or rerun
+	Error       string     `json:"error"`
+	FailedAt    time.Time  `json:"failed_at"`
+	Remediation string     `json:"remediation"` // Suggested next step
+}
+
+// String describes the failure and the suggested next step, e.g. "migration X
+// failed at <time> with <error>; run ..."
+func (f *MigrationFailure) String() string {
+	what := "migration"
+	switch f.Type {
+	case RecordRollback:
+		what = "rollback of migration"
+	case RecordRerun:
+		what = "rerun of migration"
+	}
+	return fmt.Sprintf("%s %s failed at %s with %s; %s",
+		what, f.MigrationID, f.FailedAt.Format(time.RFC3339), f.Error, f.Remediation)
+}
+
+// markDirty marks the schema dirty with a failure recorded earlier
+func (s *SchemaManager) markDirty(failure *MigrationFailure) error {
+	return s.modifySchema(func(currentSchema *SchemaVersion) ([]MigrationRecord, error) {
+		currentSchema.Status = StatusDirty
+		currentSchema.LastFailure = failure
+		return nil, nil
+	})
+}
+
+// failureRemediation suggests how to resolve a failure of the given type
+func failureRemediation(recordType RecordType) string {
+	if recordType == RecordRollback {
+		return "run 'recover' to check whether the rollback completed, then force-clean and roll back again, or restore the backup taken before the plan"
+	}
+	return "run 'recover' to check whether the changes of the migration are in place, then fix and rerun it, or restore the backup taken before the plan"
+}
@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestLastFailure(t *testing.T) {
+	dir := t.TempDir()
+	db, err := pebble.Open(filepath.Join(dir, "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	noop := func(db *pebble.DB) error { return nil }
+	registry := NewMigrationRegistry()
+	registry.Register(&Migration{ID: "1754917200_broken", Up: func(db *pebble.DB) error { return errors.New("disk on fire") }, Down: noop})
+	schemaManager := NewSchemaManager(db)
+	schemaManager.SetEncoding(SchemaEncodingProto)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, filepath.Join(dir, "test.db"))
+	engine.SetBackupEnabled(false)
+
+	plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err := engine.ExecutePlan(plan, nil); err == nil {
+		t.Fatal("Expected the migration to fail")
+	}
+
+	// The failure survives the proto encoding
+	schema, err := schemaManager.GetSchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to get schema version: %v", err)
+	}
+	failure := schema.LastFailure
+	if schema.Status != StatusDirty || failure == nil {
+		t.Fatalf("Expected a dirty state with the failure, got %+v", schema)
+	}
+	if failure.MigrationID != "1754917200_broken" || failure.Type != RecordApply ||
+		!strings.Contains(failure.Error, "disk on fire") || failure.FailedAt.IsZero() || failure.Remediation == "" {
+		t.Errorf("Unexpected failure: %+v", failure)
+	}
+	if !strings.HasPrefix(failure.String(), "migration 1754917200_broken failed at ") || !strings.Contains(failure.String(), "; run 'recover'") {
+		t.Errorf("Unexpected description: %s", failure)
+	}
+	if err := schemaManager.ValidateSchemaState(); err == nil || !strings.Contains(err.Error(), "disk on fire") {
+		t.Errorf("Expected validation to report the failure, got %v", err)
+	}
+	if diagnosis, err := schemaManager.DiagnoseRecovery(registry, nil); err != nil || diagnosis.MigrationID != "1754917200_broken" {
+		t.Errorf("Expected the failed migration to be diagnosed, got %+v (%v)", diagnosis, err)
+	}
+
+	err = CheckAndRunStartupMigrations(db, filepath.Join(dir, "test.db"), DefaultStartupOptions())
+	if err == nil || !strings.Contains(err.Error(), "migration 1754917200_broken failed at") {
+		t.Errorf("Expected startup to report the failure, got %v", err)
+	}
+
+	// Leaving the dirty state clears the failure
+	if err := schemaManager.ForceCleanState(); err != nil {
+		t.Fatalf("Failed to force clean: %v", err)
+	}
+	if schema, err := schemaManager.GetSchemaVersion(); err != nil || schema.LastFailure != nil {
+		t.Errorf("Expected the failure to be cleared, got %+v (%v)", schema, err)
+	}
+}
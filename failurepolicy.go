@@ -0,0 +1,121 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FailurePolicy is what the engine does when a migration of an upgrade plan fails
+type FailurePolicy string
+
+const (
+	// FailureStop marks the state dirty and fails the plan at once (the default)
+	FailureStop FailurePolicy = "stop"
+	// FailureContinue records the failure and continues with the migrations that
+	// do not depend on the failed one; those that do stay pending. The plan then
+	// fails, leaving the state dirty with the first failure.
+	FailureContinue FailurePolicy = "continue"
+	// FailureRollback records the failure and rolls back the migrations the plan
+	// applied before it, leaving the state clean at the version the plan started
+	// from. The failed migration itself is not rolled back; restore the backup
+	// taken before the plan if its partial writes must be undone.
+	FailureRollback FailurePolicy = "rollback"
+)
+
+// ParseFailurePolicy parses a failure policy name, "" being FailureStop
+func ParseFailurePolicy(name string) (FailurePolicy, error) {
+	switch FailurePolicy(strings.ToLower(name)) {
+	case "", FailureStop:
+		return FailureStop, nil
+	case FailureContinue:
+		return FailureContinue, nil
+	case FailureRollback:
+		return FailureRollback, nil
+	default:
+		return "", fmt.Errorf("unknown failure policy %q (expected stop, continue or rollback)", name)
+	}
+}
+
+// SetFailurePolicy sets what the engine does when a migration of an upgrade plan
+// fails, FailureStop by default. Best-effort migrations (see Migration.BestEffort)
+// never fail the plan, whatever the policy.
+func (e *MigrationEngine) SetFailurePolicy(policy FailurePolicy) {
+	e.failurePolicy = policy
+}
+
+// migrationFailed applies the failure policy to a migration of an upgrade plan
+// that failed after running for duration. It returns nil if the plan continues,
+// and otherwise the error the plan fails with.
+func (e *MigrationEngine) migrationFailed(plan *ExecutionPlan, migration *Migration, duration time.Duration, err error, progress ProgressReporter) error {
+	switch {
+	case migration.BestEffort:
+		return e.bestEffortFailed(migration, duration, err, progress)
+
+	case e.failurePolicy == FailureContinue:
+		if markErr := e.schemaManager.MarkMigrationFailed(migration.ID, migration.Description, duration, err); markErr != nil {
+			return fmt.Errorf("migration failed and failed to mark as failed: %w (original error: %v)", markErr, err)
+		}
+		if e.firstFailure == nil {
+			head, headErr := e.schemaManager.getSchemaHead()
+			if headErr != nil {
+				return headErr
+			}
+			e.firstFailure, e.firstFailureErr = head.LastFailure, fmt.Errorf("migration %s failed: %w", migration.ID, err)
+		}
+		e.skipped = append(e.skipped, migration)
+		e.warnf(progress, "failure policy", "migration %s failed, continuing with the migrations that do not depend on it: %v", migration.ID, err)
+		return nil
+
+	case e.failurePolicy == FailureRollback:
+		if markErr := e.schemaManager.recordCleanFailure(migration.ID, migration.Description+" (FAILED, plan rolled back)", duration, err, false); markErr != nil {
+			return fmt.Errorf("migration failed and failed to record the failure: %w (original error: %v)", markErr, err)
+		}
+		applied, appliedErr := e.appliedByPlan(plan)
+		if appliedErr != nil {
+			return fmt.Errorf("migration %s failed: %w (and the plan could not be rolled back: %v)", migration.ID, err, appliedErr)
+		}
+		if len(applied) > 0 {
+			reason := fmt.Sprintf("migration %s failed", migration.ID)
+			if rollbackErr := e.rollbackPlan(plan, applied, reason, progress); rollbackErr != nil {
+				return fmt.Errorf("migration %s failed: %w (and the rollback failed: %v)", migration.ID, err, rollbackErr)
+			}
+		}
+		return fmt.Errorf("migration %s failed, %d migrations of the plan rolled back: %w", migration.ID, len(applied), err)
+
+	default:
+		if markErr := e.schemaManager.MarkMigrationFailed(migration.ID, migration.Description, duration, err); markErr != nil {
+			return fmt.Errorf("migration failed and failed to mark as failed: %w (original error: %v)", markErr, err)
+		}
+		return fmt.Errorf("migration %s failed: %w", migration.ID, err)
+	}
+}
+
+// continuedFailure returns the error an upgrade plan that continued past failed
+// migrations fails with once it ran the rest, after marking the state dirty
+// with the first failure again. It returns nil if no migration failed.
+func (e *MigrationEngine) continuedFailure() error {
+	if e.firstFailureErr == nil {
+		return nil
+	}
+	if err := e.schemaManager.markDirty(e.firstFailure); err != nil {
+		return fmt.Errorf("%w (and failed to mark the state dirty: %v)", e.firstFailureErr, err)
+	}
+	return e.firstFailureErr
+}
+
+// appliedByPlan returns the migrations of an upgrade plan that are applied, in
+// plan order
+func (e *MigrationEngine) appliedByPlan(plan *ExecutionPlan) ([]*Migration, error) {
+	schema, err := e.schemaManager.getSchemaHead()
+	if err != nil {
+		return nil, err
+	}
+	var applied []*Migration
+	for _, m := range plan.Migrations {
+		if schema.AppliedMigrations[m.ID] {
+			applied = append(applied, m)
+		}
+	}
+	return applied, nil
+}
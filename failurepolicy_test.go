@@ -0,0 +1,155 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestFailurePolicy(t *testing.T) {
+	if _, err := ParseFailurePolicy("retry"); err == nil {
+		t.Error("Expected an unknown policy to be refused")
+	}
+	if policy, err := ParseFailurePolicy(""); err != nil || policy != FailureStop {
+		t.Errorf("Expected stop by default, got %q (%v)", policy, err)
+	}
+
+	run := func(t *testing.T, policy FailurePolicy) (*SchemaVersion, *MigrationEngine, error) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		noop := func(db *pebble.DB) error { return nil }
+		fail := func(db *pebble.DB) error { return errors.New("boom") }
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{ID: "1754917200_first", Up: noop, Down: noop})
+		registry.Register(&Migration{ID: "1754917300_broken", Up: fail, Down: noop})
+		registry.Register(&Migration{ID: "1754917400_independent", Up: noop, Down: noop})
+		registry.Register(&Migration{ID: "1754917500_dependent", Up: noop, Down: noop, Dependencies: []string{"1754917300_broken"}})
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupEnabled(false)
+		engine.SetFailurePolicy(policy)
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		planErr := engine.ExecutePlan(plan, nil)
+		schema, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get schema version: %v", err)
+		}
+		return schema, engine, planErr
+	}
+
+	t.Run("Stop", func(t *testing.T) {
+		schema, _, err := run(t, FailureStop)
+		if err == nil {
+			t.Fatal("Expected the plan to fail")
+		}
+		if schema.Status != StatusDirty || len(schema.AppliedMigrations) != 1 || !schema.AppliedMigrations["1754917200_first"] {
+			t.Errorf("Expected a dirty state after the first migration, got %+v", schema)
+		}
+	})
+
+	t.Run("Continue", func(t *testing.T) {
+		schema, engine, err := run(t, FailureContinue)
+		if err == nil {
+			t.Fatal("Expected the plan to fail")
+		}
+		if schema.Status != StatusDirty || schema.LastFailure == nil || schema.LastFailure.MigrationID != "1754917300_broken" {
+			t.Errorf("Expected a dirty state with the failure, got %+v", schema)
+		}
+		if len(schema.AppliedMigrations) != 2 || !schema.AppliedMigrations["1754917400_independent"] {
+			t.Errorf("Expected the independent migration to be applied, got %v", schema.AppliedMigrations)
+		}
+		skipped := engine.SkippedMigrations()
+		if len(skipped) != 2 || skipped[0].ID != "1754917300_broken" || skipped[1].ID != "1754917500_dependent" {
+			t.Errorf("Expected the failed migration and its dependent to be skipped, got %v", skipped)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		schema, _, err := run(t, FailureRollback)
+		if err == nil {
+			t.Fatal("Expected the plan to fail")
+		}
+		if schema.Status != StatusClean || len(schema.AppliedMigrations) != 0 || schema.CurrentVersion != 0 {
+			t.Errorf("Expected a clean state with the plan rolled back, got %+v", schema)
+		}
+		last := schema.MigrationHistory[len(schema.MigrationHistory)-1]
+		if last.ID != "1754917200_first" || last.Type != RecordRollback {
+			t.Errorf("Expected the first migration to be rolled back last, got %+v", last)
+		}
+		failed := false
+		for _, record := range schema.MigrationHistory {
+			failed = failed || (record.ID == "1754917300_broken" && !record.Success)
+		}
+		if !failed {
+			t.Error("Expected the failure to be recorded in the history")
+		}
+	})
+}
+
+func TestFailurePolicyWave(t *testing.T) {
+	run := func(t *testing.T, policy FailurePolicy) *SchemaVersion {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		noop := func(db *pebble.DB) error { return nil }
+		fail := func(db *pebble.DB) error { return errors.New("boom") }
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{ID: "1754917200_first", Up: noop, Down: noop})
+		registry.Register(&Migration{ID: "1754917300_users", Up: fail, Down: noop, KeyPrefixes: []string{"user/"}})
+		registry.Register(&Migration{ID: "1754917400_orders", Up: fail, Down: noop, KeyPrefixes: []string{"order/"}})
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupEnabled(false)
+		engine.SetParallelism(2)
+		engine.SetFailurePolicy(policy)
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err == nil {
+			t.Fatal("Expected the plan to fail")
+		}
+		schema, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get schema version: %v", err)
+		}
+
+		// Every failure of the wave is recorded
+		for _, id := range []string{"1754917300_users", "1754917400_orders"} {
+			recorded := false
+			for _, record := range schema.MigrationHistory {
+				recorded = recorded || (record.ID == id && !record.Success)
+			}
+			if !recorded {
+				t.Errorf("Expected the failure of %s in the history", id)
+			}
+		}
+		return schema
+	}
+
+	t.Run("Stop", func(t *testing.T) {
+		schema := run(t, FailureStop)
+		if schema.Status != StatusDirty || schema.LastFailure == nil || schema.LastFailure.MigrationID != "1754917300_users" {
+			t.Errorf("Expected a dirty state with the first failure, got %+v", schema)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		schema := run(t, FailureRollback)
+		if schema.Status != StatusClean || len(schema.AppliedMigrations) != 0 {
+			t.Errorf("Expected a clean state with the plan rolled back, got %+v", schema)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FaultPoint identifies a place in the engine where a fault can be injected
+type FaultPoint string
+
+const (
+	// FaultBeforeMigration is reached before each migration function runs
+	FaultBeforeMigration FaultPoint = "before_migration"
+
+	// FaultAfterDataWrite is reached after a migration function succeeded but
+	// before the schema state records it
+	FaultAfterDataWrite FaultPoint = "after_data_write"
+
+	// FaultDuringBackup is reached after the backup data was written but before
+	// its metadata, leaving an incomplete backup behind
+	FaultDuringBackup FaultPoint = "during_backup"
+
+	// FaultDuringRestore is reached after a restored database was swapped in but
+	// before it is verified, making the verification fail
+	FaultDuringRestore FaultPoint = "during_restore"
+)
+
+// FaultInjector is called by the engine at every fault point. Returning an error
+// injects a fault there. Errors wrapping ErrSimulatedCrash make the engine stop
+// immediately without recording the failure, as if the process had died; other
+// errors are handled like a failing migration.
+//
+// Fault injection is meant for tests and development only.
+type FaultInjector func(point FaultPoint, migrationID string) error
+
+// FailAt returns an injector that fails at point once it has been passed n times,
+// e.g. FailAt(FaultBeforeMigration, 2) fails the third migration of a plan
+func FailAt(point FaultPoint, n int) FaultInjector {
+	return countingInjector(point, n, ErrInjectedFault)
+}
+
+// CrashAt returns an injector that simulates a crash at point once it has been
+// passed n times
+func CrashAt(point FaultPoint, n int) FaultInjector {
+	return countingInjector(point, n, ErrSimulatedCrash)
+}
+
+// countingInjector returns err the n+1th time point is reached
+func countingInjector(point FaultPoint, n int, err error) FaultInjector {
+	var mu sync.Mutex
+	seen := 0
+
+	return func(p FaultPoint, migrationID string) error {
+		if p != point {
+			return nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		seen++
+		if seen == n+1 {
+			return fmt.Errorf("%w at %s (migration %s)", err, point, migrationID)
+		}
+		return nil
+	}
+}
+
+// ParseFaultSpec parses a fault specification of the form
+// "[crash:]<point>[:<n>]", for example "after_data_write" or "crash:before_migration:2"
+func ParseFaultSpec(spec string) (FaultInjector, error) {
+	parts := strings.Split(spec, ":")
+	crash := false
+	if parts[0] == "crash" {
+		crash = true
+		parts = parts[1:]
+	}
+	if len(parts) == 0 || len(parts) > 2 {
+		return nil, fmt.Errorf("invalid fault spec %q: expected [crash:]<point>[:<n>]", spec)
+	}
+
+	point := FaultPoint(parts[0])
+	switch point {
+	case FaultBeforeMigration, FaultAfterDataWrite, FaultDuringBackup, FaultDuringRestore:
+	default:
+		return nil, fmt.Errorf("invalid fault spec %q: unknown point %q (valid: %s, %s, %s, %s)",
+			spec, parts[0], FaultBeforeMigration, FaultAfterDataWrite, FaultDuringBackup, FaultDuringRestore)
+	}
+
+	n := 0
+	if len(parts) == 2 {
+		var err error
+		n, err = strconv.Atoi(parts[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid fault spec %q: count must be a non-negative integer", spec)
+		}
+	}
+
+	if crash {
+		return CrashAt(point, n), nil
+	}
+	return FailAt(point, n), nil
+}
@@ -0,0 +1,174 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestFaultInjection(t *testing.T) {
+	setup := func(t *testing.T, registry *MigrationRegistry) (*pebble.DB, string, *SchemaManager, *MigrationEngine) {
+		dir := t.TempDir()
+		dbPath := filepath.Join(dir, "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupEnabled(false)
+		return db, dbPath, schemaManager, engine
+	}
+
+	newRegistry := func(t *testing.T, calls map[string]int, rerunnable bool, ids ...string) *MigrationRegistry {
+		registry := NewMigrationRegistry()
+		for _, id := range ids {
+			id := id
+			err := registry.Register(&Migration{
+				ID: id,
+				Up: func(db *pebble.DB) error {
+					calls[id]++
+					return db.Set([]byte("data:"+id), []byte("x"), pebble.Sync)
+				},
+				Down:       func(db *pebble.DB) error { return nil },
+				Rerunnable: rerunnable,
+			})
+			if err != nil {
+				t.Fatalf("Failed to register %s: %v", id, err)
+			}
+		}
+		return registry
+	}
+
+	t.Run("FailAfterNMigrations", func(t *testing.T) {
+		calls := make(map[string]int)
+		registry := newRegistry(t, calls, false, "1754917200_first", "1754917300_second", "1754917400_third")
+		_, _, schemaManager, engine := setup(t, registry)
+		engine.SetFaultInjector(FailAt(FaultBeforeMigration, 1))
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); !errors.Is(err, ErrInjectedFault) {
+			t.Fatalf("Expected injected fault, got %v", err)
+		}
+
+		schema, _ := schemaManager.GetSchemaVersion()
+		if schema.Status != StatusDirty {
+			t.Errorf("Expected dirty status, got %s", schema.Status)
+		}
+		if !schema.AppliedMigrations["1754917200_first"] || schema.AppliedMigrations["1754917300_second"] {
+			t.Errorf("Expected only the first migration applied, got %v", schema.AppliedMigrations)
+		}
+		if calls["1754917300_second"] != 0 || calls["1754917400_third"] != 0 {
+			t.Errorf("Expected later migrations not to run, got %v", calls)
+		}
+	})
+
+	t.Run("CrashBetweenDataWriteAndSchemaUpdate", func(t *testing.T) {
+		originalRegistry := GlobalRegistry
+		defer func() { GlobalRegistry = originalRegistry }()
+
+		calls := make(map[string]int)
+		GlobalRegistry = newRegistry(t, calls, true, "1754917200_backfill")
+		db, dbPath, schemaManager, engine := setup(t, GlobalRegistry)
+		engine.SetFaultInjector(CrashAt(FaultAfterDataWrite, 0))
+
+		plan, _ := NewMigrationPlanner(GlobalRegistry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); !errors.Is(err, ErrSimulatedCrash) {
+			t.Fatalf("Expected simulated crash, got %v", err)
+		}
+
+		// Data is written but the schema still says migrating, as after a real crash
+		schema, _ := schemaManager.GetSchemaVersion()
+		if schema.Status != StatusMigrating || len(schema.AppliedMigrations) != 0 {
+			t.Fatalf("Expected interrupted migration state, got %s %v", schema.Status, schema.AppliedMigrations)
+		}
+
+		// Startup recovery reruns the rerunnable migration
+		opts := DefaultStartupOptions()
+		opts.RunMigrations = true
+		opts.CheckDiskSpace = false
+		opts.Logger = &NopLogger{}
+		if err := CheckAndRunStartupMigrations(db, dbPath, opts); err != nil {
+			t.Fatalf("Recovery failed: %v", err)
+		}
+
+		schema, _ = schemaManager.GetSchemaVersion()
+		if schema.Status != StatusClean || !schema.AppliedMigrations["1754917200_backfill"] {
+			t.Errorf("Expected recovered clean state, got %s %v", schema.Status, schema.AppliedMigrations)
+		}
+		if calls["1754917200_backfill"] != 2 {
+			t.Errorf("Expected migration to run twice, got %d", calls["1754917200_backfill"])
+		}
+	})
+
+	t.Run("CrashInLaterMigrationLeavesMigrating", func(t *testing.T) {
+		calls := make(map[string]int)
+		registry := newRegistry(t, calls, false, "1754917200_first", "1754917300_second")
+		_, _, schemaManager, engine := setup(t, registry)
+		engine.SetFaultInjector(CrashAt(FaultAfterDataWrite, 1))
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); !errors.Is(err, ErrSimulatedCrash) {
+			t.Fatalf("Expected simulated crash, got %v", err)
+		}
+
+		schema, _ := schemaManager.GetSchemaVersion()
+		if schema.Status != StatusMigrating {
+			t.Errorf("Expected interrupted second migration to leave status migrating, got %s", schema.Status)
+		}
+	})
+
+	t.Run("CrashDuringBackup", func(t *testing.T) {
+		calls := make(map[string]int)
+		registry := newRegistry(t, calls, false, "1754917200_first")
+		_, dbPath, schemaManager, engine := setup(t, registry)
+		engine.SetBackupEnabled(true)
+		engine.SetFaultInjector(CrashAt(FaultDuringBackup, 0))
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); !errors.Is(err, ErrSimulatedCrash) {
+			t.Fatalf("Expected simulated crash, got %v", err)
+		}
+		if calls["1754917200_first"] != 0 {
+			t.Error("Expected migration not to run after backup failure")
+		}
+
+		// The incomplete backup has no metadata and is not listed
+		matches, _ := filepath.Glob(dbPath + ".backup_*")
+		if len(matches) == 0 {
+			t.Error("Expected incomplete backup to be left behind")
+		}
+		backups, _ := NewBackupManager(dbPath).ListBackups()
+		if len(backups) != 0 {
+			t.Errorf("Expected no complete backups, got %d", len(backups))
+		}
+	})
+}
+
+func TestParseFaultSpec(t *testing.T) {
+	for _, spec := range []string{"before_migration", "after_data_write:3", "crash:during_backup", "crash:before_migration:0"} {
+		if _, err := ParseFaultSpec(spec); err != nil {
+			t.Errorf("ParseFaultSpec(%q) failed: %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"", "crash", "explode", "before_migration:-1", "before_migration:x", "before_migration:1:2"} {
+		if _, err := ParseFaultSpec(spec); err == nil {
+			t.Errorf("ParseFaultSpec(%q) should fail", spec)
+		}
+	}
+
+	injector, _ := ParseFaultSpec("crash:after_data_write:1")
+	if err := injector(FaultAfterDataWrite, "a"); err != nil {
+		t.Errorf("Expected first pass to succeed, got %v", err)
+	}
+	if err := injector(FaultBeforeMigration, "b"); err != nil {
+		t.Errorf("Expected other points to be ignored, got %v", err)
+	}
+	if err := injector(FaultAfterDataWrite, "b"); !errors.Is(err, ErrSimulatedCrash) {
+		t.Errorf("Expected simulated crash on second pass, got %v", err)
+	}
+}
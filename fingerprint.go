@@ -0,0 +1,325 @@
+package migrate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// fingerprintsInfix follows the key prefix in the keys stored fingerprints are
+// kept under
+const fingerprintsInfix = "fingerprints/"
+
+// DefaultFingerprintChunkSize is the average number of keys per chunk of a
+// fingerprint
+const DefaultFingerprintChunkSize = 1024
+
+// Fingerprint is a checksum of all keys and values under a prefix. Fingerprints
+// taken at different times, or of a database and a backup, are equal exactly
+// when the prefix holds the same data, so comparing them tells whether anything
+// changed without keeping a copy of the data.
+type Fingerprint struct {
+	Name      string             `json:"name,omitempty"` // Name it is stored under, see SchemaManager.SaveFingerprint
+	Prefix    []byte             `json:"prefix"`
+	Keys      int64              `json:"keys"`
+	Bytes     int64              `json:"bytes"`                // Size of the keys and values
+	Sum       string             `json:"sum"`                  // Hex SHA-256 of the keys and values in key order
+	ChunkSize int                `json:"chunk_size,omitempty"` // Average keys per chunk; 0 without chunks
+	Chunks    []FingerprintChunk `json:"chunks,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// FingerprintChunk is the checksum of a range of keys of a fingerprint. Chunks
+// end at keys whose hash is a multiple of the chunk size, so a changed key only
+// changes the checksum of its own chunk, even if keys were added or removed
+// before it.
+type FingerprintChunk struct {
+	First []byte `json:"first"`
+	Last  []byte `json:"last"`
+	Keys  int64  `json:"keys"`
+	Sum   string `json:"sum"`
+}
+
+// KeyRange is a range of keys, from First to Last inclusive
+type KeyRange struct {
+	First []byte
+	Last  []byte
+}
+
+// String returns a human-readable description of the range
+func (r KeyRange) String() string {
+	if bytes.Equal(r.First, r.Last) {
+		return fmt.Sprintf("%q", r.First)
+	}
+	return fmt.Sprintf("%q..%q", r.First, r.Last)
+}
+
+// FingerprintDiff is the result of comparing two fingerprints of a prefix
+type FingerprintDiff struct {
+	Equal      bool
+	KeysBefore int64
+	KeysAfter  int64
+
+	// Ranges are the key ranges whose chunks differ, in key order. They are only
+	// known for chunked fingerprints.
+	Ranges []KeyRange
+}
+
+// String returns a human-readable summary of the differences
+func (d *FingerprintDiff) String() string {
+	if d.Equal {
+		return "no changes"
+	}
+	summary := fmt.Sprintf("%d keys before, %d after", d.KeysBefore, d.KeysAfter)
+	if len(d.Ranges) == 0 {
+		return summary
+	}
+	var ranges []string
+	for _, r := range d.Ranges {
+		ranges = append(ranges, r.String())
+	}
+	return fmt.Sprintf("%s; changed: %s", summary, strings.Join(ranges, ", "))
+}
+
+// FingerprintPrefix computes the fingerprint of the keys under prefix in r, a
+// database, batch or snapshot. With chunkSize > 0 it also computes the checksums
+// of chunks of about chunkSize keys, which locate the changes when comparing.
+func FingerprintPrefix(r pebble.Reader, prefix []byte, chunkSize int) (*Fingerprint, error) {
+	iter, err := r.NewIter(&pebble.IterOptions{LowerBound: prefix, UpperBound: prefixUpperBound(prefix)})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	fp := &Fingerprint{Prefix: append([]byte(nil), prefix...), CreatedAt: time.Now()}
+	if chunkSize > 0 {
+		fp.ChunkSize = chunkSize
+	}
+	sum := sha256.New()
+	var chunk *FingerprintChunk
+	var chunkSum hash.Hash
+	var last []byte
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		writeFingerprintRecord(sum, key, value)
+		fp.Keys++
+		fp.Bytes += int64(len(key) + len(value))
+
+		if fp.ChunkSize == 0 {
+			continue
+		}
+		if chunk == nil {
+			chunk = &FingerprintChunk{First: append([]byte(nil), key...)}
+			chunkSum = sha256.New()
+		}
+		writeFingerprintRecord(chunkSum, key, value)
+		chunk.Keys++
+		last = append(last[:0], key...)
+		if chunkBoundary(key, fp.ChunkSize) {
+			chunk.Last = append([]byte(nil), key...)
+			chunk.Sum = hex.EncodeToString(chunkSum.Sum(nil))
+			fp.Chunks = append(fp.Chunks, *chunk)
+			chunk = nil
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	if chunk != nil {
+		chunk.Last = last
+		chunk.Sum = hex.EncodeToString(chunkSum.Sum(nil))
+		fp.Chunks = append(fp.Chunks, *chunk)
+	}
+
+	fp.Sum = hex.EncodeToString(sum.Sum(nil))
+	return fp, nil
+}
+
+// writeFingerprintRecord hashes a key and its value, length-prefixed so that
+// different splits of the same bytes hash differently
+func writeFingerprintRecord(h hash.Hash, key, value []byte) {
+	var length [binary.MaxVarintLen64]byte
+	h.Write(length[:binary.PutUvarint(length[:], uint64(len(key)))])
+	h.Write(key)
+	h.Write(length[:binary.PutUvarint(length[:], uint64(len(value)))])
+	h.Write(value)
+}
+
+// chunkBoundary reports whether a chunk ends at key. It only depends on the key,
+// so both fingerprints of a comparison have the same boundaries.
+func chunkBoundary(key []byte, chunkSize int) bool {
+	h := fnv.New32a()
+	h.Write(key)
+	return h.Sum32()%uint32(chunkSize) == 0
+}
+
+// CompareFingerprints compares two fingerprints of the same prefix, e.g. one
+// stored before a migration and one taken after it. Both must have the same
+// chunk size for the changed ranges to be located.
+func CompareFingerprints(before, after *Fingerprint) (*FingerprintDiff, error) {
+	if !bytes.Equal(before.Prefix, after.Prefix) {
+		return nil, fmt.Errorf("fingerprints are of different prefixes %q and %q", before.Prefix, after.Prefix)
+	}
+	diff := &FingerprintDiff{
+		Equal:      before.Sum == after.Sum,
+		KeysBefore: before.Keys,
+		KeysAfter:  after.Keys,
+	}
+	if diff.Equal || before.ChunkSize == 0 || before.ChunkSize != after.ChunkSize {
+		return diff, nil
+	}
+
+	chunkID := func(c FingerprintChunk) string {
+		return string(c.First) + "\x00" + string(c.Last) + "\x00" + c.Sum
+	}
+	inBefore := make(map[string]bool, len(before.Chunks))
+	for _, c := range before.Chunks {
+		inBefore[chunkID(c)] = true
+	}
+	inAfter := make(map[string]bool, len(after.Chunks))
+	for _, c := range after.Chunks {
+		inAfter[chunkID(c)] = true
+	}
+
+	var ranges []KeyRange
+	for _, c := range before.Chunks {
+		if !inAfter[chunkID(c)] {
+			ranges = append(ranges, KeyRange{First: c.First, Last: c.Last})
+		}
+	}
+	for _, c := range after.Chunks {
+		if !inBefore[chunkID(c)] {
+			ranges = append(ranges, KeyRange{First: c.First, Last: c.Last})
+		}
+	}
+	diff.Ranges = mergeKeyRanges(ranges)
+	return diff, nil
+}
+
+// mergeKeyRanges sorts ranges and merges the overlapping ones
+func mergeKeyRanges(ranges []KeyRange) []KeyRange {
+	sort.Slice(ranges, func(i, j int) bool { return bytes.Compare(ranges[i].First, ranges[j].First) < 0 })
+	var merged []KeyRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && bytes.Compare(r.First, merged[n-1].Last) <= 0 {
+			if bytes.Compare(r.Last, merged[n-1].Last) > 0 {
+				merged[n-1].Last = r.Last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// fingerprintKey returns the internal key a fingerprint is stored under
+func (s *SchemaManager) fingerprintKey(name string) []byte {
+	return []byte(s.keyPrefix + fingerprintsInfix + name)
+}
+
+// SaveFingerprint stores a fingerprint under name, replacing the one stored
+// under that name before
+func (s *SchemaManager) SaveFingerprint(name string, fp *Fingerprint) error {
+	fp.Name = name
+	data, err := json.Marshal(fp)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Set(s.fingerprintKey(name), data, pebble.Sync); err != nil {
+		return fmt.Errorf("failed to save fingerprint %s: %w", name, err)
+	}
+	return nil
+}
+
+// GetFingerprint returns the fingerprint stored under name, or nil if none is
+func (s *SchemaManager) GetFingerprint(name string) (*Fingerprint, error) {
+	data, err := getCopy(s.db, s.fingerprintKey(name))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fingerprint %s: %w", name, err)
+	}
+
+	var fp Fingerprint
+	if err := json.Unmarshal(data, &fp); err != nil {
+		return nil, fmt.Errorf("%w: fingerprint %s: %v", ErrCorruptSchemaState, name, err)
+	}
+	return &fp, nil
+}
+
+// ListFingerprints returns the stored fingerprints, ordered by name
+func (s *SchemaManager) ListFingerprints() ([]*Fingerprint, error) {
+	prefix := []byte(s.keyPrefix + fingerprintsInfix)
+	iter, err := s.db.NewIter(&pebble.IterOptions{LowerBound: prefix, UpperBound: prefixUpperBound(prefix)})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var list []*Fingerprint
+	for iter.First(); iter.Valid(); iter.Next() {
+		var fp Fingerprint
+		if err := json.Unmarshal(iter.Value(), &fp); err != nil {
+			return nil, fmt.Errorf("%w: fingerprint key %s: %v", ErrCorruptSchemaState, iter.Key(), err)
+		}
+		list = append(list, &fp)
+	}
+	return list, iter.Error()
+}
+
+// DeleteFingerprint removes the fingerprint stored under name
+func (s *SchemaManager) DeleteFingerprint(name string) error {
+	if err := s.db.Delete(s.fingerprintKey(name), pebble.Sync); err != nil {
+		return fmt.Errorf("failed to delete fingerprint %s: %w", name, err)
+	}
+	return nil
+}
+
+// VerifyFingerprint fingerprints the prefix of the fingerprint stored under name
+// again, with its chunk size, and compares. It returns the differences, and
+// ErrFingerprintMismatch if there are any.
+func (s *SchemaManager) VerifyFingerprint(name string) (*FingerprintDiff, error) {
+	stored, err := s.GetFingerprint(name)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("no fingerprint stored as %s", name)
+	}
+	current, err := FingerprintPrefix(s.db, stored.Prefix, stored.ChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := CompareFingerprints(stored, current)
+	if err != nil {
+		return nil, err
+	}
+	if !diff.Equal {
+		return diff, fmt.Errorf("%w: %s (prefix %q): %s", ErrFingerprintMismatch, name, stored.Prefix, diff)
+	}
+	return diff, nil
+}
+
+// FingerprintBackup computes the fingerprint of prefix in a backup, to compare
+// it with the live database. The backup is opened with OpenBackup, leaving it
+// untouched.
+func (b *BackupManager) FingerprintBackup(backupPath string, prefix []byte, chunkSize int) (*Fingerprint, error) {
+	db, closeBackup, err := b.OpenBackup(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBackup()
+	return FingerprintPrefix(db, prefix, chunkSize)
+}
@@ -0,0 +1,204 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestFingerprintPrefix(t *testing.T) {
+	db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 5000; i++ {
+		if err := db.Set([]byte(fmt.Sprintf("user/%05d", i)), []byte("v1"), pebble.NoSync); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+	if err := db.Set([]byte("order/1"), []byte("v1"), pebble.NoSync); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	before, err := FingerprintPrefix(db, []byte("user/"), 64)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+	if before.Keys != 5000 || before.Bytes != 5000*12 || len(before.Chunks) < 40 || len(before.Chunks) > 160 {
+		t.Fatalf("Unexpected fingerprint: %d keys, %d bytes, %d chunks", before.Keys, before.Bytes, len(before.Chunks))
+	}
+
+	// Changes outside the prefix do not count
+	if err := db.Set([]byte("order/1"), []byte("v2"), pebble.NoSync); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	same, err := FingerprintPrefix(db, []byte("user/"), 64)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+	if diff, err := CompareFingerprints(before, same); err != nil || !diff.Equal || len(diff.Ranges) != 0 {
+		t.Fatalf("Expected equal fingerprints, got %+v, %v", diff, err)
+	}
+
+	// A changed value and an inserted key are located in their chunks
+	if err := db.Set([]byte("user/01234"), []byte("v2"), pebble.NoSync); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Set([]byte("user/03000a"), []byte("v1"), pebble.NoSync); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	after, err := FingerprintPrefix(db, []byte("user/"), 64)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+	diff, err := CompareFingerprints(before, after)
+	if err != nil {
+		t.Fatalf("Failed to compare: %v", err)
+	}
+	if diff.Equal || diff.KeysBefore != 5000 || diff.KeysAfter != 5001 || len(diff.Ranges) != 2 {
+		t.Fatalf("Expected two changed ranges, got %s", diff)
+	}
+	for i, key := range []string{"user/01234", "user/03000a"} {
+		r := diff.Ranges[i]
+		if string(r.First) > key || string(r.Last) < key {
+			t.Errorf("Expected range %s to contain %s", r, key)
+		}
+	}
+
+	if _, err := CompareFingerprints(before, &Fingerprint{Prefix: []byte("order/")}); err == nil {
+		t.Errorf("Expected comparing different prefixes to fail")
+	}
+}
+
+func TestStoredFingerprints(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	for i := 0; i < 100; i++ {
+		if err := db.Set([]byte(fmt.Sprintf("order/%03d", i)), []byte("v1"), pebble.NoSync); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	// The migration must leave orders alone: it fingerprints them before its
+	// changes and verifies them afterwards
+	touchOrders := false
+	registry.Register(&Migration{
+		ID: "1754917200_users",
+		Up: func(db *pebble.DB) error {
+			fp, err := FingerprintPrefix(db, []byte("order/"), 16)
+			if err != nil {
+				return err
+			}
+			if err := NewSchemaManager(db).SaveFingerprint("orders", fp); err != nil {
+				return err
+			}
+			if touchOrders {
+				db.Set([]byte("order/050"), []byte("v2"), pebble.Sync)
+			}
+			return db.Set([]byte("user/1"), []byte("v1"), pebble.Sync)
+		},
+		Validate: func(db *pebble.DB) error {
+			_, err := NewSchemaManager(db).VerifyFingerprint("orders")
+			return err
+		},
+		Down: func(db *pebble.DB) error { return db.Delete([]byte("user/1"), pebble.Sync) },
+	})
+
+	touchOrders = true
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	err = engine.ExecutePlan(plan, nil)
+	if !errors.Is(err, ErrFingerprintMismatch) {
+		t.Fatalf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+
+	touchOrders = false
+	if err := db.Set([]byte("order/050"), []byte("v1"), pebble.Sync); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := schemaManager.ForceCleanState(); err != nil {
+		t.Fatalf("Failed to clean state: %v", err)
+	}
+	plan, err = NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Expected the migration to pass, got %v", err)
+	}
+
+	list, err := schemaManager.ListFingerprints()
+	if err != nil || len(list) != 1 || list[0].Name != "orders" || list[0].Keys != 100 {
+		t.Fatalf("Expected the stored fingerprint, got %+v, %v", list, err)
+	}
+	if err := schemaManager.DeleteFingerprint("orders"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if fp, err := schemaManager.GetFingerprint("orders"); err != nil || fp != nil {
+		t.Errorf("Expected no fingerprint after delete, got %+v, %v", fp, err)
+	}
+}
+
+func TestFingerprintBackup(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "test.db")
+			db, err := pebble.Open(dbPath, &pebble.Options{})
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+
+			for i := 0; i < 100; i++ {
+				if err := db.Set([]byte(fmt.Sprintf("user/%03d", i)), []byte("v1"), pebble.Sync); err != nil {
+					t.Fatalf("Failed to seed: %v", err)
+				}
+			}
+			backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{Compress: compress})
+			backup, err := backupManager.CreateBackup(db, "Before")
+			if err != nil {
+				t.Fatalf("Failed to back up: %v", err)
+			}
+			if err := db.Set([]byte("user/042"), []byte("v2"), pebble.Sync); err != nil {
+				t.Fatalf("Failed to write: %v", err)
+			}
+
+			inBackup, err := backupManager.FingerprintBackup(backup.Path, []byte("user/"), 8)
+			if err != nil {
+				t.Fatalf("Failed to fingerprint backup: %v", err)
+			}
+			live, err := FingerprintPrefix(db, []byte("user/"), 8)
+			if err != nil {
+				t.Fatalf("Failed to fingerprint: %v", err)
+			}
+			diff, err := CompareFingerprints(inBackup, live)
+			if err != nil || diff.Equal || len(diff.Ranges) != 1 {
+				t.Fatalf("Expected one changed range, got %s, %v", diff, err)
+			}
+			if r := diff.Ranges[0]; string(r.First) > "user/042" || string(r.Last) < "user/042" {
+				t.Errorf("Expected range %s to contain user/042", r)
+			}
+
+			if temps, _ := filepath.Glob(dbPath + ".backup_view_*"); len(temps) != 0 {
+				t.Errorf("Expected the copy of the backup to be removed, got %v", temps)
+			}
+		})
+	}
+}
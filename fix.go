@@ -0,0 +1,292 @@
+package migrate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+	"gopkg.in/yaml.v3"
+)
+
+// FixScript is a reviewed set of key mutations applied atomically with ApplyFix,
+// a safer alternative to fixing data with a one-off program. Its operations are
+// limited to set, delete and rename and run in order.
+type FixScript struct {
+	Description string     `json:"description" yaml:"description"`
+	Owner       string     `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Ops         []ScriptOp `json:"ops" yaml:"ops"`
+
+	// Path and Checksum identify the file the script was loaded from in the
+	// audit history; they are set by LoadFixScript
+	Path     string `json:"-" yaml:"-"`
+	Checksum string `json:"-" yaml:"-"`
+}
+
+// FixResult is what a fix script changes
+type FixResult struct {
+	Changes []KeyChange // Changed keys in key order
+	Inverse *FixScript  // Script restoring the values the fix replaces
+}
+
+// LoadFixScript reads a fix script from a .json, .yaml or .yml file
+func LoadFixScript(path string) (*FixScript, error) {
+	var fix FixScript
+	data, err := readScriptFile(path, &fix)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	fix.Path = path
+	fix.Checksum = fmt.Sprintf("sha256:%x", sum)
+	return &fix, nil
+}
+
+// WriteFile writes the script to a .json, .yaml or .yml file
+func (f *FixScript) WriteFile(path string) error {
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		data, err = json.MarshalIndent(f, "", "  ")
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(f)
+	default:
+		return fmt.Errorf("unsupported script extension: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal fix script: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write fix script: %w", err)
+	}
+	return nil
+}
+
+// validate checks the operations of a fix script against the keys of s
+func (f *FixScript) validate(s *SchemaManager) error {
+	if strings.TrimSpace(f.Description) == "" {
+		return fmt.Errorf("fix script requires a description")
+	}
+	if len(f.Ops) == 0 {
+		return fmt.Errorf("fix script has no ops")
+	}
+	for i, op := range f.Ops {
+		var keys []string
+		switch op.Op {
+		case ScriptOpSet:
+			for key := range op.Values {
+				keys = append(keys, key)
+			}
+		case ScriptOpDelete:
+			keys = op.Keys
+		case ScriptOpRename:
+			keys = []string{op.From, op.To}
+		default:
+			return fmt.Errorf("fix step %d: op %q is not allowed in a fix, use set, delete or rename", i+1, op.Op)
+		}
+		if err := op.validate(); err != nil {
+			return fmt.Errorf("fix step %d: %w", i+1, err)
+		}
+		for _, key := range keys {
+			if s.IsReservedKey([]byte(key)) {
+				return fmt.Errorf("fix step %d: key %q is an internal migration key", i+1, key)
+			}
+		}
+	}
+	return nil
+}
+
+// PlanFix returns what a fix script would change without writing anything
+func (s *SchemaManager) PlanFix(fix *FixScript) (*FixResult, error) {
+	batch, result, err := s.fixBatch(fix)
+	if err != nil {
+		return nil, err
+	}
+	batch.Close()
+	return result, nil
+}
+
+// ApplyFix applies a fix script in a single atomic batch together with an
+// AuditFix record holding its inverse, and returns what it changed. If any step
+// fails, e.g. a rename of a missing key, nothing is written. A fix that changes
+// nothing is not recorded. While a plan is executing on the database, ApplyFix
+// fails with ErrConcurrentExecution.
+func (s *SchemaManager) ApplyFix(fix *FixScript) (*FixResult, error) {
+	end, err := beginExecution(s.db, "fix script")
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
+	batch, result, err := s.fixBatch(fix)
+	if err != nil {
+		return nil, err
+	}
+	defer batch.Close()
+	if len(result.Changes) == 0 {
+		return result, nil
+	}
+
+	head, err := s.getSchemaHead()
+	if err != nil {
+		return nil, err
+	}
+	key, data, err := s.auditEntry(AuditRecord{
+		Type:        AuditFix,
+		Path:        fix.Path,
+		Checksum:    fix.Checksum,
+		Version:     head.CurrentVersion,
+		Description: fix.Description,
+		Keys:        len(result.Changes),
+		Inverse:     result.Inverse,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := batch.Set(key, data, nil); err != nil {
+		return nil, err
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return nil, fmt.Errorf("failed to apply fix: %w", err)
+	}
+	return result, nil
+}
+
+// fixBatch runs a fix script against an uncommitted batch and returns the batch
+// with the changes and inverse of the fix
+func (s *SchemaManager) fixBatch(fix *FixScript) (*pebble.Batch, *FixResult, error) {
+	if err := fix.validate(s); err != nil {
+		return nil, nil, err
+	}
+
+	batch := s.db.NewIndexedBatch()
+	before := make(map[string][]byte) // nil if the key did not exist
+	touch := func(key string) error {
+		if _, seen := before[key]; seen {
+			return nil
+		}
+		value, err := fixValue(s.db, key)
+		if err != nil {
+			return err
+		}
+		before[key] = value
+		return nil
+	}
+
+	for i, op := range fix.Ops {
+		if err := s.runFixOp(batch, op, touch); err != nil {
+			batch.Close()
+			return nil, nil, fmt.Errorf("fix step %d (%s): %w", i+1, op.Op, err)
+		}
+	}
+
+	keys := make([]string, 0, len(before))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := &FixResult{Inverse: &FixScript{Description: "Undo fix: " + fix.Description, Owner: fix.Owner}}
+	restore := ScriptOp{Op: ScriptOpSet, Encoding: "base64", Values: make(map[string]string)}
+	remove := ScriptOp{Op: ScriptOpDelete}
+	for _, key := range keys {
+		after, err := fixValue(batch, key)
+		if err != nil {
+			batch.Close()
+			return nil, nil, err
+		}
+		change := KeyChange{Key: []byte(key), Before: before[key], After: after}
+		switch {
+		case change.Before == nil && change.After == nil:
+			continue
+		case change.Before == nil:
+			change.Kind = ChangeAdded
+			remove.Keys = append(remove.Keys, key)
+		case change.After == nil:
+			change.Kind = ChangeDeleted
+			restore.Values[key] = base64.StdEncoding.EncodeToString(change.Before)
+		case bytes.Equal(change.Before, change.After):
+			continue
+		default:
+			change.Kind = ChangeModified
+			restore.Values[key] = base64.StdEncoding.EncodeToString(change.Before)
+		}
+		result.Changes = append(result.Changes, change)
+	}
+	if len(restore.Values) > 0 {
+		result.Inverse.Ops = append(result.Inverse.Ops, restore)
+	}
+	if len(remove.Keys) > 0 {
+		result.Inverse.Ops = append(result.Inverse.Ops, remove)
+	}
+	return batch, result, nil
+}
+
+// runFixOp adds an operation of a fix script to batch, calling touch with every
+// key it writes first
+func (s *SchemaManager) runFixOp(batch *pebble.Batch, op ScriptOp, touch func(key string) error) error {
+	switch op.Op {
+	case ScriptOpSet:
+		for key, encoded := range op.Values {
+			value, err := decodeScriptValue(encoded, op.Encoding)
+			if err != nil {
+				return err
+			}
+			if err := touch(key); err != nil {
+				return err
+			}
+			if err := batch.Set([]byte(key), value, nil); err != nil {
+				return err
+			}
+		}
+	case ScriptOpDelete:
+		for _, key := range op.Keys {
+			if err := touch(key); err != nil {
+				return err
+			}
+			if err := batch.Delete([]byte(key), nil); err != nil {
+				return err
+			}
+		}
+	case ScriptOpRename:
+		value, err := getCopy(batch, []byte(op.From))
+		if err == pebble.ErrNotFound {
+			return fmt.Errorf("key %q does not exist", op.From)
+		}
+		if err != nil {
+			return err
+		}
+		for _, key := range []string{op.From, op.To} {
+			if err := touch(key); err != nil {
+				return err
+			}
+		}
+		if err := batch.Set([]byte(op.To), value, nil); err != nil {
+			return err
+		}
+		if err := batch.Delete([]byte(op.From), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixValue returns the value of key in r, nil if it does not exist and non-nil
+// if it is empty
+func fixValue(r pebble.Reader, key string) ([]byte, error) {
+	value, err := getCopy(r, []byte(key))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err == nil && value == nil {
+		value = []byte{}
+	}
+	return value, err
+}
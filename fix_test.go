@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestApplyFix(t *testing.T) {
+	dir := t.TempDir()
+	db, err := pebble.Open(filepath.Join(dir, "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	schemaManager := NewSchemaManager(db)
+	if err := schemaManager.InitializeFreshDatabase(NewMigrationRegistry()); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	for key, value := range map[string]string{"user/1": "alice", "user/2": "bob", "user/3": ""} {
+		db.Set([]byte(key), []byte(value), pebble.Sync)
+	}
+
+	// state returns the user keys as key=value pairs
+	state := func() string {
+		t.Helper()
+		keys, _, err := schemaManager.ListKeys([]byte("user/"), 0)
+		if err != nil {
+			t.Fatalf("Failed to list keys: %v", err)
+		}
+		var pairs []string
+		for _, kv := range keys {
+			pairs = append(pairs, string(kv.Key)+"="+string(kv.Value))
+		}
+		return strings.Join(pairs, ",")
+	}
+	original := state()
+
+	scriptPath := filepath.Join(dir, "fix.yaml")
+	script := `description: Repair users
+ops:
+  - op: set
+    values:
+      user/1: alice2
+      user/4: dave
+  - op: rename
+    from: user/2
+    to: user/5
+  - op: delete
+    keys: [user/3, user/missing]
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	fix, err := LoadFixScript(scriptPath)
+	if err != nil {
+		t.Fatalf("Failed to load fix: %v", err)
+	}
+
+	plan, err := schemaManager.PlanFix(fix)
+	if err != nil {
+		t.Fatalf("Failed to plan fix: %v", err)
+	}
+	if len(plan.Changes) != 5 || state() != original {
+		t.Errorf("Expected 5 planned changes and nothing written, got %d, %s", len(plan.Changes), state())
+	}
+
+	result, err := schemaManager.ApplyFix(fix)
+	if err != nil {
+		t.Fatalf("Failed to apply fix: %v", err)
+	}
+	if got := state(); got != "user/1=alice2,user/4=dave,user/5=bob" {
+		t.Errorf("Unexpected state after the fix: %s", got)
+	}
+
+	records, err := schemaManager.AuditHistory()
+	if err != nil {
+		t.Fatalf("Failed to read audit history: %v", err)
+	}
+	if len(records) != 1 || records[0].Type != AuditFix || records[0].Keys != 5 ||
+		records[0].Inverse == nil || !strings.HasPrefix(records[0].Checksum, "sha256:") {
+		t.Fatalf("Expected the fix with its inverse in the audit history, got %+v", records)
+	}
+
+	// The inverse, written and loaded again, restores the original values
+	inversePath := filepath.Join(dir, "fix.inverse.yaml")
+	if err := result.Inverse.WriteFile(inversePath); err != nil {
+		t.Fatalf("Failed to write inverse: %v", err)
+	}
+	inverse, err := LoadFixScript(inversePath)
+	if err != nil {
+		t.Fatalf("Failed to load inverse: %v", err)
+	}
+	if _, err := schemaManager.ApplyFix(inverse); err != nil {
+		t.Fatalf("Failed to apply inverse: %v", err)
+	}
+	if got := state(); got != original {
+		t.Errorf("Expected the inverse to restore %s, got %s", original, got)
+	}
+
+	// A failing step writes nothing
+	failing := &FixScript{Description: "Fails", Ops: []ScriptOp{
+		{Op: ScriptOpSet, Values: map[string]string{"user/1": "x"}},
+		{Op: ScriptOpRename, From: "user/missing", To: "user/6"},
+	}}
+	if _, err := schemaManager.ApplyFix(failing); err == nil {
+		t.Errorf("Expected renaming a missing key to fail")
+	}
+	if got := state(); got != original {
+		t.Errorf("Expected a failed fix to write nothing, got %s", got)
+	}
+
+	for name, fix := range map[string]*FixScript{
+		"no description": {Ops: []ScriptOp{{Op: ScriptOpDelete, Keys: []string{"user/1"}}}},
+		"prefix op":      {Description: "x", Ops: []ScriptOp{{Op: ScriptOpDeletePrefix, Prefix: "user/"}}},
+		"internal key":   {Description: "x", Ops: []ScriptOp{{Op: ScriptOpDelete, Keys: []string{SchemaVersionKey}}}},
+	} {
+		if _, err := schemaManager.ApplyFix(fix); err == nil {
+			t.Errorf("%s: expected the fix to be refused", name)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package migrate
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultFutureTolerance is how far after the current time a migration may be
+// dated before it is reported as future-dated, covering ordinary clock drift
+const DefaultFutureTolerance = time.Hour
+
+// FutureMigration is a migration dated after the current time, usually because it
+// was created on a machine with a skewed clock. Once applied, it raises the schema
+// version above the migrations created by others until that time, which then
+// apply out of version order and are skipped by 'up --to'.
+type FutureMigration struct {
+	ID      string        `json:"id"`
+	Version int64         `json:"version"`
+	Ahead   time.Duration `json:"ahead"` // How far the migration is dated after the current time
+}
+
+// String returns a human-readable description of the future-dated migration
+func (f FutureMigration) String() string {
+	return fmt.Sprintf("%s is dated %s, %s in the future; check the clock of the machine that created it",
+		f.ID, FormatVersionAsTime(f.Version), f.Ahead.Round(time.Minute))
+}
+
+// IsFutureVersion returns how far version is dated after now, and whether that
+// is more than tolerance
+func IsFutureVersion(version int64, now time.Time, tolerance time.Duration) (time.Duration, bool) {
+	ahead := time.Unix(version, 0).Sub(now)
+	return ahead, ahead > tolerance
+}
+
+// FindFutureMigrations returns the migrations dated more than tolerance after now
+func FindFutureMigrations(migrations []*Migration, now time.Time, tolerance time.Duration) []FutureMigration {
+	var future []FutureMigration
+	for _, m := range migrations {
+		if ahead, ok := IsFutureVersion(m.Version, now, tolerance); ok {
+			future = append(future, FutureMigration{ID: m.ID, Version: m.Version, Ahead: ahead})
+		}
+	}
+	return future
+}
+
+// FindFutureFiles returns the migration files dated more than tolerance after now,
+// see ScanMigrationFiles
+func FindFutureFiles(files []MigrationFile, now time.Time, tolerance time.Duration) []FutureMigration {
+	var future []FutureMigration
+	for _, file := range files {
+		if ahead, ok := IsFutureVersion(file.Version, now, tolerance); ok {
+			future = append(future, FutureMigration{ID: file.ID, Version: file.Version, Ahead: ahead})
+		}
+	}
+	return future
+}
+
+// FutureMigrationsPolicy refuses upgrade plans applying migrations dated more than
+// tolerance after the current time, so that a skewed clock cannot raise the
+// schema version past the migrations others create meanwhile. Rename such a
+// migration to the current time before it is applied anywhere. Dry runs are
+// allowed.
+func FutureMigrationsPolicy(tolerance time.Duration) PolicyFunc {
+	return func(ctx PolicyContext) []PolicyViolation {
+		if ctx.Plan.Type != ExecutionTypeUpgrade || ctx.DryRun {
+			return nil
+		}
+		var violations []PolicyViolation
+		for _, future := range FindFutureMigrations(ctx.Plan.Migrations, time.Now(), tolerance) {
+			violations = append(violations, PolicyViolation{
+				Policy:      "future-migrations",
+				MigrationID: future.ID,
+				Message: fmt.Sprintf("dated %s, %s in the future",
+					FormatVersionAsTime(future.Version), future.Ahead.Round(time.Minute)),
+			})
+		}
+		return violations
+	}
+}
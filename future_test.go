@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestFutureMigrations(t *testing.T) {
+	now := time.Now()
+	futureID := fmt.Sprintf("%d_from_skewed_clock", now.Add(48*time.Hour).Unix())
+	driftID := fmt.Sprintf("%d_small_drift", now.Add(10*time.Minute).Unix())
+
+	if _, ok := IsFutureVersion(now.Add(-time.Hour).Unix(), now, 0); ok {
+		t.Errorf("Expected a past version not to be in the future")
+	}
+	if ahead, ok := IsFutureVersion(now.Add(2*time.Hour).Unix(), now, DefaultFutureTolerance); !ok || ahead < time.Hour {
+		t.Errorf("Expected a version 2h ahead to be in the future, got %v %v", ahead, ok)
+	}
+
+	noop := func(db *pebble.DB) error { return nil }
+	registry := NewMigrationRegistry()
+	for _, id := range []string{"1754917200_first", driftID, futureID} {
+		if err := registry.Register(&Migration{ID: id, Up: noop, Down: noop}); err != nil {
+			t.Fatalf("Failed to register %s: %v", id, err)
+		}
+	}
+
+	// Only migrations beyond the tolerance are reported
+	future := FindFutureMigrations(registry.GetMigrations(), now, DefaultFutureTolerance)
+	if len(future) != 1 || future[0].ID != futureID || future[0].Ahead < 47*time.Hour {
+		t.Fatalf("Expected only %s in the future, got %v", futureID, future)
+	}
+	if !strings.Contains(future[0].String(), "48h0m0s in the future") {
+		t.Errorf("Unexpected description: %s", future[0])
+	}
+
+	dir := t.TempDir()
+	for _, id := range []string{"1754917200_first", futureID} {
+		if err := os.WriteFile(filepath.Join(dir, id+".go"), []byte("package migrations\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	files, err := ScanMigrationFiles(dir)
+	if err != nil {
+		t.Fatalf("Failed to scan files: %v", err)
+	}
+	if future := FindFutureFiles(files, now, DefaultFutureTolerance); len(future) != 1 || future[0].ID != futureID {
+		t.Errorf("Expected the future file to be reported, got %v", future)
+	}
+
+	// The policy refuses applying the future migration, but allows dry runs
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+	engine.AddPolicy(FutureMigrationsPolicy(DefaultFutureTolerance))
+
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	err = engine.ExecutePlan(plan, nil)
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || len(policyErr.Violations) != 1 || policyErr.Violations[0].MigrationID != futureID {
+		t.Fatalf("Expected the future migration to be refused, got %v", err)
+	}
+
+	engine.SetDryRun(true)
+	if err := engine.CheckPolicies(plan); err != nil {
+		t.Errorf("Expected dry runs to be allowed, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func FuzzParseMigrationVersion(f *testing.F) {
+	for _, seed := range []string{
+		"1754917200_test",
+		"1754917200_",
+		"1754917200",
+		"_test",
+		"+1754917200_test",
+		"-1754917200_test",
+		"99999999999999999999_test",
+		"1754917200_test_rollback",
+		"1754917200.2_test",
+		"1754917200._test",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, id string) {
+		version, err := ParseMigrationVersion(id)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidMigrationID) {
+				t.Fatalf("ParseMigrationVersion(%q) returned untyped error: %v", id, err)
+			}
+			return
+		}
+
+		if version < 946684800 || version > 4102444800 {
+			t.Fatalf("ParseMigrationVersion(%q) accepted out of range version %d", id, version)
+		}
+		prefix := strings.SplitN(id, "_", 2)[0]
+		timestamp, sequence, _ := strings.Cut(prefix, ".")
+		if strings.TrimLeft(timestamp+sequence, "0123456789") != "" {
+			t.Fatalf("ParseMigrationVersion(%q) accepted non-digit timestamp %q", id, prefix)
+		}
+	})
+}
+
+func FuzzDecodeSchemaVersion(f *testing.F) {
+	for _, seed := range []string{
+		`{"current_version":1754917200,"applied_migrations":{"1754917200_test":true},"migration_history":[{"id":"1754917200_test","description":"Test","applied_at":"2025-01-01T00:00:00Z","duration":"1s","success":true}],"last_migration_at":"2025-01-01T00:00:00Z","status":"clean"}`,
+		`{"current_version":1754917200,"applied":["1754917200_test"],"last_history_key":1735689600000000000,"status":"clean"}`,
+		"\x00pb\x01\x08\xd0\xe3\xe8\xc4\x06\x12\x0f1754917200_test\x2a\x05clean",
+		`{"status":"dirty"}`,
+		`{"status":"exploded"}`,
+		`{"current_version":-1,"status":"clean"}`,
+		`{"applied_migrations":null,"status":"clean"}`,
+		`null`,
+		`[]`,
+		`{`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		version, err := decodeSchemaVersion(data)
+		if err != nil {
+			if !errors.Is(err, ErrCorruptSchemaState) {
+				t.Fatalf("decodeSchemaVersion returned untyped error: %v", err)
+			}
+			return
+		}
+
+		if version.AppliedMigrations == nil || version.MigrationHistory == nil {
+			t.Fatalf("decodeSchemaVersion returned nil collections")
+		}
+
+		// Anything we accept must survive a round trip unchanged
+		encoded, err := json.Marshal(version)
+		if err != nil {
+			t.Fatalf("Failed to re-encode decoded schema: %v", err)
+		}
+		again, err := decodeSchemaVersion(encoded)
+		if err != nil {
+			t.Fatalf("Re-encoded schema failed to decode: %v", err)
+		}
+		if again.CurrentVersion != version.CurrentVersion || again.Status != version.Status ||
+			len(again.AppliedMigrations) != len(version.AppliedMigrations) ||
+			len(again.MigrationHistory) != len(version.MigrationHistory) {
+			t.Fatalf("Schema round trip mismatch: %+v != %+v", again, version)
+		}
+	})
+}
+
+func FuzzParseBackupMetadata(f *testing.F) {
+	for _, seed := range []string{
+		"# Pebble Database Backup Metadata\nBACKUP_PATH=/tmp/db.backup_1\nORIGINAL_DB=/tmp/db\nCREATED_AT=2025-01-01T00:00:00Z\nVERSION=1754917200\nSIZE=1024\nDESCRIPTION=Before upgrade\n",
+		"ORIGINAL_DB=/tmp/db\nVERSION=12abc\n",
+		"ORIGINAL_DB=/tmp/db\nSIZE=-5\n",
+		"ORIGINAL_DB=/tmp/db\nCREATED_AT=yesterday\n",
+		"VERSION=1\n",
+		"=\n==\n",
+		"",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		info, err := parseBackupMetadata("/tmp/db.backup_1", content)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidBackupMetadata) {
+				t.Fatalf("parseBackupMetadata returned untyped error: %v", err)
+			}
+			return
+		}
+
+		if info.OriginalDB == "" {
+			t.Fatalf("parseBackupMetadata accepted metadata without ORIGINAL_DB")
+		}
+		if info.Size < 0 {
+			t.Fatalf("parseBackupMetadata accepted negative size %d", info.Size)
+		}
+	})
+}
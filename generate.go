@@ -0,0 +1,188 @@
+package migrate
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// migrationTemplatePrefix starts the names of the templates that produce a file
+// per migration. The rest of the name, without ".tmpl", follows the migration ID
+// in the file name: migration.go.tmpl produces <id>.go and migration_test.go.tmpl
+// produces <id>_test.go. Other templates can be included by those.
+const migrationTemplatePrefix = "migration"
+
+// migrationNamePattern matches the names migrations can be created with
+var migrationNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// MigrationTemplateData is the data migration templates are executed with
+type MigrationTemplateData struct {
+	ID          string    // Migration ID, <version>_<name>
+	Version     int64     // Unix timestamp of the migration
+	Name        string    // Name the migration was created with, e.g. add_user_indexes
+	FuncName    string    // Name in CamelCase for Go identifiers, e.g. AddUserIndexes
+	Description string    // Description of the migration, the name in words by default
+	Package     string    // Go package of the migration files
+	Author      string    // Author of the migration, if known
+	Tags        []string  // Free-form tags
+	CreatedAt   time.Time // Time the migration was created
+	Manifest    bool      // Declare the migration as a variable for `gen manifest` instead of registering it in init
+}
+
+// NewMigrationTemplateData returns the template data of a migration created now
+// with a snake_case name
+func NewMigrationTemplateData(name, pkg string) (*MigrationTemplateData, error) {
+	if !migrationNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid migration name %q: use lowercase letters, digits and underscores", name)
+	}
+
+	now := time.Now()
+	var funcName strings.Builder
+	for _, word := range strings.Split(name, "_") {
+		if word != "" {
+			funcName.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return &MigrationTemplateData{
+		ID:          fmt.Sprintf("%d_%s", now.Unix(), name),
+		Version:     now.Unix(),
+		Name:        name,
+		FuncName:    funcName.String(),
+		Description: strings.ReplaceAll(name, "_", " "),
+		Package:     pkg,
+		CreatedAt:   now,
+	}, nil
+}
+
+// SetVersion changes the version of the migration and its ID, e.g. to the next
+// free second when the current one is taken (see NextFreeVersion)
+func (d *MigrationTemplateData) SetVersion(version int64) {
+	d.Version = version
+	d.ID = fmt.Sprintf("%d_%s", version, d.Name)
+}
+
+// MigrationGenerator creates migration files from Go templates. It starts with
+// the built-in template, which templates loaded with LoadTemplates replace or
+// extend.
+type MigrationGenerator struct {
+	templates *template.Template
+}
+
+// NewMigrationGenerator creates a generator with the built-in template
+func NewMigrationGenerator() *MigrationGenerator {
+	g := &MigrationGenerator{templates: template.New("").Funcs(templateFuncs)}
+	builtin, err := fs.Sub(defaultTemplates, "templates")
+	if err == nil {
+		err = g.LoadTemplates(builtin)
+	}
+	if err != nil {
+		panic(err) // The built-in templates are valid
+	}
+	return g
+}
+
+// LoadTemplates parses the *.tmpl files in the root of fsys, e.g. os.DirFS of a
+// team's template directory or an embed.FS. A template named like a loaded one
+// replaces it.
+func (g *MigrationGenerator) LoadTemplates(fsys fs.FS) error {
+	matches, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %w", err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no *.tmpl templates found")
+	}
+
+	for _, name := range matches {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %w", name, err)
+		}
+		if _, err := g.templates.New(name).Parse(string(data)); err != nil {
+			return fmt.Errorf("failed to parse template %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Generate writes the files of a migration into dir, one per migration template,
+// and returns their paths. Go files are formatted. Nothing is written if a
+// template fails or a file exists.
+func (g *MigrationGenerator) Generate(dir string, data *MigrationTemplateData) ([]string, error) {
+	files := make(map[string][]byte)
+	var paths []string
+	for _, tmpl := range g.templates.Templates() {
+		name := tmpl.Name()
+		if !strings.HasPrefix(name, migrationTemplatePrefix) || !strings.HasSuffix(name, ".tmpl") {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to execute template %s: %w", name, err)
+		}
+		content := buf.Bytes()
+		fileName := data.ID + strings.TrimSuffix(strings.TrimPrefix(name, migrationTemplatePrefix), ".tmpl")
+		if strings.HasSuffix(fileName, ".go") {
+			formatted, err := format.Source(content)
+			if err != nil {
+				return nil, fmt.Errorf("template %s produced invalid Go code: %w", name, err)
+			}
+			content = formatted
+		}
+
+		path := filepath.Join(dir, fileName)
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("%s already exists", path)
+		}
+		files[path] = content
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no migration templates: template names must start with %q", migrationTemplatePrefix)
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := os.WriteFile(path, files[path], 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return paths, nil
+}
+
+// templateFuncs are the functions available in migration templates
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"quote": strconv.Quote,
+	// required fails the generation if a field a team's template needs is empty,
+	// e.g. {{required "author" .Author}}
+	"required": func(field string, value interface{}) (interface{}, error) {
+		empty := value == nil
+		switch v := value.(type) {
+		case string:
+			empty = v == ""
+		case []string:
+			empty = len(v) == 0
+		}
+		if empty {
+			return nil, fmt.Errorf("%s is required", field)
+		}
+		return value, nil
+	},
+}
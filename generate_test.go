@@ -0,0 +1,86 @@
+package migrate
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrationGenerator(t *testing.T) {
+	if _, err := NewMigrationTemplateData("Add-Index", "migrations"); err == nil {
+		t.Errorf("Expected an invalid name to be rejected")
+	}
+
+	data, err := NewMigrationTemplateData("add_user_indexes", "migrations")
+	if err != nil {
+		t.Fatalf("Failed to create template data: %v", err)
+	}
+	if data.FuncName != "AddUserIndexes" || data.Description != "add user indexes" || !strings.HasSuffix(data.ID, "_add_user_indexes") {
+		t.Errorf("Unexpected template data: %+v", data)
+	}
+	if err := ValidateMigrationID(data.ID); err != nil {
+		t.Errorf("Expected a valid migration ID, got %q: %v", data.ID, err)
+	}
+	data.Author = "jane"
+	data.Tags = []string{"perf", "users"}
+
+	t.Run("BuiltIn", func(t *testing.T) {
+		dir := t.TempDir()
+		paths, err := NewMigrationGenerator().Generate(dir, data)
+		if err != nil {
+			t.Fatalf("Failed to generate: %v", err)
+		}
+		if len(paths) != 1 || filepath.Base(paths[0]) != data.ID+".go" {
+			t.Fatalf("Expected %s.go, got %v", data.ID, paths)
+		}
+		content, _ := os.ReadFile(paths[0])
+		if _, err := parser.ParseFile(token.NewFileSet(), paths[0], content, 0); err != nil {
+			t.Errorf("Generated invalid Go code: %v\n%s", err, content)
+		}
+		for _, want := range []string{"package migrations", `ID:          "` + data.ID + `"`, "func upAddUserIndexes", "Author: jane", "Tags: perf, users"} {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("Expected %q in the generated file:\n%s", want, content)
+			}
+		}
+
+		if _, err := NewMigrationGenerator().Generate(dir, data); err == nil {
+			t.Errorf("Expected an existing file not to be overwritten")
+		}
+	})
+
+	t.Run("CustomTemplates", func(t *testing.T) {
+		templates := fstest.MapFS{
+			"header.tmpl":              {Data: []byte(`{{define "header.tmpl"}}// Copyright Acme Corp.{{end}}`)},
+			"migration.go.tmpl":        {Data: []byte("{{template \"header.tmpl\"}}\n\npackage {{.Package}}\n\n// {{upper .Name}} by {{required \"author\" .Author}}\n")},
+			"migration_test.go.tmpl":   {Data: []byte("package {{.Package}}_test\n")},
+			"migration_README.md.tmpl": {Data: []byte("# {{.Description}}\n")},
+		}
+		generator := NewMigrationGenerator()
+		if err := generator.LoadTemplates(templates); err != nil {
+			t.Fatalf("Failed to load templates: %v", err)
+		}
+
+		dir := t.TempDir()
+		paths, err := generator.Generate(dir, data)
+		if err != nil {
+			t.Fatalf("Failed to generate: %v", err)
+		}
+		if len(paths) != 3 {
+			t.Fatalf("Expected 3 files, got %v", paths)
+		}
+		content, _ := os.ReadFile(filepath.Join(dir, data.ID+".go"))
+		if !strings.HasPrefix(string(content), "// Copyright Acme Corp.") || !strings.Contains(string(content), "ADD_USER_INDEXES by jane") {
+			t.Errorf("Expected the custom template to replace the built-in one:\n%s", content)
+		}
+
+		anonymous := *data
+		anonymous.Author = ""
+		if _, err := generator.Generate(t.TempDir(), &anonymous); err == nil || !strings.Contains(err.Error(), "author is required") {
+			t.Errorf("Expected a missing required field to fail, got %v", err)
+		}
+	})
+}
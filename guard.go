@@ -0,0 +1,163 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// reservedSnapshot holds the reserved keys and their values captured before a migration runs
+type reservedSnapshot map[string][]byte
+
+// IsReservedKey reports whether a key belongs to the default internal namespace used
+// for migration metadata (SchemaVersionKey and keys under MigrationPrefix).
+// Migrations must not write or delete these keys.
+func IsReservedKey(key []byte) bool {
+	return string(key) == SchemaVersionKey || bytes.HasPrefix(key, []byte(MigrationPrefix))
+}
+
+// IsReservedKey reports whether a key belongs to this manager's internal namespace
+func (s *SchemaManager) IsReservedKey(key []byte) bool {
+	return string(key) == s.schemaKey || bytes.HasPrefix(key, []byte(s.keyPrefix))
+}
+
+// prefixUpperBound returns the smallest key greater than every key with the given prefix
+func prefixUpperBound(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil // No upper bound, prefix is all 0xff
+}
+
+// unguardedInfixes follow the key prefix in the keys the guard skips: the
+// progress, chunk pre-images and fingerprints running migrations save, and the
+// history, snapshot, audit, plan and undo records the engine appends outside of
+// migrations. Capturing the records would make every migration cost grow with
+// all the metadata ever stored.
+var unguardedInfixes = []string{progressInfix, preImageInfix, fingerprintsInfix,
+	historyInfix, snapshotsInfix, auditInfix, plansInfix, undoLogInfix}
+
+// unguardedPrefix returns the prefix of the unguarded keys key belongs to, or ""
+func (s *SchemaManager) unguardedPrefix(key string) string {
+	for _, infix := range unguardedInfixes {
+		if prefix := s.keyPrefix + infix; strings.HasPrefix(key, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// snapshotReservedKeys captures the keys in the reserved namespace, except for
+// the unguarded ones
+func (s *SchemaManager) snapshotReservedKeys() (reservedSnapshot, error) {
+	snapshot := make(reservedSnapshot)
+
+	value, closer, err := s.db.Get([]byte(s.schemaKey))
+	if err == nil {
+		snapshot[s.schemaKey] = append([]byte(nil), value...)
+		closer.Close()
+	} else if err != pebble.ErrNotFound {
+		return nil, err
+	}
+
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(s.keyPrefix),
+		UpperBound: prefixUpperBound([]byte(s.keyPrefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	operationKey := string(s.operationKey())
+	for valid := iter.First(); valid; {
+		// Unguarded keys are skipped without reading them
+		key := string(iter.Key())
+		if prefix := s.unguardedPrefix(key); prefix != "" {
+			valid = iter.SeekGE(prefixUpperBound([]byte(prefix)))
+			continue
+		}
+		// The engine refreshes the current operation while migrations run
+		if key != operationKey {
+			snapshot[key] = append([]byte(nil), iter.Value()...)
+		}
+		valid = iter.Next()
+	}
+
+	return snapshot, iter.Error()
+}
+
+// diffReservedKeys returns the sorted list of reserved keys that differ between two snapshots
+func diffReservedKeys(before, after reservedSnapshot) []string {
+	var changed []string
+	for key, value := range before {
+		if afterValue, ok := after[key]; !ok || !bytes.Equal(value, afterValue) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// restoreReservedKeys puts the reserved namespace back to the state captured in before
+func (s *SchemaManager) restoreReservedKeys(before, after reservedSnapshot) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			if err := batch.Delete([]byte(key), nil); err != nil {
+				return err
+			}
+		}
+	}
+	for key, value := range before {
+		if err := batch.Set([]byte(key), value, nil); err != nil {
+			return err
+		}
+	}
+
+	return batch.Commit(pebble.Sync)
+}
+
+// guardReservedKeys runs fn and fails if it modified the reserved namespace.
+// On violation the reserved keys are restored so the schema state stays intact.
+func (s *SchemaManager) guardReservedKeys(migrationID string, fn func() error) error {
+	before, err := s.snapshotReservedKeys()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot reserved keys: %w", err)
+	}
+
+	fnErr := fn()
+
+	after, err := s.snapshotReservedKeys()
+	if err != nil {
+		return fmt.Errorf("failed to check reserved keys: %w", err)
+	}
+
+	changed := diffReservedKeys(before, after)
+	if len(changed) == 0 {
+		return fnErr
+	}
+
+	if err := s.restoreReservedKeys(before, after); err != nil {
+		return fmt.Errorf("%w: migration %s modified %v and restoring them failed: %v",
+			ErrReservedKeyModified, migrationID, changed, err)
+	}
+
+	return fmt.Errorf("%w: migration %s modified %v (set AllowInternalWrites for intentional internal maintenance)",
+		ErrReservedKeyModified, migrationID, changed)
+}
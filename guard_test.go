@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestReservedKeyGuard(t *testing.T) {
+	setup := func(t *testing.T, m *Migration) (*pebble.DB, *SchemaManager, error) {
+		dir := t.TempDir()
+		db, err := pebble.Open(dir, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		registry := NewMigrationRegistry()
+		if err := registry.Register(m); err != nil {
+			t.Fatalf("Failed to register migration: %v", err)
+		}
+
+		schemaManager := NewSchemaManager(db)
+		if err := schemaManager.SetSchemaVersion(&SchemaVersion{
+			AppliedMigrations: make(map[string]bool),
+			Status:            StatusClean,
+		}); err != nil {
+			t.Fatalf("Failed to set schema version: %v", err)
+		}
+
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dir)
+		engine.SetBackupEnabled(false)
+		plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err != nil {
+			t.Fatalf("Failed to plan upgrade: %v", err)
+		}
+
+		return db, schemaManager, engine.ExecutePlan(plan, nil)
+	}
+
+	t.Run("DeleteSchemaKeyFails", func(t *testing.T) {
+		db, schemaManager, err := setup(t, &Migration{
+			ID: "1754917200_clobber_schema",
+			Up: func(db *pebble.DB) error {
+				return db.Delete([]byte(SchemaVersionKey), pebble.Sync)
+			},
+			Down: func(db *pebble.DB) error { return nil },
+		})
+		if !errors.Is(err, ErrReservedKeyModified) {
+			t.Fatalf("Expected ErrReservedKeyModified, got %v", err)
+		}
+
+		// The schema key is restored and the failure is recorded in it
+		_, closer, getErr := db.Get([]byte(SchemaVersionKey))
+		if getErr != nil {
+			t.Fatalf("Expected schema key to be restored, got %v", getErr)
+		}
+		closer.Close()
+
+		schema, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get schema version: %v", err)
+		}
+		if schema.Status != StatusDirty {
+			t.Errorf("Expected status dirty, got %s", schema.Status)
+		}
+	})
+
+	t.Run("WriteInternalPrefixFails", func(t *testing.T) {
+		db, _, err := setup(t, &Migration{
+			ID: "1754917200_write_internal",
+			Up: func(db *pebble.DB) error {
+				return db.Set([]byte(MigrationPrefix+"oops"), []byte("x"), pebble.Sync)
+			},
+			Down: func(db *pebble.DB) error { return nil },
+		})
+		if !errors.Is(err, ErrReservedKeyModified) {
+			t.Fatalf("Expected ErrReservedKeyModified, got %v", err)
+		}
+
+		if _, _, err := db.Get([]byte(MigrationPrefix + "oops")); err != pebble.ErrNotFound {
+			t.Errorf("Expected internal key to be removed, got %v", err)
+		}
+	})
+
+	t.Run("AllowInternalWrites", func(t *testing.T) {
+		_, schemaManager, err := setup(t, &Migration{
+			ID: "1754917200_internal_maintenance",
+			Up: func(db *pebble.DB) error {
+				return db.Set([]byte(MigrationPrefix+"maintenance"), []byte("x"), pebble.Sync)
+			},
+			Down:                func(db *pebble.DB) error { return nil },
+			AllowInternalWrites: true,
+		})
+		if err != nil {
+			t.Fatalf("Expected migration to succeed, got %v", err)
+		}
+
+		applied, err := schemaManager.IsMigrationApplied("1754917200_internal_maintenance")
+		if err != nil || !applied {
+			t.Errorf("Expected migration to be applied, got %v (err: %v)", applied, err)
+		}
+	})
+
+	t.Run("UserKeysAllowed", func(t *testing.T) {
+		_, _, err := setup(t, &Migration{
+			ID: "1754917200_user_keys",
+			Up: func(db *pebble.DB) error {
+				return db.Set([]byte("__migrations_are_fun"), []byte("x"), pebble.Sync)
+			},
+			Down: func(db *pebble.DB) error { return nil },
+		})
+		if err != nil {
+			t.Fatalf("Expected migration to succeed, got %v", err)
+		}
+	})
+
+	t.Run("SkipsAppendedRecords", func(t *testing.T) {
+		_, schemaManager, err := setup(t, &Migration{
+			ID:   "1754917200_first",
+			Up:   func(db *pebble.DB) error { return nil },
+			Down: func(db *pebble.DB) error { return nil },
+		})
+		if err != nil {
+			t.Fatalf("Expected migration to succeed, got %v", err)
+		}
+		if err := schemaManager.UpdateSchemaAfterMigration("1754917300_second", 1754917300, "Second", 0); err != nil {
+			t.Fatalf("Failed to update schema: %v", err)
+		}
+
+		// Only the schema head is captured, not the history or plan records
+		snapshot, err := schemaManager.snapshotReservedKeys()
+		if err != nil {
+			t.Fatalf("Failed to snapshot: %v", err)
+		}
+		if _, ok := snapshot[SchemaVersionKey]; !ok || len(snapshot) != 1 {
+			t.Errorf("Expected only the schema key, got %d keys", len(snapshot))
+		}
+	})
+}
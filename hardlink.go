@@ -0,0 +1,159 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// backupRefsDir is the directory inside a directory backup holding one file per
+// reference to the backup
+const backupRefsDir = ".backup_refs"
+
+// BackupReference is a holder of a directory backup, e.g. a restore reading from it
+type BackupReference struct {
+	Path    string // Reference file
+	PID     int    // Process holding the reference
+	Reason  string
+	Created time.Time
+}
+
+// ReferenceBackup marks a directory backup as in use until release is called.
+// Referenced backups are not removed by cleanup, ConvertToArchive or
+// RemoveBackup. References of processes that are no longer running are ignored.
+func (b *BackupManager) ReferenceBackup(backupPath, reason string) (release func(), err error) {
+	if strings.HasSuffix(backupPath, ".tar.gz") {
+		return func() {}, nil
+	}
+
+	dir := filepath.Join(backupPath, backupRefsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to reference backup: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d_%d", os.Getpid(), time.Now().UnixNano()))
+	if err := os.WriteFile(path, []byte(reason+"\n"), 0644); err != nil {
+		return nil, fmt.Errorf("failed to reference backup: %w", err)
+	}
+	return func() { os.Remove(path) }, nil
+}
+
+// BackupReferences lists the live references to a backup. Reference files of
+// processes that are no longer running are removed.
+func (b *BackupManager) BackupReferences(backupPath string) ([]*BackupReference, error) {
+	entries, err := os.ReadDir(filepath.Join(backupPath, backupRefsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup references: %w", err)
+	}
+
+	var refs []*BackupReference
+	for _, entry := range entries {
+		path := filepath.Join(backupPath, backupRefsDir, entry.Name())
+		pidPart, _, _ := strings.Cut(entry.Name(), "_")
+		pid, err := strconv.Atoi(pidPart)
+		if err != nil || !processRunning(pid) {
+			os.Remove(path)
+			continue
+		}
+
+		ref := &BackupReference{Path: path, PID: pid}
+		if data, err := os.ReadFile(path); err == nil {
+			ref.Reason = strings.TrimSpace(string(data))
+		}
+		if info, err := entry.Info(); err == nil {
+			ref.Created = info.ModTime()
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// processRunning reports whether a process with the given PID exists
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// checkUnreferenced returns an error wrapping ErrBackupReferenced if the backup
+// has live references
+func (b *BackupManager) checkUnreferenced(backupPath string) error {
+	refs, err := b.BackupReferences(backupPath)
+	if err != nil {
+		return err
+	}
+	if len(refs) > 0 {
+		return fmt.Errorf("%w: %s is held by process %d (%s)", ErrBackupReferenced, backupPath, refs[0].PID, refs[0].Reason)
+	}
+	return nil
+}
+
+// RemoveBackup removes a backup and its metadata. It fails with
+// ErrBackupReferenced while the backup is referenced.
+func (b *BackupManager) RemoveBackup(backupPath string) error {
+	if err := b.checkUnreferenced(backupPath); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(backupPath); err != nil {
+		return fmt.Errorf("failed to remove backup: %w", err)
+	}
+	if strings.HasSuffix(backupPath, ".tar.gz") {
+		os.Remove(backupPath + ".metadata")
+	}
+	return nil
+}
+
+// ConvertToArchive compresses a directory backup, such as a hardlinked one, into
+// a .tar.gz archive with its metadata and removes the directory. The archive
+// does not share files with the database, so it can be moved elsewhere.
+func (b *BackupManager) ConvertToArchive(backupPath string) (*BackupInfo, error) {
+	if strings.HasSuffix(backupPath, ".tar.gz") {
+		return nil, fmt.Errorf("%s is already an archive", backupPath)
+	}
+	if !b.isValidBackup(backupPath) {
+		return nil, fmt.Errorf("invalid backup directory: %s", backupPath)
+	}
+	info, err := b.readBackupMetadata(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup metadata: %w", err)
+	}
+	if err := b.checkUnreferenced(backupPath); err != nil {
+		return nil, err
+	}
+
+	release, err := b.ReferenceBackup(backupPath, "conversion to archive")
+	if err != nil {
+		return nil, err
+	}
+	archivePath := backupPath + ".tar.gz"
+	size, err := b.compressCheckpoint(backupPath, archivePath)
+	release()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress backup: %w", err)
+	}
+
+	info.Path = archivePath
+	info.Size = size
+	info.Hardlinked = false
+	if info.Checksum, err = b.BackupChecksum(archivePath); err != nil {
+		os.Remove(archivePath)
+		return nil, err
+	}
+	if err := b.writeBackupMetadata(info); err != nil {
+		os.Remove(archivePath)
+		return nil, fmt.Errorf("failed to write backup metadata: %w", err)
+	}
+	if err := os.RemoveAll(backupPath); err != nil {
+		return info, fmt.Errorf("archive created, but failed to remove %s: %w", backupPath, err)
+	}
+	return info, nil
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestHardlinkBackups(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	db.Set([]byte("key"), []byte("value"), pebble.Sync)
+	db.Flush()
+
+	backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{Compress: true, Hardlink: true})
+	backup, err := backupManager.CreateBackup(db, "Hardlinked")
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	t.Run("SharesSSTables", func(t *testing.T) {
+		info, err := backupManager.readBackupMetadata(backup.Path)
+		if err != nil || !info.Hardlinked {
+			t.Fatalf("Expected hardlinked metadata, got %+v (%v)", info, err)
+		}
+
+		ssts, _ := filepath.Glob(filepath.Join(backup.Path, "*.sst"))
+		if len(ssts) == 0 {
+			t.Fatal("Expected SSTables in the backup")
+		}
+		stat, err := os.Stat(ssts[0])
+		if err != nil {
+			t.Fatalf("Failed to stat SSTable: %v", err)
+		}
+		if nlink := stat.Sys().(*syscall.Stat_t).Nlink; nlink < 2 {
+			t.Errorf("Expected the SSTable to be hardlinked, got %d link(s)", nlink)
+		}
+	})
+
+	t.Run("ReferencePreventsRemoval", func(t *testing.T) {
+		// References of processes that are gone are ignored
+		stale := filepath.Join(backup.Path, backupRefsDir, "999999999_1")
+		os.MkdirAll(filepath.Dir(stale), 0755)
+		os.WriteFile(stale, []byte("crashed restore\n"), 0644)
+		if refs, err := backupManager.BackupReferences(backup.Path); err != nil || len(refs) != 0 {
+			t.Fatalf("Expected the stale reference to be ignored, got %+v (%v)", refs, err)
+		}
+
+		release, err := backupManager.ReferenceBackup(backup.Path, "test")
+		if err != nil {
+			t.Fatalf("Failed to reference backup: %v", err)
+		}
+		if err := backupManager.RemoveBackup(backup.Path); !errors.Is(err, ErrBackupReferenced) {
+			t.Errorf("Expected ErrBackupReferenced from RemoveBackup, got %v", err)
+		}
+		if _, err := backupManager.ConvertToArchive(backup.Path); !errors.Is(err, ErrBackupReferenced) {
+			t.Errorf("Expected ErrBackupReferenced from ConvertToArchive, got %v", err)
+		}
+		release()
+
+		if refs, _ := backupManager.BackupReferences(backup.Path); len(refs) != 0 {
+			t.Errorf("Expected no references after release, got %+v", refs)
+		}
+	})
+
+	t.Run("ConvertToArchive", func(t *testing.T) {
+		archive, err := backupManager.ConvertToArchive(backup.Path)
+		if err != nil {
+			t.Fatalf("Failed to convert backup: %v", err)
+		}
+		if !strings.HasSuffix(archive.Path, ".tar.gz") || archive.Hardlinked {
+			t.Errorf("Expected an archive, got %+v", archive)
+		}
+		if _, err := os.Stat(backup.Path); !os.IsNotExist(err) {
+			t.Errorf("Expected the directory to be removed, got %v", err)
+		}
+
+		backups, _ := backupManager.ListBackups()
+		if len(backups) != 1 || backups[0].Path != archive.Path || backups[0].Description != "Hardlinked" {
+			t.Errorf("Expected the archive to be listed with the original metadata, got %+v", backups)
+		}
+		if stat, err := os.Stat(archive.Path); err != nil || stat.Size() != archive.Size {
+			t.Errorf("Expected the recorded size to match the archive, got %d (%v)", archive.Size, err)
+		}
+	})
+}
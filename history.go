@@ -0,0 +1,167 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// historyInfix follows the key prefix in the keys history records are stored under
+const historyInfix = "history/"
+
+// storedSchemaVersion is the form the schema state is stored in. The schema key
+// holds the version, status and sorted applied set only; every history record is
+// stored under its own key, so recording a migration does not rewrite the history.
+// Values written by earlier versions use the AppliedMigrations map and keep the
+// history inline; they are converted on the next write.
+type storedSchemaVersion struct {
+	CurrentVersion    int64             `json:"current_version"`
+	Applied           []string          `json:"applied,omitempty"`
+	AppliedMigrations map[string]bool   `json:"applied_migrations,omitempty"`
+	MigrationHistory  []MigrationRecord `json:"migration_history,omitempty"`
+	LastHistoryKey    int64             `json:"last_history_key,omitempty"`
+	LastMigrationAt   time.Time         `json:"last_migration_at"`
+	Status            Status            `json:"status"`
+	Revision          uint64            `json:"revision,omitempty"`
+	Environment       string            `json:"environment,omitempty"`
+	RunningMigrations []string          `json:"running_migrations,omitempty"`
+	LastFailure       *MigrationFailure `json:"last_failure,omitempty"`
+}
+
+// historyKey returns the internal key a history record is stored under. Records
+// are keyed by their timestamp in Unix nanoseconds, so they sort chronologically.
+func (s *SchemaManager) historyKey(ts int64) []byte {
+	return []byte(fmt.Sprintf("%s%s%020d", s.keyPrefix, historyInfix, ts))
+}
+
+// historyPrefix returns the prefix of all history record keys
+func (s *SchemaManager) historyPrefix() []byte {
+	return []byte(s.keyPrefix + historyInfix)
+}
+
+// encodeSchemaHead encodes a schema state without its history records
+func encodeSchemaHead(version *SchemaVersion, encoding SchemaEncoding) ([]byte, error) {
+	applied := make([]string, 0, len(version.AppliedMigrations))
+	for id, ok := range version.AppliedMigrations {
+		if ok {
+			applied = append(applied, id)
+		}
+	}
+	sort.Strings(applied)
+
+	return encodeStoredSchema(&storedSchemaVersion{
+		CurrentVersion:    version.CurrentVersion,
+		Applied:           applied,
+		LastHistoryKey:    version.lastHistoryKey,
+		LastMigrationAt:   version.LastMigrationAt,
+		Status:            version.Status,
+		Revision:          version.Revision,
+		Environment:       version.Environment,
+		RunningMigrations: version.RunningMigrations,
+		LastFailure:       version.LastFailure,
+	}, encoding)
+}
+
+// putHistoryRecord adds a history record to a batch. Keys are the record time,
+// moved forward if needed so they stay unique and in insertion order.
+func (s *SchemaManager) putHistoryRecord(batch *pebble.Batch, head *SchemaVersion, record MigrationRecord) error {
+	ts := record.AppliedAt.UnixNano()
+	if ts <= head.lastHistoryKey {
+		ts = head.lastHistoryKey + 1
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %w", err)
+	}
+	if err := batch.Set(s.historyKey(ts), data, nil); err != nil {
+		return err
+	}
+	head.lastHistoryKey = ts
+	return nil
+}
+
+// updateSchema stores a schema state read with getSchemaHead and appends records to
+// the history, in one atomic write. Only the schema key and the new records are
+// written, independent of the length of the history. It fails with a
+// *SchemaConflictError if the state changed since it was read.
+func (s *SchemaManager) updateSchema(head *SchemaVersion, records ...MigrationRecord) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	// Move history kept inline by earlier versions to per-record keys
+	for _, record := range append(head.MigrationHistory, records...) {
+		if err := s.putHistoryRecord(batch, head, record); err != nil {
+			return err
+		}
+	}
+
+	if err := s.commitSchema(batch, head); err != nil {
+		return err
+	}
+	head.MigrationHistory = head.MigrationHistory[:0]
+	return nil
+}
+
+// loadHistory appends the stored history records to a decoded schema state
+func (s *SchemaManager) loadHistory(version *SchemaVersion) error {
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: s.historyPrefix(),
+		UpperBound: prefixUpperBound(s.historyPrefix()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	defer iter.Close()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		var record MigrationRecord
+		if err := json.Unmarshal(iter.Value(), &record); err != nil {
+			return fmt.Errorf("%w: history record %s: %v", ErrCorruptSchemaState, iter.Key(), err)
+		}
+		normalizeRecord(&record)
+		version.MigrationHistory = append(version.MigrationHistory, record)
+	}
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	return nil
+}
+
+// normalizeRecord sets the type of a record written before records had one,
+// from the ID suffix or description that marked it then, and removes the
+// rollback and rerun suffixes from the ID.
+func normalizeRecord(record *MigrationRecord) {
+	if record.Duration == 0 && record.DurationText != "" {
+		// Records written before durations were stored in nanoseconds
+		if d, err := time.ParseDuration(record.DurationText); err == nil {
+			record.Duration = d
+		}
+	}
+	if record.Type != "" {
+		return
+	}
+	switch {
+	case strings.HasSuffix(record.ID, "_rerun_rollback"):
+		record.ID = strings.TrimSuffix(record.ID, "_rerun_rollback")
+		record.Type = RecordRollback
+	case strings.HasSuffix(record.ID, "_rollback"):
+		record.ID = strings.TrimSuffix(record.ID, "_rollback")
+		record.Type = RecordRollback
+	case strings.HasSuffix(record.ID, "_rerun"):
+		record.ID = strings.TrimSuffix(record.ID, "_rerun")
+		record.Type = RecordRerun
+	case strings.Contains(record.Description, "(repaired"):
+		record.Type = RecordRepair
+	case strings.Contains(record.Description, "(imported from "):
+		record.Type = RecordStamp
+	case strings.Contains(record.Description, "(skipped - fresh database)"):
+		record.Type = RecordBaseline
+	default:
+		record.Type = RecordApply
+	}
+}
@@ -0,0 +1,302 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestPerRecordHistory(t *testing.T) {
+	setup := func(t *testing.T) (*pebble.DB, *SchemaManager) {
+		db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db, NewSchemaManager(db)
+	}
+
+	stored := func(t *testing.T, db *pebble.DB) (storedSchemaVersion, []byte) {
+		data, closer, err := db.Get([]byte(SchemaVersionKey))
+		if err != nil {
+			t.Fatalf("Failed to read schema key: %v", err)
+		}
+		defer closer.Close()
+
+		var stored storedSchemaVersion
+		if err := json.Unmarshal(data, &stored); err != nil {
+			t.Fatalf("Failed to decode schema key: %v", err)
+		}
+		return stored, append([]byte(nil), data...)
+	}
+
+	countRecords := func(t *testing.T, db *pebble.DB) int {
+		prefix := []byte(MigrationPrefix + historyInfix)
+		iter, err := db.NewIter(&pebble.IterOptions{LowerBound: prefix, UpperBound: prefixUpperBound(prefix)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer iter.Close()
+
+		n := 0
+		for iter.First(); iter.Valid(); iter.Next() {
+			n++
+		}
+		return n
+	}
+
+	t.Run("RecordsUnderOwnKeys", func(t *testing.T) {
+		db, schemaManager := setup(t)
+
+		var sizes []int
+		for i := 0; i < 20; i++ {
+			id := fmt.Sprintf("%d_step", 1754917200+i)
+			if err := schemaManager.MarkMigrationStarted(); err != nil {
+				t.Fatalf("Failed to mark started: %v", err)
+			}
+			if err := schemaManager.UpdateSchemaAfterMigration(id, int64(1754917200+i), "Step", time.Second); err != nil {
+				t.Fatalf("Failed to update schema: %v", err)
+			}
+			raw, data := stored(t, db)
+			if len(raw.MigrationHistory) != 0 {
+				t.Fatalf("Expected no inline history, got %d records", len(raw.MigrationHistory))
+			}
+			sizes = append(sizes, len(data))
+		}
+
+		// The schema value grows with the applied set only, not with the history
+		if growth := sizes[19] - sizes[18]; growth > 32 {
+			t.Errorf("Expected the schema value to grow by about one applied ID, grew by %d bytes", growth)
+		}
+		if n := countRecords(t, db); n != 20 {
+			t.Errorf("Expected 20 history record keys, got %d", n)
+		}
+
+		history, err := schemaManager.GetMigrationHistory()
+		if err != nil {
+			t.Fatalf("Failed to get history: %v", err)
+		}
+		if len(history) != 20 {
+			t.Fatalf("Expected 20 history records, got %d", len(history))
+		}
+		for i, record := range history {
+			if expected := fmt.Sprintf("%d_step", 1754917200+i); record.ID != expected {
+				t.Errorf("Record %d: expected %s, got %s", i, expected, record.ID)
+			}
+		}
+		if err := schemaManager.ValidateSchemaState(); err != nil {
+			t.Errorf("Expected state to validate: %v", err)
+		}
+	})
+
+	t.Run("SameTimestampKeepsOrder", func(t *testing.T) {
+		_, schemaManager := setup(t)
+
+		now := time.Now()
+		version := &SchemaVersion{AppliedMigrations: map[string]bool{}, Status: StatusClean}
+		for i := 0; i < 5; i++ {
+			id := fmt.Sprintf("%d_step", 1754917200+i)
+			version.AppliedMigrations[id] = true
+			version.MigrationHistory = append(version.MigrationHistory, MigrationRecord{ID: id, AppliedAt: now, Success: true})
+		}
+		if err := schemaManager.SetSchemaVersion(version); err != nil {
+			t.Fatalf("Failed to store schema: %v", err)
+		}
+		if err := schemaManager.UpdateAfterRollback("1754917204_step", 1754917204, "Step", time.Millisecond); err != nil {
+			t.Fatalf("Failed to record rollback: %v", err)
+		}
+
+		history, _ := schemaManager.GetMigrationHistory()
+		if len(history) != 6 || history[5].ID != "1754917204_step" || history[5].Type != RecordRollback {
+			t.Fatalf("Expected 6 records ending with the rollback, got %+v", history)
+		}
+		for i := 0; i < 5; i++ {
+			if expected := fmt.Sprintf("%d_step", 1754917200+i); history[i].ID != expected {
+				t.Errorf("Record %d: expected %s, got %s", i, expected, history[i].ID)
+			}
+		}
+	})
+
+	t.Run("ReplaceRemovesOldRecords", func(t *testing.T) {
+		db, schemaManager := setup(t)
+
+		for i := 0; i < 10; i++ {
+			schemaManager.UpdateSchemaAfterMigration(fmt.Sprintf("%d_step", 1754917200+i), int64(1754917200+i), "Step", time.Second)
+		}
+
+		// Replace the state with a fresh one, as import does
+		current, _ := schemaManager.GetSchemaVersion()
+		if err := schemaManager.SetSchemaVersion(&SchemaVersion{
+			CurrentVersion:    1754917200,
+			AppliedMigrations: map[string]bool{"1754917200_step": true},
+			MigrationHistory:  []MigrationRecord{{ID: "1754917200_step", Success: true}},
+			Status:            StatusClean,
+			Revision:          current.Revision,
+		}); err != nil {
+			t.Fatalf("Failed to replace schema: %v", err)
+		}
+
+		if n := countRecords(t, db); n != 1 {
+			t.Errorf("Expected 1 history record key, got %d", n)
+		}
+		history, _ := schemaManager.GetMigrationHistory()
+		if len(history) != 1 {
+			t.Errorf("Expected 1 history record, got %d", len(history))
+		}
+	})
+
+	t.Run("ConvertsLegacyFormat", func(t *testing.T) {
+		db, schemaManager := setup(t)
+
+		legacy := `{"current_version":1754917200,"applied_migrations":{"1754917200_test":true},"migration_history":[{"id":"1754917200_test","description":"Test","applied_at":"2025-01-01T00:00:00Z","duration":"1s","success":true}],"last_migration_at":"2025-01-01T00:00:00Z","status":"clean"}`
+		db.Set([]byte(SchemaVersionKey), []byte(legacy), pebble.Sync)
+
+		applied, err := schemaManager.IsMigrationApplied("1754917200_test")
+		if err != nil || !applied {
+			t.Fatalf("Expected legacy applied set to be read, got %v (%v)", applied, err)
+		}
+
+		// The next write moves the inline history to per-record keys
+		if err := schemaManager.UpdateSchemaAfterMigration("1754917300_next", 1754917300, "Next", time.Second); err != nil {
+			t.Fatalf("Failed to update schema: %v", err)
+		}
+		raw, _ := stored(t, db)
+		if len(raw.Applied) != 2 || raw.AppliedMigrations != nil || len(raw.MigrationHistory) != 0 {
+			t.Errorf("Expected converted format after write, got %+v", raw)
+		}
+
+		history, _ := schemaManager.GetMigrationHistory()
+		if len(history) != 2 || history[0].ID != "1754917200_test" || history[1].ID != "1754917300_next" {
+			t.Errorf("Expected legacy record followed by the new one, got %+v", history)
+		}
+	})
+	t.Run("TypesLegacyRecords", func(t *testing.T) {
+		db, schemaManager := setup(t)
+
+		legacy := `{"current_version":1754917200,"applied_migrations":{"1754917200_a":true,"1754917200_a_rerun":true},"migration_history":[` +
+			`{"id":"1754917200_a","description":"A","applied_at":"2025-01-01T00:00:00Z","duration":"1s","success":true},` +
+			`{"id":"1754917300_b","description":"B","applied_at":"2025-01-01T00:00:01Z","duration":"1s","success":true},` +
+			`{"id":"1754917300_b_rollback","description":"Rolled back: B","applied_at":"2025-01-01T00:00:02Z","duration":"0s","success":true},` +
+			`{"id":"1754917200_a_rerun","description":"Rerun: A","applied_at":"2025-01-01T00:00:03Z","duration":"1s","success":true}` +
+			`],"last_migration_at":"2025-01-01T00:00:03Z","status":"clean"}`
+		db.Set([]byte(SchemaVersionKey), []byte(legacy), pebble.Sync)
+
+		history, err := schemaManager.GetMigrationHistory()
+		if err != nil {
+			t.Fatalf("Failed to read history: %v", err)
+		}
+		expected := []struct {
+			id         string
+			recordType RecordType
+		}{
+			{"1754917200_a", RecordApply},
+			{"1754917300_b", RecordApply},
+			{"1754917300_b", RecordRollback},
+			{"1754917200_a", RecordRerun},
+		}
+		for i, want := range expected {
+			if history[i].ID != want.id || history[i].Type != want.recordType {
+				t.Errorf("Record %d: expected %s (%s), got %s (%s)", i, want.id, want.recordType, history[i].ID, history[i].Type)
+			}
+		}
+		if schema, _ := schemaManager.GetSchemaVersion(); len(schema.AppliedMigrations) != 1 || !schema.AppliedMigrations["1754917200_a"] {
+			t.Errorf("Expected only the canonical ID to be applied, got %v", schema.AppliedMigrations)
+		}
+		if history[0].Duration != time.Second || history[0].DurationText != "1s" {
+			t.Errorf("Expected the legacy duration to be parsed, got %v (%q)", history[0].Duration, history[0].DurationText)
+		}
+		if err := schemaManager.ValidateSchemaState(); err != nil {
+			t.Errorf("Expected the legacy state to validate: %v", err)
+		}
+	})
+
+	t.Run("RerunKeepsCanonicalID", func(t *testing.T) {
+		db, schemaManager := setup(t)
+
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{
+			ID:   "1754917200_rerun_me",
+			Up:   func(db *pebble.DB) error { return nil },
+			Down: func(db *pebble.DB) error { return nil },
+		})
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, "")
+		engine.SetBackupEnabled(false)
+		planner := NewMigrationPlanner(registry, schemaManager)
+
+		plan, _ := planner.PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to execute: %v", err)
+		}
+		plan, err := planner.PlanRerun("1754917200_rerun_me")
+		if err != nil {
+			t.Fatalf("Failed to plan rerun: %v", err)
+		}
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to rerun: %v", err)
+		}
+
+		schema, _ := schemaManager.GetSchemaVersion()
+		if len(schema.AppliedMigrations) != 1 || !schema.AppliedMigrations["1754917200_rerun_me"] {
+			t.Errorf("Expected only the canonical ID to be applied, got %v", schema.AppliedMigrations)
+		}
+		history := schema.MigrationHistory
+		if len(history) != 2 || history[1].ID != "1754917200_rerun_me" || history[1].Type != RecordRerun {
+			t.Errorf("Expected a rerun record under the canonical ID, got %+v", history)
+		}
+		if err := schemaManager.ValidateSchemaState(); err != nil {
+			t.Errorf("Expected state to validate after rerun: %v", err)
+		}
+	})
+
+	t.Run("RecordsElapsedDurations", func(t *testing.T) {
+		db, schemaManager := setup(t)
+
+		failing := false
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{
+			ID: "1754917200_slow",
+			Up: func(db *pebble.DB) error {
+				time.Sleep(10 * time.Millisecond)
+				if failing {
+					return fmt.Errorf("boom")
+				}
+				return nil
+			},
+			Down: func(db *pebble.DB) error {
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			},
+		})
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, "")
+		engine.SetBackupEnabled(false)
+		planner := NewMigrationPlanner(registry, schemaManager)
+
+		plan, _ := planner.PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to execute: %v", err)
+		}
+		plan, _ = planner.PlanDowngrade(0)
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to roll back: %v", err)
+		}
+		failing = true
+		plan, _ = planner.PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err == nil {
+			t.Fatalf("Expected the migration to fail")
+		}
+
+		history, _ := schemaManager.GetMigrationHistory()
+		if len(history) != 3 {
+			t.Fatalf("Expected 3 records, got %+v", history)
+		}
+		for _, record := range history {
+			if record.Duration < 10*time.Millisecond || record.DurationText != record.Duration.String() {
+				t.Errorf("Expected the elapsed time in the %s record, got %v (%q)", record.Type, record.Duration, record.DurationText)
+			}
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportOptions controls how migration state from another tool is imported
+type ImportOptions struct {
+	// Source names the tool the state came from; it is recorded in the history
+	// records of the imported migrations. Default: "golang-migrate"
+	Source string
+
+	// Force allows replacing a schema state that already has applied migrations
+	Force bool
+}
+
+// ImportGolangMigrateState seeds the schema state from golang-migrate's
+// schema_migrations table. golang-migrate only stores the latest applied version
+// and a dirty flag, so every registered migration with a version up to and
+// including that version is marked as applied. A version <= 0 (golang-migrate's
+// nil version) imports an empty state.
+func (s *SchemaManager) ImportGolangMigrateState(registry *MigrationRegistry, version int64, dirty bool, opts ImportOptions) ([]string, error) {
+	if dirty {
+		return nil, fmt.Errorf("source state is dirty at version %d: resolve it with golang-migrate's force command before importing", version)
+	}
+
+	var versions []int64
+	if version > 0 {
+		found := false
+		for _, m := range registry.GetMigrations() {
+			if m.Version == version {
+				found = true
+			}
+			if m.Version <= version {
+				versions = append(versions, m.Version)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no registered migration has version %d", version)
+		}
+	}
+
+	return s.ImportAppliedVersions(registry, versions, opts)
+}
+
+// ImportAppliedVersions seeds the schema state so that exactly the registered
+// migrations with the given versions are marked as applied. Every version must
+// match a registered migration. Returns the IDs of the imported migrations.
+func (s *SchemaManager) ImportAppliedVersions(registry *MigrationRegistry, versions []int64, opts ImportOptions) ([]string, error) {
+	source := opts.Source
+	if source == "" {
+		source = "golang-migrate"
+	}
+
+	currentSchema, err := s.GetSchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current schema: %w", err)
+	}
+	if currentSchema.Status != StatusClean {
+		return nil, fmt.Errorf("cannot import into schema in %s state", currentSchema.Status)
+	}
+	if len(currentSchema.AppliedMigrations) > 0 && !opts.Force {
+		return nil, fmt.Errorf("schema already has %d applied migrations (use force to replace them)", len(currentSchema.AppliedMigrations))
+	}
+
+	byVersion := make(map[int64][]*Migration)
+	for _, m := range registry.GetMigrations() {
+		byVersion[m.Version] = append(byVersion[m.Version], m)
+	}
+
+	wanted := make(map[int64]bool)
+	var unknown []string
+	for _, v := range versions {
+		if _, ok := byVersion[v]; !ok {
+			unknown = append(unknown, strconv.FormatInt(v, 10))
+			continue
+		}
+		wanted[v] = true
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("versions not found in registry: %s", strings.Join(unknown, ", "))
+	}
+
+	sorted := make([]int64, 0, len(wanted))
+	for v := range wanted {
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var migrations []*Migration
+	for _, v := range sorted {
+		migrations = append(migrations, byVersion[v]...)
+	}
+	return s.stampApplied(currentSchema, migrations, "imported from "+source)
+}
+
+// InitializeFromAppliedList seeds the schema state so that exactly the registered
+// migrations with the given IDs are marked as applied, e.g. when adopting the
+// tool on a database whose history is known. IDs may be former IDs registered
+// with RegisterAlias. Every ID must match a registered migration, and the
+// dependencies of the listed migrations must be listed too. Like
+// ImportAppliedVersions, it fails on a database with applied migrations unless
+// opts.Force is set; opts.Source defaults to "applied list". Returns the IDs of
+// the seeded migrations in version order.
+func (s *SchemaManager) InitializeFromAppliedList(registry *MigrationRegistry, ids []string, opts ImportOptions) ([]string, error) {
+	source := opts.Source
+	if source == "" {
+		source = "applied list"
+	}
+
+	currentSchema, err := s.GetSchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current schema: %w", err)
+	}
+	if currentSchema.Status != StatusClean {
+		return nil, fmt.Errorf("cannot seed schema in %s state", currentSchema.Status)
+	}
+	if len(currentSchema.AppliedMigrations) > 0 && !opts.Force {
+		return nil, fmt.Errorf("schema already has %d applied migrations (use force to replace them)", len(currentSchema.AppliedMigrations))
+	}
+
+	listed := make(map[string]bool)
+	var unknown []string
+	for _, id := range ids {
+		id = registry.ResolveID(id)
+		if _, ok := registry.GetMigration(id); !ok {
+			unknown = append(unknown, id)
+			continue
+		}
+		listed[id] = true
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("migrations not found in registry: %s", strings.Join(unknown, ", "))
+	}
+
+	var migrations []*Migration
+	for _, m := range registry.GetMigrations() {
+		if !listed[m.ID] {
+			continue
+		}
+		for _, depID := range m.Dependencies {
+			if depID = registry.ResolveID(depID); !listed[depID] {
+				return nil, fmt.Errorf("migration %s is listed but its dependency %s is not", m.ID, depID)
+			}
+		}
+		migrations = append(migrations, m)
+	}
+	return s.stampApplied(currentSchema, migrations, "seeded from "+source)
+}
+
+// stampApplied replaces the schema state with one where exactly migrations, given
+// in version order, are applied, recording a stamp for each with note appended
+// to its description
+func (s *SchemaManager) stampApplied(currentSchema *SchemaVersion, migrations []*Migration, note string) ([]string, error) {
+	now := time.Now()
+	schema := &SchemaVersion{
+		AppliedMigrations: make(map[string]bool),
+		MigrationHistory:  make([]MigrationRecord, 0, len(migrations)),
+		Status:            StatusClean,
+		Revision:          currentSchema.Revision,
+		Environment:       currentSchema.Environment,
+	}
+	var stamped []string
+
+	for _, m := range migrations {
+		schema.AppliedMigrations[m.ID] = true
+		schema.MigrationHistory = append(schema.MigrationHistory, MigrationRecord{
+			ID:           m.ID,
+			Type:         RecordStamp,
+			Description:  fmt.Sprintf("%s (%s)", m.Description, note),
+			AppliedAt:    now,
+			DurationText: "0s",
+			Success:      true,
+		})
+		stamped = append(stamped, m.ID)
+		schema.CurrentVersion = m.Version
+		schema.LastMigrationAt = now
+	}
+
+	if err := s.SetSchemaVersion(schema); err != nil {
+		return nil, err
+	}
+
+	return stamped, nil
+}
+
+// ParseAppliedIDs reads applied migration IDs, one per line, e.g. for
+// InitializeFromAppliedList. Blank lines and lines starting with '#' are
+// ignored, as is anything after the ID on a line, e.g. a comment.
+func ParseAppliedIDs(r io.Reader) ([]string, error) {
+	var ids []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		ids = append(ids, fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read migration IDs: %w", err)
+	}
+	return ids, nil
+}
+
+// ParseAppliedVersions reads applied migration versions, one per line. Blank lines
+// and lines starting with '#' are ignored. Lines may also be rows exported from
+// golang-migrate's schema_migrations table ("version,dirty" or "version dirty"),
+// in which case a header row is skipped and dirty rows are rejected.
+func ParseAppliedVersions(r io.Reader) ([]int64, error) {
+	var versions []int64
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == '|' || r == ' ' || r == '\t'
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		if len(versions) == 0 && strings.EqualFold(fields[0], "version") {
+			continue // Header row
+		}
+
+		version, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid version %q", lineNum, fields[0])
+		}
+		if len(fields) > 1 {
+			switch strings.ToLower(fields[1]) {
+			case "true", "t", "1":
+				return nil, fmt.Errorf("line %d: version %d is marked dirty", lineNum, version)
+			}
+		}
+
+		versions = append(versions, version)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read versions: %w", err)
+	}
+
+	return versions, nil
+}
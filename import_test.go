@@ -0,0 +1,163 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestImportGolangMigrateState(t *testing.T) {
+	setup := func(t *testing.T) (*SchemaManager, *MigrationRegistry) {
+		db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		registry := NewMigrationRegistry()
+		for _, id := range []string{"1754917200_first", "1754917300_second", "1754917400_third"} {
+			registry.Register(&Migration{
+				ID:   id,
+				Up:   func(db *pebble.DB) error { return nil },
+				Down: func(db *pebble.DB) error { return nil },
+			})
+		}
+
+		return NewSchemaManager(db), registry
+	}
+
+	t.Run("UpToVersion", func(t *testing.T) {
+		schemaManager, registry := setup(t)
+
+		imported, err := schemaManager.ImportGolangMigrateState(registry, 1754917300, false, ImportOptions{})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if len(imported) != 2 {
+			t.Fatalf("Expected 2 imported migrations, got %v", imported)
+		}
+
+		schema, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get schema version: %v", err)
+		}
+		if schema.CurrentVersion != 1754917300 {
+			t.Errorf("Expected version 1754917300, got %d", schema.CurrentVersion)
+		}
+		if schema.AppliedMigrations["1754917400_third"] {
+			t.Errorf("Expected third migration to stay pending")
+		}
+		if err := schemaManager.ValidateSchemaState(); err != nil {
+			t.Errorf("Imported state failed validation: %v", err)
+		}
+
+		pending, err := registry.GetPendingMigrations(schema.AppliedMigrations)
+		if err != nil || len(pending) != 1 {
+			t.Errorf("Expected 1 pending migration, got %d (err: %v)", len(pending), err)
+		}
+	})
+
+	t.Run("DirtyRefused", func(t *testing.T) {
+		schemaManager, registry := setup(t)
+		if _, err := schemaManager.ImportGolangMigrateState(registry, 1754917300, true, ImportOptions{}); err == nil {
+			t.Fatal("Expected dirty state to be refused")
+		}
+	})
+
+	t.Run("UnknownVersion", func(t *testing.T) {
+		schemaManager, registry := setup(t)
+		if _, err := schemaManager.ImportGolangMigrateState(registry, 1754917250, false, ImportOptions{}); err == nil {
+			t.Fatal("Expected unknown version to be refused")
+		}
+		if _, err := schemaManager.ImportAppliedVersions(registry, []int64{1754917200, 42}, ImportOptions{}); err == nil {
+			t.Fatal("Expected unknown version in list to be refused")
+		}
+	})
+
+	t.Run("ExistingStateNeedsForce", func(t *testing.T) {
+		schemaManager, registry := setup(t)
+		if _, err := schemaManager.ImportAppliedVersions(registry, []int64{1754917200}, ImportOptions{}); err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if _, err := schemaManager.ImportAppliedVersions(registry, []int64{1754917300}, ImportOptions{}); err == nil {
+			t.Fatal("Expected import over existing state to be refused")
+		}
+		imported, err := schemaManager.ImportAppliedVersions(registry, []int64{1754917300}, ImportOptions{Force: true})
+		if err != nil || len(imported) != 1 || imported[0] != "1754917300_second" {
+			t.Fatalf("Expected forced import of second migration, got %v (err: %v)", imported, err)
+		}
+	})
+}
+
+func TestParseAppliedVersions(t *testing.T) {
+	versions, err := ParseAppliedVersions(strings.NewReader("# exported\nversion,dirty\n1754917200,false\n\n1754917300 f\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(versions) != 2 || versions[0] != 1754917200 || versions[1] != 1754917300 {
+		t.Errorf("Unexpected versions: %v", versions)
+	}
+
+	if _, err := ParseAppliedVersions(strings.NewReader("1754917200,true\n")); err == nil {
+		t.Error("Expected dirty row to be refused")
+	}
+	if _, err := ParseAppliedVersions(strings.NewReader("abc\n")); err == nil {
+		t.Error("Expected invalid version to be refused")
+	}
+}
+
+func TestInitializeFromAppliedList(t *testing.T) {
+	db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	noop := func(db *pebble.DB) error { return nil }
+	registry := NewMigrationRegistry()
+	registry.Register(&Migration{ID: "1754917200_first", Up: noop, Down: noop})
+	registry.Register(&Migration{ID: "1754917300_second", Up: noop, Down: noop, Dependencies: []string{"1754917200_first"}})
+	registry.Register(&Migration{ID: "1754917400_third", Up: noop, Down: noop})
+	if err := registry.RegisterAlias("1754917400_old_third", "1754917400_third"); err != nil {
+		t.Fatalf("Failed to register alias: %v", err)
+	}
+	schemaManager := NewSchemaManager(db)
+
+	if _, err := schemaManager.InitializeFromAppliedList(registry, []string{"1754917200_first", "1754917250_missing"}, ImportOptions{}); err == nil {
+		t.Error("Expected an unknown ID to be refused")
+	}
+	if _, err := schemaManager.InitializeFromAppliedList(registry, []string{"1754917300_second"}, ImportOptions{}); err == nil {
+		t.Error("Expected a listed migration without its dependency to be refused")
+	}
+
+	// Unlisted migrations stay pending, whatever their version
+	ids, err := ParseAppliedIDs(strings.NewReader("# applied by hand\n1754917400_old_third\n\n1754917200_first  2024-01-05\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	seeded, err := schemaManager.InitializeFromAppliedList(registry, ids, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+	if len(seeded) != 2 || seeded[0] != "1754917200_first" || seeded[1] != "1754917400_third" {
+		t.Fatalf("Expected first and third to be seeded in order, got %v", seeded)
+	}
+	schema, err := schemaManager.GetSchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to get schema version: %v", err)
+	}
+	if schema.CurrentVersion != 1754917400 || schema.AppliedMigrations["1754917300_second"] {
+		t.Errorf("Unexpected seeded state: version %d, applied %v", schema.CurrentVersion, schema.AppliedMigrations)
+	}
+	if len(schema.MigrationHistory) != 2 || !strings.HasSuffix(schema.MigrationHistory[0].Description, "(seeded from applied list)") {
+		t.Errorf("Expected stamp records for the seeded migrations, got %v", schema.MigrationHistory)
+	}
+
+	if _, err := schemaManager.InitializeFromAppliedList(registry, []string{"1754917200_first"}, ImportOptions{}); err == nil {
+		t.Error("Expected seeding over existing state to be refused")
+	}
+	if _, err := schemaManager.InitializeFromAppliedList(registry, []string{"1754917200_first"}, ImportOptions{Force: true}); err != nil {
+		t.Errorf("Expected forced seed to succeed, got %v", err)
+	}
+}
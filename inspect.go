@@ -0,0 +1,156 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// SchemaStateInfo describes the stored schema state for debugging. It is filled
+// in as far as possible even if the state does not decode.
+type SchemaStateInfo struct {
+	Key      string         // Key the schema state is stored under
+	Exists   bool           // Whether the key exists
+	Raw      []byte         // Stored value, as is
+	Encoding SchemaEncoding // Encoding of the stored value
+	Legacy   bool           // Whether the value uses the format with inline history
+	Chunks   int            // Number of keys the value is split across, 0 if it is not, see SetSchemaChunkSize
+
+	Version     *SchemaVersion // Decoded state without history records, nil if DecodeError is set
+	DecodeError error          // Why the value does not decode, wraps ErrCorruptSchemaState
+
+	HistoryRecords int      // Number of history records stored under their own keys
+	HistoryBytes   int64    // Total size of these records
+	CorruptHistory []string // Keys of history records that do not decode
+}
+
+// InspectSchemaState reads the stored schema state and its history records without
+// failing on corrupt values, for diagnosing broken or oversized state.
+func (s *SchemaManager) InspectSchemaState() (*SchemaStateInfo, error) {
+	info := &SchemaStateInfo{Key: s.schemaKey}
+
+	data, chunks, err := s.readSchemaData()
+	if errors.Is(err, ErrCorruptSchemaState) {
+		info.Exists = true
+		info.DecodeError = err
+	} else if err != nil && err != pebble.ErrNotFound {
+		return nil, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if err == nil {
+		info.Exists = true
+		info.Raw = data
+		info.Chunks = chunks
+
+		info.Encoding = SchemaEncodingJSON
+		if strings.HasPrefix(string(info.Raw), protoSchemaHeader) {
+			info.Encoding = SchemaEncodingProto
+		}
+		if stored, err := decodeStoredSchema(info.Raw); err == nil {
+			info.Legacy = stored.AppliedMigrations != nil || stored.MigrationHistory != nil
+		}
+		info.Version, info.DecodeError = decodeSchemaVersion(info.Raw)
+	}
+
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: s.historyPrefix(),
+		UpperBound: prefixUpperBound(s.historyPrefix()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	defer iter.Close()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		info.HistoryRecords++
+		info.HistoryBytes += int64(len(iter.Value()))
+		if err := json.Unmarshal(iter.Value(), &MigrationRecord{}); err != nil {
+			info.CorruptHistory = append(info.CorruptHistory, string(iter.Key()))
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	return info, nil
+}
+
+// ListKeys returns up to limit key/value pairs under prefix in key order, and
+// whether more keys follow. Internal migration keys are skipped. A limit of 0
+// returns every key.
+func (s *SchemaManager) ListKeys(prefix []byte, limit int) ([]SampledKey, bool, error) {
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixUpperBound(prefix),
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read keys: %w", err)
+	}
+	defer iter.Close()
+
+	var keys []SampledKey
+	for iter.First(); iter.Valid(); iter.Next() {
+		if s.IsReservedKey(iter.Key()) {
+			continue
+		}
+		if limit > 0 && len(keys) == limit {
+			return keys, true, nil
+		}
+		keys = append(keys, SampledKey{
+			Key:   append([]byte(nil), iter.Key()...),
+			Value: append([]byte(nil), iter.Value()...),
+		})
+	}
+	if err := iter.Error(); err != nil {
+		return nil, false, fmt.Errorf("failed to read keys: %w", err)
+	}
+	return keys, false, nil
+}
+
+// PrefixStats summarizes the keys under a prefix
+type PrefixStats struct {
+	Keys       int64 // Number of keys, without the internal migration keys
+	KeyBytes   int64 // Total size of the keys
+	ValueBytes int64 // Total size of the values
+}
+
+// StatPrefix counts the keys under prefix and their sizes in one scan. Internal
+// migration keys are skipped.
+func (s *SchemaManager) StatPrefix(prefix []byte) (*PrefixStats, error) {
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixUpperBound(prefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys: %w", err)
+	}
+	defer iter.Close()
+
+	stats := &PrefixStats{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		if s.IsReservedKey(iter.Key()) {
+			continue
+		}
+		stats.Keys++
+		stats.KeyBytes += int64(len(iter.Key()))
+		stats.ValueBytes += int64(len(iter.Value()))
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to read keys: %w", err)
+	}
+	return stats, nil
+}
+
+// GetKey returns a copy of the value of key and whether the key exists
+func (s *SchemaManager) GetKey(key []byte) ([]byte, bool, error) {
+	value, err := getCopy(s.db, key)
+	if err == pebble.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get %q: %w", key, err)
+	}
+	return value, true, nil
+}
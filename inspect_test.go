@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestInspectSchemaState(t *testing.T) {
+	setup := func(t *testing.T) (*pebble.DB, *SchemaManager) {
+		db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db, NewSchemaManager(db)
+	}
+
+	t.Run("Missing", func(t *testing.T) {
+		_, schemaManager := setup(t)
+
+		info, err := schemaManager.InspectSchemaState()
+		if err != nil {
+			t.Fatalf("Failed to inspect: %v", err)
+		}
+		if info.Exists || info.Version != nil || info.DecodeError != nil {
+			t.Errorf("Expected a missing key without diagnostics, got %+v", info)
+		}
+	})
+
+	t.Run("Healthy", func(t *testing.T) {
+		_, schemaManager := setup(t)
+		schemaManager.SetEncoding(SchemaEncodingProto)
+		schemaManager.UpdateSchemaAfterMigration("1754917200_step", 1754917200, "Step", time.Second)
+		schemaManager.UpdateSchemaAfterMigration("1754917300_step", 1754917300, "Step", time.Second)
+
+		info, err := schemaManager.InspectSchemaState()
+		if err != nil {
+			t.Fatalf("Failed to inspect: %v", err)
+		}
+		if !info.Exists || info.Encoding != SchemaEncodingProto || info.Legacy || info.DecodeError != nil {
+			t.Fatalf("Unexpected info: %+v", info)
+		}
+		if info.Version.Revision != 2 || len(info.Version.AppliedMigrations) != 2 {
+			t.Errorf("Expected revision 2 with 2 applied migrations, got %+v", info.Version)
+		}
+		if info.HistoryRecords != 2 || info.HistoryBytes == 0 || len(info.CorruptHistory) != 0 {
+			t.Errorf("Expected 2 healthy history records, got %d (%d bytes, corrupt %v)",
+				info.HistoryRecords, info.HistoryBytes, info.CorruptHistory)
+		}
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		db, schemaManager := setup(t)
+		schemaManager.UpdateSchemaAfterMigration("1754917200_step", 1754917200, "Step", time.Second)
+
+		db.Set([]byte(SchemaVersionKey), []byte(`{"current_version":1754917200,"status":"exploded"}`), pebble.Sync)
+		badKey := schemaManager.historyKey(1)
+		db.Set(badKey, []byte(`{"id":`), pebble.Sync)
+
+		info, err := schemaManager.InspectSchemaState()
+		if err != nil {
+			t.Fatalf("Expected corrupt state to be inspected, got %v", err)
+		}
+		if string(info.Raw) != `{"current_version":1754917200,"status":"exploded"}` {
+			t.Errorf("Expected the raw value, got %q", info.Raw)
+		}
+		if info.Version != nil || !errors.Is(info.DecodeError, ErrCorruptSchemaState) {
+			t.Errorf("Expected a decode error wrapping ErrCorruptSchemaState, got %v", info.DecodeError)
+		}
+		if info.HistoryRecords != 2 || len(info.CorruptHistory) != 1 || info.CorruptHistory[0] != string(badKey) {
+			t.Errorf("Expected 1 of 2 history records to be corrupt, got %d, %v", info.HistoryRecords, info.CorruptHistory)
+		}
+	})
+
+	t.Run("Legacy", func(t *testing.T) {
+		db, schemaManager := setup(t)
+		db.Set([]byte(SchemaVersionKey), []byte(`{"current_version":0,"applied_migrations":{},"migration_history":[],"status":"clean"}`), pebble.Sync)
+
+		info, err := schemaManager.InspectSchemaState()
+		if err != nil {
+			t.Fatalf("Failed to inspect: %v", err)
+		}
+		if !info.Legacy || info.Encoding != SchemaEncodingJSON {
+			t.Errorf("Expected a legacy JSON value, got %+v", info)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Step is an internal phase of the engine executing a plan
+type Step string
+
+const (
+	// StepBackup takes the backup before a plan; it has no migration
+	StepBackup Step = "backup"
+
+	// StepMarkStarted marks the schema as migrating before a migration runs.
+	// Before a wave of parallel migrations it has no migration.
+	StepMarkStarted Step = "mark_started"
+
+	// StepExecute runs the Up or Down function of a migration, or the automatic
+	// rollback of a migration without Down
+	StepExecute Step = "execute"
+
+	// StepValidate runs the Validate function of a migration, if it has one
+	StepValidate Step = "validate"
+
+	// StepRecord records a migration as applied or rolled back in the schema state
+	StepRecord Step = "record"
+)
+
+// StepEvent is a step of the engine reached by a StepInterceptor
+type StepEvent struct {
+	Step        Step
+	After       bool   // Whether the step has run
+	MigrationID string // Empty for the backup and for marking a wave as started
+	Direction   string // "up" or "down", empty for the backup
+	Err         error  // Error of the step, once it has run
+}
+
+// String describes the event, e.g. "before execute 1754917200_users up"
+func (e StepEvent) String() string {
+	s := "before " + string(e.Step)
+	if e.After {
+		s = "after " + string(e.Step)
+	}
+	if e.MigrationID != "" {
+		s += " " + e.MigrationID
+	}
+	if e.Direction != "" {
+		s += " " + e.Direction
+	}
+	if e.After && e.Err != nil {
+		s += fmt.Sprintf(" (%v)", e.Err)
+	}
+	return s
+}
+
+// StepInterceptor is called by the engine before and after each step of a plan,
+// to assert the order of the steps or to change their outcome. Returning an
+// error before a step fails it without running it; returning an error after a
+// step that succeeded fails it as if the step had failed. As with a FaultInjector,
+// errors wrapping ErrSimulatedCrash make the engine stop immediately without
+// recording the failure, e.g. to leave the schema marked as migrating after
+// StepMarkStarted.
+//
+// With parallelism, the interceptor is called concurrently for the migrations of
+// a wave. It is not called in dry runs.
+type StepInterceptor func(event StepEvent) error
+
+// StepRecorder is a StepInterceptor recording the events it is called with, e.g.
+// to assert the order of the steps in tests
+type StepRecorder struct {
+	mu     sync.Mutex
+	events []StepEvent
+}
+
+// Intercept records event; pass it to MigrationEngine.SetStepInterceptor
+func (r *StepRecorder) Intercept(event StepEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+// Events returns the recorded events in the order they occurred
+func (r *StepRecorder) Events() []StepEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]StepEvent(nil), r.events...)
+}
+
+// Steps returns the recorded events as strings, see StepEvent.String
+func (r *StepRecorder) Steps() []string {
+	events := r.Events()
+	steps := make([]string, len(events))
+	for i, event := range events {
+		steps[i] = event.String()
+	}
+	return steps
+}
@@ -0,0 +1,169 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestStepInterceptor(t *testing.T) {
+	setup := func(t *testing.T, registry *MigrationRegistry) (*pebble.DB, string, *SchemaManager, *MigrationEngine) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupEnabled(false)
+		return db, dbPath, schemaManager, engine
+	}
+
+	newRegistry := func(t *testing.T, calls map[string]int, ids ...string) *MigrationRegistry {
+		registry := NewMigrationRegistry()
+		for i, id := range ids {
+			id := id
+			migration := &Migration{
+				ID: id,
+				Up: func(db *pebble.DB) error {
+					calls[id]++
+					return db.Set([]byte("data:"+id), []byte("x"), pebble.Sync)
+				},
+				Down: func(db *pebble.DB) error {
+					return db.Delete([]byte("data:"+id), pebble.Sync)
+				},
+				Rerunnable: true,
+			}
+			if i == 0 {
+				migration.Validate = func(db *pebble.DB) error { return nil }
+			}
+			if err := registry.Register(migration); err != nil {
+				t.Fatalf("Failed to register %s: %v", id, err)
+			}
+		}
+		return registry
+	}
+
+	t.Run("StepOrder", func(t *testing.T) {
+		registry := newRegistry(t, map[string]int{}, "1754917200_first", "1754917300_second")
+		_, _, schemaManager, engine := setup(t, registry)
+		engine.SetBackupEnabled(true)
+		recorder := &StepRecorder{}
+		engine.SetStepInterceptor(recorder.Intercept)
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to upgrade: %v", err)
+		}
+		expected := []string{
+			"before backup", "after backup",
+			"before mark_started 1754917200_first up", "after mark_started 1754917200_first up",
+			"before execute 1754917200_first up", "after execute 1754917200_first up",
+			"before validate 1754917200_first up", "after validate 1754917200_first up",
+			"before record 1754917200_first up", "after record 1754917200_first up",
+			"before mark_started 1754917300_second up", "after mark_started 1754917300_second up",
+			"before execute 1754917300_second up", "after execute 1754917300_second up",
+			"before record 1754917300_second up", "after record 1754917300_second up",
+		}
+		if steps := recorder.Steps(); !reflect.DeepEqual(steps, expected) {
+			t.Errorf("Unexpected steps:\n%v\nwant:\n%v", steps, expected)
+		}
+
+		recorder = &StepRecorder{}
+		engine.SetStepInterceptor(recorder.Intercept)
+		engine.SetBackupEnabled(false)
+		plan, _ = NewMigrationPlanner(registry, schemaManager).PlanDowngrade(0)
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to downgrade: %v", err)
+		}
+		if steps := recorder.Steps(); len(steps) != 14 || steps[0] != "before mark_started 1754917300_second down" {
+			t.Errorf("Unexpected downgrade steps: %v", steps)
+		}
+	})
+
+	t.Run("FailBeforeStep", func(t *testing.T) {
+		calls := make(map[string]int)
+		registry := newRegistry(t, calls, "1754917200_first", "1754917300_second")
+		_, _, schemaManager, engine := setup(t, registry)
+		engine.SetStepInterceptor(func(event StepEvent) error {
+			if event.Step == StepValidate && !event.After {
+				return fmt.Errorf("%w: validation refused", ErrInjectedFault)
+			}
+			return nil
+		})
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); !errors.Is(err, ErrInjectedFault) {
+			t.Fatalf("Expected injected fault, got %v", err)
+		}
+		schema, _ := schemaManager.GetSchemaVersion()
+		if schema.Status != StatusDirty || len(schema.AppliedMigrations) != 0 {
+			t.Errorf("Expected a dirty schema without applied migrations, got %s %v", schema.Status, schema.AppliedMigrations)
+		}
+		if calls["1754917200_first"] != 1 || calls["1754917300_second"] != 0 {
+			t.Errorf("Expected only the first migration to run, got %v", calls)
+		}
+	})
+
+	t.Run("FailAfterStep", func(t *testing.T) {
+		registry := newRegistry(t, map[string]int{}, "1754917200_first")
+		_, _, schemaManager, engine := setup(t, registry)
+		var seen error
+		engine.SetStepInterceptor(func(event StepEvent) error {
+			if event.Step == StepRecord && event.After {
+				seen = event.Err
+				return ErrInjectedFault
+			}
+			return nil
+		})
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); !errors.Is(err, ErrInjectedFault) {
+			t.Fatalf("Expected injected fault, got %v", err)
+		}
+		if seen != nil {
+			t.Errorf("Expected the record step to succeed, got %v", seen)
+		}
+	})
+
+	t.Run("CrashAfterMarkStartedRecovers", func(t *testing.T) {
+		originalRegistry := GlobalRegistry
+		defer func() { GlobalRegistry = originalRegistry }()
+
+		calls := make(map[string]int)
+		GlobalRegistry = newRegistry(t, calls, "1754917200_first")
+		db, dbPath, schemaManager, engine := setup(t, GlobalRegistry)
+		engine.SetStepInterceptor(func(event StepEvent) error {
+			if event.Step == StepMarkStarted && event.After {
+				return ErrSimulatedCrash
+			}
+			return nil
+		})
+
+		plan, _ := NewMigrationPlanner(GlobalRegistry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); !errors.Is(err, ErrSimulatedCrash) {
+			t.Fatalf("Expected simulated crash, got %v", err)
+		}
+		schema, _ := schemaManager.GetSchemaVersion()
+		if schema.Status != StatusMigrating || calls["1754917200_first"] != 0 {
+			t.Fatalf("Expected the schema stuck migrating before the migration ran, got %s %v", schema.Status, calls)
+		}
+
+		opts := DefaultStartupOptions()
+		opts.RunMigrations = true
+		opts.BackupEnabled = false
+		if err := CheckAndRunStartupMigrations(db, dbPath, opts); err != nil {
+			t.Fatalf("Failed to recover: %v", err)
+		}
+		schema, _ = schemaManager.GetSchemaVersion()
+		if schema.Status != StatusClean || !schema.AppliedMigrations["1754917200_first"] {
+			t.Errorf("Expected the migration applied after recovery, got %s %v", schema.Status, schema.AppliedMigrations)
+		}
+	})
+}
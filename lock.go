@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultLockFile is the conventional name of the lock file committed next to the migrations
+const DefaultLockFile = "migrations.lock"
+
+// lockFileHeader is written at the top of every lock file
+const lockFileHeader = "# pebble-migrate lock file: migration IDs and checksums expected in this release.\n# Regenerate with `pebble-migrate lock` after adding or changing migrations.\n"
+
+// Checksum returns a digest of the migration's ID, description and dependencies,
+// plus the steps of script migrations. The code of Go migrations cannot be hashed,
+// so for them the checksum pins the declared metadata only.
+func (m *Migration) Checksum() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", m.ID, m.Description, strings.Join(m.Dependencies, ","))
+	h.Write(m.checksumSource)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// LockEntry pins a single migration in a lock file
+type LockEntry struct {
+	ID       string
+	Checksum string
+}
+
+// LockFile lists the migrations a release is expected to contain. Committing it
+// lets `up` detect binaries built from a different set of migrations, for example
+// after a partial rebuild, before anything is applied.
+type LockFile struct {
+	Entries []LockEntry
+}
+
+// NewLockFile creates a lock file pinning every migration in the registry
+func NewLockFile(registry *MigrationRegistry) *LockFile {
+	lock := &LockFile{}
+	for _, m := range registry.GetMigrations() {
+		lock.Entries = append(lock.Entries, LockEntry{ID: m.ID, Checksum: m.Checksum()})
+	}
+	return lock
+}
+
+// WriteLockFile writes a lock file, one "<id> <checksum>" line per migration
+func WriteLockFile(path string, lock *LockFile) error {
+	var buf bytes.Buffer
+	buf.WriteString(lockFileHeader)
+	for _, entry := range lock.Entries {
+		fmt.Fprintf(&buf, "%s %s\n", entry.ID, entry.Checksum)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return nil
+}
+
+// ReadLockFile reads a lock file written by WriteLockFile
+func ReadLockFile(path string) (*LockFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	lock := &LockFile{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: %s line %d: expected \"<id> <checksum>\"", ErrInvalidLockFile, path, lineNum)
+		}
+		lock.Entries = append(lock.Entries, LockEntry{ID: fields[0], Checksum: fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	return lock, nil
+}
+
+// Verify checks that the registry contains exactly the locked migrations with the
+// locked checksums, returning ErrLockMismatch with every difference otherwise
+func (l *LockFile) Verify(registry *MigrationRegistry) error {
+	var problems []string
+	locked := make(map[string]bool)
+	for _, entry := range l.Entries {
+		locked[entry.ID] = true
+		m, ok := registry.GetMigration(entry.ID)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is locked but not registered", entry.ID))
+			continue
+		}
+		if checksum := m.Checksum(); checksum != entry.Checksum {
+			problems = append(problems, fmt.Sprintf("%s has checksum %s, locked %s", entry.ID, shortChecksum(checksum), shortChecksum(entry.Checksum)))
+		}
+	}
+	for _, m := range registry.GetMigrations() {
+		if !locked[m.ID] {
+			problems = append(problems, fmt.Sprintf("%s is registered but not locked", m.ID))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrLockMismatch, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// shortChecksum abbreviates a checksum for error messages
+func shortChecksum(checksum string) string {
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
+
+// SetLockFile makes upgrade planning verify the registry against a lock file first
+// (see LockFile.Verify). Pass nil to disable the check.
+func (p *MigrationPlanner) SetLockFile(lock *LockFile) {
+	p.lockFile = lock
+}
+
+// verifyLock checks the registry against the lock file, if one is set
+func (p *MigrationPlanner) verifyLock() error {
+	if p.lockFile == nil {
+		return nil
+	}
+	return p.lockFile.Verify(p.registry)
+}
@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestLockFile(t *testing.T) {
+	noop := func(db *pebble.DB) error { return nil }
+
+	newRegistry := func(t *testing.T, migrations ...*Migration) *MigrationRegistry {
+		registry := NewMigrationRegistry()
+		for _, m := range migrations {
+			if err := registry.Register(m); err != nil {
+				t.Fatalf("Failed to register %s: %v", m.ID, err)
+			}
+		}
+		return registry
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		registry := newRegistry(t,
+			&Migration{ID: "1754917200_users", Description: "Users", Up: noop, Down: noop},
+			&Migration{ID: "1754917300_orders", Dependencies: []string{"1754917200_users"}, Up: noop, Down: noop},
+		)
+
+		path := filepath.Join(t.TempDir(), DefaultLockFile)
+		if err := WriteLockFile(path, NewLockFile(registry)); err != nil {
+			t.Fatalf("Failed to write lock file: %v", err)
+		}
+		lock, err := ReadLockFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read lock file: %v", err)
+		}
+		if len(lock.Entries) != 2 || lock.Entries[0].ID != "1754917200_users" {
+			t.Fatalf("Unexpected entries: %+v", lock.Entries)
+		}
+		if err := lock.Verify(registry); err != nil {
+			t.Errorf("Expected registry to match its lock file: %v", err)
+		}
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		lock := NewLockFile(newRegistry(t,
+			&Migration{ID: "1754917200_users", Up: noop, Down: noop},
+			&Migration{ID: "1754917300_orders", Up: noop, Down: noop},
+		))
+
+		registry := newRegistry(t,
+			&Migration{ID: "1754917200_users", Description: "Changed", Up: noop, Down: noop},
+			&Migration{ID: "1754917400_items", Up: noop, Down: noop},
+		)
+		err := lock.Verify(registry)
+		if !errors.Is(err, ErrLockMismatch) {
+			t.Fatalf("Expected ErrLockMismatch, got %v", err)
+		}
+		for _, expected := range []string{
+			"1754917200_users has checksum",
+			"1754917300_orders is locked but not registered",
+			"1754917400_items is registered but not locked",
+		} {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected error to mention %q: %v", expected, err)
+			}
+		}
+	})
+
+	t.Run("ScriptStepsChangeChecksum", func(t *testing.T) {
+		load := func(t *testing.T, value string) *Migration {
+			script := &ScriptMigration{
+				ID: "1754917200_mode",
+				Up: []ScriptOp{{Op: ScriptOpSet, Values: map[string]string{"config:mode": value}}},
+			}
+			m, err := script.Migration()
+			if err != nil {
+				t.Fatalf("Failed to convert script: %v", err)
+			}
+			return m
+		}
+
+		if load(t, "strict").Checksum() == load(t, "lenient").Checksum() {
+			t.Error("Expected different script steps to change the checksum")
+		}
+		if load(t, "strict").Checksum() != load(t, "strict").Checksum() {
+			t.Error("Expected the checksum to be stable")
+		}
+	})
+
+	t.Run("PlannerVerifiesLock", func(t *testing.T) {
+		registry := newRegistry(t, &Migration{ID: "1754917200_users", Up: noop, Down: noop})
+		lock := NewLockFile(registry)
+		registry.Register(&Migration{ID: "1754917300_unexpected", Up: noop, Down: noop})
+
+		db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		planner := NewMigrationPlanner(registry, NewSchemaManager(db))
+		planner.SetLockFile(lock)
+		if _, err := planner.PlanUpgrade(); !errors.Is(err, ErrLockMismatch) {
+			t.Errorf("Expected PlanUpgrade to fail with ErrLockMismatch, got %v", err)
+		}
+		if _, err := planner.PlanUpgradeTo(1754917300); !errors.Is(err, ErrLockMismatch) {
+			t.Errorf("Expected PlanUpgradeTo to fail with ErrLockMismatch, got %v", err)
+		}
+	})
+
+	t.Run("InvalidFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), DefaultLockFile)
+		os.WriteFile(path, []byte("# header\n1754917200_users\n"), 0644)
+		if _, err := ReadLockFile(path); !errors.Is(err, ErrInvalidLockFile) {
+			t.Errorf("Expected ErrInvalidLockFile, got %v", err)
+		}
+	})
+}
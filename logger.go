@@ -38,11 +38,19 @@ func (l *DefaultLogger) Debugf(format string, args ...interface{}) {
 	}
 }
 
+// Warnf logs a formatted message at warning level, see WarningLogger.
+func (l *DefaultLogger) Warnf(format string, args ...interface{}) {
+	fmt.Printf("Warning: "+format+"\n", args...)
+}
+
 // Errorf logs a formatted message at error level.
 func (l *DefaultLogger) Errorf(format string, args ...interface{}) {
 	fmt.Printf("[ERROR] "+format+"\n", args...)
 }
 
+// defaultLogger is used by the engine and backup manager without a logger
+var defaultLogger Logger = NewDefaultLogger(false)
+
 // NopLogger is a no-operation logger that discards all messages.
 // Useful for testing or when logging should be completely disabled.
 type NopLogger struct{}
@@ -53,5 +61,8 @@ func (l *NopLogger) Printf(format string, args ...interface{}) {}
 // Debugf does nothing.
 func (l *NopLogger) Debugf(format string, args ...interface{}) {}
 
+// Warnf does nothing.
+func (l *NopLogger) Warnf(format string, args ...interface{}) {}
+
 // Errorf does nothing.
 func (l *NopLogger) Errorf(format string, args ...interface{}) {}
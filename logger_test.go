@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// recordingLogger keeps the logged messages by level
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) record(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Printf(format string, args ...interface{}) {
+	l.record("INFO", format, args...)
+}
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.record("DEBUG", format, args...)
+}
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.record("ERROR", format, args...)
+}
+
+func (l *recordingLogger) contains(substr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, message := range l.messages {
+		if strings.Contains(message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEngineLogger(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	registry.Register(&Migration{
+		ID: "1754917200_logged",
+		UpContext: func(ctx *MigrationContext) error {
+			ctx.Logger.Printf("from the migration")
+			return nil
+		},
+		Down: func(db *pebble.DB) error { return nil },
+	})
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	logger := &recordingLogger{}
+	engine.SetLogger(logger)
+
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+
+	for _, expected := range []string{
+		"INFO Creating compressed backup",
+		"INFO Backup created successfully",
+		"DEBUG Executing up migration for 1754917200_logged",
+		"INFO from the migration",
+	} {
+		if !logger.contains(expected) {
+			t.Errorf("Expected %q to be logged, got %q", expected, logger.messages)
+		}
+	}
+
+	t.Run("VerboseLogsAtInfoLevel", func(t *testing.T) {
+		engine.SetVerbose(true)
+		defer engine.SetVerbose(false)
+		plan, err := NewMigrationPlanner(registry, schemaManager).PlanDowngrade(0)
+		if err != nil {
+			t.Fatalf("Failed to plan: %v", err)
+		}
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to execute: %v", err)
+		}
+		if !logger.contains("INFO Executing down migration for 1754917200_logged") {
+			t.Errorf("Expected the verbose message at info level, got %q", logger.messages)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ManifestFileName is the default name of the file written by `gen manifest`
+const ManifestFileName = "registrations.go"
+
+// migratePackagePath is the import path migration files import this package by
+const migratePackagePath = "github.com/herenow/pebble-migrate"
+
+// ManifestEntry is a migration declared by a package-level variable of a
+// migrations package
+type ManifestEntry struct {
+	File string // Base name of the file declaring the migration
+	Var  string // Variable holding the migration
+	ID   string // Migration ID
+}
+
+// MigrationManifest lists the migrations of a migrations package, ordered by
+// file name, to register them explicitly instead of in init functions
+type MigrationManifest struct {
+	Package string
+	Entries []ManifestEntry
+}
+
+// ScanMigrationPackage parses the Go files of the migrations package in dir,
+// except test files and manifestFile, and collects the migrations declared as
+//
+//	var addUserIndexes = &migrate.Migration{ID: "1700000000_add_user_indexes", ...}
+//
+// It returns ErrManifestDrift listing every problem if a file named like a
+// migration declares none, a file declares more than one, a file name and the
+// ID it declares differ, an ID is not a string literal or declared twice, or a
+// file registers migrations itself with migrate.Register.
+func ScanMigrationPackage(dir, manifestFile string) (*MigrationManifest, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Go files in %s: %w", dir, err)
+	}
+
+	manifest := &MigrationManifest{}
+	var problems []string
+	declared := make(map[string]string) // ID -> file
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if strings.HasSuffix(name, "_test.go") || name == manifestFile {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if manifest.Package == "" {
+			manifest.Package = file.Name.Name
+		}
+
+		entries, fileProblems := scanMigrationFile(name, file)
+		problems = append(problems, fileProblems...)
+
+		_, prefixErr := parseVersionPrefix(strings.TrimSuffix(name, ".go"))
+		switch {
+		case len(entries) == 0 && prefixErr == nil:
+			problems = append(problems, fmt.Sprintf("%s declares no migration", name))
+		case len(entries) > 1:
+			problems = append(problems, fmt.Sprintf("%s declares %d migrations; declare one per file", name, len(entries)))
+		}
+		for _, entry := range entries {
+			if entry.ID+".go" != name {
+				problems = append(problems, fmt.Sprintf("%s declares migration %s; rename the file to %s.go", name, entry.ID, entry.ID))
+			}
+			if other, ok := declared[entry.ID]; ok {
+				problems = append(problems, fmt.Sprintf("%s is declared in %s and %s", entry.ID, other, name))
+			}
+			declared[entry.ID] = name
+		}
+		manifest.Entries = append(manifest.Entries, entries...)
+	}
+	if manifest.Package == "" {
+		return nil, fmt.Errorf("no Go files found in %s", dir)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrManifestDrift, strings.Join(problems, "; "))
+	}
+	return manifest, nil
+}
+
+// scanMigrationFile collects the migrations declared in a file and the problems
+// found in it
+func scanMigrationFile(name string, file *ast.File) ([]ManifestEntry, []string) {
+	alias := migrateImportName(file)
+	if alias == "" {
+		return nil, nil
+	}
+
+	var entries []ManifestEntry
+	var problems []string
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for i, value := range valueSpec.Values {
+				lit := migrationLiteral(value, alias)
+				if lit == nil || i >= len(valueSpec.Names) {
+					continue
+				}
+				varName := valueSpec.Names[i].Name
+				id, ok := literalMigrationID(lit)
+				if !ok {
+					problems = append(problems, fmt.Sprintf("%s: the ID of %s is not a string literal", name, varName))
+					continue
+				}
+				entries = append(entries, ManifestEntry{File: name, Var: varName, ID: id})
+			}
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Register" {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == alias {
+				problems = append(problems, fmt.Sprintf("%s calls %s.Register; declare the migration as a package-level variable instead", name, alias))
+			}
+		}
+		return true
+	})
+	return entries, problems
+}
+
+// migrateImportName returns the name a file imports this package by, or "" if
+// it does not import it or imports it for side effects only
+func migrateImportName(file *ast.File) string {
+	alias := ""
+	for _, imp := range file.Imports {
+		if path, _ := strconv.Unquote(imp.Path.Value); path == migratePackagePath {
+			alias = "migrate"
+			if imp.Name != nil {
+				alias = imp.Name.Name
+			}
+		}
+	}
+	if alias == "_" {
+		return ""
+	}
+	return alias
+}
+
+// migrationLiteral returns the composite literal of &<alias>.Migration{...}, or nil
+func migrationLiteral(expr ast.Expr, alias string) *ast.CompositeLit {
+	unary, ok := expr.(*ast.UnaryExpr)
+	if !ok || unary.Op != token.AND {
+		return nil
+	}
+	lit, ok := unary.X.(*ast.CompositeLit)
+	if !ok || !isMigrationType(lit, alias) {
+		return nil
+	}
+	return lit
+}
+
+// isMigrationType reports whether lit is a <alias>.Migration literal
+func isMigrationType(lit *ast.CompositeLit, alias string) bool {
+	sel, ok := lit.Type.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Migration" {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && x.Name == alias
+}
+
+// literalMigrationID returns the ID field of a Migration literal if it is a
+// string literal
+func literalMigrationID(lit *ast.CompositeLit) (string, bool) {
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := kv.Key.(*ast.Ident); !ok || key.Name != "ID" {
+			continue
+		}
+		value, ok := kv.Value.(*ast.BasicLit)
+		if !ok || value.Kind != token.STRING {
+			return "", false
+		}
+		id, err := strconv.Unquote(value.Value)
+		return id, err == nil
+	}
+	return "", false
+}
+
+// Source returns the formatted Go source of the manifest file. It declares
+// Migrations, returning the migrations of the package, and RegisterMigrations,
+// registering them into a registry.
+func (m *MigrationManifest) Source() ([]byte, error) {
+	entries := append([]ManifestEntry(nil), m.Entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].File < entries[j].File })
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by pebble-migrate gen manifest. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", m.Package)
+	fmt.Fprintf(&buf, "import migrate %q\n\n", migratePackagePath)
+	fmt.Fprintf(&buf, "// Migrations returns the migrations of this package, ordered by file name\n")
+	fmt.Fprintf(&buf, "func Migrations() []*migrate.Migration {\n\treturn []*migrate.Migration{\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "\t\t%s, // %s\n", entry.Var, entry.File)
+	}
+	fmt.Fprintf(&buf, "\t}\n}\n\n")
+	fmt.Fprintf(&buf, "// RegisterMigrations registers the migrations of this package into registry\n")
+	fmt.Fprintf(&buf, "func RegisterMigrations(registry *migrate.MigrationRegistry) error {\n")
+	fmt.Fprintf(&buf, "\tfor _, m := range Migrations() {\n")
+	fmt.Fprintf(&buf, "\t\tif err := registry.Register(m); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n")
+	fmt.Fprintf(&buf, "\treturn nil\n}\n")
+
+	return format.Source(buf.Bytes())
+}
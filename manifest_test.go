@@ -0,0 +1,124 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeManifestPackage writes Go files into a new directory
+func writeManifestPackage(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// manifestMigrationFile returns a migration file declaring id in a variable
+func manifestMigrationFile(varName, id string) string {
+	return `package migrations
+
+import pm "github.com/herenow/pebble-migrate"
+
+var ` + varName + ` = &pm.Migration{ID: "` + id + `", Description: "test"}
+`
+}
+
+func TestScanMigrationPackage(t *testing.T) {
+	t.Run("Manifest", func(t *testing.T) {
+		dir := writeManifestPackage(t, map[string]string{
+			"1700000100_second.go":     manifestMigrationFile("second", "1700000100_second"),
+			"1700000000_first.go":      manifestMigrationFile("first", "1700000000_first"),
+			"helpers.go":               "package migrations\n\nfunc helper() {}\n",
+			"1700000000_first_test.go": "package migrations\n",
+			ManifestFileName:           "package migrations\n\nthis is not parsed\n",
+		})
+
+		manifest, err := ScanMigrationPackage(dir, ManifestFileName)
+		if err != nil {
+			t.Fatalf("Failed to scan: %v", err)
+		}
+		if manifest.Package != "migrations" || len(manifest.Entries) != 2 {
+			t.Fatalf("Unexpected manifest: %+v", manifest)
+		}
+
+		source, err := manifest.Source()
+		if err != nil {
+			t.Fatalf("Failed to generate source: %v", err)
+		}
+		content := string(source)
+		first, second := strings.Index(content, "// 1700000000_first.go"), strings.Index(content, "// 1700000100_second.go")
+		if first < 0 || second < first {
+			t.Errorf("Expected the migrations ordered by file name:\n%s", content)
+		}
+		for _, want := range []string{"DO NOT EDIT", "package migrations", "func RegisterMigrations(registry *migrate.MigrationRegistry) error"} {
+			if !strings.Contains(content, want) {
+				t.Errorf("Expected %q in the manifest:\n%s", want, content)
+			}
+		}
+	})
+
+	drift := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "FileNameDiffers",
+			files: map[string]string{"1700000000_first.go": manifestMigrationFile("first", "1700000000_renamed")},
+			want:  "rename the file to 1700000000_renamed.go",
+		},
+		{
+			name:  "NoMigration",
+			files: map[string]string{"1700000000_first.go": "package migrations\n"},
+			want:  "1700000000_first.go declares no migration",
+		},
+		{
+			name: "TwoMigrations",
+			files: map[string]string{"1700000000_first.go": manifestMigrationFile("first", "1700000000_first") +
+				"\nvar other = &pm.Migration{ID: \"1700000000_first\"}\n"},
+			want: "declares 2 migrations",
+		},
+		{
+			name: "IDNotLiteral",
+			files: map[string]string{"1700000000_first.go": `package migrations
+
+import migrate "github.com/herenow/pebble-migrate"
+
+const id = "1700000000_first"
+
+var first = &migrate.Migration{ID: id}
+`},
+			want: "the ID of first is not a string literal",
+		},
+		{
+			name: "RegisteredInInit",
+			files: map[string]string{"1700000000_first.go": `package migrations
+
+import "github.com/herenow/pebble-migrate"
+
+func init() {
+	migrate.Register(&migrate.Migration{ID: "1700000000_first"})
+}
+`},
+			want: "calls migrate.Register",
+		},
+	}
+	for _, tc := range drift {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ScanMigrationPackage(writeManifestPackage(t, tc.files), ManifestFileName)
+			if !errors.Is(err, ErrManifestDrift) {
+				t.Fatalf("Expected ErrManifestDrift, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Expected %q in %q", tc.want, err)
+			}
+		})
+	}
+}
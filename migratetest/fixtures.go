@@ -0,0 +1,226 @@
+// Package migratetest provides helpers for testing migrations: opening scratch
+// databases, loading fixture data and comparing key ranges against golden files.
+package migratetest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// Entry is a single key/value pair in a fixture or golden file. Encoding is
+// empty for values stored as plain text, or "base64" / "hex" for binary values.
+type Entry struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// OpenDB opens a Pebble database in a temporary directory that is closed and
+// removed when the test finishes
+func OpenDB(t testing.TB) *pebble.DB {
+	t.Helper()
+
+	db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("migratetest: failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// LoadFixtures writes the fixture data at path into db. Path may be a file or a
+// directory, in which case every .json and .csv file in it is loaded in name order.
+//
+// JSON fixtures are either an object mapping keys to text values, or an array of
+// Entry objects (the golden file format). CSV fixtures have key,value[,encoding]
+// rows with an optional key,value header.
+func LoadFixtures(t testing.TB, db *pebble.DB, path string) {
+	t.Helper()
+
+	entries, err := ReadFixtures(path)
+	if err != nil {
+		t.Fatalf("migratetest: %v", err)
+	}
+	if err := writeEntries(db, entries); err != nil {
+		t.Fatalf("migratetest: failed to load fixtures from %s: %v", path, err)
+	}
+}
+
+// LoadMap writes text key/value pairs into db
+func LoadMap(t testing.TB, db *pebble.DB, data map[string]string) {
+	t.Helper()
+
+	entries := make([]Entry, 0, len(data))
+	for key, value := range data {
+		entries = append(entries, Entry{Key: key, Value: value})
+	}
+	if err := writeEntries(db, entries); err != nil {
+		t.Fatalf("migratetest: failed to load data: %v", err)
+	}
+}
+
+// ReadFixtures parses the fixture file or directory at path without writing it
+func ReadFixtures(path string) ([]Entry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat fixtures: %w", err)
+	}
+
+	if !info.IsDir() {
+		return readFixtureFile(path)
+	}
+
+	files, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture directory: %w", err)
+	}
+
+	var names []string
+	for _, f := range files {
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if !f.IsDir() && (ext == ".json" || ext == ".csv") {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var entries []Entry
+	for _, name := range names {
+		fileEntries, err := readFixtureFile(filepath.Join(path, name))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+
+	return entries, nil
+}
+
+// readFixtureFile parses a single .json or .csv fixture file
+func readFixtureFile(path string) ([]Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture %s: %w", path, err)
+	}
+
+	var entries []Entry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		entries, err = parseJSONFixture(data)
+	case ".csv":
+		entries, err = parseCSVFixture(data)
+	default:
+		return nil, fmt.Errorf("unsupported fixture format: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+
+	for _, e := range entries {
+		if _, err := decodeValue(e); err != nil {
+			return nil, fmt.Errorf("fixture %s key %q: %w", path, e.Key, err)
+		}
+	}
+
+	return entries, nil
+}
+
+// parseJSONFixture accepts an object of text values or an array of entries
+func parseJSONFixture(data []byte) ([]Entry, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []Entry
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(trimmed, &values); err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(values))
+	for key, value := range values {
+		entries = append(entries, Entry{Key: key, Value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// parseCSVFixture reads key,value[,encoding] rows
+func parseCSVFixture(data []byte) ([]Entry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	var entries []Entry
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && len(record) >= 2 && record[0] == "key" && record[1] == "value" {
+			continue // Header row
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("line %d: expected key,value[,encoding]", line)
+		}
+
+		entry := Entry{Key: record[0], Value: record[1]}
+		if len(record) == 3 {
+			entry.Encoding = record[2]
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// decodeValue returns the raw bytes of an entry's value
+func decodeValue(e Entry) ([]byte, error) {
+	switch e.Encoding {
+	case "":
+		return []byte(e.Value), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(e.Value)
+	case "hex":
+		return hex.DecodeString(e.Value)
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", e.Encoding)
+	}
+}
+
+// writeEntries writes entries to db in a single batch
+func writeEntries(db *pebble.DB, entries []Entry) error {
+	batch := db.NewBatch()
+	defer batch.Close()
+
+	for _, e := range entries {
+		value, err := decodeValue(e)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", e.Key, err)
+		}
+		if err := batch.Set([]byte(e.Key), value, nil); err != nil {
+			return err
+		}
+	}
+
+	return batch.Commit(pebble.Sync)
+}
@@ -0,0 +1,58 @@
+package migratetest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestFixturesAndGolden(t *testing.T) {
+	db := OpenDB(t)
+	LoadFixtures(t, db, filepath.Join("testdata", "fixtures"))
+
+	// Uppercase every user name
+	iter, err := db.NewIter(&pebble.IterOptions{LowerBound: []byte("user:"), UpperBound: []byte("user;")})
+	if err != nil {
+		t.Fatalf("Failed to create iterator: %v", err)
+	}
+	batch := db.NewBatch()
+	for iter.First(); iter.Valid(); iter.Next() {
+		batch.Set(append([]byte(nil), iter.Key()...), []byte(strings.ToUpper(string(iter.Value()))), nil)
+	}
+	iter.Close()
+	if err := batch.Commit(pebble.Sync); err != nil {
+		t.Fatalf("Failed to commit batch: %v", err)
+	}
+
+	AssertGolden(t, db, "", filepath.Join("testdata", "golden", "uppercase_users.json"))
+
+	entries := Snapshot(t, db, "blob:")
+	if len(entries) != 1 || entries[0].Encoding != "base64" || entries[0].Value != "AAEC" {
+		t.Errorf("Expected binary blob to be base64 encoded, got %+v", entries)
+	}
+
+	// Golden files can be loaded back as fixtures
+	other := OpenDB(t)
+	LoadFixtures(t, other, filepath.Join("testdata", "golden", "uppercase_users.json"))
+	AssertGolden(t, other, "user:", filepath.Join("testdata", "golden", "uppercase_users_only.json"))
+}
+
+func TestReadFixturesErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"bad.json":     `{"a": 1}`,
+		"bad.csv":      "a,b,c,d\n",
+		"encoding.csv": "a,zz,hex\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		if _, err := ReadFixtures(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
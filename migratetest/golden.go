@@ -0,0 +1,174 @@
+package migratetest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/pebble"
+	migrate "github.com/herenow/pebble-migrate"
+)
+
+// UpdateGoldenEnv is the environment variable that makes AssertGolden rewrite
+// golden files instead of comparing against them
+const UpdateGoldenEnv = "PEBBLE_MIGRATE_UPDATE_GOLDEN"
+
+// Snapshot returns every key under prefix in key order. Keys in the internal
+// migration namespace are skipped, so snapshots do not depend on schema state.
+func Snapshot(t testing.TB, db *pebble.DB, prefix string) []Entry {
+	t.Helper()
+
+	entries, err := snapshot(db, []byte(prefix))
+	if err != nil {
+		t.Fatalf("migratetest: failed to snapshot %q: %v", prefix, err)
+	}
+	return entries
+}
+
+// AssertGolden compares the keys under prefix with the golden file at path and
+// fails the test on any difference. Run the tests with PEBBLE_MIGRATE_UPDATE_GOLDEN=1
+// to create or update the golden file. Golden files use the JSON Entry array
+// format, so they can also be loaded as fixtures.
+func AssertGolden(t testing.TB, db *pebble.DB, prefix, path string) {
+	t.Helper()
+
+	actual, err := encodeGolden(Snapshot(t, db, prefix))
+	if err != nil {
+		t.Fatalf("migratetest: failed to encode snapshot: %v", err)
+	}
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("migratetest: failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, actual, 0644); err != nil {
+			t.Fatalf("migratetest: failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("migratetest: failed to read golden file (set %s=1 to create it): %v", UpdateGoldenEnv, err)
+	}
+
+	if !bytes.Equal(bytes.TrimSpace(expected), bytes.TrimSpace(actual)) {
+		t.Errorf("migratetest: keys under %q do not match %s\n%s", prefix, path, diffGolden(expected, actual))
+	}
+}
+
+// snapshot collects the non-reserved entries under prefix
+func snapshot(db *pebble.DB, prefix []byte) ([]Entry, error) {
+	opts := &pebble.IterOptions{}
+	if len(prefix) > 0 {
+		opts.LowerBound = prefix
+		opts.UpperBound = upperBound(prefix)
+	}
+
+	iter, err := db.NewIter(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	entries := make([]Entry, 0)
+	for iter.First(); iter.Valid(); iter.Next() {
+		if migrate.IsReservedKey(iter.Key()) {
+			continue
+		}
+		entries = append(entries, newEntry(iter.Key(), iter.Value()))
+	}
+
+	return entries, iter.Error()
+}
+
+// newEntry encodes a key/value pair, using base64 for values that are not printable text
+func newEntry(key, value []byte) Entry {
+	if isText(value) {
+		return Entry{Key: string(key), Value: string(value)}
+	}
+	return Entry{Key: string(key), Value: base64.StdEncoding.EncodeToString(value), Encoding: "base64"}
+}
+
+// isText reports whether a value can be stored in a golden file as plain text
+func isText(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// upperBound returns the smallest key greater than every key with the given prefix
+func upperBound(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// encodeGolden renders entries as an indented JSON array, one entry per line
+func encodeGolden(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("[\n")
+	for i, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("  ")
+		buf.Write(line)
+		if i < len(entries)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]\n")
+	return buf.Bytes(), nil
+}
+
+// diffGolden describes the entries that differ between the golden and actual data
+func diffGolden(expected, actual []byte) string {
+	expectedEntries, err := parseJSONFixture(expected)
+	if err != nil {
+		return fmt.Sprintf("golden file is not valid: %v", err)
+	}
+	actualEntries, _ := parseJSONFixture(actual)
+
+	want := make(map[string]Entry, len(expectedEntries))
+	for _, e := range expectedEntries {
+		want[e.Key] = e
+	}
+
+	var buf bytes.Buffer
+	for _, e := range actualEntries {
+		w, ok := want[e.Key]
+		switch {
+		case !ok:
+			fmt.Fprintf(&buf, "  + %s = %q\n", e.Key, e.Value)
+		case w != e:
+			fmt.Fprintf(&buf, "  ~ %s = %q (want %q)\n", e.Key, e.Value, w.Value)
+		}
+		delete(want, e.Key)
+	}
+	for _, e := range expectedEntries {
+		if _, missing := want[e.Key]; missing {
+			fmt.Fprintf(&buf, "  - %s = %q\n", e.Key, e.Value)
+		}
+	}
+	return buf.String()
+}
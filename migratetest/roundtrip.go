@@ -0,0 +1,160 @@
+package migratetest
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	migrate "github.com/herenow/pebble-migrate"
+)
+
+// Generator produces a random pre-migration state from r
+type Generator func(r *rand.Rand) map[string][]byte
+
+// RoundTripOptions configures RoundTripWithOptions
+type RoundTripOptions struct {
+	// Iterations is the number of random states to test. Default: 20
+	Iterations int
+
+	// Seed seeds the generator. Default: derived from the current time.
+	// Failures report the seed needed to reproduce them.
+	Seed int64
+}
+
+// RoundTrip property-tests a migration with the default options: for random
+// pre-states produced by gen it applies Up, runs Validate (if set), applies Down
+// and checks that the keyspace equals the original state. Migrations without a
+// Down function are rolled back with the inverse recorded by their Apply function.
+func RoundTrip(t *testing.T, m *migrate.Migration, gen Generator) {
+	t.Helper()
+	RoundTripWithOptions(t, m, gen, RoundTripOptions{})
+}
+
+// RoundTripWithOptions is RoundTrip with explicit iteration count and seed
+func RoundTripWithOptions(t *testing.T, m *migrate.Migration, gen Generator, opts RoundTripOptions) {
+	t.Helper()
+
+	if opts.Iterations <= 0 {
+		opts.Iterations = 20
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	for i := 0; i < opts.Iterations; i++ {
+		seed := opts.Seed + int64(i)
+		db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("migratetest: failed to open database: %v", err)
+		}
+
+		err = checkRoundTrip(db, m, gen(rand.New(rand.NewSource(seed))))
+		db.Close()
+		if err != nil {
+			t.Fatalf("migratetest: %s round trip failed (reproduce with RoundTripOptions{Seed: %d, Iterations: 1}): %v",
+				m.ID, seed, err)
+		}
+	}
+}
+
+// checkRoundTrip loads state into db, runs the migration up and down, and
+// verifies that the original state is restored
+func checkRoundTrip(db *pebble.DB, m *migrate.Migration, state map[string][]byte) error {
+	batch := db.NewBatch()
+	for key, value := range state {
+		if err := batch.Set([]byte(key), value, nil); err != nil {
+			batch.Close()
+			return err
+		}
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		batch.Close()
+		return fmt.Errorf("failed to load generated state: %w", err)
+	}
+	batch.Close()
+
+	before, err := snapshotRaw(db)
+	if err != nil {
+		return err
+	}
+
+	// A migration without Down is checked against the inverse the engine derives
+	log := migrate.NewOpLog(m.ID)
+	up := m.Up
+	if m.HasAutomaticDown() {
+		up = func(db *pebble.DB) error { return m.Apply(migrate.NewWriter(db, log)) }
+	}
+
+	if err := up(db); err != nil {
+		return fmt.Errorf("up failed: %w", err)
+	}
+	if m.Validate != nil {
+		if err := m.Validate(db); err != nil {
+			return fmt.Errorf("validate failed: %w", err)
+		}
+	}
+	if m.HasAutomaticDown() {
+		if err := log.Undo(db, false); err != nil {
+			return fmt.Errorf("automatic down failed: %w", err)
+		}
+	} else if err := m.Down(db); err != nil {
+		return fmt.Errorf("down failed: %w", err)
+	}
+
+	after, err := snapshotRaw(db)
+	if err != nil {
+		return err
+	}
+
+	return compareKeyspaces(before, after)
+}
+
+// snapshotRaw returns every non-reserved key and value in db
+func snapshotRaw(db *pebble.DB) (map[string][]byte, error) {
+	iter, err := db.NewIter(&pebble.IterOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	state := make(map[string][]byte)
+	for iter.First(); iter.Valid(); iter.Next() {
+		if migrate.IsReservedKey(iter.Key()) {
+			continue
+		}
+		state[string(iter.Key())] = append([]byte(nil), iter.Value()...)
+	}
+	return state, iter.Error()
+}
+
+// compareKeyspaces reports the first differences between two keyspaces
+func compareKeyspaces(before, after map[string][]byte) error {
+	const maxReported = 5
+	var diffs []string
+
+	for key, value := range before {
+		afterValue, ok := after[key]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("key %q missing after down", key))
+		case !bytes.Equal(value, afterValue):
+			diffs = append(diffs, fmt.Sprintf("key %q changed: %q -> %q", key, value, afterValue))
+		}
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			diffs = append(diffs, fmt.Sprintf("key %q left behind after down", key))
+		}
+	}
+
+	if len(diffs) == 0 {
+		return nil
+	}
+	if len(diffs) > maxReported {
+		diffs = append(diffs[:maxReported], fmt.Sprintf("and %d more", len(diffs)-maxReported))
+	}
+	return fmt.Errorf("keyspace differs from original: %v", diffs)
+}
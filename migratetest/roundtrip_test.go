@@ -0,0 +1,73 @@
+package migratetest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	migrate "github.com/herenow/pebble-migrate"
+)
+
+// renamePrefix moves every key under from to the same suffix under to
+func renamePrefix(db *pebble.DB, from, to string) error {
+	iter, err := db.NewIter(&pebble.IterOptions{LowerBound: []byte(from), UpperBound: upperBound([]byte(from))})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	batch := db.NewBatch()
+	defer batch.Close()
+	for iter.First(); iter.Valid(); iter.Next() {
+		suffix := strings.TrimPrefix(string(iter.Key()), from)
+		batch.Set([]byte(to+suffix), append([]byte(nil), iter.Value()...), nil)
+		batch.Delete(append([]byte(nil), iter.Key()...), nil)
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+func generateUsers(r *rand.Rand) map[string][]byte {
+	state := make(map[string][]byte)
+	for i := 0; i < r.Intn(50); i++ {
+		value := make([]byte, r.Intn(32))
+		r.Read(value)
+		state[fmt.Sprintf("user:%d", r.Intn(1000))] = value
+	}
+	state["other:key"] = []byte("untouched")
+	return state
+}
+
+func TestRoundTrip(t *testing.T) {
+	RoundTrip(t, &migrate.Migration{
+		ID:   "1754917200_rename_users",
+		Up:   func(db *pebble.DB) error { return renamePrefix(db, "user:", "users/") },
+		Down: func(db *pebble.DB) error { return renamePrefix(db, "users/", "user:") },
+		Validate: func(db *pebble.DB) error {
+			_, closer, err := db.Get([]byte("user:1"))
+			if err == nil {
+				closer.Close()
+				return fmt.Errorf("old key still present")
+			}
+			return nil
+		},
+	}, generateUsers)
+}
+
+func TestRoundTripDetectsLossyDown(t *testing.T) {
+	lossy := &migrate.Migration{
+		ID: "1754917200_lossy",
+		Up: func(db *pebble.DB) error { return renamePrefix(db, "user:", "users/") },
+		Down: func(db *pebble.DB) error {
+			// Forgets to move the data back
+			return db.DeleteRange([]byte("users/"), []byte("users0"), pebble.Sync)
+		},
+	}
+
+	db := OpenDB(t)
+	err := checkRoundTrip(db, lossy, map[string][]byte{"user:1": []byte("alice")})
+	if err == nil || !strings.Contains(err.Error(), "missing after down") {
+		t.Fatalf("Expected lossy down to be detected, got %v", err)
+	}
+}
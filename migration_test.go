@@ -1,9 +1,9 @@
 package migrate
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -84,7 +84,7 @@ func TestSchemaManager(t *testing.T) {
 
 	t.Run("MarkMigrationFailed", func(t *testing.T) {
 		testErr := "test error"
-		err := schemaManager.MarkMigrationFailed("1754917300_failed", "Failed migration", &testError{testErr})
+		err := schemaManager.MarkMigrationFailed("1754917300_failed", "Failed migration", time.Second, &testError{testErr})
 		if err != nil {
 			t.Fatalf("Failed to mark migration as failed: %v", err)
 		}
@@ -114,6 +114,66 @@ func TestSchemaManager(t *testing.T) {
 	})
 }
 
+func TestConfigurableSchemaKey(t *testing.T) {
+	dir := t.TempDir()
+	db, err := pebble.Open(dir, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Two logical stores sharing one database
+	users := NewSchemaManager(db)
+	users.SetSchemaKey("users/__schema_version__")
+	users.SetKeyPrefix("users/__migration_")
+
+	orders := NewSchemaManager(db)
+	orders.SetSchemaKey("orders/__schema_version__")
+	orders.SetKeyPrefix("orders/__migration_")
+
+	if err := users.UpdateSchemaAfterMigration("1754917200_users", 1754917200, "Users", time.Second); err != nil {
+		t.Fatalf("Failed to update users schema: %v", err)
+	}
+
+	t.Run("StoresAreIndependent", func(t *testing.T) {
+		version, err := orders.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get orders schema: %v", err)
+		}
+		if version.CurrentVersion != 0 || len(version.AppliedMigrations) != 0 {
+			t.Errorf("Expected orders store to be untouched, got %+v", version)
+		}
+
+		if _, _, err := db.Get([]byte(SchemaVersionKey)); err != pebble.ErrNotFound {
+			t.Errorf("Expected default schema key to be unused, got %v", err)
+		}
+	})
+
+	t.Run("GuardUsesConfiguredKeys", func(t *testing.T) {
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{
+			ID: "1754917300_clobber_users",
+			Up: func(db *pebble.DB) error {
+				return db.Set([]byte("users/__migration_oops"), []byte("x"), pebble.Sync)
+			},
+			Down: func(db *pebble.DB) error { return nil },
+		})
+
+		engine := NewMigrationEngineWithBackup(db, users, registry, dir)
+		engine.SetBackupEnabled(false)
+		plan, err := NewMigrationPlanner(registry, users).PlanUpgrade()
+		if err != nil {
+			t.Fatalf("Failed to plan upgrade: %v", err)
+		}
+		if err := engine.ExecutePlan(plan, nil); !errors.Is(err, ErrReservedKeyModified) {
+			t.Fatalf("Expected ErrReservedKeyModified, got %v", err)
+		}
+		if !users.IsReservedKey([]byte("users/__schema_version__")) || users.IsReservedKey([]byte(SchemaVersionKey)) {
+			t.Errorf("IsReservedKey does not follow the configured keys")
+		}
+	})
+}
+
 func TestMigrationRegistry(t *testing.T) {
 	registry := NewMigrationRegistry()
 
@@ -300,6 +360,12 @@ func TestMigrationIDValidation(t *testing.T) {
 		{"1754917300_another_test", true},
 		{"1754917200_test-migration", true},
 		{"1754917200_test", true},
+		{"1754917200.2_test", true},
+		{"1754917200._test", false},    // Empty sequence
+		{"1754917200.0_test", false},   // Zero sequence
+		{"1754917200.1.2_test", false}, // Two sequences
+		{"1754917200.+1_test", false},  // Signed sequence
+
 		{"1754917200_", false},               // Empty description
 		{"_test", false},                     // No timestamp
 		{"abc_test", false},                  // Non-numeric timestamp
@@ -307,36 +373,55 @@ func TestMigrationIDValidation(t *testing.T) {
 		{"", false},                          // Empty
 		{"1754917200_test migration", false}, // Space in description
 		{"1754917200_test@migration", false}, // Invalid character
+		{"+1754917200_test", false},          // Signed timestamp
+		{"1754917200_test_rollback", false},  // Reserved suffix
+		{"1754917200_test_rerun", false},     // Reserved suffix
+		{"1754917200_" + strings.Repeat("a", MaxMigrationIDLength), false}, // Too long
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.id, func(t *testing.T) {
-			// Simple validation check: ID must have underscore and numeric prefix
-			valid := true
-			if tc.id == "" {
-				valid = false
-			} else if !strings.Contains(tc.id, "_") {
-				valid = false
-			} else {
-				parts := strings.SplitN(tc.id, "_", 2)
-				if len(parts) != 2 || parts[1] == "" {
-					valid = false
-				} else {
-					// Check if first part is numeric
-					if _, err := strconv.ParseInt(parts[0], 10, 64); err != nil {
-						valid = false
-					} else if strings.Contains(parts[1], " ") || strings.Contains(parts[1], "@") {
-						// Check for invalid characters in description
-						valid = false
-					}
-				}
-			}
+			err := ValidateMigrationID(tc.id)
+			valid := err == nil
 
 			if valid != tc.valid {
-				t.Errorf("Expected %v for ID '%s', got %v", tc.valid, tc.id, valid)
+				t.Errorf("Expected %v for ID '%s', got %v (err: %v)", tc.valid, tc.id, valid, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidMigrationID) {
+				t.Errorf("Expected ErrInvalidMigrationID for ID '%s', got %v", tc.id, err)
 			}
 		})
 	}
+
+	t.Run("RegisterRejectsInvalidID", func(t *testing.T) {
+		registry := NewMigrationRegistry()
+		err := registry.Register(&Migration{
+			ID:   "1754917200_test migration",
+			Up:   func(db *pebble.DB) error { return nil },
+			Down: func(db *pebble.DB) error { return nil },
+		})
+		if !errors.Is(err, ErrInvalidMigrationID) {
+			t.Errorf("Expected ErrInvalidMigrationID, got %v", err)
+		}
+	})
+
+	t.Run("LegacyIDsAllowedWithFlag", func(t *testing.T) {
+		registry := NewMigrationRegistry()
+		registry.SetAllowLegacyIDs(true)
+		err := registry.Register(&Migration{
+			ID:   "1754917200_Legacy Migration",
+			Up:   func(db *pebble.DB) error { return nil },
+			Down: func(db *pebble.DB) error { return nil },
+		})
+		if err != nil {
+			t.Fatalf("Expected legacy ID to be accepted, got %v", err)
+		}
+
+		discovery := NewDiscoveryService("migrations", registry)
+		if err := discovery.ValidateMigrations(); err != nil {
+			t.Errorf("Expected legacy registry to validate, got %v", err)
+		}
+	})
 }
 
 // Helper types for testing
@@ -585,6 +670,56 @@ func TestInitializeFreshDatabase(t *testing.T) {
 			t.Errorf("Expected 0 applied migrations with empty registry, got %d", len(version.AppliedMigrations))
 		}
 	})
+
+	t.Run("DataProbe", func(t *testing.T) {
+		db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{
+			ID:   "1754917200_test",
+			Up:   func(db *pebble.DB) error { return nil },
+			Down: func(db *pebble.DB) error { return nil },
+		})
+
+		// Metadata the application writes before startup is not data
+		if err := db.Set([]byte("meta:node_id"), []byte("n1"), pebble.Sync); err != nil {
+			t.Fatalf("Failed to write key: %v", err)
+		}
+		schemaManager := NewSchemaManager(db)
+		schemaManager.SetDataProbe(DataPrefixesProbe("user:", "order:"))
+		if err := schemaManager.InitializeFreshDatabase(registry); err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		version, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get schema version: %v", err)
+		}
+		if version.CurrentVersion != 1754917200 || !version.AppliedMigrations["1754917200_test"] {
+			t.Errorf("Expected a fresh database at the latest version, got %d", version.CurrentVersion)
+		}
+
+		// A key under a data prefix makes it a pre-migration database
+		if err := db.Delete([]byte(SchemaVersionKey), pebble.Sync); err != nil {
+			t.Fatalf("Failed to delete schema key: %v", err)
+		}
+		if err := db.Set([]byte("user:1"), []byte("alice"), pebble.Sync); err != nil {
+			t.Fatalf("Failed to write key: %v", err)
+		}
+		if err := schemaManager.InitializeFreshDatabase(registry); err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		version, err = schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get schema version: %v", err)
+		}
+		if version.CurrentVersion != 0 || len(version.AppliedMigrations) != 0 {
+			t.Errorf("Expected a pre-migration database at version 0, got %d", version.CurrentVersion)
+		}
+	})
 }
 
 // Integration test for the complete migration flow
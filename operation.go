@@ -0,0 +1,179 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// operationInfix follows the key prefix in the key the plan execution in flight
+// is stored under
+const operationInfix = "operation"
+
+// OperationHeartbeatInterval is how often a running plan refreshes the heartbeat
+// of its Operation
+const OperationHeartbeatInterval = 5 * time.Second
+
+// Operation is a plan execution in flight, as stored in the database by the
+// engine running it. Applications get it with CurrentOperation, e.g. to show
+// migration progress in their own dashboards.
+type Operation struct {
+	Plan        ExecutionType `json:"plan"`
+	Phase       ProgressPhase `json:"phase"`                  // Phase of the last progress event
+	MigrationID string        `json:"migration_id,omitempty"` // Running migration, if any
+	Direction   string        `json:"direction,omitempty"`    // "up" or "down" while a migration runs
+	Step        int           `json:"step,omitempty"`         // 1-based index of the migration in the plan
+	Total       int           `json:"total"`                  // Number of migrations in the plan
+	Message     string        `json:"message,omitempty"`      // Message of the last progress event
+	PID         int           `json:"pid"`                    // Process running the plan
+	StartedAt   time.Time     `json:"started_at"`
+	Heartbeat   time.Time     `json:"heartbeat"` // Refreshed every OperationHeartbeatInterval
+
+	// Progress is the progress saved by the running migration, if it saves any
+	// (see MigrationContext.SaveProgress). It is read by CurrentOperation.
+	Progress *MigrationProgress `json:"progress,omitempty"`
+}
+
+// HeartbeatAge returns how long ago the heartbeat was refreshed. An age of
+// several OperationHeartbeatIntervals means the process running the plan died
+// or hangs, or the database was restored from a backup taken during the plan.
+func (o *Operation) HeartbeatAge() time.Duration {
+	return time.Since(o.Heartbeat)
+}
+
+// CurrentOperation returns the plan execution in flight in a database using the
+// default keys, or nil if none is. See SchemaManager.CurrentOperation.
+func CurrentOperation(db *pebble.DB) (*Operation, error) {
+	return NewSchemaManager(db).CurrentOperation()
+}
+
+// CurrentOperation returns the plan execution in flight, with the progress saved
+// by its running migration, or nil if none is. The record of a plan is removed
+// when it ends, also when it fails; one left by a process that died stays until
+// the next plan, with a growing HeartbeatAge.
+func (s *SchemaManager) CurrentOperation() (*Operation, error) {
+	data, err := getCopy(s.db, s.operationKey())
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current operation: %w", err)
+	}
+
+	var op Operation
+	if err := json.Unmarshal(data, &op); err != nil {
+		return nil, fmt.Errorf("%w: current operation: %v", ErrCorruptSchemaState, err)
+	}
+	if op.MigrationID != "" {
+		if op.Progress, err = s.GetMigrationProgress(op.MigrationID); err != nil {
+			return nil, err
+		}
+	}
+	return &op, nil
+}
+
+// operationKey returns the internal key the plan execution in flight is stored under
+func (s *SchemaManager) operationKey() []byte {
+	return []byte(s.keyPrefix + operationInfix)
+}
+
+// operationTracker keeps the Operation record of a plan execution up to date
+// from its progress events and refreshes its heartbeat, and passes the events on
+type operationTracker struct {
+	mu       sync.Mutex
+	schema   *SchemaManager
+	op       Operation
+	next     ProgressReporter
+	writeErr error // First failed write
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// startOperation records the start of a plan and starts refreshing its heartbeat
+func startOperation(schema *SchemaManager, plan *ExecutionPlan, next ProgressReporter) *operationTracker {
+	now := time.Now()
+	t := &operationTracker{
+		schema: schema,
+		op:     Operation{Plan: plan.Type, Phase: ProgressPlanStarted, Total: len(plan.Migrations), PID: os.Getpid(), StartedAt: now, Heartbeat: now},
+		next:   next,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	t.write()
+	go t.heartbeat()
+	return t
+}
+
+// Report records the event and passes it on
+func (t *operationTracker) Report(event ProgressEvent) {
+	t.mu.Lock()
+	t.op.Phase = event.Phase
+	if event.MigrationID != "" {
+		t.op.MigrationID = event.MigrationID
+		t.op.Direction = event.Direction
+	}
+	if event.Step != 0 {
+		t.op.Step = event.Step
+	}
+	if event.Message != "" {
+		t.op.Message = event.Message
+	}
+	t.op.Heartbeat = time.Now()
+	t.mu.Unlock()
+
+	t.write()
+	t.next.Report(event)
+}
+
+// heartbeat refreshes the heartbeat until the plan ends
+func (t *operationTracker) heartbeat() {
+	defer close(t.done)
+	ticker := time.NewTicker(OperationHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-ticker.C:
+			t.mu.Lock()
+			t.op.Heartbeat = now
+			t.mu.Unlock()
+			t.write()
+		}
+	}
+}
+
+// write stores the record. Write errors are kept for finish so that tracking
+// does not fail the plan. Writes are not synced: the record only describes the
+// process while it runs.
+func (t *operationTracker) write() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data, err := json.Marshal(t.op)
+	if err == nil {
+		err = t.schema.db.Set(t.schema.operationKey(), data, pebble.NoSync)
+	}
+	if err != nil && t.writeErr == nil {
+		t.writeErr = err
+	}
+}
+
+// finish stops the heartbeat and removes the record. It returns the first error
+// writing the record.
+func (t *operationTracker) finish() error {
+	close(t.stop)
+	<-t.done
+
+	if err := t.schema.db.Delete(t.schema.operationKey(), pebble.Sync); err != nil && t.writeErr == nil {
+		t.writeErr = err
+	}
+	if t.writeErr != nil {
+		return fmt.Errorf("failed to track current operation: %w", t.writeErr)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestCurrentOperation(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	noop := func(db *pebble.DB) error { return nil }
+	var seen *Operation
+	registry.Register(&Migration{ID: "1754917200_first", Up: noop, Down: noop})
+	registry.Register(&Migration{
+		ID: "1754917300_backfill",
+		UpContext: func(ctx *MigrationContext) error {
+			if err := ctx.SaveProgress([]byte("user/42"), 50); err != nil {
+				return err
+			}
+			// Another goroutine of the application reads the operation
+			var err error
+			seen, err = CurrentOperation(ctx.DB)
+			return err
+		},
+		Down: noop,
+	})
+
+	if op, err := CurrentOperation(db); err != nil || op != nil {
+		t.Fatalf("Expected no operation before the plan, got %+v, %v", op, err)
+	}
+
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+
+	if seen == nil {
+		t.Fatalf("Expected the operation to be visible while the plan runs")
+	}
+	if seen.Plan != ExecutionTypeUpgrade || seen.Phase != ProgressMigration || seen.MigrationID != "1754917300_backfill" ||
+		seen.Direction != "up" || seen.Step != 2 || seen.Total != 2 || seen.PID != os.Getpid() {
+		t.Errorf("Unexpected operation: %+v", seen)
+	}
+	if seen.HeartbeatAge() > time.Minute || seen.StartedAt.IsZero() {
+		t.Errorf("Unexpected heartbeat: %+v", seen)
+	}
+	if seen.Progress == nil || string(seen.Progress.Cursor) != "user/42" || seen.Progress.Percent != 50 {
+		t.Errorf("Expected the saved progress of the migration, got %+v", seen.Progress)
+	}
+
+	if op, err := CurrentOperation(db); err != nil || op != nil {
+		t.Errorf("Expected the operation to be removed after the plan, got %+v, %v", op, err)
+	}
+}
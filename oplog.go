@@ -0,0 +1,509 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// opLogMagic identifies the binary operation log format
+const opLogMagic = "PMOPLOG1"
+
+// OpKind identifies the kind of a recorded key mutation
+type OpKind byte
+
+const (
+	// OpSet records a key being written
+	OpSet OpKind = 1
+
+	// OpDelete records a key being deleted
+	OpDelete OpKind = 2
+)
+
+// String returns the name of the operation kind
+func (k OpKind) String() string {
+	switch k {
+	case OpSet:
+		return "set"
+	case OpDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(k))
+	}
+}
+
+// Op is a single key mutation together with the key's value before it
+type Op struct {
+	Kind     OpKind
+	Key      []byte
+	Value    []byte // New value, for OpSet
+	Existed  bool   // Whether the key existed before the mutation
+	Previous []byte // Value before the mutation, if Existed
+}
+
+// OpLog is the ordered list of key mutations a migration performed. Because every
+// operation carries the previous value, a log can be replayed and also undone.
+type OpLog struct {
+	MigrationID string
+	CreatedAt   time.Time
+	Ops         []Op
+}
+
+// NewOpLog creates an empty operation log for a migration
+func NewOpLog(migrationID string) *OpLog {
+	return &OpLog{
+		MigrationID: migrationID,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// MarshalBinary encodes the log in the compact binary log format
+func (l *OpLog) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(opLogMagic)
+	writeBytes(&buf, []byte(l.MigrationID))
+	writeUvarint(&buf, uint64(l.CreatedAt.UnixNano()))
+	writeUvarint(&buf, uint64(len(l.Ops)))
+
+	for _, op := range l.Ops {
+		buf.WriteByte(byte(op.Kind))
+		writeBytes(&buf, op.Key)
+		if op.Kind == OpSet {
+			writeBytes(&buf, op.Value)
+		}
+		if op.Existed {
+			buf.WriteByte(1)
+			writeBytes(&buf, op.Previous)
+		} else {
+			buf.WriteByte(0)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a log encoded by MarshalBinary
+func (l *OpLog) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(opLogMagic)) {
+		return fmt.Errorf("%w: missing header", ErrInvalidOpLog)
+	}
+	r := bytes.NewReader(data[len(opLogMagic):])
+
+	id, err := readBytes(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidOpLog, err)
+	}
+	createdAt, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidOpLog, err)
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidOpLog, err)
+	}
+	if count > uint64(r.Len()) {
+		return fmt.Errorf("%w: operation count %d exceeds data size", ErrInvalidOpLog, count)
+	}
+
+	ops := make([]Op, 0, count)
+	for i := uint64(0); i < count; i++ {
+		op, err := readOp(r)
+		if err != nil {
+			return fmt.Errorf("%w: operation %d: %v", ErrInvalidOpLog, i, err)
+		}
+		ops = append(ops, op)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidOpLog, r.Len())
+	}
+
+	l.MigrationID = string(id)
+	l.CreatedAt = time.Unix(0, int64(createdAt))
+	l.Ops = ops
+	return nil
+}
+
+// readOp decodes a single operation
+func readOp(r *bytes.Reader) (Op, error) {
+	var op Op
+
+	kind, err := r.ReadByte()
+	if err != nil {
+		return op, err
+	}
+	op.Kind = OpKind(kind)
+	if op.Kind != OpSet && op.Kind != OpDelete {
+		return op, fmt.Errorf("unknown operation kind %d", kind)
+	}
+
+	if op.Key, err = readBytes(r); err != nil {
+		return op, err
+	}
+	if op.Kind == OpSet {
+		if op.Value, err = readBytes(r); err != nil {
+			return op, err
+		}
+	}
+
+	existed, err := r.ReadByte()
+	if err != nil {
+		return op, err
+	}
+	if existed == 1 {
+		op.Existed = true
+		if op.Previous, err = readBytes(r); err != nil {
+			return op, err
+		}
+	}
+
+	return op, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	writeUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, fmt.Errorf("length %d exceeds remaining data", n)
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+// WriteOpLog writes a log to a file
+func WriteOpLog(path string, log *OpLog) error {
+	data, err := log.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write operation log: %w", err)
+	}
+	return nil
+}
+
+// ReadOpLog reads a log written by WriteOpLog
+func ReadOpLog(path string) (*OpLog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read operation log: %w", err)
+	}
+	log := &OpLog{}
+	if err := log.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// Keys returns the sorted, distinct keys the log touches
+func (l *OpLog) Keys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, op := range l.Ops {
+		if !seen[string(op.Key)] {
+			seen[string(op.Key)] = true
+			keys = append(keys, string(op.Key))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// keyState is the value of a key at some point, or its absence
+type keyState struct {
+	exists bool
+	value  []byte
+}
+
+// initialStates returns the state of every touched key before the first operation
+func (l *OpLog) initialStates() map[string]keyState {
+	states := make(map[string]keyState)
+	for _, op := range l.Ops {
+		if _, ok := states[string(op.Key)]; !ok {
+			states[string(op.Key)] = keyState{exists: op.Existed, value: op.Previous}
+		}
+	}
+	return states
+}
+
+// finalStates returns the state of every touched key after the last operation
+func (l *OpLog) finalStates() map[string]keyState {
+	states := make(map[string]keyState)
+	for _, op := range l.Ops {
+		states[string(op.Key)] = keyState{exists: op.Kind == OpSet, value: op.Value}
+	}
+	return states
+}
+
+// checkStates returns the sorted keys whose current value in db differs from expected
+func checkStates(db *pebble.DB, expected map[string]keyState) ([]string, error) {
+	var conflicts []string
+	for key, want := range expected {
+		value, closer, err := db.Get([]byte(key))
+		if err == pebble.ErrNotFound {
+			if want.exists {
+				conflicts = append(conflicts, key)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %q: %w", key, err)
+		}
+		if !want.exists || !bytes.Equal(value, want.value) {
+			conflicts = append(conflicts, key)
+		}
+		closer.Close()
+	}
+	sort.Strings(conflicts)
+	return conflicts, nil
+}
+
+// summarizeKeys formats a key list for an error message, eliding long lists
+func summarizeKeys(keys []string) string {
+	const maxKeys = 10
+	if len(keys) <= maxKeys {
+		return fmt.Sprintf("%q", keys)
+	}
+	return fmt.Sprintf("%q and %d more", keys[:maxKeys], len(keys)-maxKeys)
+}
+
+// Replay re-applies the logged operations to db in one batch. Unless force is set,
+// every touched key must still have the value it had before the migration ran;
+// otherwise ErrOpLogConflict is returned and nothing is written.
+func (l *OpLog) Replay(db *pebble.DB, force bool) error {
+	if !force {
+		conflicts, err := checkStates(db, l.initialStates())
+		if err != nil {
+			return err
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("%w: keys changed since before migration %s: %s", ErrOpLogConflict, l.MigrationID, summarizeKeys(conflicts))
+		}
+	}
+
+	batch := db.NewBatch()
+	defer batch.Close()
+
+	for _, op := range l.Ops {
+		var err error
+		if op.Kind == OpSet {
+			err = batch.Set(op.Key, op.Value, nil)
+		} else {
+			err = batch.Delete(op.Key, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return batch.Commit(pebble.Sync)
+}
+
+// Undo inverts the logged operations in reverse order in one batch, restoring every
+// touched key to its value before the migration. Unless force is set, every touched
+// key must still have the value the migration left; otherwise ErrOpLogConflict is
+// returned and nothing is written.
+func (l *OpLog) Undo(db *pebble.DB, force bool) error {
+	if !force {
+		conflicts, err := checkStates(db, l.finalStates())
+		if err != nil {
+			return err
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("%w: keys changed since migration %s: %s", ErrOpLogConflict, l.MigrationID, summarizeKeys(conflicts))
+		}
+	}
+
+	batch := db.NewBatch()
+	defer batch.Close()
+
+	for i := len(l.Ops) - 1; i >= 0; i-- {
+		op := l.Ops[i]
+		var err error
+		if op.Existed {
+			err = batch.Set(op.Key, op.Previous, nil)
+		} else {
+			err = batch.Delete(op.Key, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return batch.Commit(pebble.Sync)
+}
+
+// WriterFunc is the signature for migration functions that write through a Writer
+type WriterFunc func(w *Writer) error
+
+// upFromApply returns a MigrationFunc that runs apply without keeping its log
+func upFromApply(migrationID string, apply WriterFunc) MigrationFunc {
+	return func(db *pebble.DB) error {
+		return apply(NewWriter(db, NewOpLog(migrationID)))
+	}
+}
+
+// Writer performs key mutations on behalf of a migration and records each of them,
+// with the key's previous value, in an operation log
+type Writer struct {
+	db  *pebble.DB
+	log *OpLog
+}
+
+// NewWriter creates a writer that records mutations to db in log
+func NewWriter(db *pebble.DB, log *OpLog) *Writer {
+	return &Writer{db: db, log: log}
+}
+
+// DB returns the underlying database for reads and iteration. Writes made directly
+// to it are not recorded.
+func (w *Writer) DB() *pebble.DB {
+	return w.db
+}
+
+// Log returns the operation log mutations are recorded in
+func (w *Writer) Log() *OpLog {
+	return w.log
+}
+
+// Get returns a copy of the value of key, or pebble.ErrNotFound
+func (w *Writer) Get(key []byte) ([]byte, error) {
+	return getCopy(w.db, key)
+}
+
+// Set writes key and records the mutation
+func (w *Writer) Set(key, value []byte) error {
+	op, err := newOp(w.db, OpSet, key, value)
+	if err != nil {
+		return err
+	}
+	if err := w.db.Set(key, value, pebble.Sync); err != nil {
+		return err
+	}
+	w.log.Ops = append(w.log.Ops, op)
+	return nil
+}
+
+// Delete deletes key and records the mutation
+func (w *Writer) Delete(key []byte) error {
+	op, err := newOp(w.db, OpDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	if err := w.db.Delete(key, pebble.Sync); err != nil {
+		return err
+	}
+	w.log.Ops = append(w.log.Ops, op)
+	return nil
+}
+
+// NewBatch creates a batch whose mutations are recorded when it is committed
+func (w *Writer) NewBatch() *WriterBatch {
+	return &WriterBatch{w: w, batch: w.db.NewIndexedBatch()}
+}
+
+// WriterBatch groups recorded mutations into one atomic write. Reads through the
+// batch see its pending writes.
+type WriterBatch struct {
+	w     *Writer
+	batch *pebble.Batch
+	ops   []Op
+}
+
+// Get returns a copy of the value of key including pending writes, or pebble.ErrNotFound
+func (b *WriterBatch) Get(key []byte) ([]byte, error) {
+	return getCopy(b.batch, key)
+}
+
+// Set adds a write of key to the batch
+func (b *WriterBatch) Set(key, value []byte) error {
+	op, err := newOp(b.batch, OpSet, key, value)
+	if err != nil {
+		return err
+	}
+	if err := b.batch.Set(key, value, nil); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, op)
+	return nil
+}
+
+// Delete adds a delete of key to the batch
+func (b *WriterBatch) Delete(key []byte) error {
+	op, err := newOp(b.batch, OpDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	if err := b.batch.Delete(key, nil); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, op)
+	return nil
+}
+
+// Count returns the number of mutations in the batch
+func (b *WriterBatch) Count() int {
+	return len(b.ops)
+}
+
+// Commit applies the batch and records its mutations
+func (b *WriterBatch) Commit() error {
+	if err := b.batch.Commit(pebble.Sync); err != nil {
+		return err
+	}
+	b.w.log.Ops = append(b.w.log.Ops, b.ops...)
+	b.ops = nil
+	return nil
+}
+
+// Close releases the batch. Uncommitted mutations are discarded.
+func (b *WriterBatch) Close() error {
+	return b.batch.Close()
+}
+
+// getCopy returns a copy of the value of key
+func getCopy(r pebble.Reader, key []byte) ([]byte, error) {
+	value, closer, err := r.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return append([]byte(nil), value...), nil
+}
+
+// newOp creates an operation, capturing the current value of key from r
+func newOp(r pebble.Reader, kind OpKind, key, value []byte) (Op, error) {
+	op := Op{Kind: kind, Key: append([]byte(nil), key...)}
+	if kind == OpSet {
+		op.Value = append([]byte(nil), value...)
+	}
+
+	previous, err := getCopy(r, key)
+	switch {
+	case err == nil:
+		op.Existed = true
+		op.Previous = previous
+	case err != pebble.ErrNotFound:
+		return op, fmt.Errorf("failed to read previous value of %q: %w", key, err)
+	}
+
+	return op, nil
+}
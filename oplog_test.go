@@ -0,0 +1,199 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestOpLog(t *testing.T) {
+	openDB := func(t *testing.T) (*pebble.DB, string) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db, dbPath
+	}
+
+	read := func(t *testing.T, db *pebble.DB) map[string]string {
+		state := make(map[string]string)
+		iter, _ := db.NewIter(&pebble.IterOptions{})
+		defer iter.Close()
+		for iter.First(); iter.Valid(); iter.Next() {
+			if !IsReservedKey(iter.Key()) {
+				state[string(iter.Key())] = string(iter.Value())
+			}
+		}
+		return state
+	}
+
+	// apply seeds a:1, b:2 and runs a migration that updates a, deletes b, adds c
+	// and updates c again in a batch
+	apply := func(t *testing.T, db *pebble.DB) *OpLog {
+		db.Set([]byte("a"), []byte("1"), pebble.Sync)
+		db.Set([]byte("b"), []byte("2"), pebble.Sync)
+
+		log := NewOpLog("1754917200_change")
+		w := NewWriter(db, log)
+		if err := w.Set([]byte("a"), []byte("10")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Delete([]byte("b")); err != nil {
+			t.Fatal(err)
+		}
+
+		batch := w.NewBatch()
+		defer batch.Close()
+		batch.Set([]byte("c"), []byte("3"))
+		if value, err := batch.Get([]byte("c")); err != nil || string(value) != "3" {
+			t.Fatalf("Expected batch read to see pending write, got %q, %v", value, err)
+		}
+		batch.Set([]byte("c"), []byte("30"))
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return log
+	}
+
+	t.Run("RecordsPreImages", func(t *testing.T) {
+		db, _ := openDB(t)
+		log := apply(t, db)
+
+		if len(log.Ops) != 4 {
+			t.Fatalf("Expected 4 operations, got %d", len(log.Ops))
+		}
+		last := log.Ops[3]
+		if string(last.Key) != "c" || !last.Existed || string(last.Previous) != "3" {
+			t.Errorf("Expected second write of c to record the pending value, got %+v", last)
+		}
+		if log.Ops[1].Kind != OpDelete || string(log.Ops[1].Previous) != "2" {
+			t.Errorf("Expected delete of b with previous value, got %+v", log.Ops[1])
+		}
+		if !reflect.DeepEqual(log.Keys(), []string{"a", "b", "c"}) {
+			t.Errorf("Unexpected keys %v", log.Keys())
+		}
+	})
+
+	t.Run("EncodingRoundTrip", func(t *testing.T) {
+		db, dbPath := openDB(t)
+		log := apply(t, db)
+
+		path := dbPath + ".oplog"
+		if err := WriteOpLog(path, log); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := ReadOpLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.MigrationID != log.MigrationID || !decoded.CreatedAt.Equal(log.CreatedAt) || len(decoded.Ops) != len(log.Ops) {
+			t.Fatalf("Decoded log differs: %+v", decoded)
+		}
+		for i := range log.Ops {
+			want, got := log.Ops[i], decoded.Ops[i]
+			if want.Kind != got.Kind || string(want.Key) != string(got.Key) || string(want.Value) != string(got.Value) ||
+				want.Existed != got.Existed || string(want.Previous) != string(got.Previous) {
+				t.Errorf("Operation %d differs: %+v != %+v", i, got, want)
+			}
+		}
+
+		empty := &OpLog{MigrationID: "1754917200_empty", Ops: []Op{{Kind: OpSet, Key: []byte("k"), Existed: true}}}
+		data, _ := empty.MarshalBinary()
+		if err := (&OpLog{}).UnmarshalBinary(data); err != nil {
+			t.Errorf("Expected empty trailing value to decode, got %v", err)
+		}
+
+		data, _ = log.MarshalBinary()
+		if err := (&OpLog{}).UnmarshalBinary(data[:len(data)-1]); !errors.Is(err, ErrInvalidOpLog) {
+			t.Errorf("Expected truncated log to be invalid, got %v", err)
+		}
+	})
+
+	t.Run("UndoAndReplay", func(t *testing.T) {
+		db, _ := openDB(t)
+		log := apply(t, db)
+		after := read(t, db)
+
+		if err := log.Undo(db, false); err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		if state := read(t, db); !reflect.DeepEqual(state, map[string]string{"a": "1", "b": "2"}) {
+			t.Errorf("Expected original state after undo, got %v", state)
+		}
+
+		if err := log.Replay(db, false); err != nil {
+			t.Fatalf("Replay failed: %v", err)
+		}
+		if state := read(t, db); !reflect.DeepEqual(state, after) {
+			t.Errorf("Expected migrated state after replay, got %v", state)
+		}
+	})
+
+	t.Run("Conflicts", func(t *testing.T) {
+		db, _ := openDB(t)
+		log := apply(t, db)
+		db.Set([]byte("c"), []byte("changed"), pebble.Sync)
+
+		if err := log.Undo(db, false); !errors.Is(err, ErrOpLogConflict) {
+			t.Fatalf("Expected conflict, got %v", err)
+		}
+		if state := read(t, db); state["a"] != "10" {
+			t.Errorf("Expected nothing to be written on conflict, got %v", state)
+		}
+		if err := log.Replay(db, false); !errors.Is(err, ErrOpLogConflict) {
+			t.Errorf("Expected replay conflict, got %v", err)
+		}
+
+		if err := log.Undo(db, true); err != nil {
+			t.Fatalf("Forced undo failed: %v", err)
+		}
+		if state := read(t, db); !reflect.DeepEqual(state, map[string]string{"a": "1", "b": "2"}) {
+			t.Errorf("Expected original state after forced undo, got %v", state)
+		}
+	})
+
+	t.Run("EngineSavesLog", func(t *testing.T) {
+		db, dbPath := openDB(t)
+		registry := NewMigrationRegistry()
+		err := registry.Register(&Migration{
+			ID: "1754917200_apply",
+			Apply: func(w *Writer) error {
+				return w.Set([]byte("k"), []byte("v"))
+			},
+			Down: func(db *pebble.DB) error { return nil },
+		})
+		if err != nil {
+			t.Fatalf("Expected migration with Apply and no Up to register: %v", err)
+		}
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupEnabled(false)
+		engine.SetRecordOps(true)
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Migration failed: %v", err)
+		}
+
+		paths, err := NewBackupManager(dbPath).ListOpLogs()
+		if err != nil || len(paths) != 1 {
+			t.Fatalf("Expected one saved log, got %v, %v", paths, err)
+		}
+		log, err := ReadOpLog(paths[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if log.MigrationID != "1754917200_apply" || len(log.Ops) != 1 {
+			t.Errorf("Unexpected saved log %+v", log)
+		}
+		if backups, _ := NewBackupManager(dbPath).ListBackups(); len(backups) != 0 {
+			t.Errorf("Expected operation logs not to be listed as backups, got %d", len(backups))
+		}
+	})
+}
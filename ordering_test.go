@@ -195,3 +195,132 @@ func TestMigrationOrderingComplexDependencies(t *testing.T) {
 		}
 	}
 }
+
+func TestMigrationOrderingPriority(t *testing.T) {
+	registry := NewMigrationRegistry()
+	noop := func(db *pebble.DB) error { return nil }
+
+	// A heavy backfill, a critical fix registered later and a fix that has to wait
+	// for the backfill despite its priority
+	registry.Register(&Migration{ID: "1000000000_backfill", Up: noop, Down: noop})
+	registry.Register(&Migration{ID: "1100000000_fix", Priority: 10, Up: noop, Down: noop})
+	registry.Register(&Migration{ID: "1200000000_fix_after_backfill", Priority: 10, Dependencies: []string{"1000000000_backfill"}, Up: noop, Down: noop})
+	registry.Register(&Migration{ID: "1300000000_cleanup", Priority: -1, Up: noop, Down: noop})
+	registry.Register(&Migration{ID: "1400000000_other", Up: noop, Down: noop})
+
+	pending, err := registry.GetPendingMigrations(make(map[string]bool))
+	if err != nil {
+		t.Fatalf("Failed to get pending migrations: %v", err)
+	}
+
+	expectedOrder := []string{
+		"1100000000_fix",                // Highest priority among ready migrations
+		"1000000000_backfill",           // Earliest timestamp with default priority
+		"1200000000_fix_after_backfill", // Ready once the backfill ran, ahead of the rest
+		"1400000000_other",
+		"1300000000_cleanup", // Negative priority runs last
+	}
+
+	if len(pending) != len(expectedOrder) {
+		t.Fatalf("Expected %d migrations, got %d", len(expectedOrder), len(pending))
+	}
+	for i, m := range pending {
+		if m.ID != expectedOrder[i] {
+			t.Errorf("Position %d: expected %s, got %s", i, expectedOrder[i], m.ID)
+		}
+	}
+}
+
+func TestSequentialVersionParser(t *testing.T) {
+	noop := func(db *pebble.DB) error { return nil }
+
+	t.Run("DefaultRejectsSequential", func(t *testing.T) {
+		registry := NewMigrationRegistry()
+		if err := registry.Register(&Migration{ID: "00001_add_index", Up: noop, Down: noop}); err == nil {
+			t.Fatal("Expected sequential ID to be rejected by default parser")
+		}
+	})
+
+	t.Run("MixedOrdering", func(t *testing.T) {
+		registry := NewMigrationRegistry()
+		if err := registry.SetVersionParser(ParseSequentialMigrationVersion); err != nil {
+			t.Fatalf("Failed to set parser: %v", err)
+		}
+
+		for _, id := range []string{"1754917200_timestamped", "00002_backfill", "00001_add_index"} {
+			if err := registry.Register(&Migration{ID: id, Up: noop, Down: noop}); err != nil {
+				t.Fatalf("Failed to register %s: %v", id, err)
+			}
+		}
+
+		pending, err := registry.GetPendingMigrations(map[string]bool{})
+		if err != nil {
+			t.Fatalf("Failed to get pending migrations: %v", err)
+		}
+		expected := []string{"00001_add_index", "00002_backfill", "1754917200_timestamped"}
+		for i, m := range pending {
+			if m.ID != expected[i] {
+				t.Errorf("Position %d: expected %s, got %s", i, expected[i], m.ID)
+			}
+		}
+		if pending[0].Version != 1 {
+			t.Errorf("Expected version 1, got %d", pending[0].Version)
+		}
+	})
+
+	t.Run("InvalidSequentialIDs", func(t *testing.T) {
+		for _, id := range []string{"00000_zero", "00001_", "_add_index", "00001_add_index_rerun", "0x01_hex"} {
+			if _, err := ParseSequentialMigrationVersion(id); err == nil {
+				t.Errorf("Expected %q to be rejected", id)
+			}
+		}
+	})
+
+	t.Run("ReparsesRegisteredMigrations", func(t *testing.T) {
+		registry := NewMigrationRegistry()
+		registry.SetVersionParser(ParseSequentialMigrationVersion)
+		registry.Register(&Migration{ID: "00001_add_index", Up: noop, Down: noop})
+
+		if err := registry.SetVersionParser(nil); err == nil {
+			t.Fatal("Expected default parser to reject registered sequential ID")
+		}
+		if m, _ := registry.GetMigration("00001_add_index"); m.Version != 1 {
+			t.Errorf("Expected version to be unchanged, got %d", m.Version)
+		}
+	})
+}
+
+func TestMigrationOrderingSequence(t *testing.T) {
+	noop := func(db *pebble.DB) error { return nil }
+
+	registry := NewMigrationRegistry()
+	for _, id := range []string{"1754917201_next_second", "1754917200.10_tenth", "1754917200.2_second", "1754917200_plain", "1754917200.1_first"} {
+		if err := registry.Register(&Migration{ID: id, Up: noop, Down: noop}); err != nil {
+			t.Fatalf("Failed to register %s: %v", id, err)
+		}
+	}
+
+	expected := []string{"1754917200_plain", "1754917200.1_first", "1754917200.2_second", "1754917200.10_tenth", "1754917201_next_second"}
+	for name, migrations := range map[string]func() ([]*Migration, error){
+		"Registered": func() ([]*Migration, error) { return registry.GetMigrations(), nil },
+		"Pending":    func() ([]*Migration, error) { return registry.GetPendingMigrations(map[string]bool{}) },
+	} {
+		ordered, err := migrations()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for i, m := range ordered {
+			if m.ID != expected[i] {
+				t.Errorf("%s position %d: expected %s, got %s", name, i, expected[i], m.ID)
+			}
+		}
+	}
+
+	tenth, _ := registry.GetMigration("1754917200.10_tenth")
+	if tenth.Version != 1754917200 || tenth.Sequence != 10 {
+		t.Errorf("Expected version 1754917200 sequence 10, got %d.%d", tenth.Version, tenth.Sequence)
+	}
+	if seq := ParseMigrationSequence("1754917200_plain"); seq != 0 {
+		t.Errorf("Expected no sequence for a plain ID, got %d", seq)
+	}
+}
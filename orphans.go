@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// maxOrphanExamples is the number of orphaned keys reported per prefix
+const maxOrphanExamples = 5
+
+// OrphanedKeys describes keys left under a prefix introduced by a migration that
+// was rolled back, which its Down should have removed
+type OrphanedKeys struct {
+	MigrationID string   `json:"migration_id"` // Migration that declares the prefix in Introduces
+	Prefix      string   `json:"prefix"`       // The introduced prefix
+	Keys        int64    `json:"keys"`         // Number of keys left under the prefix
+	Examples    []string `json:"examples"`     // The first few of them
+}
+
+// String returns a human-readable description of the orphaned keys
+func (o OrphanedKeys) String() string {
+	return fmt.Sprintf("%d key(s) under %q introduced by %s, e.g. %s",
+		o.Keys, o.Prefix, o.MigrationID, strings.Join(o.Examples, ", "))
+}
+
+// FindOrphanedKeys scans the prefixes introduced by registered migrations that
+// are no longer applied, i.e. were applied and rolled back, for keys their Down
+// missed. Keys under a prefix introduced by an applied migration belong to that
+// migration and are not reported, nor are the manager's internal keys. The
+// result lists only the prefixes with keys, in registry order.
+func (s *SchemaManager) FindOrphanedKeys(registry *MigrationRegistry) ([]OrphanedKeys, error) {
+	schema, err := s.GetSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var owned [][]byte
+	rolledBack := make(map[string]bool)
+	for _, m := range registry.GetMigrations() {
+		if schema.AppliedMigrations[m.ID] {
+			for _, prefix := range m.Introduces {
+				owned = append(owned, []byte(prefix))
+			}
+		}
+	}
+	for _, record := range schema.MigrationHistory {
+		if record.Success && record.Type.Applies() && !schema.AppliedMigrations[record.ID] {
+			rolledBack[record.ID] = true
+		}
+	}
+
+	var orphans []OrphanedKeys
+	for _, m := range registry.GetMigrations() {
+		if !rolledBack[m.ID] {
+			continue
+		}
+		for _, prefix := range m.Introduces {
+			orphan, err := s.scanOrphans(m.ID, prefix, owned)
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan %q: %w", prefix, err)
+			}
+			if orphan.Keys > 0 {
+				orphans = append(orphans, orphan)
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// scanOrphans counts the keys under prefix that are neither internal nor under
+// one of the owned prefixes
+func (s *SchemaManager) scanOrphans(migrationID, prefix string, owned [][]byte) (OrphanedKeys, error) {
+	orphan := OrphanedKeys{MigrationID: migrationID, Prefix: prefix}
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(prefix),
+		UpperBound: prefixUpperBound([]byte(prefix)),
+	})
+	if err != nil {
+		return orphan, err
+	}
+	defer iter.Close()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		key := iter.Key()
+		if s.IsReservedKey(key) || hasAnyPrefix(key, owned) {
+			continue
+		}
+		orphan.Keys++
+		if len(orphan.Examples) < maxOrphanExamples {
+			orphan.Examples = append(orphan.Examples, fmt.Sprintf("%q", key))
+		}
+	}
+	return orphan, iter.Error()
+}
+
+// hasAnyPrefix reports whether key starts with one of prefixes
+func hasAnyPrefix(key []byte, prefixes [][]byte) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package migrate
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestFindOrphanedKeys(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	set := func(keys ...string) MigrationFunc {
+		return func(db *pebble.DB) error {
+			for _, key := range keys {
+				if err := db.Set([]byte(key), []byte("x"), pebble.Sync); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	del := func(keys ...string) MigrationFunc {
+		return func(db *pebble.DB) error {
+			for _, key := range keys {
+				if err := db.Delete([]byte(key), pebble.Sync); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	// The first migration stays applied and owns profile/avatar/
+	migrations := []*Migration{
+		{
+			ID:         "1754917200_avatars",
+			Up:         set("profile/avatar/1"),
+			Down:       del("profile/avatar/1"),
+			Introduces: []string{"profile/avatar/"},
+		},
+		{
+			ID:         "1754917300_profiles",
+			Up:         set("profile/1", "profile/2", "index/profile/1"),
+			Down:       del("profile/1", "index/profile/1"), // Misses profile/2
+			Introduces: []string{"profile/", "index/profile/"},
+		},
+		{
+			ID:         "1754917400_pending",
+			Up:         set(),
+			Down:       del(),
+			Introduces: []string{"pending/"},
+		},
+	}
+	for _, m := range migrations[:2] {
+		if err := registry.Register(m); err != nil {
+			t.Fatalf("Failed to register: %v", err)
+		}
+	}
+
+	planner := NewMigrationPlanner(registry, schemaManager)
+	plan, err := planner.PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+
+	if orphans, err := schemaManager.FindOrphanedKeys(registry); err != nil || len(orphans) != 0 {
+		t.Fatalf("Expected no orphans while applied, got %v, %v", orphans, err)
+	}
+
+	plan, err = planner.PlanDowngrade(migrations[0].Version)
+	if err != nil {
+		t.Fatalf("Failed to plan downgrade: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to downgrade: %v", err)
+	}
+
+	// A never applied migration is not checked, even if its prefix has keys
+	if err := registry.Register(migrations[2]); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if err := db.Set([]byte("pending/1"), []byte("x"), pebble.Sync); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	orphans, err := schemaManager.FindOrphanedKeys(registry)
+	if err != nil {
+		t.Fatalf("Failed to find orphans: %v", err)
+	}
+	if len(orphans) != 1 {
+		t.Fatalf("Expected one orphaned prefix, got %v", orphans)
+	}
+	orphan := orphans[0]
+	if orphan.MigrationID != migrations[1].ID || orphan.Prefix != "profile/" || orphan.Keys != 1 ||
+		len(orphan.Examples) != 1 || orphan.Examples[0] != `"profile/2"` {
+		t.Errorf("Expected profile/2 to be reported, got %+v", orphan)
+	}
+}
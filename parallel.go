@@ -0,0 +1,322 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SetParallelism sets how many independent migrations an upgrade may run at once.
+// Consecutive pending migrations run together when none depends on another and all
+// declare disjoint KeyPrefixes; migrations without declared prefixes always run on
+// their own. The history is recorded in plan order regardless of completion order.
+// Values below 2 disable parallel execution (the default).
+func (e *MigrationEngine) SetParallelism(n int) {
+	e.parallelism = n
+}
+
+// prefixesOverlap reports whether two key prefixes can match the same key
+func prefixesOverlap(a, b string) bool {
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// canJoinWave reports whether m can run in parallel with the migrations in wave.
+// Dependencies are resolved through the aliases of registry.
+func canJoinWave(registry *MigrationRegistry, wave []*Migration, m *Migration) bool {
+	if len(m.KeyPrefixes) == 0 {
+		return false
+	}
+	for _, other := range wave {
+		if len(other.KeyPrefixes) == 0 {
+			return false
+		}
+		for _, dep := range m.Dependencies {
+			if registry.ResolveID(dep) == other.ID {
+				return false
+			}
+		}
+		for _, a := range m.KeyPrefixes {
+			for _, b := range other.KeyPrefixes {
+				if prefixesOverlap(a, b) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// planWaves splits an ordered list of migrations into waves of consecutive
+// migrations that can run in parallel
+func planWaves(registry *MigrationRegistry, migrations []*Migration) [][]*Migration {
+	var waves [][]*Migration
+	var wave []*Migration
+	for _, m := range migrations {
+		if len(wave) > 0 && !canJoinWave(registry, wave, m) {
+			waves = append(waves, wave)
+			wave = nil
+		}
+		wave = append(wave, m)
+	}
+	if len(wave) > 0 {
+		waves = append(waves, wave)
+	}
+	return waves
+}
+
+// migrationIDs returns the IDs of migrations
+func migrationIDs(migrations []*Migration) []string {
+	ids := make([]string, len(migrations))
+	for i, m := range migrations {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+// waveResult is the outcome of one migration in a wave
+type waveResult struct {
+	log      *OpLog
+	err      error
+	duration time.Duration
+}
+
+// runInWave runs a migration of a wave. Unlike executeWithFaults it does not store
+// the undo log, as writing internal keys would trip the reserved key guard of the
+// migrations still running; recordWave stores it instead.
+func (e *MigrationEngine) runInWave(migration *Migration, progress ProgressReporter) waveResult {
+	if err := e.injectFault(FaultBeforeMigration, migration.ID); err != nil {
+		return waveResult{err: err}
+	}
+
+	start := time.Now()
+	log, err := e.runMigration(migration, true, progress)
+	duration := time.Since(start)
+	if err != nil {
+		return waveResult{err: err, duration: duration}
+	}
+
+	return waveResult{log: log, err: e.injectFault(FaultAfterDataWrite, migration.ID), duration: duration}
+}
+
+// executeWaves runs the migrations of an upgrade plan in parallel waves, within
+// the batch limits counted from start
+func (e *MigrationEngine) executeWaves(plan *ExecutionPlan, start time.Time, progress ProgressReporter) error {
+	// Migrations report progress concurrently
+	progress = &syncReporter{reporter: progress}
+	total := len(plan.Migrations)
+	var completed int32
+
+	waves := planWaves(e.registry, plan.Migrations)
+	done := 0
+	for w, wave := range waves {
+		if err := e.canceledBefore(wave[0]); err != nil {
+			return err
+		}
+		if e.batchExhausted(done, len(wave), start) {
+			var rest []*Migration
+			for _, later := range waves[w:] {
+				rest = append(rest, later...)
+			}
+			e.deferRest(rest, total, progress)
+			return e.continuedFailure()
+		}
+
+		// Migrations depending on a skipped best-effort migration stay pending
+		var runnable []*Migration
+		for _, migration := range wave {
+			if !e.skipIfBlocked(migration, progress) {
+				runnable = append(runnable, migration)
+			}
+		}
+		done += len(wave) - len(runnable)
+		if wave = runnable; len(wave) == 0 {
+			continue
+		}
+
+		if len(wave) > 1 {
+			progress.Report(ProgressEvent{
+				Phase:   ProgressMigrationStarted,
+				Total:   total,
+				Percent: planPercent(done, total),
+				Message: fmt.Sprintf("Executing wave %d/%d: %d migrations in parallel", w+1, len(waves), len(wave)),
+			})
+		}
+
+		started := StepEvent{Step: StepMarkStarted, Direction: "up"}
+		if err := e.interceptStep(started, func() error { return e.schemaManager.MarkMigrationStarted(migrationIDs(wave)...) }); err != nil {
+			return fmt.Errorf("failed to mark migration as started: %w", err)
+		}
+
+		results := make([]waveResult, len(wave))
+		slots := make(chan struct{}, e.parallelism)
+		var wg sync.WaitGroup
+		for i, migration := range wave {
+			wg.Add(1)
+			go func(i int, migration *Migration) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+
+				step := done + i + 1
+				progress.Report(ProgressEvent{
+					Phase:       ProgressMigrationStarted,
+					Step:        step,
+					Total:       total,
+					MigrationID: migration.ID,
+					Direction:   "up",
+					Percent:     planPercent(int(atomic.LoadInt32(&completed)), total),
+					Message:     fmt.Sprintf("Executing migration %d/%d: %s", step, total, migration.ID),
+				})
+				results[i] = e.runInWave(migration, progress)
+				if results[i].err == nil {
+					event := ProgressEvent{
+						Phase:       ProgressMigrationCompleted,
+						Step:        step,
+						Total:       total,
+						MigrationID: migration.ID,
+						Direction:   "up",
+						Percent:     planPercent(int(atomic.AddInt32(&completed, 1)), total),
+					}
+					if e.verbose {
+						event.Message = fmt.Sprintf("Migration %s completed in %v", migration.ID, results[i].duration)
+					}
+					progress.Report(event)
+				}
+			}(i, migration)
+		}
+		wg.Wait()
+		done += len(wave)
+
+		if err := e.recordWave(plan, wave, results, progress); err != nil {
+			return err
+		}
+	}
+	if err := e.continuedFailure(); err != nil {
+		return err
+	}
+
+	reportf(progress, ProgressPlanCompleted, "Upgrade completed successfully")
+	return nil
+}
+
+// recordWave records the results of a wave in plan order: every successful
+// migration is marked as applied and every failed best-effort migration is
+// recorded, then the other failures are handled as the failure policy says.
+// Unless the policy is FailureContinue, it applies to the first failure only,
+// after the others were recorded as failed. Migrations canceled with the plan
+// are left marked as running, unless another migration of the wave failed: they
+// are then recorded as failed before the failure policy applies.
+func (e *MigrationEngine) recordWave(plan *ExecutionPlan, wave []*Migration, results []waveResult, progress ProgressReporter) error {
+	for _, r := range results {
+		if errors.Is(r.err, ErrSimulatedCrash) {
+			return r.err
+		}
+	}
+
+	var failed, canceled []int
+	// Keep the schema marked as migrating until the whole wave is recorded
+	markRest := func(i int) error {
+		if i == len(wave)-1 {
+			return nil
+		}
+		if err := e.schemaManager.MarkMigrationStarted(migrationIDs(wave[i+1:])...); err != nil {
+			return fmt.Errorf("failed to mark migration as started: %w", err)
+		}
+		return nil
+	}
+	for i, migration := range wave {
+		if results[i].err != nil && e.canceledDuring(results[i].err) {
+			canceled = append(canceled, i)
+			continue
+		}
+		if results[i].err != nil && migration.BestEffort {
+			if err := e.bestEffortFailed(migration, results[i].duration, results[i].err, progress); err != nil {
+				return err
+			}
+			if err := markRest(i); err != nil {
+				return err
+			}
+			continue
+		}
+		if results[i].err != nil {
+			failed = append(failed, i)
+			continue
+		}
+
+		if migration.HasAutomaticDown() {
+			if err := e.schemaManager.SaveUndoLog(results[i].log); err != nil {
+				return err
+			}
+		}
+		if err := e.schemaManager.ClearMigrationProgress(migration.ID); err != nil {
+			return err
+		}
+		record := StepEvent{Step: StepRecord, MigrationID: migration.ID, Direction: "up"}
+		if err := e.interceptStep(record, func() error {
+			return e.schemaManager.UpdateSchemaAfterMigration(migration.ID, migration.Version, migration.Description, results[i].duration)
+		}); err != nil {
+			return fmt.Errorf("failed to update schema version after migration %s: %w", migration.ID, err)
+		}
+		if err := markRest(i); err != nil {
+			return err
+		}
+	}
+
+	var canceledIDs []string
+	for _, i := range canceled {
+		canceledIDs = append(canceledIDs, wave[i].ID)
+	}
+	if len(canceled) > 0 && len(failed) == 0 {
+		if err := e.schemaManager.MarkMigrationStarted(canceledIDs...); err != nil {
+			return fmt.Errorf("failed to mark migration as started: %w", err)
+		}
+		return fmt.Errorf("migrations %s were canceled and are left interrupted: %w",
+			strings.Join(canceledIDs, ", "), results[canceled[0]].err)
+	}
+
+	// The state cannot be both dirty and interrupted, so the canceled migrations
+	// fail with the others, keeping their partial writes in the history
+	for _, i := range canceled {
+		if err := e.schemaManager.MarkMigrationFailed(wave[i].ID, wave[i].Description, results[i].duration, results[i].err); err != nil {
+			return fmt.Errorf("migration canceled and failed to mark as failed: %w (original error: %v)", err, results[i].err)
+		}
+	}
+	// Unless the plan continues past failures, the policy applies once, to the
+	// first failure; the others are recorded as failed before, so that their
+	// partial writes show in the history too
+	var otherIDs []string
+	if e.failurePolicy != FailureContinue && len(failed) > 1 {
+		for _, i := range failed[1:] {
+			if err := e.schemaManager.MarkMigrationFailed(wave[i].ID, wave[i].Description, results[i].duration, results[i].err); err != nil {
+				return fmt.Errorf("migration failed and failed to mark as failed: %w (original error: %v)", err, results[i].err)
+			}
+			otherIDs = append(otherIDs, wave[i].ID)
+		}
+		failed = failed[:1]
+	}
+	for _, i := range failed {
+		if err := e.migrationFailed(plan, wave[i], results[i].duration, results[i].err, progress); err != nil {
+			if len(otherIDs) > 0 {
+				err = fmt.Errorf("%w (and migrations %s of the same wave failed too)", err, strings.Join(otherIDs, ", "))
+			}
+			if len(canceled) > 0 {
+				return fmt.Errorf("%w (and migrations %s were canceled and marked as failed: %v)",
+					err, strings.Join(canceledIDs, ", "), results[canceled[0]].err)
+			}
+			return err
+		}
+	}
+	if len(canceled) > 0 {
+		// The failures were continued past, but the plan is canceled
+		err := fmt.Errorf("migrations %s were canceled and marked as failed: %w",
+			strings.Join(canceledIDs, ", "), results[canceled[0]].err)
+		if failErr := e.continuedFailure(); failErr != nil {
+			return fmt.Errorf("%w (after %v)", err, failErr)
+		}
+		return err
+	}
+	return nil
+}
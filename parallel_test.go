@@ -0,0 +1,208 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestPlanWaves(t *testing.T) {
+	m := func(id string, deps []string, prefixes ...string) *Migration {
+		return &Migration{ID: id, Dependencies: deps, KeyPrefixes: prefixes}
+	}
+
+	tests := []struct {
+		name       string
+		aliases    map[string]string
+		migrations []*Migration
+		expected   [][]string
+	}{
+		{
+			name: "DisjointPrefixes",
+			migrations: []*Migration{
+				m("1", nil, "user:"),
+				m("2", nil, "order:"),
+				m("3", nil, "item:", "stock:"),
+			},
+			expected: [][]string{{"1", "2", "3"}},
+		},
+		{
+			name: "OverlappingPrefixes",
+			migrations: []*Migration{
+				m("1", nil, "user:"),
+				m("2", nil, "user:email:"),
+				m("3", nil, "order:"),
+			},
+			expected: [][]string{{"1"}, {"2", "3"}},
+		},
+		{
+			name: "Dependency",
+			migrations: []*Migration{
+				m("1", nil, "user:"),
+				m("2", []string{"1"}, "order:"),
+			},
+			expected: [][]string{{"1"}, {"2"}},
+		},
+		{
+			name:    "AliasedDependency",
+			aliases: map[string]string{"0": "1"},
+			migrations: []*Migration{
+				m("1", nil, "user:"),
+				m("2", []string{"0"}, "order:"),
+			},
+			expected: [][]string{{"1"}, {"2"}},
+		},
+		{
+			name: "UndeclaredPrefixes",
+			migrations: []*Migration{
+				m("1", nil, "user:"),
+				m("2", nil),
+				m("3", nil, "order:"),
+			},
+			expected: [][]string{{"1"}, {"2"}, {"3"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewMigrationRegistry()
+			for oldID, newID := range tt.aliases {
+				if err := registry.RegisterAlias(oldID, newID); err != nil {
+					t.Fatalf("Failed to register alias: %v", err)
+				}
+			}
+
+			var got [][]string
+			for _, wave := range planWaves(registry, tt.migrations) {
+				var ids []string
+				for _, migration := range wave {
+					ids = append(ids, migration.ID)
+				}
+				got = append(got, ids)
+			}
+
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected waves %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if len(got[i]) != len(tt.expected[i]) {
+					t.Fatalf("Expected waves %v, got %v", tt.expected, got)
+				}
+				for j := range got[i] {
+					if got[i][j] != tt.expected[i][j] {
+						t.Fatalf("Expected waves %v, got %v", tt.expected, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParallelUpgrade(t *testing.T) {
+	setup := func(t *testing.T, registry *MigrationRegistry) (*pebble.DB, *SchemaManager, *MigrationEngine) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupEnabled(false)
+		engine.SetParallelism(4)
+		return db, schemaManager, engine
+	}
+
+	t.Run("ConcurrentWithPlanOrderHistory", func(t *testing.T) {
+		var running, maxRunning int32
+		migration := func(id, prefix string, delay time.Duration) *Migration {
+			return &Migration{
+				ID:          id,
+				KeyPrefixes: []string{prefix},
+				Up: func(db *pebble.DB) error {
+					n := atomic.AddInt32(&running, 1)
+					defer atomic.AddInt32(&running, -1)
+					for {
+						m := atomic.LoadInt32(&maxRunning)
+						if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+							break
+						}
+					}
+					// Later migrations finish first
+					time.Sleep(delay)
+					return db.Set([]byte(prefix+"done"), []byte("x"), pebble.Sync)
+				},
+				Down: func(db *pebble.DB) error { return nil },
+			}
+		}
+
+		registry := NewMigrationRegistry()
+		registry.Register(migration("1754917200_users", "user:", 60*time.Millisecond))
+		registry.Register(migration("1754917300_orders", "order:", 30*time.Millisecond))
+		registry.Register(migration("1754917400_items", "item:", 0))
+		_, schemaManager, engine := setup(t, registry)
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Parallel upgrade failed: %v", err)
+		}
+
+		if maxRunning < 2 {
+			t.Errorf("Expected migrations to run concurrently, at most %d ran at once", maxRunning)
+		}
+
+		schema, _ := schemaManager.GetSchemaVersion()
+		if schema.Status != StatusClean || schema.CurrentVersion != 1754917400 {
+			t.Errorf("Expected clean schema at 1754917400, got %s at %d", schema.Status, schema.CurrentVersion)
+		}
+		history, _ := schemaManager.GetMigrationHistory()
+		expected := []string{"1754917200_users", "1754917300_orders", "1754917400_items"}
+		if len(history) != len(expected) {
+			t.Fatalf("Expected %d history records, got %d", len(expected), len(history))
+		}
+		for i, id := range expected {
+			if history[i].ID != id {
+				t.Errorf("Expected history record %d to be %s, got %s", i, id, history[i].ID)
+			}
+		}
+	})
+
+	t.Run("FailureRecordsSucceededMigrations", func(t *testing.T) {
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{
+			ID:          "1754917200_users",
+			KeyPrefixes: []string{"user:"},
+			Up:          func(db *pebble.DB) error { return errors.New("boom") },
+			Down:        func(db *pebble.DB) error { return nil },
+		})
+		registry.Register(&Migration{
+			ID:          "1754917300_orders",
+			KeyPrefixes: []string{"order:"},
+			Apply: func(w *Writer) error {
+				return w.Set([]byte("order:1"), []byte("x"))
+			},
+		})
+		_, schemaManager, engine := setup(t, registry)
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err == nil {
+			t.Fatal("Expected parallel upgrade to fail")
+		}
+
+		schema, _ := schemaManager.GetSchemaVersion()
+		if schema.Status != StatusDirty {
+			t.Errorf("Expected dirty status, got %s", schema.Status)
+		}
+		if applied, _ := schemaManager.IsMigrationApplied("1754917300_orders"); !applied {
+			t.Error("Expected the succeeded migration to be recorded as applied")
+		}
+		if _, err := schemaManager.LoadUndoLog("1754917300_orders"); err != nil {
+			t.Errorf("Expected undo log of the succeeded migration to be stored: %v", err)
+		}
+	})
+}
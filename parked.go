@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// parkedInfix follows the key prefix in the keys parked migrations are stored under
+const parkedInfix = "parked/"
+
+// ParkedMigration is a pending migration excluded from upgrade plans until it is
+// unparked, e.g. a slow backfill that must not hold back the startup of
+// unrelated fixes. See SchemaManager.ParkMigration.
+type ParkedMigration struct {
+	ID       string    `json:"id"`
+	Reason   string    `json:"reason,omitempty"`
+	ParkedAt time.Time `json:"parked_at"`
+}
+
+// parkedKey returns the internal key a parked migration is stored under
+func (s *SchemaManager) parkedKey(migrationID string) []byte {
+	return []byte(s.keyPrefix + parkedInfix + migrationID)
+}
+
+// ParkMigration parks a pending migration: PlanUpgrade and PlanUpgradeTo leave
+// it, and the pending migrations depending on it, out of their plans and list
+// them in ExecutionPlan.Parked instead, until UnparkMigration is called. Applying
+// it explicitly with MigrationEngine.ApplyOne still works. Parking a migration
+// again replaces its reason.
+func (s *SchemaManager) ParkMigration(migrationID, reason string) error {
+	applied, err := s.IsMigrationApplied(migrationID)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return fmt.Errorf("migration %s is already applied", migrationID)
+	}
+
+	data, err := json.Marshal(&ParkedMigration{ID: migrationID, Reason: reason, ParkedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	if err := s.db.Set(s.parkedKey(migrationID), data, pebble.Sync); err != nil {
+		return fmt.Errorf("failed to park migration %s: %w", migrationID, err)
+	}
+	return nil
+}
+
+// UnparkMigration returns a parked migration to upgrade plans. Unparking a
+// migration that is not parked does nothing.
+func (s *SchemaManager) UnparkMigration(migrationID string) error {
+	if err := s.db.Delete(s.parkedKey(migrationID), pebble.Sync); err != nil {
+		return fmt.Errorf("failed to unpark migration %s: %w", migrationID, err)
+	}
+	return nil
+}
+
+// ListParkedMigrations returns the parked migrations, ordered by ID
+func (s *SchemaManager) ListParkedMigrations() ([]*ParkedMigration, error) {
+	prefix := []byte(s.keyPrefix + parkedInfix)
+	iter, err := s.db.NewIter(&pebble.IterOptions{LowerBound: prefix, UpperBound: prefixUpperBound(prefix)})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var list []*ParkedMigration
+	for iter.First(); iter.Valid(); iter.Next() {
+		var parked ParkedMigration
+		if err := json.Unmarshal(iter.Value(), &parked); err != nil {
+			return nil, fmt.Errorf("%w: parked migration key %s: %v", ErrCorruptSchemaState, iter.Key(), err)
+		}
+		list = append(list, &parked)
+	}
+	return list, iter.Error()
+}
+
+// holdParked moves the parked migrations of an upgrade plan, and those depending
+// on them, from Migrations to Parked
+func (p *MigrationPlanner) holdParked(plan *ExecutionPlan) error {
+	parked, err := p.schema.ListParkedMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to get parked migrations: %w", err)
+	}
+	if len(parked) == 0 {
+		return nil
+	}
+
+	held := make(map[string]bool)
+	for _, m := range parked {
+		held[p.registry.ResolveID(m.ID)] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, m := range plan.Migrations {
+			for _, depID := range m.Dependencies {
+				if !held[m.ID] && held[p.registry.ResolveID(depID)] {
+					held[m.ID] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	var run []*Migration
+	for _, m := range plan.Migrations {
+		if held[m.ID] {
+			plan.Parked = append(plan.Parked, m)
+		} else {
+			run = append(run, m)
+		}
+	}
+	plan.Migrations = run
+	plan.EstimatedSteps = len(run)
+	return nil
+}
@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestParkedMigrations(t *testing.T) {
+	db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	noop := func(db *pebble.DB) error { return nil }
+	registry := NewMigrationRegistry()
+	for _, m := range []*Migration{
+		{ID: "1754917200_backfill", Up: noop, Down: noop},
+		{ID: "1754917300_fix", Up: noop, Down: noop},
+		{ID: "1754917400_after_backfill", Up: noop, Down: noop, Dependencies: []string{"1754917200_backfill"}},
+	} {
+		if err := registry.Register(m); err != nil {
+			t.Fatalf("Failed to register %s: %v", m.ID, err)
+		}
+	}
+	schemaManager := NewSchemaManager(db)
+	planner := NewMigrationPlanner(registry, schemaManager)
+
+	if err := schemaManager.ParkMigration("1754917200_backfill", "maintenance window"); err != nil {
+		t.Fatalf("Failed to park: %v", err)
+	}
+	parked, err := schemaManager.ListParkedMigrations()
+	if err != nil || len(parked) != 1 || parked[0].ID != "1754917200_backfill" || parked[0].Reason != "maintenance window" {
+		t.Fatalf("Expected the parked migration to be listed, got %v, %v", parked, err)
+	}
+
+	// The parked migration and its dependent are left out of upgrades
+	plan, err := planner.PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if len(plan.Migrations) != 1 || plan.Migrations[0].ID != "1754917300_fix" || plan.TargetVersion != 1754917300 {
+		t.Errorf("Expected only the fix to be planned, got %v", plan.Migrations)
+	}
+	if len(plan.Parked) != 2 || plan.Parked[0].ID != "1754917200_backfill" || plan.Parked[1].ID != "1754917400_after_backfill" {
+		t.Errorf("Expected the backfill and its dependent to be parked, got %v", plan.Parked)
+	}
+	planTo, err := planner.PlanUpgradeTo(1754917400)
+	if err != nil || len(planTo.Migrations) != 1 || len(planTo.Parked) != 2 {
+		t.Errorf("Expected PlanUpgradeTo to leave out parked migrations, got %v, %v", planTo, err)
+	}
+
+	// Unparking returns them to the plan
+	if err := schemaManager.UnparkMigration("1754917200_backfill"); err != nil {
+		t.Fatalf("Failed to unpark: %v", err)
+	}
+	plan, err = planner.PlanUpgrade()
+	if err != nil || len(plan.Migrations) != 3 || len(plan.Parked) != 0 {
+		t.Errorf("Expected all migrations to be planned after unparking, got %v, %v", plan, err)
+	}
+
+	// Applied migrations cannot be parked
+	if err := schemaManager.UpdateSchemaAfterMigration("1754917300_fix", 1754917300, "", 0); err != nil {
+		t.Fatalf("Failed to update schema: %v", err)
+	}
+	if err := schemaManager.ParkMigration("1754917300_fix", ""); err == nil {
+		t.Errorf("Expected parking an applied migration to fail")
+	}
+}
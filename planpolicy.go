@@ -0,0 +1,156 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PolicyContext is what a plan policy decides on
+type PolicyContext struct {
+	Plan          *ExecutionPlan
+	Environment   string // Environment the schema state is stamped with, "" if unstamped
+	BackupEnabled bool   // Whether the engine backs up the database before the plan
+	DryRun        bool   // Whether the plan is only simulated or run against a copy
+}
+
+// PolicyViolation is a reason a plan policy refuses a plan
+type PolicyViolation struct {
+	Policy      string // Name of the policy, e.g. "max-migrations"
+	MigrationID string // Migration the violation is about, "" for the whole plan
+	Message     string
+}
+
+// String returns a human-readable description of the violation
+func (v PolicyViolation) String() string {
+	if v.MigrationID != "" {
+		return fmt.Sprintf("%s: %s: %s", v.Policy, v.MigrationID, v.Message)
+	}
+	return fmt.Sprintf("%s: %s", v.Policy, v.Message)
+}
+
+// PolicyFunc approves a plan before the engine executes it, returning the
+// violations that refuse it, or none. See MigrationEngine.AddPolicy.
+type PolicyFunc func(ctx PolicyContext) []PolicyViolation
+
+// PolicyError is returned when plan policies refuse a plan. It matches
+// ErrPolicyViolation with errors.Is.
+type PolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.String()
+	}
+	return fmt.Sprintf("%v: %s", ErrPolicyViolation, strings.Join(messages, "; "))
+}
+
+func (e *PolicyError) Unwrap() error {
+	return ErrPolicyViolation
+}
+
+// AddPolicy adds a policy the engine evaluates before executing a plan, dry runs
+// included. A plan any policy refuses is not executed and fails with a
+// *PolicyError listing the violations of all policies.
+func (e *MigrationEngine) AddPolicy(policy PolicyFunc) {
+	e.policies = append(e.policies, policy)
+}
+
+// CheckPolicies evaluates the policies of the engine against plan, e.g. to report
+// violations before asking for confirmation. It returns a *PolicyError if any
+// policy refuses the plan.
+func (e *MigrationEngine) CheckPolicies(plan *ExecutionPlan) error {
+	if len(e.policies) == 0 {
+		return nil
+	}
+	environment, err := e.schemaManager.GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("failed to read environment for plan policies: %w", err)
+	}
+	ctx := PolicyContext{
+		Plan:          plan,
+		Environment:   environment,
+		BackupEnabled: e.enableBackup && e.backupManager != nil,
+		DryRun:        e.dryRun,
+	}
+
+	var violations []PolicyViolation
+	for _, policy := range e.policies {
+		violations = append(violations, policy(ctx)...)
+	}
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// MaxMigrationsPolicy refuses plans of more than max migrations, so large
+// catch-ups are split into reviewed steps, e.g. with 'up --to'
+func MaxMigrationsPolicy(max int) PolicyFunc {
+	return func(ctx PolicyContext) []PolicyViolation {
+		if len(ctx.Plan.Migrations) <= max {
+			return nil
+		}
+		return []PolicyViolation{{
+			Policy:  "max-migrations",
+			Message: fmt.Sprintf("plan has %d migrations, more than the allowed %d", len(ctx.Plan.Migrations), max),
+		}}
+	}
+}
+
+// ForbidDowngradePolicy refuses downgrade plans on databases stamped with one of
+// environments (see SchemaManager.SetEnvironment), or on every database if none
+// are given. Dry runs are allowed.
+func ForbidDowngradePolicy(environments ...string) PolicyFunc {
+	return func(ctx PolicyContext) []PolicyViolation {
+		if ctx.Plan.Type != ExecutionTypeDowngrade || ctx.DryRun || len(ctx.Plan.Migrations) == 0 {
+			return nil
+		}
+		if len(environments) == 0 {
+			return []PolicyViolation{{Policy: "forbid-downgrade", Message: "downgrades are not allowed"}}
+		}
+		for _, env := range environments {
+			if env == ctx.Environment {
+				return []PolicyViolation{{
+					Policy:  "forbid-downgrade",
+					Message: fmt.Sprintf("downgrades are not allowed in environment %q", env),
+				}}
+			}
+		}
+		return nil
+	}
+}
+
+// RequireBackupPolicy refuses plans that run a migration tagged with one of tags
+// (see Migration.Tags) without a backup. Dry runs are allowed.
+func RequireBackupPolicy(tags ...string) PolicyFunc {
+	return func(ctx PolicyContext) []PolicyViolation {
+		if ctx.BackupEnabled || ctx.DryRun {
+			return nil
+		}
+		var violations []PolicyViolation
+		for _, m := range ctx.Plan.Migrations {
+			if tag := firstMatchingTag(m.Tags, tags); tag != "" {
+				violations = append(violations, PolicyViolation{
+					Policy:      "require-backup",
+					MigrationID: m.ID,
+					Message:     fmt.Sprintf("migrations tagged %q must run with a backup", tag),
+				})
+			}
+		}
+		return violations
+	}
+}
+
+// firstMatchingTag returns the first of tags that is in wanted, or ""
+func firstMatchingTag(tags, wanted []string) string {
+	for _, tag := range tags {
+		for _, w := range wanted {
+			if tag == w {
+				return tag
+			}
+		}
+	}
+	return ""
+}
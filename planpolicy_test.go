@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestPlanPolicies(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	schemaManager := NewSchemaManager(db)
+	noop := func(db *pebble.DB) error { return nil }
+	registry := NewMigrationRegistry()
+	for _, m := range []*Migration{
+		{ID: "1754917200_first", Up: noop, Down: noop},
+		{ID: "1754917300_backfill", Up: noop, Down: noop, Tags: []string{"heavy"}},
+	} {
+		if err := registry.Register(m); err != nil {
+			t.Fatalf("Failed to register: %v", err)
+		}
+	}
+	planner := NewMigrationPlanner(registry, schemaManager)
+
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+	engine.AddPolicy(MaxMigrationsPolicy(1))
+	engine.AddPolicy(RequireBackupPolicy("heavy"))
+	engine.AddPolicy(ForbidDowngradePolicy("production"))
+
+	plan, err := planner.PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	err = engine.ExecutePlan(plan, nil)
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("Expected a *PolicyError, got %v", err)
+	}
+	if len(policyErr.Violations) != 2 {
+		t.Fatalf("Expected 2 violations, got %v", policyErr.Violations)
+	}
+	if v := policyErr.Violations[1]; v.Policy != "require-backup" || v.MigrationID != "1754917300_backfill" {
+		t.Errorf("Expected the heavy migration to require a backup, got %v", v)
+	}
+	if schema, err := schemaManager.GetSchemaVersion(); err != nil || len(schema.AppliedMigrations) > 0 {
+		t.Errorf("Expected a refused plan not to run, got %+v, %v", schema, err)
+	}
+
+	// Dry runs only check the plan size
+	engine.SetDryRun(true)
+	engine.SetDryRunExecute(false)
+	if err := engine.CheckPolicies(plan); err == nil || len(err.(*PolicyError).Violations) != 1 {
+		t.Errorf("Expected only the size violation in a dry run, got %v", err)
+	}
+	engine.SetDryRun(false)
+
+	// One migration at a time, the heavy one with a backup
+	plan, err = planner.PlanUpgradeTo(1754917200)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Expected the first migration to be approved, got %v", err)
+	}
+	engine.SetBackupEnabled(true)
+	plan, err = planner.PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.CheckPolicies(plan); err != nil {
+		t.Errorf("Expected the heavy migration to be approved with a backup, got %v", err)
+	}
+
+	// Downgrades are refused once the database is stamped production
+	plan, err = planner.PlanDowngrade(0)
+	if err != nil {
+		t.Fatalf("Failed to plan downgrade: %v", err)
+	}
+	if err := engine.CheckPolicies(plan); err != nil {
+		t.Errorf("Expected the downgrade of an unstamped database to be approved, got %v", err)
+	}
+	if err := schemaManager.SetEnvironment("production"); err != nil {
+		t.Fatalf("Failed to stamp: %v", err)
+	}
+	if err := engine.CheckPolicies(plan); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("Expected the downgrade to be refused in production, got %v", err)
+	}
+}
+
+func TestStartupPolicies(t *testing.T) {
+	originalRegistry := GlobalRegistry
+	defer func() { GlobalRegistry = originalRegistry }()
+
+	GlobalRegistry = NewMigrationRegistry()
+	noop := func(db *pebble.DB) error { return nil }
+	for _, id := range []string{"1754917200_first", "1754917300_second"} {
+		GlobalRegistry.Register(&Migration{ID: id, Up: noop, Down: noop})
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := NewSchemaManager(db).InitializeFreshDatabase(NewMigrationRegistry()); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+
+	opts := DefaultStartupOptions()
+	opts.RunMigrations = true
+	opts.CheckDiskSpace = false
+	opts.Policies = []PolicyFunc{MaxMigrationsPolicy(1)}
+	if err := CheckAndRunStartupMigrations(db, dbPath, opts); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("Expected startup to fail with ErrPolicyViolation, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// plansInfix follows the key prefix in the keys plan records are stored under
+const plansInfix = "plans/"
+
+// PlanRecord records an executed plan. The history records of its migrations
+// are the ones recorded between StartedAt and FinishedAt.
+type PlanRecord struct {
+	Type          ExecutionType `json:"type"`
+	Migrations    []string      `json:"migrations"`
+	FromVersion   int64         `json:"from_version"`
+	TargetVersion int64         `json:"target_version"`
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at"`
+	Duration      time.Duration `json:"duration_ns"`
+	DurationText  string        `json:"duration"` // Duration formatted for display
+	BackupPath    string        `json:"backup_path,omitempty"`
+	Success       bool          `json:"success"`
+	Error         string        `json:"error,omitempty"`
+
+	// Deferred lists the migrations of the plan left pending by the batch limits
+	// (see MigrationEngine.SetBatchLimits). Migrations and TargetVersion then
+	// describe the part that ran.
+	Deferred []string `json:"deferred,omitempty"`
+
+	// Skipped lists the migrations of the plan left pending because a best-effort
+	// migration failed, or any migration with FailureContinue: the failed
+	// migrations and those depending on them (see Migration.BestEffort and
+	// MigrationEngine.SetFailurePolicy). Migrations and TargetVersion leave them out.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// Contains reports whether a history record was recorded during the plan
+func (p *PlanRecord) Contains(record MigrationRecord) bool {
+	return !record.AppliedAt.Before(p.StartedAt) && !record.AppliedAt.After(p.FinishedAt)
+}
+
+// planKey returns the internal key a plan record is stored under, keyed by its
+// start time in Unix nanoseconds like history records
+func (s *SchemaManager) planKey(ts int64) []byte {
+	return []byte(fmt.Sprintf("%s%s%020d", s.keyPrefix, plansInfix, ts))
+}
+
+// plansPrefix returns the prefix of all plan record keys
+func (s *SchemaManager) plansPrefix() []byte {
+	return []byte(s.keyPrefix + plansInfix)
+}
+
+// RecordPlan stores a plan record
+func (s *SchemaManager) RecordPlan(record PlanRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan record: %w", err)
+	}
+	if err := s.db.Set(s.planKey(record.StartedAt.UnixNano()), data, pebble.Sync); err != nil {
+		return fmt.Errorf("failed to record plan: %w", err)
+	}
+	return nil
+}
+
+// PlanHistory returns the recorded plans, oldest first
+func (s *SchemaManager) PlanHistory() ([]PlanRecord, error) {
+	prefix := s.plansPrefix()
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixUpperBound(prefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan history: %w", err)
+	}
+	defer iter.Close()
+
+	var records []PlanRecord
+	for iter.First(); iter.Valid(); iter.Next() {
+		var record PlanRecord
+		if err := json.Unmarshal(iter.Value(), &record); err != nil {
+			return nil, fmt.Errorf("%w: plan record %s: %v", ErrCorruptSchemaState, iter.Key(), err)
+		}
+		records = append(records, record)
+	}
+	return records, iter.Error()
+}
+
+// recordPlan records an executed plan. Plans without migrations, dry runs and
+// simulated crashes are not recorded.
+func (e *MigrationEngine) recordPlan(plan *ExecutionPlan, start time.Time, err error, progress ProgressReporter) {
+	if len(plan.Migrations) == 0 || e.dryRun || e.inDryRun || errors.Is(err, ErrSimulatedCrash) {
+		return
+	}
+
+	finished := time.Now()
+	record := PlanRecord{
+		Type:          plan.Type,
+		FromVersion:   plan.CurrentVersion,
+		TargetVersion: plan.TargetVersion,
+		StartedAt:     start,
+		FinishedAt:    finished,
+		Duration:      finished.Sub(start),
+		DurationText:  finished.Sub(start).String(),
+		BackupPath:    e.planBackup,
+		Success:       err == nil,
+	}
+	deferred := make(map[string]bool, len(e.deferred))
+	for _, migration := range e.deferred {
+		deferred[migration.ID] = true
+		record.Deferred = append(record.Deferred, migration.ID)
+	}
+	for _, migration := range e.skipped {
+		deferred[migration.ID] = true
+		record.Skipped = append(record.Skipped, migration.ID)
+	}
+	for _, migration := range plan.Migrations {
+		if !deferred[migration.ID] {
+			record.Migrations = append(record.Migrations, migration.ID)
+		}
+	}
+	if len(deferred) > 0 {
+		if schema, schemaErr := e.schemaManager.GetSchemaVersion(); schemaErr == nil {
+			record.TargetVersion = schema.CurrentVersion
+		}
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	if recordErr := e.schemaManager.RecordPlan(record); recordErr != nil {
+		e.warnf(progress, "plan history", "%v", recordErr)
+	}
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestPlanHistory(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	registry.Register(&Migration{
+		ID:   "1754917200_first",
+		Up:   func(db *pebble.DB) error { return nil },
+		Down: func(db *pebble.DB) error { return nil },
+	})
+	registry.Register(&Migration{
+		ID:   "1754917300_second",
+		Up:   func(db *pebble.DB) error { return nil },
+		Down: func(db *pebble.DB) error { return nil },
+	})
+	registry.Register(&Migration{
+		ID:   "1754917400_third",
+		Up:   func(db *pebble.DB) error { return errors.New("boom") },
+		Down: func(db *pebble.DB) error { return nil },
+	})
+
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	planner := NewMigrationPlanner(registry, schemaManager)
+
+	plan, err := planner.PlanUpgradeTo(1754917300)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+
+	engine.SetBackupEnabled(false)
+	plan, err = planner.PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err == nil {
+		t.Fatalf("Expected the plan to fail")
+	}
+
+	plans, err := schemaManager.PlanHistory()
+	if err != nil {
+		t.Fatalf("Failed to read plan history: %v", err)
+	}
+	if len(plans) != 2 {
+		t.Fatalf("Expected 2 plans, got %+v", plans)
+	}
+	if p := plans[0]; !p.Success || p.Type != ExecutionTypeUpgrade || len(p.Migrations) != 2 || p.BackupPath == "" || p.TargetVersion != 1754917300 {
+		t.Errorf("Unexpected first plan: %+v", p)
+	}
+	if p := plans[1]; p.Success || p.Error == "" || p.BackupPath != "" || len(p.Migrations) != 1 {
+		t.Errorf("Unexpected second plan: %+v", p)
+	}
+
+	history, err := schemaManager.GetMigrationHistory()
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 history records, got %d", len(history))
+	}
+	for i, record := range history {
+		inFirst := plans[0].Contains(record)
+		if inFirst != (i < 2) || plans[1].Contains(record) != (i == 2) {
+			t.Errorf("Record %s grouped wrongly", record.ID)
+		}
+	}
+
+	t.Run("DryRunIsNotRecorded", func(t *testing.T) {
+		engine.SetDryRun(true)
+		engine.SetDryRunExecute(false)
+		defer engine.SetDryRun(false)
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to execute dry run: %v", err)
+		}
+		if plans, _ := schemaManager.PlanHistory(); len(plans) != 2 {
+			t.Errorf("Expected no plan to be recorded for a dry run, got %d plans", len(plans))
+		}
+	})
+}
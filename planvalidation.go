@@ -0,0 +1,214 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// PlanValidatorFunc checks the database after a plan completed, returning an
+// error if the data is inconsistent. Unlike Migration.Validate it is not tied to
+// a migration, so it can check invariants spanning the data of several, e.g.
+// that every order references an existing user. See MigrationEngine.AddPlanValidator.
+type PlanValidatorFunc func(db *pebble.DB, plan *ExecutionPlan) error
+
+// PlanValidationAction is what the engine does when plan validators fail
+type PlanValidationAction string
+
+const (
+	// PlanValidationFail fails the plan, leaving the migrations applied
+	PlanValidationFail PlanValidationAction = "fail"
+	// PlanValidationRollback fails the plan and rolls back the migrations an
+	// upgrade plan applied. Other plans fail as with PlanValidationFail.
+	PlanValidationRollback PlanValidationAction = "rollback"
+	// PlanValidationAlert reports the failures as warnings; the plan succeeds
+	PlanValidationAlert PlanValidationAction = "alert"
+)
+
+// ParsePlanValidationAction parses a plan validation action name, "" being
+// PlanValidationFail
+func ParsePlanValidationAction(name string) (PlanValidationAction, error) {
+	switch PlanValidationAction(strings.ToLower(name)) {
+	case "", PlanValidationFail:
+		return PlanValidationFail, nil
+	case PlanValidationRollback:
+		return PlanValidationRollback, nil
+	case PlanValidationAlert:
+		return PlanValidationAlert, nil
+	default:
+		return "", fmt.Errorf("unknown plan validation action %q (expected fail, rollback or alert)", name)
+	}
+}
+
+// PlanValidationFailure is a plan validator that failed
+type PlanValidationFailure struct {
+	Validator string // Name the validator was added with
+	Err       error
+}
+
+// String returns the validator name and its error
+func (f PlanValidationFailure) String() string {
+	return fmt.Sprintf("%s: %v", f.Validator, f.Err)
+}
+
+// PlanValidationError is returned when plan validators fail a plan. It matches
+// ErrPlanValidation with errors.Is.
+type PlanValidationError struct {
+	Failures   []PlanValidationFailure
+	RolledBack []string // Migrations rolled back with PlanValidationRollback, in rollback order
+}
+
+func (e *PlanValidationError) Error() string {
+	messages := make([]string, len(e.Failures))
+	for i, failure := range e.Failures {
+		messages[i] = failure.String()
+	}
+	message := fmt.Sprintf("%v: %s", ErrPlanValidation, strings.Join(messages, "; "))
+	if len(e.RolledBack) > 0 {
+		message += fmt.Sprintf(" (rolled back %d migrations)", len(e.RolledBack))
+	}
+	return message
+}
+
+func (e *PlanValidationError) Unwrap() error {
+	return ErrPlanValidation
+}
+
+// planValidator is a validator added with RegisterPlanValidator or AddPlanValidator
+type planValidator struct {
+	name     string
+	validate PlanValidatorFunc
+}
+
+// RegisterPlanValidator registers a plan validator in the global registry, see
+// MigrationRegistry.RegisterPlanValidator
+func RegisterPlanValidator(name string, validator PlanValidatorFunc) error {
+	return GlobalRegistry.RegisterPlanValidator(name, validator)
+}
+
+// RegisterPlanValidator registers a validator that every engine executing the
+// migrations of the registry runs after a plan, like one added with
+// MigrationEngine.AddPlanValidator. Registering it next to the migrations, e.g.
+// in an init function, makes the CLI run it too.
+func (r *MigrationRegistry) RegisterPlanValidator(name string, validator PlanValidatorFunc) error {
+	if name == "" {
+		return fmt.Errorf("plan validator name cannot be empty")
+	}
+	for _, v := range r.planValidators {
+		if v.name == name {
+			return fmt.Errorf("plan validator '%s' already registered", name)
+		}
+	}
+	r.planValidators = append(r.planValidators, planValidator{name: name, validate: validator})
+	return nil
+}
+
+// AddPlanValidator adds a validator the engine runs after every plan that
+// executed migrations and completed, after those registered with the registry
+// and in the order they were added. If any fails, the engine acts as set with
+// SetPlanValidationAction, by default failing the plan with a
+// *PlanValidationError listing the failures of all validators. Dry runs are not
+// validated.
+func (e *MigrationEngine) AddPlanValidator(name string, validator PlanValidatorFunc) {
+	e.planValidators = append(e.planValidators, planValidator{name: name, validate: validator})
+}
+
+// SetPlanValidationAction sets what the engine does when plan validators fail,
+// PlanValidationFail by default
+func (e *MigrationEngine) SetPlanValidationAction(action PlanValidationAction) {
+	e.planValidationAction = action
+}
+
+// validatePlan runs the plan validators after plan completed and acts on their
+// failures
+func (e *MigrationEngine) validatePlan(plan *ExecutionPlan, progress ProgressReporter) error {
+	validators := append(append([]planValidator(nil), e.registry.planValidators...), e.planValidators...)
+	applied := e.executedMigrations(plan)
+	if len(validators) == 0 || len(applied) == 0 {
+		return nil
+	}
+
+	var failures []PlanValidationFailure
+	for _, v := range validators {
+		if err := v.validate(e.db, plan); err != nil {
+			failures = append(failures, PlanValidationFailure{Validator: v.name, Err: err})
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+
+	validationErr := &PlanValidationError{Failures: failures}
+	switch e.planValidationAction {
+	case PlanValidationAlert:
+		for _, failure := range failures {
+			e.warnf(progress, "plan validation", "%s", failure)
+		}
+		return nil
+	case PlanValidationRollback:
+		if plan.Type != ExecutionTypeUpgrade {
+			break
+		}
+		if err := e.rollbackPlan(plan, applied, "plan validation failed", progress); err != nil {
+			return fmt.Errorf("%w (and the rollback failed: %v)", validationErr, err)
+		}
+		for _, m := range reverseMigrations(applied) {
+			validationErr.RolledBack = append(validationErr.RolledBack, m.ID)
+		}
+	}
+	return validationErr
+}
+
+// executedMigrations returns the migrations of plan that were applied, leaving
+// out those deferred by the batch limits or skipped after a failure
+func (e *MigrationEngine) executedMigrations(plan *ExecutionPlan) []*Migration {
+	left := make(map[string]bool, len(e.deferred)+len(e.skipped))
+	for _, m := range append(append([]*Migration(nil), e.deferred...), e.skipped...) {
+		left[m.ID] = true
+	}
+	var executed []*Migration
+	for _, m := range plan.Migrations {
+		if !left[m.ID] {
+			executed = append(executed, m)
+		}
+	}
+	return executed
+}
+
+// rollbackPlan rolls back the migrations an upgrade plan applied, reporting why.
+// The backup taken before the plan already covers the state it returns to, so no
+// other backup is taken.
+func (e *MigrationEngine) rollbackPlan(plan *ExecutionPlan, applied []*Migration, reason string, progress ProgressReporter) error {
+	schema, err := e.schemaManager.GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+	down := &ExecutionPlan{
+		Type:           ExecutionTypeDowngrade,
+		CurrentVersion: schema.CurrentVersion,
+		TargetVersion:  plan.CurrentVersion,
+		Migrations:     reverseMigrations(applied),
+		EstimatedSteps: len(applied),
+	}
+
+	reportf(progress, ProgressWarning, "Warning: %s, rolling back %d migrations", reason, len(applied))
+	enableBackup := e.enableBackup
+	e.enableBackup = false
+	defer func() { e.enableBackup = enableBackup }()
+
+	// The rollback is not canceled with the plan, so that it does not stop halfway
+	ctx := e.ctx
+	e.ctx = nil
+	defer func() { e.ctx = ctx }()
+	return e.executeDowngrade(down, progress)
+}
+
+// reverseMigrations returns migrations in reverse order
+func reverseMigrations(migrations []*Migration) []*Migration {
+	reversed := make([]*Migration, len(migrations))
+	for i, m := range migrations {
+		reversed[len(migrations)-1-i] = m
+	}
+	return reversed
+}
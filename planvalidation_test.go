@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestPlanValidators(t *testing.T) {
+	setup := func(t *testing.T) (*MigrationEngine, *SchemaManager, *MigrationPlanner) {
+		db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		// The second migration writes an order referencing a user nobody created
+		registry := NewMigrationRegistry()
+		for _, m := range []*Migration{
+			{
+				ID:   "1754917200_users",
+				Up:   func(db *pebble.DB) error { return db.Set([]byte("user:1"), []byte("a"), pebble.Sync) },
+				Down: func(db *pebble.DB) error { return db.Delete([]byte("user:1"), pebble.Sync) },
+			},
+			{
+				ID:   "1754917300_orders",
+				Up:   func(db *pebble.DB) error { return db.Set([]byte("order:1"), []byte("user:2"), pebble.Sync) },
+				Down: func(db *pebble.DB) error { return db.Delete([]byte("order:1"), pebble.Sync) },
+			},
+		} {
+			if err := registry.Register(m); err != nil {
+				t.Fatalf("Failed to register %s: %v", m.ID, err)
+			}
+		}
+		// Validators registered with the registry run before those of the engine
+		if err := registry.RegisterPlanValidator("users", func(db *pebble.DB, plan *ExecutionPlan) error {
+			if _, err := getCopy(db, []byte("user:1")); err != nil {
+				return errors.New("user:1 is missing")
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to register validator: %v", err)
+		}
+		if err := registry.RegisterPlanValidator("users", nil); err == nil {
+			t.Fatalf("Expected a duplicate validator name to be refused")
+		}
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, "")
+		engine.SetBackupEnabled(false)
+		engine.AddPlanValidator("order-users", func(db *pebble.DB, plan *ExecutionPlan) error {
+			user, err := getCopy(db, []byte("order:1"))
+			if err == pebble.ErrNotFound {
+				return nil
+			}
+			if _, err := getCopy(db, user); err != nil {
+				return errors.New("order:1 references a missing user")
+			}
+			return nil
+		})
+		return engine, schemaManager, NewMigrationPlanner(registry, schemaManager)
+	}
+
+	execute := func(t *testing.T, engine *MigrationEngine, planner *MigrationPlanner) error {
+		plan, err := planner.PlanUpgrade()
+		if err != nil {
+			t.Fatalf("Failed to plan: %v", err)
+		}
+		return engine.ExecutePlan(plan, nil)
+	}
+
+	t.Run("Fail", func(t *testing.T) {
+		engine, schemaManager, planner := setup(t)
+		err := execute(t, engine, planner)
+		var validationErr *PlanValidationError
+		if !errors.As(err, &validationErr) || !errors.Is(err, ErrPlanValidation) ||
+			len(validationErr.Failures) != 1 || validationErr.Failures[0].Validator != "order-users" {
+			t.Fatalf("Expected the plan to fail validation, got %v", err)
+		}
+		if applied, _ := schemaManager.IsMigrationApplied("1754917300_orders"); !applied {
+			t.Errorf("Expected the migrations to stay applied")
+		}
+		plans, err := schemaManager.PlanHistory()
+		if err != nil || len(plans) != 1 || plans[0].Success {
+			t.Errorf("Expected the plan to be recorded as failed, got %+v, %v", plans, err)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		engine, schemaManager, planner := setup(t)
+		engine.SetPlanValidationAction(PlanValidationRollback)
+		err := execute(t, engine, planner)
+		var validationErr *PlanValidationError
+		if !errors.As(err, &validationErr) || len(validationErr.RolledBack) != 2 ||
+			validationErr.RolledBack[0] != "1754917300_orders" {
+			t.Fatalf("Expected the plan to be rolled back, got %v", err)
+		}
+		version, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to read schema: %v", err)
+		}
+		if len(version.AppliedMigrations) != 0 || version.Status != StatusClean {
+			t.Errorf("Expected a clean schema without applied migrations, got %+v", version)
+		}
+		if _, err := getCopy(engine.DB(), []byte("order:1")); err != pebble.ErrNotFound {
+			t.Errorf("Expected the order to be rolled back, got %v", err)
+		}
+	})
+
+	t.Run("Alert", func(t *testing.T) {
+		engine, _, planner := setup(t)
+		engine.SetPlanValidationAction(PlanValidationAlert)
+		if err := execute(t, engine, planner); err != nil {
+			t.Fatalf("Expected the plan to succeed, got %v", err)
+		}
+		warnings := engine.Warnings()
+		if len(warnings) != 1 || warnings[0].Source != "plan validation" {
+			t.Errorf("Expected the failure as a warning, got %v", warnings)
+		}
+	})
+}
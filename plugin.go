@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PluginSymbol is the symbol a migration plugin may export to provide its
+// migrations. Its type must be func() ([]*migrate.Migration, error).
+const PluginSymbol = "Migrations"
+
+// MigrationFactory returns migrations that are not linked into the binary at
+// build time, such as migrations provided by a Go plugin
+type MigrationFactory func() ([]*Migration, error)
+
+var (
+	factoriesMu sync.Mutex
+	factories   = make(map[string]MigrationFactory)
+	loadedPaths = make(map[string]bool)
+)
+
+// RegisterMigrationFactory registers a named factory. Factories are collected by
+// MigrationRegistry.LoadFactoryMigrations; a plugin can call this from its init
+// function instead of exporting PluginSymbol.
+func RegisterMigrationFactory(name string, factory MigrationFactory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("factory name and function are required")
+	}
+
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, exists := factories[name]; exists {
+		return fmt.Errorf("migration factory '%s' already registered", name)
+	}
+	factories[name] = factory
+	return nil
+}
+
+// LoadPlugins opens every Go plugin (.so) in dir and registers the factory each one
+// exports as PluginSymbol, named after the file. Plugins may also register factories
+// from their init functions. Returns the names of the plugins opened.
+//
+// Go plugins are only supported on Linux, FreeBSD and macOS with cgo enabled, must
+// be built with the same Go toolchain and module versions as the host binary, and
+// can never be unloaded. Treat plugin loading as an opt-in escape hatch for
+// deploying hotfix migrations to long-running services.
+func LoadPlugins(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".so") {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+
+	var loaded []string
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".so")
+		if err := loadPlugin(name, path); err != nil {
+			return loaded, err
+		}
+		loaded = append(loaded, name)
+	}
+
+	return loaded, nil
+}
+
+// loadPlugin opens a single plugin and registers its exported factory
+func loadPlugin(name, path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve plugin path %s: %w", path, err)
+	}
+
+	factoriesMu.Lock()
+	alreadyLoaded := loadedPaths[absPath]
+	factoriesMu.Unlock()
+	if alreadyLoaded {
+		return nil
+	}
+
+	p, err := plugin.Open(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to open plugin %s: %w", path, err)
+	}
+
+	factoriesMu.Lock()
+	loadedPaths[absPath] = true
+	factoriesMu.Unlock()
+
+	symbol, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil // Plugin registers its factories from init
+	}
+
+	fn, ok := symbol.(func() ([]*Migration, error))
+	if !ok {
+		return fmt.Errorf("plugin %s: symbol %s has type %T, expected func() ([]*migrate.Migration, error)",
+			path, PluginSymbol, symbol)
+	}
+
+	return RegisterMigrationFactory(name, fn)
+}
+
+// LoadFactoryMigrations registers the migrations of every registered factory that
+// has not been loaded into this registry yet. Returns the IDs of the new migrations.
+func (r *MigrationRegistry) LoadFactoryMigrations() ([]string, error) {
+	factoriesMu.Lock()
+	names := make([]string, 0, len(factories))
+	pending := make(map[string]MigrationFactory)
+	for name, factory := range factories {
+		if !r.loadedFactories[name] {
+			names = append(names, name)
+			pending[name] = factory
+		}
+	}
+	factoriesMu.Unlock()
+	sort.Strings(names)
+
+	var registered []string
+	for _, name := range names {
+		migrations, err := pending[name]()
+		if err != nil {
+			return registered, fmt.Errorf("migration factory '%s' failed: %w", name, err)
+		}
+		for _, m := range migrations {
+			if err := r.Register(m); err != nil {
+				return registered, fmt.Errorf("migration factory '%s': %w", name, err)
+			}
+			registered = append(registered, m.ID)
+		}
+
+		if r.loadedFactories == nil {
+			r.loadedFactories = make(map[string]bool)
+		}
+		r.loadedFactories[name] = true
+	}
+
+	return registered, nil
+}
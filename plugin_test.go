@@ -0,0 +1,54 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestMigrationFactories(t *testing.T) {
+	factory := func() ([]*Migration, error) {
+		return []*Migration{{
+			ID:   "1754917500_factory_hotfix",
+			Up:   func(db *pebble.DB) error { return nil },
+			Down: func(db *pebble.DB) error { return nil },
+		}}, nil
+	}
+
+	if err := RegisterMigrationFactory("test_hotfix", factory); err != nil {
+		t.Fatalf("Failed to register factory: %v", err)
+	}
+	if err := RegisterMigrationFactory("test_hotfix", factory); err == nil {
+		t.Error("Expected duplicate factory name to be rejected")
+	}
+
+	registry := NewMigrationRegistry()
+	registered, err := registry.LoadFactoryMigrations()
+	if err != nil {
+		t.Fatalf("Failed to load factory migrations: %v", err)
+	}
+	if _, ok := registry.GetMigration("1754917500_factory_hotfix"); !ok {
+		t.Fatalf("Expected factory migration to be registered, got %v", registered)
+	}
+
+	// Loading again only picks up factories registered since
+	registered, err = registry.LoadFactoryMigrations()
+	if err != nil || len(registered) != 0 {
+		t.Errorf("Expected no new migrations, got %v (err: %v)", registered, err)
+	}
+
+	t.Run("InvalidPlugin", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "broken.so"), []byte("not a plugin"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if _, err := LoadPlugins(dir); err == nil {
+			t.Error("Expected invalid plugin to fail to load")
+		}
+		if _, err := LoadPlugins(filepath.Join(dir, "missing")); err == nil {
+			t.Error("Expected missing plugin directory to fail")
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package migrate
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// MetadataPolicy lists the operational metadata every migration of a registry
+// must carry, see MigrationRegistry.SetMetadataPolicy. The zero value requires
+// nothing.
+type MetadataPolicy struct {
+	RequireDescription bool // Migration.Description must be set
+	RequireOwner       bool // Migration.Owner must be set
+	RequireRunbook     bool // Migration.RunbookURL must be set
+}
+
+// StrictMetadataPolicy requires a description, an owner and a runbook URL
+var StrictMetadataPolicy = MetadataPolicy{RequireDescription: true, RequireOwner: true, RequireRunbook: true}
+
+// Enabled reports whether the policy requires any metadata
+func (p MetadataPolicy) Enabled() bool {
+	return p.RequireDescription || p.RequireOwner || p.RequireRunbook
+}
+
+// Missing returns the names of the required fields that are empty or blank
+func (p MetadataPolicy) Missing(description, owner, runbookURL string) []string {
+	var missing []string
+	if p.RequireDescription && strings.TrimSpace(description) == "" {
+		missing = append(missing, "Description")
+	}
+	if p.RequireOwner && strings.TrimSpace(owner) == "" {
+		missing = append(missing, "Owner")
+	}
+	if p.RequireRunbook && strings.TrimSpace(runbookURL) == "" {
+		missing = append(missing, "RunbookURL")
+	}
+	return missing
+}
+
+// Check returns ErrMissingMetadata naming the fields m lacks
+func (p MetadataPolicy) Check(m *Migration) error {
+	if problem := p.problem(m); problem != "" {
+		return fmt.Errorf("%w: %s", ErrMissingMetadata, problem)
+	}
+	return nil
+}
+
+// problem describes the fields m lacks, or returns "" if it has them all
+func (p MetadataPolicy) problem(m *Migration) string {
+	missing := p.Missing(m.Description, m.Owner, m.RunbookURL)
+	if len(missing) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("migration '%s' has no %s", m.ID, strings.Join(missing, ", "))
+}
+
+// SetMetadataPolicy makes Register reject migrations without the metadata the
+// policy requires with ErrMissingMetadata, e.g. StrictMetadataPolicy for
+// production migration sets. Setting it fails, and leaves the previous policy,
+// if registered migrations already lack the metadata, e.g. ones registered in
+// init functions.
+func (r *MigrationRegistry) SetMetadataPolicy(policy MetadataPolicy) error {
+	var problems []string
+	for _, m := range r.ordered {
+		if problem := policy.problem(m); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingMetadata, strings.Join(problems, "; "))
+	}
+	r.metadataPolicy = policy
+	return nil
+}
+
+// readGoMigrationMetadata reads the metadata of file from the Migration literal
+// of a Go migration file: the one with the file's ID, or the only one. Files
+// that do not parse or declare no such literal are left without metadata.
+func readGoMigrationMetadata(path string, file *MigrationFile) {
+	parsed, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return
+	}
+	alias := migrateImportName(parsed)
+	if alias == "" {
+		return
+	}
+
+	var literals []*ast.CompositeLit
+	ast.Inspect(parsed, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.CompositeLit); ok && isMigrationType(lit, alias) {
+			literals = append(literals, lit)
+		}
+		return true
+	})
+
+	var found *ast.CompositeLit
+	for _, lit := range literals {
+		if id, ok := literalMigrationID(lit); ok && id == file.ID {
+			found = lit
+		}
+	}
+	if found == nil && len(literals) == 1 {
+		found = literals[0]
+	}
+	if found == nil {
+		return
+	}
+
+	for _, elt := range found.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		value := types.ExprString(kv.Value)
+		if lit, ok := kv.Value.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			value, _ = strconv.Unquote(lit.Value)
+		}
+		switch key.Name {
+		case "Description":
+			file.Description = value
+		case "Owner":
+			file.Owner = value
+		case "RunbookURL":
+			file.RunbookURL = value
+		}
+	}
+	file.HasMetadata = true
+}
+
+// FindMetadataProblems returns a description of every file whose migration lacks
+// metadata the policy requires. Files without metadata (see
+// MigrationFile.HasMetadata) are not checked.
+func FindMetadataProblems(files []MigrationFile, policy MetadataPolicy) []string {
+	var problems []string
+	for _, file := range files {
+		if !file.HasMetadata {
+			continue
+		}
+		if missing := policy.Missing(file.Description, file.Owner, file.RunbookURL); len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: migration %s has no %s", file.Name, file.ID, strings.Join(missing, ", ")))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,106 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestMetadataPolicy(t *testing.T) {
+	noop := func(db *pebble.DB) error { return nil }
+	registry := NewMigrationRegistry()
+	if err := registry.Register(&Migration{ID: "1754917200_bare", Up: noop, Down: noop}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	// Migrations registered before the policy must already comply
+	if err := registry.SetMetadataPolicy(StrictMetadataPolicy); !errors.Is(err, ErrMissingMetadata) {
+		t.Fatalf("Expected ErrMissingMetadata, got %v", err)
+	}
+
+	registry = NewMigrationRegistry()
+	if err := registry.SetMetadataPolicy(StrictMetadataPolicy); err != nil {
+		t.Fatalf("Failed to set policy: %v", err)
+	}
+	err := registry.Register(&Migration{ID: "1754917200_bare", Description: "Bare", Owner: " ", Up: noop, Down: noop})
+	if !errors.Is(err, ErrMissingMetadata) {
+		t.Fatalf("Expected ErrMissingMetadata, got %v", err)
+	}
+	if want := "missing migration metadata: migration '1754917200_bare' has no Owner, RunbookURL"; err.Error() != want {
+		t.Errorf("Expected %q, got %q", want, err.Error())
+	}
+
+	err = registry.Register(&Migration{
+		ID:          "1754917300_documented",
+		Description: "Documented",
+		Owner:       "storage-team",
+		RunbookURL:  "https://runbooks.example.com/1754917300",
+		Up:          noop,
+		Down:        noop,
+	})
+	if err != nil {
+		t.Errorf("Expected a complete migration to register, got %v", err)
+	}
+}
+
+func TestFindMetadataProblems(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"1754917200_complete.go": `package migrations
+
+import m "github.com/herenow/pebble-migrate"
+
+const owner = "storage-team"
+
+func init() {
+	m.Register(&m.Migration{
+		ID:          "1754917200_complete",
+		Description: "Complete",
+		Owner:       owner,
+		RunbookURL:  "https://runbooks.example.com/1754917200",
+	})
+}
+`,
+		"1754917300_no_owner.yaml": `id: 1754917300_no_owner
+description: No owner
+runbook_url: https://runbooks.example.com/1754917300
+up:
+  - op: set
+    values: {a: b}
+down:
+  - op: delete
+    keys: [a]
+`,
+		"1754917400_built.go": `package migrations
+
+import migrate "github.com/herenow/pebble-migrate"
+
+func init() {
+	migrate.Register(build())
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	scanned, err := ScanMigrationFiles(dir)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	for _, file := range scanned {
+		if want := file.ID != "1754917400_built"; file.HasMetadata != want {
+			t.Errorf("Expected HasMetadata %v for %s", want, file.Name)
+		}
+	}
+
+	problems := FindMetadataProblems(scanned, StrictMetadataPolicy)
+	if len(problems) != 1 || problems[0] != "1754917300_no_owner.yaml: migration 1754917300_no_owner has no Owner" {
+		t.Errorf("Expected only the script without owner to be reported, got %v", problems)
+	}
+}
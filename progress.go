@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ProgressPhase is the kind of a progress event
+type ProgressPhase string
+
+const (
+	ProgressPlanStarted        ProgressPhase = "plan_started"        // The plan starts executing
+	ProgressBackup             ProgressPhase = "backup"              // The backup before the plan
+	ProgressMigrationStarted   ProgressPhase = "migration_started"   // A migration starts
+	ProgressMigration          ProgressPhase = "migration"           // Reported by a running migration
+	ProgressMigrationCompleted ProgressPhase = "migration_completed" // A migration completed
+	ProgressPlanCompleted      ProgressPhase = "plan_completed"      // The plan completed successfully
+	ProgressDryRun             ProgressPhase = "dry_run"             // Output of a dry run
+	ProgressWarning            ProgressPhase = "warning"             // A problem that does not fail the plan
+	ProgressStandby            ProgressPhase = "standby"             // The plan is applied to the warm standby
+)
+
+// ProgressEvent is a progress update of a plan execution
+type ProgressEvent struct {
+	Phase       ProgressPhase
+	Step        int     // 1-based index of the migration in the plan, 0 if not about one
+	Total       int     // Number of migrations in the plan
+	MigrationID string  // Migration the event is about, if any
+	Direction   string  // "up" or "down" for migration events
+	Percent     float64 // Completion of the plan, or of the migration for ProgressMigration; -1 if unknown
+	Message     string  // Human-readable description, as printed by the CLI; may be empty
+}
+
+// ProgressReporter receives the progress events of a plan execution. Events of
+// parallel migrations are reported one at a time.
+type ProgressReporter interface {
+	Report(event ProgressEvent)
+}
+
+// ProgressFunc adapts a callback receiving progress messages to a
+// ProgressReporter. A nil ProgressFunc discards the events.
+type ProgressFunc func(message string)
+
+// Report passes the message of the event to the callback. Events without a
+// message, such as completions outside of verbose mode, are skipped.
+func (f ProgressFunc) Report(event ProgressEvent) {
+	if f != nil && event.Message != "" {
+		f(event.Message)
+	}
+}
+
+// ProgressEventFunc adapts a function to a ProgressReporter. A nil
+// ProgressEventFunc discards the events.
+type ProgressEventFunc func(event ProgressEvent)
+
+// Report calls the function with the event
+func (f ProgressEventFunc) Report(event ProgressEvent) {
+	if f != nil {
+		f(event)
+	}
+}
+
+// syncReporter serializes the events of concurrently running migrations
+type syncReporter struct {
+	mu       sync.Mutex
+	reporter ProgressReporter
+}
+
+func (s *syncReporter) Report(event ProgressEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reporter.Report(event)
+}
+
+// planPercent returns the completion of a plan after done of total migrations
+func planPercent(done, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(done) / float64(total) * 100
+}
+
+// reportf reports an event of a phase that is not about a single migration
+func reportf(progress ProgressReporter, phase ProgressPhase, format string, args ...interface{}) {
+	progress.Report(ProgressEvent{Phase: phase, Percent: -1, Message: fmt.Sprintf(format, args...)})
+}
+
+// migrationEvent returns an event about the step-th migration of a plan of total
+// migrations, of which done are complete
+func migrationEvent(phase ProgressPhase, step, total, done int, migration *Migration, direction, message string) ProgressEvent {
+	return ProgressEvent{
+		Phase:       phase,
+		Step:        step,
+		Total:       total,
+		MigrationID: migration.ID,
+		Direction:   direction,
+		Percent:     planPercent(done, total),
+		Message:     message,
+	}
+}
@@ -0,0 +1,82 @@
+package migrate
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestProgressEvents(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	for _, id := range []string{"1754917200_first", "1754917300_second"} {
+		registry.Register(&Migration{
+			ID: id,
+			UpContext: func(ctx *MigrationContext) error {
+				ctx.ProgressPercent(50, "halfway")
+				return nil
+			},
+			Down: func(db *pebble.DB) error { return nil },
+		})
+	}
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	var events []ProgressEvent
+	if err := engine.ExecutePlanWithProgress(plan, ProgressEventFunc(func(event ProgressEvent) {
+		events = append(events, event)
+	})); err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+
+	expected := []struct {
+		phase   ProgressPhase
+		id      string
+		step    int
+		percent float64
+	}{
+		{ProgressPlanStarted, "", 0, 0},
+		{ProgressMigrationStarted, "1754917200_first", 1, 0},
+		{ProgressMigration, "1754917200_first", 0, 50},
+		{ProgressMigrationCompleted, "1754917200_first", 1, 50},
+		{ProgressMigrationStarted, "1754917300_second", 2, 50},
+		{ProgressMigration, "1754917300_second", 0, 50},
+		{ProgressMigrationCompleted, "1754917300_second", 2, 100},
+		{ProgressPlanCompleted, "", 0, 100},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %+v", len(expected), events)
+	}
+	for i, want := range expected {
+		got := events[i]
+		if got.Phase != want.phase || got.MigrationID != want.id || got.Step != want.step || got.Percent != want.percent {
+			t.Errorf("Event %d: expected %+v, got %+v", i, want, got)
+		}
+		if got.Phase != ProgressPlanStarted && got.Phase != ProgressPlanCompleted && got.Direction != "up" {
+			t.Errorf("Event %d: expected direction up, got %q", i, got.Direction)
+		}
+	}
+
+	t.Run("ProgressFuncSkipsEmptyMessages", func(t *testing.T) {
+		var messages []string
+		reporter := ProgressFunc(func(msg string) { messages = append(messages, msg) })
+		reporter.Report(ProgressEvent{Phase: ProgressMigrationCompleted})
+		reporter.Report(ProgressEvent{Phase: ProgressPlanCompleted, Message: "done"})
+		if len(messages) != 1 || messages[0] != "done" {
+			t.Errorf("Expected only the message, got %q", messages)
+		}
+		ProgressFunc(nil).Report(ProgressEvent{Message: "discarded"})
+	})
+}
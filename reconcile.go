@@ -0,0 +1,161 @@
+package migrate
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DiscrepancyKind is the kind of inconsistency found by CheckVersion
+type DiscrepancyKind string
+
+const (
+	DiscrepancyVersion        DiscrepancyKind = "version"         // CurrentVersion does not match the applied set
+	DiscrepancyInvalidID      DiscrepancyKind = "invalid_id"      // An applied ID has no version prefix
+	DiscrepancyMissingHistory DiscrepancyKind = "missing_history" // Applied without a successful history record
+	DiscrepancyRolledBack     DiscrepancyKind = "rolled_back"     // Applied, but last recorded as rolled back
+	DiscrepancyNotApplied     DiscrepancyKind = "not_applied"     // Recorded as applied, but not in the applied set
+)
+
+// VersionDiscrepancy is an inconsistency between the current version, the
+// applied set and the history
+type VersionDiscrepancy struct {
+	Kind        DiscrepancyKind
+	MigrationID string // Empty for DiscrepancyVersion
+	Message     string
+}
+
+// VersionReport is the outcome of CheckVersion and ReconcileVersion
+type VersionReport struct {
+	StoredVersion   int64 // CurrentVersion as stored
+	ComputedVersion int64 // Highest version in the applied set
+	Discrepancies   []VersionDiscrepancy
+	Reconciled      bool // Whether ReconcileVersion stored ComputedVersion
+}
+
+// Consistent reports whether no discrepancies were found
+func (r *VersionReport) Consistent() bool {
+	return len(r.Discrepancies) == 0
+}
+
+// CheckVersion recomputes the current version from the applied set without
+// changing the state, and reports where the version, the applied set and the
+// history disagree. A downgrade failing midway can leave them inconsistent.
+func (s *SchemaManager) CheckVersion() (*VersionReport, error) {
+	schema, err := s.GetSchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return checkVersion(schema), nil
+}
+
+// ReconcileVersion stores the current version recomputed from the applied set
+// and reports the discrepancies found, as CheckVersion does. Only the version is
+// corrected; use RepairMissingHistory for missing history records, the other
+// discrepancies need manual intervention.
+func (s *SchemaManager) ReconcileVersion() (*VersionReport, error) {
+	report, err := s.CheckVersion()
+	if err != nil {
+		return nil, err
+	}
+	if report.StoredVersion == report.ComputedVersion {
+		return report, nil
+	}
+	if err := s.snapshot("reconcile version"); err != nil {
+		return nil, err
+	}
+
+	err = s.modifySchema(func(currentSchema *SchemaVersion) ([]MigrationRecord, error) {
+		// Recompute on the state being written in case it changed concurrently
+		currentSchema.CurrentVersion, _ = appliedVersion(currentSchema.AppliedMigrations)
+		report.ComputedVersion = currentSchema.CurrentVersion
+		return nil, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile version: %w", err)
+	}
+	report.Reconciled = true
+	return report, nil
+}
+
+// appliedVersion returns the highest version in an applied set and the IDs
+// without a version prefix
+func appliedVersion(applied map[string]bool) (int64, []string) {
+	var maxVersion int64
+	var invalid []string
+	for id := range applied {
+		version, err := parseVersionPrefix(id)
+		if err != nil {
+			invalid = append(invalid, id)
+			continue
+		}
+		if version > maxVersion {
+			maxVersion = version
+		}
+	}
+	sort.Strings(invalid)
+	return maxVersion, invalid
+}
+
+// checkVersion builds the report of a schema state
+func checkVersion(schema *SchemaVersion) *VersionReport {
+	computed, invalid := appliedVersion(schema.AppliedMigrations)
+	report := &VersionReport{StoredVersion: schema.CurrentVersion, ComputedVersion: computed}
+
+	if computed != schema.CurrentVersion {
+		report.Discrepancies = append(report.Discrepancies, VersionDiscrepancy{
+			Kind:    DiscrepancyVersion,
+			Message: fmt.Sprintf("current version is %d, but the highest applied version is %d", schema.CurrentVersion, computed),
+		})
+	}
+	for _, id := range invalid {
+		report.Discrepancies = append(report.Discrepancies, VersionDiscrepancy{
+			Kind:        DiscrepancyInvalidID,
+			MigrationID: id,
+			Message:     fmt.Sprintf("applied migration %s has no version prefix", id),
+		})
+	}
+
+	// The last successful record of each migration tells whether it is applied
+	lastRecord := make(map[string]RecordType)
+	for _, record := range schema.MigrationHistory {
+		if record.Success {
+			lastRecord[record.ID] = record.Type
+		}
+	}
+
+	ids := make([]string, 0, len(schema.AppliedMigrations)+len(lastRecord))
+	for id := range schema.AppliedMigrations {
+		ids = append(ids, id)
+	}
+	for id := range lastRecord {
+		if !schema.AppliedMigrations[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		recordType, recorded := lastRecord[id]
+		switch {
+		case schema.AppliedMigrations[id] && !recorded:
+			report.Discrepancies = append(report.Discrepancies, VersionDiscrepancy{
+				Kind:        DiscrepancyMissingHistory,
+				MigrationID: id,
+				Message:     fmt.Sprintf("migration %s is applied but has no successful history record", id),
+			})
+		case schema.AppliedMigrations[id] && !recordType.Applies():
+			report.Discrepancies = append(report.Discrepancies, VersionDiscrepancy{
+				Kind:        DiscrepancyRolledBack,
+				MigrationID: id,
+				Message:     fmt.Sprintf("migration %s is applied but was last recorded as rolled back", id),
+			})
+		case !schema.AppliedMigrations[id] && recordType.Applies():
+			report.Discrepancies = append(report.Discrepancies, VersionDiscrepancy{
+				Kind:        DiscrepancyNotApplied,
+				MigrationID: id,
+				Message:     fmt.Sprintf("migration %s was last recorded as applied but is not in the applied set", id),
+			})
+		}
+	}
+	return report
+}
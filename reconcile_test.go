@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestReconcileVersion(t *testing.T) {
+	db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	schemaManager := NewSchemaManager(db)
+
+	// A downgrade that failed after rolling back 1754917300_b, with a version
+	// left behind and a history that disagrees with the applied set
+	now := time.Now()
+	if err := schemaManager.SetSchemaVersion(&SchemaVersion{
+		CurrentVersion: 1754917400,
+		AppliedMigrations: map[string]bool{
+			"1754917200_a": true,
+			"1754917300_b": true,
+			"1754917250_c": true,
+		},
+		MigrationHistory: []MigrationRecord{
+			{ID: "1754917200_a", Type: RecordApply, AppliedAt: now, Success: true},
+			{ID: "1754917300_b", Type: RecordApply, AppliedAt: now, Success: true},
+			{ID: "1754917400_d", Type: RecordApply, AppliedAt: now, Success: true},
+			{ID: "1754917300_b", Type: RecordRollback, AppliedAt: now, Success: true},
+		},
+		Status: StatusDirty,
+	}); err != nil {
+		t.Fatalf("Failed to store schema: %v", err)
+	}
+
+	report, err := schemaManager.CheckVersion()
+	if err != nil {
+		t.Fatalf("Failed to check version: %v", err)
+	}
+	if report.StoredVersion != 1754917400 || report.ComputedVersion != 1754917300 || report.Reconciled {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	expected := []VersionDiscrepancy{
+		{Kind: DiscrepancyVersion},
+		{Kind: DiscrepancyMissingHistory, MigrationID: "1754917250_c"},
+		{Kind: DiscrepancyRolledBack, MigrationID: "1754917300_b"},
+		{Kind: DiscrepancyNotApplied, MigrationID: "1754917400_d"},
+	}
+	if len(report.Discrepancies) != len(expected) {
+		t.Fatalf("Expected %d discrepancies, got %+v", len(expected), report.Discrepancies)
+	}
+	for i, want := range expected {
+		if got := report.Discrepancies[i]; got.Kind != want.Kind || got.MigrationID != want.MigrationID || got.Message == "" {
+			t.Errorf("Discrepancy %d: expected %s %s, got %+v", i, want.Kind, want.MigrationID, got)
+		}
+	}
+	if schema, _ := schemaManager.GetSchemaVersion(); schema.CurrentVersion != 1754917400 {
+		t.Errorf("Expected CheckVersion not to change the version, got %d", schema.CurrentVersion)
+	}
+
+	report, err = schemaManager.ReconcileVersion()
+	if err != nil {
+		t.Fatalf("Failed to reconcile version: %v", err)
+	}
+	if !report.Reconciled {
+		t.Errorf("Expected the version to be reconciled")
+	}
+	schema, _ := schemaManager.GetSchemaVersion()
+	if schema.CurrentVersion != 1754917300 || schema.Status != StatusDirty {
+		t.Errorf("Expected version 1754917300 with the status untouched, got %d (%s)", schema.CurrentVersion, schema.Status)
+	}
+
+	t.Run("ConsistentStateIsUnchanged", func(t *testing.T) {
+		report, err := schemaManager.ReconcileVersion()
+		if err != nil {
+			t.Fatalf("Failed to reconcile version: %v", err)
+		}
+		if report.Reconciled {
+			t.Errorf("Expected nothing to reconcile, got %+v", report)
+		}
+		for _, d := range report.Discrepancies {
+			if d.Kind == DiscrepancyVersion {
+				t.Errorf("Expected no version discrepancy, got %+v", d)
+			}
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package migrate
+
+import (
+	"sort"
+)
+
+// RecoveryStep is a step of the recommended path out of a failed or
+// interrupted migration
+type RecoveryStep string
+
+const (
+	RecoveryValidate RecoveryStep = "validate" // Check whether the changes of the migration are in place with its Validate function
+	RecoveryRepair   RecoveryStep = "repair"   // Reconcile the applied migrations and the version with the history
+	RecoveryRerun    RecoveryStep = "rerun"    // Mark the state clean and run the pending migrations again
+	RecoveryAbandon  RecoveryStep = "abandon"  // Roll back the chunks the interrupted chunked migration committed
+	RecoveryRestore  RecoveryStep = "restore"  // Restore the backup taken before the failed plan
+)
+
+// RecoveryDiagnosis describes the state of a database that needs recovery and the
+// recommended steps, in order. Rerun, abandon and restore are alternatives.
+type RecoveryDiagnosis struct {
+	Status        Status
+	Version       int64
+	MigrationID   string // Migration that failed or was interrupted, if known
+	Error         string // Error recorded for the migration, if it failed
+	Discrepancies []VersionDiscrepancy
+	Backup        string // Backup to restore, if any
+	Steps         []RecoveryStep
+}
+
+// NeedsRecovery reports whether the database is dirty, in the middle of a
+// migration or rollback, or inconsistent with its history
+func (d *RecoveryDiagnosis) NeedsRecovery() bool {
+	return d.Status != StatusClean || len(d.Discrepancies) > 0
+}
+
+// DiagnoseRecovery inspects the schema state and recommends a recovery path. The
+// migration at fault is the one of the failure recorded in a dirty database (of
+// the last failed history record for state that does not record it), or the
+// first migration recorded as running in an interrupted one (the first pending
+// migration for state that does not record them). The backup is the one taken
+// before the last plan if it failed, or else the newest complete backup; backups
+// may be nil to not consider restoring.
+func (s *SchemaManager) DiagnoseRecovery(registry *MigrationRegistry, backups *BackupManager) (*RecoveryDiagnosis, error) {
+	report, err := s.CheckVersion()
+	if err != nil {
+		return nil, err
+	}
+	schema, err := s.GetSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	diagnosis := &RecoveryDiagnosis{
+		Status:        schema.Status,
+		Version:       schema.CurrentVersion,
+		Discrepancies: report.Discrepancies,
+	}
+	if !diagnosis.NeedsRecovery() {
+		return diagnosis, nil
+	}
+
+	switch schema.Status {
+	case StatusDirty:
+		if failure := schema.LastFailure; failure != nil {
+			diagnosis.MigrationID = failure.MigrationID
+			diagnosis.Error = failure.Error
+			break
+		}
+		for i := len(schema.MigrationHistory) - 1; i >= 0; i-- {
+			if record := schema.MigrationHistory[i]; !record.Success {
+				diagnosis.MigrationID = record.ID
+				diagnosis.Error = record.Error
+				break
+			}
+		}
+	case StatusMigrating:
+		if len(schema.RunningMigrations) > 0 {
+			diagnosis.MigrationID = schema.RunningMigrations[0]
+			if registry != nil {
+				diagnosis.MigrationID = registry.ResolveID(diagnosis.MigrationID)
+			}
+		} else if registry != nil {
+			if pending, err := registry.GetPendingMigrations(schema.AppliedMigrations); err == nil && len(pending) > 0 {
+				diagnosis.MigrationID = pending[0].ID
+			}
+		}
+	}
+	if backups != nil {
+		diagnosis.Backup = s.recoveryBackup(backups)
+	}
+
+	var migration *Migration
+	if registry != nil && diagnosis.MigrationID != "" {
+		migration, _ = registry.GetMigration(diagnosis.MigrationID)
+	}
+	if migration != nil && migration.Validate != nil {
+		diagnosis.Steps = append(diagnosis.Steps, RecoveryValidate)
+	}
+	if len(diagnosis.Discrepancies) > 0 {
+		diagnosis.Steps = append(diagnosis.Steps, RecoveryRepair)
+	}
+	if schema.Status != StatusClean {
+		diagnosis.Steps = append(diagnosis.Steps, RecoveryRerun)
+		if migration != nil && (migration.ChunkPreImages || migration.Down != nil || migration.DownContext != nil) {
+			if saved, err := s.GetMigrationProgress(migration.ID); err == nil && saved != nil && saved.Direction == "up" {
+				diagnosis.Steps = append(diagnosis.Steps, RecoveryAbandon)
+			}
+		}
+		if diagnosis.Backup != "" {
+			diagnosis.Steps = append(diagnosis.Steps, RecoveryRestore)
+		}
+	}
+	return diagnosis, nil
+}
+
+// recoveryBackup returns the backup taken before the last plan if it failed, or
+// the newest complete backup, or ""
+func (s *SchemaManager) recoveryBackup(backups *BackupManager) string {
+	if plans, err := s.PlanHistory(); err == nil && len(plans) > 0 {
+		if last := plans[len(plans)-1]; !last.Success && last.BackupPath != "" {
+			return last.BackupPath
+		}
+	}
+
+	list, err := backups.ListBackups()
+	if err != nil || len(list) == 0 {
+		return ""
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list[0].Path
+}
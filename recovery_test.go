@@ -1,6 +1,8 @@
 package migrate
 
 import (
+	"errors"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -252,4 +254,158 @@ func TestMigrationRecovery(t *testing.T) {
 			t.Errorf("Expected current version to be 1755003600, got %d", finalSchema.CurrentVersion)
 		}
 	})
+
+	t.Run("RecoverRecordedMigration", func(t *testing.T) {
+		// The interrupted migration is the one recorded as running, not the first
+		// pending one, which may be ordered before it
+		GlobalRegistry = NewMigrationRegistry()
+		noop := func(db *pebble.DB) error { return nil }
+		GlobalRegistry.Register(&Migration{ID: "1755000000_not_rerunnable", Up: noop, Down: noop})
+		GlobalRegistry.Register(&Migration{ID: "1755000000.1_rerunnable", Up: noop, Down: noop, Rerunnable: true})
+
+		dir := t.TempDir()
+		db, err := pebble.Open(dir, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		schemaManager := NewSchemaManager(db)
+		if err := schemaManager.MarkMigrationStarted("1755000000.1_rerunnable"); err != nil {
+			t.Fatalf("Failed to mark migration started: %v", err)
+		}
+		diagnosis, err := schemaManager.DiagnoseRecovery(GlobalRegistry, nil)
+		if err != nil || diagnosis.MigrationID != "1755000000.1_rerunnable" {
+			t.Errorf("Expected the recorded migration to be diagnosed, got %+v (%v)", diagnosis, err)
+		}
+
+		opts := DefaultStartupOptions()
+		opts.RunMigrations = true
+		if err := CheckAndRunStartupMigrations(db, dir, opts); err != nil {
+			t.Fatalf("Expected recovery of the recorded migration, got %v", err)
+		}
+		finalSchema, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to get final schema: %v", err)
+		}
+		if finalSchema.Status != StatusClean || len(finalSchema.RunningMigrations) != 0 || len(finalSchema.AppliedMigrations) != 2 {
+			t.Errorf("Expected a clean state with both migrations applied, got %+v", finalSchema)
+		}
+
+		// A migration interrupted while rolling back is still applied and needs
+		// manual intervention, even if it is rerunnable
+		if err := schemaManager.MarkMigrationStarted("1755000000.1_rerunnable"); err != nil {
+			t.Fatalf("Failed to mark migration started: %v", err)
+		}
+		err = CheckAndRunStartupMigrations(db, dir, opts)
+		if err == nil || !strings.Contains(err.Error(), "while rolling back") {
+			t.Errorf("Expected an interrupted rollback to be refused, got %v", err)
+		}
+	})
+}
+
+func TestDiagnoseRecovery(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer func() { db.Close() }() // Reopened by the restore
+
+	registry := NewMigrationRegistry()
+	registry.Register(&Migration{
+		ID:   "1754917200_first",
+		Up:   func(db *pebble.DB) error { return nil },
+		Down: func(db *pebble.DB) error { return nil },
+	})
+	registry.Register(&Migration{
+		ID:       "1754917300_broken",
+		Up:       func(db *pebble.DB) error { return errors.New("boom") },
+		Down:     func(db *pebble.DB) error { return nil },
+		Validate: func(db *pebble.DB) error { return nil },
+	})
+	schemaManager := NewSchemaManager(db)
+	backupManager := NewBackupManager(dbPath)
+
+	diagnosis, err := schemaManager.DiagnoseRecovery(registry, backupManager)
+	if err != nil {
+		t.Fatalf("Failed to diagnose: %v", err)
+	}
+	if diagnosis.NeedsRecovery() || len(diagnosis.Steps) != 0 {
+		t.Fatalf("Expected a clean database to need no recovery, got %+v", diagnosis)
+	}
+
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetLogger(&NopLogger{})
+	engine.SetDiagnostics(false)
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err == nil {
+		t.Fatalf("Expected the broken migration to fail the plan")
+	}
+
+	diagnosis, err = schemaManager.DiagnoseRecovery(registry, backupManager)
+	if err != nil {
+		t.Fatalf("Failed to diagnose: %v", err)
+	}
+	if diagnosis.Status != StatusDirty || diagnosis.MigrationID != "1754917300_broken" || !strings.Contains(diagnosis.Error, "boom") {
+		t.Errorf("Expected the failed migration in the diagnosis, got %+v", diagnosis)
+	}
+	if diagnosis.Backup == "" || filepath.Dir(diagnosis.Backup) != dir {
+		t.Errorf("Expected the backup of the failed plan, got %q", diagnosis.Backup)
+	}
+	expected := []RecoveryStep{RecoveryValidate, RecoveryRerun, RecoveryRestore}
+	if len(diagnosis.Steps) != len(expected) {
+		t.Fatalf("Expected steps %v, got %v", expected, diagnosis.Steps)
+	}
+	for i, step := range expected {
+		if diagnosis.Steps[i] != step {
+			t.Errorf("Step %d: expected %s, got %s", i, step, diagnosis.Steps[i])
+		}
+	}
+
+	t.Run("InterruptedMigration", func(t *testing.T) {
+		if err := schemaManager.MarkMigrationStarted(); err != nil {
+			t.Fatalf("Failed to mark started: %v", err)
+		}
+		diagnosis, err := schemaManager.DiagnoseRecovery(registry, nil)
+		if err != nil {
+			t.Fatalf("Failed to diagnose: %v", err)
+		}
+		if diagnosis.MigrationID != "1754917300_broken" || diagnosis.Backup != "" {
+			t.Errorf("Expected the first pending migration and no backup, got %+v", diagnosis)
+		}
+	})
+
+	t.Run("RestoreOfferedBackup", func(t *testing.T) {
+		// The backup taken by default is compressed
+		if !strings.HasSuffix(diagnosis.Backup, ".tar.gz") {
+			t.Fatalf("Expected a compressed backup, got %q", diagnosis.Backup)
+		}
+		db.Close()
+		backupManager.SetRegistry(registry)
+		report, err := backupManager.RestoreBackupWithReport(diagnosis.Backup)
+		if err != nil {
+			t.Fatalf("Failed to restore the offered backup: %v", err)
+		}
+		if db, err = pebble.Open(dbPath, &pebble.Options{}); err != nil {
+			t.Fatalf("Failed to reopen database: %v", err)
+		}
+		schemaManager.db = db
+
+		// The backup predates the plan
+		if len(report.Pending) != 2 {
+			t.Errorf("Expected both migrations to be pending, got %d", len(report.Pending))
+		}
+		diagnosis, err := schemaManager.DiagnoseRecovery(registry, nil)
+		if err != nil {
+			t.Fatalf("Failed to diagnose: %v", err)
+		}
+		if diagnosis.NeedsRecovery() {
+			t.Errorf("Expected the restored database to need no recovery, got %+v", diagnosis)
+		}
+	})
 }
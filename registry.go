@@ -2,6 +2,8 @@ package migrate
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 )
 
 // GlobalRegistry is the global migration registry used by the CLI
@@ -15,6 +17,7 @@ func Register(m *Migration) error {
 // DiscoveryService handles discovery of migration files
 type DiscoveryService struct {
 	migrationDir string
+	pluginDir    string
 	registry     *MigrationRegistry
 }
 
@@ -26,19 +29,68 @@ func NewDiscoveryService(migrationDir string, registry *MigrationRegistry) *Disc
 	}
 }
 
+// SetPluginDir enables loading Go plugin (.so) migrations from dir. Plugin loading
+// is off unless a directory is set; see LoadPlugins for the constraints.
+func (d *DiscoveryService) SetPluginDir(dir string) {
+	d.pluginDir = dir
+}
+
 // LoadMigrations discovers and loads all migration files from the migration directory
 func (d *DiscoveryService) LoadMigrations() error {
-	// For now, we'll use a simpler approach where migrations are registered
-	// via init() functions in Go files. This is similar to database/sql drivers.
-	// The migration files will be compiled into the binary.
+	// Go migrations are registered via init() functions in Go files, similar to
+	// database/sql drivers, and are compiled into the binary.
+	//
+	// Script migrations (.json, .yaml, .yml) in the migration directory are loaded
+	// here and interpreted at runtime, as are migrations from registered factories
+	// and, when a plugin directory is set, from Go plugins.
+	if err := d.loadScripts(); err != nil {
+		return err
+	}
 
-	// In a more advanced implementation, we could:
-	// 1. Use Go plugins to dynamically load migrations
-	// 2. Parse .sql files with embedded Go code
-	// 3. Use reflection to discover migrations
+	if d.pluginDir != "" {
+		if _, err := LoadPlugins(d.pluginDir); err != nil {
+			return err
+		}
+	}
 
-	// For this implementation, migrations are registered via init() functions
-	// when the migration files are imported.
+	if _, err := d.registry.LoadFactoryMigrations(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// loadScripts registers the script migrations in the migration directory
+func (d *DiscoveryService) loadScripts() error {
+	if d.migrationDir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(d.migrationDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read migration directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !IsScriptMigrationFile(entry.Name()) {
+			continue
+		}
+
+		script, err := LoadScriptMigration(filepath.Join(d.migrationDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		migration, err := script.Migration()
+		if err != nil {
+			return err
+		}
+		if err := d.registry.Register(migration); err != nil {
+			return fmt.Errorf("failed to register script %s: %w", entry.Name(), err)
+		}
+	}
 
 	return nil
 }
@@ -68,25 +120,20 @@ func (d *DiscoveryService) ValidateMigrations() error {
 
 	// Validate migration IDs follow naming convention
 	for _, m := range migrations {
-		if !isValidMigrationID(m.ID) {
-			return fmt.Errorf("migration ID '%s' doesn't follow naming convention (should be like '001_description')", m.ID)
+		if _, err := d.registry.parseVersion(m.ID); err != nil {
+			return fmt.Errorf("migration ID '%s' doesn't follow naming convention (should be like '1700000000_description'): %w", m.ID, err)
 		}
 	}
 
 	return nil
 }
 
-// isValidMigrationID validates that migration ID follows naming convention
-func isValidMigrationID(id string) bool {
-	// Use the version parsing function to validate format
-	_, err := ParseMigrationVersion(id)
-	return err == nil
-}
-
 // MigrationPlanner helps plan migration execution
 type MigrationPlanner struct {
-	registry *MigrationRegistry
-	schema   *SchemaManager
+	registry        *MigrationRegistry
+	schema          *SchemaManager
+	strictConflicts bool
+	lockFile        *LockFile
 }
 
 // NewMigrationPlanner creates a new migration planner
@@ -99,7 +146,11 @@ func NewMigrationPlanner(registry *MigrationRegistry, schema *SchemaManager) *Mi
 
 // PlanUpgrade creates an execution plan to apply all pending migrations
 func (p *MigrationPlanner) PlanUpgrade() (*ExecutionPlan, error) {
-	currentSchema, err := p.schema.GetSchemaVersion()
+	if err := p.verifyLock(); err != nil {
+		return nil, err
+	}
+
+	currentSchema, err := p.schema.getSchemaHead()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current schema: %w", err)
 	}
@@ -120,11 +171,14 @@ func (p *MigrationPlanner) PlanUpgrade() (*ExecutionPlan, error) {
 		Migrations:     pendingMigrations,
 		EstimatedSteps: len(pendingMigrations),
 	}
+	if err := p.holdParked(plan); err != nil {
+		return nil, err
+	}
 
 	// Set target version to latest migration's Unix timestamp if any pending
-	if len(pendingMigrations) > 0 {
+	if len(plan.Migrations) > 0 {
 		maxVersion := currentSchema.CurrentVersion
-		for _, m := range pendingMigrations {
+		for _, m := range plan.Migrations {
 			if m.Version > maxVersion {
 				maxVersion = m.Version
 			}
@@ -132,12 +186,20 @@ func (p *MigrationPlanner) PlanUpgrade() (*ExecutionPlan, error) {
 		plan.TargetVersion = maxVersion
 	}
 
+	if err := p.checkConflicts(plan); err != nil {
+		return nil, err
+	}
+
 	return plan, nil
 }
 
 // PlanUpgradeTo creates an execution plan to upgrade to a specific version
 func (p *MigrationPlanner) PlanUpgradeTo(targetVersion int64) (*ExecutionPlan, error) {
-	currentSchema, err := p.schema.GetSchemaVersion()
+	if err := p.verifyLock(); err != nil {
+		return nil, err
+	}
+
+	currentSchema, err := p.schema.getSchemaHead()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current schema: %w", err)
 	}
@@ -160,25 +222,35 @@ func (p *MigrationPlanner) PlanUpgradeTo(targetVersion int64) (*ExecutionPlan, e
 	allMigrations := p.registry.GetMigrationsInVersionRange(currentSchema.CurrentVersion+1, targetVersion)
 
 	// Filter out already applied migrations
+	applied := p.registry.resolveApplied(currentSchema.AppliedMigrations)
 	var pendingMigrations []*Migration
 	for _, m := range allMigrations {
-		if !currentSchema.AppliedMigrations[m.ID] {
+		if !applied[m.ID] {
 			pendingMigrations = append(pendingMigrations, m)
 		}
 	}
 
-	return &ExecutionPlan{
+	plan := &ExecutionPlan{
 		Type:           ExecutionTypeUpgrade,
 		CurrentVersion: currentSchema.CurrentVersion,
 		TargetVersion:  targetVersion,
 		Migrations:     pendingMigrations,
 		EstimatedSteps: len(pendingMigrations),
-	}, nil
+	}
+	if err := p.holdParked(plan); err != nil {
+		return nil, err
+	}
+
+	if err := p.checkConflicts(plan); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
 }
 
 // PlanDowngrade creates an execution plan to downgrade to a specific version
 func (p *MigrationPlanner) PlanDowngrade(targetVersion int64) (*ExecutionPlan, error) {
-	currentSchema, err := p.schema.GetSchemaVersion()
+	currentSchema, err := p.schema.getSchemaHead()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current schema: %w", err)
 	}
@@ -201,10 +273,11 @@ func (p *MigrationPlanner) PlanDowngrade(targetVersion int64) (*ExecutionPlan, e
 	migrationsToRollback := p.registry.GetMigrationsInVersionRange(targetVersion+1, currentSchema.CurrentVersion)
 
 	// Filter to only applied migrations and reverse order for rollback
+	applied := p.registry.resolveApplied(currentSchema.AppliedMigrations)
 	var rollbackMigrations []*Migration
 	for i := len(migrationsToRollback) - 1; i >= 0; i-- {
 		m := migrationsToRollback[i]
-		if currentSchema.AppliedMigrations[m.ID] {
+		if applied[m.ID] {
 			rollbackMigrations = append(rollbackMigrations, m)
 		}
 	}
@@ -225,7 +298,7 @@ func (p *MigrationPlanner) PlanRerun(migrationID string) (*ExecutionPlan, error)
 		return nil, fmt.Errorf("migration '%s' not found", migrationID)
 	}
 
-	currentSchema, err := p.schema.GetSchemaVersion()
+	currentSchema, err := p.schema.getSchemaHead()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current schema version: %w", err)
 	}
@@ -248,6 +321,14 @@ type ExecutionPlan struct {
 	TargetVersion  int64         `json:"target_version"`
 	Migrations     []*Migration  `json:"migrations"`
 	EstimatedSteps int           `json:"estimated_steps"`
+
+	// Conflicts lists migrations of an upgrade plan that declare overlapping key
+	// prefixes without a dependency between them (see MigrationPlanner.SetStrictConflicts)
+	Conflicts []KeyConflict `json:"conflicts,omitempty"`
+
+	// Parked lists the pending migrations an upgrade plan leaves out because they
+	// or one of their dependencies are parked (see SchemaManager.ParkMigration)
+	Parked []*Migration `json:"parked,omitempty"`
 }
 
 // ExecutionType represents the type of migration execution
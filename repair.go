@@ -0,0 +1,259 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RepairMode selects which side PlanRepair trusts when the applied set and the
+// history disagree
+type RepairMode string
+
+const (
+	// RepairFromApplied trusts the applied set: applied migrations without a
+	// successful history record, or last recorded as rolled back, get a repair record
+	RepairFromApplied RepairMode = "applied"
+	// RepairFromHistory trusts the history: the applied set is rebuilt from the
+	// migrations whose last successful record applied them
+	RepairFromHistory RepairMode = "history"
+	// RepairReconcile trusts the history where it has a record of the migration
+	// and the applied set where it has none
+	RepairReconcile RepairMode = "reconcile"
+)
+
+// RepairAction is a change PlanRepair proposes for one migration
+type RepairAction string
+
+const (
+	RepairAddHistory    RepairAction = "add_history"    // Record the migration as applied in the history
+	RepairAddRollback   RepairAction = "add_rollback"   // Record the migration as not applied in the history
+	RepairMarkApplied   RepairAction = "mark_applied"   // Add the migration to the applied set
+	RepairUnmarkApplied RepairAction = "unmark_applied" // Remove the migration from the applied set
+	RepairSkip          RepairAction = "skip"           // Leave the discrepancy for manual intervention
+)
+
+// RepairResolution decides the action for one item of a repair plan
+type RepairResolution string
+
+const (
+	ResolveTrustHistory RepairResolution = "history"  // Make the applied set match the history
+	ResolveTrustApplied RepairResolution = "applied"  // Make the history match the applied set
+	ResolveUnknown      RepairResolution = "unknown"  // Leave the discrepancy as is
+	ResolveValidate     RepairResolution = "validate" // Run the migration's Validate to tell whether it is applied
+)
+
+// RepairItem is a discrepancy of one migration and the action resolving it
+type RepairItem struct {
+	MigrationID string
+	Kind        DiscrepancyKind
+	Message     string // Description of the discrepancy
+	Action      RepairAction
+}
+
+// RepairPlan is the diff a repair applies to the schema state
+type RepairPlan struct {
+	Mode        RepairMode
+	Items       []RepairItem
+	FromVersion int64 // CurrentVersion before the repair
+	ToVersion   int64 // CurrentVersion recomputed from the repaired applied set
+
+	applied map[string]bool // Applied set the plan was made for
+}
+
+// Empty reports whether the repair changes nothing
+func (p *RepairPlan) Empty() bool {
+	for _, item := range p.Items {
+		if item.Action != RepairSkip {
+			return false
+		}
+	}
+	return p.FromVersion == p.ToVersion
+}
+
+// PlanRepair returns the changes a repair in the given mode would make, without
+// changing the state. Discrepancies the mode does not resolve are included with
+// RepairSkip. Show the plan as a preview, change the action of single items with
+// ResolveRepair and pass it to ApplyRepair.
+func (s *SchemaManager) PlanRepair(mode RepairMode) (*RepairPlan, error) {
+	schema, err := s.GetSchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	plan := &RepairPlan{Mode: mode, FromVersion: schema.CurrentVersion, applied: schema.AppliedMigrations}
+	for _, d := range checkVersion(schema).Discrepancies {
+		if d.MigrationID == "" || d.Kind == DiscrepancyInvalidID {
+			continue
+		}
+		action, ok := repairAction(mode, d.Kind)
+		if !ok {
+			action = RepairSkip
+		}
+		plan.Items = append(plan.Items, RepairItem{MigrationID: d.MigrationID, Kind: d.Kind, Message: d.Message, Action: action})
+	}
+	plan.updateVersion()
+	return plan, nil
+}
+
+// updateVersion recomputes ToVersion after the actions of the plan changed
+func (p *RepairPlan) updateVersion() {
+	applied := make(map[string]bool, len(p.applied))
+	for id := range p.applied {
+		applied[id] = true
+	}
+	p.apply(applied)
+	p.ToVersion, _ = appliedVersion(applied)
+}
+
+// ResolveRepair sets the action of the i-th item of a plan from a resolution.
+// ResolveValidate runs the Validate function of the migration from the registry
+// against the database: the migration is considered applied if it passes and not
+// applied if it fails. Without a Validate function the item is left unresolved.
+// It returns the action chosen.
+func (s *SchemaManager) ResolveRepair(plan *RepairPlan, i int, resolution RepairResolution, registry *MigrationRegistry) (RepairAction, error) {
+	item := &plan.Items[i]
+	switch resolution {
+	case ResolveTrustHistory:
+		item.Action, _ = repairAction(RepairFromHistory, item.Kind)
+	case ResolveTrustApplied:
+		item.Action = trustApplied(item.Kind)
+	case ResolveUnknown:
+		item.Action = RepairSkip
+	case ResolveValidate:
+		var migration *Migration
+		if registry != nil {
+			migration, _ = registry.GetMigration(item.MigrationID)
+		}
+		if migration == nil || migration.Validate == nil {
+			item.Action = RepairSkip
+			break
+		}
+		// Treat the migration as if the side claiming it is applied is right
+		// when it validates, and the other side otherwise
+		claimsApplied := item.Kind != DiscrepancyNotApplied
+		if err := migration.Validate(s.db); err != nil {
+			claimsApplied = !claimsApplied
+		}
+		if claimsApplied {
+			item.Action = trustApplied(item.Kind)
+		} else {
+			item.Action, _ = repairAction(RepairFromHistory, item.Kind)
+		}
+	default:
+		return "", fmt.Errorf("unknown repair resolution %q", resolution)
+	}
+	plan.updateVersion()
+	return item.Action, nil
+}
+
+// trustApplied returns the action making the history match the applied set
+func trustApplied(kind DiscrepancyKind) RepairAction {
+	if kind == DiscrepancyNotApplied {
+		return RepairAddRollback
+	}
+	return RepairAddHistory
+}
+
+// repairAction returns the action resolving a kind of discrepancy in a mode
+func repairAction(mode RepairMode, kind DiscrepancyKind) (RepairAction, bool) {
+	switch kind {
+	case DiscrepancyMissingHistory:
+		if mode == RepairFromHistory {
+			return RepairUnmarkApplied, true
+		}
+		return RepairAddHistory, true
+	case DiscrepancyRolledBack:
+		if mode == RepairFromApplied {
+			return RepairAddHistory, true
+		}
+		return RepairUnmarkApplied, true
+	case DiscrepancyNotApplied:
+		if mode == RepairFromApplied {
+			// Only a rollback record could say the migration is not applied, and
+			// recording a rollback that never ran is left to ResolveTrustApplied
+			return "", false
+		}
+		return RepairMarkApplied, true
+	}
+	return "", false
+}
+
+// apply applies the applied set changes of the plan
+func (p *RepairPlan) apply(applied map[string]bool) {
+	for _, item := range p.Items {
+		switch item.Action {
+		case RepairMarkApplied:
+			applied[item.MigrationID] = true
+		case RepairUnmarkApplied:
+			delete(applied, item.MigrationID)
+		}
+	}
+}
+
+// ApplyRepair applies a plan returned by PlanRepair, recomputes the current
+// version and marks the state clean. The registry provides the descriptions of
+// the added history records and may be nil.
+func (s *SchemaManager) ApplyRepair(plan *RepairPlan, registry *MigrationRegistry) error {
+	now := time.Now()
+	var records []MigrationRecord
+	for _, item := range plan.Items {
+		recordType := RecordRepair
+		switch item.Action {
+		case RepairAddHistory:
+		case RepairAddRollback:
+			recordType = RecordRollback
+		default:
+			continue
+		}
+		description := "unknown migration"
+		if registry != nil {
+			if m, ok := registry.GetMigration(item.MigrationID); ok {
+				description = m.Description
+			}
+		}
+		records = append(records, MigrationRecord{
+			ID:           item.MigrationID,
+			Type:         recordType,
+			Description:  fmt.Sprintf("%s (repaired - %s)", description, strings.ReplaceAll(string(item.Kind), "_", " ")),
+			AppliedAt:    now,
+			DurationText: "0s",
+			Success:      true,
+		})
+	}
+
+	if err := s.snapshot(fmt.Sprintf("repair (%s)", plan.Mode)); err != nil {
+		return err
+	}
+
+	err := s.modifySchema(func(head *SchemaVersion) ([]MigrationRecord, error) {
+		if head.AppliedMigrations == nil {
+			head.AppliedMigrations = make(map[string]bool)
+		}
+		plan.apply(head.AppliedMigrations)
+		head.CurrentVersion, _ = appliedVersion(head.AppliedMigrations)
+		head.Status = StatusClean
+		return records, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save repaired schema: %w", err)
+	}
+	return nil
+}
+
+// RebuildAppliedMigrations rebuilds the applied set from the history, the inverse
+// of RepairMissingHistory: a migration is applied if its last successful history
+// record applied it. It returns the applied changes.
+func (s *SchemaManager) RebuildAppliedMigrations() (*RepairPlan, error) {
+	plan, err := s.PlanRepair(RepairFromHistory)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Empty() {
+		return plan, nil
+	}
+	if err := s.ApplyRepair(plan, nil); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,187 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestRepairModes(t *testing.T) {
+	// An applied set and a history disagreeing in each possible way: c has no
+	// history, b was rolled back but is still applied, d was applied but is not
+	// in the applied set
+	setup := func(t *testing.T) *SchemaManager {
+		db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		schemaManager := NewSchemaManager(db)
+		now := time.Now()
+		if err := schemaManager.SetSchemaVersion(&SchemaVersion{
+			CurrentVersion: 1754917300,
+			AppliedMigrations: map[string]bool{
+				"1754917200_a": true,
+				"1754917300_b": true,
+				"1754917250_c": true,
+			},
+			MigrationHistory: []MigrationRecord{
+				{ID: "1754917200_a", Type: RecordApply, AppliedAt: now, Success: true},
+				{ID: "1754917300_b", Type: RecordApply, AppliedAt: now, Success: true},
+				{ID: "1754917400_d", Type: RecordApply, AppliedAt: now, Success: true},
+				{ID: "1754917300_b", Type: RecordRollback, AppliedAt: now, Success: true},
+			},
+			Status: StatusDirty,
+		}); err != nil {
+			t.Fatalf("Failed to store schema: %v", err)
+		}
+		return schemaManager
+	}
+
+	tests := []struct {
+		mode       RepairMode
+		actions    map[string]RepairAction
+		applied    []string
+		version    int64
+		consistent bool
+	}{
+		{
+			mode:    RepairFromApplied,
+			actions: map[string]RepairAction{"1754917250_c": RepairAddHistory, "1754917300_b": RepairAddHistory, "1754917400_d": RepairSkip},
+			applied: []string{"1754917200_a", "1754917250_c", "1754917300_b"},
+			version: 1754917300,
+		},
+		{
+			mode:       RepairFromHistory,
+			actions:    map[string]RepairAction{"1754917250_c": RepairUnmarkApplied, "1754917300_b": RepairUnmarkApplied, "1754917400_d": RepairMarkApplied},
+			applied:    []string{"1754917200_a", "1754917400_d"},
+			version:    1754917400,
+			consistent: true,
+		},
+		{
+			mode:       RepairReconcile,
+			actions:    map[string]RepairAction{"1754917250_c": RepairAddHistory, "1754917300_b": RepairUnmarkApplied, "1754917400_d": RepairMarkApplied},
+			applied:    []string{"1754917200_a", "1754917250_c", "1754917400_d"},
+			version:    1754917400,
+			consistent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			schemaManager := setup(t)
+
+			plan, err := schemaManager.PlanRepair(tt.mode)
+			if err != nil {
+				t.Fatalf("Failed to plan repair: %v", err)
+			}
+			if len(plan.Items) != len(tt.actions) || plan.ToVersion != tt.version {
+				t.Fatalf("Unexpected plan: %+v", plan)
+			}
+			for _, item := range plan.Items {
+				if tt.actions[item.MigrationID] != item.Action {
+					t.Errorf("Expected %s for %s, got %s", tt.actions[item.MigrationID], item.MigrationID, item.Action)
+				}
+			}
+			if schema, _ := schemaManager.GetSchemaVersion(); len(schema.AppliedMigrations) != 3 {
+				t.Errorf("Expected PlanRepair not to change the state")
+			}
+
+			if err := schemaManager.ApplyRepair(plan, nil); err != nil {
+				t.Fatalf("Failed to apply repair: %v", err)
+			}
+			schema, _ := schemaManager.GetSchemaVersion()
+			if len(schema.AppliedMigrations) != len(tt.applied) || schema.CurrentVersion != tt.version || schema.Status != StatusClean {
+				t.Errorf("Unexpected state after repair: %+v", schema)
+			}
+			for _, id := range tt.applied {
+				if !schema.AppliedMigrations[id] {
+					t.Errorf("Expected %s to be applied", id)
+				}
+			}
+
+			err = schemaManager.ValidateSchemaState()
+			if tt.consistent && err != nil {
+				t.Errorf("Expected the repaired state to validate: %v", err)
+			}
+			if !tt.consistent && err == nil {
+				t.Errorf("Expected the record of 1754917400_d to remain inconsistent")
+			}
+		})
+	}
+
+	t.Run("ResolvePerItem", func(t *testing.T) {
+		schemaManager := setup(t)
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{
+			ID:       "1754917250_c",
+			Up:       func(db *pebble.DB) error { return nil },
+			Down:     func(db *pebble.DB) error { return nil },
+			Validate: func(db *pebble.DB) error { return errors.New("not applied") },
+		})
+
+		plan, err := schemaManager.PlanRepair(RepairReconcile)
+		if err != nil {
+			t.Fatalf("Failed to plan repair: %v", err)
+		}
+		resolutions := map[string]RepairResolution{
+			"1754917250_c": ResolveValidate,
+			"1754917300_b": ResolveTrustApplied,
+			"1754917400_d": ResolveTrustApplied,
+		}
+		expected := map[string]RepairAction{
+			"1754917250_c": RepairUnmarkApplied,
+			"1754917300_b": RepairAddHistory,
+			"1754917400_d": RepairAddRollback,
+		}
+		for i, item := range plan.Items {
+			action, err := schemaManager.ResolveRepair(plan, i, resolutions[item.MigrationID], registry)
+			if err != nil {
+				t.Fatalf("Failed to resolve %s: %v", item.MigrationID, err)
+			}
+			if action != expected[item.MigrationID] {
+				t.Errorf("Expected %s for %s, got %s", expected[item.MigrationID], item.MigrationID, action)
+			}
+		}
+		if plan.ToVersion != 1754917300 {
+			t.Errorf("Expected the version to follow the resolutions, got %d", plan.ToVersion)
+		}
+		if _, err := schemaManager.ResolveRepair(plan, 0, "guess", registry); err == nil {
+			t.Errorf("Expected an unknown resolution to fail")
+		}
+
+		if err := schemaManager.ApplyRepair(plan, registry); err != nil {
+			t.Fatalf("Failed to apply repair: %v", err)
+		}
+		schema, _ := schemaManager.GetSchemaVersion()
+		if len(schema.AppliedMigrations) != 2 || !schema.AppliedMigrations["1754917200_a"] || !schema.AppliedMigrations["1754917300_b"] {
+			t.Errorf("Unexpected applied migrations: %v", schema.AppliedMigrations)
+		}
+		if err := schemaManager.ValidateSchemaState(); err != nil {
+			t.Errorf("Expected the resolved state to validate: %v", err)
+		}
+	})
+
+	t.Run("RebuildAppliedMigrations", func(t *testing.T) {
+		schemaManager := setup(t)
+		plan, err := schemaManager.RebuildAppliedMigrations()
+		if err != nil {
+			t.Fatalf("Failed to rebuild: %v", err)
+		}
+		if plan.Mode != RepairFromHistory || len(plan.Items) != 3 {
+			t.Errorf("Unexpected plan: %+v", plan)
+		}
+		if err := schemaManager.ValidateSchemaState(); err != nil {
+			t.Errorf("Expected the rebuilt state to validate: %v", err)
+		}
+
+		plan, err = schemaManager.RebuildAppliedMigrations()
+		if err != nil || !plan.Empty() {
+			t.Errorf("Expected nothing left to rebuild, got %+v (%v)", plan, err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// DB returns the database the engine operates on. It changes when RestoreBackup
+// reopens the database.
+func (e *MigrationEngine) DB() *pebble.DB {
+	return e.db
+}
+
+// RestoreBackup restores a backup into the database the engine operates on. The
+// database is closed right before the restored copy is swapped in and reopened
+// with opts afterwards, also when the restore fails and the previous database is
+// swapped back. The engine and its schema manager then use the reopened database;
+// callers get it from DB and must not use the old handle, or anything derived
+// from it, again.
+//
+// The engine's registry is set on the backup manager, so the report lists the
+// migrations that need to be reapplied. While a plan is executing on the
+// database, RestoreBackup fails with ErrConcurrentExecution.
+func (e *MigrationEngine) RestoreBackup(backupPath string, opts *pebble.Options) (*RestoreReport, error) {
+	if e.backupManager == nil {
+		return nil, fmt.Errorf("no backup manager configured")
+	}
+	e.backupManager.SetRegistry(e.registry)
+
+	// A plan must not use the database while it is closed and swapped
+	end, err := e.claim("restore")
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
+	closed := false
+	report, err := e.backupManager.RestoreInto(backupPath, func() error {
+		if err := e.db.Close(); err != nil {
+			return err
+		}
+		closed = true
+		return nil
+	})
+	if !closed {
+		return nil, err
+	}
+
+	db, openErr := pebble.Open(e.dbPath, opts)
+	if openErr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("%w (and failed to reopen database: %v)", err, openErr)
+		}
+		return nil, fmt.Errorf("failed to reopen database: %w", openErr)
+	}
+	e.db = db
+	e.schemaManager.db = db
+	return report, err
+}
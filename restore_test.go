@@ -0,0 +1,220 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestRestoreSwap(t *testing.T) {
+	// setup creates a database with a backup holding key=before, then sets key=after
+	setup := func(t *testing.T, opts BackupOptions) (string, *BackupManager, *BackupInfo) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		db.Set([]byte("key"), []byte("before"), pebble.Sync)
+		backupManager := NewBackupManagerWithOptions(dbPath, opts)
+		backup, err := backupManager.CreateBackup(db, "Before")
+		if err != nil {
+			t.Fatalf("Failed to create backup: %v", err)
+		}
+		db.Set([]byte("key"), []byte("after"), pebble.Sync)
+		return dbPath, backupManager, backup
+	}
+
+	value := func(t *testing.T, dbPath string) string {
+		db, err := pebble.Open(dbPath, &pebble.Options{ReadOnly: true})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		data, closer, err := db.Get([]byte("key"))
+		if err != nil {
+			t.Fatalf("Failed to read key: %v", err)
+		}
+		defer closer.Close()
+		return string(data)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		dbPath, backupManager, backup := setup(t, BackupOptions{})
+
+		if err := backupManager.RestoreBackup(backup.Path); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		if v := value(t, dbPath); v != "before" {
+			t.Errorf("Expected the restored value, got %q", v)
+		}
+		if _, err := os.Stat(backupManager.previousPath()); !os.IsNotExist(err) {
+			t.Errorf("Expected the previous database to be removed, got %v", err)
+		}
+		if artifacts, _ := backupManager.ListArtifacts(); len(artifacts) != 0 {
+			t.Errorf("Expected no artifacts, got %+v", artifacts)
+		}
+	})
+
+	t.Run("Compressed", func(t *testing.T) {
+		dbPath, backupManager, backup := setup(t, BackupOptions{Compress: true})
+		if !strings.HasSuffix(backup.Path, ".tar.gz") {
+			t.Fatalf("Expected a compressed backup, got %s", backup.Path)
+		}
+
+		if err := backupManager.RestoreBackup(backup.Path); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		if v := value(t, dbPath); v != "before" {
+			t.Errorf("Expected the restored value, got %q", v)
+		}
+		if artifacts, _ := backupManager.ListArtifacts(); len(artifacts) != 0 {
+			t.Errorf("Expected no artifacts, got %+v", artifacts)
+		}
+	})
+
+	t.Run("FailedVerificationSwapsBack", func(t *testing.T) {
+		dbPath, backupManager, backup := setup(t, BackupOptions{})
+		backupManager.SetFaultInjector(FailAt(FaultDuringRestore, 0))
+
+		err := backupManager.RestoreBackup(backup.Path)
+		if !errors.Is(err, ErrInjectedFault) {
+			t.Fatalf("Expected the injected fault, got %v", err)
+		}
+		if v := value(t, dbPath); v != "after" {
+			t.Errorf("Expected the live database to be swapped back, got %q", v)
+		}
+		if artifacts, _ := backupManager.ListArtifacts(); len(artifacts) != 0 {
+			t.Errorf("Expected no artifacts, got %+v", artifacts)
+		}
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+
+		noop := func(db *pebble.DB) error { return nil }
+		registry := NewMigrationRegistry()
+		registry.Register(&Migration{ID: "1754917200_first", Up: noop, Down: noop})
+		registry.Register(&Migration{ID: "1754917300_second", Up: noop, Down: noop})
+
+		// The backup has the first migration, the live database both
+		schemaManager := NewSchemaManager(db)
+		schemaManager.UpdateSchemaAfterMigration("1754917200_first", 1754917200, "First", time.Second)
+		backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{})
+		backupManager.SetRegistry(registry)
+		backup, err := backupManager.CreateBackup(db, "Before second")
+		if err != nil {
+			t.Fatalf("Failed to create backup: %v", err)
+		}
+		schemaManager.UpdateSchemaAfterMigration("1754917300_second", 1754917300, "Second", time.Second)
+		db.Close()
+
+		report, err := backupManager.RestoreBackupWithReport(backup.Path)
+		if err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		if report.RestoredVersion != 1754917200 || !report.VersionMatches() || report.Status != StatusClean {
+			t.Errorf("Expected the backup version to be restored, got %+v", report)
+		}
+		if report.ValidationError != nil {
+			t.Errorf("Expected the restored state to validate: %v", report.ValidationError)
+		}
+		if len(report.Pending) != 1 || report.Pending[0].ID != "1754917300_second" {
+			t.Errorf("Expected the second migration to be pending, got %v", report.Pending)
+		}
+	})
+
+	t.Run("LeftoverPreviousBlocksRestore", func(t *testing.T) {
+		dbPath, backupManager, backup := setup(t, BackupOptions{})
+		os.MkdirAll(backupManager.previousPath(), 0755)
+
+		if err := backupManager.RestoreBackup(backup.Path); err == nil {
+			t.Fatal("Expected a leftover previous database to block the restore")
+		}
+		if v := value(t, dbPath); v != "after" {
+			t.Errorf("Expected the live database to be untouched, got %q", v)
+		}
+
+		artifacts, _ := backupManager.ListArtifacts()
+		if len(artifacts) != 1 || artifacts[0].Kind != ArtifactPrevious {
+			t.Errorf("Expected the previous database to be listed, got %+v", artifacts)
+		}
+	})
+}
+
+func TestRestoreInto(t *testing.T) {
+	t.Run("EngineReopensDatabase", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, NewMigrationRegistry(), dbPath)
+		engine.SetBackupManager(NewBackupManagerWithOptions(dbPath, BackupOptions{}))
+
+		db.Set([]byte("key"), []byte("before"), pebble.Sync)
+		backup, err := engine.backupManager.CreateBackup(db, "Before")
+		if err != nil {
+			t.Fatalf("Failed to create backup: %v", err)
+		}
+		db.Set([]byte("key"), []byte("after"), pebble.Sync)
+
+		if _, err := engine.RestoreBackup(backup.Path, &pebble.Options{}); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		defer engine.DB().Close()
+
+		data, closer, err := engine.DB().Get([]byte("key"))
+		if err != nil {
+			t.Fatalf("Failed to read key from the reopened database: %v", err)
+		}
+		if string(data) != "before" {
+			t.Errorf("Expected the restored value, got %q", data)
+		}
+		closer.Close()
+
+		if _, err := schemaManager.GetSchemaVersion(); err != nil {
+			t.Errorf("Expected the schema manager to use the reopened database: %v", err)
+		}
+	})
+
+	t.Run("CloseFailureAbandonsRestore", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{})
+		backup, err := backupManager.CreateBackup(db, "Before")
+		if err != nil {
+			t.Fatalf("Failed to create backup: %v", err)
+		}
+
+		busy := errors.New("database busy")
+		_, err = backupManager.RestoreInto(backup.Path, func() error { return busy })
+		if !errors.Is(err, busy) {
+			t.Fatalf("Expected the close error, got %v", err)
+		}
+		if err := db.Set([]byte("key"), []byte("value"), pebble.Sync); err != nil {
+			t.Errorf("Expected the database to stay usable: %v", err)
+		}
+		if artifacts, _ := backupManager.ListArtifacts(); len(artifacts) != 0 {
+			t.Errorf("Expected no artifacts, got %+v", artifacts)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// lastGoodSuffix follows the database path in the name of the file recording the
+// backup taken before the last successful plan
+const lastGoodSuffix = ".last_good_backup"
+
+// PinBackup pins a backup so cleanup never removes it, whatever its age or the
+// number of backups. The reason is stored in the backup metadata.
+func (b *BackupManager) PinBackup(backupPath, reason string) error {
+	info, err := b.readBackupMetadata(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read backup metadata: %w", err)
+	}
+	if reason == "" {
+		reason = "pinned"
+	}
+	info.Pinned = reason
+	return b.writeBackupMetadata(info)
+}
+
+// UnpinBackup removes the pin of a backup
+func (b *BackupManager) UnpinBackup(backupPath string) error {
+	info, err := b.readBackupMetadata(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read backup metadata: %w", err)
+	}
+	info.Pinned = ""
+	return b.writeBackupMetadata(info)
+}
+
+// lastGoodPath returns the path of the file recording the last known good backup
+func (b *BackupManager) lastGoodPath() string {
+	return b.dbPath + lastGoodSuffix
+}
+
+// MarkLastGoodBackup records the backup taken before the last successful plan.
+// The engine calls it when a plan it backed up succeeds.
+func (b *BackupManager) MarkLastGoodBackup(backupPath string) error {
+	if err := os.WriteFile(b.lastGoodPath(), []byte(backupPath+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record last good backup: %w", err)
+	}
+	return nil
+}
+
+// LastGoodBackup returns the path of the backup taken before the last
+// successful plan, or "" if none was recorded
+func (b *BackupManager) LastGoodBackup() string {
+	data, err := os.ReadFile(b.lastGoodPath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// ProtectedBackups returns the backups cleanup keeps regardless of age and count,
+// with the reason: pinned backups, the newest complete backup, and the backup
+// taken before the last successful plan
+func (b *BackupManager) ProtectedBackups(backups []*BackupInfo) map[string]string {
+	protected := make(map[string]string)
+	var newest *BackupInfo
+	for _, backup := range backups {
+		if backup.Pinned != "" {
+			protected[backup.Path] = "pinned: " + backup.Pinned
+		}
+		if newest == nil || backup.CreatedAt.After(newest.CreatedAt) {
+			newest = backup
+		}
+	}
+	if lastGood := b.LastGoodBackup(); lastGood != "" {
+		protected[lastGood] = "backup of the last successful plan"
+	}
+	if newest != nil {
+		if _, ok := protected[newest.Path]; !ok {
+			protected[newest.Path] = "newest backup"
+		}
+	}
+	return protected
+}
+
+// removeOldBackup removes a backup during cleanup unless it is protected or
+// referenced, and reports whether it was removed
+func (b *BackupManager) removeOldBackup(backup *BackupInfo, protected map[string]string) bool {
+	if reason, ok := protected[backup.Path]; ok {
+		b.log().Printf("Keeping old backup %s (%s)", backup.Path, reason)
+		return false
+	}
+	if err := b.checkUnreferenced(backup.Path); err != nil {
+		b.log().Printf("Keeping old backup: %v", err)
+		return false
+	}
+	b.log().Printf("Removing old backup: %s", backup.Path)
+	if err := b.RemoveBackup(backup.Path); err != nil {
+		b.warnf("backup cleanup", "failed to remove backup %s: %v", backup.Path, err)
+		return false
+	}
+	return true
+}
+
+// performBackupCleanup removes the oldest backups beyond the maxBackups limit.
+// Protected backups are kept even beyond the limit.
+func (b *BackupManager) performBackupCleanup() error {
+	if b.maxBackups <= 0 {
+		return nil // No limit
+	}
+
+	backups, err := b.ListBackups()
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+	if len(backups) <= b.maxBackups {
+		return nil
+	}
+
+	// Newest first
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	protected := b.ProtectedBackups(backups)
+	for _, backup := range backups[b.maxBackups:] {
+		b.removeOldBackup(backup, protected)
+	}
+	return nil
+}
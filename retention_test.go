@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestBackupRetention(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Backups of 4 days, oldest first
+	backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{})
+	var paths []string
+	for i := 4; i > 0; i-- {
+		info := &BackupInfo{
+			Path:        filepath.Join(dir, fmt.Sprintf("test.db.backup_2024010%d_000000", 5-i)),
+			OriginalDB:  dbPath,
+			CreatedAt:   time.Now().Add(-time.Duration(i) * 24 * time.Hour),
+			Description: "Backup",
+		}
+		os.MkdirAll(info.Path, 0755)
+		if err := backupManager.writeBackupMetadata(info); err != nil {
+			t.Fatalf("Failed to write metadata: %v", err)
+		}
+		paths = append(paths, info.Path)
+	}
+
+	if err := backupManager.PinBackup(paths[0], "before launch"); err != nil {
+		t.Fatalf("Failed to pin backup: %v", err)
+	}
+	if err := backupManager.MarkLastGoodBackup(paths[1]); err != nil {
+		t.Fatalf("Failed to mark last good backup: %v", err)
+	}
+
+	// Only the third backup is neither pinned, last good nor the newest
+	if err := backupManager.CleanupOldBackups(time.Hour); err != nil {
+		t.Fatalf("Failed to clean up: %v", err)
+	}
+	backups, _ := backupManager.ListBackups()
+	kept := make(map[string]bool)
+	for _, backup := range backups {
+		kept[backup.Path] = true
+	}
+	if len(backups) != 3 || !kept[paths[0]] || !kept[paths[1]] || !kept[paths[3]] {
+		t.Fatalf("Expected the protected backups to be kept, got %+v", backups)
+	}
+
+	// Count-based cleanup keeps protected backups too, even beyond the limit
+	if err := backupManager.UnpinBackup(paths[0]); err != nil {
+		t.Fatalf("Failed to unpin backup: %v", err)
+	}
+	backupManager.maxBackups = 1
+	if err := backupManager.performBackupCleanup(); err != nil {
+		t.Fatalf("Failed to clean up: %v", err)
+	}
+	backups, _ = backupManager.ListBackups()
+	if len(backups) != 2 {
+		t.Fatalf("Expected the last good and newest backups to be kept, got %+v", backups)
+	}
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected the unpinned backup to be removed, got %v", err)
+	}
+}
+
+func TestEngineMarksLastGoodBackup(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	registry := NewMigrationRegistry()
+	noop := func(db *pebble.DB) error { return nil }
+	registry.Register(&Migration{ID: "1754917200_first", Up: noop, Down: noop})
+
+	schemaManager := NewSchemaManager(db)
+	backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{})
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupManager(backupManager)
+
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+
+	backups, _ := backupManager.ListBackups()
+	if len(backups) != 1 || backupManager.LastGoodBackup() != backups[0].Path {
+		t.Errorf("Expected the plan's backup to be the last good one, got %q", backupManager.LastGoodBackup())
+	}
+}
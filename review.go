@@ -0,0 +1,314 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RollbackCoverage is how a migration is rolled back
+type RollbackCoverage string
+
+const (
+	RollbackDown      RollbackCoverage = "down"      // By its Down function
+	RollbackAutomatic RollbackCoverage = "automatic" // By restoring the values its Apply recorded
+)
+
+// ReviewReport describes the migrations added since a version for the review of
+// a release: their plan order, dependencies, lint findings, rollback coverage,
+// and what they change and how long they take if simulated against a database
+// (see MigrationEngine.SimulateReview)
+type ReviewReport struct {
+	Since       int64             `json:"since"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Migrations  []ReviewMigration `json:"migrations"` // In plan order
+
+	// Waves are the groups of consecutive migrations that may run in parallel
+	// (see MigrationEngine.SetParallelism); only set if a group has more than one
+	Waves     [][]string    `json:"waves,omitempty"`
+	Conflicts []KeyConflict `json:"conflicts,omitempty"`
+	Problems  []string      `json:"problems,omitempty"` // Lint findings
+
+	Simulated      bool            `json:"simulated"`
+	BackupEstimate *BackupEstimate `json:"backup_estimate,omitempty"` // Backup taken before the plan, if simulated
+}
+
+// ReviewMigration is a migration of a ReviewReport
+type ReviewMigration struct {
+	ID           string           `json:"id"`
+	Description  string           `json:"description,omitempty"`
+	Owner        string           `json:"owner,omitempty"`
+	RunbookURL   string           `json:"runbook_url,omitempty"`
+	Dependencies []string         `json:"dependencies,omitempty"`
+	Tags         []string         `json:"tags,omitempty"`
+	KeyPrefixes  []string         `json:"key_prefixes,omitempty"`
+	Rerunnable   bool             `json:"rerunnable"`
+	Validated    bool             `json:"validated"` // Whether it has a Validate function
+	Rollback     RollbackCoverage `json:"rollback"`
+
+	Simulation *ReviewSimulation `json:"simulation,omitempty"`
+}
+
+// ReviewSimulation is what a migration did in a dry run
+type ReviewSimulation struct {
+	Duration time.Duration `json:"duration"`
+	Added    int           `json:"added"`
+	Modified int           `json:"modified"`
+	Deleted  int           `json:"deleted"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// rollbackCoverage returns how m is rolled back; Register requires a Down
+// function unless Apply is set
+func rollbackCoverage(m *Migration) RollbackCoverage {
+	if m.Down == nil {
+		return RollbackAutomatic
+	}
+	return RollbackDown
+}
+
+// Review builds a report of the registered migrations with a version above since,
+// in the order an upgrade from since applies them
+func (r *MigrationRegistry) Review(since int64) (*ReviewReport, error) {
+	applied := make(map[string]bool)
+	for _, m := range r.GetMigrations() {
+		if m.Version <= since {
+			applied[m.ID] = true
+		}
+	}
+	migrations, err := r.GetPendingMigrations(applied)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReviewReport{Since: since, GeneratedAt: time.Now()}
+	for _, m := range migrations {
+		report.Migrations = append(report.Migrations, ReviewMigration{
+			ID:           m.ID,
+			Description:  m.Description,
+			Owner:        m.Owner,
+			RunbookURL:   m.RunbookURL,
+			Dependencies: m.Dependencies,
+			Tags:         m.Tags,
+			KeyPrefixes:  m.KeyPrefixes,
+			Rerunnable:   m.Rerunnable,
+			Validated:    m.Validate != nil || m.ValidateContext != nil,
+			Rollback:     rollbackCoverage(m),
+		})
+		if problem := StrictMetadataPolicy.problem(m); problem != "" {
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+	report.Problems = append(report.Problems, reviewVersionCollisions(r.GetMigrations(), since)...)
+	for _, future := range FindFutureMigrations(migrations, report.GeneratedAt, DefaultFutureTolerance) {
+		report.Problems = append(report.Problems, future.String())
+	}
+
+	waves := planWaves(r, migrations)
+	if len(waves) < len(migrations) {
+		for _, wave := range waves {
+			var ids []string
+			for _, m := range wave {
+				ids = append(ids, m.ID)
+			}
+			report.Waves = append(report.Waves, ids)
+		}
+	}
+	report.Conflicts = r.FindKeyConflicts(migrations)
+	return report, nil
+}
+
+// reviewVersionCollisions reports the migrations above since that share their
+// version with another migration
+func reviewVersionCollisions(migrations []*Migration, since int64) []string {
+	byVersion := make(map[int64][]string)
+	var versions []int64
+	for _, m := range migrations {
+		if len(byVersion[m.Version]) == 0 {
+			versions = append(versions, m.Version)
+		}
+		byVersion[m.Version] = append(byVersion[m.Version], m.ID)
+	}
+
+	var problems []string
+	for _, version := range versions {
+		if ids := byVersion[version]; version > since && len(ids) > 1 {
+			problems = append(problems, fmt.Sprintf("migrations %s share timestamp %d, so their order depends only on their IDs",
+				strings.Join(ids, ", "), version))
+		}
+	}
+	return problems
+}
+
+// Coverage returns the number of migrations of the report with each rollback coverage
+func (r *ReviewReport) Coverage() map[RollbackCoverage]int {
+	coverage := make(map[RollbackCoverage]int)
+	for _, m := range r.Migrations {
+		coverage[m.Rollback]++
+	}
+	return coverage
+}
+
+// SimulateReview runs the pending upgrade of the engine's database in a dry run
+// (see DryRun) and adds what every migration of the report did to it, along with
+// the estimate of the backup taken before the upgrade. Migrations of the report
+// already applied to the database are not simulated. The database is not
+// modified.
+func (e *MigrationEngine) SimulateReview(report *ReviewReport) error {
+	plan, err := NewMigrationPlanner(e.registry, e.schemaManager).PlanUpgrade()
+	if err != nil {
+		return err
+	}
+
+	report.Simulated = true
+	if e.backupManager != nil {
+		report.BackupEstimate = e.backupManager.EstimateBackupSize(e.db)
+	}
+	if len(plan.Migrations) == 0 {
+		return nil
+	}
+
+	dryRun, err := e.DryRun(plan)
+	if dryRun == nil {
+		return err
+	}
+	results := make(map[string]*MigrationDryRun)
+	for _, result := range dryRun.Migrations {
+		results[result.MigrationID] = result
+	}
+	for i := range report.Migrations {
+		result, ok := results[report.Migrations[i].ID]
+		if !ok {
+			continue
+		}
+		simulation := &ReviewSimulation{
+			Duration: result.Duration,
+			Added:    result.Added,
+			Modified: result.Modified,
+			Deleted:  result.Deleted,
+		}
+		if result.Err != nil {
+			simulation.Error = result.Err.Error()
+		}
+		report.Migrations[i].Simulation = simulation
+	}
+	// A failing migration is part of the report rather than an error
+	return nil
+}
+
+// Markdown renders the report as a Markdown document
+func (r *ReviewReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Migration Review\n\n")
+	fmt.Fprintf(&b, "%d migrations since version %d, generated %s.\n\n",
+		len(r.Migrations), r.Since, r.GeneratedAt.Format(time.RFC3339))
+	if len(r.Migrations) == 0 {
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "## Plan\n\n")
+	fmt.Fprintf(&b, "| # | Migration | Owner | Rollback | Validate | Rerunnable | Tags |\n")
+	fmt.Fprintf(&b, "|---|-----------|-------|----------|----------|------------|------|\n")
+	for i, m := range r.Migrations {
+		name := "`" + m.ID + "`"
+		if m.Description != "" {
+			name += " " + markdownCell(m.Description)
+		}
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s | %s |\n", i+1, name, markdownCell(m.Owner),
+			m.Rollback, yesNo(m.Validated), yesNo(m.Rerunnable), markdownCell(strings.Join(m.Tags, ", ")))
+	}
+
+	coverage := r.Coverage()
+	fmt.Fprintf(&b, "\n## Rollback Coverage\n\n")
+	fmt.Fprintf(&b, "- Down function: %d\n", coverage[RollbackDown])
+	fmt.Fprintf(&b, "- Automatic, restoring the values Apply recorded: %d\n", coverage[RollbackAutomatic])
+	var unvalidated []string
+	for _, m := range r.Migrations {
+		if !m.Validated {
+			unvalidated = append(unvalidated, m.ID)
+		}
+	}
+	if len(unvalidated) > 0 {
+		fmt.Fprintf(&b, "\nWithout a Validate function, a failed upgrade is only noticed if Up fails: `%s`\n",
+			strings.Join(unvalidated, "`, `"))
+	}
+
+	fmt.Fprintf(&b, "\n## Dependencies\n\n")
+	fmt.Fprintf(&b, "```mermaid\ngraph TD\n")
+	for _, m := range r.Migrations {
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", mermaidID(m.ID), m.ID)
+		for _, dep := range m.Dependencies {
+			fmt.Fprintf(&b, "    %s --> %s\n", mermaidID(dep), mermaidID(m.ID))
+		}
+	}
+	fmt.Fprintf(&b, "```\n")
+	if len(r.Waves) > 0 {
+		fmt.Fprintf(&b, "\nWith parallelism, the migrations run in %d waves:\n\n", len(r.Waves))
+		for i, wave := range r.Waves {
+			fmt.Fprintf(&b, "%d. `%s`\n", i+1, strings.Join(wave, "`, `"))
+		}
+	}
+
+	fmt.Fprintf(&b, "\n## Lint\n\n")
+	if len(r.Problems) == 0 && len(r.Conflicts) == 0 {
+		fmt.Fprintf(&b, "No problems found.\n")
+	}
+	for _, problem := range r.Problems {
+		fmt.Fprintf(&b, "- %s\n", markdownCell(problem))
+	}
+	for _, conflict := range r.Conflicts {
+		fmt.Fprintf(&b, "- %s\n", markdownCell(conflict.String()))
+	}
+
+	fmt.Fprintf(&b, "\n## Simulation\n\n")
+	if !r.Simulated {
+		fmt.Fprintf(&b, "Not simulated: no database given.\n")
+		return b.String()
+	}
+	if e := r.BackupEstimate; e != nil {
+		fmt.Fprintf(&b, "Backup before the upgrade: about %.2f MB in %s.\n\n",
+			float64(e.Size)/1024/1024, e.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(&b, "| Migration | Duration | Added | Modified | Deleted | Result |\n")
+	fmt.Fprintf(&b, "|-----------|----------|-------|----------|---------|--------|\n")
+	var total time.Duration
+	for _, m := range r.Migrations {
+		s := m.Simulation
+		if s == nil {
+			fmt.Fprintf(&b, "| `%s` | | | | | not run (applied or after a failure) |\n", m.ID)
+			continue
+		}
+		result := "ok"
+		if s.Error != "" {
+			result = "failed: " + markdownCell(s.Error)
+		}
+		total += s.Duration
+		fmt.Fprintf(&b, "| `%s` | %s | %d | %d | %d | %s |\n", m.ID, s.Duration.Round(time.Millisecond),
+			s.Added, s.Modified, s.Deleted, result)
+	}
+	fmt.Fprintf(&b, "\nTotal simulated duration: %s.\n", total.Round(time.Millisecond))
+	return b.String()
+}
+
+// markdownCell escapes text for a Markdown table cell or list item
+func markdownCell(text string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(text)
+}
+
+// mermaidID returns a Mermaid node ID for a migration ID
+func mermaidID(id string) string {
+	return "m" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, id)
+}
+
+// yesNo renders a boolean for a Markdown table
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,94 @@
+package migrate
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestReview(t *testing.T) {
+	setKey := func(key string) MigrationFunc {
+		return func(db *pebble.DB) error { return db.Set([]byte(key), []byte("v"), pebble.Sync) }
+	}
+	registry := NewMigrationRegistry()
+	for _, m := range []*Migration{
+		{ID: "1754917100_old", Up: setKey("old"), Down: setKey("old")},
+		{ID: "1754917200_a", Description: "Add a", Owner: "team", RunbookURL: "https://runbooks/a",
+			Up: setKey("a"), Down: func(db *pebble.DB) error { return db.Delete([]byte("a"), pebble.Sync) }},
+		{ID: "1754917300_b", Dependencies: []string{"1754917200_a"},
+			Apply: func(w *Writer) error { return w.Set([]byte("b"), []byte("v")) }},
+		{ID: "1754917400_c", KeyPrefixes: []string{"c/"}, Up: setKey("c/1"), Down: setKey("c/1")},
+		{ID: "1754917400_d", KeyPrefixes: []string{"d/"}, Up: setKey("d/1"), Down: setKey("d/1")},
+	} {
+		if err := registry.Register(m); err != nil {
+			t.Fatalf("Failed to register %s: %v", m.ID, err)
+		}
+	}
+
+	report, err := registry.Review(1754917100)
+	if err != nil {
+		t.Fatalf("Failed to review: %v", err)
+	}
+	var ids []string
+	for _, m := range report.Migrations {
+		ids = append(ids, m.ID)
+	}
+	if strings.Join(ids, ",") != "1754917200_a,1754917300_b,1754917400_c,1754917400_d" {
+		t.Fatalf("Expected the migrations since the version in plan order, got %v", ids)
+	}
+	if coverage := report.Coverage(); coverage[RollbackDown] != 3 || coverage[RollbackAutomatic] != 1 {
+		t.Errorf("Unexpected rollback coverage: %v", coverage)
+	}
+	if len(report.Waves) != 3 || len(report.Waves[2]) != 2 {
+		t.Errorf("Expected c and d in one wave, got %v", report.Waves)
+	}
+	problems := strings.Join(report.Problems, "\n")
+	if strings.Contains(problems, "1754917200_a") || !strings.Contains(problems, "'1754917300_b' has no") ||
+		!strings.Contains(problems, "share timestamp 1754917400") {
+		t.Errorf("Unexpected lint problems:\n%s", problems)
+	}
+
+	markdown := report.Markdown()
+	for _, want := range []string{"## Plan", "| automatic |", "m1754917200_a --> m1754917300_b", "Not simulated"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Expected the Markdown report to contain %q:\n%s", want, markdown)
+		}
+	}
+
+	// The simulation runs the pending migrations of a database on a copy
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	schemaManager := NewSchemaManager(db)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	plan, err := NewMigrationPlanner(registry, schemaManager).PlanUpgradeTo(1754917200)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	engine.SetBackupEnabled(false)
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+
+	if err := engine.SimulateReview(report); err != nil {
+		t.Fatalf("Failed to simulate: %v", err)
+	}
+	if !report.Simulated || report.BackupEstimate == nil {
+		t.Errorf("Expected the report to be simulated with a backup estimate")
+	}
+	if report.Migrations[0].Simulation != nil {
+		t.Errorf("Expected the applied migration not to be simulated")
+	}
+	if s := report.Migrations[1].Simulation; s == nil || s.Added != 1 || s.Error != "" {
+		t.Errorf("Expected the simulation to add one key, got %+v", s)
+	}
+	if _, closer, err := db.Get([]byte("b")); err == nil {
+		closer.Close()
+		t.Errorf("Expected the simulation not to modify the database")
+	}
+}
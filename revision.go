@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// maxSchemaUpdateAttempts is how often a schema update is retried on a conflict
+const maxSchemaUpdateAttempts = 5
+
+// schemaWriteMu makes the revision check and the write of a schema update atomic.
+// Pebble's directory lock keeps other processes out, so this covers every writer.
+var schemaWriteMu sync.Mutex
+
+// SchemaConflictError is returned when the stored schema state changed between
+// reading and writing it. It matches ErrSchemaConflict with errors.Is.
+type SchemaConflictError struct {
+	Expected uint64 // Revision the update was based on
+	Actual   uint64 // Revision found in the database
+}
+
+func (e *SchemaConflictError) Error() string {
+	return fmt.Sprintf("%v: expected revision %d, found %d", ErrSchemaConflict, e.Expected, e.Actual)
+}
+
+func (e *SchemaConflictError) Unwrap() error {
+	return ErrSchemaConflict
+}
+
+// commitSchema writes the schema head together with the other writes in batch, if
+// the stored revision still matches the revision head was read at. On success the
+// revision of head is incremented.
+func (s *SchemaManager) commitSchema(batch *pebble.Batch, head *SchemaVersion) error {
+	schemaWriteMu.Lock()
+	defer schemaWriteMu.Unlock()
+
+	stored, err := s.getSchemaHead()
+	if err != nil {
+		return err
+	}
+	if stored.Revision != head.Revision {
+		return &SchemaConflictError{Expected: head.Revision, Actual: stored.Revision}
+	}
+
+	// Only a migrating state names the migrations being executed, and only a
+	// dirty state the failure
+	if head.Status != StatusMigrating {
+		head.RunningMigrations = nil
+	}
+	if head.Status != StatusDirty {
+		head.LastFailure = nil
+	}
+	next := *head
+	next.Revision++
+	data, err := encodeSchemaHead(&next, s.encoding)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema version: %w", err)
+	}
+	if err := s.writeSchemaData(batch, data); err != nil {
+		return fmt.Errorf("failed to store schema version: %w", err)
+	}
+
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return fmt.Errorf("failed to store schema version: %w", err)
+	}
+	head.Revision = next.Revision
+	return nil
+}
+
+// modifySchema applies fn to the current schema head and stores the result with the
+// history records fn returns. If the state changed concurrently, the update is
+// retried on the new state.
+func (s *SchemaManager) modifySchema(fn func(head *SchemaVersion) ([]MigrationRecord, error)) error {
+	var err error
+	for attempt := 0; attempt < maxSchemaUpdateAttempts; attempt++ {
+		var head *SchemaVersion
+		head, err = s.getSchemaHead()
+		if err != nil {
+			return fmt.Errorf("failed to get current schema version: %w", err)
+		}
+
+		var records []MigrationRecord
+		records, err = fn(head)
+		if err != nil {
+			return err
+		}
+
+		err = s.updateSchema(head, records...)
+		if !errors.Is(err, ErrSchemaConflict) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestSchemaRevision(t *testing.T) {
+	setup := func(t *testing.T) *SchemaManager {
+		db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return NewSchemaManager(db)
+	}
+
+	t.Run("Increments", func(t *testing.T) {
+		schemaManager := setup(t)
+
+		for i := 1; i <= 3; i++ {
+			if err := schemaManager.SetCurrentVersion(int64(1754917200 + i)); err != nil {
+				t.Fatalf("Failed to update schema: %v", err)
+			}
+			version, err := schemaManager.GetSchemaVersion()
+			if err != nil {
+				t.Fatalf("Failed to read schema: %v", err)
+			}
+			if version.Revision != uint64(i) {
+				t.Errorf("Expected revision %d, got %d", i, version.Revision)
+			}
+		}
+	})
+
+	t.Run("StaleWriteConflicts", func(t *testing.T) {
+		schemaManager := setup(t)
+		schemaManager.MarkMigrationStarted()
+
+		stale, _ := schemaManager.GetSchemaVersion()
+		fresh, _ := schemaManager.GetSchemaVersion()
+
+		fresh.Status = StatusClean
+		if err := schemaManager.SetSchemaVersion(fresh); err != nil {
+			t.Fatalf("Failed to store schema: %v", err)
+		}
+		if fresh.Revision != stale.Revision+1 {
+			t.Errorf("Expected the written state to have revision %d, got %d", stale.Revision+1, fresh.Revision)
+		}
+
+		stale.Status = StatusDirty
+		err := schemaManager.SetSchemaVersion(stale)
+		if !errors.Is(err, ErrSchemaConflict) {
+			t.Fatalf("Expected ErrSchemaConflict, got %v", err)
+		}
+		var conflict *SchemaConflictError
+		if !errors.As(err, &conflict) || conflict.Expected != stale.Revision || conflict.Actual != fresh.Revision {
+			t.Errorf("Expected conflict between revisions %d and %d, got %v", stale.Revision, fresh.Revision, err)
+		}
+
+		version, _ := schemaManager.GetSchemaVersion()
+		if version.Status != StatusClean {
+			t.Errorf("Expected the stale write to be rejected, status is %s", version.Status)
+		}
+	})
+
+	t.Run("ConcurrentUpdatesKeepAllRecords", func(t *testing.T) {
+		schemaManager := setup(t)
+
+		// Updates read the state outside the write lock, so they race; conflicts
+		// are retried and no update is lost
+		var wg sync.WaitGroup
+		errs := make(chan error, 4)
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				id := fmt.Sprintf("%d_step", 1754917200+i)
+				errs <- schemaManager.UpdateSchemaAfterMigration(id, int64(1754917200+i), "Step", time.Second)
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Errorf("Update failed: %v", err)
+			}
+		}
+
+		version, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to read schema: %v", err)
+		}
+		if len(version.AppliedMigrations) != 4 || len(version.MigrationHistory) != 4 {
+			t.Errorf("Expected 4 applied migrations and records, got %d and %d",
+				len(version.AppliedMigrations), len(version.MigrationHistory))
+		}
+		if version.Revision != 4 {
+			t.Errorf("Expected revision 4, got %d", version.Revision)
+		}
+	})
+}
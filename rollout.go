@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+)
+
+// RolloutGate decides whether this node runs the startup migrations of a plan.
+// Use it to roll heavy migrations out gradually across a fleet of nodes that
+// each have their own database. A node that is gated out starts without
+// running the plan.
+type RolloutGate func(plan *ExecutionPlan) bool
+
+// HostnamePercentGate returns a gate that lets percent of the nodes run a plan,
+// chosen by a hash of the hostname and the target version of the plan. A node's
+// choice is stable across restarts, and raising the percentage keeps the nodes
+// already chosen. If the hostname cannot be read, the node is gated out.
+func HostnamePercentGate(percent int) RolloutGate {
+	return func(plan *ExecutionPlan) bool {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return false
+		}
+		return rolloutBucket(hostname, plan.TargetVersion) < percent
+	}
+}
+
+// EnvCohortGate returns a gate that lets the nodes run a plan whose environment
+// variable name is set to one of the cohorts, e.g. EnvCohortGate("MIGRATION_COHORT",
+// "canary", "wave1").
+func EnvCohortGate(name string, cohorts ...string) RolloutGate {
+	return func(plan *ExecutionPlan) bool {
+		value := os.Getenv(name)
+		for _, cohort := range cohorts {
+			if value == cohort {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// rolloutBucket returns the bucket between 0 and 99 a node falls into for a
+// target version
+func rolloutBucket(hostname string, targetVersion int64) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s/%d", hostname, targetVersion)
+	return int(h.Sum32() % 100)
+}
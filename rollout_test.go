@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestRolloutGates(t *testing.T) {
+	plan := &ExecutionPlan{TargetVersion: 1754917300}
+
+	t.Run("HostnamePercent", func(t *testing.T) {
+		if HostnamePercentGate(0)(plan) {
+			t.Errorf("Expected no node to pass a 0%% gate")
+		}
+		if !HostnamePercentGate(100)(plan) {
+			t.Errorf("Expected every node to pass a 100%% gate")
+		}
+
+		// About the requested share of hosts pass, and raising the share keeps them
+		passed := 0
+		for i := 0; i < 1000; i++ {
+			host := fmt.Sprintf("node-%d", i)
+			in10 := rolloutBucket(host, plan.TargetVersion) < 10
+			in50 := rolloutBucket(host, plan.TargetVersion) < 50
+			if in10 {
+				passed++
+			}
+			if in10 && !in50 {
+				t.Fatalf("Expected %s to stay in the rollout when raising the share", host)
+			}
+		}
+		if passed < 50 || passed > 150 {
+			t.Errorf("Expected about 100 of 1000 hosts in a 10%% rollout, got %d", passed)
+		}
+	})
+
+	t.Run("EnvCohort", func(t *testing.T) {
+		gate := EnvCohortGate("TEST_MIGRATION_COHORT", "canary", "wave1")
+		t.Setenv("TEST_MIGRATION_COHORT", "wave1")
+		if !gate(plan) {
+			t.Errorf("Expected the wave1 cohort to pass")
+		}
+		t.Setenv("TEST_MIGRATION_COHORT", "wave2")
+		if gate(plan) {
+			t.Errorf("Expected the wave2 cohort to be gated out")
+		}
+	})
+
+	t.Run("GatedOutNodeStartsWithoutMigrating", func(t *testing.T) {
+		originalRegistry := GlobalRegistry
+		defer func() { GlobalRegistry = originalRegistry }()
+		GlobalRegistry = NewMigrationRegistry()
+		GlobalRegistry.Register(&Migration{
+			ID:   "1754917300_heavy",
+			Up:   func(db *pebble.DB) error { return nil },
+			Down: func(db *pebble.DB) error { return nil },
+		})
+
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		// A database with data is not fresh, so the migration is pending
+		db.Set([]byte("data"), []byte("value"), pebble.Sync)
+
+		opts := DefaultStartupOptions()
+		opts.RunMigrations = true
+		opts.CheckDiskSpace = false
+		opts.Logger = &NopLogger{}
+		var gated *ExecutionPlan
+		opts.RolloutGate = func(plan *ExecutionPlan) bool {
+			gated = plan
+			return false
+		}
+		if err := CheckAndRunStartupMigrations(db, dbPath, opts); err != nil {
+			t.Fatalf("Expected a gated out node to start: %v", err)
+		}
+		if gated == nil || len(gated.Migrations) != 1 {
+			t.Fatalf("Expected the gate to see the pending plan, got %+v", gated)
+		}
+		if applied, _ := NewSchemaManager(db).IsMigrationApplied("1754917300_heavy"); applied {
+			t.Errorf("Expected the migration not to run on a gated out node")
+		}
+
+		opts.MinSchemaVersion = 1754917300
+		if err := CheckAndRunStartupMigrations(db, dbPath, opts); err == nil {
+			t.Errorf("Expected a gated out node below the minimum version to fail")
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package migrate
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// SampledKey is a key and its value picked by SampleKeys
+type SampledKey struct {
+	Key   []byte
+	Value []byte
+}
+
+// SampleOptions configures ValidateSample
+type SampleOptions struct {
+	// Size is the number of keys to check. Default: derived from Confidence and
+	// Tolerance.
+	Size int
+
+	// Confidence is the probability of sampling at least one bad key if at least
+	// a Tolerance fraction of the keys is bad. Default: 0.99
+	Confidence float64
+
+	// Tolerance is the smallest fraction of bad keys that is detected with
+	// Confidence. Default: 0.01, which with the default confidence checks 459 keys.
+	Tolerance float64
+
+	// MaxFailures is the number of failed keys accepted before the validation
+	// fails. Default: 0
+	MaxFailures int
+
+	// Seed seeds the sampling. Default: derived from the current time. Failures
+	// report the seed needed to reproduce them.
+	Seed int64
+}
+
+// sampleSize returns the number of keys to sample: Size if set, or else the
+// smallest n with 1-(1-Tolerance)^n >= Confidence
+func (o SampleOptions) sampleSize() int {
+	if o.Size > 0 {
+		return o.Size
+	}
+	confidence, tolerance := o.Confidence, o.Tolerance
+	if confidence <= 0 || confidence >= 1 {
+		confidence = 0.99
+	}
+	if tolerance <= 0 || tolerance >= 1 {
+		tolerance = 0.01
+	}
+	return int(math.Ceil(math.Log(1-confidence) / math.Log(1-tolerance)))
+}
+
+// SampleKeys picks up to n keys under prefix uniformly at random with reservoir
+// sampling, in one pass over the prefix without holding more than n keys. It
+// returns the sample in key order and the number of keys under prefix.
+func SampleKeys(db *pebble.DB, prefix []byte, n int, r *rand.Rand) ([]SampledKey, int64, error) {
+	iter, err := db.NewIter(&pebble.IterOptions{LowerBound: prefix, UpperBound: prefixUpperBound(prefix)})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer iter.Close()
+	if n < 0 {
+		n = 0
+	}
+
+	// The position of each sampled key in the prefix restores the key order
+	type sampled struct {
+		SampledKey
+		position int64
+	}
+	reservoir := make([]sampled, 0, n)
+	var seen int64
+	for iter.First(); iter.Valid(); iter.Next() {
+		seen++
+		slot := -1
+		if len(reservoir) < n {
+			reservoir = append(reservoir, sampled{})
+			slot = len(reservoir) - 1
+		} else if j := r.Int63n(seen); j < int64(n) {
+			slot = int(j)
+		}
+		if slot >= 0 {
+			reservoir[slot] = sampled{
+				SampledKey: SampledKey{Key: append([]byte(nil), iter.Key()...), Value: append([]byte(nil), iter.Value()...)},
+				position:   seen,
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, 0, err
+	}
+
+	sort.Slice(reservoir, func(i, j int) bool { return reservoir[i].position < reservoir[j].position })
+	sample := make([]SampledKey, len(reservoir))
+	for i, kv := range reservoir {
+		sample[i] = kv.SampledKey
+	}
+	return sample, seen, nil
+}
+
+// ValidateSample checks predicate on a random sample of the keys under prefix,
+// so the validation of a migration that rewrote a huge prefix costs one scan of
+// its keys instead of decoding and checking every value. It fails with
+// ErrSampleValidation if more than opts.MaxFailures sampled keys fail. A prefix
+// smaller than the sample is checked completely.
+func ValidateSample(db *pebble.DB, prefix []byte, opts SampleOptions, predicate func(key, value []byte) error) error {
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	sample, total, err := SampleKeys(db, prefix, opts.sampleSize(), rand.New(rand.NewSource(opts.Seed)))
+	if err != nil {
+		return fmt.Errorf("failed to sample keys under %q: %w", prefix, err)
+	}
+
+	var failures []string
+	for _, kv := range sample {
+		if err := predicate(kv.Key, kv.Value); err != nil {
+			failure := fmt.Sprintf("%q: %v", kv.Key, err)
+			if _, decoder := valueDecoder(kv.Key); decoder != nil {
+				failure += " (value " + RenderValue(kv.Key, kv.Value) + ")"
+			}
+			failures = append(failures, failure)
+		}
+	}
+	failed := len(failures)
+	if failed <= opts.MaxFailures {
+		return nil
+	}
+	if failed > 5 {
+		failures = append(failures[:5], fmt.Sprintf("and %d more", len(failures)-5))
+	}
+	return fmt.Errorf("%w: %d of %d sampled keys (of %d) under %q failed (reproduce with SampleOptions{Seed: %d}): %s",
+		ErrSampleValidation, failed, len(sample), total, prefix, opts.Seed, strings.Join(failures, "; "))
+}
+
+// SampleValidator returns a Validate function that checks predicate on a random
+// sample of the keys under prefix, see ValidateSample
+func SampleValidator(prefix string, opts SampleOptions, predicate func(key, value []byte) error) MigrationFunc {
+	return func(db *pebble.DB) error {
+		return ValidateSample(db, []byte(prefix), opts, predicate)
+	}
+}
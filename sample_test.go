@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestSampleKeys(t *testing.T) {
+	db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 1000; i++ {
+		if err := db.Set([]byte(fmt.Sprintf("user/%04d", i)), []byte("v"), pebble.NoSync); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+	if err := db.Set([]byte("usez"), []byte("v"), pebble.NoSync); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	sample, total, err := SampleKeys(db, []byte("user/"), 100, r)
+	if err != nil {
+		t.Fatalf("Failed to sample: %v", err)
+	}
+	if total != 1000 || len(sample) != 100 {
+		t.Fatalf("Expected 100 of 1000 keys, got %d of %d", len(sample), total)
+	}
+	if !sort.SliceIsSorted(sample, func(i, j int) bool { return bytes.Compare(sample[i].Key, sample[j].Key) < 0 }) {
+		t.Errorf("Expected the sample in key order")
+	}
+	for i := 1; i < len(sample); i++ {
+		if bytes.Equal(sample[i].Key, sample[i-1].Key) {
+			t.Errorf("Key %s sampled twice", sample[i].Key)
+		}
+	}
+
+	// Every key has the same chance: over many samples, keys from the start and
+	// the end of the prefix are picked about n/N = 10% of the time
+	counts := make(map[string]int)
+	for i := 0; i < 500; i++ {
+		sample, _, err := SampleKeys(db, []byte("user/"), 100, r)
+		if err != nil {
+			t.Fatalf("Failed to sample: %v", err)
+		}
+		for _, kv := range sample {
+			counts[string(kv.Key)]++
+		}
+	}
+	for _, key := range []string{"user/0000", "user/0500", "user/0999"} {
+		if counts[key] < 20 || counts[key] > 90 {
+			t.Errorf("Expected %s in about 50 of 500 samples, got %d", key, counts[key])
+		}
+	}
+
+	sample, total, err = SampleKeys(db, []byte("user/000"), 100, r)
+	if err != nil || total != 10 || len(sample) != 10 {
+		t.Errorf("Expected a small prefix to be sampled completely, got %d of %d, %v", len(sample), total, err)
+	}
+}
+
+func TestValidateSample(t *testing.T) {
+	db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// One in ten keys was not migrated
+	for i := 0; i < 5000; i++ {
+		value := "v2"
+		if i%10 == 0 {
+			value = "v1"
+		}
+		if err := db.Set([]byte(fmt.Sprintf("user/%04d", i)), []byte(value), pebble.NoSync); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+	migrated := func(key, value []byte) error {
+		if string(value) != "v2" {
+			return fmt.Errorf("value %s", value)
+		}
+		return nil
+	}
+
+	if size := (SampleOptions{}).sampleSize(); size != 459 {
+		t.Errorf("Expected 459 keys for 99%% confidence and 1%% tolerance, got %d", size)
+	}
+	if size := (SampleOptions{Confidence: 0.95, Tolerance: 0.05}).sampleSize(); size != 59 {
+		t.Errorf("Expected 59 keys for 95%% confidence and 5%% tolerance, got %d", size)
+	}
+
+	err = ValidateSample(db, []byte("user/"), SampleOptions{Seed: 7}, migrated)
+	if !errors.Is(err, ErrSampleValidation) {
+		t.Fatalf("Expected ErrSampleValidation, got %v", err)
+	}
+	if !bytes.Contains([]byte(err.Error()), []byte("SampleOptions{Seed: 7}")) {
+		t.Errorf("Expected the error to name the seed, got %v", err)
+	}
+
+	if err := ValidateSample(db, []byte("user/"), SampleOptions{Size: 50, MaxFailures: 50, Seed: 7}, migrated); err != nil {
+		t.Errorf("Expected failures within MaxFailures to pass, got %v", err)
+	}
+
+	validate := SampleValidator("user/", SampleOptions{}, func(key, value []byte) error { return nil })
+	if err := validate(db); err != nil {
+		t.Errorf("Expected the validator to pass, got %v", err)
+	}
+}
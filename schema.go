@@ -1,8 +1,8 @@
 package migrate
 
 import (
-	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/pebble"
@@ -10,19 +10,92 @@ import (
 
 // SchemaManager handles schema version management in Pebble
 type SchemaManager struct {
-	db *pebble.DB
+	db        *pebble.DB
+	schemaKey string
+	keyPrefix string
+	encoding  SchemaEncoding
+
+	snapshotLimit int // Number of schema snapshots kept, see SetSnapshotLimit
+	chunkSize     int // Size above which the state is stored in chunks, see SetSchemaChunkSize
+
+	dataProbe DataProbe // Tells application data from other keys, see SetDataProbe
 }
 
-// NewSchemaManager creates a new schema manager
+// NewSchemaManager creates a new schema manager using the default
+// SchemaVersionKey and MigrationPrefix keys
 func NewSchemaManager(db *pebble.DB) *SchemaManager {
 	return &SchemaManager{
-		db: db,
+		db:        db,
+		schemaKey: SchemaVersionKey,
+		keyPrefix: MigrationPrefix,
+		encoding:  SchemaEncodingJSON,
+
+		snapshotLimit: DefaultSnapshotLimit,
+		chunkSize:     DefaultSchemaChunkSize,
+	}
+}
+
+// SetSchemaKey relocates the key the schema state is stored under.
+// Use this when the default key conflicts with application data, or to keep
+// several logical stores with independent migrations in one database.
+func (s *SchemaManager) SetSchemaKey(key string) {
+	if key == "" {
+		key = SchemaVersionKey
+	}
+	s.schemaKey = key
+}
+
+// SetKeyPrefix relocates the internal key prefix used for migration metadata
+func (s *SchemaManager) SetKeyPrefix(prefix string) {
+	if prefix == "" {
+		prefix = MigrationPrefix
+	}
+	s.keyPrefix = prefix
+}
+
+// SetEncoding selects how the schema state is written. Both encodings are always
+// read, so a stored state is converted on the next write after switching.
+func (s *SchemaManager) SetEncoding(encoding SchemaEncoding) {
+	if encoding == "" {
+		encoding = SchemaEncodingJSON
 	}
+	s.encoding = encoding
+}
+
+// Encoding returns the encoding the schema state is written in
+func (s *SchemaManager) Encoding() SchemaEncoding {
+	return s.encoding
+}
+
+// SchemaKey returns the key the schema state is stored under
+func (s *SchemaManager) SchemaKey() string {
+	return s.schemaKey
 }
 
-// GetSchemaVersion retrieves the current schema version from Pebble
+// KeyPrefix returns the internal key prefix used for migration metadata
+func (s *SchemaManager) KeyPrefix() string {
+	return s.keyPrefix
+}
+
+// GetSchemaVersion retrieves the current schema version, including the full
+// migration history, from Pebble
 func (s *SchemaManager) GetSchemaVersion() (*SchemaVersion, error) {
-	data, closer, err := s.db.Get([]byte(SchemaVersionKey))
+	version, err := s.getSchemaHead()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadHistory(version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// getSchemaHead retrieves the schema version without the history records stored
+// under their own keys. Use it with updateSchema for updates that do not need the
+// history.
+func (s *SchemaManager) getSchemaHead() (*SchemaVersion, error) {
+	data, _, err := s.readSchemaData()
 	if err != nil {
 		if err == pebble.ErrNotFound {
 			// Return default schema version for new databases
@@ -36,145 +109,222 @@ func (s *SchemaManager) GetSchemaVersion() (*SchemaVersion, error) {
 		}
 		return nil, fmt.Errorf("failed to get schema version: %w", err)
 	}
-	defer closer.Close()
 
-	var version SchemaVersion
-	if err := json.Unmarshal(data, &version); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal schema version: %w", err)
+	return decodeSchemaVersion(data)
+}
+
+// decodeSchemaVersion decodes and sanity-checks a stored schema version.
+// Malformed or hand-edited state returns an error wrapping ErrCorruptSchemaState.
+// History records stored under their own keys are not loaded.
+func decodeSchemaVersion(data []byte) (*SchemaVersion, error) {
+	stored, err := decodeStoredSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal schema version: %v", ErrCorruptSchemaState, err)
+	}
+
+	version := SchemaVersion{
+		CurrentVersion:    stored.CurrentVersion,
+		AppliedMigrations: stored.AppliedMigrations,
+		MigrationHistory:  stored.MigrationHistory,
+		LastMigrationAt:   stored.LastMigrationAt,
+		Status:            stored.Status,
+		Revision:          stored.Revision,
+		Environment:       stored.Environment,
+		RunningMigrations: stored.RunningMigrations,
+		LastFailure:       stored.LastFailure,
+		lastHistoryKey:    stored.LastHistoryKey,
+	}
+	if stored.Applied != nil {
+		version.AppliedMigrations = make(map[string]bool, len(stored.Applied))
+		for _, id := range stored.Applied {
+			version.AppliedMigrations[id] = true
+		}
+	}
+
+	switch version.Status {
+	case StatusClean, StatusMigrating, StatusDirty, StatusRollback:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrCorruptSchemaState, version.Status)
+	}
+
+	if version.CurrentVersion < 0 {
+		return nil, fmt.Errorf("%w: negative current version %d", ErrCorruptSchemaState, version.CurrentVersion)
+	}
+
+	if version.AppliedMigrations == nil {
+		version.AppliedMigrations = make(map[string]bool)
+	}
+	// Earlier versions also marked reruns as applied under a suffixed ID; the
+	// next update stores the applied set without them
+	for id := range version.AppliedMigrations {
+		if strings.HasSuffix(id, "_rerun") {
+			delete(version.AppliedMigrations, id)
+		}
+	}
+	if version.MigrationHistory == nil {
+		version.MigrationHistory = make([]MigrationRecord, 0)
+	}
+	for i := range version.MigrationHistory {
+		normalizeRecord(&version.MigrationHistory[i])
 	}
 
 	return &version, nil
 }
 
-// SetSchemaVersion stores the schema version in Pebble
+// SetSchemaVersion replaces the stored schema state, including the whole migration
+// history. The write is conditional: version.Revision must match the stored
+// revision (0 if no state is stored), otherwise a *SchemaConflictError is returned.
+// Read the state with GetSchemaVersion, modify it and write it back; on a conflict,
+// read it again. On success version.Revision is incremented. The replaced state
+// is snapshotted first, see SchemaSnapshots.
 func (s *SchemaManager) SetSchemaVersion(version *SchemaVersion) error {
-	data, err := json.Marshal(version)
-	if err != nil {
-		return fmt.Errorf("failed to marshal schema version: %w", err)
+	return s.setSchemaVersion(version, "replace state")
+}
+
+// setSchemaVersion replaces the stored schema state after snapshotting it
+func (s *SchemaManager) setSchemaVersion(version *SchemaVersion, reason string) error {
+	if err := s.snapshot(reason); err != nil {
+		return err
 	}
 
-	if err := s.db.Set([]byte(SchemaVersionKey), data, pebble.Sync); err != nil {
-		return fmt.Errorf("failed to store schema version: %w", err)
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	if err := batch.DeleteRange(s.historyPrefix(), prefixUpperBound(s.historyPrefix()), nil); err != nil {
+		return fmt.Errorf("failed to replace history: %w", err)
+	}
+
+	head := *version
+	head.lastHistoryKey = 0
+	for _, record := range version.MigrationHistory {
+		if err := s.putHistoryRecord(batch, &head, record); err != nil {
+			return err
+		}
 	}
 
+	if err := s.commitSchema(batch, &head); err != nil {
+		return err
+	}
+	version.Revision = head.Revision
+	version.lastHistoryKey = head.lastHistoryKey
+
 	return nil
 }
 
 // UpdateSchemaAfterMigration updates the schema after a successful migration
 func (s *SchemaManager) UpdateSchemaAfterMigration(migrationID string, version int64, description string, duration time.Duration) error {
-	currentSchema, err := s.GetSchemaVersion()
-	if err != nil {
-		return fmt.Errorf("failed to get current schema version: %w", err)
-	}
+	return s.recordApplied(migrationID, RecordApply, version, description, duration)
+}
 
-	// Add migration record
-	record := MigrationRecord{
-		ID:          migrationID,
-		Description: description,
-		AppliedAt:   time.Now(),
-		Duration:    duration.String(),
-		Success:     true,
-	}
+// recordApplied marks a migration as applied with a history record of the given type
+func (s *SchemaManager) recordApplied(migrationID string, recordType RecordType, version int64, description string, duration time.Duration) error {
+	return s.modifySchema(func(currentSchema *SchemaVersion) ([]MigrationRecord, error) {
+		// Add migration record
+		record := MigrationRecord{
+			ID:           migrationID,
+			Type:         recordType,
+			Description:  description,
+			AppliedAt:    time.Now(),
+			Duration:     duration,
+			DurationText: duration.String(),
+			Success:      true,
+		}
 
-	// Mark migration as applied
-	if currentSchema.AppliedMigrations == nil {
-		currentSchema.AppliedMigrations = make(map[string]bool)
-	}
-	currentSchema.AppliedMigrations[migrationID] = true
-	currentSchema.MigrationHistory = append(currentSchema.MigrationHistory, record)
-	currentSchema.LastMigrationAt = record.AppliedAt
-	currentSchema.Status = StatusClean
+		// Mark migration as applied
+		if currentSchema.AppliedMigrations == nil {
+			currentSchema.AppliedMigrations = make(map[string]bool)
+		}
+		currentSchema.AppliedMigrations[migrationID] = true
+		currentSchema.LastMigrationAt = record.AppliedAt
+		currentSchema.Status = StatusClean
 
-	// Update current version to the migration's Unix timestamp
-	if version > currentSchema.CurrentVersion {
-		currentSchema.CurrentVersion = version
-	}
+		// Update current version to the migration's Unix timestamp
+		if version > currentSchema.CurrentVersion {
+			currentSchema.CurrentVersion = version
+		}
 
-	return s.SetSchemaVersion(currentSchema)
+		return []MigrationRecord{record}, nil
+	})
 }
 
-// MarkMigrationStarted marks the beginning of a migration
-func (s *SchemaManager) MarkMigrationStarted() error {
-	currentSchema, err := s.GetSchemaVersion()
-	if err != nil {
-		return fmt.Errorf("failed to get current schema version: %w", err)
-	}
-
-	currentSchema.Status = StatusMigrating
-	return s.SetSchemaVersion(currentSchema)
+// MarkMigrationStarted marks the beginning of a migration, recording the IDs of
+// the migrations being executed so that recovery after an interruption knows
+// which ones to check, see SchemaVersion.RunningMigrations
+func (s *SchemaManager) MarkMigrationStarted(migrationIDs ...string) error {
+	return s.modifySchema(func(currentSchema *SchemaVersion) ([]MigrationRecord, error) {
+		currentSchema.Status = StatusMigrating
+		currentSchema.RunningMigrations = append([]string(nil), migrationIDs...)
+		return nil, nil
+	})
 }
 
-// MarkMigrationFailed marks a migration as failed
-func (s *SchemaManager) MarkMigrationFailed(migrationID string, description string, migrationErr error) error {
-	currentSchema, err := s.GetSchemaVersion()
-	if err != nil {
-		return fmt.Errorf("failed to get current schema: %w", err)
-	}
+// MarkMigrationFailed marks a migration as failed after running for duration
+func (s *SchemaManager) MarkMigrationFailed(migrationID string, description string, duration time.Duration, migrationErr error) error {
+	return s.markFailed(migrationID, RecordApply, description, duration, migrationErr)
+}
 
-	// Add failed migration record to history
-	record := MigrationRecord{
-		ID:          migrationID,
-		Description: description + " (FAILED)",
-		AppliedAt:   time.Now(),
-		Duration:    "0s",
-		Success:     false,
-		Error:       migrationErr.Error(),
-	}
+// markFailed marks the schema dirty with a failed history record of the given type
+func (s *SchemaManager) markFailed(migrationID string, recordType RecordType, description string, duration time.Duration, migrationErr error) error {
+	return s.modifySchema(func(currentSchema *SchemaVersion) ([]MigrationRecord, error) {
+		// Add failed migration record to history
+		record := MigrationRecord{
+			ID:           migrationID,
+			Type:         recordType,
+			Description:  description + " (FAILED)",
+			AppliedAt:    time.Now(),
+			Duration:     duration,
+			DurationText: duration.String(),
+			Success:      false,
+			Error:        migrationErr.Error(),
+		}
 
-	currentSchema.MigrationHistory = append(currentSchema.MigrationHistory, record)
-	currentSchema.LastMigrationAt = record.AppliedAt
-	currentSchema.Status = StatusDirty
+		currentSchema.LastMigrationAt = record.AppliedAt
+		currentSchema.Status = StatusDirty
+		currentSchema.LastFailure = &MigrationFailure{
+			MigrationID: migrationID,
+			Type:        recordType,
+			Error:       record.Error,
+			FailedAt:    record.AppliedAt,
+			Remediation: failureRemediation(recordType),
+		}
 
-	return s.SetSchemaVersion(currentSchema)
+		return []MigrationRecord{record}, nil
+	})
 }
 
 // MarkRollbackStarted marks the beginning of a rollback
 func (s *SchemaManager) MarkRollbackStarted() error {
-	currentSchema, err := s.GetSchemaVersion()
-	if err != nil {
-		return fmt.Errorf("failed to get current schema version: %w", err)
-	}
-
-	currentSchema.Status = StatusRollback
-	return s.SetSchemaVersion(currentSchema)
+	return s.setStatus(StatusRollback)
 }
 
-// UpdateAfterRollback updates the schema after a successful rollback
-func (s *SchemaManager) UpdateAfterRollback(migrationID string, version int64, description string) error {
-	currentSchema, err := s.GetSchemaVersion()
-	if err != nil {
-		return fmt.Errorf("failed to get current schema: %w", err)
-	}
-
-	// Remove the migration from applied set
-	if currentSchema.AppliedMigrations != nil {
-		delete(currentSchema.AppliedMigrations, migrationID)
-	}
+// UpdateAfterRollback updates the schema after a successful rollback that ran for duration
+func (s *SchemaManager) UpdateAfterRollback(migrationID string, version int64, description string, duration time.Duration) error {
+	return s.modifySchema(func(currentSchema *SchemaVersion) ([]MigrationRecord, error) {
+		// Remove the migration from applied set
+		if currentSchema.AppliedMigrations != nil {
+			delete(currentSchema.AppliedMigrations, migrationID)
+		}
 
-	// Add rollback record to history
-	rollbackRecord := MigrationRecord{
-		ID:          migrationID + "_rollback",
-		Description: fmt.Sprintf("Rolled back: %s", description),
-		AppliedAt:   time.Now(),
-		Duration:    "0s",
-		Success:     true,
-	}
+		// Add rollback record to history
+		rollbackRecord := MigrationRecord{
+			ID:           migrationID,
+			Type:         RecordRollback,
+			Description:  fmt.Sprintf("Rolled back: %s", description),
+			AppliedAt:    time.Now(),
+			Duration:     duration,
+			DurationText: duration.String(),
+			Success:      true,
+		}
 
-	currentSchema.MigrationHistory = append(currentSchema.MigrationHistory, rollbackRecord)
-	currentSchema.LastMigrationAt = rollbackRecord.AppliedAt
-	currentSchema.Status = StatusClean
+		currentSchema.LastMigrationAt = rollbackRecord.AppliedAt
+		currentSchema.Status = StatusClean
 
-	// Update current version after rollback
-	// Find the highest version among remaining applied migrations
-	var maxVersion int64 = 0
-	for migID := range currentSchema.AppliedMigrations {
-		if migVersion, err := ParseMigrationVersion(migID); err == nil && migVersion > maxVersion {
-			maxVersion = migVersion
-		}
-	}
-	currentSchema.CurrentVersion = maxVersion
+		// Update current version after rollback
+		// Find the highest version among remaining applied migrations
+		currentSchema.CurrentVersion, _ = appliedVersion(currentSchema.AppliedMigrations)
 
-	return s.SetSchemaVersion(currentSchema)
+		return []MigrationRecord{rollbackRecord}, nil
+	})
 }
 
 // GetMigrationHistory returns the history of applied migrations
@@ -189,7 +339,7 @@ func (s *SchemaManager) GetMigrationHistory() ([]MigrationRecord, error) {
 
 // IsMigrationApplied checks if a specific migration has been applied
 func (s *SchemaManager) IsMigrationApplied(migrationID string) (bool, error) {
-	currentSchema, err := s.GetSchemaVersion()
+	currentSchema, err := s.getSchemaHead()
 	if err != nil {
 		return false, err
 	}
@@ -203,13 +353,13 @@ func (s *SchemaManager) IsMigrationApplied(migrationID string) (bool, error) {
 
 // SetCurrentVersion sets the current version (Unix timestamp) for the repository
 func (s *SchemaManager) SetCurrentVersion(version int64) error {
-	currentSchema, err := s.GetSchemaVersion()
-	if err != nil {
-		return fmt.Errorf("failed to get current schema: %w", err)
+	if err := s.snapshot("set current version"); err != nil {
+		return err
 	}
-
-	currentSchema.CurrentVersion = version
-	return s.SetSchemaVersion(currentSchema)
+	return s.modifySchema(func(currentSchema *SchemaVersion) ([]MigrationRecord, error) {
+		currentSchema.CurrentVersion = version
+		return nil, nil
+	})
 }
 
 // ValidateSchemaState performs basic validation on the schema state
@@ -221,6 +371,9 @@ func (s *SchemaManager) ValidateSchemaState() error {
 
 	// Check for dirty state
 	if currentSchema.Status == StatusDirty {
+		if currentSchema.LastFailure != nil {
+			return fmt.Errorf("database is in dirty state, manual intervention required: %s", currentSchema.LastFailure)
+		}
 		return fmt.Errorf("database is in dirty state, manual intervention required")
 	}
 
@@ -237,12 +390,14 @@ func (s *SchemaManager) ValidateSchemaState() error {
 	// Validate applied migrations are consistent with history
 	successfulMigrations := make(map[string]bool)
 	for _, record := range currentSchema.MigrationHistory {
-		if record.Success && !isRollbackRecord(record.ID) {
+		if !record.Success {
+			continue
+		}
+		if record.Type.Applies() {
 			successfulMigrations[record.ID] = true
-		} else if isRollbackRecord(record.ID) {
-			// Remove original migration from successful set if rollback succeeded
-			originalID := record.ID[:len(record.ID)-9] // Remove "_rollback" suffix
-			delete(successfulMigrations, originalID)
+		} else {
+			// A successful rollback removes the migration from the successful set
+			delete(successfulMigrations, record.ID)
 		}
 	}
 
@@ -267,22 +422,22 @@ func (s *SchemaManager) ValidateSchemaState() error {
 	return nil
 }
 
-// isRollbackRecord checks if a migration record is a rollback record
-func isRollbackRecord(id string) bool {
-	return len(id) > 9 && id[len(id)-9:] == "_rollback"
-}
-
 // ForceCleanState forces the schema to clean state (use with caution)
 // Note: This only changes the Status field. It does NOT fix missing history records.
-// Use RepairMissingHistory() to fix consistency issues between AppliedMigrations and MigrationHistory.
+// Use PlanRepair() and ApplyRepair() to fix consistency issues between AppliedMigrations and MigrationHistory.
 func (s *SchemaManager) ForceCleanState() error {
-	currentSchema, err := s.GetSchemaVersion()
-	if err != nil {
-		return fmt.Errorf("failed to get current schema version: %w", err)
+	if err := s.snapshot("force clean"); err != nil {
+		return err
 	}
+	return s.setStatus(StatusClean)
+}
 
-	currentSchema.Status = StatusClean
-	return s.SetSchemaVersion(currentSchema)
+// setStatus updates the status of the schema state
+func (s *SchemaManager) setStatus(status Status) error {
+	return s.modifySchema(func(currentSchema *SchemaVersion) ([]MigrationRecord, error) {
+		currentSchema.Status = status
+		return nil, nil
+	})
 }
 
 // RepairMissingHistory creates synthetic history records for any migrations
@@ -297,13 +452,14 @@ func (s *SchemaManager) RepairMissingHistory(registry *MigrationRegistry) ([]str
 	// Build set of migrations that have successful history records
 	successfulInHistory := make(map[string]bool)
 	for _, record := range currentSchema.MigrationHistory {
-		if record.Success && !isRollbackRecord(record.ID) {
+		if record.Success && record.Type.Applies() {
 			successfulInHistory[record.ID] = true
 		}
 	}
 
 	// Find applied migrations missing from history
 	var repaired []string
+	var records []MigrationRecord
 	now := time.Now()
 
 	for migrationID := range currentSchema.AppliedMigrations {
@@ -315,12 +471,13 @@ func (s *SchemaManager) RepairMissingHistory(registry *MigrationRegistry) ([]str
 			}
 
 			// Create synthetic history record
-			currentSchema.MigrationHistory = append(currentSchema.MigrationHistory, MigrationRecord{
-				ID:          migrationID,
-				Description: description + " (repaired - missing history)",
-				AppliedAt:   now,
-				Duration:    "0s",
-				Success:     true,
+			records = append(records, MigrationRecord{
+				ID:           migrationID,
+				Type:         RecordRepair,
+				Description:  description + " (repaired - missing history)",
+				AppliedAt:    now,
+				DurationText: "0s",
+				Success:      true,
 			})
 			repaired = append(repaired, migrationID)
 		}
@@ -330,22 +487,52 @@ func (s *SchemaManager) RepairMissingHistory(registry *MigrationRegistry) ([]str
 		return nil, nil // Nothing to repair
 	}
 
-	// Also ensure status is clean
-	currentSchema.Status = StatusClean
+	if err := s.snapshot("repair missing history"); err != nil {
+		return nil, err
+	}
 
-	if err := s.SetSchemaVersion(currentSchema); err != nil {
+	// Append the records and ensure status is clean
+	err = s.modifySchema(func(head *SchemaVersion) ([]MigrationRecord, error) {
+		head.Status = StatusClean
+		return records, nil
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to save repaired schema: %w", err)
 	}
 
 	return repaired, nil
 }
 
+// FreshDatabasePolicy is how a fresh database, one without any application data
+// (see SetDataProbe), is initialized, see SchemaManager.InitializeDatabase
+type FreshDatabasePolicy string
+
+const (
+	// FreshDatabaseMarkAllApplied initializes a fresh database at the latest
+	// version, recording every registered migration as applied without running
+	// it. Applications that create their data in its latest shape rely on it.
+	FreshDatabaseMarkAllApplied FreshDatabasePolicy = "mark_all_applied"
+	// FreshDatabaseRunAllMigrations initializes a fresh database at version 0,
+	// so that every migration runs, e.g. when migrations create the initial data
+	FreshDatabaseRunAllMigrations FreshDatabasePolicy = "run_all_migrations"
+	// FreshDatabaseFail refuses to initialize a fresh database, returning
+	// ErrFreshDatabase, e.g. to catch a wrong or unmounted data directory
+	FreshDatabaseFail FreshDatabasePolicy = "fail"
+)
+
 // InitializeFreshDatabase initializes schema for databases without __schema_version.
 // - If DB is empty (no keys): fresh database -> initialize at latest version
 // - If DB has keys: pre-migration database -> set version 0, run migrations
 func (s *SchemaManager) InitializeFreshDatabase(registry *MigrationRegistry) error {
+	return s.InitializeDatabase(registry, FreshDatabaseMarkAllApplied)
+}
+
+// InitializeDatabase initializes schema for databases without __schema_version
+// like InitializeFreshDatabase, treating an empty database as policy says. A
+// pre-migration database is always set to version 0.
+func (s *SchemaManager) InitializeDatabase(registry *MigrationRegistry, policy FreshDatabasePolicy) error {
 	// Check if schema key already exists
-	_, closer, err := s.db.Get([]byte(SchemaVersionKey))
+	_, closer, err := s.db.Get([]byte(s.schemaKey))
 	if err == nil {
 		closer.Close()
 		return nil // Already initialized, nothing to do
@@ -371,6 +558,21 @@ func (s *SchemaManager) InitializeFreshDatabase(registry *MigrationRegistry) err
 		})
 	}
 
+	switch policy {
+	case "", FreshDatabaseMarkAllApplied:
+	case FreshDatabaseRunAllMigrations:
+		return s.SetSchemaVersion(&SchemaVersion{
+			CurrentVersion:    0,
+			AppliedMigrations: make(map[string]bool),
+			MigrationHistory:  make([]MigrationRecord, 0),
+			Status:            StatusClean,
+		})
+	case FreshDatabaseFail:
+		return ErrFreshDatabase
+	default:
+		return fmt.Errorf("unknown fresh database policy %q", policy)
+	}
+
 	// Truly fresh database - initialize at latest version
 	migrations := registry.GetMigrations()
 	if len(migrations) == 0 {
@@ -396,11 +598,12 @@ func (s *SchemaManager) InitializeFreshDatabase(registry *MigrationRegistry) err
 
 		// Create synthetic history record for fresh db initialization
 		migrationHistory = append(migrationHistory, MigrationRecord{
-			ID:          m.ID,
-			Description: m.Description + " (skipped - fresh database)",
-			AppliedAt:   now,
-			Duration:    "0s",
-			Success:     true,
+			ID:           m.ID,
+			Type:         RecordBaseline,
+			Description:  m.Description + " (skipped - fresh database)",
+			AppliedAt:    now,
+			DurationText: "0s",
+			Success:      true,
 		})
 	}
 
@@ -412,7 +615,8 @@ func (s *SchemaManager) InitializeFreshDatabase(registry *MigrationRegistry) err
 	})
 }
 
-// isDatabaseEmpty checks if the database has any keys at all
+// isDatabaseEmpty checks if the database has any application data, by default
+// any keys at all (see SetDataProbe)
 func (s *SchemaManager) isDatabaseEmpty() (bool, error) {
 	iter, err := s.db.NewIter(nil) // nil options = iterate all keys
 	if err != nil {
@@ -421,5 +625,13 @@ func (s *SchemaManager) isDatabaseEmpty() (bool, error) {
 	defer iter.Close()
 
 	// If First() returns false, there are no keys
-	return !iter.First(), nil
+	if s.dataProbe == nil {
+		return !iter.First(), nil
+	}
+	for iter.First(); iter.Valid(); iter.Next() {
+		if s.dataProbe(iter.Key()) {
+			return false, nil
+		}
+	}
+	return true, iter.Error()
 }
@@ -0,0 +1,408 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+	"gopkg.in/yaml.v3"
+)
+
+// Script operation names
+const (
+	ScriptOpSet          = "set"           // Set the keys in Values
+	ScriptOpDelete       = "delete"        // Delete the keys in Keys
+	ScriptOpRename       = "rename"        // Move the value of key From to key To
+	ScriptOpCopyPrefix   = "copy_prefix"   // Copy every key under From to the same suffix under To
+	ScriptOpDeletePrefix = "delete_prefix" // Delete every key under Prefix
+	ScriptOpReencode     = "reencode"      // Rewrite every value under Prefix with the named Codec
+)
+
+// scriptBatchSize is the number of keys written per batch by prefix operations
+const scriptBatchSize = 1000
+
+// ScriptMigration is a declarative migration loaded from a YAML or JSON file.
+// Its steps are interpreted at runtime, so small data fixes can be shipped
+// without recompiling the binary.
+type ScriptMigration struct {
+	ID           string     `json:"id" yaml:"id"`
+	Description  string     `json:"description" yaml:"description"`
+	Owner        string     `json:"owner" yaml:"owner"`
+	RunbookURL   string     `json:"runbook_url" yaml:"runbook_url"`
+	Dependencies []string   `json:"dependencies" yaml:"dependencies"`
+	Rerunnable   bool       `json:"rerunnable" yaml:"rerunnable"`
+	BestEffort   bool       `json:"best_effort" yaml:"best_effort"`
+	Priority     int        `json:"priority" yaml:"priority"`
+	Tags         []string   `json:"tags" yaml:"tags"`
+	Up           []ScriptOp `json:"up" yaml:"up"`
+	Down         []ScriptOp `json:"down" yaml:"down"`
+}
+
+// ScriptOp is a single step of a script migration
+type ScriptOp struct {
+	Op       string            `json:"op" yaml:"op"`
+	Prefix   string            `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	From     string            `json:"from,omitempty" yaml:"from,omitempty"`
+	To       string            `json:"to,omitempty" yaml:"to,omitempty"`
+	Keys     []string          `json:"keys,omitempty" yaml:"keys,omitempty"`
+	Values   map[string]string `json:"values,omitempty" yaml:"values,omitempty"`
+	Encoding string            `json:"encoding,omitempty" yaml:"encoding,omitempty"` // Encoding of Values: "" (raw), "base64" or "hex"
+	Codec    string            `json:"codec,omitempty" yaml:"codec,omitempty"`
+}
+
+// ValueCodec transforms a stored value; it is used by the reencode script operation
+type ValueCodec func(key, value []byte) ([]byte, error)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]ValueCodec{
+		"base64_encode": func(key, value []byte) ([]byte, error) {
+			return []byte(base64.StdEncoding.EncodeToString(value)), nil
+		},
+		"base64_decode": func(key, value []byte) ([]byte, error) {
+			return base64.StdEncoding.DecodeString(string(value))
+		},
+		"hex_encode": func(key, value []byte) ([]byte, error) {
+			return []byte(hex.EncodeToString(value)), nil
+		},
+		"hex_decode": func(key, value []byte) ([]byte, error) {
+			return hex.DecodeString(string(value))
+		},
+		"json_compact": func(key, value []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, value); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		},
+	}
+)
+
+// RegisterCodec makes a value codec available to script migrations under name.
+// Codecs must be registered before the scripts that use them are loaded.
+func RegisterCodec(name string, codec ValueCodec) error {
+	if name == "" || codec == nil {
+		return fmt.Errorf("codec name and function are required")
+	}
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, exists := codecs[name]; exists {
+		return fmt.Errorf("codec '%s' already registered", name)
+	}
+	codecs[name] = codec
+	return nil
+}
+
+// lookupCodec returns the codec registered under name
+func lookupCodec(name string) (ValueCodec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+// IsScriptMigrationFile reports whether a file name has a script migration extension
+func IsScriptMigrationFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// LoadScriptMigration reads a script migration from a .json, .yaml or .yml file.
+// If the file does not set an ID, the file name without extension is used.
+func LoadScriptMigration(path string) (*ScriptMigration, error) {
+	var script ScriptMigration
+	if _, err := readScriptFile(path, &script); err != nil {
+		return nil, err
+	}
+
+	if script.ID == "" {
+		base := filepath.Base(path)
+		script.ID = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	return &script, nil
+}
+
+// readScriptFile decodes a .json, .yaml or .yml file into v, refusing unknown
+// fields, and returns the file's content
+func readScriptFile(path string, v interface{}) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(v)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(v)
+	default:
+		return nil, fmt.Errorf("unsupported script extension: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse script %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// Migration validates the script and converts it into a Migration whose Apply and
+// Down functions interpret the script steps. Writes go through a Writer, so script
+// migrations can record operation logs. A script without down steps is rolled
+// back automatically by restoring the values its up steps replaced.
+func (s *ScriptMigration) Migration() (*Migration, error) {
+	if len(s.Up) == 0 {
+		return nil, fmt.Errorf("script migration '%s' has no up steps", s.ID)
+	}
+	for i, op := range s.Up {
+		if err := op.validate(); err != nil {
+			return nil, fmt.Errorf("script migration '%s' up step %d: %w", s.ID, i+1, err)
+		}
+	}
+	for i, op := range s.Down {
+		if err := op.validate(); err != nil {
+			return nil, fmt.Errorf("script migration '%s' down step %d: %w", s.ID, i+1, err)
+		}
+	}
+
+	id := s.ID
+	up := s.Up
+	down := s.Down
+	apply := func(w *Writer) error {
+		return runScriptOps(w, up)
+	}
+
+	m := &Migration{
+		ID:           id,
+		Description:  s.Description,
+		Owner:        s.Owner,
+		RunbookURL:   s.RunbookURL,
+		Dependencies: s.Dependencies,
+		Rerunnable:   s.Rerunnable,
+		BestEffort:   s.BestEffort,
+		Priority:     s.Priority,
+		Tags:         s.Tags,
+		Up:           upFromApply(id, apply),
+		Apply:        apply,
+	}
+	// Pin the steps in the checksum; the encoding does not depend on the file format
+	m.checksumSource, _ = json.Marshal(struct {
+		Up   []ScriptOp `json:"up"`
+		Down []ScriptOp `json:"down"`
+	}{up, down})
+	if len(down) > 0 {
+		m.Down = func(db *pebble.DB) error {
+			return runScriptOps(NewWriter(db, NewOpLog(id)), down)
+		}
+	}
+
+	return m, nil
+}
+
+// validate checks that an operation has the fields it needs
+func (op ScriptOp) validate() error {
+	switch op.Op {
+	case ScriptOpSet:
+		if len(op.Values) == 0 {
+			return fmt.Errorf("%s requires values", op.Op)
+		}
+		for key, value := range op.Values {
+			if key == "" {
+				return fmt.Errorf("%s has an empty key", op.Op)
+			}
+			if _, err := decodeScriptValue(value, op.Encoding); err != nil {
+				return fmt.Errorf("%s value for %q: %w", op.Op, key, err)
+			}
+		}
+	case ScriptOpDelete:
+		if len(op.Keys) == 0 {
+			return fmt.Errorf("%s requires keys", op.Op)
+		}
+	case ScriptOpCopyPrefix, ScriptOpRename:
+		if op.From == "" || op.To == "" {
+			return fmt.Errorf("%s requires from and to", op.Op)
+		}
+		if op.From == op.To {
+			return fmt.Errorf("%s from and to must differ", op.Op)
+		}
+	case ScriptOpDeletePrefix:
+		// An empty prefix would delete the whole database
+		if op.Prefix == "" {
+			return fmt.Errorf("%s requires a non-empty prefix", op.Op)
+		}
+	case ScriptOpReencode:
+		if op.Prefix == "" {
+			return fmt.Errorf("%s requires a non-empty prefix", op.Op)
+		}
+		if _, ok := lookupCodec(op.Codec); !ok {
+			return fmt.Errorf("%s uses unknown codec %q", op.Op, op.Codec)
+		}
+	case "":
+		return fmt.Errorf("op is required")
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	return nil
+}
+
+// decodeScriptValue decodes a value from a set operation
+func decodeScriptValue(value, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(value), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(value)
+	case "hex":
+		return hex.DecodeString(value)
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+// runScriptOps executes script operations in order
+func runScriptOps(w *Writer, ops []ScriptOp) error {
+	for i, op := range ops {
+		if err := runScriptOp(w, op); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, op.Op, err)
+		}
+	}
+	return nil
+}
+
+// runScriptOp executes a single script operation
+func runScriptOp(w *Writer, op ScriptOp) error {
+	switch op.Op {
+	case ScriptOpSet:
+		batch := w.NewBatch()
+		defer batch.Close()
+
+		keys := make([]string, 0, len(op.Values))
+		for key := range op.Values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, err := decodeScriptValue(op.Values[key], op.Encoding)
+			if err != nil {
+				return err
+			}
+			if err := batch.Set([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return batch.Commit()
+
+	case ScriptOpDelete:
+		batch := w.NewBatch()
+		defer batch.Close()
+
+		for _, key := range op.Keys {
+			if err := batch.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return batch.Commit()
+
+	case ScriptOpRename:
+		batch := w.NewBatch()
+		defer batch.Close()
+
+		value, err := batch.Get([]byte(op.From))
+		if err == pebble.ErrNotFound {
+			return fmt.Errorf("key %q does not exist", op.From)
+		}
+		if err != nil {
+			return err
+		}
+		if err := batch.Set([]byte(op.To), value); err != nil {
+			return err
+		}
+		if err := batch.Delete([]byte(op.From)); err != nil {
+			return err
+		}
+		return batch.Commit()
+
+	case ScriptOpCopyPrefix:
+		from, to := []byte(op.From), []byte(op.To)
+		return rewritePrefix(w, from, func(batch *WriterBatch, key, value []byte) error {
+			newKey := append(append([]byte(nil), to...), key[len(from):]...)
+			return batch.Set(newKey, value)
+		})
+
+	case ScriptOpDeletePrefix:
+		// Keys are deleted one by one rather than with a range delete so that
+		// every deletion is recorded
+		return rewritePrefix(w, []byte(op.Prefix), func(batch *WriterBatch, key, value []byte) error {
+			return batch.Delete(key)
+		})
+
+	case ScriptOpReencode:
+		codec, ok := lookupCodec(op.Codec)
+		if !ok {
+			return fmt.Errorf("unknown codec %q", op.Codec)
+		}
+		return rewritePrefix(w, []byte(op.Prefix), func(batch *WriterBatch, key, value []byte) error {
+			encoded, err := codec(key, value)
+			if err != nil {
+				return fmt.Errorf("codec %s failed for key %q: %w", op.Codec, key, err)
+			}
+			return batch.Set(key, encoded)
+		})
+
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// rewritePrefix calls fn for every key under prefix, committing the writes in batches
+func rewritePrefix(w *Writer, prefix []byte, fn func(batch *WriterBatch, key, value []byte) error) error {
+	iter, err := w.DB().NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixUpperBound(prefix),
+	})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	batch := w.NewBatch()
+	defer func() { batch.Close() }()
+
+	count := 0
+	for iter.First(); iter.Valid(); iter.Next() {
+		key := append([]byte(nil), iter.Key()...)
+		value := append([]byte(nil), iter.Value()...)
+		if err := fn(batch, key, value); err != nil {
+			return err
+		}
+
+		count++
+		if count%scriptBatchSize == 0 {
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+			batch.Close()
+			batch = w.NewBatch()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return batch.Commit()
+}
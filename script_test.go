@@ -0,0 +1,203 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestScriptMigrations(t *testing.T) {
+	writeScript := func(t *testing.T, dir, name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write script: %v", err)
+		}
+	}
+
+	getValue := func(t *testing.T, db *pebble.DB, key string) (string, bool) {
+		value, closer, err := db.Get([]byte(key))
+		if err == pebble.ErrNotFound {
+			return "", false
+		}
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", key, err)
+		}
+		defer closer.Close()
+		return string(value), true
+	}
+
+	t.Run("UpAndDown", func(t *testing.T) {
+		scriptsDir := t.TempDir()
+		writeScript(t, scriptsDir, "1754917200_move_users.yaml", `
+description: Move users to a new prefix
+up:
+  - op: copy_prefix
+    from: "user:"
+    to: "users/"
+  - op: delete_prefix
+    prefix: "user:"
+  - op: set
+    values:
+      "users/__format": "v2"
+down:
+  - op: copy_prefix
+    from: "users/"
+    to: "user:"
+  - op: delete_prefix
+    prefix: "users/"
+  - op: delete
+    keys: ["user:__format"]
+`)
+		writeScript(t, scriptsDir, "README.md", "not a script")
+
+		db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		db.Set([]byte("user:1"), []byte("alice"), pebble.Sync)
+		db.Set([]byte("user:2"), []byte("bob"), pebble.Sync)
+
+		registry := NewMigrationRegistry()
+		if err := NewDiscoveryService(scriptsDir, registry).LoadMigrations(); err != nil {
+			t.Fatalf("Failed to load scripts: %v", err)
+		}
+		if _, ok := registry.GetMigration("1754917200_move_users"); !ok {
+			t.Fatal("Expected script migration to be registered under its file name")
+		}
+
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, t.TempDir())
+		engine.SetBackupEnabled(false)
+		planner := NewMigrationPlanner(registry, schemaManager)
+
+		plan, err := planner.PlanUpgrade()
+		if err != nil {
+			t.Fatalf("Failed to plan upgrade: %v", err)
+		}
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Upgrade failed: %v", err)
+		}
+
+		if v, ok := getValue(t, db, "users/1"); !ok || v != "alice" {
+			t.Errorf("Expected users/1=alice, got %q (found: %v)", v, ok)
+		}
+		if _, ok := getValue(t, db, "user:1"); ok {
+			t.Error("Expected user:1 to be deleted")
+		}
+		if v, _ := getValue(t, db, "users/__format"); v != "v2" {
+			t.Errorf("Expected users/__format=v2, got %q", v)
+		}
+
+		plan, err = planner.PlanDowngrade(0)
+		if err != nil {
+			t.Fatalf("Failed to plan downgrade: %v", err)
+		}
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Downgrade failed: %v", err)
+		}
+
+		if v, ok := getValue(t, db, "user:2"); !ok || v != "bob" {
+			t.Errorf("Expected user:2=bob after rollback, got %q (found: %v)", v, ok)
+		}
+		if _, ok := getValue(t, db, "users/2"); ok {
+			t.Error("Expected users/2 to be deleted after rollback")
+		}
+		if _, ok := getValue(t, db, "user:__format"); ok {
+			t.Error("Expected user:__format to be deleted after rollback")
+		}
+	})
+
+	t.Run("ReencodeJSON", func(t *testing.T) {
+		scriptsDir := t.TempDir()
+		writeScript(t, scriptsDir, "fix.json", `{
+  "id": "1754917300_encode_blobs",
+  "up": [{"op": "reencode", "prefix": "blob:", "codec": "base64_encode"}],
+  "down": [{"op": "reencode", "prefix": "blob:", "codec": "base64_decode"}]
+}`)
+
+		db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		db.Set([]byte("blob:a"), []byte("hello"), pebble.Sync)
+
+		script, err := LoadScriptMigration(filepath.Join(scriptsDir, "fix.json"))
+		if err != nil {
+			t.Fatalf("Failed to load script: %v", err)
+		}
+		m, err := script.Migration()
+		if err != nil {
+			t.Fatalf("Failed to build migration: %v", err)
+		}
+
+		if err := m.Up(db); err != nil {
+			t.Fatalf("Up failed: %v", err)
+		}
+		if v, _ := getValue(t, db, "blob:a"); v != "aGVsbG8=" {
+			t.Errorf("Expected base64 value, got %q", v)
+		}
+		if err := m.Down(db); err != nil {
+			t.Fatalf("Down failed: %v", err)
+		}
+		if v, _ := getValue(t, db, "blob:a"); v != "hello" {
+			t.Errorf("Expected original value, got %q", v)
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		scriptsDir := t.TempDir()
+		writeScript(t, scriptsDir, "1754917350_rename.yaml", "up:\n  - op: rename\n    from: old\n    to: new\n")
+
+		db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		db.Set([]byte("old"), []byte("value"), pebble.Sync)
+
+		script, err := LoadScriptMigration(filepath.Join(scriptsDir, "1754917350_rename.yaml"))
+		if err != nil {
+			t.Fatalf("Failed to load script: %v", err)
+		}
+		m, err := script.Migration()
+		if err != nil {
+			t.Fatalf("Failed to build migration: %v", err)
+		}
+		if err := m.Up(db); err != nil {
+			t.Fatalf("Up failed: %v", err)
+		}
+		if _, ok := getValue(t, db, "old"); ok {
+			t.Errorf("Expected old to be renamed")
+		}
+		if v, _ := getValue(t, db, "new"); v != "value" {
+			t.Errorf("Expected new = value, got %q", v)
+		}
+		if err := m.Up(db); err == nil {
+			t.Errorf("Expected renaming a missing key to fail")
+		}
+	})
+
+	t.Run("InvalidScripts", func(t *testing.T) {
+		for name, content := range map[string]string{
+			"1754917400_empty_prefix.yaml":  "up:\n  - op: delete_prefix\n    prefix: \"\"\n",
+			"1754917400_unknown_op.yaml":    "up:\n  - op: truncate\n",
+			"1754917400_unknown_codec.yaml": "up:\n  - op: reencode\n    prefix: a\n    codec: nope\n",
+			"1754917400_unknown_field.yaml": "up:\n  - op: delete\n    keys: [a]\n    bogus: 1\n",
+			"1754917400_no_up.json":         `{"down": [{"op": "delete", "keys": ["a"]}]}`,
+		} {
+			dir := t.TempDir()
+			writeScript(t, dir, name, content)
+
+			err := NewDiscoveryService(dir, NewMigrationRegistry()).LoadMigrations()
+			if err == nil {
+				t.Errorf("%s: expected load to fail", name)
+			} else if !strings.Contains(err.Error(), "script") {
+				t.Errorf("%s: expected error to mention the script, got %v", name, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// snapshotsInfix follows the key prefix in the keys schema snapshots are stored under
+const snapshotsInfix = "snapshots/"
+
+// DefaultSnapshotLimit is the number of schema snapshots kept by default
+const DefaultSnapshotLimit = 10
+
+// SchemaSnapshot is a copy of the schema state, including the history, taken
+// before an operation that replaces or repairs it
+type SchemaSnapshot struct {
+	TakenAt time.Time      `json:"taken_at"`
+	Reason  string         `json:"reason"` // Operation the snapshot was taken before
+	State   *SchemaVersion `json:"state"`
+}
+
+// SetSnapshotLimit sets how many schema snapshots are kept; older ones are
+// removed when a snapshot is taken. 0 disables snapshots.
+func (s *SchemaManager) SetSnapshotLimit(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	s.snapshotLimit = limit
+}
+
+// snapshotKey returns the internal key a snapshot is stored under, keyed by the
+// time it was taken in Unix nanoseconds like history records
+func (s *SchemaManager) snapshotKey(ts int64) []byte {
+	return []byte(fmt.Sprintf("%s%s%020d", s.keyPrefix, snapshotsInfix, ts))
+}
+
+// snapshotsPrefix returns the prefix of all snapshot keys
+func (s *SchemaManager) snapshotsPrefix() []byte {
+	return []byte(s.keyPrefix + snapshotsInfix)
+}
+
+// snapshot stores a copy of the current schema state before an operation that
+// replaces or repairs it, and removes the snapshots beyond the limit. Nothing is
+// stored for an uninitialized database or a state that does not decode.
+func (s *SchemaManager) snapshot(reason string) error {
+	if s.snapshotLimit == 0 {
+		return nil
+	}
+	if _, closer, err := s.db.Get([]byte(s.schemaKey)); err == pebble.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to snapshot schema state: %w", err)
+	} else {
+		closer.Close()
+	}
+
+	state, err := s.GetSchemaVersion()
+	if errors.Is(err, ErrCorruptSchemaState) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to snapshot schema state: %w", err)
+	}
+
+	snapshot := SchemaSnapshot{TakenAt: time.Now(), Reason: reason, State: state}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema snapshot: %w", err)
+	}
+	if err := s.db.Set(s.snapshotKey(snapshot.TakenAt.UnixNano()), data, pebble.Sync); err != nil {
+		return fmt.Errorf("failed to snapshot schema state: %w", err)
+	}
+	return s.pruneSnapshots()
+}
+
+// pruneSnapshots removes the oldest snapshots beyond the limit
+func (s *SchemaManager) pruneSnapshots() error {
+	prefix := s.snapshotsPrefix()
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixUpperBound(prefix),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prune schema snapshots: %w", err)
+	}
+	var keys [][]byte
+	for iter.Last(); iter.Valid(); iter.Prev() {
+		keys = append(keys, append([]byte(nil), iter.Key()...))
+	}
+	if err := iter.Close(); err != nil {
+		return fmt.Errorf("failed to prune schema snapshots: %w", err)
+	}
+	if len(keys) <= s.snapshotLimit {
+		return nil
+	}
+
+	// keys is newest first; the oldest are removed as one range
+	oldest := keys[s.snapshotLimit]
+	if err := s.db.DeleteRange(prefix, append(oldest, 0), pebble.Sync); err != nil {
+		return fmt.Errorf("failed to prune schema snapshots: %w", err)
+	}
+	return nil
+}
+
+// SchemaSnapshots returns the stored schema snapshots, newest first
+func (s *SchemaManager) SchemaSnapshots() ([]SchemaSnapshot, error) {
+	prefix := s.snapshotsPrefix()
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: prefixUpperBound(prefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema snapshots: %w", err)
+	}
+	defer iter.Close()
+
+	var snapshots []SchemaSnapshot
+	for iter.Last(); iter.Valid(); iter.Prev() {
+		var snapshot SchemaSnapshot
+		if err := json.Unmarshal(iter.Value(), &snapshot); err != nil {
+			return nil, fmt.Errorf("%w: schema snapshot %s: %v", ErrCorruptSchemaState, iter.Key(), err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, iter.Error()
+}
+
+// RestoreSnapshot replaces the schema state with a snapshot returned by
+// SchemaSnapshots. The replaced state is snapshotted first, so the restore can be
+// undone in turn.
+func (s *SchemaManager) RestoreSnapshot(snapshot SchemaSnapshot) error {
+	if snapshot.State == nil {
+		return fmt.Errorf("%w: snapshot of %s has no state", ErrCorruptSchemaState, snapshot.TakenAt.Format(time.RFC3339))
+	}
+
+	current, err := s.getSchemaHead()
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	state := *snapshot.State
+	state.Revision = current.Revision
+	return s.setSchemaVersion(&state, "restore snapshot of "+snapshot.TakenAt.Format(time.RFC3339))
+}
@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestSchemaSnapshots(t *testing.T) {
+	db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	schemaManager := NewSchemaManager(db)
+
+	// The first state replaces nothing, so nothing is snapshotted
+	if err := schemaManager.SetSchemaVersion(&SchemaVersion{
+		CurrentVersion:    1754917200,
+		AppliedMigrations: map[string]bool{"1754917200_a": true},
+		MigrationHistory:  []MigrationRecord{{ID: "1754917200_a", Type: RecordApply, AppliedAt: time.Now(), Success: true}},
+		Status:            StatusDirty,
+	}); err != nil {
+		t.Fatalf("Failed to store schema: %v", err)
+	}
+	if snapshots, _ := schemaManager.SchemaSnapshots(); len(snapshots) != 0 {
+		t.Fatalf("Expected no snapshot of an uninitialized database, got %d", len(snapshots))
+	}
+
+	// An accidental reset
+	if err := schemaManager.ForceCleanState(); err != nil {
+		t.Fatalf("Failed to force clean: %v", err)
+	}
+	current, _ := schemaManager.GetSchemaVersion()
+	current.AppliedMigrations = map[string]bool{}
+	current.MigrationHistory = nil
+	current.CurrentVersion = 0
+	if err := schemaManager.SetSchemaVersion(current); err != nil {
+		t.Fatalf("Failed to reset schema: %v", err)
+	}
+
+	snapshots, err := schemaManager.SchemaSnapshots()
+	if err != nil {
+		t.Fatalf("Failed to read snapshots: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Reason != "replace state" || snapshots[1].Reason != "force clean" {
+		t.Fatalf("Expected the reset and force clean snapshots, newest first, got %+v", snapshots)
+	}
+	if snapshots[1].State.Status != StatusDirty || len(snapshots[0].State.MigrationHistory) != 1 {
+		t.Errorf("Expected the snapshots to hold the replaced states")
+	}
+
+	if err := schemaManager.RestoreSnapshot(snapshots[0]); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	restored, _ := schemaManager.GetSchemaVersion()
+	if restored.CurrentVersion != 1754917200 || !restored.AppliedMigrations["1754917200_a"] || len(restored.MigrationHistory) != 1 || restored.Status != StatusClean {
+		t.Errorf("Unexpected restored state: %+v", restored)
+	}
+	if snapshots, _ := schemaManager.SchemaSnapshots(); len(snapshots) != 3 || snapshots[0].State.CurrentVersion != 0 {
+		t.Errorf("Expected the restore to snapshot the reset state, got %+v", snapshots)
+	}
+
+	t.Run("PrunesBeyondLimit", func(t *testing.T) {
+		schemaManager.SetSnapshotLimit(2)
+		defer schemaManager.SetSnapshotLimit(DefaultSnapshotLimit)
+		if err := schemaManager.SetCurrentVersion(1754917200); err != nil {
+			t.Fatalf("Failed to set version: %v", err)
+		}
+		snapshots, _ := schemaManager.SchemaSnapshots()
+		if len(snapshots) != 2 || snapshots[0].Reason != "set current version" {
+			t.Errorf("Expected the 2 newest snapshots, got %+v", snapshots)
+		}
+	})
+
+	t.Run("DisabledWithZeroLimit", func(t *testing.T) {
+		schemaManager.SetSnapshotLimit(0)
+		defer schemaManager.SetSnapshotLimit(DefaultSnapshotLimit)
+		before, _ := schemaManager.SchemaSnapshots()
+		if err := schemaManager.ForceCleanState(); err != nil {
+			t.Fatalf("Failed to force clean: %v", err)
+		}
+		if after, _ := schemaManager.SchemaSnapshots(); len(after) != len(before) {
+			t.Errorf("Expected no snapshot with a zero limit")
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// SetStandby designates the database directory at path as a warm standby, e.g.
+// a restored backup or a checkpoint of the database (see CreateStandby). After
+// every plan it executes, the engine applies the same migrations to the standby,
+// so the standby can be promoted at failover without migrating. A standby that
+// cannot be brought in line is reported as a warning and does not fail the plan;
+// run SyncStandby to retry. An empty path disables the standby.
+func (e *MigrationEngine) SetStandby(path string) {
+	e.standbyPath = path
+}
+
+// CreateStandby creates a warm standby at path as a checkpoint of the engine's
+// database. path must not exist.
+func (e *MigrationEngine) CreateStandby(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("standby %s already exists", path)
+	}
+	if err := e.db.Checkpoint(path); err != nil {
+		return fmt.Errorf("failed to create standby: %w", err)
+	}
+	return nil
+}
+
+// SyncStandby brings the warm standby at path in line with the engine's database:
+// migrations only the standby has applied are rolled back, then the migrations it
+// lacks are applied in plan order. The standby must have clean schema state of
+// the same environment, and every migration to run must be registered. No backup
+// of the standby is taken.
+func (e *MigrationEngine) SyncStandby(path string, progress ProgressReporter) error {
+	if progress == nil {
+		progress = ProgressFunc(nil) // Discards events
+	}
+
+	head, err := e.schemaManager.getSchemaHead()
+	if err != nil {
+		return fmt.Errorf("failed to read schema state: %w", err)
+	}
+
+	engine, err := e.openStandby(path)
+	if err != nil {
+		return err
+	}
+	defer engine.db.Close()
+	standby := engine.schemaManager
+
+	if exists, err := standby.hasSchemaState(); err != nil || !exists {
+		if err == nil {
+			err = fmt.Errorf("no schema state, create it from a backup or checkpoint of the database")
+		}
+		return fmt.Errorf("standby %s: %w", path, err)
+	}
+	if err := standby.CheckEnvironment(head.Environment); err != nil {
+		return fmt.Errorf("standby %s: %w", path, err)
+	}
+	standbyHead, err := standby.getSchemaHead()
+	if err != nil {
+		return fmt.Errorf("failed to read standby schema state: %w", err)
+	}
+	if standbyHead.Status != StatusClean {
+		return fmt.Errorf("standby %s is in '%s' state", path, standbyHead.Status)
+	}
+
+	down, up, err := e.standbyPlans(head.AppliedMigrations, standbyHead)
+	if err != nil {
+		return fmt.Errorf("standby %s: %w", path, err)
+	}
+	if len(down.Migrations) == 0 && len(up.Migrations) == 0 {
+		reportf(progress, ProgressStandby, "Standby %s is in sync", path)
+		return nil
+	}
+
+	reporter := standbyReporter(path, progress)
+	for _, plan := range []*ExecutionPlan{down, up} {
+		if len(plan.Migrations) == 0 {
+			continue
+		}
+		if err := engine.ExecutePlanWithProgress(plan, reporter); err != nil {
+			return fmt.Errorf("failed to migrate standby %s: %w", path, err)
+		}
+	}
+	reportf(progress, ProgressStandby, "Standby %s is in sync: %d migrations applied, %d rolled back",
+		path, len(up.Migrations), len(down.Migrations))
+	return nil
+}
+
+// standbyPlans returns the plans that bring a standby with the given schema head
+// to the applied migrations of the primary: a downgrade of the migrations only
+// the standby applied, then an upgrade of the ones it lacks
+func (e *MigrationEngine) standbyPlans(primaryApplied map[string]bool, standbyHead *SchemaVersion) (*ExecutionPlan, *ExecutionPlan, error) {
+	primary := e.registry.resolveApplied(primaryApplied)
+	applied := make(map[string]bool)
+	for id, ok := range e.registry.resolveApplied(standbyHead.AppliedMigrations) {
+		if ok {
+			applied[id] = true
+		}
+	}
+
+	down := &ExecutionPlan{Type: ExecutionTypeDowngrade, CurrentVersion: standbyHead.CurrentVersion}
+	for id := range applied {
+		if _, registered := e.registry.GetMigration(id); !registered && !primary[id] {
+			return nil, nil, fmt.Errorf("migration '%s' is only applied to the standby and not registered", id)
+		}
+	}
+	ordered := e.registry.GetMigrations()
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if m := ordered[i]; applied[m.ID] && !primary[m.ID] {
+			down.Migrations = append(down.Migrations, m)
+			delete(applied, m.ID)
+		}
+	}
+	down.TargetVersion, _ = appliedVersion(applied)
+
+	up := &ExecutionPlan{Type: ExecutionTypeUpgrade, CurrentVersion: down.TargetVersion}
+	pending, err := e.registry.GetPendingMigrations(applied)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, m := range pending {
+		if primary[m.ID] {
+			up.Migrations = append(up.Migrations, m)
+			applied[m.ID] = true
+		}
+	}
+	for id := range primary {
+		if !applied[id] {
+			return nil, nil, fmt.Errorf("migration '%s' is applied to the database and not registered", id)
+		}
+	}
+	up.TargetVersion, _ = appliedVersion(applied)
+
+	down.EstimatedSteps = len(down.Migrations)
+	up.EstimatedSteps = len(up.Migrations)
+	return down, up, nil
+}
+
+// syncStandby applies an executed plan to the standby: a rerun is repeated on
+// it, and the applied migrations are brought in line. Failures are reported as
+// warnings.
+func (e *MigrationEngine) syncStandby(plan *ExecutionPlan, progress ProgressReporter) {
+	var err error
+	if plan.Type == ExecutionTypeRerun {
+		err = e.rerunOnStandby(plan, progress)
+	}
+	if err == nil {
+		err = e.SyncStandby(e.standbyPath, progress)
+	}
+	if err != nil {
+		e.warnf(progress, "standby", "standby is not in sync: %v", err)
+	}
+}
+
+// rerunOnStandby reruns the migration of a rerun plan on the standby if it is
+// applied there
+func (e *MigrationEngine) rerunOnStandby(plan *ExecutionPlan, progress ProgressReporter) error {
+	engine, err := e.openStandby(e.standbyPath)
+	if err != nil {
+		return err
+	}
+	defer engine.db.Close()
+
+	head, err := engine.schemaManager.getSchemaHead()
+	if err != nil {
+		return fmt.Errorf("failed to read standby schema state: %w", err)
+	}
+	if !e.registry.resolveApplied(head.AppliedMigrations)[plan.Migrations[0].ID] {
+		return nil
+	}
+
+	if err := engine.ExecutePlanWithProgress(plan, standbyReporter(e.standbyPath, progress)); err != nil {
+		return fmt.Errorf("failed to rerun on standby %s: %w", e.standbyPath, err)
+	}
+	return nil
+}
+
+// openStandby opens the standby at path and returns an engine migrating it like
+// e, without backups; the caller closes its database
+func (e *MigrationEngine) openStandby(path string) (*MigrationEngine, error) {
+	db, err := pebble.Open(path, &pebble.Options{ErrorIfNotExists: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open standby %s: %w", path, err)
+	}
+
+	standby := NewSchemaManager(db)
+	standby.SetSchemaKey(e.schemaManager.SchemaKey())
+	standby.SetKeyPrefix(e.schemaManager.KeyPrefix())
+	standby.SetEncoding(e.schemaManager.Encoding())
+	return &MigrationEngine{
+		db:            db,
+		schemaManager: standby,
+		registry:      e.registry,
+		dbPath:        path,
+		dryRunExecute: true,
+		verbose:       e.verbose,
+		forceUndo:     e.forceUndo,
+		logger:        e.logger,
+	}, nil
+}
+
+// standbyReporter reports the events of a standby's execution as ProgressStandby
+// events of the primary's plan
+func standbyReporter(path string, progress ProgressReporter) ProgressReporter {
+	return ProgressEventFunc(func(event ProgressEvent) {
+		if event.Message == "" {
+			return
+		}
+		progress.Report(ProgressEvent{
+			Phase:       ProgressStandby,
+			MigrationID: event.MigrationID,
+			Direction:   event.Direction,
+			Percent:     -1,
+			Message:     fmt.Sprintf("Standby %s: %s", path, event.Message),
+		})
+	})
+}
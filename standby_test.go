@@ -0,0 +1,143 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestWarmStandby(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	standbyPath := filepath.Join(dir, "standby.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	schemaManager := NewSchemaManager(db)
+	if err := schemaManager.InitializeFreshDatabase(NewMigrationRegistry()); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+
+	setKey := func(key string) MigrationFunc {
+		return func(db *pebble.DB) error { return db.Set([]byte(key), []byte("v"), pebble.Sync) }
+	}
+	deleteKey := func(key string) MigrationFunc {
+		return func(db *pebble.DB) error { return db.Delete([]byte(key), pebble.Sync) }
+	}
+	registry := NewMigrationRegistry()
+	for _, id := range []string{"1754917200_a", "1754917300_b", "1754917400_c"} {
+		if err := registry.Register(&Migration{ID: id, Up: setKey(id), Down: deleteKey(id)}); err != nil {
+			t.Fatalf("Failed to register: %v", err)
+		}
+	}
+	planner := NewMigrationPlanner(registry, schemaManager)
+	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+	engine.SetBackupEnabled(false)
+
+	if err := engine.CreateStandby(standbyPath); err != nil {
+		t.Fatalf("Failed to create standby: %v", err)
+	}
+	if err := engine.CreateStandby(standbyPath); err == nil {
+		t.Errorf("Expected creating an existing standby to fail")
+	}
+	engine.SetStandby(standbyPath)
+
+	// standbyState returns the applied migrations and keys of the standby
+	standbyState := func() (map[string]bool, []string) {
+		t.Helper()
+		standby, err := pebble.Open(standbyPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open standby: %v", err)
+		}
+		defer standby.Close()
+		schema, err := NewSchemaManager(standby).GetSchemaVersion()
+		if err != nil {
+			t.Fatalf("Failed to read standby schema: %v", err)
+		}
+		var keys []string
+		for _, id := range []string{"1754917200_a", "1754917300_b", "1754917400_c"} {
+			if _, closer, err := standby.Get([]byte(id)); err == nil {
+				closer.Close()
+				keys = append(keys, id)
+			}
+		}
+		return schema.AppliedMigrations, keys
+	}
+
+	var warnings []string
+	progress := ProgressEventFunc(func(event ProgressEvent) {
+		if event.Phase == ProgressWarning {
+			warnings = append(warnings, event.Message)
+		}
+	})
+	plan, err := planner.PlanUpgradeTo(1754917300)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlanWithProgress(plan, progress); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+	applied, keys := standbyState()
+	if len(applied) != 2 || strings.Join(keys, ",") != "1754917200_a,1754917300_b" {
+		t.Errorf("Expected the standby to be migrated in lockstep, got %v, %v", applied, keys)
+	}
+
+	plan, err = planner.PlanDowngrade(1754917200)
+	if err != nil {
+		t.Fatalf("Failed to plan downgrade: %v", err)
+	}
+	if err := engine.ExecutePlanWithProgress(plan, progress); err != nil {
+		t.Fatalf("Failed to downgrade: %v", err)
+	}
+	if applied, keys := standbyState(); len(applied) != 1 || strings.Join(keys, ",") != "1754917200_a" {
+		t.Errorf("Expected the standby to be rolled back in lockstep, got %v, %v", applied, keys)
+	}
+
+	// A standby that fell behind is caught up by SyncStandby
+	engine.SetStandby("")
+	plan, err = planner.PlanUpgrade()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if err := engine.ExecutePlan(plan, nil); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+	if applied, _ := standbyState(); len(applied) != 1 {
+		t.Fatalf("Expected the standby to be left alone, got %v", applied)
+	}
+	if err := engine.SyncStandby(standbyPath, nil); err != nil {
+		t.Fatalf("Failed to sync standby: %v", err)
+	}
+	if applied, keys := standbyState(); len(applied) != 3 || len(keys) != 3 {
+		t.Errorf("Expected the standby to catch up, got %v, %v", applied, keys)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+
+	// A standby of another environment is refused
+	if err := schemaManager.SetEnvironment("production"); err != nil {
+		t.Fatalf("Failed to stamp: %v", err)
+	}
+	standby, err := pebble.Open(standbyPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open standby: %v", err)
+	}
+	if err := NewSchemaManager(standby).SetEnvironment("staging"); err != nil {
+		t.Fatalf("Failed to stamp standby: %v", err)
+	}
+	standby.Close()
+	if err := engine.SyncStandby(standbyPath, nil); !errors.Is(err, ErrEnvironmentMismatch) {
+		t.Errorf("Expected ErrEnvironmentMismatch, got %v", err)
+	}
+
+	if err := engine.SyncStandby(filepath.Join(dir, "missing.db"), nil); err == nil {
+		t.Errorf("Expected syncing a missing standby to fail")
+	}
+}
@@ -1,10 +1,12 @@
 package migrate
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/cockroachdb/pebble"
 )
@@ -15,26 +17,176 @@ type StartupOptions struct {
 	// If false, will fail if migrations are needed
 	RunMigrations bool
 
+	// ReadOnly only verifies the database, for processes that must not write to
+	// it, e.g. read-only replicas or a database opened with pebble ReadOnly. An
+	// uninitialized database fails startup instead of being initialized, the
+	// environment is checked but not stamped, an interrupted migration fails
+	// startup instead of being reset for a retry, and pending migrations are
+	// logged and left to a writable process, like on a node outside the rollout.
+	// The version must still be within MinSchemaVersion and MaxSchemaVersion.
+	// RunMigrations is ignored.
+	// Default: false
+	ReadOnly bool
+
 	// Logger is an optional logger for migration progress
 	// If nil, uses fmt.Printf for logging
 	Logger Logger
 
+	// FreshDatabasePolicy is how a fresh database, one without application data, is
+	// initialized: at the latest version with every migration marked applied,
+	// at version 0 so that every migration runs, or not at all, failing startup
+	// with ErrFreshDatabase. A database with data but no schema state always
+	// starts at version 0.
+	// Default: "" (FreshDatabaseMarkAllApplied)
+	FreshDatabasePolicy FreshDatabasePolicy
+
+	// DataProbe tells application data from other keys, e.g. metadata the
+	// application writes before startup, when classifying a database without
+	// schema state as fresh or pre-migration (see DataPrefixesProbe)
+	// Default: nil (any key is application data)
+	DataProbe DataProbe
+
 	// BackupEnabled controls whether backups are created during migration
 	// Default: false (creating checkpoints and zipping is CPU intensive)
 	BackupEnabled bool
 
+	// AsyncBackup compresses the backup in the background, so migrations start
+	// once its checkpoint exists. Startup returns before the backup is complete;
+	// the result is logged when it is.
+	// Default: false
+	AsyncBackup bool
+
+	// EventLogPath is a file the progress events of the startup migrations are
+	// appended to as JSON lines, independent of the Logger
+	// Default: "" (no event log)
+	EventLogPath string
+
 	// CheckDiskSpace enables disk space validation before migrations
 	// Default: true
 	CheckDiskSpace bool
 
 	// DatabaseSizeMultiplier is the space multiplier for migration space calculation
-	// Required free space = database size * multiplier
-	// Default: 2.0 (2x database size for backup + temporary doubling)
+	// Required free space = database size * multiplier, plus the
+	// EstimateBackupSize estimate when BackupEnabled is set
+	// Default: 2.0 (2x database size for temporary doubling)
 	DatabaseSizeMultiplier float64
 
 	// CLIName is the name of the CLI tool shown in error messages
 	// Default: "pebble-migrate"
 	CLIName string
+
+	// SchemaKey is the key the schema state is stored under
+	// Default: SchemaVersionKey
+	SchemaKey string
+
+	// KeyPrefix is the prefix reserved for internal migration metadata
+	// Default: MigrationPrefix
+	KeyPrefix string
+
+	// SchemaEncoding is the encoding the schema state is written in
+	// Default: SchemaEncodingJSON
+	SchemaEncoding SchemaEncoding
+
+	// MinSchemaVersion and MaxSchemaVersion are the schema versions the application
+	// supports. Startup fails with a *SchemaVersionError if the database is newer
+	// than MaxSchemaVersion, e.g. migrated by a newer build of the application, or
+	// is still older than MinSchemaVersion after the startup migrations.
+	// Default: 0 (no bound)
+	MinSchemaVersion int64
+	MaxSchemaVersion int64
+
+	// RolloutGate decides whether this node runs the pending migrations, see
+	// HostnamePercentGate and EnvCohortGate. A node that is gated out starts
+	// without migrating, as long as its version is at least MinSchemaVersion.
+	// Default: nil (every node migrates)
+	RolloutGate RolloutGate
+
+	// Coordinator is consulted before and after the pending migrations run, to
+	// coordinate nodes that each own a replica of the database
+	// Default: NopCoordinator
+	Coordinator Coordinator
+
+	// Environment labels the environment the application runs in, e.g.
+	// "production". The schema state is stamped with it on first startup, and
+	// startup fails with ErrEnvironmentMismatch on a database stamped with
+	// another environment, e.g. a production directory mounted into staging.
+	// Default: "" (not checked)
+	Environment string
+
+	// Policies approve the startup plan before it runs (see MigrationEngine.AddPolicy).
+	// Startup fails with a *PolicyError if one refuses it.
+	// Default: nil (no policies)
+	Policies []PolicyFunc
+
+	// PlanValidationAction is what startup does when the plan validators
+	// registered with the registry fail after the startup plan (see
+	// MigrationRegistry.RegisterPlanValidator): fail startup, roll the plan back
+	// and fail, or only log the failures.
+	// Default: "" (PlanValidationFail)
+	PlanValidationAction PlanValidationAction
+
+	// FailurePolicy is what a failed migration does to the startup plan (see
+	// MigrationEngine.SetFailurePolicy): fail startup at once, continue with the
+	// migrations not depending on it before failing, or roll the plan back and fail.
+	// Default: "" (FailureStop)
+	FailurePolicy FailurePolicy
+
+	// Context cancels the startup migrations, e.g. when the process is asked to
+	// stop (see MigrationEngine.ExecutePlanContext): no further migration is
+	// started, and a running migration using its MigrationContext is left
+	// interrupted for the next startup to recover.
+	// Default: nil (context.Background())
+	Context context.Context
+
+	// MaxMigrationsPerStartup and MaxStartupMigrationTime bound the time a startup
+	// spends migrating: once either is reached, no further migration is started
+	// and the rest is deferred to the next startup (see
+	// MigrationEngine.SetBatchLimits). At least one migration runs per startup.
+	// The application starts on the version reached, which must be at least
+	// MinSchemaVersion.
+	// Default: 0 (no limit)
+	MaxMigrationsPerStartup int
+	MaxStartupMigrationTime time.Duration
+
+	// StandbyPath is the directory of a warm standby copy of the database, e.g. a
+	// restored backup. The startup migrations are applied to it too, so it can be
+	// promoted without migrating (see MigrationEngine.SetStandby). A standby that
+	// cannot be migrated is logged and does not fail startup.
+	// Default: "" (no standby)
+	StandbyPath string
+}
+
+// SchemaVersionError is returned at startup when the schema version is outside
+// the window set by StartupOptions.MinSchemaVersion and MaxSchemaVersion. It
+// matches ErrUnsupportedSchemaVersion with errors.Is.
+type SchemaVersionError struct {
+	Version int64 // Schema version of the database
+	Min     int64 // Lowest supported version, 0 if unbounded
+	Max     int64 // Highest supported version, 0 if unbounded
+}
+
+func (e *SchemaVersionError) Error() string {
+	if e.Max > 0 && e.Version > e.Max {
+		return fmt.Sprintf("%v: database is at version %d, newer than the highest supported version %d",
+			ErrUnsupportedSchemaVersion, e.Version, e.Max)
+	}
+	return fmt.Sprintf("%v: database is at version %d, older than the lowest supported version %d",
+		ErrUnsupportedSchemaVersion, e.Version, e.Min)
+}
+
+func (e *SchemaVersionError) Unwrap() error {
+	return ErrUnsupportedSchemaVersion
+}
+
+// checkSupportedVersion returns a *SchemaVersionError if version is newer than
+// opts.MaxSchemaVersion, or, if checkMin is set, older than opts.MinSchemaVersion
+func checkSupportedVersion(version int64, opts StartupOptions, checkMin bool) error {
+	tooNew := opts.MaxSchemaVersion > 0 && version > opts.MaxSchemaVersion
+	tooOld := checkMin && opts.MinSchemaVersion > 0 && version < opts.MinSchemaVersion
+	if tooNew || tooOld {
+		return &SchemaVersionError{Version: version, Min: opts.MinSchemaVersion, Max: opts.MaxSchemaVersion}
+	}
+	return nil
 }
 
 // DefaultStartupOptions returns default startup options
@@ -51,14 +203,53 @@ func DefaultStartupOptions() StartupOptions {
 
 // CheckAndRunStartupMigrations checks migration status and optionally runs migrations
 // This is a utility function for application startup integration
+// Calls for the same database do not overlap: while one runs, or a plan is
+// executing on the database, others fail with ErrConcurrentExecution.
 func CheckAndRunStartupMigrations(db *pebble.DB, dbPath string, opts StartupOptions) error {
 	// Create migration services
 	schemaManager := NewSchemaManager(db)
+	schemaManager.SetSchemaKey(opts.SchemaKey)
+	schemaManager.SetKeyPrefix(opts.KeyPrefix)
+	schemaManager.SetEncoding(opts.SchemaEncoding)
+	schemaManager.SetDataProbe(opts.DataProbe)
 	registry := GlobalRegistry
 
-	// Initialize schema for fresh/pre-migration databases
-	if err := schemaManager.InitializeFreshDatabase(registry); err != nil {
-		return fmt.Errorf("failed to initialize database schema: %w", err)
+	cliName := opts.CLIName
+	if cliName == "" {
+		cliName = "pebble-migrate"
+	}
+
+	// Recovery and initialization must not run beside another startup or plan
+	if !opts.ReadOnly {
+		end, err := beginExecution(db, "startup migration check")
+		if err != nil {
+			return err
+		}
+		defer end()
+	}
+
+	if opts.ReadOnly {
+		// Read-only processes verify the state a writable process initialized
+		exists, err := schemaManager.hasSchemaState()
+		if err != nil {
+			return fmt.Errorf("failed to check schema version: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("database has no schema state - start a writable process or run '%s up' to initialize it", cliName)
+		}
+		if err := schemaManager.CheckEnvironment(opts.Environment); err != nil {
+			return err
+		}
+	} else {
+		// Initialize schema for fresh/pre-migration databases
+		if err := schemaManager.InitializeDatabase(registry, opts.FreshDatabasePolicy); err != nil {
+			return fmt.Errorf("failed to initialize database schema: %w", err)
+		}
+
+		// A database of another environment is left alone
+		if err := schemaManager.StampEnvironment(opts.Environment); err != nil {
+			return err
+		}
 	}
 
 	planner := NewMigrationPlanner(registry, schemaManager)
@@ -69,13 +260,8 @@ func CheckAndRunStartupMigrations(db *pebble.DB, dbPath string, opts StartupOpti
 		return fmt.Errorf("failed to get schema version: %w", err)
 	}
 
-	cliName := opts.CLIName
-	if cliName == "" {
-		cliName = "pebble-migrate"
-	}
-
 	// Check database state and attempt recovery if possible
-	if currentSchema.Status == StatusMigrating {
+	if currentSchema.Status == StatusMigrating && !opts.ReadOnly {
 		// Attempt to recover from interrupted migration
 		if err := attemptMigrationRecovery(db, schemaManager, planner, opts); err != nil {
 			return err
@@ -90,10 +276,19 @@ func CheckAndRunStartupMigrations(db *pebble.DB, dbPath string, opts StartupOpti
 
 	// If still not clean after recovery attempt, fail
 	if currentSchema.Status != StatusClean {
+		if failure := currentSchema.LastFailure; failure != nil {
+			return fmt.Errorf("database is in '%s' state - %s. "+
+				"Run '%s status' for details", currentSchema.Status, failure, cliName)
+		}
 		return fmt.Errorf("database is in '%s' state - manual intervention required. "+
 			"Run '%s status' to check and resolve issues", currentSchema.Status, cliName)
 	}
 
+	// A database migrated past the supported versions cannot be migrated back here
+	if err := checkSupportedVersion(currentSchema.CurrentVersion, opts, false); err != nil {
+		return err
+	}
+
 	// Check for pending migrations
 	plan, err := planner.PlanUpgrade()
 	if err != nil {
@@ -104,7 +299,25 @@ func CheckAndRunStartupMigrations(db *pebble.DB, dbPath string, opts StartupOpti
 		if opts.Logger != nil {
 			opts.Logger.Debugf("Database is up to date (version %d)", currentSchema.CurrentVersion)
 		}
-		return nil
+		return checkSupportedVersion(currentSchema.CurrentVersion, opts, true)
+	}
+
+	// Read-only processes leave pending migrations to a writable one
+	if opts.ReadOnly {
+		if opts.Logger != nil {
+			opts.Logger.Printf("Skipping %d pending migrations: read-only startup (version %d)",
+				len(plan.Migrations), currentSchema.CurrentVersion)
+		}
+		return checkSupportedVersion(currentSchema.CurrentVersion, opts, true)
+	}
+
+	// Nodes outside the rollout start on the current schema
+	if opts.RolloutGate != nil && !opts.RolloutGate(plan) {
+		if opts.Logger != nil {
+			opts.Logger.Printf("Skipping %d pending migrations: node is not part of the rollout (version %d)",
+				len(plan.Migrations), currentSchema.CurrentVersion)
+		}
+		return checkSupportedVersion(currentSchema.CurrentVersion, opts, true)
 	}
 
 	// Handle pending migrations
@@ -115,11 +328,20 @@ func CheckAndRunStartupMigrations(db *pebble.DB, dbPath string, opts StartupOpti
 			len(plan.Migrations), cliName)
 	}
 
-	// Check disk space before proceeding with migrations
-	if opts.CheckDiskSpace {
-		if err := checkMigrationDiskSpace(dbPath, opts.DatabaseSizeMultiplier, opts.Logger); err != nil {
-			return fmt.Errorf("disk space check failed: %w", err)
+	coordinator := opts.Coordinator
+	if coordinator == nil {
+		coordinator = NopCoordinator{}
+	}
+	run, err := coordinator.BeforeMigrate(plan)
+	if err != nil {
+		return fmt.Errorf("migration coordinator: %w", err)
+	}
+	if !run {
+		if opts.Logger != nil {
+			opts.Logger.Printf("Skipping %d pending migrations: the coordinator did not select this node (version %d)",
+				len(plan.Migrations), currentSchema.CurrentVersion)
 		}
+		return checkSupportedVersion(currentSchema.CurrentVersion, opts, true)
 	}
 
 	// Log migration start
@@ -131,7 +353,29 @@ func CheckAndRunStartupMigrations(db *pebble.DB, dbPath string, opts StartupOpti
 	// Create migration engine with backup enabled
 	engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
 	engine.SetVerbose(false) // Let logger handle verbosity through log levels
+	engine.claimed = true    // The startup check claimed the database above
 	engine.SetBackupEnabled(opts.BackupEnabled)
+	engine.SetAsyncBackup(opts.AsyncBackup)
+	engine.SetLogger(opts.Logger)
+	engine.SetEventLog(opts.EventLogPath)
+	for _, policy := range opts.Policies {
+		engine.AddPolicy(policy)
+	}
+	engine.SetPlanValidationAction(opts.PlanValidationAction)
+	engine.SetFailurePolicy(opts.FailurePolicy)
+	engine.SetBatchLimits(opts.MaxMigrationsPerStartup, opts.MaxStartupMigrationTime)
+	engine.SetStandby(opts.StandbyPath)
+
+	// Check disk space before proceeding with migrations
+	if opts.CheckDiskSpace {
+		var backupSize uint64
+		if opts.BackupEnabled {
+			backupSize = uint64(engine.backupManager.EstimateBackupSize(db).Size)
+		}
+		if err := checkMigrationDiskSpace(dbPath, opts.DatabaseSizeMultiplier, backupSize, opts.Logger); err != nil {
+			return fmt.Errorf("disk space check failed: %w", err)
+		}
+	}
 
 	// Create progress callback that uses the logger
 	progressCallback := func(msg string) {
@@ -143,16 +387,47 @@ func CheckAndRunStartupMigrations(db *pebble.DB, dbPath string, opts StartupOpti
 	}
 
 	// Execute migrations with progress logging
-	err = engine.ExecutePlan(plan, progressCallback)
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	err = engine.ExecutePlanContext(ctx, plan, ProgressFunc(progressCallback))
+	if coordErr := coordinator.AfterMigrate(plan, err); coordErr != nil {
+		if err != nil {
+			return fmt.Errorf("startup migration failed: %w (coordinator: %v)", err, coordErr)
+		}
+		return fmt.Errorf("migration coordinator: %w", coordErr)
+	}
 	if err != nil {
 		return fmt.Errorf("startup migration failed: %w", err)
 	}
 
 	// Log completion
-	if opts.Logger != nil {
+	version := plan.TargetVersion
+	if deferred := engine.DeferredMigrations(); len(deferred) > 0 {
+		schema, err := schemaManager.GetSchemaVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get schema version: %w", err)
+		}
+		version = schema.CurrentVersion
+		if opts.Logger != nil {
+			opts.Logger.Printf("Startup migrations stopped at the startup limits (version %d), %d migrations deferred to the next startup, starting with %s",
+				version, len(deferred), deferred[0].ID)
+		}
+	} else if opts.Logger != nil {
 		opts.Logger.Printf("Startup migrations completed successfully (version %d)", plan.TargetVersion)
 	}
-	return nil
+
+	if pending := engine.PendingBackup(); pending != nil && opts.Logger != nil {
+		go func() {
+			if info, err := pending.Wait(); err != nil {
+				opts.Logger.Printf("Background backup failed: %v", err)
+			} else {
+				opts.Logger.Printf("Background backup completed: %s", info.Path)
+			}
+		}()
+	}
+	return checkSupportedVersion(version, opts, true)
 }
 
 
@@ -169,39 +444,65 @@ func attemptMigrationRecovery(db *pebble.DB, schemaManager *SchemaManager, plann
 		cliName = "pebble-migrate"
 	}
 
-	// Get pending migrations to identify what was likely being executed
-	plan, err := planner.PlanUpgrade()
-	if err != nil {
-		return fmt.Errorf("failed to create migration plan for recovery: %w", err)
+	// The state names the migrations that were being executed. State written by
+	// earlier releases does not, so the first pending migration is assumed.
+	var stuckMigrations []*Migration
+	for _, id := range currentSchema.RunningMigrations {
+		stuckMigration, ok := planner.registry.GetMigration(planner.registry.ResolveID(id))
+		if !ok {
+			return fmt.Errorf("database is in 'migrating' state - migration '%s' was interrupted but is not registered. "+
+				"Run '%s force-clean' to manually reset state", id, cliName)
+		}
+		if currentSchema.AppliedMigrations[stuckMigration.ID] || currentSchema.AppliedMigrations[id] {
+			return fmt.Errorf("database is in 'migrating' state - migration '%s' (%s) was interrupted while rolling back. "+
+				"This requires manual intervention. "+
+				"Options:\n"+
+				"  1. Run '%s force-clean' to force reset, then roll it back again (use with caution)\n"+
+				"  2. Restore from backup if available",
+				stuckMigration.ID, stuckMigration.Description, cliName)
+		}
+		stuckMigrations = append(stuckMigrations, stuckMigration)
 	}
 
-	if len(plan.Migrations) == 0 {
-		// No pending migrations but status is migrating - inconsistent state
-		return fmt.Errorf("database is in 'migrating' state but no pending migrations found. "+
-			"Run '%s force-clean' to manually reset state", cliName)
-	}
+	if len(stuckMigrations) == 0 {
+		// Get pending migrations to identify what was likely being executed
+		plan, err := planner.PlanUpgrade()
+		if err != nil {
+			return fmt.Errorf("failed to create migration plan for recovery: %w", err)
+		}
 
-	// The first pending migration is likely the one that was interrupted
-	stuckMigration := plan.Migrations[0]
+		if len(plan.Migrations) == 0 {
+			// No pending migrations but status is migrating - inconsistent state
+			return fmt.Errorf("database is in 'migrating' state but no pending migrations found. "+
+				"Run '%s force-clean' to manually reset state", cliName)
+		}
 
-	// Check if the migration is safe to rerun
-	if !stuckMigration.Rerunnable {
-		return fmt.Errorf("database is in 'migrating' state - migration '%s' (%s) was interrupted. "+
-			"This migration is not marked as rerunnable and requires manual intervention. "+
-			"Options:\n"+
-			"  1. Run '%s validate' to check if migration completed successfully\n"+
-			"  2. Run '%s force-clean' to force reset (use with caution)\n"+
-			"  3. Restore from backup if available",
-			stuckMigration.ID, stuckMigration.Description, cliName, cliName)
+		// The first pending migration is likely the one that was interrupted
+		stuckMigrations = plan.Migrations[:1]
 	}
 
-	// Migration is rerunnable - attempt recovery
-	if opts.Logger != nil {
-		opts.Logger.Printf("Recovering from interrupted migration: %s (%s)",
-			stuckMigration.ID, stuckMigration.Description)
-	} else {
-		fmt.Printf("Recovering from interrupted migration: %s (%s)\n",
-			stuckMigration.ID, stuckMigration.Description)
+	// Check if the migrations are safe to rerun
+	for _, stuckMigration := range stuckMigrations {
+		if !stuckMigration.Rerunnable {
+			return fmt.Errorf("database is in 'migrating' state - migration '%s' (%s) was interrupted. "+
+				"This migration is not marked as rerunnable and requires manual intervention. "+
+				"Options:\n"+
+				"  1. Run '%s validate' to check if migration completed successfully\n"+
+				"  2. Run '%s force-clean' to force reset (use with caution)\n"+
+				"  3. Restore from backup if available",
+				stuckMigration.ID, stuckMigration.Description, cliName, cliName)
+		}
+	}
+
+	// Migrations are rerunnable - attempt recovery
+	for _, stuckMigration := range stuckMigrations {
+		if opts.Logger != nil {
+			opts.Logger.Printf("Recovering from interrupted migration: %s (%s)",
+				stuckMigration.ID, stuckMigration.Description)
+		} else {
+			fmt.Printf("Recovering from interrupted migration: %s (%s)\n",
+				stuckMigration.ID, stuckMigration.Description)
+		}
 	}
 
 	// Reset status to clean to allow retry
@@ -219,8 +520,9 @@ func attemptMigrationRecovery(db *pebble.DB, schemaManager *SchemaManager, plann
 	return nil
 }
 
-// checkMigrationDiskSpace validates available disk space using smart calculation
-func checkMigrationDiskSpace(dbPath string, sizeMultiplier float64, logger Logger) error {
+// checkMigrationDiskSpace validates available disk space using smart calculation.
+// backupSize is the estimated size of the backup taken before migrating, if any.
+func checkMigrationDiskSpace(dbPath string, sizeMultiplier float64, backupSize uint64, logger Logger) error {
 	// Calculate database size
 	dbSize, err := calculateDatabaseSize(dbPath)
 	if err != nil {
@@ -231,7 +533,7 @@ func checkMigrationDiskSpace(dbPath string, sizeMultiplier float64, logger Logge
 	}
 
 	// Calculate required space
-	requiredSpace := uint64(float64(dbSize) * sizeMultiplier)
+	requiredSpace := uint64(float64(dbSize)*sizeMultiplier) + backupSize
 
 	// Get filesystem statistics
 	var stat syscall.Statfs_t
@@ -246,8 +548,9 @@ func checkMigrationDiskSpace(dbPath string, sizeMultiplier float64, logger Logge
 	freeSpace := stat.Bavail * uint64(stat.Bsize)
 
 	if logger != nil {
-		logger.Debugf("Migration disk space check: db=%.2fGB, required=%.2fGB, free=%.2fGB, multiplier=%.1f",
+		logger.Debugf("Migration disk space check: db=%.2fGB, backup=%.2fGB, required=%.2fGB, free=%.2fGB, multiplier=%.1f",
 			float64(dbSize)/(1024*1024*1024),
+			float64(backupSize)/(1024*1024*1024),
 			float64(requiredSpace)/(1024*1024*1024),
 			float64(freeSpace)/(1024*1024*1024),
 			sizeMultiplier)
@@ -255,10 +558,11 @@ func checkMigrationDiskSpace(dbPath string, sizeMultiplier float64, logger Logge
 
 	// Check if we have enough free space
 	if freeSpace < requiredSpace {
-		return fmt.Errorf("insufficient disk space for migration: %.2f GB required (%.2f GB database x %.1fx), only %.2f GB available",
+		return fmt.Errorf("insufficient disk space for migration: %.2f GB required (%.2f GB database x %.1fx + %.2f GB backup), only %.2f GB available",
 			float64(requiredSpace)/(1024*1024*1024),
 			float64(dbSize)/(1024*1024*1024),
 			sizeMultiplier,
+			float64(backupSize)/(1024*1024*1024),
 			float64(freeSpace)/(1024*1024*1024))
 	}
 
@@ -0,0 +1,186 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestStartupVersionWindow(t *testing.T) {
+	originalRegistry := GlobalRegistry
+	defer func() { GlobalRegistry = originalRegistry }()
+
+	GlobalRegistry = NewMigrationRegistry()
+	for _, id := range []string{"1754917200_first", "1754917300_second"} {
+		GlobalRegistry.Register(&Migration{
+			ID:   id,
+			Up:   func(db *pebble.DB) error { return nil },
+			Down: func(db *pebble.DB) error { return nil },
+		})
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// A fresh database starts at the latest version, 1754917300
+	tests := []struct {
+		name     string
+		min, max int64
+		wantErr  bool
+	}{
+		{"Unbounded", 0, 0, false},
+		{"Inside", 1754917200, 1754917300, false},
+		{"NewerThanMax", 0, 1754917200, true},
+		{"OlderThanMin", 1754917400, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultStartupOptions()
+			opts.CheckDiskSpace = false
+			opts.Logger = &NopLogger{}
+			opts.MinSchemaVersion = tt.min
+			opts.MaxSchemaVersion = tt.max
+
+			err := CheckAndRunStartupMigrations(db, dbPath, opts)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Expected startup to succeed: %v", err)
+				}
+				return
+			}
+
+			var versionErr *SchemaVersionError
+			if !errors.As(err, &versionErr) || !errors.Is(err, ErrUnsupportedSchemaVersion) {
+				t.Fatalf("Expected a *SchemaVersionError, got %v", err)
+			}
+			if versionErr.Version != 1754917300 || versionErr.Min != tt.min || versionErr.Max != tt.max {
+				t.Errorf("Unexpected error fields: %+v", versionErr)
+			}
+		})
+	}
+}
+
+func TestStartupReadOnly(t *testing.T) {
+	originalRegistry := GlobalRegistry
+	defer func() { GlobalRegistry = originalRegistry }()
+
+	noop := func(db *pebble.DB) error { return nil }
+	GlobalRegistry = NewMigrationRegistry()
+	GlobalRegistry.Register(&Migration{ID: "1754917200_first", Up: noop, Down: noop})
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	opts := DefaultStartupOptions()
+	opts.CheckDiskSpace = false
+	opts.Logger = &NopLogger{}
+	opts.ReadOnly = true
+	opts.RunMigrations = true
+
+	// An uninitialized database is not initialized
+	if err := CheckAndRunStartupMigrations(db, dbPath, opts); err == nil {
+		t.Fatalf("Expected an uninitialized database to fail read-only startup")
+	}
+	if exists, err := NewSchemaManager(db).hasSchemaState(); err != nil || exists {
+		t.Fatalf("Expected no schema state to be written, got %v, %v", exists, err)
+	}
+
+	// A writable process initializes it, then a newer build adds a migration
+	writable := opts
+	writable.ReadOnly = false
+	if err := CheckAndRunStartupMigrations(db, dbPath, writable); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	db.Close()
+	GlobalRegistry.Register(&Migration{ID: "1754917300_second", Up: noop, Down: noop})
+
+	db, err = pebble.Open(dbPath, &pebble.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to open database read-only: %v", err)
+	}
+	defer db.Close()
+
+	// Pending migrations are left to the writable process
+	opts.Environment = "production"
+	if err := CheckAndRunStartupMigrations(db, dbPath, opts); err != nil {
+		t.Fatalf("Expected read-only startup to succeed, got %v", err)
+	}
+	applied, err := NewSchemaManager(db).IsMigrationApplied("1754917300_second")
+	if err != nil || applied {
+		t.Errorf("Expected the pending migration not to run, got %v, %v", applied, err)
+	}
+
+	// The version must still be supported
+	opts.MinSchemaVersion = 1754917300
+	var versionErr *SchemaVersionError
+	if err := CheckAndRunStartupMigrations(db, dbPath, opts); !errors.As(err, &versionErr) {
+		t.Errorf("Expected a *SchemaVersionError, got %v", err)
+	}
+}
+
+func TestStartupFreshDatabasePolicy(t *testing.T) {
+	originalRegistry := GlobalRegistry
+	defer func() { GlobalRegistry = originalRegistry }()
+
+	var ran int
+	GlobalRegistry = NewMigrationRegistry()
+	GlobalRegistry.Register(&Migration{
+		ID:   "1754917200_seed",
+		Up:   func(db *pebble.DB) error { ran++; return db.Set([]byte("config"), []byte("v1"), pebble.Sync) },
+		Down: func(db *pebble.DB) error { return db.Delete([]byte("config"), pebble.Sync) },
+	})
+
+	tests := []struct {
+		policy  FreshDatabasePolicy
+		wantRun int
+		wantErr error
+	}{
+		{"", 0, nil},
+		{FreshDatabaseMarkAllApplied, 0, nil},
+		{FreshDatabaseRunAllMigrations, 1, nil},
+		{FreshDatabaseFail, 0, ErrFreshDatabase},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "test.db")
+			db, err := pebble.Open(dbPath, &pebble.Options{})
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+
+			opts := DefaultStartupOptions()
+			opts.CheckDiskSpace = false
+			opts.Logger = &NopLogger{}
+			opts.RunMigrations = true
+			opts.FreshDatabasePolicy = tt.policy
+
+			ran = 0
+			err = CheckAndRunStartupMigrations(db, dbPath, opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if ran != tt.wantRun {
+				t.Errorf("Expected the migration to run %d times, ran %d", tt.wantRun, ran)
+			}
+			if tt.wantErr != nil {
+				if exists, _ := NewSchemaManager(db).hasSchemaState(); exists {
+					t.Errorf("Expected no schema state to be written")
+				}
+				return
+			}
+			if applied, err := NewSchemaManager(db).IsMigrationApplied("1754917200_seed"); err != nil || !applied {
+				t.Errorf("Expected the migration to be applied, got %v, %v", applied, err)
+			}
+		})
+	}
+}
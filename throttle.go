@@ -0,0 +1,180 @@
+package migrate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+	"time"
+)
+
+// gzipBlockSize is the amount of input compressed into each gzip member when
+// compressing with several workers
+const gzipBlockSize = 1 << 20
+
+// rateLimiter limits the read rate of backup and restore operations. It is
+// shared by all operations of a backup manager.
+type rateLimiter struct {
+	mu          sync.Mutex
+	bytesPerSec float64
+	start       time.Time
+	last        time.Time
+	bytes       int64
+}
+
+// newRateLimiter returns a limiter for mbps megabytes per second, or nil for no limit
+func newRateLimiter(mbps float64) *rateLimiter {
+	if mbps <= 0 {
+		return nil
+	}
+	return &rateLimiter{bytesPerSec: mbps * 1024 * 1024}
+}
+
+// wait accounts for n bytes read and sleeps until the rate is within the limit
+func (l *rateLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Idle time does not build up credit for bursts
+	now := time.Now()
+	if now.Sub(l.last) > time.Second {
+		l.start = now
+		l.bytes = 0
+	}
+	l.bytes += int64(n)
+	expected := time.Duration(float64(l.bytes) / l.bytesPerSec * float64(time.Second))
+	if elapsed := now.Sub(l.start); expected > elapsed {
+		time.Sleep(expected - elapsed)
+	}
+	l.last = time.Now()
+}
+
+// throttledReader reads through a rate limiter
+type throttledReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.limiter.wait(n)
+	return n, err
+}
+
+// throttle returns r limited to the manager's read rate
+func (b *BackupManager) throttle(r io.Reader) io.Reader {
+	if b.readLimiter == nil {
+		return r
+	}
+	return &throttledReader{r: r, limiter: b.readLimiter}
+}
+
+// newCompressor returns the gzip writer for a compressed backup, compressing with
+// the manager's number of workers
+func (b *BackupManager) newCompressor(w io.Writer) io.WriteCloser {
+	if b.compressionWorkers <= 1 {
+		return gzip.NewWriter(w)
+	}
+	return newParallelGzipWriter(w, b.compressionWorkers)
+}
+
+// gzipBlock is a compressed block of a parallelGzipWriter
+type gzipBlock struct {
+	data []byte
+	err  error
+}
+
+// parallelGzipWriter compresses blocks of its input concurrently into separate
+// gzip members. The concatenated members are a valid gzip stream, which
+// gzip.Reader reads as one.
+type parallelGzipWriter struct {
+	w      io.Writer
+	buf    []byte
+	blocks int
+	sem    chan struct{}
+	order  chan chan gzipBlock
+	done   chan error
+	closed bool
+	err    error
+}
+
+func newParallelGzipWriter(w io.Writer, workers int) *parallelGzipWriter {
+	p := &parallelGzipWriter{
+		w:     w,
+		buf:   make([]byte, 0, gzipBlockSize),
+		sem:   make(chan struct{}, workers),
+		order: make(chan chan gzipBlock, workers),
+		done:  make(chan error, 1),
+	}
+	go p.writeBlocks()
+	return p
+}
+
+func (p *parallelGzipWriter) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		n := copy(p.buf[len(p.buf):cap(p.buf)], data)
+		p.buf = p.buf[:len(p.buf)+n]
+		data = data[n:]
+		written += n
+		if len(p.buf) == cap(p.buf) {
+			p.compressBlock()
+		}
+	}
+	return written, nil
+}
+
+// compressBlock hands the buffered input to a worker
+func (p *parallelGzipWriter) compressBlock() {
+	data := p.buf
+	p.buf = make([]byte, 0, gzipBlockSize)
+	p.blocks++
+
+	result := make(chan gzipBlock, 1)
+	p.sem <- struct{}{}
+	p.order <- result
+	go func() {
+		defer func() { <-p.sem }()
+		var out bytes.Buffer
+		zw := gzip.NewWriter(&out)
+		_, err := zw.Write(data)
+		if err == nil {
+			err = zw.Close()
+		}
+		result <- gzipBlock{data: out.Bytes(), err: err}
+	}()
+}
+
+// writeBlocks writes the compressed blocks in input order
+func (p *parallelGzipWriter) writeBlocks() {
+	var err error
+	for result := range p.order {
+		block := <-result
+		if err == nil {
+			err = block.err
+		}
+		if err == nil {
+			_, err = p.w.Write(block.data)
+		}
+	}
+	p.done <- err
+}
+
+// Close compresses the remaining input and waits for all blocks to be written
+func (p *parallelGzipWriter) Close() error {
+	if p.closed {
+		return p.err
+	}
+	p.closed = true
+
+	// An empty input still needs one member to be a gzip stream
+	if len(p.buf) > 0 || p.blocks == 0 {
+		p.compressBlock()
+	}
+	close(p.order)
+	p.err = <-p.done
+	return p.err
+}
@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestParallelGzipWriter(t *testing.T) {
+	for _, size := range []int{0, 100, gzipBlockSize, 3*gzipBlockSize + 17} {
+		input := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(input[:size/2])
+
+		var out bytes.Buffer
+		w := newParallelGzipWriter(&out, 4)
+		// Uneven writes cross block boundaries
+		for data := input; len(data) > 0; {
+			n := len(data)
+			if n > 100000 {
+				n = 100000
+			}
+			w.Write(data[:n])
+			data = data[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("size %d: failed to close: %v", size, err)
+		}
+
+		r, err := gzip.NewReader(&out)
+		if err != nil {
+			t.Fatalf("size %d: not a gzip stream: %v", size, err)
+		}
+		output, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(output, input) {
+			t.Errorf("size %d: round trip failed (%d bytes, %v)", size, len(output), err)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(0) != nil {
+		t.Error("Expected no limiter without a limit")
+	}
+
+	limiter := newRateLimiter(10)
+	r := &throttledReader{r: bytes.NewReader(make([]byte, 2<<20)), limiter: limiter}
+	start := time.Now()
+	io.Copy(io.Discard, r)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected 2 MB at 10 MB/s to take about 200ms, took %s", elapsed)
+	}
+}
+
+func TestThrottledBackup(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := pebble.Open(dbPath, &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.Set([]byte("key"), []byte("value"), pebble.Sync)
+
+	backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{
+		Compress:           true,
+		MaxReadMBps:        100,
+		CompressionWorkers: 4,
+	})
+	backup, err := backupManager.CreateBackup(db, "Throttled")
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	file, err := os.Open(backup.Path)
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Backup is not gzip: %v", err)
+	}
+	entries := 0
+	tr := tar.NewReader(gz)
+	for {
+		if _, err := tr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Backup is not a valid archive: %v", err)
+		}
+		entries++
+	}
+	if entries == 0 {
+		t.Error("Expected files in the backup archive")
+	}
+}
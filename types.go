@@ -2,6 +2,7 @@ package migrate
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,16 +17,51 @@ type SchemaVersion struct {
 	MigrationHistory  []MigrationRecord `json:"migration_history"`  // Historical record of migrations
 	LastMigrationAt   time.Time         `json:"last_migration_at"`
 	Status            Status            `json:"status"`
+	Revision          uint64            `json:"revision"`              // Incremented on every write, for optimistic concurrency control
+	Environment       string            `json:"environment,omitempty"` // Label of the environment the database belongs to, see StampEnvironment
+
+	// RunningMigrations are the IDs of the migrations being executed while the
+	// status is migrating, see MarkMigrationStarted. Empty in any other status.
+	RunningMigrations []string `json:"running_migrations,omitempty"`
+
+	// LastFailure is the failure that left the state dirty, with a suggested
+	// remediation. Nil in any other status.
+	LastFailure *MigrationFailure `json:"last_failure,omitempty"`
+
+	// lastHistoryKey is the timestamp key of the most recent stored history record
+	lastHistoryKey int64
 }
 
 // MigrationRecord tracks when and how a migration was applied
 type MigrationRecord struct {
-	ID          string    `json:"id"`          // Timestamp-based ID (e.g., "20250812_143022_description")
-	Description string    `json:"description"`
-	AppliedAt   time.Time `json:"applied_at"`
-	Duration    string    `json:"duration"`
-	Success     bool      `json:"success"`
-	Error       string    `json:"error,omitempty"`
+	ID           string        `json:"id"`   // Timestamp-based ID (e.g., "20250812_143022_description")
+	Type         RecordType    `json:"type"` // What happened to the migration
+	Description  string        `json:"description"`
+	AppliedAt    time.Time     `json:"applied_at"`
+	Duration     time.Duration `json:"duration_ns"` // How long the migration ran
+	DurationText string        `json:"duration"`    // Duration formatted for display
+	Success      bool          `json:"success"`
+	Error        string        `json:"error,omitempty"`
+	BestEffort   bool          `json:"best_effort,omitempty"` // The failure of a best-effort migration, which left the state clean
+}
+
+// RecordType is the kind of operation a history record describes
+type RecordType string
+
+const (
+	RecordApply    RecordType = "apply"    // The migration ran up
+	RecordRollback RecordType = "rollback" // The migration ran down
+	RecordRerun    RecordType = "rerun"    // The migration ran down and up again
+	RecordRepair   RecordType = "repair"   // Recorded by a repair of the schema state
+	RecordStamp    RecordType = "stamp"    // Marked as applied without running, e.g. on import
+	RecordBaseline RecordType = "baseline" // Marked as applied when initializing a fresh database
+	RecordRenamed  RecordType = "renamed"  // Applied under this ID, now an alias of another (see RegisterAlias)
+)
+
+// Applies reports whether a successful record of this type leaves the migration
+// applied
+func (t RecordType) Applies() bool {
+	return t != RecordRollback && t != RecordRenamed
 }
 
 // Status represents the current migration state
@@ -44,10 +80,78 @@ type Migration struct {
 	Version      int64         // Unix timestamp parsed from ID (e.g., 1736700000)
 	Dependencies []string      // IDs of migrations that must be applied before this one
 	Description  string
+	Owner        string // Author or team responsible for the migration, see MetadataPolicy
+	RunbookURL   string // Where operators find what to do if the migration fails
 	Up           MigrationFunc
 	Down         MigrationFunc
 	Validate     MigrationFunc
 	Rerunnable   bool          // If true, migration can be safely rerun if interrupted
+
+	// Sequence orders migrations generated within the same second. It is parsed
+	// from a <timestamp>.<seq>_<description> ID, and 0 for other IDs.
+	Sequence int64
+
+	// BestEffort marks a non-critical migration, e.g. a cleanup, whose failure
+	// must not block the application: the failure is recorded, the state stays
+	// clean and the plan continues without it and the migrations depending on it,
+	// which stay pending (see MigrationEngine.SkippedMigrations and
+	// SchemaVersion.BestEffortFailures). It runs again with the next plan, so it
+	// must be safe to rerun after a partial run.
+	BestEffort bool
+
+	// Priority orders migrations whose dependencies are met: among those, higher
+	// priorities run first and equal priorities run in timestamp order. Use it to run
+	// cheap critical fixes ahead of heavy backfills. Defaults to 0.
+	Priority int
+
+	// Apply is an alternative to Up that performs its writes through a Writer, so
+	// every key mutation is recorded in an operation log. When Apply is set, Up may
+	// be left nil and is derived from it, and Down may be left nil: the engine then
+	// stores the previous value of every key Apply touched and rolls the migration
+	// back by restoring them.
+	Apply WriterFunc
+
+	// UpContext, DownContext and ValidateContext are alternatives to Up, Down and
+	// Validate that receive a MigrationContext, with the logger, progress
+	// reporting, cancellation and metrics of the run. When set, the engine calls
+	// them instead, and Register derives the plain function from them if it is nil.
+	UpContext       ContextFunc
+	DownContext     ContextFunc
+	ValidateContext ContextFunc
+
+	// ValidateCursor checks the progress a chunked migration saved before it was
+	// interrupted, e.g. that the data up to its cursor is in place, before the
+	// engine resumes the migration in the same direction. An error fails the run
+	// with ErrInvalidCursor, leaving the progress for inspection.
+	ValidateCursor func(ctx *MigrationContext, progress *MigrationProgress) error
+
+	// ChunkPreImages makes the chunks of the migration (see MigrationContext.NewChunk)
+	// store the previous values of the keys they write, committed with each chunk.
+	// An abandoned partial run is then rolled back by restoring them instead of
+	// running Down (see MigrationEngine.AbandonMigration). It costs a read per write.
+	ChunkPreImages bool
+
+	// KeyPrefixes declares the key prefixes the migration reads and writes. Migrations
+	// with disjoint declared prefixes and no dependency on each other may run in
+	// parallel (see MigrationEngine.SetParallelism); overlapping prefixes without a
+	// dependency are reported as plan conflicts. Leave empty if unknown.
+	KeyPrefixes []string
+
+	// Introduces declares the key prefixes the migration creates and its Down
+	// removes. Keys left under them after the migration was rolled back are
+	// reported as orphans (see SchemaManager.FindOrphanedKeys).
+	Introduces []string
+
+	// Tags label the migration for plan policies, e.g. "heavy" for migrations that
+	// may only run with a backup (see RequireBackupPolicy)
+	Tags []string
+
+	// AllowInternalWrites disables the reserved key guard for this migration.
+	// Only set this for intentional maintenance of the internal migration metadata.
+	AllowInternalWrites bool
+
+	// checksumSource is hashed into the checksum, e.g. the steps of a script migration
+	checksumSource []byte
 }
 
 // MigrationFunc is the signature for migration functions
@@ -55,10 +159,23 @@ type MigrationFunc func(db *pebble.DB) error
 
 // MigrationRegistry manages all available migrations
 type MigrationRegistry struct {
-	migrations map[string]*Migration
-	ordered    []*Migration
+	migrations     map[string]*Migration
+	ordered        []*Migration
+	allowLegacyIDs bool
+	versionParser  VersionParser
+	uniqueVersions bool
+	metadataPolicy MetadataPolicy
+	aliases        map[string]string // Former migration IDs to current ones, see RegisterAlias
+	planValidators []planValidator   // Run after each plan, see RegisterPlanValidator
+
+	// loadedFactories tracks which migration factories were loaded into this registry
+	loadedFactories map[string]bool
 }
 
+// VersionParser parses the version from a migration ID. The parser decides which
+// IDs a registry accepts, and the versions it returns decide the execution order.
+type VersionParser func(migrationID string) (int64, error)
+
 // NewMigrationRegistry creates a new migration registry
 func NewMigrationRegistry() *MigrationRegistry {
 	return &MigrationRegistry{
@@ -77,26 +194,59 @@ func (r *MigrationRegistry) Register(m *Migration) error {
 	if m.ID == "" {
 		return fmt.Errorf("migration ID cannot be empty")
 	}
+	if target, isAlias := r.aliases[m.ID]; isAlias {
+		return fmt.Errorf("migration ID '%s' is registered as an alias of '%s'", m.ID, target)
+	}
+	if m.Apply != nil && m.UpContext != nil {
+		return fmt.Errorf("migration '%s' cannot have both Apply and UpContext", m.ID)
+	}
+	if m.Up == nil && m.Apply != nil {
+		m.Up = upFromApply(m.ID, m.Apply)
+	}
+	if m.Up == nil && m.UpContext != nil {
+		m.Up = WithoutContext(m.ID, "up", m.UpContext)
+	}
+	if m.Down == nil && m.DownContext != nil {
+		m.Down = WithoutContext(m.ID, "down", m.DownContext)
+	}
+	if m.Validate == nil && m.ValidateContext != nil {
+		m.Validate = WithoutContext(m.ID, "up", m.ValidateContext)
+	}
 	if m.Up == nil {
 		return fmt.Errorf("migration '%s' must have an Up function", m.ID)
 	}
-	if m.Down == nil {
-		return fmt.Errorf("migration '%s' must have a Down function", m.ID)
+	if m.Down == nil && m.Apply == nil {
+		return fmt.Errorf("migration '%s' must have a Down function (or use Apply for an automatic one)", m.ID)
+	}
+
+	for _, prefixes := range [][]string{m.KeyPrefixes, m.Introduces} {
+		for _, prefix := range prefixes {
+			if prefix == "" {
+				return fmt.Errorf("migration '%s' declares an empty key prefix", m.ID)
+			}
+		}
 	}
 
 	// Parse and validate Unix timestamp from ID
-	version, err := ParseMigrationVersion(m.ID)
+	version, err := r.parseVersion(m.ID)
 	if err != nil {
 		return fmt.Errorf("invalid migration ID format '%s': %w", m.ID, err)
 	}
+	if err := r.checkUniqueVersion(m, version); err != nil {
+		return err
+	}
+	if err := r.metadataPolicy.Check(m); err != nil {
+		return err
+	}
 	m.Version = version
+	m.Sequence = ParseMigrationSequence(m.ID)
 
 	r.migrations[m.ID] = m
 	r.ordered = append(r.ordered, m)
 
-	// Keep ordered by version (Unix timestamp)
+	// Keep ordered by version (Unix timestamp) and sequence
 	for i := len(r.ordered) - 1; i > 0; i-- {
-		if r.ordered[i].Version < r.ordered[i-1].Version {
+		if versionBefore(r.ordered[i], r.ordered[i-1]) {
 			r.ordered[i], r.ordered[i-1] = r.ordered[i-1], r.ordered[i]
 		} else {
 			break
@@ -106,6 +256,51 @@ func (r *MigrationRegistry) Register(m *Migration) error {
 	return nil
 }
 
+// SetAllowLegacyIDs controls whether IDs that predate strict ID validation are accepted.
+// Legacy IDs only need a valid timestamp prefix; the description is not checked.
+func (r *MigrationRegistry) SetAllowLegacyIDs(enabled bool) {
+	r.allowLegacyIDs = enabled
+}
+
+// SetVersionParser replaces the parser used to derive versions from migration IDs,
+// for example ParseSequentialMigrationVersion for goose-style IDs. A nil parser
+// restores the default. Migrations registered earlier are re-parsed and reordered;
+// an error is returned if any of them is not accepted by the new parser.
+func (r *MigrationRegistry) SetVersionParser(parser VersionParser) error {
+	previous := r.versionParser
+	r.versionParser = parser
+
+	versions := make(map[string]int64, len(r.ordered))
+	for _, m := range r.ordered {
+		version, err := r.parseVersion(m.ID)
+		if err != nil {
+			r.versionParser = previous
+			return fmt.Errorf("registered migration '%s' rejected by version parser: %w", m.ID, err)
+		}
+		versions[m.ID] = version
+	}
+
+	for _, m := range r.ordered {
+		m.Version = versions[m.ID]
+	}
+	sort.SliceStable(r.ordered, func(i, j int) bool {
+		return versionBefore(r.ordered[i], r.ordered[j])
+	})
+
+	return nil
+}
+
+// parseVersion parses a migration ID using the registry's validation mode
+func (r *MigrationRegistry) parseVersion(id string) (int64, error) {
+	if r.versionParser != nil {
+		return r.versionParser(id)
+	}
+	if r.allowLegacyIDs {
+		return ParseLegacyMigrationVersion(id)
+	}
+	return ParseMigrationVersion(id)
+}
+
 // GetMigration returns a migration by ID
 func (r *MigrationRegistry) GetMigration(id string) (*Migration, bool) {
 	m, exists := r.migrations[id]
@@ -124,6 +319,7 @@ func (r *MigrationRegistry) GetMigrations() []*Migration {
 // This ensures a deterministic and chronological execution order.
 func (r *MigrationRegistry) GetPendingMigrations(appliedMigrations map[string]bool) ([]*Migration, error) {
 	var pending []*Migration
+	appliedMigrations = r.resolveApplied(appliedMigrations)
 
 	// First collect all pending migrations
 	for _, m := range r.ordered {
@@ -154,36 +350,160 @@ func (r *MigrationRegistry) GetMigrationsInVersionRange(fromVersion, toVersion i
 	return result
 }
 
-// ParseMigrationVersion parses Unix timestamp version from migration ID
-// Expected format: <unix_timestamp>_<description>
-// Example: 1736700000_marketmeta_migration
+// MaxMigrationIDLength is the maximum length of a migration ID
+const MaxMigrationIDLength = 128
+
+// reservedIDSuffixes are used internally to mark rollback and rerun history records
+var reservedIDSuffixes = []string{"_rollback", "_rerun"}
+
+// ParseMigrationVersion parses Unix timestamp version from migration ID and
+// enforces the migration ID grammar:
+//
+//	<unix_timestamp>[.<sequence>]_<description>
+//
+// where:
+//   - timestamp: digits only, between years 2000 and 2100
+//   - sequence: optional positive number ordering migrations generated within
+//     the same second, e.g. by codegen (see ParseMigrationSequence)
+//   - description: non-empty, only ASCII letters, digits, '_' and '-'
+//   - at most MaxMigrationIDLength characters in total
+//   - must not end with a reserved suffix (_rollback, _rerun)
+//
+// Examples: 1736700000_marketmeta_migration, 1736700000.2_add_index
 func ParseMigrationVersion(migrationID string) (int64, error) {
-	// Split on first underscore
-	parts := strings.SplitN(migrationID, "_", 2)
-	if len(parts) != 2 {
-		return 0, fmt.Errorf("migration ID must follow format <timestamp>_<description>")
+	version, err := ParseLegacyMigrationVersion(migrationID)
+	if err != nil {
+		return 0, err
 	}
 
-	// Parse Unix timestamp
-	version, err := strconv.ParseInt(parts[0], 10, 64)
+	if err := validateIDDescription(migrationID); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// ParseSequentialMigrationVersion parses goose-style sequential IDs such as
+// 00001_add_index, where the prefix is a positive sequence number. Unix timestamp
+// IDs are accepted as well, so both styles can be mixed in one registry; sequential
+// migrations then order before timestamped ones. The description follows the same
+// rules as ParseMigrationVersion.
+func ParseSequentialMigrationVersion(migrationID string) (int64, error) {
+	version, err := parseVersionPrefix(migrationID)
 	if err != nil {
-		return 0, fmt.Errorf("invalid timestamp in migration ID: %w", err)
+		return 0, err
+	}
+	if version <= 0 {
+		return 0, fmt.Errorf("%w: sequence number must be positive", ErrInvalidMigrationID)
+	}
+
+	if err := validateIDDescription(migrationID); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// validateIDDescription checks the length, description and suffix rules of the
+// migration ID grammar. The version prefix must already have been validated.
+func validateIDDescription(migrationID string) error {
+	if len(migrationID) > MaxMigrationIDLength {
+		return fmt.Errorf("%w: ID is %d characters long, maximum is %d",
+			ErrInvalidMigrationID, len(migrationID), MaxMigrationIDLength)
+	}
+
+	description := strings.SplitN(migrationID, "_", 2)[1]
+	if description == "" {
+		return fmt.Errorf("%w: description must not be empty", ErrInvalidMigrationID)
+	}
+	for _, c := range description {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !isDigit && c != '_' && c != '-' {
+			return fmt.Errorf("%w: description contains invalid character %q (allowed: letters, digits, '_', '-')",
+				ErrInvalidMigrationID, c)
+		}
+	}
+
+	for _, suffix := range reservedIDSuffixes {
+		if strings.HasSuffix(migrationID, suffix) {
+			return fmt.Errorf("%w: suffix %q is reserved", ErrInvalidMigrationID, suffix)
+		}
+	}
+
+	return nil
+}
+
+// ValidateMigrationID checks that a migration ID follows the migration ID grammar
+// described on ParseMigrationVersion
+func ValidateMigrationID(migrationID string) error {
+	_, err := ParseMigrationVersion(migrationID)
+	return err
+}
+
+// ParseLegacyMigrationVersion parses the Unix timestamp version from a migration ID
+// without enforcing the description grammar. It accepts IDs created before strict
+// validation was introduced and is used when reading IDs back from stored state.
+func ParseLegacyMigrationVersion(migrationID string) (int64, error) {
+	version, err := parseVersionPrefix(migrationID)
+	if err != nil {
+		return 0, err
 	}
 
 	// Validate it's a reasonable Unix timestamp (between year 2000 and 2100)
 	if version < 946684800 || version > 4102444800 {
-		return 0, fmt.Errorf("timestamp %d is outside valid range (2000-2100)", version)
+		return 0, fmt.Errorf("%w: timestamp %d is outside valid range (2000-2100)", ErrInvalidMigrationID, version)
 	}
 
 	return version, nil
 }
 
+// parseVersionPrefix parses the numeric prefix of a <number>[.<sequence>]_<description>
+// ID without checking its range
+func parseVersionPrefix(migrationID string) (int64, error) {
+	// Split on first underscore
+	parts := strings.SplitN(migrationID, "_", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("%w: migration ID must follow format <timestamp>_<description>", ErrInvalidMigrationID)
+	}
+
+	if prefix, sequence, ok := strings.Cut(parts[0], "."); ok {
+		if !isDigits(sequence) {
+			return 0, fmt.Errorf("%w: sequence %q must only contain digits", ErrInvalidMigrationID, sequence)
+		}
+		if n, err := strconv.ParseInt(sequence, 10, 64); err != nil || n <= 0 {
+			return 0, fmt.Errorf("%w: sequence %q must be a positive number", ErrInvalidMigrationID, sequence)
+		}
+		parts[0] = prefix
+	}
+
+	// Only plain digits are accepted; strconv would also accept a leading sign
+	if parts[0] == "" {
+		return 0, fmt.Errorf("%w: version prefix must not be empty", ErrInvalidMigrationID)
+	}
+	for _, c := range parts[0] {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%w: timestamp %q must only contain digits", ErrInvalidMigrationID, parts[0])
+		}
+	}
+
+	version, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid timestamp in migration ID: %v", ErrInvalidMigrationID, err)
+	}
 
-// FormatVersionAsTime converts Unix timestamp to human-readable time
+	return version, nil
+}
+
+// FormatVersionAsTime converts Unix timestamp to human-readable time.
+// Versions below the timestamp range come from sequential IDs and are shown as such.
 func FormatVersionAsTime(version int64) string {
 	if version == 0 {
 		return "(no migrations)"
 	}
+	if version < 946684800 {
+		return "sequential"
+	}
 	return time.Unix(version, 0).UTC().Format("2006-01-02 15:04:05 UTC")
 }
 
@@ -208,6 +528,7 @@ func (r *MigrationRegistry) topologicalSort(migrations []*Migration, appliedMigr
 	// Build edges and calculate in-degrees
 	for _, m := range migrations {
 		for _, depID := range m.Dependencies {
+			depID = r.ResolveID(depID)
 			// Only count dependency if it's not already applied
 			if !appliedMigrations[depID] {
 				// Check if dependency exists in our pending set
@@ -240,18 +561,18 @@ func (r *MigrationRegistry) topologicalSort(migrations []*Migration, appliedMigr
 		}
 	}
 
-	// Process migrations, always picking the one with lowest timestamp from ready set
+	// Process migrations, always picking the first by (priority, timestamp) from ready set
 	for len(ready) > 0 {
-		// Sort ready migrations by timestamp to maintain chronological order when possible
+		// Sort ready migrations by priority, then timestamp to maintain chronological order when possible
 		for i := 0; i < len(ready)-1; i++ {
 			for j := i + 1; j < len(ready); j++ {
-				if ready[i].Version > ready[j].Version {
+				if runsBefore(ready[j], ready[i]) {
 					ready[i], ready[j] = ready[j], ready[i]
 				}
 			}
 		}
 
-		// Take the migration with lowest timestamp
+		// Take the migration with highest priority and lowest timestamp
 		current := ready[0]
 		ready = ready[1:]
 
@@ -287,3 +608,52 @@ const (
 	SchemaVersionKey = "__schema_version__"
 	MigrationPrefix  = "__migration_"
 )
+
+// ParseMigrationSequence returns the sequence of a <timestamp>.<sequence>_<description>
+// ID, or 0 for IDs without one. Migrations with the same timestamp run in
+// sequence order, those without a sequence first.
+func ParseMigrationSequence(migrationID string) int64 {
+	prefix := strings.SplitN(migrationID, "_", 2)[0]
+	_, sequence, ok := strings.Cut(prefix, ".")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseInt(sequence, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// versionBefore reports whether migration a has a lower version than b, comparing
+// sequences within the same timestamp
+func versionBefore(a, b *Migration) bool {
+	if a.Version != b.Version {
+		return a.Version < b.Version
+	}
+	return a.Sequence < b.Sequence
+}
+
+// runsBefore reports whether a ready migration a is executed before a ready migration b
+func runsBefore(a, b *Migration) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.Version != b.Version || a.Sequence != b.Sequence {
+		return versionBefore(a, b)
+	}
+	return a.ID < b.ID
+}
@@ -0,0 +1,78 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// undoLogInfix follows the key prefix in the keys recorded undo logs are stored under
+const undoLogInfix = "undo_"
+
+// HasAutomaticDown reports whether the migration is rolled back by inverting the
+// key mutations its Apply function recorded, because it has no Down function
+func (m *Migration) HasAutomaticDown() bool {
+	return m.Down == nil && m.Apply != nil
+}
+
+// undoLogKey returns the internal key the undo log of a migration is stored under
+func (s *SchemaManager) undoLogKey(migrationID string) []byte {
+	return []byte(s.keyPrefix + undoLogInfix + migrationID)
+}
+
+// SaveUndoLog stores the operation log of an applied migration in the internal
+// namespace, so the migration can be rolled back after a restart
+func (s *SchemaManager) SaveUndoLog(log *OpLog) error {
+	data, err := log.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := s.db.Set(s.undoLogKey(log.MigrationID), data, pebble.Sync); err != nil {
+		return fmt.Errorf("failed to save undo log for %s: %w", log.MigrationID, err)
+	}
+	return nil
+}
+
+// LoadUndoLog returns the stored undo log of a migration, or ErrNoUndoLog
+func (s *SchemaManager) LoadUndoLog(migrationID string) (*OpLog, error) {
+	data, err := getCopy(s.db, s.undoLogKey(migrationID))
+	if err == pebble.ErrNotFound {
+		return nil, fmt.Errorf("%w for migration %s", ErrNoUndoLog, migrationID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read undo log for %s: %w", migrationID, err)
+	}
+
+	log := &OpLog{}
+	if err := log.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// DeleteUndoLog removes the stored undo log of a migration
+func (s *SchemaManager) DeleteUndoLog(migrationID string) error {
+	if err := s.db.Delete(s.undoLogKey(migrationID), pebble.Sync); err != nil {
+		return fmt.Errorf("failed to delete undo log for %s: %w", migrationID, err)
+	}
+	return nil
+}
+
+// undoRecorded rolls a migration back by inverting its stored undo log. An undo that
+// already completed (for example before an interrupted rollback) is not repeated.
+func (s *SchemaManager) undoRecorded(migrationID string, force bool) error {
+	log, err := s.LoadUndoLog(migrationID)
+	if err != nil {
+		return err
+	}
+
+	undone, err := checkStates(s.db, log.initialStates())
+	if err != nil {
+		return err
+	}
+	if len(undone) == 0 {
+		return nil
+	}
+
+	return log.Undo(s.db, force)
+}
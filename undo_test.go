@@ -0,0 +1,167 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestAutomaticDown(t *testing.T) {
+	getValue := func(t *testing.T, db *pebble.DB, key string) (string, bool) {
+		value, closer, err := db.Get([]byte(key))
+		if err == pebble.ErrNotFound {
+			return "", false
+		}
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", key, err)
+		}
+		defer closer.Close()
+		return string(value), true
+	}
+
+	newRegistry := func(t *testing.T) *MigrationRegistry {
+		registry := NewMigrationRegistry()
+		err := registry.Register(&Migration{
+			ID: "1754917200_rename",
+			Apply: func(w *Writer) error {
+				value, err := w.Get([]byte("old"))
+				if err != nil {
+					return err
+				}
+				if err := w.Set([]byte("new"), value); err != nil {
+					return err
+				}
+				return w.Delete([]byte("old"))
+			},
+		})
+		if err != nil {
+			t.Fatalf("Expected migration without Down to register: %v", err)
+		}
+		return registry
+	}
+
+	// open opens the database with a fresh engine, as after a process restart
+	open := func(t *testing.T, dbPath string, registry *MigrationRegistry) (*pebble.DB, *SchemaManager, *MigrationEngine) {
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupEnabled(false)
+		return db, schemaManager, engine
+	}
+
+	// migrate seeds the database, applies the migration and closes the database
+	migrate := func(t *testing.T, registry *MigrationRegistry) string {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, schemaManager, engine := open(t, dbPath, registry)
+		defer db.Close()
+
+		db.Set([]byte("old"), []byte("value"), pebble.Sync)
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Migration failed: %v", err)
+		}
+		if _, err := schemaManager.LoadUndoLog("1754917200_rename"); err != nil {
+			t.Fatalf("Expected undo log to be stored: %v", err)
+		}
+		return dbPath
+	}
+
+	t.Run("RollbackAfterRestart", func(t *testing.T) {
+		registry := newRegistry(t)
+		dbPath := migrate(t, registry)
+
+		db, schemaManager, engine := open(t, dbPath, registry)
+		defer db.Close()
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanDowngrade(0)
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Rollback failed: %v", err)
+		}
+
+		if v, ok := getValue(t, db, "old"); !ok || v != "value" {
+			t.Errorf("Expected old key restored, got %q", v)
+		}
+		if _, ok := getValue(t, db, "new"); ok {
+			t.Error("Expected new key removed")
+		}
+		if _, err := schemaManager.LoadUndoLog("1754917200_rename"); !errors.Is(err, ErrNoUndoLog) {
+			t.Errorf("Expected undo log to be deleted after rollback, got %v", err)
+		}
+	})
+
+	t.Run("ConflictingChange", func(t *testing.T) {
+		registry := newRegistry(t)
+		dbPath := migrate(t, registry)
+
+		db, schemaManager, engine := open(t, dbPath, registry)
+		defer db.Close()
+		db.Set([]byte("new"), []byte("changed"), pebble.Sync)
+
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanDowngrade(0)
+		if err := engine.ExecutePlan(plan, nil); !errors.Is(err, ErrOpLogConflict) {
+			t.Fatalf("Expected conflict, got %v", err)
+		}
+		if v, _ := getValue(t, db, "new"); v != "changed" {
+			t.Errorf("Expected conflicting key untouched, got %q", v)
+		}
+
+	})
+
+	t.Run("ForcedUndo", func(t *testing.T) {
+		registry := newRegistry(t)
+		dbPath := migrate(t, registry)
+
+		db, schemaManager, engine := open(t, dbPath, registry)
+		defer db.Close()
+		db.Set([]byte("new"), []byte("changed"), pebble.Sync)
+
+		engine.SetForceUndo(true)
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanDowngrade(0)
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Forced rollback failed: %v", err)
+		}
+		if v, _ := getValue(t, db, "old"); v != "value" {
+			t.Errorf("Expected old key restored, got %q", v)
+		}
+		if _, ok := getValue(t, db, "new"); ok {
+			t.Error("Expected new key removed")
+		}
+	})
+
+	t.Run("ScriptWithoutDownSteps", func(t *testing.T) {
+		dir := t.TempDir()
+		script := `{"up": [{"op": "set", "values": {"config:mode": "strict"}}]}`
+		if err := os.WriteFile(filepath.Join(dir, "1754917200_mode.json"), []byte(script), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		registry := NewMigrationRegistry()
+		if err := NewDiscoveryService(dir, registry).LoadMigrations(); err != nil {
+			t.Fatalf("Failed to load script: %v", err)
+		}
+
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, schemaManager, engine := open(t, dbPath, registry)
+		defer db.Close()
+		db.Set([]byte("config:mode"), []byte("lenient"), pebble.Sync)
+
+		planner := NewMigrationPlanner(registry, schemaManager)
+		plan, _ := planner.PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Migration failed: %v", err)
+		}
+		plan, _ = planner.PlanDowngrade(0)
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Rollback failed: %v", err)
+		}
+		if v, _ := getValue(t, db, "config:mode"); v != "lenient" {
+			t.Errorf("Expected previous value restored, got %q", v)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// valueDecoders maps key prefixes to the names of the codecs rendering their
+// values; it is guarded by codecsMu
+var valueDecoders = map[string]string{}
+
+// RegisterValueDecoder makes the values of the keys under prefix render with the
+// codec registered under name, see RegisterCodec, wherever values are shown:
+// dry run changes, exports with Decode, ListKeys and sample validation failures.
+// A codec could unmarshal a protobuf message and marshal it as JSON, for example.
+// The decoder of the longest matching prefix applies.
+func RegisterValueDecoder(prefix, name string) error {
+	if _, ok := lookupCodec(name); !ok {
+		return fmt.Errorf("unknown codec %q", name)
+	}
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if existing, exists := valueDecoders[prefix]; exists {
+		return fmt.Errorf("prefix %q already decoded with codec '%s'", prefix, existing)
+	}
+	valueDecoders[prefix] = name
+	return nil
+}
+
+// ValueDecoders returns the registered value decoders as prefix=codec pairs,
+// sorted by prefix
+func ValueDecoders() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	decoders := make([]string, 0, len(valueDecoders))
+	for prefix, name := range valueDecoders {
+		decoders = append(decoders, prefix+"="+name)
+	}
+	sort.Strings(decoders)
+	return decoders
+}
+
+// valueDecoder returns the name and codec of the decoder for key, or a nil codec
+// if no decoder's prefix matches
+func valueDecoder(key []byte) (string, ValueCodec) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	best, found := "", false
+	for prefix := range valueDecoders {
+		if strings.HasPrefix(string(key), prefix) && (!found || len(prefix) > len(best)) {
+			best, found = prefix, true
+		}
+	}
+	if !found {
+		return "", nil
+	}
+	name := valueDecoders[best]
+	return name, codecs[name]
+}
+
+// DecodeValue returns value as rendered by the decoder registered for key, and
+// whether a decoder applied
+func DecodeValue(key, value []byte) ([]byte, bool, error) {
+	name, codec := valueDecoder(key)
+	if codec == nil {
+		return value, false, nil
+	}
+	decoded, err := codec(key, value)
+	if err != nil {
+		return nil, true, fmt.Errorf("codec %s failed on key %q: %w", name, key, err)
+	}
+	return decoded, true, nil
+}
+
+// RenderValue returns value in human-readable form: decoded with the decoder
+// registered for key, see RegisterValueDecoder, and as is if that yields text,
+// or else quoted. A value failing to decode is quoted with the error.
+func RenderValue(key, value []byte) string {
+	decoded, ok, err := DecodeValue(key, value)
+	if err != nil {
+		return fmt.Sprintf("%q (%v)", value, err)
+	}
+	if ok && utf8.Valid(decoded) {
+		return string(decoded)
+	}
+	return fmt.Sprintf("%q", decoded)
+}
@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+func TestValueDecoders(t *testing.T) {
+	if err := RegisterCodec("test_upper", func(key, value []byte) ([]byte, error) {
+		if bytes.HasPrefix(value, []byte("bad")) {
+			return nil, fmt.Errorf("not decodable")
+		}
+		return bytes.ToUpper(value), nil
+	}); err != nil {
+		t.Fatalf("Failed to register codec: %v", err)
+	}
+	if err := RegisterValueDecoder("vd/", "hex_encode"); err != nil {
+		t.Fatalf("Failed to register decoder: %v", err)
+	}
+	if err := RegisterValueDecoder("vd/text/", "test_upper"); err != nil {
+		t.Fatalf("Failed to register decoder: %v", err)
+	}
+	if err := RegisterValueDecoder("vd/", "test_upper"); err == nil {
+		t.Errorf("Expected registering a prefix twice to fail")
+	}
+	if err := RegisterValueDecoder("other/", "missing_codec"); err == nil {
+		t.Errorf("Expected registering an unknown codec to fail")
+	}
+
+	// The longest matching prefix applies; keys without a decoder are quoted
+	for _, tc := range []struct{ key, value, want string }{
+		{"vd/text/1", "hello", "HELLO"},
+		{"vd/1", "hi", "6869"},
+		{"plain", "a\x00b", `"a\x00b"`},
+		{"vd/text/2", "bad value", `"bad value" (codec test_upper failed on key "vd/text/2": not decodable)`},
+	} {
+		if got := RenderValue([]byte(tc.key), []byte(tc.value)); got != tc.want {
+			t.Errorf("RenderValue(%q) = %s, want %s", tc.key, got, tc.want)
+		}
+	}
+
+	db, err := pebble.Open(filepath.Join(t.TempDir(), "test.db"), &pebble.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	schemaManager := NewSchemaManager(db)
+	if err := schemaManager.InitializeFreshDatabase(NewMigrationRegistry()); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	for _, key := range []string{"vd/text/a", "vd/text/b", "vd/text/c"} {
+		if err := db.Set([]byte(key), []byte(key[len(key)-1:]), pebble.Sync); err != nil {
+			t.Fatalf("Failed to set: %v", err)
+		}
+	}
+
+	keys, more, err := schemaManager.ListKeys([]byte("vd/"), 2)
+	if err != nil {
+		t.Fatalf("Failed to list keys: %v", err)
+	}
+	if len(keys) != 2 || !more || string(keys[0].Key) != "vd/text/a" {
+		t.Errorf("Expected the first 2 of 3 keys, got %d keys, more %v", len(keys), more)
+	}
+	if keys, more, _ := schemaManager.ListKeys(nil, 0); len(keys) != 3 || more {
+		t.Errorf("Expected every key without the internal ones, got %d keys, more %v", len(keys), more)
+	}
+
+	// Exports with Decode render values and cannot be imported
+	var out bytes.Buffer
+	if _, err := schemaManager.ExportKeys(&out, ExportOptions{Prefix: []byte("vd/text/a"), Decode: true}); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != `{"key":"vd/text/a","value":"A"}` {
+		t.Errorf("Unexpected decoded export: %s", got)
+	}
+	if _, err := schemaManager.ImportKeys(&out, ExportOptions{Decode: true}); err == nil {
+		t.Errorf("Expected importing a decoded export to fail")
+	}
+
+	// Sample validation failures show decoded values
+	err = ValidateSample(db, []byte("vd/text/"), SampleOptions{Size: 10}, func(key, value []byte) error {
+		if string(value) == "b" {
+			return fmt.Errorf("unexpected value")
+		}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), `"vd/text/b": unexpected value (value B)`) {
+		t.Errorf("Expected the failure to show the decoded value, got %v", err)
+	}
+}
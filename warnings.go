@@ -0,0 +1,86 @@
+package migrate
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxWarnings is how many warnings an engine or backup manager keeps
+const maxWarnings = 100
+
+// Warning is a soft failure: something that went wrong without failing the
+// operation it happened in, e.g. removing old backups after a new backup was
+// created. Warnings are logged and collected, see MigrationEngine.Warnings and
+// BackupManager.Warnings, so that callers can surface or alert on them.
+type Warning struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"` // What raised it, e.g. "backup cleanup" or "audit"
+	Message string    `json:"message"`
+}
+
+// String returns the source and message of the warning
+func (w Warning) String() string {
+	return w.Source + ": " + w.Message
+}
+
+// WarningLogger is implemented by loggers with a warning level. Warnings are
+// written to a logger with Warnf if it implements it, and otherwise with Printf
+// prefixed with "Warning: ".
+type WarningLogger interface {
+	// Warnf logs a formatted message at warning level
+	Warnf(format string, args ...interface{})
+}
+
+// logWarning writes a warning to logger
+func logWarning(logger Logger, w Warning) {
+	if wl, ok := logger.(WarningLogger); ok {
+		wl.Warnf("%s", w.Message)
+		return
+	}
+	logger.Printf("Warning: %s", w.Message)
+}
+
+// warningLog collects the last maxWarnings warnings; it is safe for concurrent use
+type warningLog struct {
+	mu       sync.Mutex
+	warnings []Warning
+	total    int // Number of warnings ever added, for since
+}
+
+// add adds a warning, dropping the oldest beyond maxWarnings
+func (l *warningLog) add(w Warning) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, w)
+	if len(l.warnings) > maxWarnings {
+		l.warnings = append([]Warning(nil), l.warnings[len(l.warnings)-maxWarnings:]...)
+	}
+	l.total++
+}
+
+// mark returns a position to pass to since
+func (l *warningLog) mark() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// since returns the warnings added after mark that are still kept
+func (l *warningLog) since(mark int) []Warning {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	first := len(l.warnings) - (l.total - mark)
+	if first < 0 {
+		first = 0
+	}
+	if first >= len(l.warnings) {
+		return nil
+	}
+	return append([]Warning(nil), l.warnings[first:]...)
+}
+
+// newWarning returns a warning raised now
+func newWarning(source, format string, args ...interface{}) Warning {
+	return Warning{Time: time.Now(), Source: source, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// warnLogger records the messages logged at each level
+type warnLogger struct {
+	NopLogger
+	warnings []string
+}
+
+func (l *warnLogger) Warnf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestWarnings(t *testing.T) {
+	t.Run("KeepsTheLast", func(t *testing.T) {
+		var log warningLog
+		mark := log.mark()
+		for i := 0; i < maxWarnings+5; i++ {
+			log.add(newWarning("test", "warning %d", i))
+		}
+		all := log.since(0)
+		if len(all) != maxWarnings || all[0].Message != "warning 5" {
+			t.Errorf("Expected the last %d warnings, got %d starting with %v", maxWarnings, len(all), all[0])
+		}
+		if since := log.since(mark); len(since) != maxWarnings {
+			t.Errorf("Expected the kept warnings since the mark, got %d", len(since))
+		}
+		last := log.mark()
+		log.add(newWarning("test", "new"))
+		if since := log.since(last); len(since) != 1 || since[0].String() != "test: new" {
+			t.Errorf("Expected only the new warning, got %v", since)
+		}
+	})
+
+	t.Run("RestoreReport", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		schemaManager := NewSchemaManager(db)
+		if err := schemaManager.UpdateSchemaAfterMigration("1754917200_first", 1754917200, "First", 0); err != nil {
+			t.Fatalf("Failed to update schema: %v", err)
+		}
+
+		logger := &warnLogger{}
+		backupManager := NewBackupManagerWithOptions(dbPath, BackupOptions{})
+		backupManager.SetLogger(logger)
+		backup, err := backupManager.CreateBackup(db, "test")
+		if err != nil {
+			t.Fatalf("Failed to create backup: %v", err)
+		}
+		db.Close()
+
+		// Metadata claiming another version makes the restore warn
+		backup.Version = 1754917300
+		if err := backupManager.writeBackupMetadata(backup); err != nil {
+			t.Fatalf("Failed to write metadata: %v", err)
+		}
+		report, err := backupManager.RestoreBackupWithReport(backup.Path)
+		if err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		if len(report.Warnings) != 1 || report.Warnings[0].Source != "restore" ||
+			!strings.Contains(report.Warnings[0].Message, "differs from the backup version") {
+			t.Errorf("Expected a version warning in the report, got %v", report.Warnings)
+		}
+		if warnings := backupManager.Warnings(); len(warnings) != 1 {
+			t.Errorf("Expected the manager to keep the warning, got %v", warnings)
+		}
+		if len(logger.warnings) != 1 || logger.warnings[0] != report.Warnings[0].Message {
+			t.Errorf("Expected the warning to be logged with Warnf, got %v", logger.warnings)
+		}
+	})
+
+	t.Run("EnginePlan", func(t *testing.T) {
+		dir := t.TempDir()
+		dbPath := filepath.Join(dir, "test.db")
+		db, err := pebble.Open(dbPath, &pebble.Options{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		noop := func(db *pebble.DB) error { return nil }
+		registry := NewMigrationRegistry()
+		if err := registry.Register(&Migration{ID: "1754917200_first", Up: noop, Down: noop}); err != nil {
+			t.Fatalf("Failed to register: %v", err)
+		}
+		schemaManager := NewSchemaManager(db)
+		engine := NewMigrationEngineWithBackup(db, schemaManager, registry, dbPath)
+		engine.SetBackupEnabled(false)
+
+		// A standby that cannot be synced does not fail the plan
+		standby := filepath.Join(dir, "standby")
+		if err := os.WriteFile(standby, []byte("not a database"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		engine.SetStandby(standby)
+
+		var reported []string
+		plan, _ := NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		err = engine.ExecutePlan(plan, func(message string) {
+			if strings.HasPrefix(message, "Warning: ") {
+				reported = append(reported, message)
+			}
+		})
+		if err != nil {
+			t.Fatalf("Expected the plan to succeed, got %v", err)
+		}
+		warnings := engine.Warnings()
+		if len(warnings) != 1 || warnings[0].Source != "standby" {
+			t.Fatalf("Expected a standby warning, got %v", warnings)
+		}
+		if len(reported) != 1 || reported[0] != "Warning: "+warnings[0].Message {
+			t.Errorf("Expected the warning to be reported as progress, got %v", reported)
+		}
+
+		// The next plan starts without warnings
+		engine.SetStandby("")
+		plan, _ = NewMigrationPlanner(registry, schemaManager).PlanUpgrade()
+		if err := engine.ExecutePlan(plan, nil); err != nil {
+			t.Fatalf("Failed to execute plan: %v", err)
+		}
+		if warnings := engine.Warnings(); len(warnings) != 0 {
+			t.Errorf("Expected no warnings, got %v", warnings)
+		}
+	})
+}